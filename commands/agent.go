@@ -3,8 +3,8 @@ package commands
 import (
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
-	"time"
 
 	"github.com/github/hub/v2/opencog"
 	"github.com/github/hub/v2/ui"
@@ -21,9 +21,30 @@ var cmdAgent = &Command{
 	list       List all registered agents
 	start      Start an agent
 	stop       Stop an agent
+	pause      Pause a running agent
+	resume     Resume a paused agent
 	status     Show agent status and metrics
 	remove     Remove an agent
 	types      List available agent types
+	config     Show or edit an agent's configuration
+	events     Show an agent's event history
+	daemon     Run the orchestrator in the foreground
+	knowledge  Import or export the knowledge of an AtomSpace agent
+	query      Ask an AtomSpace agent a question
+	infer      Reason with a PLN agent
+	stimulate  Give stimulus to atoms through an ECAN agent
+	psi        Inspect and drive an OpenPsi agent
+	mine       Mine frequent patterns with a pattern miner agent
+	ingest     Add the current repository to an AtomSpace agent
+	graph      Draw the agents or their knowledge as a graph
+	workflow   Run pipelines chaining agents
+	schedule   Run agent commands and workflows on cron schedules
+	webhook    Send GitHub events to agents
+	reflect    Assess the agents with a reflection agent
+	heartbeat  Record a heartbeat of an agent
+	tune       Inspect and drive a meta-learning agent
+	broker     Inspect and drive the routing of a broker agent
+	cluster    Show the cluster the agent daemon takes part in
 
 ## Examples:
 
@@ -39,21 +60,34 @@ var cmdAgent = &Command{
 	# Start an agent
 	$ hub agent start my-atomspace
 
+	# Pause and resume an agent
+	$ hub agent pause my-atomspace
+	$ hub agent resume my-atomspace
+
 	# Stop an agent
 	$ hub agent stop my-atomspace
 
 	# Remove an agent
 	$ hub agent remove my-atomspace
 
+	# Change a configuration option
+	$ hub agent config my-atomspace --set max_atoms=5000
+
+	# Show who started, stopped or reconfigured an agent
+	$ hub agent events my-atomspace
+
 	# List available agent types
 	$ hub agent types
+
+	# Show the configuration options accepted by an agent type
+	$ hub agent types ecan
 `,
 }
 
 var cmdAgentCreate = &Command{
 	Key:   "create",
 	Run:   agentCreate,
-	Usage: "agent create --name <NAME> --type <TYPE> [--repo <URL>] [--branch <BRANCH>]",
+	Usage: "agent create --name <NAME> --type <TYPE> [--repo <URL>] [--branch <BRANCH>] [--set <KEY>=<VALUE>...] [--endpoint <URL>] [--liveness <PROBE>] [--readiness <PROBE>] [--probe-interval <DURATION>] [--probe-timeout <DURATION>] [--failure-threshold <N>] [--cpu-limit <SECONDS>] [--memory-limit <SIZE>] [--files-limit <N>] [--time-limit <DURATION>]",
 	Long:  `Create a new cognitive agent.`,
 	KnownFlags: `
 	--name <NAME>
@@ -67,6 +101,45 @@ var cmdAgentCreate = &Command{
 
 	--branch <BRANCH>
 		Git branch (optional, default: main)
+
+	--set <KEY>=<VALUE>
+		Set a configuration option (may be given multiple times). Options are
+		validated against the agent type; see ''hub agent types <TYPE>''.
+
+	--endpoint <URL>
+		Address the agent serves on; HTTP and TCP probes connect to it.
+
+	--liveness <PROBE>
+		Probe that decides whether the agent is alive. <PROBE> is one of
+		''exec:<COMMAND>'', ''http:[<PORT>][/<PATH>]'', ''tcp:<PORT>'' or
+		''heartbeat''. Defaults to the agent type's health check.
+
+	--readiness <PROBE>
+		Probe that decides whether the agent is ready to receive work.
+
+	--probe-interval <DURATION>
+		Time between probes (default: 10s).
+
+	--probe-timeout <DURATION>
+		Time a single probe may take (default: 2s).
+
+	--failure-threshold <N>
+		Consecutive probe failures before an agent is considered dead or not
+		ready (default: 3).
+
+	--cpu-limit <SECONDS>
+		CPU time the agent process may consume before it is killed.
+
+	--memory-limit <SIZE>
+		Memory the agent process may use, e.g. ''512M'' or ''2G''. Enforced
+		with a cgroup where one can be created, and otherwise by limiting the
+		data segment of the process.
+
+	--files-limit <N>
+		Number of files the agent process may have open at once.
+
+	--time-limit <DURATION>
+		Wall-clock time the agent may run before the daemon stops it.
 `,
 }
 
@@ -101,25 +174,58 @@ var cmdAgentStop = &Command{
 	Long:  `Stop an agent.`,
 }
 
-var cmdAgentStatus = &Command{
-	Key:   "status",
-	Run:   agentStatus,
-	Usage: "agent status <name>",
-	Long:  `Show agent status and metrics.`,
+var cmdAgentPause = &Command{
+	Key:   "pause",
+	Run:   agentPause,
+	Usage: "agent pause <name>",
+	Long: `Pause a running agent.
+
+An agent process is suspended with SIGSTOP, and the orchestrator holds
+messages addressed to the agent until it is resumed.`,
+}
+
+var cmdAgentResume = &Command{
+	Key:   "resume",
+	Run:   agentResume,
+	Usage: "agent resume <name>",
+	Long: `Resume a paused agent.
+
+An agent process is continued with SIGCONT, and messages held while the agent
+was paused are delivered in the order they were sent.`,
 }
 
 var cmdAgentRemove = &Command{
 	Key:   "remove",
 	Run:   agentRemove,
 	Usage: "agent remove <name>",
-	Long:  `Remove an agent.`,
+	Long: `Remove an agent. An agent that is starting, running or paused, or that
+still has a process, is stopped first, terminating its process.`,
 }
 
 var cmdAgentTypes = &Command{
 	Key:   "types",
 	Run:   agentTypes,
-	Usage: "agent types",
-	Long:  `List available agent types.`,
+	Usage: "agent types [<TYPE>]",
+	Long: `List available agent types, or show the details and configuration options of <TYPE>.
+
+Besides the built-in types, agent types can be added as plugins by placing
+descriptor files (YAML or JSON) in ''~/.config/hub.cog/agent-types/''. A
+descriptor declares the type's name, description, launch command, config
+schema and health-check method:
+
+	name: summarizer
+	description: Summarizes repository activity
+	command: [python3, summarizer.py]
+	config:
+	  options:
+	    - key: window
+	      type: duration
+	      default: 24h
+	health_check:
+	  method: heartbeat
+
+Agents of a type with a launch command are started as processes by
+''hub agent start'' and terminated by ''hub agent stop''.`,
 }
 
 func init() {
@@ -127,6 +233,8 @@ func init() {
 	cmdAgent.Use(cmdAgentList)
 	cmdAgent.Use(cmdAgentStart)
 	cmdAgent.Use(cmdAgentStop)
+	cmdAgent.Use(cmdAgentPause)
+	cmdAgent.Use(cmdAgentResume)
 	cmdAgent.Use(cmdAgentStatus)
 	cmdAgent.Use(cmdAgentRemove)
 	cmdAgent.Use(cmdAgentTypes)
@@ -134,6 +242,8 @@ func init() {
 }
 
 func agentCreate(cmd *Command, args *Args) {
+	args.NoForward()
+
 	name := args.Flag.Value("--name")
 	agentType := args.Flag.Value("--type")
 	repository := args.Flag.Value("--repo")
@@ -152,18 +262,41 @@ func agentCreate(cmd *Command, args *Args) {
 		os.Exit(1)
 	}
 
-	registry, err := opencog.NewRegistry("")
+	settings, err := parseConfigSettings(args.Flag.AllValues("--set"))
 	if err != nil {
-		ui.Errorf("Error: failed to create registry: %v\n", err)
+		ui.Errorf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
+	liveness, err := parseProbeFlag(args, "--liveness")
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	readiness, err := parseProbeFlag(args, "--readiness")
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	limits, err := parseLimitFlags(args)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
 	config := opencog.AgentConfig{
 		Name:       name,
 		Type:       opencog.AgentType(agentType),
 		Repository: repository,
 		Branch:     branch,
-		Config:     make(map[string]interface{}),
+		Config:     settings,
+		Endpoint:   args.Flag.Value("--endpoint"),
+		Liveness:   liveness,
+		Readiness:  readiness,
+		Limits:     limits,
 	}
 
 	agent, err := opencog.NewAgent(config)
@@ -177,19 +310,25 @@ func agentCreate(cmd *Command, args *Args) {
 		os.Exit(1)
 	}
 
+	registry.RecordEvent(opencog.Event{
+		AgentID: agent.ID,
+		Actor:   opencog.CurrentActor(),
+		Kind:    opencog.EventLifecycle,
+		To:      string(agent.Status),
+		Reason:  "created",
+	})
+
 	ui.Printf("Created agent: %s (ID: %s, Type: %s)\n", agent.Name, agent.ID, agent.Type)
 }
 
 func agentList(cmd *Command, args *Args) {
+	args.NoForward()
+
 	typeFilter := args.Flag.Value("--type")
 	statusFilter := args.Flag.Value("--status")
 	verbose := args.Flag.Bool("--verbose")
 
-	registry, err := opencog.NewRegistry("")
-	if err != nil {
-		ui.Errorf("Error: failed to create registry: %v\n", err)
-		os.Exit(1)
-	}
+	registry := openAgentRegistry()
 
 	var agents []*opencog.Agent
 	if typeFilter != "" {
@@ -207,14 +346,18 @@ func agentList(cmd *Command, args *Args) {
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 	if verbose {
-		fmt.Fprintln(w, "ID\tNAME\tTYPE\tSTATUS\tCREATED\tREPOSITORY")
+		fmt.Fprintln(w, "ID\tNAME\tTYPE\tSTATUS\tHEALTH\tCREATED\tREPOSITORY")
 		for _, agent := range agents {
 			repo := agent.Repository
 			if repo == "" {
 				repo = "-"
 			}
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
-				agent.ID, agent.Name, agent.Type, agent.Status,
+			health := "-"
+			if agent.Health != nil {
+				health = string(agent.Health.State)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				agent.ID, agent.Name, agent.Type, agent.Status, health,
 				agent.CreatedAt.Format("2006-01-02 15:04:05"), repo)
 		}
 	} else {
@@ -227,6 +370,8 @@ func agentList(cmd *Command, args *Args) {
 }
 
 func agentStart(cmd *Command, args *Args) {
+	args.NoForward()
+
 	if args.IsParamsEmpty() {
 		ui.Errorln("Error: agent name is required")
 		ui.Errorln("Usage: hub agent start <name>")
@@ -235,11 +380,7 @@ func agentStart(cmd *Command, args *Args) {
 
 	agentName := args.FirstParam()
 
-	registry, err := opencog.NewRegistry("")
-	if err != nil {
-		ui.Errorf("Error: failed to create registry: %v\n", err)
-		os.Exit(1)
-	}
+	registry := openAgentRegistry()
 
 	agent, err := registry.GetByName(agentName)
 	if err != nil {
@@ -252,10 +393,23 @@ func agentStart(cmd *Command, args *Args) {
 		return
 	}
 
-	agent.Status = opencog.StatusRunning
-	now := time.Now()
-	agent.StartedAt = &now
-	agent.UpdatedAt = now
+	transitionAgent(registry, agent, opencog.StatusStarting, "started by user")
+	if agent.Metrics != nil {
+		agent.Metrics.ErrorReason = ""
+	}
+
+	if desc, ok := opencog.DefaultTypes.Lookup(agent.Type); ok && len(desc.Command) > 0 {
+		pid, err := opencog.StartProcess(agent, desc.Command, registry.Dir())
+		if err != nil {
+			registry.Transition(agent, opencog.StatusError, opencog.CurrentActor(), err.Error())
+			registry.Update(agent)
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		agent.PID = pid
+	}
+
+	transitionAgent(registry, agent, opencog.StatusRunning, "")
 
 	if err := registry.Update(agent); err != nil {
 		ui.Errorf("Error: failed to update agent: %v\n", err)
@@ -266,6 +420,8 @@ func agentStart(cmd *Command, args *Args) {
 }
 
 func agentStop(cmd *Command, args *Args) {
+	args.NoForward()
+
 	if args.IsParamsEmpty() {
 		ui.Errorln("Error: agent name is required")
 		ui.Errorln("Usage: hub agent stop <name>")
@@ -274,67 +430,122 @@ func agentStop(cmd *Command, args *Args) {
 
 	agentName := args.FirstParam()
 
-	registry, err := opencog.NewRegistry("")
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(agentName)
 	if err != nil {
-		ui.Errorf("Error: failed to create registry: %v\n", err)
+		ui.Errorf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
+	if agent.Status == opencog.StatusStopped {
+		ui.Printf("Agent %s is already stopped\n", agentName)
+		return
+	}
+
+	if err := registry.Stop(agent, opencog.CurrentActor(), "stopped by user"); err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ui.Printf("Stopped agent: %s\n", agentName)
+}
+
+func agentPause(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.IsParamsEmpty() {
+		ui.Errorln("Error: agent name is required")
+		ui.Errorln("Usage: hub agent pause <name>")
+		os.Exit(1)
+	}
+
+	agentName := args.FirstParam()
+
+	registry := openAgentRegistry()
+
 	agent, err := registry.GetByName(agentName)
 	if err != nil {
 		ui.Errorf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if agent.Status == opencog.StatusStopped {
-		ui.Printf("Agent %s is already stopped\n", agentName)
+	if agent.Status == opencog.StatusPaused {
+		ui.Printf("Agent %s is already paused\n", agentName)
 		return
 	}
 
-	agent.Status = opencog.StatusStopped
-	now := time.Now()
-	agent.StoppedAt = &now
-	agent.UpdatedAt = now
+	if err := opencog.CheckProcessHost(registry.Dir(), agent); err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	transitionAgent(registry, agent, opencog.StatusPaused, "paused by user")
+
+	if agent.PID != 0 {
+		if err := opencog.PauseProcess(agent.PID); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	if err := registry.Update(agent); err != nil {
 		ui.Errorf("Error: failed to update agent: %v\n", err)
 		os.Exit(1)
 	}
 
-	ui.Printf("Stopped agent: %s\n", agentName)
+	ui.Printf("Paused agent: %s\n", agentName)
 }
 
-func agentStatus(cmd *Command, args *Args) {
+func agentResume(cmd *Command, args *Args) {
+	args.NoForward()
+
 	if args.IsParamsEmpty() {
 		ui.Errorln("Error: agent name is required")
-		ui.Errorln("Usage: hub agent status <name>")
+		ui.Errorln("Usage: hub agent resume <name>")
 		os.Exit(1)
 	}
 
 	agentName := args.FirstParam()
 
-	registry, err := opencog.NewRegistry("")
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(agentName)
 	if err != nil {
-		ui.Errorf("Error: failed to create registry: %v\n", err)
+		ui.Errorf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	agent, err := registry.GetByName(agentName)
-	if err != nil {
+	if agent.Status != opencog.StatusPaused {
+		ui.Errorf("Error: agent %s is not paused (status: %s)\n", agentName, agent.Status)
+		os.Exit(1)
+	}
+
+	if err := opencog.CheckProcessHost(registry.Dir(), agent); err != nil {
 		ui.Errorf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	jsonStr, err := agent.ToJSON()
-	if err != nil {
-		ui.Errorf("Error: failed to convert agent to JSON: %v\n", err)
+	transitionAgent(registry, agent, opencog.StatusRunning, "resumed by user")
+
+	if agent.PID != 0 {
+		if err := opencog.ResumeProcess(agent.PID); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := registry.Update(agent); err != nil {
+		ui.Errorf("Error: failed to update agent: %v\n", err)
 		os.Exit(1)
 	}
 
-	ui.Println(jsonStr)
+	ui.Printf("Resumed agent: %s\n", agentName)
 }
 
 func agentRemove(cmd *Command, args *Args) {
+	args.NoForward()
+
 	if args.IsParamsEmpty() {
 		ui.Errorln("Error: agent name is required")
 		ui.Errorln("Usage: hub agent remove <name>")
@@ -343,11 +554,7 @@ func agentRemove(cmd *Command, args *Args) {
 
 	agentName := args.FirstParam()
 
-	registry, err := opencog.NewRegistry("")
-	if err != nil {
-		ui.Errorf("Error: failed to create registry: %v\n", err)
-		os.Exit(1)
-	}
+	registry := openAgentRegistry()
 
 	agent, err := registry.GetByName(agentName)
 	if err != nil {
@@ -355,6 +562,14 @@ func agentRemove(cmd *Command, args *Args) {
 		os.Exit(1)
 	}
 
+	active := agent.Status == opencog.StatusStarting || agent.Status == opencog.StatusRunning || agent.Status == opencog.StatusPaused
+	if active || agent.PID != 0 {
+		if err := registry.Stop(agent, opencog.CurrentActor(), "removed by user"); err != nil {
+			ui.Errorf("Error: failed to stop agent: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	if err := registry.Unregister(agent.ID); err != nil {
 		ui.Errorf("Error: failed to remove agent: %v\n", err)
 		os.Exit(1)
@@ -364,26 +579,166 @@ func agentRemove(cmd *Command, args *Args) {
 }
 
 func agentTypes(cmd *Command, args *Args) {
-	types := []struct {
-		Type        string
-		Description string
-	}{
-		{"atomspace", "Knowledge representation and storage"},
-		{"pln", "Probabilistic Logic Networks reasoning"},
-		{"ecan", "Economic Attention Networks"},
-		{"openpsi", "Goal-driven behavior"},
-		{"patternminer", "Pattern mining and discovery"},
-		{"metalearning", "Meta-learning and optimization"},
-		{"reflection", "Self-reflection and monitoring"},
-		{"orchestrator", "Multi-agent coordination"},
-		{"broker", "Message routing and coordination"},
-		{"custom", "User-defined agents"},
+	args.NoForward()
+
+	openAgentRegistry()
+
+	if !args.IsParamsEmpty() {
+		agentTypeDetails(opencog.AgentType(args.FirstParam()))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tDESCRIPTION\tOPTIONS")
+	for _, desc := range opencog.DefaultTypes.List() {
+		options := "-"
+		if len(desc.Schema.Options) > 0 {
+			options = strings.Join(desc.Schema.Keys(), ", ")
+		} else if desc.Schema.AllowUnknown {
+			options = "any"
+		}
+		description := desc.Description
+		if !desc.Builtin() {
+			description += " (plugin)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", desc.Name, description, options)
+	}
+	w.Flush()
+}
+
+func agentTypeDetails(agentType opencog.AgentType) {
+	desc, ok := opencog.DefaultTypes.Lookup(agentType)
+	if !ok {
+		ui.Errorf("Error: unknown agent type %q\n", agentType)
+		os.Exit(1)
+	}
+
+	ui.Printf("Type:         %s\n", desc.Name)
+	ui.Printf("Description:  %s\n", desc.Description)
+	if len(desc.Command) > 0 {
+		ui.Printf("Command:      %s\n", strings.Join(desc.Command, " "))
+	}
+	ui.Printf("Health check: %s\n", desc.HealthCheck.Method)
+	if !desc.Builtin() {
+		ui.Printf("Source:       %s\n", desc.Source)
+	}
+	ui.Println()
+
+	schema := desc.Schema
+	if len(schema.Options) == 0 {
+		if schema.AllowUnknown {
+			ui.Printf("Agent type %s accepts arbitrary options\n", agentType)
+		} else {
+			ui.Printf("Agent type %s has no options\n", agentType)
+		}
+		return
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "TYPE\tDESCRIPTION")
-	for _, t := range types {
-		fmt.Fprintf(w, "%s\t%s\n", t.Type, t.Description)
+	fmt.Fprintln(w, "OPTION\tTYPE\tDEFAULT\tDESCRIPTION")
+	for _, opt := range schema.Options {
+		def := "-"
+		if opt.Required {
+			def = "(required)"
+		} else if opt.Default != nil {
+			def = fmt.Sprint(opt.Default)
+		}
+		description := opt.Description
+		if len(opt.Choices) > 0 {
+			description = fmt.Sprintf("%s (one of: %s)", description, strings.Join(opt.Choices, ", "))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", opt.Key, opt.Type, def, description)
 	}
 	w.Flush()
 }
+
+// transitionAgent moves agent to a new status on behalf of the current user
+// or exits if the lifecycle does not allow it
+func transitionAgent(registry *opencog.Registry, agent *opencog.Agent, to opencog.AgentStatus, reason string) {
+	if err := registry.Transition(agent, to, opencog.CurrentActor(), reason); err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// openAgentRegistry opens the agent registry and registers the agent type
+// plugins found in its configuration directory
+func openAgentRegistry() *opencog.Registry {
+	registry, err := opencog.NewRegistry("")
+	if err != nil {
+		ui.Errorf("Error: failed to create registry: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := opencog.LoadPlugins(registry.Dir()); err != nil {
+		ui.Errorf("Warning: failed to load agent type plugins:\n%v\n", err)
+	}
+
+	return registry
+}
+
+// parseProbeFlag parses a probe flag along with the shared probe tuning flags
+func parseProbeFlag(args *Args, flag string) (*opencog.HealthCheck, error) {
+	spec := args.Flag.Value(flag)
+	if spec == "" {
+		return nil, nil
+	}
+
+	probe, err := opencog.ParseHealthCheck(spec)
+	if err != nil {
+		return nil, err
+	}
+	probe.Interval = args.Flag.Value("--probe-interval")
+	probe.Timeout = args.Flag.Value("--probe-timeout")
+	if args.Flag.HasReceived("--failure-threshold") {
+		probe.FailureThreshold = args.Flag.Int("--failure-threshold")
+		if probe.FailureThreshold <= 0 {
+			return nil, fmt.Errorf("--failure-threshold must be a positive number")
+		}
+	}
+
+	return probe, nil
+}
+
+// parseLimitFlags parses the resource limit flags of agent create
+func parseLimitFlags(args *Args) (*opencog.ResourceLimits, error) {
+	limits := &opencog.ResourceLimits{
+		WallClock: args.Flag.Value("--time-limit"),
+	}
+
+	if args.Flag.HasReceived("--cpu-limit") {
+		limits.CPUSeconds = args.Flag.Int("--cpu-limit")
+		if limits.CPUSeconds <= 0 {
+			return nil, fmt.Errorf("--cpu-limit must be a positive number of seconds")
+		}
+	}
+	if size := args.Flag.Value("--memory-limit"); size != "" {
+		bytes, err := opencog.ParseByteSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --memory-limit: %v", err)
+		}
+		limits.MemoryBytes = bytes
+	}
+	if args.Flag.HasReceived("--files-limit") {
+		limits.OpenFiles = args.Flag.Int("--files-limit")
+		if limits.OpenFiles <= 0 {
+			return nil, fmt.Errorf("--files-limit must be a positive number")
+		}
+	}
+
+	return limits, nil
+}
+
+// parseConfigSettings turns repeated KEY=VALUE flags into a config map. Values
+// are kept as strings and coerced by the agent type's schema.
+func parseConfigSettings(settings []string) (map[string]interface{}, error) {
+	config := make(map[string]interface{})
+	for _, setting := range settings {
+		parts := strings.SplitN(setting, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid --set value %q, expected KEY=VALUE", setting)
+		}
+		config[parts[0]] = parts[1]
+	}
+	return config, nil
+}
@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/opencog/routing"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentBroker = &Command{
+	Key:   "broker",
+	Run:   agentBroker,
+	Usage: "agent broker (rules|send|reset) <name> [--type <TYPE>] [--payload <JSON>] [--from <AGENT>] [--json]",
+	Long: `Inspect and drive the routing of a broker agent.
+
+A broker forwards the messages sent to it along the first of its rules that
+matches them. Rules are declared in a YAML file set with
+''hub agent config <name> --set rules=<file>'', relative to the configuration
+directory:
+
+	rules:
+	  - name: alerts
+	    types: [command]
+	    from: [monitor-*]
+	    tags: [production]
+	    payload: {severity: high, event.action: opened}
+	    to: [pager, logger]
+	  - name: questions
+	    types: [query]
+	    to: [kb-eu, kb-us]
+	    mode: first
+	  - name: census
+	    payload: {action: status}
+	    to: [kb-eu, kb-us, reasoner]
+	    mode: gather
+	    timeout: 5s
+
+A rule matches messages of one of its types, from senders whose name matches
+one of its glob patterns and that have all of its tags, and whose payload
+fields match its patterns; dots reach into nested fields. Unset conditions
+match every message. In the fanout mode, the default, a copy of the message is
+sent to every agent of the rule and the broker answers with the agents it was
+delivered to. In the first mode, the first reply of the agents is the answer.
+In the gather mode, the answer holds the replies of every agent that answered
+within the timeout, and the errors of the others. Messages are never
+forwarded back to their sender.
+
+## Commands:
+
+	* _rules_:
+		Show the rules with how many messages they routed, replies they got
+		and failures.
+
+	* _send_:
+		Send a message to the broker and print its answer.
+
+	* _reset_:
+		Forget the routing statistics.`,
+	KnownFlags: `
+	--type <TYPE>
+		Send a message of type <TYPE> (default: command).
+
+	--payload <JSON>
+		Send <JSON> as the payload of the message.
+
+	--from <AGENT>
+		Send the message as the agent named <AGENT>, so that rules match its
+		name and tags.
+
+	--json
+		Print rules and statistics as JSON.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentBroker)
+}
+
+func agentBroker(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() != 2 {
+		ui.Errorln("Usage: hub agent broker (rules|send|reset) <name>")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(args.GetParam(1))
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if agent.Type != opencog.BrokerAgent {
+		ui.Errorf("Error: agent %s is a %s agent, not a broker agent\n", agent.Name, agent.Type)
+		os.Exit(1)
+	}
+
+	switch action := args.GetParam(0); action {
+	case "rules":
+		showRoutes(registry, agent, args.Flag.Bool("--json"))
+	case "send":
+		sendThroughBroker(registry, agent, args)
+	case "reset":
+		if err := opencog.ResetRoutingStats(registry.Dir(), agent); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		ui.Printf("Forgot the routing statistics of %s\n", agent.Name)
+	default:
+		ui.Errorf("Error: unknown broker command %q, expected rules, send or reset\n", action)
+		os.Exit(1)
+	}
+}
+
+func showRoutes(registry *opencog.Registry, agent *opencog.Agent, asJSON bool) {
+	table, err := opencog.RoutingTable(registry.Dir(), agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	stats, unrouted, err := opencog.RoutingStats(registry.Dir(), agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if asJSON {
+		printJSON(map[string]interface{}{"rules": table.Rules, "stats": stats, "unrouted": unrouted})
+		return
+	}
+	for _, rule := range table.Rules {
+		ui.Printf("%-16s %s → %s%s\n", rule.Name, rule.ForwardMode(), strings.Join(rule.To, ", "), describeMatch(rule))
+		s := stats[rule.Name]
+		if s == nil {
+			ui.Printf("%-16s no messages routed\n", "")
+			continue
+		}
+		ui.Printf("%-16s %d routed, %d delivered, %d replies, %d failures", "", s.Matched, s.Delivered, s.Replies, s.Failures)
+		if s.Replies > 0 {
+			ui.Printf(", replies in %s on average", s.MeanReply().Round(time.Millisecond))
+		}
+		ui.Println()
+		if s.LastError != "" {
+			ui.Printf("%-16s last error: %s\n", "", s.LastError)
+		}
+	}
+	if unrouted > 0 {
+		ui.Printf("\n%d messages matched no rule\n", unrouted)
+	}
+}
+
+// describeMatch summarizes the conditions of a rule
+func describeMatch(rule routing.Rule) string {
+	var conditions []string
+	if len(rule.Types) > 0 {
+		conditions = append(conditions, "type "+strings.Join(rule.Types, "|"))
+	}
+	if len(rule.From) > 0 {
+		conditions = append(conditions, "from "+strings.Join(rule.From, "|"))
+	}
+	if len(rule.Tags) > 0 {
+		conditions = append(conditions, "tagged "+strings.Join(rule.Tags, ", "))
+	}
+	if len(rule.Payload) > 0 {
+		conditions = append(conditions, "payload"+formatPayload(rule.Payload))
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "  when " + strings.Join(conditions, ", ")
+}
+
+func sendThroughBroker(registry *opencog.Registry, agent *opencog.Agent, args *Args) {
+	table, err := opencog.RoutingTable(registry.Dir(), agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	msgType := opencog.MessageTypeCommand
+	if t := args.Flag.Value("--type"); t != "" {
+		msgType = opencog.MessageType(t)
+	}
+	payload := make(map[string]interface{})
+	if data := args.Flag.Value("--payload"); data != "" {
+		if err := json.Unmarshal([]byte(data), &payload); err != nil {
+			ui.Errorf("Error: invalid --payload: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Host the agents the rules forward to, as the daemon would
+	agents := []*opencog.Agent{agent}
+	for _, name := range table.Agents() {
+		peer, err := registry.GetByName(name)
+		if err != nil || peer.ID == agent.ID || !opencog.HasBehavior(peer.Type) {
+			continue
+		}
+		agents = append(agents, peer)
+	}
+	orchestrator, client, err := hostAgents(registry, agents)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer orchestrator.FlushTraffic()
+
+	from := client
+	if name := args.Flag.Value("--from"); name != "" {
+		sender, err := registry.GetByName(name)
+		if err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := orchestrator.RegisterAgent(sender.ID); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		from = sender.ID
+	}
+
+	reply, err := orchestrator.Request(&opencog.Message{
+		From:    from,
+		To:      agent.ID,
+		Type:    msgType,
+		Payload: payload,
+	}, agentRequestTimeout)
+	if err != nil {
+		orchestrator.FlushTraffic()
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	printJSON(reply.Payload)
+}
@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentCluster = &Command{
+	Key:   "cluster",
+	Run:   agentCluster,
+	Usage: "agent cluster (nodes|status) [--json]",
+	Long: `Show the cluster the agent daemon of this host takes part in.
+
+Daemons run with ''--node'' form a cluster (see ''hub agent daemon''). Each
+node writes what it knows of the cluster to the configuration directory.
+The registry is replicated among the nodes by a Raft log, which a leader
+elected by the nodes appends the changes made on every node to. A change is
+committed once a majority of the nodes holds it, and applied by every node
+in the order of the log.
+
+## Commands:
+
+	* _nodes_:
+		List the nodes with their address, tags, the agents placed on them
+		out of their capacity, and when they were last heard from. The node
+		leading the cluster is marked with *, and this host's node with >.
+
+	* _status_:
+		Show the state of the Raft log on this host's node: its role, the
+		term and the leader it knows of, the members, how far its log is
+		committed, applied and compacted into a snapshot and, on the leader,
+		how far the log of every other member matches its own.`,
+	KnownFlags: `
+	--json
+		Print the nodes or the status as JSON.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentCluster)
+}
+
+func agentCluster(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() != 1 {
+		ui.Errorln("Usage: hub agent cluster (nodes|status)")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+	state, err := opencog.LoadClusterState(registry.Dir())
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if state == nil {
+		ui.Errorln("Error: the agent daemon of this host is not a cluster node")
+		os.Exit(1)
+	}
+
+	switch action := args.GetParam(0); action {
+	case "nodes":
+		showClusterNodes(registry, state, args.Flag.Bool("--json"))
+	case "status":
+		showClusterStatus(state, args.Flag.Bool("--json"))
+	default:
+		ui.Errorf("Error: unknown cluster command %q, expected nodes or status\n", action)
+		os.Exit(1)
+	}
+}
+
+func showClusterNodes(registry *opencog.Registry, state *opencog.ClusterState, asJSON bool) {
+	placed := make(map[string][]string)
+	for _, agent := range registry.List() {
+		if agent.Node != "" {
+			placed[agent.Node] = append(placed[agent.Node], agent.Name)
+		}
+	}
+
+	if asJSON {
+		printJSON(map[string]interface{}{"node": state.Node, "coordinator": state.Coordinator,
+			"nodes": state.Nodes, "agents": placed})
+		return
+	}
+	for _, node := range state.Nodes {
+		mark := " "
+		if node.Name == state.Coordinator {
+			mark = "*"
+		}
+		if node.Name == state.Node {
+			mark = ">" + mark
+		} else {
+			mark = " " + mark
+		}
+		agents := placed[node.Name]
+		sort.Strings(agents)
+		seen := "not heard from"
+		if !node.LastSeen.IsZero() {
+			seen = fmt.Sprintf("seen %s ago", time.Since(node.LastSeen).Round(time.Second))
+		}
+		ui.Printf("%s %-16s %-22s %d/%d agents, %s\n", mark, node.Name, node.Address,
+			len(agents), node.Capacity, seen)
+		if len(node.Tags) > 0 {
+			ui.Printf("   %-16s tags: %s\n", "", strings.Join(node.Tags, ", "))
+		}
+		if len(agents) > 0 {
+			ui.Printf("   %-16s agents: %s\n", "", strings.Join(agents, ", "))
+		}
+	}
+	if state.Error != "" {
+		ui.Printf("\nLast sync failed: %s\n", state.Error)
+	}
+}
+
+func showClusterStatus(state *opencog.ClusterState, asJSON bool) {
+	status := state.Raft
+	if status == nil {
+		ui.Errorln("Error: the node has not written the state of its log yet")
+		os.Exit(1)
+	}
+	if asJSON {
+		printJSON(status)
+		return
+	}
+
+	leader := status.Leader
+	if leader == "" {
+		leader = "none elected"
+	}
+	ui.Printf("Node:     %s (%s)\n", status.ID, status.Role)
+	ui.Printf("Term:     %d\n", status.Term)
+	ui.Printf("Leader:   %s\n", leader)
+	ui.Printf("Members:  %s\n", strings.Join(status.Members, ", "))
+	ui.Printf("Log:      %d entries, %d committed, %d applied, %d in the snapshot\n",
+		status.LastIndex, status.CommitIndex, status.AppliedIndex, status.SnapshotIndex)
+	if !state.Synced.IsZero() {
+		ui.Printf("Synced:   %s ago\n", time.Since(state.Synced).Round(time.Second))
+	}
+	if state.Error != "" {
+		ui.Printf("Error:    %s\n", state.Error)
+	}
+	if status.Error != "" {
+		ui.Printf("Storage:  %s\n", status.Error)
+	}
+	if len(status.Peers) > 0 {
+		ui.Println("\nFollowers:")
+		for _, peer := range status.Peers {
+			behind := status.LastIndex - peer.Match
+			ui.Printf("  %-16s matches %d (%d behind), answered %s ago\n", peer.ID, peer.Match, behind,
+				time.Since(peer.LastContact).Round(time.Millisecond))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentConfig = &Command{
+	Key:   "config",
+	Run:   agentConfig,
+	Usage: "agent config <name> [--set <KEY>=<VALUE>...] [--unset <KEY>...]",
+	Long: `Show or edit an agent's configuration.
+
+Without options, print the agent's configuration. Edits are validated against
+the agent type's schema and recorded in the agent's event history.`,
+	KnownFlags: `
+	--set <KEY>=<VALUE>
+		Set a configuration option (may be given multiple times).
+
+	--unset <KEY>
+		Reset a configuration option to its default (may be given multiple
+		times).
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentConfig)
+}
+
+func agentConfig(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.IsParamsEmpty() {
+		ui.Errorln("Error: agent name is required")
+		ui.Errorln("Usage: hub agent config <name> [--set <KEY>=<VALUE>...] [--unset <KEY>...]")
+		os.Exit(1)
+	}
+
+	agentName := args.FirstParam()
+
+	settings, err := parseConfigSettings(args.Flag.AllValues("--set"))
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	unset := args.Flag.AllValues("--unset")
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(agentName)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(settings) == 0 && len(unset) == 0 {
+		printAgentConfig(agent)
+		return
+	}
+
+	changes, err := agent.UpdateConfig(settings, unset)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(changes) == 0 {
+		ui.Printf("Configuration of %s is unchanged\n", agentName)
+		return
+	}
+
+	if err := registry.Update(agent); err != nil {
+		ui.Errorf("Error: failed to update agent: %v\n", err)
+		os.Exit(1)
+	}
+
+	actor := opencog.CurrentActor()
+	for _, change := range changes {
+		registry.RecordEvent(opencog.Event{
+			AgentID: agent.ID,
+			Actor:   actor,
+			Kind:    opencog.EventConfig,
+			From:    formatConfigValue(change.Key, change.Old),
+			To:      formatConfigValue(change.Key, change.New),
+		})
+		ui.Printf("%s: %s -> %s\n", change.Key, configValueOrDash(change.Old), configValueOrDash(change.New))
+	}
+}
+
+func printAgentConfig(agent *opencog.Agent) {
+	if len(agent.Config) == 0 {
+		ui.Printf("Agent %s has no configuration\n", agent.Name)
+		return
+	}
+
+	keys := make([]string, 0, len(agent.Config))
+	for key := range agent.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OPTION\tVALUE")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%v\n", key, agent.Config[key])
+	}
+	w.Flush()
+}
+
+func formatConfigValue(key string, value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s=%v", key, value)
+}
+
+func configValueOrDash(value interface{}) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/github/hub/v2/github"
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentDaemon = &Command{
+	Key: "daemon",
+	Run: agentDaemon,
+	Usage: `
+agent daemon [--interval <DURATION>] [--heartbeat-timeout <DURATION>]
+agent daemon --node <NAME> [--listen <ADDRESS>] [--advertise <ADDRESS>] [--join <ADDRESS>] [--node-tags <TAGS>] [--capacity <N>]
+`,
+	Long: `Run the agent orchestrator in the foreground.
+
+The daemon periodically re-reads the agent registry and checks the health of
+running agents: agents with a liveness probe are probed at the probe's
+interval, other agents are marked as errored when they miss heartbeats.
+Readiness probes mark agents as not ready without changing their status.
+Scheduled tasks are run as they come due (see ''hub agent schedule''), and
+the commands agents send to ''github'' are taken on GitHub as far as their
+''github_*'' options grant them. The events ''hub agent webhook'' receives
+are delivered to the agents the daemon hosts. Stop the daemon with Ctrl-C.
+
+With ''--node'', daemons on several hosts form a cluster. The first daemon is
+run without ''--join''; the others join it, or any node of the cluster. The
+registry is replicated among the nodes by a Raft log: changes made on any
+host are committed once a majority of the nodes holds them, and changes made
+to an agent that another node changed first are dropped, unless they changed
+other fields (see ''hub agent cluster'' and the ''conflict'' events). The
+leader the nodes elect places every in-process agent onto a node whose tags
+include all of the agent's ''node_tags'' and that has room to spare, and
+runs the scheduled tasks. Each node hosts the agents placed on it, and
+messages to agents hosted on other nodes are forwarded to them. Agents of a
+node that stops answering the leader are placed elsewhere; a daemon that is
+stopped leaves the cluster. Nodes authenticate each other with the secret
+in HUB_CLUSTER_SECRET. Knowledge, sample and other agent state kept under
+the configuration directory stays on the host that wrote it.`,
+	KnownFlags: `
+	--interval <DURATION>
+		Time between coordination ticks (default: 5s).
+
+	--heartbeat-timeout <DURATION>
+		Time a running agent without a liveness probe may go without a
+		heartbeat before it is marked as errored (default: 30s).
+
+	--node <NAME>
+		Take part in a cluster as the node named <NAME>.
+
+	--listen <ADDRESS>
+		Accept the calls of other nodes on <ADDRESS> (default: :7946).
+
+	--advertise <ADDRESS>
+		Tell other nodes to call this node on <ADDRESS> (default: the
+		''--listen'' address).
+
+	--join <ADDRESS>
+		Join the cluster of the node at <ADDRESS>.
+
+	--node-tags <TAGS>
+		Comma-separated tags describing this node to the agents' ''node_tags''.
+
+	--capacity <N>
+		Place at most <N> agents on this node (default: 10).
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentDaemon)
+}
+
+func agentDaemon(cmd *Command, args *Args) {
+	args.NoForward()
+
+	registry := openAgentRegistry()
+	orchestrator := opencog.NewOrchestrator(registry)
+
+	if interval := args.Flag.Value("--interval"); interval != "" {
+		orchestrator.CheckInterval = parseDurationFlag("--interval", interval)
+	}
+	if timeout := args.Flag.Value("--heartbeat-timeout"); timeout != "" {
+		orchestrator.HeartbeatTimeout = parseDurationFlag("--heartbeat-timeout", timeout)
+	}
+
+	if node := args.Flag.Value("--node"); node != "" {
+		joinCluster(orchestrator, node, args)
+	}
+	if err := orchestrator.HostGitHub(github.NewClient(github.DefaultGitHubHost())); err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := orchestrator.Start(); err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ui.Printf("Orchestrating %d agents (interval %s, heartbeat timeout %s)\n",
+		registry.Count(), orchestrator.CheckInterval, orchestrator.HeartbeatTimeout)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	if err := orchestrator.Stop(); err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	ui.Println("Orchestrator stopped")
+}
+
+// joinCluster makes the orchestrator the cluster node named node, as the
+// cluster flags say
+func joinCluster(orchestrator *opencog.Orchestrator, node string, args *Args) {
+	secret := os.Getenv("HUB_CLUSTER_SECRET")
+	if secret == "" {
+		ui.Errorln("Error: set HUB_CLUSTER_SECRET to the secret the cluster nodes share")
+		os.Exit(1)
+	}
+	config := opencog.ClusterConfig{
+		Node:      node,
+		Listen:    args.Flag.Value("--listen"),
+		Advertise: args.Flag.Value("--advertise"),
+		Join:      args.Flag.Value("--join"),
+		Capacity:  10,
+		Secret:    []byte(secret),
+	}
+	if config.Listen == "" {
+		config.Listen = ":7946"
+	}
+	for _, tag := range strings.Split(args.Flag.Value("--node-tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			config.Tags = append(config.Tags, tag)
+		}
+	}
+	if capacity := args.Flag.Value("--capacity"); capacity != "" {
+		n, err := strconv.Atoi(capacity)
+		if err != nil || n <= 0 {
+			ui.Errorf("Error: invalid --capacity %q\n", capacity)
+			os.Exit(1)
+		}
+		config.Capacity = n
+	}
+
+	if err := orchestrator.JoinCluster(config); err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if config.Join == "" {
+		ui.Printf("Started cluster as node %s on %s\n", node, orchestrator.ClusterAddress())
+	} else {
+		ui.Printf("Joined cluster at %s as node %s\n", config.Join, node)
+	}
+}
+
+// parseDurationFlag parses a positive duration flag value or exits
+func parseDurationFlag(flag, value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		ui.Errorf("Error: invalid %s %q\n", flag, value)
+		os.Exit(1)
+	}
+	return d
+}
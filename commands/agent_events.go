@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentEvents = &Command{
+	Key:   "events",
+	Run:   agentEvents,
+	Usage: "agent events <name> [--kind <KIND>] [--since <DURATION>] [--limit <N>] [--json]",
+	Long: `Show an agent's event history.
+
+Lifecycle changes, configuration edits and health-check verdicts are recorded
+with the actor that made them, the time, the old and new state, and a reason.
+The actions the agent takes on GitHub are recorded too, with their outcome,
+including those its grant denied and those of dry runs. The most recent 200
+events are kept for each agent.`,
+	KnownFlags: `
+	--kind <KIND>
+		Only show events of this kind: lifecycle, config, health or github.
+
+	--since <DURATION>
+		Only show events from the last <DURATION>, e.g. 24h.
+
+	--limit <N>
+		Only show the <N> most recent events.
+
+	--json
+		Print events as JSON.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentEvents)
+}
+
+func agentEvents(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.IsParamsEmpty() {
+		ui.Errorln("Error: agent name is required")
+		ui.Errorln("Usage: hub agent events <name>")
+		os.Exit(1)
+	}
+
+	agentName := args.FirstParam()
+
+	filter := opencog.EventFilter{
+		Kind:  opencog.EventKind(args.Flag.Value("--kind")),
+		Limit: args.Flag.Int("--limit"),
+	}
+	switch filter.Kind {
+	case "", opencog.EventLifecycle, opencog.EventConfig, opencog.EventHealth, opencog.EventGitHub:
+	default:
+		ui.Errorf("Error: unknown event kind %q\n", filter.Kind)
+		os.Exit(1)
+	}
+	if since := args.Flag.Value("--since"); since != "" {
+		filter.Since = time.Now().Add(-parseDurationFlag("--since", since))
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(agentName)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	events, err := registry.Events(agent.ID, filter)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if args.Flag.Bool("--json") {
+		data, err := json.MarshalIndent(events, "", "  ")
+		if err != nil {
+			ui.Errorf("Error: failed to convert events to JSON: %v\n", err)
+			os.Exit(1)
+		}
+		ui.Println(string(data))
+		return
+	}
+
+	if len(events) == 0 {
+		ui.Println("No events found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTOR\tKIND\tFROM\tTO\tREASON")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			event.Time.Format("2006-01-02 15:04:05"), event.Actor, event.Kind,
+			dashIfEmpty(event.From), dashIfEmpty(event.To), event.Reason)
+	}
+	w.Flush()
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/opencog/atomspace"
+	"github.com/github/hub/v2/opencog/graph"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentGraph = &Command{
+	Key:   "graph",
+	Run:   agentGraph,
+	Usage: "agent graph [<name>] [--query <PATTERN>] [--limit <N>] [--format <FORMAT>] [--output <FILE>]",
+	Long: `Draw the agents, or the knowledge of an AtomSpace agent, as a graph.
+
+Without <name>, the graph shows every agent. Dashed edges are dependencies,
+labeled with the option naming the other agent, such as ''atomspace'', or
+''rules'' for the agents an openpsi agent's rules act on. Solid edges are the
+messages agents sent each other, thicker for busier flows.
+
+With <name>, the graph shows the atoms of that AtomSpace agent: each link
+points to its outgoing atoms, numbered by position. With ''--query'', only the
+links matched by the pattern, and the atoms they hold, are shown.
+
+## Formats:
+
+	* _dot_:
+		Graphviz, e.g. ''hub agent graph | dot -Tsvg > agents.svg''.
+
+	* _graphml_:
+		GraphML, for tools such as Gephi or yEd.
+
+	* _mermaid_:
+		A Mermaid flowchart, which GitHub renders in Markdown code blocks.`,
+	KnownFlags: `
+	--query <PATTERN>
+		Show only the atoms matched by the Atomese <PATTERN>.
+
+	--limit <N>
+		Show the atoms of at most <N> answers to the query.
+
+	--format <FORMAT>
+		Write the graph as dot, graphml or mermaid. Defaults to the format
+		matching the extension of <FILE>, or dot.
+
+	--output <FILE>
+		Write the graph to <FILE> instead of standard output.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentGraph)
+}
+
+// graphExtensions maps file extensions to the format they hold
+var graphExtensions = map[string]graph.Format{
+	".dot":     graph.DOT,
+	".gv":      graph.DOT,
+	".graphml": graph.GraphML,
+	".mmd":     graph.Mermaid,
+	".mermaid": graph.Mermaid,
+}
+
+func agentGraph(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() > 1 {
+		ui.Errorln("Usage: hub agent graph [<name>]")
+		os.Exit(1)
+	}
+
+	file := args.Flag.Value("--output")
+	format := graph.DOT
+	if ext, ok := graphExtensions[filepath.Ext(file)]; ok {
+		format = ext
+	}
+	if args.Flag.HasReceived("--format") {
+		var err error
+		if format, err = graph.ParseFormat(args.Flag.Value("--format")); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	limit := 0
+	if args.Flag.HasReceived("--limit") {
+		limit = args.Flag.Int("--limit")
+		if limit <= 0 {
+			ui.Errorln("Error: --limit must be a positive number")
+			os.Exit(1)
+		}
+	}
+
+	registry := openAgentRegistry()
+
+	var g *graph.Graph
+	var err error
+	if args.ParamsSize() == 0 {
+		if args.Flag.HasReceived("--query") {
+			ui.Errorln("Error: --query needs the name of an atomspace agent")
+			os.Exit(1)
+		}
+		g, err = opencog.Topology(registry)
+	} else {
+		g, err = knowledgeGraph(registry, args.FirstParam(), args.Flag.Value("--query"), limit)
+	}
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if file != "" {
+		if out, err = os.Create(file); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	if err := graph.Write(out, g, format); err != nil {
+		ui.Errorf("Error: failed to write graph: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// knowledgeGraph returns the graph of an AtomSpace agent's atoms, or of the
+// atoms matched by pattern
+func knowledgeGraph(registry *opencog.Registry, name, pattern string, limit int) (*graph.Graph, error) {
+	agent, err := registry.GetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if agent.Type != opencog.AtomSpaceAgent {
+		return nil, fmt.Errorf("agent %s is a %s agent, not an atomspace agent", agent.Name, agent.Type)
+	}
+
+	var q *atomspace.Query
+	if pattern != "" {
+		if q, err = atomspace.ParseQuery(pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern: %v", err)
+		}
+	}
+
+	store, err := opencog.OpenAtomSpace(registry.Dir(), agent)
+	if err != nil {
+		return nil, err
+	}
+
+	var g *graph.Graph
+	err = store.Read(func(space *atomspace.AtomSpace) error {
+		var handles []atomspace.Handle
+		if q != nil {
+			if handles, err = space.Grounded(q, limit); err != nil {
+				return err
+			}
+			if len(handles) == 0 {
+				return fmt.Errorf("the pattern has no answers in %s", agent.Name)
+			}
+		}
+		g, err = graph.AtomSpace(agent.Name, space, handles)
+		return err
+	})
+	return g, err
+}
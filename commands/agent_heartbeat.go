@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentHeartbeat = &Command{
+	Key:   "heartbeat",
+	Run:   agentHeartbeat,
+	Usage: "agent heartbeat <name> [--metric <KEY>=<VALUE>...]",
+	Long: `Record a heartbeat of an agent, with the metrics it reports.
+
+Agent processes run this to tell ''hub agent daemon'' that they are alive; the
+daemon marks running agents without a liveness probe as errored when they miss
+heartbeats. Their name is in ''HUB_AGENT_NAME''. Metrics reported with
+heartbeats are shown by ''hub agent status'', and score the trials of
+the metalearning agents tuning the agent (see ''hub agent tune'').`,
+	KnownFlags: `
+	--metric <KEY>=<VALUE>
+		Report a numeric metric. May be given multiple times.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentHeartbeat)
+}
+
+func agentHeartbeat(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() != 1 {
+		ui.Errorln("Usage: hub agent heartbeat <name> [--metric <KEY>=<VALUE>...]")
+		os.Exit(1)
+	}
+
+	reported := make(map[string]float64)
+	for _, metric := range args.Flag.AllValues("--metric") {
+		parts := strings.SplitN(metric, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			ui.Errorf("Error: invalid --metric value %q, expected KEY=VALUE\n", metric)
+			os.Exit(1)
+		}
+		value, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			ui.Errorf("Error: invalid --metric value %q, expected a number\n", metric)
+			os.Exit(1)
+		}
+		reported[parts[0]] = value
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(args.FirstParam())
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := registry.Heartbeat(agent.ID, reported); err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
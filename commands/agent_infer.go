@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/opencog/atomspace"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentInfer = &Command{
+	Key:   "infer",
+	Run:   agentInfer,
+	Usage: "agent infer <name> [<TARGET>] [--from <ATOMESE>] [--steps <N>] [--last] [--json]",
+	Long: `Reason with a PLN agent over the knowledge of its atomspace agent.
+
+Without <TARGET>, chain forward: apply deduction, inversion and modus ponens
+to the known InheritanceLinks and ImplicationLinks until nothing new follows or
+the agent's max_steps budget is used up. With an Atomese <TARGET>, such as
+''(InheritanceLink (ConceptNode "cat") (ConceptNode "animal"))'', chain
+backward: look for the inferences that conclude it, proving their premises up
+to max_depth levels deep.
+
+Conclusions are sent to the atomspace agent as knowledge. A conclusion that
+was already known is revised with the new evidence. Each inference is drawn
+only once, so running again only reasons about what changed.
+
+The atomspace agent is set with ''hub agent config <name> --set atomspace=<kb>''.`,
+	KnownFlags: `
+	--from <ATOMESE>
+		Chain forward only from these atoms and the statements about them.
+
+	--steps <N>
+		Apply at most <N> rules instead of the agent's max_steps.
+
+	--last
+		Show the trace of the last run instead of reasoning.
+
+	--json
+		Print the run as JSON.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentInfer)
+}
+
+func agentInfer(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() < 1 || args.ParamsSize() > 2 {
+		ui.Errorln("Usage: hub agent infer <name> [<TARGET>]")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(args.GetParam(0))
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if agent.Type != opencog.PLNAgent {
+		ui.Errorf("Error: agent %s is a %s agent, not a pln agent\n", agent.Name, agent.Type)
+		os.Exit(1)
+	}
+
+	var run *opencog.InferenceRun
+	if args.Flag.Bool("--last") {
+		if run, err = opencog.LastInference(registry.Dir(), agent); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if run == nil {
+			ui.Printf("%s has not reasoned yet\n", agent.Name)
+			return
+		}
+	} else {
+		run = runInference(registry, agent, args)
+	}
+
+	if args.Flag.Bool("--json") {
+		data, err := json.MarshalIndent(run, "", "  ")
+		if err != nil {
+			ui.Errorf("Error: failed to encode run: %v\n", err)
+			os.Exit(1)
+		}
+		ui.Println(string(data))
+		return
+	}
+
+	printInferenceRun(run)
+}
+
+func runInference(registry *opencog.Registry, agent *opencog.Agent, args *Args) *opencog.InferenceRun {
+	chaining, atomese := opencog.ForwardChaining, args.Flag.Value("--from")
+	if args.ParamsSize() == 2 {
+		if atomese != "" {
+			ui.Errorln("Error: --from only applies to forward chaining")
+			os.Exit(1)
+		}
+		chaining, atomese = opencog.BackwardChaining, args.GetParam(1)
+	}
+
+	steps := 0
+	if args.Flag.HasReceived("--steps") {
+		if steps = args.Flag.Int("--steps"); steps <= 0 {
+			ui.Errorln("Error: --steps must be a positive number")
+			os.Exit(1)
+		}
+	}
+
+	kb, err := opencog.KnowledgeAgent(registry, agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	reply, err := requestAgent(registry, agent, opencog.MessageTypeCommand,
+		opencog.InferencePayload(chaining, atomese, steps), kb)
+	if err != nil {
+		ui.Errorf("Error: inference failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	run, err := opencog.DecodeInferenceRun(reply.Payload)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return run
+}
+
+// printInferenceRun prints the trace of a run, one rule application per
+// entry, followed by the outcome
+func printInferenceRun(run *opencog.InferenceRun) {
+	direction := "Forward"
+	if run.Chaining == opencog.BackwardChaining {
+		direction = "Backward"
+	}
+	ui.Printf("%s chaining over %s: %d steps, %d conclusions\n",
+		direction, run.Knowledge, len(run.Steps), len(run.Conclusions))
+
+	for i, step := range run.Steps {
+		ui.Printf("\n%d. %s\n", i+1, step.Rule)
+		for _, premise := range step.Premises {
+			ui.Printf("     %s\n", roundTree(premise))
+		}
+		ui.Printf("   ⊢ %s\n", roundTree(step.Conclusion))
+	}
+
+	if run.Target != nil {
+		ui.Println()
+		if run.Target.TV == nil {
+			ui.Printf("Could not prove %s\n", run.Target)
+		} else {
+			ui.Printf("Proved %s\n", roundTree(*run.Target))
+		}
+	}
+	if run.Exhausted {
+		ui.Println()
+		ui.Println("The step budget was used up; run again or raise max_steps to continue")
+	}
+}
+
+// roundTree returns tree with its truth values rounded for display
+func roundTree(tree atomspace.Tree) atomspace.Tree {
+	if tree.TV != nil {
+		tv := atomspace.TruthValue{Strength: round3(tree.TV.Strength), Confidence: round3(tree.TV.Confidence)}
+		tree.TV = &tv
+	}
+	outgoing := make([]atomspace.Tree, len(tree.Outgoing))
+	for i, child := range tree.Outgoing {
+		outgoing[i] = roundTree(child)
+	}
+	tree.Outgoing = outgoing
+	return tree
+}
+
+func round3(x float64) float64 {
+	return math.Round(x*1000) / 1000
+}
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/github/hub/v2/git"
+	"github.com/github/hub/v2/github"
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/opencog/ingest"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentIngest = &Command{
+	Key:   "ingest",
+	Run:   agentIngest,
+	Usage: "agent ingest <name> [--no-github] [--full]",
+	Long: `Add the current repository to the knowledge of an AtomSpace agent.
+
+The commits of the local branches, with their authors, parents and the files
+they change, are added along with the head of each branch. Unless
+''--no-github'' is given, the issues, pull requests, labels and releases of the
+GitHub project are added too.
+
+Entities are concepts named after their kind, such as ''(ConceptNode "commit:<sha>")'',
+''author:<email>'', ''file:<path>'', ''branch:<name>'', ''issue:<number>'',
+''pull:<number>'', ''user:<login>'', ''label:<name>'' and ''release:<tag>'',
+each declared with ''(InheritanceLink (ConceptNode "commit:<sha>") (ConceptNode "commit"))''.
+They are related by EvaluationLinks with the predicates ''authored'',
+''parent'', ''changes'', ''head'', ''title'', ''opened'', ''state'', ''labeled''
+and ''targets''. A branch head or an issue state that no longer holds keeps
+its link with a strength of 0.
+
+Later runs only add the commits and issues that are new or updated since the
+previous run into the same agent.`,
+	KnownFlags: `
+	--no-github
+		Only add what the local repository holds.
+
+	--full
+		Read the whole repository and project again.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentIngest)
+}
+
+func agentIngest(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() != 1 {
+		ui.Errorln("Usage: hub agent ingest <name>")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(args.FirstParam())
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if agent.Type != opencog.AtomSpaceAgent {
+		ui.Errorf("Error: agent %s is a %s agent, not an atomspace agent\n", agent.Name, agent.Type)
+		os.Exit(1)
+	}
+
+	repository, err := git.Dir()
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	name := repository
+
+	var project *github.Project
+	var client *github.Client
+	if !args.Flag.Bool("--no-github") {
+		localRepo, err := github.LocalRepo()
+		if err == nil {
+			project, err = localRepo.MainProject()
+		}
+		if err != nil {
+			ui.Errorf("Error: %v; use --no-github to only add the local repository\n", err)
+			os.Exit(1)
+		}
+		client = github.NewClient(project.Host)
+		name = project.String()
+	}
+
+	var previous *ingest.Progress
+	if !args.Flag.Bool("--full") {
+		if previous, err = ingest.LoadProgress(registry.Dir(), agent, repository); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	batch, err := ingest.Read(previous, project, client)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	reply, err := requestAgent(registry, agent, opencog.MessageTypeKnowledge, map[string]interface{}{"atoms": batch.Atoms})
+	if err != nil {
+		ui.Errorf("Error: failed to add %s to %s: %v\n", name, agent.Name, err)
+		os.Exit(1)
+	}
+	if err := ingest.SaveProgress(registry.Dir(), agent, repository, batch.Progress); err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ui.Printf("Ingested %s into %s: %d commits on %d branches", name, agent.Name, batch.Commits, batch.Branches)
+	if project != nil {
+		ui.Printf(", %d issues, %d pull requests, %d labels, %d releases",
+			batch.Issues, batch.PullRequests, batch.Labels, batch.Releases)
+	}
+	ui.Printf("; %v new atoms, %v atoms in total\n", reply.Payload["added"], reply.Payload["size"])
+}
@@ -0,0 +1,171 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/github/hub/v2/github"
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/opencog/atomspace"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentKnowledge = &Command{
+	Key:   "knowledge",
+	Run:   agentKnowledge,
+	Usage: "agent knowledge (import|export) <name> [<FILE>]",
+	Long: `Import or export the knowledge of an AtomSpace agent as Atomese.
+
+## Commands:
+
+	* _import_:
+		Parse the Atomese s-expressions in <FILE>, such as
+		''(InheritanceLink (stv 0.9 0.8) (ConceptNode "cat") (ConceptNode "animal"))'',
+		and send them to the agent as knowledge. Parse errors are reported with
+		their line and column.
+
+	* _export_:
+		Write the agent's knowledge as Atomese to <FILE>, or to standard output.
+		Exporting knowledge imported from an exported file reproduces that file
+		exactly.`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentKnowledge)
+}
+
+// agentRequestTimeout bounds how long the CLI waits for an agent to reply
+const agentRequestTimeout = 30 * time.Second
+
+func agentKnowledge(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() < 2 {
+		ui.Errorln("Usage: hub agent knowledge (import|export) <name> [<FILE>]")
+		os.Exit(1)
+	}
+
+	action := args.GetParam(0)
+	agentName := args.GetParam(1)
+	file := ""
+	if args.ParamsSize() > 2 {
+		file = args.GetParam(2)
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(agentName)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if agent.Type != opencog.AtomSpaceAgent {
+		ui.Errorf("Error: agent %s is a %s agent, not an atomspace agent\n", agent.Name, agent.Type)
+		os.Exit(1)
+	}
+
+	switch action {
+	case "import":
+		if file == "" {
+			ui.Errorln("Usage: hub agent knowledge import <name> <FILE>")
+			os.Exit(1)
+		}
+		importKnowledge(registry, agent, file)
+	case "export":
+		exportKnowledge(registry, agent, file)
+	default:
+		ui.Errorf("Error: unknown knowledge command %q, expected import or export\n", action)
+		os.Exit(1)
+	}
+}
+
+func importKnowledge(registry *opencog.Registry, agent *opencog.Agent, file string) {
+	f, err := os.Open(file)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	trees, err := atomspace.ParseScheme(f)
+	if err != nil {
+		ui.Errorf("Error: %s: %v\n", file, err)
+		os.Exit(1)
+	}
+
+	reply, err := requestAgent(registry, agent, opencog.MessageTypeKnowledge, map[string]interface{}{"atoms": trees})
+	if err != nil {
+		ui.Errorf("Error: failed to import knowledge: %v\n", err)
+		os.Exit(1)
+	}
+
+	ui.Printf("Imported %d expressions into %s: %v new atoms, %v atoms in total\n",
+		len(trees), agent.Name, reply.Payload["added"], reply.Payload["size"])
+}
+
+func exportKnowledge(registry *opencog.Registry, agent *opencog.Agent, file string) {
+	store, err := opencog.OpenAtomSpace(registry.Dir(), agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if file != "" {
+		if out, err = os.Create(file); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+
+	err = store.Read(func(space *atomspace.AtomSpace) error {
+		return space.ExportScheme(out)
+	})
+	if err != nil {
+		ui.Errorf("Error: failed to export knowledge: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// requestAgent sends a message to agent and waits for its reply. The agent,
+// and the peers it talks to while handling the message, are hosted in this
+// process for the duration of the request.
+func requestAgent(registry *opencog.Registry, agent *opencog.Agent, msgType opencog.MessageType, payload map[string]interface{}, peers ...*opencog.Agent) (*opencog.Message, error) {
+	orchestrator, client, err := hostAgents(registry, append([]*opencog.Agent{agent}, peers...))
+	if err != nil {
+		return nil, err
+	}
+	defer orchestrator.FlushTraffic()
+
+	return orchestrator.Request(&opencog.Message{
+		From:    client,
+		To:      agent.ID,
+		Type:    msgType,
+		Payload: payload,
+	}, agentRequestTimeout)
+}
+
+// hostAgents hosts agents in this process, along with GitHub for them to act
+// on, and registers a client to send them requests from
+func hostAgents(registry *opencog.Registry, agents []*opencog.Agent) (*opencog.Orchestrator, string, error) {
+	orchestrator := opencog.NewOrchestrator(registry)
+	if err := orchestrator.HostGitHub(github.NewClient(github.DefaultGitHubHost())); err != nil {
+		return nil, "", err
+	}
+	for _, a := range agents {
+		behavior, err := opencog.NewBehavior(a, registry.Dir())
+		if err != nil {
+			return nil, "", err
+		}
+		if err := orchestrator.Host(a.ID, behavior); err != nil {
+			return nil, "", err
+		}
+	}
+	client := fmt.Sprintf("cli-%d", os.Getpid())
+	if err := orchestrator.RegisterAgent(client); err != nil {
+		return nil, "", err
+	}
+	return orchestrator, client, nil
+}
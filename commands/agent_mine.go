@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentMine = &Command{
+	Key:   "mine",
+	Run:   agentMine,
+	Usage: "agent mine <name> [--last] [--limit <N>] [--json] [--export <FILE>]",
+	Long: `Mine frequent patterns from the knowledge of a pattern miner agent's atomspace
+agent.
+
+A pattern is a conjunction of links in which some nodes are replaced by
+variables, such as ''(AndLink (InheritanceLink (VariableNode "$1") (ConceptNode "mammal"))
+(EvaluationLink (PredicateNode "likes") (ListLink (VariableNode "$1") (ConceptNode "fish"))))''.
+Its support is the number of ways its variables can be grounded. Patterns grow
+one link at a time up to the agent's max_pattern_size, and only patterns with
+at least min_support groundings are grown further.
+
+Patterns are ranked by surprisingness: how far their probability is from what
+it would be if their links were independent. The max_published most surprising
+ones are sent to the atomspace agent as
+''(EvaluationLink (stv <surprisingness> <confidence>) (PredicateNode "surprising-pattern") (LambdaLink <pattern>))'',
+unless they were already sent with the same support.
+
+The atomspace agent is set with ''hub agent config <name> --set atomspace=<kb>''.`,
+	KnownFlags: `
+	--last
+		Show the patterns of the last run instead of mining.
+
+	--limit <N>
+		Show only the <N> most surprising patterns.
+
+	--json
+		Print the run as JSON.
+
+	--export <FILE>
+		Write the run as JSON to <FILE>.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentMine)
+}
+
+func agentMine(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() != 1 {
+		ui.Errorln("Usage: hub agent mine <name>")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(args.FirstParam())
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if agent.Type != opencog.PatternMinerAgent {
+		ui.Errorf("Error: agent %s is a %s agent, not a patternminer agent\n", agent.Name, agent.Type)
+		os.Exit(1)
+	}
+
+	var run *opencog.MiningRun
+	if args.Flag.Bool("--last") {
+		if run, err = opencog.LastMining(registry.Dir(), agent); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if run == nil {
+			ui.Printf("%s has not mined yet\n", agent.Name)
+			return
+		}
+	} else {
+		run = runMining(registry, agent)
+	}
+
+	if args.Flag.HasReceived("--limit") {
+		limit := args.Flag.Int("--limit")
+		if limit <= 0 {
+			ui.Errorln("Error: --limit must be a positive number")
+			os.Exit(1)
+		}
+		if len(run.Patterns) > limit {
+			run.Patterns = run.Patterns[:limit]
+		}
+	}
+
+	if file := args.Flag.Value("--export"); file != "" {
+		data, err := json.MarshalIndent(run, "", "  ")
+		if err == nil {
+			err = os.WriteFile(file, append(data, '\n'), 0644)
+		}
+		if err != nil {
+			ui.Errorf("Error: failed to export patterns: %v\n", err)
+			os.Exit(1)
+		}
+		ui.Printf("Exported %d patterns to %s\n", len(run.Patterns), file)
+		return
+	}
+	if args.Flag.Bool("--json") {
+		printJSON(run)
+		return
+	}
+
+	ui.Printf("Mined %s: %d patterns, %d published\n", run.Knowledge, len(run.Patterns), run.Published)
+	for i, p := range run.Patterns {
+		ui.Printf("\n%d. surprisingness %.3f, support %d\n", i+1, p.Surprisingness, p.Support)
+		for _, clause := range p.Clauses {
+			ui.Printf("     %s\n", clause)
+		}
+	}
+}
+
+func runMining(registry *opencog.Registry, agent *opencog.Agent) *opencog.MiningRun {
+	kb, err := opencog.KnowledgeAgent(registry, agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	reply, err := requestAgent(registry, agent, opencog.MessageTypeCommand,
+		map[string]interface{}{"action": opencog.MineAction}, kb)
+	if err != nil {
+		ui.Errorf("Error: mining failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	run, err := opencog.DecodeMiningRun(reply.Payload)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return run
+}
@@ -0,0 +1,248 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentPsi = &Command{
+	Key:   "psi",
+	Run:   agentPsi,
+	Usage: "agent psi (goals|step|log) <name> [--limit <N>] [--json]",
+	Long: `Inspect and drive the goal-driven action selection of an OpenPsi agent.
+
+Goals and rules are declared in a YAML file set with
+''hub agent config <name> --set rules=<file>'', relative to the configuration
+directory:
+
+	goals:
+	  - name: understand
+	    urgency: 0.8
+	    growth: 0.05
+	rules:
+	  - name: reason
+	    context: '(InheritanceLink (ConceptNode "cat") (VariableNode "$x"))'
+	    action:
+	      agent: reasoner
+	      payload: {action: forward}
+	    goal: understand
+	    weight: 0.5
+
+Every step, each goal grows more urgent by its growth. Of the rules whose
+context pattern has a grounding in the agent's atomspace agent, the one with
+the highest weight times the urgency of its goal is selected, and its action is
+sent as a command to its agent. Once the action is performed, the urgency of
+the goal drops by the rule's weight. Steps run every cycle_interval while
+''hub agent daemon'' runs the agent.
+
+## Commands:
+
+	* _goals_:
+		Show the goals with their current urgency, and the rules serving them.
+
+	* _step_:
+		Select and perform an action right away.
+
+	* _log_:
+		Show the most recent decisions, with the rules that applied.`,
+	KnownFlags: `
+	--limit <N>
+		Show only the last <N> decisions.
+
+	--json
+		Print decisions as JSON.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentPsi)
+}
+
+func agentPsi(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() != 2 {
+		ui.Errorln("Usage: hub agent psi (goals|step|log) <name>")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(args.GetParam(1))
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if agent.Type != opencog.OpenPsiAgent {
+		ui.Errorf("Error: agent %s is a %s agent, not an openpsi agent\n", agent.Name, agent.Type)
+		os.Exit(1)
+	}
+
+	switch action := args.GetParam(0); action {
+	case "goals":
+		showGoals(registry, agent)
+	case "step":
+		stepPsi(registry, agent, args.Flag.Bool("--json"))
+	case "log":
+		showDecisions(registry, agent, args)
+	default:
+		ui.Errorf("Error: unknown psi command %q, expected goals, step or log\n", action)
+		os.Exit(1)
+	}
+}
+
+func showGoals(registry *opencog.Registry, agent *opencog.Agent) {
+	model, err := opencog.PsiModel(registry.Dir(), agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	urgency, err := opencog.GoalUrgency(registry.Dir(), agent, model)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ui.Println("Goals:")
+	for _, goal := range model.Goals {
+		growth := ""
+		if goal.Growth > 0 {
+			growth = fmt.Sprintf("  (grows %g per step)", goal.Growth)
+		}
+		ui.Printf("  %-16s %.2f%s\n", goal.Name, urgency[goal.Name], growth)
+	}
+
+	ui.Println("\nRules:")
+	for _, rule := range model.Rules {
+		ui.Printf("  %-16s %s ×%g → %s%s\n", rule.Name, rule.Goal, rule.Weight, rule.Action.Agent, formatPayload(rule.Action.Payload))
+		if rule.Context != "" {
+			ui.Printf("  %-16s when %s\n", "", rule.Context)
+		}
+	}
+}
+
+func stepPsi(registry *opencog.Registry, agent *opencog.Agent, asJSON bool) {
+	model, err := opencog.PsiModel(registry.Dir(), agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Host the agents the rules may command, as the daemon would
+	var peers []*opencog.Agent
+	names := map[string]bool{agent.Name: true}
+	if kb := agent.ConfigString("atomspace"); kb != "" {
+		names[kb] = false
+	}
+	for _, rule := range model.Rules {
+		if _, seen := names[rule.Action.Agent]; !seen {
+			names[rule.Action.Agent] = false
+		}
+	}
+	for name, self := range names {
+		peer, err := registry.GetByName(name)
+		if self || err != nil || !opencog.HasBehavior(peer.Type) {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+
+	reply, err := requestAgent(registry, agent, opencog.MessageTypeCommand,
+		map[string]interface{}{"action": opencog.StepAction}, peers...)
+	if err != nil {
+		ui.Errorf("Error: step failed: %v\n", err)
+		os.Exit(1)
+	}
+	decision, err := opencog.DecodeDecision(reply.Payload)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if asJSON {
+		printJSON(decision)
+		return
+	}
+	printDecision(decision)
+}
+
+func showDecisions(registry *opencog.Registry, agent *opencog.Agent, args *Args) {
+	decisions, err := opencog.DecisionLog(registry.Dir(), agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if args.Flag.HasReceived("--limit") {
+		limit := args.Flag.Int("--limit")
+		if limit <= 0 {
+			ui.Errorln("Error: --limit must be a positive number")
+			os.Exit(1)
+		}
+		if len(decisions) > limit {
+			decisions = decisions[len(decisions)-limit:]
+		}
+	}
+
+	if args.Flag.Bool("--json") {
+		printJSON(decisions)
+		return
+	}
+	if len(decisions) == 0 {
+		ui.Printf("%s has not decided anything yet\n", agent.Name)
+		return
+	}
+	for i, decision := range decisions {
+		if i > 0 {
+			ui.Println()
+		}
+		printDecision(decision)
+	}
+}
+
+// printDecision prints the action selected in a step, the goal it served
+// and the rules it was chosen over
+func printDecision(decision *opencog.Decision) {
+	when := decision.Time.Local().Format("2006-01-02 15:04:05")
+	switch {
+	case decision.Rule == "":
+		ui.Printf("%s  no action: no rule applies to an urgent goal\n", when)
+	case decision.Error != "":
+		ui.Printf("%s  %s → %s failed: %s\n", when, decision.Rule, decision.Agent, decision.Error)
+	default:
+		ui.Printf("%s  %s → %s%s\n", when, decision.Rule, decision.Agent, formatPayload(decision.Payload))
+	}
+	if decision.Goal != "" {
+		ui.Printf("  goal %s, urgency %.2f\n", decision.Goal, decision.Urgency[decision.Goal])
+	}
+	if len(decision.Candidates) > 0 {
+		parts := make([]string, len(decision.Candidates))
+		for i, c := range decision.Candidates {
+			parts[i] = fmt.Sprintf("%s %.2f", c.Rule, c.Score)
+		}
+		ui.Printf("  candidates: %s\n", strings.Join(parts, ", "))
+	}
+}
+
+// formatPayload returns the payload of a command as JSON after a space, or
+// nothing if it is empty
+func formatPayload(payload map[string]interface{}) string {
+	if len(payload) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(payload)
+	return " " + string(data)
+}
+
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		ui.Errorf("Error: failed to encode JSON: %v\n", err)
+		os.Exit(1)
+	}
+	ui.Println(string(data))
+}
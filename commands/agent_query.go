@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/opencog/atomspace"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentQuery = &Command{
+	Key:   "query",
+	Run:   agentQuery,
+	Usage: "agent query <name> <PATTERN> [--limit <N>] [--json]",
+	Long: `Ask an AtomSpace agent a question.
+
+<PATTERN> is an Atomese pattern whose VariableNodes are grounded against the
+agent's knowledge, for example
+
+	hub agent query kb '(InheritanceLink (VariableNode "$x") (ConceptNode "animal"))'
+
+Patterns may be wrapped in GetLink, with a variable declaration that
+constrains variable types through TypedVariableLink, or in BindLink, whose
+rewrite is instantiated for every grounding. Several clauses can be combined
+in an AndLink.`,
+	KnownFlags: `
+	--limit <N>
+		Stop after <N> answers.
+
+	--json
+		Print the result as JSON.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentQuery)
+}
+
+func agentQuery(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() != 2 {
+		ui.Errorln("Usage: hub agent query <name> <PATTERN>")
+		os.Exit(1)
+	}
+
+	agentName := args.GetParam(0)
+	pattern := args.GetParam(1)
+
+	limit := 0
+	if args.Flag.HasReceived("--limit") {
+		limit = args.Flag.Int("--limit")
+		if limit <= 0 {
+			ui.Errorln("Error: --limit must be a positive number")
+			os.Exit(1)
+		}
+	}
+
+	// Report syntax errors before involving the agent
+	if _, err := atomspace.ParseQuery(pattern); err != nil {
+		ui.Errorf("Error: invalid pattern: %v\n", err)
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(agentName)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if agent.Type != opencog.AtomSpaceAgent {
+		ui.Errorf("Error: agent %s is a %s agent, not an atomspace agent\n", agent.Name, agent.Type)
+		os.Exit(1)
+	}
+
+	reply, err := requestAgent(registry, agent, opencog.MessageTypeQuery, atomspace.QueryPayload(pattern, limit))
+	if err != nil {
+		ui.Errorf("Error: query failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	result, err := atomspace.DecodeQueryResult(reply.Payload)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if args.Flag.Bool("--json") {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			ui.Errorf("Error: failed to encode result: %v\n", err)
+			os.Exit(1)
+		}
+		ui.Println(string(data))
+		return
+	}
+
+	printQueryResult(result)
+}
+
+// printQueryResult prints each grounding as its variable bindings, or each
+// rewritten atom for BindLink queries
+func printQueryResult(result *atomspace.QueryResult) {
+	if result.Count() == 0 {
+		ui.Println("No groundings")
+		return
+	}
+
+	for i, tree := range result.Results {
+		if i > 0 {
+			ui.Println()
+		}
+		ui.Println(atomspace.FormatScheme(tree))
+	}
+
+	for i, row := range result.Groundings {
+		if len(row) == 0 {
+			ui.Println("Pattern is present")
+			return
+		}
+		if i > 0 {
+			ui.Println()
+		}
+		for j, tree := range row {
+			text := atomspace.FormatScheme(tree)
+			ui.Printf("%s = %s\n", result.Variables[j], strings.ReplaceAll(text, "\n", "\n"+strings.Repeat(" ", len(result.Variables[j])+3)))
+		}
+	}
+}
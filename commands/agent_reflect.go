@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentReflect = &Command{
+	Key:   "reflect",
+	Run:   agentReflect,
+	Usage: "agent reflect <name> [--last] [--json]",
+	Long: `Assess the agents with a reflection agent and print its report as Markdown.
+
+The report covers the time since the agent's previous report: the messages each
+agent sent and received, its errors, restarts and health failures, and the
+pairs of agents where replies took slow_reply or longer on average. Each metric
+is compared with its values in the last baseline_reports reports, and those
+anomaly_threshold standard deviations or more away from them are listed as
+anomalies.
+
+Reports with anomalies are published on GitHub when publish is ''issue'' (to
+repository) or ''gist'', and the agent is granted ''create_issue'' or
+''create_gist'' with ''github_actions''. ''hub agent daemon'' makes a report
+every report_interval.`,
+	KnownFlags: `
+	--last
+		Show the last report instead of making one.
+
+	--json
+		Print the report as JSON.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentReflect)
+}
+
+func agentReflect(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() != 1 {
+		ui.Errorln("Usage: hub agent reflect <name>")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(args.FirstParam())
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if agent.Type != opencog.ReflectionAgent {
+		ui.Errorf("Error: agent %s is a %s agent, not a reflection agent\n", agent.Name, agent.Type)
+		os.Exit(1)
+	}
+
+	var report *opencog.ReflectionReport
+	if args.Flag.Bool("--last") {
+		reports, err := opencog.ReflectionReports(registry.Dir(), agent)
+		if err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(reports) == 0 {
+			ui.Printf("%s has not reported yet\n", agent.Name)
+			return
+		}
+		report = reports[len(reports)-1]
+	} else {
+		reply, err := requestAgent(registry, agent, opencog.MessageTypeCommand,
+			map[string]interface{}{"action": opencog.ReflectAction})
+		if err != nil {
+			ui.Errorf("Error: reflection failed: %v\n", err)
+			os.Exit(1)
+		}
+		if report, err = opencog.DecodeReflectionReport(reply.Payload); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if args.Flag.Bool("--json") {
+		printJSON(report)
+		return
+	}
+	ui.Print(report.Markdown())
+	if report.URL != "" {
+		ui.Printf("\nPublished to %s\n", report.URL)
+	}
+	if report.PublishError != "" {
+		ui.Errorf("Warning: %s\n", report.PublishError)
+	}
+}
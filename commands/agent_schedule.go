@@ -0,0 +1,282 @@
+package commands
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentSchedule = &Command{
+	Key:   "schedule",
+	Run:   agentSchedule,
+	Usage: "agent schedule (add <name> --cron <EXPR> (--agent <AGENT> [--payload <JSON>] | --workflow <FILE>)|list|show <name>|remove <name>)",
+	Long: `Run agent commands and workflows on cron schedules.
+
+Scheduled tasks are run by ''hub agent daemon'': either a command sent to an
+agent, which must be running, or a workflow (see ''hub agent workflow'').
+Schedules sending commands to an agent are removed with the agent.
+
+Schedules are cron expressions of five fields: minute, hour, day of month,
+month and day of week, such as ''0 3 * * *'' for 3am every day or
+''*/15 9-17 * * mon-fri'' for every quarter of an hour during working hours.
+The macros ''@hourly'', ''@daily'', ''@weekly'', ''@monthly'' and ''@yearly''
+are accepted too. Times are local.
+
+A run due while the previous run of the same schedule is still going is
+skipped. Runs due while the daemon was not running are skipped too, unless
+the schedule was added with ''--missed catch-up'', in which case it runs once
+as soon as the daemon is back.
+
+## Commands:
+
+	* _add_:
+		Add a schedule named <name>.
+
+	* _list_:
+		Show each schedule with its next run and the time and outcome of
+		its last run.
+
+	* _show_:
+		Show a schedule and its most recent runs.
+
+	* _remove_:
+		Remove a schedule.`,
+	KnownFlags: `
+	--cron <EXPR>
+		Run on the cron schedule <EXPR>.
+
+	--agent <AGENT>
+		Send a command to the agent named <AGENT>.
+
+	--payload <JSON>
+		Send <JSON> as the payload of the command, such as
+		''{"action": "mine"}''.
+
+	--timeout <DURATION>
+		Wait at most <DURATION> for the agent's reply (default: 30s).
+
+	--workflow <FILE>
+		Run the workflow in <FILE>.
+
+	--missed <POLICY>
+		What to do about runs due while the daemon was not running: skip
+		them, or catch-up with one run (default: skip).
+
+	--json
+		Print schedules as JSON.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentSchedule)
+}
+
+func agentSchedule(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() == 0 {
+		ui.Errorln("Usage: hub agent schedule (add|list|show|remove)")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
+	action := args.FirstParam()
+	if action == "list" {
+		listSchedules(registry, args.Flag.Bool("--json"))
+		return
+	}
+	if args.ParamsSize() != 2 {
+		ui.Errorf("Usage: hub agent schedule %s <name>\n", action)
+		os.Exit(1)
+	}
+	name := args.GetParam(1)
+
+	switch action {
+	case "add":
+		addSchedule(registry, name, args)
+	case "show":
+		showSchedule(registry, name, args.Flag.Bool("--json"))
+	case "remove":
+		if err := registry.RemoveSchedule(name); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		ui.Printf("Removed schedule %s\n", name)
+	default:
+		ui.Errorf("Error: unknown schedule command %q, expected add, list, show or remove\n", action)
+		os.Exit(1)
+	}
+}
+
+func addSchedule(registry *opencog.Registry, name string, args *Args) {
+	if !args.Flag.HasReceived("--cron") {
+		ui.Errorln("Error: --cron is required")
+		os.Exit(1)
+	}
+	schedule := &opencog.Schedule{
+		Name:    name,
+		Cron:    args.Flag.Value("--cron"),
+		Timeout: args.Flag.Value("--timeout"),
+		Missed:  opencog.MissedSkip,
+	}
+	if args.Flag.HasReceived("--missed") {
+		schedule.Missed = opencog.MissedPolicy(args.Flag.Value("--missed"))
+	}
+
+	if file := args.Flag.Value("--workflow"); file != "" {
+		// The daemon may run in another directory
+		path, err := filepath.Abs(file)
+		if err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		schedule.Workflow = path
+	}
+	if agentName := args.Flag.Value("--agent"); agentName != "" {
+		agent, err := registry.GetByName(agentName)
+		if err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		schedule.AgentID = agent.ID
+	}
+	if payload := args.Flag.Value("--payload"); payload != "" {
+		if err := json.Unmarshal([]byte(payload), &schedule.Payload); err != nil {
+			ui.Errorf("Error: invalid --payload: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := registry.AddSchedule(schedule); err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	ui.Printf("Added schedule %s, next run %s\n", name, formatNextRun(schedule, time.Now()))
+}
+
+// scheduleView is a schedule as listed
+type scheduleView struct {
+	*opencog.Schedule
+	Agent   string                  `json:"agent,omitempty"`
+	NextRun *time.Time              `json:"next_run,omitempty"`
+	LastRun *opencog.ScheduledRun   `json:"last_run,omitempty"`
+	Runs    []*opencog.ScheduledRun `json:"runs,omitempty"`
+}
+
+func viewSchedule(registry *opencog.Registry, schedule *opencog.Schedule, now time.Time) *scheduleView {
+	view := &scheduleView{Schedule: schedule}
+	if agent, err := registry.Get(schedule.AgentID); err == nil {
+		view.Agent = agent.Name
+	}
+	if next := schedule.NextRun(now); !next.IsZero() {
+		view.NextRun = &next
+	}
+	runs, err := registry.ScheduledRuns(schedule.Name)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(runs) > 0 {
+		view.LastRun = runs[len(runs)-1]
+	}
+	view.Runs = runs
+	return view
+}
+
+func (v *scheduleView) target() string {
+	if v.Workflow != "" {
+		return "workflow " + filepath.Base(v.Workflow)
+	}
+	return "agent " + v.Agent
+}
+
+func listSchedules(registry *opencog.Registry, asJSON bool) {
+	schedules, err := registry.Schedules()
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	views := make([]*scheduleView, 0, len(schedules))
+	for _, schedule := range schedules {
+		view := viewSchedule(registry, schedule, now)
+		view.Runs = nil
+		views = append(views, view)
+	}
+	if asJSON {
+		printJSON(views)
+		return
+	}
+	if len(views) == 0 {
+		ui.Println("No schedules")
+		return
+	}
+
+	ui.Printf("%-20s %-18s %-24s %-17s %-17s %s\n", "NAME", "SCHEDULE", "TARGET", "NEXT RUN", "LAST RUN", "OUTCOME")
+	for _, view := range views {
+		last, outcome := "-", "-"
+		if run := view.LastRun; run != nil {
+			last = run.Due.Local().Format("2006-01-02 15:04")
+			outcome = string(run.Status)
+		}
+		ui.Printf("%-20s %-18s %-24s %-17s %-17s %s\n", view.Name, view.Cron, view.target(), formatNextRun(view.Schedule, now), last, outcome)
+	}
+}
+
+func showSchedule(registry *opencog.Registry, name string, asJSON bool) {
+	schedule, err := registry.Schedule(name)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	now := time.Now()
+	view := viewSchedule(registry, schedule, now)
+	if asJSON {
+		printJSON(view)
+		return
+	}
+
+	ui.Printf("Name:     %s\n", view.Name)
+	ui.Printf("Schedule: %s\n", view.Cron)
+	if view.Workflow != "" {
+		ui.Printf("Workflow: %s\n", view.Workflow)
+	} else {
+		ui.Printf("Agent:    %s%s\n", view.Agent, formatPayload(view.Payload))
+	}
+	ui.Printf("Missed:   %s\n", view.Missed)
+	ui.Printf("Next run: %s\n", formatNextRun(schedule, now))
+
+	if len(view.Runs) == 0 {
+		ui.Println("\nNo runs yet")
+		return
+	}
+	ui.Println("\nRuns:")
+	for i := len(view.Runs) - 1; i >= 0; i-- {
+		run := view.Runs[i]
+		details := ""
+		if run.Started != nil && run.Finished != nil {
+			details = " in " + run.Finished.Sub(*run.Started).Round(time.Millisecond).String()
+		}
+		if run.RunID != "" {
+			details += " (" + run.RunID + ")"
+		}
+		ui.Printf("  %s  %-10s%s\n", run.Due.Local().Format("2006-01-02 15:04"), run.Status, details)
+		if run.Error != "" {
+			ui.Printf("  %16s  %s\n", "", run.Error)
+		}
+	}
+}
+
+func formatNextRun(schedule *opencog.Schedule, now time.Time) string {
+	next := schedule.NextRun(now)
+	if next.IsZero() {
+		return "never"
+	}
+	return next.Local().Format("2006-01-02 15:04")
+}
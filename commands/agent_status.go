@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentStatus = &Command{
+	Key:   "status",
+	Run:   agentStatus,
+	Usage: "agent status <name> [--summary]",
+	Long: `Show agent status and metrics.
+
+The full agent record is printed as JSON. With ''--summary'', the status,
+limits and metrics are summarized instead. For agents supervised by
+''hub agent daemon'', the summary shows resource usage sampled on each
+coordination tick as trends over the most recent samples. For ecan agents,
+it shows the attentional focus left by the last attention allocation cycle
+with the short-term importance of each atom.`,
+	KnownFlags: `
+	--summary
+		Summarize the agent instead of printing its record as JSON.
+`,
+}
+
+func agentStatus(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.IsParamsEmpty() {
+		ui.Errorln("Error: agent name is required")
+		ui.Errorln("Usage: hub agent status <name> [--summary]")
+		os.Exit(1)
+	}
+
+	agentName := args.FirstParam()
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(agentName)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !args.Flag.Bool("--summary") {
+		jsonStr, err := agent.ToJSON()
+		if err != nil {
+			ui.Errorf("Error: failed to convert agent to JSON: %v\n", err)
+			os.Exit(1)
+		}
+		ui.Println(jsonStr)
+		return
+	}
+
+	ui.Printf("Agent:    %s (%s)\n", agent.Name, agent.ID)
+	ui.Printf("Type:     %s\n", agent.Type)
+	status := string(agent.Status)
+	if agent.Health != nil && agent.Health.State != "" {
+		status += fmt.Sprintf(" (health: %s)", agent.Health.State)
+	}
+	ui.Printf("Status:   %s\n", status)
+	if agent.PID != 0 {
+		ui.Printf("PID:      %d\n", agent.PID)
+	}
+	if agent.Node != "" {
+		ui.Printf("Node:     %s\n", agent.Node)
+	}
+	if agent.StartedAt != nil && (agent.Status == opencog.StatusRunning || agent.Status == opencog.StatusPaused) {
+		ui.Printf("Uptime:   %s\n", time.Since(*agent.StartedAt).Round(time.Second))
+	}
+	if limits := formatLimits(agent.Limits); limits != "" {
+		ui.Printf("Limits:   %s\n", limits)
+	}
+	if agent.Metrics != nil {
+		ui.Printf("Requests: %d (%d errors)\n", agent.Metrics.RequestCount, agent.Metrics.ErrorCount)
+		if agent.Metrics.ErrorReason != "" {
+			ui.Printf("Error:    %s\n", agent.Metrics.ErrorReason)
+		}
+		if len(agent.Metrics.Reported) > 0 {
+			keys := make([]string, 0, len(agent.Metrics.Reported))
+			for key := range agent.Metrics.Reported {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for i, key := range keys {
+				keys[i] = fmt.Sprintf("%s=%g", key, agent.Metrics.Reported[key])
+			}
+			ui.Printf("Reported: %s\n", strings.Join(keys, ", "))
+		}
+	}
+
+	samples, err := registry.Samples(agent.ID)
+	if err != nil {
+		ui.Errorf("Warning: %v\n", err)
+	}
+	if len(samples) > 0 {
+		ui.Printf("\nResources (last %d samples):\n", len(samples))
+		printTrend("CPU", samples, func(s opencog.ResourceSample) float64 { return s.CPUPercent },
+			func(v float64) string { return fmt.Sprintf("%.1f%%", v) })
+		printTrend("Memory", samples, func(s opencog.ResourceSample) float64 { return float64(s.RSS) },
+			func(v float64) string { return opencog.FormatByteSize(int64(v)) })
+		printTrend("Threads", samples, func(s opencog.ResourceSample) float64 { return float64(s.Threads) },
+			func(v float64) string { return fmt.Sprintf("%d", int(v)) })
+		printTrend("Files", samples, func(s opencog.ResourceSample) float64 { return float64(s.OpenFiles) },
+			func(v float64) string { return fmt.Sprintf("%d", int(v)) })
+	}
+
+	if agent.Type == opencog.ECANAgent {
+		printAttentionalFocus(registry, agent)
+	}
+}
+
+// printAttentionalFocus prints the focus left by an ECAN agent's last cycle
+func printAttentionalFocus(registry *opencog.Registry, agent *opencog.Agent) {
+	cycle, cycles, err := opencog.AttentionalFocus(registry.Dir(), agent)
+	if err != nil {
+		ui.Errorf("Warning: %v\n", err)
+		return
+	}
+	if cycle == nil {
+		ui.Println("\nAttentional focus: no cycles yet")
+		return
+	}
+
+	ui.Printf("\nAttentional focus of %s (cycle %d, %s ago):\n",
+		cycle.Knowledge, cycles, time.Since(cycle.Time).Round(time.Second))
+	if len(cycle.Focus) == 0 {
+		ui.Println("  (empty)")
+	}
+	for _, atom := range cycle.Focus {
+		ui.Printf("  %8.2f  %s\n", atom.STI, atom.Atom)
+	}
+	ui.Printf("  Boundary %.2f STI; bank holds %.2f STI, %.2f LTI\n",
+		cycle.Boundary, cycle.Bank.STIFunds, cycle.Bank.LTIFunds)
+}
+
+// printTrend prints a sparkline of one measurement followed by its latest value
+func printTrend(label string, samples []opencog.ResourceSample, value func(opencog.ResourceSample) float64, format func(float64) string) {
+	values := make([]float64, len(samples))
+	for i, sample := range samples {
+		values[i] = value(sample)
+	}
+	ui.Printf("  %-8s %s %s\n", label, opencog.Sparkline(values), format(values[len(values)-1]))
+}
+
+// formatLimits describes an agent's resource limits on one line
+func formatLimits(limits *opencog.ResourceLimits) string {
+	if limits.IsZero() {
+		return ""
+	}
+
+	var parts []string
+	if limits.CPUSeconds > 0 {
+		parts = append(parts, fmt.Sprintf("cpu %ds", limits.CPUSeconds))
+	}
+	if limits.MemoryBytes > 0 {
+		parts = append(parts, "memory "+opencog.FormatByteSize(limits.MemoryBytes))
+	}
+	if limits.OpenFiles > 0 {
+		parts = append(parts, fmt.Sprintf("files %d", limits.OpenFiles))
+	}
+	if limits.WallClock != "" {
+		parts = append(parts, "wall-clock "+limits.WallClock)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/opencog/atomspace"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentStimulate = &Command{
+	Key:   "stimulate",
+	Run:   agentStimulate,
+	Usage: "agent stimulate <name> <ATOMESE> [--amount <N>] [--cycle]",
+	Long: `Give stimulus to atoms through an ECAN agent.
+
+The atoms, such as ''(ConceptNode "cat")'', must be known to the agent's
+atomspace agent. On its next attention allocation cycle, the ECAN agent pays
+them wages in short- and long-term importance for the stimulus they received.
+Importance then spreads along links to related atoms, and every atom pays rent
+each cycle, so atoms that stop being stimulated drop out of the attentional
+focus. See the focus with ''hub agent status <name> --summary''.
+
+Cycles run every cycle_interval while ''hub agent daemon'' runs the agent.`,
+	KnownFlags: `
+	--amount <N>
+		Give <N> units of stimulus to each atom instead of 1.
+
+	--cycle
+		Run an attention allocation cycle right away.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentStimulate)
+}
+
+func agentStimulate(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() != 2 {
+		ui.Errorln("Usage: hub agent stimulate <name> <ATOMESE>")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(args.GetParam(0))
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if agent.Type != opencog.ECANAgent {
+		ui.Errorf("Error: agent %s is a %s agent, not an ecan agent\n", agent.Name, agent.Type)
+		os.Exit(1)
+	}
+
+	trees, err := atomspace.ParseScheme(strings.NewReader(args.GetParam(1)))
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(trees) == 0 {
+		ui.Errorln("Error: no atoms to stimulate")
+		os.Exit(1)
+	}
+
+	amount := 1.0
+	if args.Flag.HasReceived("--amount") {
+		amount, err = strconv.ParseFloat(args.Flag.Value("--amount"), 64)
+		if err != nil || amount <= 0 {
+			ui.Errorln("Error: --amount must be a positive number")
+			os.Exit(1)
+		}
+	}
+
+	if _, err := requestAgent(registry, agent, opencog.MessageTypeCommand,
+		opencog.StimulusPayload(trees, amount)); err != nil {
+		ui.Errorf("Error: stimulus failed: %v\n", err)
+		os.Exit(1)
+	}
+	ui.Printf("Stimulated %d atoms\n", len(trees))
+
+	if !args.Flag.Bool("--cycle") {
+		return
+	}
+	kb, err := opencog.KnowledgeAgent(registry, agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	reply, err := requestAgent(registry, agent, opencog.MessageTypeCommand,
+		map[string]interface{}{"action": opencog.CycleAction}, kb)
+	if err != nil {
+		ui.Errorf("Error: attention allocation failed: %v\n", err)
+		os.Exit(1)
+	}
+	cycle, err := opencog.DecodeAttentionCycle(reply.Payload)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	ui.Printf("Paid %.2f STI in wages and collected %.2f in rent; %d atoms in focus\n",
+		cycle.Wages, cycle.Rent, len(cycle.Focus))
+}
@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentTune = &Command{
+	Key:   "tune",
+	Run:   agentTune,
+	Usage: "agent tune (trials|next|apply|reset) <name> [--json]",
+	Long: `Inspect and drive the parameter search of a meta-learning agent.
+
+A metalearning agent tunes the numeric options of its target agent:
+
+	$ hub agent create --name tuner --type metalearning \
+	    --set target=attention --set parameters=af_size=10:50:10,diffusion_rate=0.1:0.5 \
+	    --set metric=score --set strategy=bandit
+
+Each trial sets values of the parameters on the target and restarts it. After
+trial_duration, the trial is scored by the last value of metric the target
+reported with ''hub agent heartbeat --metric <metric>=<VALUE>'' since it
+restarted. The grid strategy tries the points of a grid over the parameters in
+turn, with 5 values for parameters without a step; random samples them
+uniformly; bandit tries every point of the grid once, then keeps trying the
+points with the best upper confidence bound on their mean score. Trials run
+while ''hub agent daemon'' runs the agent, until max_trials have run.
+
+## Commands:
+
+	* _trials_:
+		Show the trials so far and the best configuration.
+
+	* _next_:
+		End the current trial and start the next one right away.
+
+	* _apply_:
+		Set the configuration that scored best on average on the target and
+		restart it. The search ends.
+
+	* _reset_:
+		Forget the trials, so that the search starts anew.`,
+	KnownFlags: `
+	--json
+		Print trials as JSON.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentTune)
+}
+
+func agentTune(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() != 2 {
+		ui.Errorln("Usage: hub agent tune (trials|next|apply|reset) <name>")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
+	agent, err := registry.GetByName(args.GetParam(1))
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if agent.Type != opencog.MetaLearningAgent {
+		ui.Errorf("Error: agent %s is a %s agent, not a metalearning agent\n", agent.Name, agent.Type)
+		os.Exit(1)
+	}
+
+	switch action := args.GetParam(0); action {
+	case "trials":
+		showTrials(registry, agent, args.Flag.Bool("--json"))
+	case "next":
+		reply, err := requestAgent(registry, agent, opencog.MessageTypeCommand,
+			map[string]interface{}{"action": opencog.TrialAction})
+		if err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		trial, err := opencog.DecodeTuningTrial(reply.Payload)
+		if err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if args.Flag.Bool("--json") {
+			printJSON(trial)
+			return
+		}
+		ui.Printf("Started trial %d: %s\n", trial.Number, trial.Values.Key())
+	case "apply":
+		best, changes, err := opencog.ApplyBestTuning(registry, agent, opencog.CurrentActor())
+		if err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		ui.Printf("Applied %s, scoring %g over %d trials\n", best.Values.Key(), best.Score, best.Trials)
+		for _, change := range changes {
+			ui.Printf("%s: %s -> %s\n", change.Key, configValueOrDash(change.Old), configValueOrDash(change.New))
+		}
+	case "reset":
+		if err := opencog.ResetTuning(registry.Dir(), agent); err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		ui.Printf("Forgot the trials of %s\n", agent.Name)
+	default:
+		ui.Errorf("Error: unknown tune command %q, expected trials, next, apply or reset\n", action)
+		os.Exit(1)
+	}
+}
+
+func showTrials(registry *opencog.Registry, agent *opencog.Agent, asJSON bool) {
+	trials, current, err := opencog.TuningTrials(registry.Dir(), agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	best, err := opencog.BestTuning(registry.Dir(), agent)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if asJSON {
+		printJSON(map[string]interface{}{"trials": trials, "current": current, "best": best})
+		return
+	}
+	if len(trials) == 0 && current == nil {
+		ui.Printf("%s has not run any trials yet\n", agent.Name)
+		return
+	}
+
+	metric := agent.ConfigString("metric")
+	for _, trial := range trials {
+		outcome := ""
+		if trial.Score != nil {
+			outcome = fmt.Sprintf("%s %g", metric, *trial.Score)
+		} else {
+			outcome = "failed: " + trial.Error
+		}
+		ui.Printf("%3d  %s  %s\n", trial.Number, trial.Values.Key(), outcome)
+	}
+	if current != nil {
+		ui.Printf("%3d  %s  running since %s\n", current.Number, current.Values.Key(),
+			current.Started.Local().Format("2006-01-02 15:04:05"))
+	}
+	if best != nil {
+		ui.Printf("\nBest: %s, %s %g over %d trials\n", best.Values.Key(), metric, best.Score, best.Trials)
+	}
+}
@@ -0,0 +1,244 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/opencog/webhook"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentWebhook = &Command{
+	Key:   "webhook",
+	Run:   agentWebhook,
+	Usage: "agent webhook (serve [--listen <ADDRESS>] [--record <DIR>]|replay [--event <EVENT>] <FILE>...) [--manifest <FILE>]",
+	Long: `Send GitHub events to agents.
+
+''serve'' receives the webhook deliveries of a repository or organization and
+sends the events they hold to the agents subscribed to them. Deliveries must
+be signed with the webhook's secret, read from ''$HUB_WEBHOOK_SECRET''; the
+others are refused. ''push'', ''pull_request'', ''issues'' and ''check_run''
+events are routed, other events are ignored.
+
+Subscriptions are routes declared in a manifest, ''webhooks.yaml'' in the
+configuration directory unless ''--manifest'' is given:
+
+	routes:
+	  - event: pull_request
+	    actions: [opened, reopened]
+	    agent: reviewer
+	    payload: {action: review}
+	  - event: check_run
+	    repositories: [github/hub]
+	    agent: triage
+	    type: knowledge
+
+Every route an event matches sends it to its agent, as a command unless
+''type'' says ''query'' or ''knowledge''. The message holds the route's
+payload, and the event under ''event'': its name, action, repository, sender,
+and the push, pull request, issue or check run it is about. Events are
+delivered by the agent daemon (see ''hub agent daemon''), which must be running
+to host the agents of the routes; the receiver hosts no agents itself.
+
+''replay'' sends recorded deliveries, saved by ''serve --record'', through the
+routes as if they were just received, and waits for the agents' replies. A
+payload saved from GitHub's webhook settings can be replayed too, given the
+name of its event with ''--event''.`,
+	KnownFlags: `
+	--manifest <FILE>
+		Read routes from <FILE>.
+
+	--listen <ADDRESS>
+		Listen on <ADDRESS> (default: localhost:8080).
+
+	--record <DIR>
+		Save the deliveries of routed events in <DIR>, to be replayed.
+
+	--event <EVENT>
+		Replay payloads of the event <EVENT>, such as push.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentWebhook)
+}
+
+func agentWebhook(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() == 0 {
+		ui.Errorln("Usage: hub agent webhook (serve|replay <FILE>...)")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+
+	path := args.Flag.Value("--manifest")
+	if path == "" {
+		path = filepath.Join(registry.Dir(), "webhooks.yaml")
+	}
+	manifest, err := webhook.LoadManifest(path)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch action := args.FirstParam(); action {
+	case "serve":
+		serveWebhooks(registry, manifest, args)
+	case "replay":
+		if args.ParamsSize() < 2 {
+			ui.Errorln("Usage: hub agent webhook replay <FILE>...")
+			os.Exit(1)
+		}
+		replayWebhooks(registry, manifest, args.Params[1:], args.Flag.Value("--event"))
+	default:
+		ui.Errorf("Error: unknown webhook command %q, expected serve or replay\n", action)
+		os.Exit(1)
+	}
+}
+
+// webhookClient is the sender of the events posted to the daemon
+const webhookClient = "webhook"
+
+// webhookRouter sends events to the agents of the routes they match, through
+// the daemon hosting them
+type webhookRouter struct {
+	registry *opencog.Registry
+}
+
+func newWebhookRouter(registry *opencog.Registry, manifest *webhook.Manifest) (*webhookRouter, error) {
+	for _, name := range manifest.Agents() {
+		agent, err := registry.GetByName(name)
+		if err != nil {
+			return nil, err
+		}
+		if !opencog.HasBehavior(agent.Type) {
+			return nil, fmt.Errorf("agent %s: %s agents cannot be sent messages", agent.Name, agent.Type)
+		}
+	}
+	return &webhookRouter{registry: registry}, nil
+}
+
+// send posts an event along a route and waits for the agent's reply
+func (w *webhookRouter) send(route *webhook.Route, event *webhook.Event) (*opencog.Message, error) {
+	// Agents created since the receiver started are routed to as well
+	w.registry.Reload()
+	agent, err := w.registry.GetByName(route.Agent)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := route.Message(event)
+	if err != nil {
+		return nil, err
+	}
+	msg := &opencog.Message{
+		From:    webhookClient,
+		To:      agent.ID,
+		Type:    opencog.MessageType(route.MessageType()),
+		Payload: payload,
+	}
+	if err := w.registry.PostMessage(msg); err != nil {
+		return nil, err
+	}
+	return w.registry.WaitForReply(msg.ID, agentRequestTimeout)
+}
+
+func describeEvent(event *webhook.Event) string {
+	parts := []string{event.Name}
+	if event.Action != "" {
+		parts = append(parts, event.Action)
+	}
+	if event.Repository != "" {
+		parts = append(parts, event.Repository)
+	}
+	return strings.Join(parts, " ")
+}
+
+func serveWebhooks(registry *opencog.Registry, manifest *webhook.Manifest, args *Args) {
+	secret := os.Getenv("HUB_WEBHOOK_SECRET")
+	if secret == "" {
+		ui.Errorln("Error: set HUB_WEBHOOK_SECRET to the secret of the webhook")
+		os.Exit(1)
+	}
+	listen := args.Flag.Value("--listen")
+	if listen == "" {
+		listen = "localhost:8080"
+	}
+
+	router, err := newWebhookRouter(registry, manifest)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	handler := &webhook.Handler{
+		Secret:    []byte(secret),
+		Manifest:  manifest,
+		RecordDir: args.Flag.Value("--record"),
+		// GitHub gives up on deliveries after 10 seconds, so agents are
+		// answered in the background
+		Deliver: func(route *webhook.Route, event *webhook.Event) {
+			go func() {
+				if _, err := router.send(route, event); err != nil {
+					ui.Errorf("%s → %s: %v\n", describeEvent(event), route.Agent, err)
+					return
+				}
+				ui.Printf("%s → %s\n", describeEvent(event), route.Agent)
+			}()
+		},
+	}
+
+	ui.Printf("Receiving webhooks on http://%s/ for %d routes\n", listen, len(manifest.Routes))
+	if err := http.ListenAndServe(listen, handler); err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func replayWebhooks(registry *opencog.Registry, manifest *webhook.Manifest, files []string, eventName string) {
+	router, err := newWebhookRouter(registry, manifest)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, file := range files {
+		recording, err := webhook.ReadRecording(file, eventName)
+		if err == nil {
+			var event *webhook.Event
+			if event, err = webhook.Parse(recording.Event, recording.Delivery, recording.Payload); err == nil {
+				replayEvent(router, manifest, event, &failed)
+			}
+		}
+		if err != nil {
+			ui.Errorf("Error: %s: %v\n", file, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func replayEvent(router *webhookRouter, manifest *webhook.Manifest, event *webhook.Event, failed *bool) {
+	routes := manifest.Match(event)
+	if len(routes) == 0 {
+		ui.Printf("%s: no route\n", describeEvent(event))
+		return
+	}
+	for _, route := range routes {
+		reply, err := router.send(route, event)
+		if err != nil {
+			ui.Errorf("%s → %s: %v\n", describeEvent(event), route.Agent, err)
+			*failed = true
+			continue
+		}
+		ui.Printf("%s → %s:%s\n", describeEvent(event), route.Agent, formatPayload(reply.Payload))
+	}
+}
@@ -0,0 +1,274 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/opencog/workflow"
+	"github.com/github/hub/v2/ui"
+)
+
+var cmdAgentWorkflow = &Command{
+	Key:   "workflow",
+	Run:   agentWorkflow,
+	Usage: "agent workflow (run <FILE>|runs|show <ID>) [--json]",
+	Long: `Run pipelines chaining agents, and inspect their runs.
+
+A workflow is a graph of steps declared in a YAML file. Each step sends a
+message to an agent and waits for its reply:
+
+	name: understand-repo
+	steps:
+	  - name: mine
+	    agent: miner
+	    payload: {action: mine}
+	    timeout: 5m
+	  - name: infer
+	    agent: reasoner
+	    needs: [mine]
+	    payload: {action: forward}
+	    when: mine.output.run.published > 0
+	    retries: 2
+	  - name: focus
+	    agent: attention
+	    needs: [infer]
+	    payload: {action: cycle}
+
+A step starts once the steps it ''needs'' have succeeded, so steps that do not
+need each other run side by side. Messages are commands unless ''type'' says
+''query'' or ''knowledge''. Each attempt waits ''timeout'' for the reply, 30s
+unless set, and a failed step is attempted ''retries'' more times,
+''retry_delay'' apart.
+
+''when'' makes a step conditional on the result of a step it needs: a value
+of its ''output'', the payload of the agent's reply, such as
+''mine.output.run.published''. The value is compared to a literal with ''=='',
+''!='', ''<'', ''<='', ''>'' or ''>='', or alone holds when it is set and not
+false, zero or empty. A step is skipped when its condition does not hold or a
+step it needs did not succeed, and so are the steps needing it. A step failing
+every attempt fails the run.
+
+The agents of the steps, and the agents they depend on, are hosted in this
+process for the duration of the run. Every run is recorded in the
+configuration directory as the run progresses.
+
+## Commands:
+
+	* _run_:
+		Run the workflow in <FILE> and print each step as it finishes.
+
+	* _runs_:
+		List the recorded runs.
+
+	* _show_:
+		Show the record of a run: the status, attempts and output of each
+		step.`,
+	KnownFlags: `
+	--json
+		Print runs as JSON.
+`,
+}
+
+func init() {
+	cmdAgent.Use(cmdAgentWorkflow)
+}
+
+func agentWorkflow(cmd *Command, args *Args) {
+	args.NoForward()
+
+	if args.ParamsSize() == 0 {
+		ui.Errorln("Usage: hub agent workflow (run <FILE>|runs|show <ID>)")
+		os.Exit(1)
+	}
+
+	registry := openAgentRegistry()
+	asJSON := args.Flag.Bool("--json")
+
+	switch action := args.FirstParam(); action {
+	case "run":
+		if args.ParamsSize() != 2 {
+			ui.Errorln("Usage: hub agent workflow run <FILE>")
+			os.Exit(1)
+		}
+		runWorkflow(registry, args.GetParam(1), asJSON)
+	case "runs":
+		listWorkflowRuns(registry, asJSON)
+	case "show":
+		if args.ParamsSize() != 2 {
+			ui.Errorln("Usage: hub agent workflow show <ID>")
+			os.Exit(1)
+		}
+		run, err := workflow.LoadRun(registry.Dir(), args.GetParam(1))
+		if err != nil {
+			ui.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if asJSON {
+			printJSON(run)
+			return
+		}
+		printWorkflowRun(run)
+	default:
+		ui.Errorf("Error: unknown workflow command %q, expected run, runs or show\n", action)
+		os.Exit(1)
+	}
+}
+
+func runWorkflow(registry *opencog.Registry, file string, asJSON bool) {
+	w, err := workflow.Load(file)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	agents, err := workflowAgents(registry, w)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	orchestrator, client, err := hostAgents(registry, agents)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer orchestrator.FlushTraffic()
+
+	printed := make(map[string]bool)
+	runner := &workflow.Runner{
+		Send: orchestrator.WorkflowSender(client),
+		Record: func(run *workflow.Run) error {
+			if !asJSON {
+				for _, step := range run.Steps {
+					if isDone(step.Status) && !printed[step.Name] {
+						printed[step.Name] = true
+						printStepRun(step)
+					}
+				}
+			}
+			return workflow.SaveRun(registry.Dir(), run)
+		},
+	}
+
+	run, err := runner.Run(w, file)
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if asJSON {
+		printJSON(run)
+	} else {
+		ui.Printf("\nRun %s %s in %s\n", run.ID, run.Status, run.Finished.Sub(run.Started).Round(time.Millisecond))
+	}
+	if run.Status != workflow.Succeeded {
+		os.Exit(1)
+	}
+}
+
+// workflowAgents returns the agents the steps of a workflow send messages
+// to, and the agents these depend on
+func workflowAgents(registry *opencog.Registry, w *workflow.Workflow) ([]*opencog.Agent, error) {
+	var agents []*opencog.Agent
+	for _, step := range w.Steps {
+		agent, err := registry.GetByName(step.Agent)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %v", step.Name, err)
+		}
+		if !opencog.HasBehavior(agent.Type) {
+			return nil, fmt.Errorf("step %s: %s agents cannot be sent messages", step.Name, agent.Type)
+		}
+		agents = append(agents, agent)
+	}
+	return withDependencies(registry, agents), nil
+}
+
+// withDependencies returns agents, once each, followed by the agents they
+// depend on, directly or not, that can be hosted in this process
+func withDependencies(registry *opencog.Registry, agents []*opencog.Agent) []*opencog.Agent {
+	var all []*opencog.Agent
+	seen := make(map[string]bool)
+	for _, agent := range agents {
+		if !seen[agent.ID] {
+			seen[agent.ID] = true
+			all = append(all, agent)
+		}
+	}
+
+	deps := registry.Dependencies()
+	for i := 0; i < len(all); i++ {
+		for _, dep := range deps {
+			if dep.From.ID == all[i].ID && !seen[dep.To.ID] && opencog.HasBehavior(dep.To.Type) {
+				seen[dep.To.ID] = true
+				all = append(all, dep.To)
+			}
+		}
+	}
+	return all
+}
+
+func isDone(status workflow.Status) bool {
+	return status == workflow.Succeeded || status == workflow.Failed || status == workflow.Skipped
+}
+
+func listWorkflowRuns(registry *opencog.Registry, asJSON bool) {
+	runs, err := workflow.ListRuns(registry.Dir())
+	if err != nil {
+		ui.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if asJSON {
+		printJSON(runs)
+		return
+	}
+	if len(runs) == 0 {
+		ui.Println("No workflow runs")
+		return
+	}
+
+	ui.Printf("%-40s %-10s %-20s %s\n", "ID", "STATUS", "STARTED", "STEPS")
+	for _, run := range runs {
+		succeeded := 0
+		for _, step := range run.Steps {
+			if step.Status == workflow.Succeeded {
+				succeeded++
+			}
+		}
+		ui.Printf("%-40s %-10s %-20s %d/%d\n", run.ID, run.Status, run.Started.Format("2006-01-02 15:04:05"), succeeded, len(run.Steps))
+	}
+}
+
+func printWorkflowRun(run *workflow.Run) {
+	ui.Printf("Run:      %s\n", run.ID)
+	ui.Printf("Workflow: %s\n", run.Workflow)
+	if run.File != "" {
+		ui.Printf("File:     %s\n", run.File)
+	}
+	ui.Printf("Status:   %s\n", run.Status)
+	ui.Printf("Started:  %s\n", run.Started.Format(time.RFC3339))
+	if run.Finished != nil {
+		ui.Printf("Finished: %s\n", run.Finished.Format(time.RFC3339))
+	}
+
+	ui.Println("\nSteps:")
+	for _, step := range run.Steps {
+		printStepRun(step)
+		if step.Output != nil {
+			ui.Printf("  %-16s →%s\n", "", formatPayload(step.Output))
+		}
+	}
+}
+
+func printStepRun(step *workflow.StepRun) {
+	details := step.Agent
+	if step.Started != nil && step.Finished != nil {
+		details += ", " + step.Finished.Sub(*step.Started).Round(time.Millisecond).String()
+	}
+	if step.Attempts > 1 {
+		details += fmt.Sprintf(", %d attempts", step.Attempts)
+	}
+	ui.Printf("  %-16s %-10s (%s)\n", step.Name, step.Status, details)
+	if step.Error != "" {
+		ui.Printf("  %-16s %s\n", "", step.Error)
+	}
+}
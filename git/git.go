@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/github/hub/v2/cmd"
 )
@@ -239,6 +240,57 @@ func Log(sha1, sha2 string) (string, error) {
 	return outputs, nil
 }
 
+// Commit is a commit as listed by Commits
+type Commit struct {
+	Sha         string
+	Parents     []string
+	AuthorName  string
+	AuthorEmail string
+	AuthorDate  time.Time
+	Subject     string
+	Files       []string
+}
+
+// Commits lists the commits reachable from the given revisions, oldest
+// first, with the files each one changed. Revisions are passed to `git log`
+// as is, so "^sha" excludes the commits reachable from sha.
+func Commits(revisions ...string) ([]Commit, error) {
+	logCmd := gitCmd("-c", "log.showSignature=false", "log", "--no-color", "--reverse", "--name-only")
+	logCmd.WithArg("--format=%x00%H%x1f%P%x1f%aN%x1f%aE%x1f%aI%x1f%s")
+	logCmd.WithArgs(revisions...)
+	logCmd.WithArg("--")
+	logCmd.Stderr = nil
+
+	output, err := logCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Can't load git log %s", strings.Join(revisions, " "))
+	}
+
+	commits := []Commit{}
+	for _, entry := range strings.Split(output, "\x00")[1:] {
+		lines := outputLines(strings.TrimSpace(entry))
+		fields := strings.Split(lines[0], "\x1f")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("Can't parse git log entry %q", lines[0])
+		}
+		commit := Commit{
+			Sha:         fields[0],
+			Parents:     strings.Fields(fields[1]),
+			AuthorName:  fields[2],
+			AuthorEmail: fields[3],
+			Subject:     fields[5],
+		}
+		commit.AuthorDate, _ = time.Parse(time.RFC3339, fields[4])
+		for _, file := range lines[1:] {
+			if file != "" {
+				commit.Files = append(commit.Files, file)
+			}
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
 func Remotes() ([]string, error) {
 	remoteCmd := gitCmd("remote", "-v")
 	remoteCmd.Stderr = nil
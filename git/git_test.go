@@ -184,3 +184,29 @@ func TestCommentChar(t *testing.T) {
 	_, err = CommentChar("#\n;\n@\n!\n$\n%\n^\n&\n|\n:")
 	assert.Equal(t, "unable to select a comment character that is not used in the current message", err.Error())
 }
+
+func TestGitCommits(t *testing.T) {
+	repo := fixtures.SetupTestRepo()
+	defer repo.TearDown()
+
+	commits, err := Commits("9b5a719a3d76ac9dc2fa635d9b1f34fd73994c06")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(commits))
+
+	first, second := commits[0], commits[1]
+	assert.Equal(t, "08f4b7b6513dffc6245857e497cfd6101dc47818", first.Sha)
+	assert.Equal(t, 0, len(first.Parents))
+	assert.Equal(t, "Jingwen Owen Ou", first.AuthorName)
+	assert.Equal(t, "jingweno@gmail.com", first.AuthorEmail)
+	assert.Equal(t, "Add test_file", first.Subject)
+	assert.Equal(t, []string{"test_file"}, first.Files)
+	assert.Equal(t, int64(1392104351), first.AuthorDate.Unix())
+
+	assert.Equal(t, []string{first.Sha}, second.Parents)
+	assert.Equal(t, "First comment", second.Subject)
+
+	commits, err = Commits("9b5a719a3d76ac9dc2fa635d9b1f34fd73994c06", "^08f4b7b6513dffc6245857e497cfd6101dc47818")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(commits))
+	assert.Equal(t, second.Sha, commits[0].Sha)
+}
@@ -636,6 +636,7 @@ type Comment struct {
 	Body      string    `json:"body"`
 	User      *User     `json:"user"`
 	CreatedAt time.Time `json:"created_at"`
+	HTMLURL   string    `json:"html_url"`
 }
 
 type Issue struct {
@@ -793,6 +794,39 @@ func (client *Client) FetchComments(project *Project, number string) (comments [
 	return
 }
 
+func (client *Client) CreateComment(project *Project, issueNumber int, body string) (comment *Comment, err error) {
+	api, err := client.simpleAPI()
+	if err != nil {
+		return
+	}
+
+	params := map[string]interface{}{"body": body}
+	res, err := api.PostJSON(fmt.Sprintf("repos/%s/%s/issues/%d/comments", project.Owner, project.Name, issueNumber), params)
+	if err = checkStatus(201, "creating comment", res, err); err != nil {
+		return
+	}
+
+	comment = &Comment{}
+	err = res.Unmarshal(comment)
+	return
+}
+
+func (client *Client) AddLabels(project *Project, issueNumber int, labels []string) (err error) {
+	api, err := client.simpleAPI()
+	if err != nil {
+		return
+	}
+
+	params := map[string]interface{}{"labels": labels}
+	res, err := api.PostJSON(fmt.Sprintf("repos/%s/%s/issues/%d/labels", project.Owner, project.Name, issueNumber), params)
+	if err = checkStatus(200, "adding labels", res, err); err != nil {
+		return
+	}
+
+	res.Body.Close()
+	return
+}
+
 func (client *Client) CreateIssue(project *Project, params interface{}) (issue *Issue, err error) {
 	api, err := client.simpleAPI()
 	if err != nil {
@@ -3,6 +3,7 @@ package opencog
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 )
 
@@ -16,15 +17,15 @@ const (
 	ECANAgent         AgentType = "ecan"         // Economic Attention Networks
 	OpenPsiAgent      AgentType = "openpsi"      // Goal-driven behavior
 	PatternMinerAgent AgentType = "patternminer" // Pattern mining and discovery
-	
+
 	// Meta-cognitive agents
-	MetaLearningAgent AgentType = "metalearning"  // Meta-learning and optimization
-	ReflectionAgent   AgentType = "reflection"    // Self-reflection and monitoring
-	
+	MetaLearningAgent AgentType = "metalearning" // Meta-learning and optimization
+	ReflectionAgent   AgentType = "reflection"   // Self-reflection and monitoring
+
 	// Coordination agents
-	OrchestratorAgent AgentType = "orchestrator"  // Multi-agent coordination
-	BrokerAgent       AgentType = "broker"        // Message routing and coordination
-	
+	OrchestratorAgent AgentType = "orchestrator" // Multi-agent coordination
+	BrokerAgent       AgentType = "broker"       // Message routing and coordination
+
 	// Custom agent type
 	CustomAgent AgentType = "custom" // User-defined agents
 )
@@ -33,32 +34,44 @@ const (
 type AgentStatus string
 
 const (
-	StatusCreated   AgentStatus = "created"
-	StatusStarting  AgentStatus = "starting"
-	StatusRunning   AgentStatus = "running"
-	StatusPaused    AgentStatus = "paused"
-	StatusStopping  AgentStatus = "stopping"
-	StatusStopped   AgentStatus = "stopped"
-	StatusError     AgentStatus = "error"
+	StatusCreated  AgentStatus = "created"
+	StatusStarting AgentStatus = "starting"
+	StatusRunning  AgentStatus = "running"
+	StatusPaused   AgentStatus = "paused"
+	StatusStopping AgentStatus = "stopping"
+	StatusStopped  AgentStatus = "stopped"
+	StatusError    AgentStatus = "error"
 )
 
 // Agent represents a cognitive agent in the OpenCog system
 type Agent struct {
-	ID          string                 `json:"id"`
-	Name        string                 `json:"name"`
-	Type        AgentType              `json:"type"`
-	Status      AgentStatus            `json:"status"`
-	Repository  string                 `json:"repository"`
-	Branch      string                 `json:"branch"`
-	Config      map[string]interface{} `json:"config"`
-	CreatedAt   time.Time              `json:"created_at"`
-	UpdatedAt   time.Time              `json:"updated_at"`
-	StartedAt   *time.Time             `json:"started_at,omitempty"`
-	StoppedAt   *time.Time             `json:"stopped_at,omitempty"`
-	Endpoint    string                 `json:"endpoint,omitempty"`
-	Version     string                 `json:"version,omitempty"`
-	Tags        []string               `json:"tags,omitempty"`
-	Metrics     *AgentMetrics          `json:"metrics,omitempty"`
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	Type       AgentType              `json:"type"`
+	Status     AgentStatus            `json:"status"`
+	Repository string                 `json:"repository"`
+	Branch     string                 `json:"branch"`
+	Config     map[string]interface{} `json:"config"`
+	CreatedAt  time.Time              `json:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+	StartedAt  *time.Time             `json:"started_at,omitempty"`
+	StoppedAt  *time.Time             `json:"stopped_at,omitempty"`
+	Endpoint   string                 `json:"endpoint,omitempty"`
+	PID        int                    `json:"pid,omitempty"`
+	Cgroup     string                 `json:"cgroup,omitempty"`
+	Node       string                 `json:"node,omitempty"`
+	Limits     *ResourceLimits        `json:"limits,omitempty"`
+	Liveness   *HealthCheck           `json:"liveness,omitempty"`
+	Readiness  *HealthCheck           `json:"readiness,omitempty"`
+	Health     *AgentHealth           `json:"health,omitempty"`
+	History    []StatusTransition     `json:"history,omitempty"`
+	Version    string                 `json:"version,omitempty"`
+	Tags       []string               `json:"tags,omitempty"`
+	Metrics    *AgentMetrics          `json:"metrics,omitempty"`
+
+	// loaded is the agent as the registry read or saved it, which Update
+	// merges the changes made to the agent since against
+	loaded []byte
 }
 
 // AgentMetrics contains performance and health metrics for an agent
@@ -69,6 +82,14 @@ type AgentMetrics struct {
 	ErrorCount    int64     `json:"error_count"`
 	LastHeartbeat time.Time `json:"last_heartbeat"`
 	Uptime        int64     `json:"uptime"` // seconds
+	Threads       int       `json:"threads,omitempty"`
+	OpenFiles     int       `json:"open_files,omitempty"`
+	// ErrorReason is set when the agent breaches a resource limit, e.g.
+	// limit_exceeded:memory
+	ErrorReason string `json:"error_reason,omitempty"`
+	// Reported holds the metrics the agent reported with its last
+	// heartbeats, such as a score meta-learning agents tune it by
+	Reported map[string]float64 `json:"reported,omitempty"`
 }
 
 // AgentConfig defines configuration options for creating an agent
@@ -79,6 +100,10 @@ type AgentConfig struct {
 	Branch     string                 `json:"branch,omitempty"`
 	Config     map[string]interface{} `json:"config,omitempty"`
 	Tags       []string               `json:"tags,omitempty"`
+	Endpoint   string                 `json:"endpoint,omitempty"`
+	Liveness   *HealthCheck           `json:"liveness,omitempty"`
+	Readiness  *HealthCheck           `json:"readiness,omitempty"`
+	Limits     *ResourceLimits        `json:"limits,omitempty"`
 }
 
 // Validate checks if the agent configuration is valid
@@ -89,7 +114,31 @@ func (ac *AgentConfig) Validate() error {
 	if ac.Type == "" {
 		return fmt.Errorf("agent type is required")
 	}
-	return nil
+	for _, probe := range []*HealthCheck{ac.Liveness, ac.Readiness} {
+		if probe == nil {
+			continue
+		}
+		if err := probe.validate(); err != nil {
+			return err
+		}
+	}
+	if ac.Limits != nil {
+		if err := ac.Limits.validate(); err != nil {
+			return err
+		}
+	}
+	_, err := ac.normalizedConfig()
+	return err
+}
+
+// normalizedConfig validates Config against the type's schema and returns it
+// with values coerced and defaults applied
+func (ac *AgentConfig) normalizedConfig() (map[string]interface{}, error) {
+	schema, ok := SchemaFor(ac.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown agent type %q", ac.Type)
+	}
+	return schema.Apply(ac.Type, ac.Config)
 }
 
 // NewAgent creates a new agent instance
@@ -98,6 +147,11 @@ func NewAgent(config AgentConfig) (*Agent, error) {
 		return nil, err
 	}
 
+	agentConfig, err := config.normalizedConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	now := time.Now()
 	agent := &Agent{
 		ID:         generateAgentID(),
@@ -106,15 +160,153 @@ func NewAgent(config AgentConfig) (*Agent, error) {
 		Status:     StatusCreated,
 		Repository: config.Repository,
 		Branch:     config.Branch,
-		Config:     config.Config,
+		Config:     agentConfig,
 		CreatedAt:  now,
 		UpdatedAt:  now,
 		Tags:       config.Tags,
+		Endpoint:   config.Endpoint,
+		Liveness:   config.Liveness,
+		Readiness:  config.Readiness,
+	}
+	if !config.Limits.IsZero() {
+		agent.Limits = config.Limits
+	}
+
+	// Agents without an explicit liveness probe use their type's health check
+	if agent.Liveness == nil {
+		if desc, ok := DefaultTypes.Lookup(config.Type); ok && desc.HealthCheck.Active() {
+			probe := *desc.HealthCheck
+			agent.Liveness = &probe
+		}
 	}
 
 	return agent, nil
 }
 
+// ConfigChange describes the edit of a single configuration key. Old or New
+// is nil when the key was added or removed.
+type ConfigChange struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+// UpdateConfig sets and unsets configuration keys, validates the result
+// against the agent type's schema and returns the keys that changed. Unset
+// keys fall back to their defaults.
+func (a *Agent) UpdateConfig(set map[string]interface{}, unset []string) ([]ConfigChange, error) {
+	merged := make(map[string]interface{}, len(a.Config)+len(set))
+	for key, value := range a.Config {
+		merged[key] = value
+	}
+	for _, key := range unset {
+		delete(merged, key)
+	}
+	for key, value := range set {
+		merged[key] = value
+	}
+
+	schema, ok := SchemaFor(a.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown agent type %q", a.Type)
+	}
+	normalized, err := schema.Apply(a.Type, merged)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(normalized))
+	seen := make(map[string]bool)
+	for _, config := range []map[string]interface{}{a.Config, normalized} {
+		for key := range config {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []ConfigChange
+	for _, key := range keys {
+		oldValue, newValue := a.Config[key], normalized[key]
+		if fmt.Sprint(oldValue) != fmt.Sprint(newValue) {
+			changes = append(changes, ConfigChange{Key: key, Old: oldValue, New: newValue})
+		}
+	}
+
+	a.Config = normalized
+	if len(changes) > 0 {
+		a.UpdatedAt = time.Now()
+	}
+	return changes, nil
+}
+
+// configValue returns the agent's value for key coerced to the type declared
+// by its schema, falling back to the option's default
+func (a *Agent) configValue(key string) interface{} {
+	schema, ok := SchemaFor(a.Type)
+	if !ok {
+		return a.Config[key]
+	}
+	option, ok := schema.Option(key)
+	if !ok {
+		return a.Config[key]
+	}
+
+	for _, value := range []interface{}{a.Config[key], option.Default} {
+		if value == nil {
+			continue
+		}
+		if coerced, err := option.Coerce(value); err == nil {
+			return coerced
+		}
+	}
+	return nil
+}
+
+// ConfigInt returns an integer configuration option, or zero if it is unset
+func (a *Agent) ConfigInt(key string) int {
+	switch v := a.configValue(key).(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// ConfigFloat returns a numeric configuration option, or zero if it is unset
+func (a *Agent) ConfigFloat(key string) float64 {
+	switch v := a.configValue(key).(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+// ConfigString returns a string configuration option, or "" if it is unset
+func (a *Agent) ConfigString(key string) string {
+	if s, ok := a.configValue(key).(string); ok {
+		return s
+	}
+	return ""
+}
+
+// ConfigBool returns a boolean configuration option, or false if it is unset
+func (a *Agent) ConfigBool(key string) bool {
+	b, _ := a.configValue(key).(bool)
+	return b
+}
+
+// ConfigDuration returns a duration configuration option, or zero if it is
+// unset
+func (a *Agent) ConfigDuration(key string) time.Duration {
+	return parseDurationOr(a.ConfigString(key), 0)
+}
+
 // ToJSON converts the agent to JSON string
 func (a *Agent) ToJSON() (string, error) {
 	data, err := json.MarshalIndent(a, "", "  ")
@@ -128,3 +320,20 @@ func (a *Agent) ToJSON() (string, error) {
 func generateAgentID() string {
 	return fmt.Sprintf("agent-%d", time.Now().UnixNano())
 }
+
+// agentEnv returns the environment variables describing agent to its process
+func agentEnv(agent *Agent) ([]string, error) {
+	config, err := json.Marshal(agent.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode agent config: %w", err)
+	}
+
+	return []string{
+		"HUB_AGENT_ID=" + agent.ID,
+		"HUB_AGENT_NAME=" + agent.Name,
+		"HUB_AGENT_TYPE=" + string(agent.Type),
+		"HUB_AGENT_REPOSITORY=" + agent.Repository,
+		"HUB_AGENT_BRANCH=" + agent.Branch,
+		"HUB_AGENT_CONFIG=" + string(config),
+	}, nil
+}
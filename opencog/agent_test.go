@@ -169,6 +169,33 @@ func TestAgentStatusTransitions(t *testing.T) {
 	}
 }
 
+func TestAgentUpdateConfig(t *testing.T) {
+	agent, err := NewAgent(AgentConfig{Name: "tuned", Type: ECANAgent})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+
+	changes, err := agent.UpdateConfig(map[string]interface{}{"af_size": "50"}, nil)
+	if err != nil {
+		t.Fatalf("UpdateConfig failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Key != "af_size" || changes[0].Old != 20 || changes[0].New != 50 {
+		t.Errorf("Unexpected changes %+v", changes)
+	}
+
+	changes, _ = agent.UpdateConfig(nil, []string{"af_size"})
+	if len(changes) != 1 || agent.Config["af_size"] != 20 {
+		t.Errorf("Unset should restore the default, got %+v", agent.Config)
+	}
+
+	if _, err := agent.UpdateConfig(map[string]interface{}{"af_size": "lots"}, nil); err == nil {
+		t.Error("UpdateConfig should validate against the schema")
+	}
+	if agent.Config["af_size"] != 20 {
+		t.Error("A rejected update should leave the config unchanged")
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) > 0 && len(substr) > 0 && s != "" && substr != "" && 
 		   (s == substr || (len(s) > len(substr) && findSubstring(s, substr)))
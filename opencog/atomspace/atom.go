@@ -0,0 +1,155 @@
+// Package atomspace implements an in-memory hypergraph knowledge store in the
+// style of the OpenCog AtomSpace. Knowledge is held as atoms: nodes, which
+// are identified by their type and name, and links, which are identified by
+// their type and ordered outgoing set of other atoms. Every atom carries a
+// truth value and an attention value.
+package atomspace
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is the type of an atom. Node types end in "Node" and link types end
+// in "Link", apart from a few link types used to declare variables.
+type Type string
+
+// Common atom types
+const (
+	ConceptNode   Type = "ConceptNode"
+	PredicateNode Type = "PredicateNode"
+	SchemaNode    Type = "SchemaNode"
+	VariableNode  Type = "VariableNode"
+	NumberNode    Type = "NumberNode"
+	TypeNode      Type = "TypeNode"
+
+	InheritanceLink Type = "InheritanceLink"
+	SimilarityLink  Type = "SimilarityLink"
+	MemberLink      Type = "MemberLink"
+	EvaluationLink  Type = "EvaluationLink"
+	ExecutionLink   Type = "ExecutionLink"
+	ImplicationLink Type = "ImplicationLink"
+	EquivalenceLink Type = "EquivalenceLink"
+	ContextLink     Type = "ContextLink"
+	ListLink        Type = "ListLink"
+	SetLink         Type = "SetLink"
+	AndLink         Type = "AndLink"
+	OrLink          Type = "OrLink"
+	NotLink         Type = "NotLink"
+
+	// Pattern matching
+	GetLink           Type = "GetLink"
+	BindLink          Type = "BindLink"
+	TypedVariableLink Type = "TypedVariableLink"
+	VariableList      Type = "VariableList"
+	TypeChoice        Type = "TypeChoice"
+	LambdaLink        Type = "LambdaLink"
+)
+
+// irregularLinkTypes are link types whose names do not end in "Link"
+var irregularLinkTypes = map[Type]bool{
+	VariableList: true,
+	TypeChoice:   true,
+}
+
+// IsNode reports whether t is a node type
+func (t Type) IsNode() bool {
+	return len(t) > len("Node") && strings.HasSuffix(string(t), "Node")
+}
+
+// IsLink reports whether t is a link type
+func (t Type) IsLink() bool {
+	return len(t) > len("Link") && strings.HasSuffix(string(t), "Link") || irregularLinkTypes[t]
+}
+
+// validate checks that t names a node or link type
+func (t Type) validate() error {
+	if !t.IsNode() && !t.IsLink() {
+		return fmt.Errorf("invalid atom type %q: must end in Node or Link", t)
+	}
+	for _, r := range t {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return fmt.Errorf("invalid atom type %q: must be alphanumeric", t)
+		}
+	}
+	return nil
+}
+
+// Handle identifies an atom within an AtomSpace
+type Handle uint64
+
+// TruthValue is a simple truth value: the strength of a statement and the
+// confidence in that strength, both between 0 and 1
+type TruthValue struct {
+	Strength   float64 `json:"strength"`
+	Confidence float64 `json:"confidence"`
+}
+
+// DefaultTruthValue is the truth value of atoms that have not been given one:
+// true, with no confidence
+var DefaultTruthValue = TruthValue{Strength: 1, Confidence: 0}
+
+// countScale is the lookahead constant K relating confidence to evidence count
+const countScale = 800
+
+// Count returns the amount of evidence the confidence corresponds to
+func (tv TruthValue) Count() float64 {
+	if tv.Confidence >= 1 {
+		return countScale * 1e6
+	}
+	return countScale * tv.Confidence / (1 - tv.Confidence)
+}
+
+// ConfidenceFromCount converts an amount of evidence into a confidence
+func ConfidenceFromCount(count float64) float64 {
+	return count / (count + countScale)
+}
+
+// validate checks that both components are between 0 and 1
+func (tv TruthValue) validate() error {
+	if tv.Strength < 0 || tv.Strength > 1 || tv.Confidence < 0 || tv.Confidence > 1 {
+		return fmt.Errorf("invalid truth value (%g, %g): strength and confidence must be between 0 and 1", tv.Strength, tv.Confidence)
+	}
+	return nil
+}
+
+// AttentionValue describes how important an atom is: short-term importance
+// decides what is in the attentional focus, long-term importance decides what
+// is kept in memory, and VLTI protects an atom from being forgotten at all
+type AttentionValue struct {
+	STI  float64 `json:"sti"`
+	LTI  float64 `json:"lti"`
+	VLTI bool    `json:"vlti,omitempty"`
+}
+
+// Atom is a node or link in an AtomSpace
+type Atom struct {
+	Handle   Handle         `json:"handle"`
+	Type     Type           `json:"type"`
+	Name     string         `json:"name,omitempty"`
+	Outgoing []Handle       `json:"outgoing,omitempty"`
+	TV       TruthValue     `json:"tv"`
+	AV       AttentionValue `json:"av"`
+}
+
+// IsNode reports whether the atom is a node
+func (a *Atom) IsNode() bool {
+	return a.Type.IsNode()
+}
+
+// IsLink reports whether the atom is a link
+func (a *Atom) IsLink() bool {
+	return a.Type.IsLink()
+}
+
+// Arity returns the number of atoms in a link's outgoing set
+func (a *Atom) Arity() int {
+	return len(a.Outgoing)
+}
+
+// copy returns a copy of the atom that shares no memory with it
+func (a *Atom) copy() *Atom {
+	c := *a
+	c.Outgoing = append([]Handle(nil), a.Outgoing...)
+	return &c
+}
@@ -0,0 +1,428 @@
+package atomspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AtomSpace is a hypergraph of atoms, indexed by type, by node name and by
+// incoming set. Adding an atom that already exists returns the existing one,
+// so every node and link is held exactly once. It is safe for concurrent use.
+type AtomSpace struct {
+	mu    sync.RWMutex
+	atoms map[Handle]*Atom
+	next  Handle
+
+	// nodes maps a node type and name to the node
+	nodes map[Type]map[string]Handle
+	// links maps the key of a link, its type and outgoing set, to the link
+	links map[string]Handle
+	// byType holds the atoms of each type
+	byType map[Type]map[Handle]struct{}
+	// incoming holds the links each atom appears in
+	incoming map[Handle]map[Handle]struct{}
+}
+
+// New creates an empty AtomSpace
+func New() *AtomSpace {
+	return &AtomSpace{
+		atoms:    make(map[Handle]*Atom),
+		next:     1,
+		nodes:    make(map[Type]map[string]Handle),
+		links:    make(map[string]Handle),
+		byType:   make(map[Type]map[Handle]struct{}),
+		incoming: make(map[Handle]map[Handle]struct{}),
+	}
+}
+
+// AddNode adds a node, or returns the existing node with the same type and
+// name
+func (as *AtomSpace) AddNode(t Type, name string) (Handle, error) {
+	if err := t.validate(); err != nil {
+		return 0, err
+	}
+	if !t.IsNode() {
+		return 0, fmt.Errorf("%s is not a node type", t)
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if h, ok := as.nodes[t][name]; ok {
+		return h, nil
+	}
+
+	atom := &Atom{Type: t, Name: name, TV: DefaultTruthValue}
+	as.insert(atom)
+	if as.nodes[t] == nil {
+		as.nodes[t] = make(map[string]Handle)
+	}
+	as.nodes[t][name] = atom.Handle
+	return atom.Handle, nil
+}
+
+// AddLink adds a link over the given atoms, or returns the existing link
+// with the same type and outgoing set
+func (as *AtomSpace) AddLink(t Type, outgoing ...Handle) (Handle, error) {
+	if err := t.validate(); err != nil {
+		return 0, err
+	}
+	if !t.IsLink() {
+		return 0, fmt.Errorf("%s is not a link type", t)
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	for _, h := range outgoing {
+		if _, ok := as.atoms[h]; !ok {
+			return 0, fmt.Errorf("cannot link to unknown atom %d", h)
+		}
+	}
+
+	key := linkKey(t, outgoing)
+	if h, ok := as.links[key]; ok {
+		return h, nil
+	}
+
+	atom := &Atom{Type: t, Outgoing: append([]Handle(nil), outgoing...), TV: DefaultTruthValue}
+	as.insert(atom)
+	as.links[key] = atom.Handle
+	for _, h := range outgoing {
+		if as.incoming[h] == nil {
+			as.incoming[h] = make(map[Handle]struct{})
+		}
+		as.incoming[h][atom.Handle] = struct{}{}
+	}
+	return atom.Handle, nil
+}
+
+// insert assigns atom a handle and indexes it by type. The caller must hold
+// the write lock.
+func (as *AtomSpace) insert(atom *Atom) {
+	atom.Handle = as.next
+	as.next++
+	as.atoms[atom.Handle] = atom
+	if as.byType[atom.Type] == nil {
+		as.byType[atom.Type] = make(map[Handle]struct{})
+	}
+	as.byType[atom.Type][atom.Handle] = struct{}{}
+}
+
+// linkKey identifies a link by its type and outgoing set
+func linkKey(t Type, outgoing []Handle) string {
+	var b strings.Builder
+	b.WriteString(string(t))
+	for _, h := range outgoing {
+		fmt.Fprintf(&b, " %d", h)
+	}
+	return b.String()
+}
+
+// Get returns a copy of the atom with handle h
+func (as *AtomSpace) Get(h Handle) (*Atom, bool) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	atom, ok := as.atoms[h]
+	if !ok {
+		return nil, false
+	}
+	return atom.copy(), true
+}
+
+// Node looks up a node by type and name
+func (as *AtomSpace) Node(t Type, name string) (Handle, bool) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	h, ok := as.nodes[t][name]
+	return h, ok
+}
+
+// Link looks up a link by type and outgoing set
+func (as *AtomSpace) Link(t Type, outgoing ...Handle) (Handle, bool) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	h, ok := as.links[linkKey(t, outgoing)]
+	return h, ok
+}
+
+// NodesNamed returns the nodes of any type with the given name
+func (as *AtomSpace) NodesNamed(name string) []Handle {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	var handles []Handle
+	for _, names := range as.nodes {
+		if h, ok := names[name]; ok {
+			handles = append(handles, h)
+		}
+	}
+	sortHandles(handles)
+	return handles
+}
+
+// ByType returns the atoms of type t in the order they were added
+func (as *AtomSpace) ByType(t Type) []Handle {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return sortedSet(as.byType[t])
+}
+
+// Incoming returns the links that h appears in, in the order they were added
+func (as *AtomSpace) Incoming(h Handle) []Handle {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return sortedSet(as.incoming[h])
+}
+
+// Handles returns every atom in the order they were added
+func (as *AtomSpace) Handles() []Handle {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	handles := make([]Handle, 0, len(as.atoms))
+	for h := range as.atoms {
+		handles = append(handles, h)
+	}
+	sortHandles(handles)
+	return handles
+}
+
+// Types returns the types of the atoms in the AtomSpace, sorted by name
+func (as *AtomSpace) Types() []Type {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	types := make([]Type, 0, len(as.byType))
+	for t, atoms := range as.byType {
+		if len(atoms) > 0 {
+			types = append(types, t)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// Size returns the number of atoms
+func (as *AtomSpace) Size() int {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return len(as.atoms)
+}
+
+// SetTruthValue sets the truth value of an atom
+func (as *AtomSpace) SetTruthValue(h Handle, tv TruthValue) error {
+	if err := tv.validate(); err != nil {
+		return err
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	atom, ok := as.atoms[h]
+	if !ok {
+		return fmt.Errorf("unknown atom %d", h)
+	}
+	atom.TV = tv
+	return nil
+}
+
+// SetAttentionValue sets the attention value of an atom
+func (as *AtomSpace) SetAttentionValue(h Handle, av AttentionValue) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	atom, ok := as.atoms[h]
+	if !ok {
+		return fmt.Errorf("unknown atom %d", h)
+	}
+	atom.AV = av
+	return nil
+}
+
+// Remove deletes an atom. An atom that appears in links can only be removed
+// recursively, which also removes those links.
+func (as *AtomSpace) Remove(h Handle, recursive bool) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if _, ok := as.atoms[h]; !ok {
+		return fmt.Errorf("unknown atom %d", h)
+	}
+	if len(as.incoming[h]) > 0 && !recursive {
+		return fmt.Errorf("atom %d appears in %d links", h, len(as.incoming[h]))
+	}
+
+	as.remove(h)
+	return nil
+}
+
+// remove deletes an atom and the links it appears in. The caller must hold
+// the write lock.
+func (as *AtomSpace) remove(h Handle) {
+	atom, ok := as.atoms[h]
+	if !ok {
+		return
+	}
+
+	for link := range as.incoming[h] {
+		as.remove(link)
+	}
+	delete(as.incoming, h)
+
+	if atom.IsNode() {
+		delete(as.nodes[atom.Type], atom.Name)
+	} else {
+		delete(as.links, linkKey(atom.Type, atom.Outgoing))
+		for _, out := range atom.Outgoing {
+			delete(as.incoming[out], h)
+		}
+	}
+	delete(as.byType[atom.Type], h)
+	delete(as.atoms, h)
+}
+
+// Clear removes every atom
+func (as *AtomSpace) Clear() {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	fresh := New()
+	as.atoms = fresh.atoms
+	as.next = fresh.next
+	as.nodes = fresh.nodes
+	as.links = fresh.links
+	as.byType = fresh.byType
+	as.incoming = fresh.incoming
+}
+
+// Clone returns a copy of the AtomSpace that shares no memory with it. The
+// atoms keep their handles.
+func (as *AtomSpace) Clone() *AtomSpace {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	c := New()
+	c.next = as.next
+	for h, atom := range as.atoms {
+		c.atoms[h] = atom.copy()
+	}
+	for t, names := range as.nodes {
+		c.nodes[t] = make(map[string]Handle, len(names))
+		for name, h := range names {
+			c.nodes[t][name] = h
+		}
+	}
+	for key, h := range as.links {
+		c.links[key] = h
+	}
+	for t, set := range as.byType {
+		c.byType[t] = copySet(set)
+	}
+	for h, set := range as.incoming {
+		c.incoming[h] = copySet(set)
+	}
+	return c
+}
+
+func copySet(set map[Handle]struct{}) map[Handle]struct{} {
+	c := make(map[Handle]struct{}, len(set))
+	for h := range set {
+		c[h] = struct{}{}
+	}
+	return c
+}
+
+// Save writes every atom to a JSON file
+func (as *AtomSpace) Save(path string) error {
+	as.mu.RLock()
+	atoms := make([]*Atom, 0, len(as.atoms))
+	for _, atom := range as.atoms {
+		atoms = append(atoms, atom.copy())
+	}
+	as.mu.RUnlock()
+	sort.Slice(atoms, func(i, j int) bool { return atoms[i].Handle < atoms[j].Handle })
+
+	data, err := json.MarshalIndent(atoms, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal atoms: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create atomspace directory: %w", err)
+	}
+	// Readers never see a partly written file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write atomspace file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write atomspace file: %w", err)
+	}
+	return nil
+}
+
+// Load reads an AtomSpace written by Save. A missing file yields an empty
+// AtomSpace.
+func Load(path string) (*AtomSpace, error) {
+	as := New()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return as, nil
+		}
+		return nil, fmt.Errorf("failed to read atomspace file: %w", err)
+	}
+
+	var atoms []*Atom
+	if err := json.Unmarshal(data, &atoms); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal atoms: %w", err)
+	}
+
+	// Atoms are saved in handle order, so every link's outgoing atoms are
+	// restored before the link itself
+	handles := make(map[Handle]Handle, len(atoms))
+	for _, saved := range atoms {
+		var h Handle
+		if saved.Type.IsNode() {
+			h, err = as.AddNode(saved.Type, saved.Name)
+		} else {
+			outgoing := make([]Handle, len(saved.Outgoing))
+			for i, out := range saved.Outgoing {
+				outgoing[i] = handles[out]
+			}
+			h, err = as.AddLink(saved.Type, outgoing...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: atom %d: %w", path, saved.Handle, err)
+		}
+		handles[saved.Handle] = h
+		as.SetTruthValue(h, saved.TV)
+		as.SetAttentionValue(h, saved.AV)
+	}
+
+	return as, nil
+}
+
+func sortedSet(set map[Handle]struct{}) []Handle {
+	handles := make([]Handle, 0, len(set))
+	for h := range set {
+		handles = append(handles, h)
+	}
+	sortHandles(handles)
+	return handles
+}
+
+func sortHandles(handles []Handle) {
+	sort.Slice(handles, func(i, j int) bool { return handles[i] < handles[j] })
+}
@@ -0,0 +1,205 @@
+package atomspace
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAddNodeDeduplicates(t *testing.T) {
+	as := New()
+
+	cat, err := as.AddNode(ConceptNode, "cat")
+	if err != nil {
+		t.Fatalf("AddNode failed: %v", err)
+	}
+	again, _ := as.AddNode(ConceptNode, "cat")
+	if again != cat {
+		t.Errorf("Adding the same node should return the same handle, got %d and %d", cat, again)
+	}
+	predicate, _ := as.AddNode(PredicateNode, "cat")
+	if predicate == cat {
+		t.Error("Nodes of different types should be distinct")
+	}
+	if as.Size() != 2 {
+		t.Errorf("Expected 2 atoms, got %d", as.Size())
+	}
+
+	atom, ok := as.Get(cat)
+	if !ok || atom.Name != "cat" || !atom.IsNode() || atom.TV != DefaultTruthValue {
+		t.Errorf("Unexpected atom %+v", atom)
+	}
+}
+
+func TestAddInvalidAtoms(t *testing.T) {
+	as := New()
+
+	if _, err := as.AddNode("Concept", "x"); err == nil {
+		t.Error("AddNode should reject types not ending in Node")
+	}
+	if _, err := as.AddNode(InheritanceLink, "x"); err == nil {
+		t.Error("AddNode should reject link types")
+	}
+	if _, err := as.AddLink(ConceptNode); err == nil {
+		t.Error("AddLink should reject node types")
+	}
+	if _, err := as.AddLink(ListLink, 42); err == nil {
+		t.Error("AddLink should reject unknown outgoing atoms")
+	}
+}
+
+func TestLinksAndIncoming(t *testing.T) {
+	as := New()
+	cat, _ := as.AddNode(ConceptNode, "cat")
+	animal, _ := as.AddNode(ConceptNode, "animal")
+	dog, _ := as.AddNode(ConceptNode, "dog")
+
+	catAnimal, err := as.AddLink(InheritanceLink, cat, animal)
+	if err != nil {
+		t.Fatalf("AddLink failed: %v", err)
+	}
+	dogAnimal, _ := as.AddLink(InheritanceLink, dog, animal)
+	animalCat, _ := as.AddLink(InheritanceLink, animal, cat)
+
+	if again, _ := as.AddLink(InheritanceLink, cat, animal); again != catAnimal {
+		t.Error("Adding the same link should return the same handle")
+	}
+	if animalCat == catAnimal {
+		t.Error("Links with differently ordered outgoing sets should be distinct")
+	}
+
+	if h, ok := as.Link(InheritanceLink, dog, animal); !ok || h != dogAnimal {
+		t.Error("Link lookup failed")
+	}
+	if h, ok := as.Node(ConceptNode, "dog"); !ok || h != dog {
+		t.Error("Node lookup failed")
+	}
+
+	incoming := as.Incoming(animal)
+	if len(incoming) != 3 {
+		t.Errorf("Expected animal in 3 links, got %v", incoming)
+	}
+	if got := as.ByType(InheritanceLink); len(got) != 3 || got[0] != catAnimal {
+		t.Errorf("Unexpected links by type %v", got)
+	}
+	if got := as.NodesNamed("cat"); len(got) != 1 || got[0] != cat {
+		t.Errorf("Unexpected nodes named cat %v", got)
+	}
+	if got := as.Types(); len(got) != 2 || got[0] != ConceptNode {
+		t.Errorf("Unexpected types %v", got)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	as := New()
+	cat, _ := as.AddNode(ConceptNode, "cat")
+	animal, _ := as.AddNode(ConceptNode, "animal")
+	link, _ := as.AddLink(InheritanceLink, cat, animal)
+	outer, _ := as.AddLink(ListLink, link)
+
+	if err := as.Remove(cat, false); err == nil {
+		t.Error("Removing an atom with incoming links should fail unless recursive")
+	}
+	if err := as.Remove(cat, true); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	for _, h := range []Handle{cat, link, outer} {
+		if _, ok := as.Get(h); ok {
+			t.Errorf("Atom %d should have been removed", h)
+		}
+	}
+	if len(as.Incoming(animal)) != 0 {
+		t.Error("Removed links should leave the incoming set of their atoms")
+	}
+	if _, ok := as.Node(ConceptNode, "cat"); ok {
+		t.Error("Removed nodes should leave the name index")
+	}
+	if as.Size() != 1 {
+		t.Errorf("Expected 1 atom left, got %d", as.Size())
+	}
+}
+
+func TestValues(t *testing.T) {
+	as := New()
+	cat, _ := as.AddNode(ConceptNode, "cat")
+
+	if err := as.SetTruthValue(cat, TruthValue{Strength: 0.9, Confidence: 0.8}); err != nil {
+		t.Fatalf("SetTruthValue failed: %v", err)
+	}
+	if err := as.SetTruthValue(cat, TruthValue{Strength: 1.5}); err == nil {
+		t.Error("SetTruthValue should reject values outside [0, 1]")
+	}
+	as.SetAttentionValue(cat, AttentionValue{STI: 10, LTI: 2})
+
+	atom, _ := as.Get(cat)
+	if atom.TV.Strength != 0.9 || atom.AV.STI != 10 {
+		t.Errorf("Unexpected values %+v %+v", atom.TV, atom.AV)
+	}
+
+	tv := TruthValue{Strength: 1, Confidence: ConfidenceFromCount(800)}
+	if tv.Confidence != 0.5 || tv.Count() != 800 {
+		t.Errorf("Count and confidence should convert back and forth, got %g and %g", tv.Confidence, tv.Count())
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	as := New()
+	cat, _ := as.AddNode(ConceptNode, "cat")
+	animal, _ := as.AddNode(ConceptNode, "animal")
+	link, _ := as.AddLink(InheritanceLink, cat, animal)
+	as.SetTruthValue(link, TruthValue{Strength: 0.9, Confidence: 0.8})
+	as.SetAttentionValue(cat, AttentionValue{STI: 5})
+
+	path := filepath.Join(t.TempDir(), "atoms.json")
+	if err := as.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Size() != 3 {
+		t.Fatalf("Expected 3 atoms, got %d", loaded.Size())
+	}
+
+	lcat, _ := loaded.Node(ConceptNode, "cat")
+	lanimal, _ := loaded.Node(ConceptNode, "animal")
+	llink, ok := loaded.Link(InheritanceLink, lcat, lanimal)
+	if !ok {
+		t.Fatal("Link should survive a round trip")
+	}
+	if atom, _ := loaded.Get(llink); atom.TV.Confidence != 0.8 {
+		t.Errorf("Truth value should survive a round trip, got %+v", atom.TV)
+	}
+	if atom, _ := loaded.Get(lcat); atom.AV.STI != 5 {
+		t.Errorf("Attention value should survive a round trip, got %+v", atom.AV)
+	}
+
+	empty, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || empty.Size() != 0 {
+		t.Errorf("Loading a missing file should give an empty AtomSpace, got %v", err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	as := New()
+	cat, _ := as.AddNode(ConceptNode, "cat")
+	animal, _ := as.AddNode(ConceptNode, "animal")
+	link, _ := as.AddLink(InheritanceLink, cat, animal)
+
+	clone := as.Clone()
+	if h, ok := clone.Link(InheritanceLink, cat, animal); !ok || h != link {
+		t.Fatalf("Clone should keep handles, got %d", h)
+	}
+
+	dog, _ := clone.AddNode(ConceptNode, "dog")
+	clone.AddLink(InheritanceLink, dog, animal)
+	clone.SetTruthValue(link, TruthValue{Strength: 0.5, Confidence: 0.5})
+	if as.Size() != 3 || len(as.Incoming(animal)) != 1 {
+		t.Errorf("Changing a clone should not change the original, got %d atoms", as.Size())
+	}
+	if atom, _ := as.Get(link); atom.TV != DefaultTruthValue {
+		t.Errorf("Changing a clone should not change truth values, got %+v", atom.TV)
+	}
+}
@@ -0,0 +1,467 @@
+package atomspace
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/github/hub/v2/opencog/internal/decode"
+)
+
+// Variable is a variable of a query, optionally restricted to atoms of some
+// types
+type Variable struct {
+	Name  string `json:"name"`
+	Types []Type `json:"types,omitempty"`
+}
+
+// accepts reports whether the variable may be bound to an atom of type t
+func (v Variable) accepts(t Type) bool {
+	if len(v.Types) == 0 {
+		return true
+	}
+	for _, allowed := range v.Types {
+		if allowed == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Query is a pattern to be matched against an AtomSpace. Its clauses must
+// all be present in the AtomSpace, with every occurrence of a variable bound
+// to the same atom. A query with a rewrite produces the rewrite for each
+// grounding; a query without one produces the groundings themselves.
+//
+// Queries are written in Atomese, GetLink and BindLink style:
+//
+//	(GetLink
+//	  (TypedVariableLink (VariableNode "$x") (TypeNode "ConceptNode"))
+//	  (AndLink
+//	    (InheritanceLink (VariableNode "$x") (ConceptNode "animal"))
+//	    (EvaluationLink (PredicateNode "likes") (ListLink (VariableNode "$x") (ConceptNode "fish")))))
+//
+// A pattern that is not wrapped in GetLink or BindLink is treated as a
+// GetLink whose variables are those that appear in it.
+type Query struct {
+	Variables []Variable
+	Clauses   []Tree
+	Rewrite   *Tree
+}
+
+// QueryResult holds the answers to a query. For queries without a rewrite,
+// each grounding lists the atoms bound to the variables, in the order of
+// Variables; for queries with one, Results holds the rewritten atoms.
+type QueryResult struct {
+	Variables  []string `json:"variables"`
+	Groundings [][]Tree `json:"groundings,omitempty"`
+	Results    []Tree   `json:"results,omitempty"`
+}
+
+// ParseQuery parses a query written in Atomese
+func ParseQuery(src string) (*Query, error) {
+	trees, err := ParseScheme(strings.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	if len(trees) != 1 {
+		return nil, fmt.Errorf("expected one pattern, found %d", len(trees))
+	}
+	return NewQuery(trees[0])
+}
+
+// NewQuery builds a query from its Atomese form
+func NewQuery(pattern Tree) (*Query, error) {
+	q := &Query{}
+
+	var decl *Tree
+	body := pattern
+	switch pattern.Type {
+	case GetLink:
+		switch len(pattern.Outgoing) {
+		case 1:
+			body = pattern.Outgoing[0]
+		case 2:
+			decl, body = &pattern.Outgoing[0], pattern.Outgoing[1]
+		default:
+			return nil, fmt.Errorf("GetLink takes a pattern and optionally a variable declaration")
+		}
+	case BindLink:
+		switch len(pattern.Outgoing) {
+		case 2:
+			body = pattern.Outgoing[0]
+			q.Rewrite = &pattern.Outgoing[1]
+		case 3:
+			decl, body = &pattern.Outgoing[0], pattern.Outgoing[1]
+			q.Rewrite = &pattern.Outgoing[2]
+		default:
+			return nil, fmt.Errorf("BindLink takes a pattern, a rewrite and optionally a variable declaration")
+		}
+	}
+
+	if body.Type == AndLink {
+		q.Clauses = body.Outgoing
+	} else {
+		q.Clauses = []Tree{body}
+	}
+	if len(q.Clauses) == 0 {
+		return nil, fmt.Errorf("pattern has no clauses")
+	}
+	for _, clause := range q.Clauses {
+		if clause.Type == VariableNode {
+			return nil, fmt.Errorf("a clause cannot be a bare variable")
+		}
+	}
+
+	if decl != nil {
+		vars, err := parseDeclaration(*decl)
+		if err != nil {
+			return nil, err
+		}
+		q.Variables = vars
+	} else {
+		seen := make(map[string]bool)
+		for _, clause := range q.Clauses {
+			collectVariables(clause, seen, &q.Variables)
+		}
+	}
+
+	declared := make(map[string]bool)
+	for _, v := range q.Variables {
+		declared[v.Name] = true
+	}
+	used := make(map[string]bool)
+	for _, clause := range q.Clauses {
+		var vars []Variable
+		collectVariables(clause, make(map[string]bool), &vars)
+		for _, v := range vars {
+			if !declared[v.Name] {
+				return nil, fmt.Errorf("variable %s is not declared", v.Name)
+			}
+			used[v.Name] = true
+		}
+	}
+	for _, v := range q.Variables {
+		if !used[v.Name] {
+			return nil, fmt.Errorf("variable %s does not appear in the pattern", v.Name)
+		}
+	}
+	if q.Rewrite != nil {
+		var vars []Variable
+		collectVariables(*q.Rewrite, make(map[string]bool), &vars)
+		for _, v := range vars {
+			if !declared[v.Name] {
+				return nil, fmt.Errorf("rewrite uses undeclared variable %s", v.Name)
+			}
+		}
+	}
+
+	return q, nil
+}
+
+// parseDeclaration reads the variables of a VariableNode, TypedVariableLink
+// or VariableList
+func parseDeclaration(decl Tree) ([]Variable, error) {
+	switch decl.Type {
+	case VariableNode:
+		return []Variable{{Name: decl.Name}}, nil
+	case TypedVariableLink:
+		if len(decl.Outgoing) != 2 || decl.Outgoing[0].Type != VariableNode {
+			return nil, fmt.Errorf("TypedVariableLink takes a variable and a type")
+		}
+		v := Variable{Name: decl.Outgoing[0].Name}
+		typ := decl.Outgoing[1]
+		choices := []Tree{typ}
+		if typ.Type == TypeChoice {
+			choices = typ.Outgoing
+		}
+		for _, choice := range choices {
+			if choice.Type != TypeNode {
+				return nil, fmt.Errorf("expected TypeNode for variable %s, found %s", v.Name, choice.Type)
+			}
+			t := Type(choice.Name)
+			if err := t.validate(); err != nil {
+				return nil, err
+			}
+			v.Types = append(v.Types, t)
+		}
+		return []Variable{v}, nil
+	case VariableList:
+		var vars []Variable
+		for _, item := range decl.Outgoing {
+			itemVars, err := parseDeclaration(item)
+			if err != nil {
+				return nil, err
+			}
+			vars = append(vars, itemVars...)
+		}
+		return vars, nil
+	}
+	return nil, fmt.Errorf("invalid variable declaration %s", decl.Type)
+}
+
+// collectVariables appends the variables in tree that are not yet seen, in
+// the order they appear
+func collectVariables(tree Tree, seen map[string]bool, vars *[]Variable) {
+	if tree.Type == VariableNode {
+		if !seen[tree.Name] {
+			seen[tree.Name] = true
+			*vars = append(*vars, Variable{Name: tree.Name})
+		}
+		return
+	}
+	for _, child := range tree.Outgoing {
+		collectVariables(child, seen, vars)
+	}
+}
+
+// bindings maps variable names to the atoms they are bound to
+type bindings map[string]Handle
+
+func (b bindings) with(name string, h Handle) bindings {
+	extended := make(bindings, len(b)+1)
+	for k, v := range b {
+		extended[k] = v
+	}
+	extended[name] = h
+	return extended
+}
+
+// matcher matches the clauses of a query against an AtomSpace
+type matcher struct {
+	as    *AtomSpace
+	vars  map[string]Variable
+	limit int
+	found []bindings
+	seen  map[string]bool
+	names []string
+}
+
+// Match returns the distinct groundings of the query's variables, in the
+// order they are found. A positive limit stops the search after that many.
+func (as *AtomSpace) Match(q *Query, limit int) []map[string]Handle {
+	m := &matcher{
+		as:    as,
+		vars:  make(map[string]Variable),
+		limit: limit,
+		seen:  make(map[string]bool),
+	}
+	for _, v := range q.Variables {
+		m.vars[v.Name] = v
+		m.names = append(m.names, v.Name)
+	}
+
+	m.search(q.Clauses, bindings{})
+
+	results := make([]map[string]Handle, len(m.found))
+	for i, b := range m.found {
+		results[i] = b
+	}
+	return results
+}
+
+// search grounds the remaining clauses under b, depth first
+func (m *matcher) search(clauses []Tree, b bindings) {
+	if m.limit > 0 && len(m.found) >= m.limit {
+		return
+	}
+	if len(clauses) == 0 {
+		key := make([]string, len(m.names))
+		for i, name := range m.names {
+			key[i] = fmt.Sprint(b[name])
+		}
+		if k := strings.Join(key, " "); !m.seen[k] {
+			m.seen[k] = true
+			m.found = append(m.found, b)
+		}
+		return
+	}
+
+	clause := clauses[0]
+	for _, candidate := range m.candidates(clause, b) {
+		if extended, ok := m.match(clause, candidate, b); ok {
+			m.search(clauses[1:], extended)
+		}
+	}
+}
+
+// candidates returns the atoms a clause could match. When the clause links
+// to a known atom, only the links that atom appears in are considered.
+func (m *matcher) candidates(clause Tree, b bindings) []Handle {
+	if !hasVariables(clause) {
+		if h, ok := m.as.Find(clause); ok {
+			return []Handle{h}
+		}
+		return nil
+	}
+
+	for _, child := range clause.Outgoing {
+		var anchor Handle
+		if child.Type == VariableNode {
+			h, bound := b[child.Name]
+			if !bound {
+				continue
+			}
+			anchor = h
+		} else if !hasVariables(child) {
+			h, ok := m.as.Find(child)
+			if !ok {
+				return nil
+			}
+			anchor = h
+		} else {
+			continue
+		}
+
+		var handles []Handle
+		for _, link := range m.as.Incoming(anchor) {
+			if atom, ok := m.as.Get(link); ok && atom.Type == clause.Type {
+				handles = append(handles, link)
+			}
+		}
+		return handles
+	}
+
+	return m.as.ByType(clause.Type)
+}
+
+// match unifies a pattern with an atom, extending the bindings
+func (m *matcher) match(pattern Tree, h Handle, b bindings) (bindings, bool) {
+	atom, ok := m.as.Get(h)
+	if !ok {
+		return nil, false
+	}
+
+	if pattern.Type == VariableNode {
+		if v, isVar := m.vars[pattern.Name]; isVar {
+			if bound, ok := b[pattern.Name]; ok {
+				return b, bound == h
+			}
+			if !v.accepts(atom.Type) {
+				return nil, false
+			}
+			return b.with(pattern.Name, h), true
+		}
+	}
+
+	if pattern.Type != atom.Type {
+		return nil, false
+	}
+	if atom.IsNode() {
+		return b, pattern.Name == atom.Name
+	}
+	if len(pattern.Outgoing) != len(atom.Outgoing) {
+		return nil, false
+	}
+	for i, child := range pattern.Outgoing {
+		if b, ok = m.match(child, atom.Outgoing[i], b); !ok {
+			return nil, false
+		}
+	}
+	return b, true
+}
+
+// hasVariables reports whether a tree contains a variable
+func hasVariables(tree Tree) bool {
+	if tree.Type == VariableNode {
+		return true
+	}
+	for _, child := range tree.Outgoing {
+		if hasVariables(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute runs a query and returns its groundings or, for queries with a
+// rewrite, the rewritten atoms. Rewritten atoms are not added to the
+// AtomSpace.
+func (as *AtomSpace) Execute(q *Query, limit int) (*QueryResult, error) {
+	result := &QueryResult{Variables: make([]string, len(q.Variables))}
+	for i, v := range q.Variables {
+		result.Variables[i] = v.Name
+	}
+
+	for _, grounding := range as.Match(q, limit) {
+		if q.Rewrite != nil {
+			tree, err := as.substitute(*q.Rewrite, grounding)
+			if err != nil {
+				return nil, err
+			}
+			result.Results = append(result.Results, tree)
+			continue
+		}
+
+		row := make([]Tree, len(q.Variables))
+		for i, v := range q.Variables {
+			tree, err := as.Tree(grounding[v.Name])
+			if err != nil {
+				return nil, err
+			}
+			row[i] = tree
+		}
+		result.Groundings = append(result.Groundings, row)
+	}
+
+	return result, nil
+}
+
+// Grounded returns the atoms matched by the clauses of a query, for up to
+// limit groundings: the subgraph of the AtomSpace the query's answers come
+// from.
+func (as *AtomSpace) Grounded(q *Query, limit int) ([]Handle, error) {
+	var handles []Handle
+	seen := make(map[Handle]bool)
+	for _, grounding := range as.Match(q, limit) {
+		for _, clause := range q.Clauses {
+			tree, err := as.substitute(clause, grounding)
+			if err != nil {
+				return nil, err
+			}
+			if h, ok := as.Find(tree); ok && !seen[h] {
+				seen[h] = true
+				handles = append(handles, h)
+			}
+		}
+	}
+	return handles, nil
+}
+
+// substitute replaces the variables in tree with the atoms bound to them
+func (as *AtomSpace) substitute(tree Tree, grounding map[string]Handle) (Tree, error) {
+	if tree.Type == VariableNode {
+		if h, ok := grounding[tree.Name]; ok {
+			return as.Tree(h)
+		}
+	}
+
+	result := tree
+	result.Outgoing = nil
+	for _, child := range tree.Outgoing {
+		substituted, err := as.substitute(child, grounding)
+		if err != nil {
+			return Tree{}, err
+		}
+		result.Outgoing = append(result.Outgoing, substituted)
+	}
+	return result, nil
+}
+
+// Count returns the number of answers in the result
+func (r *QueryResult) Count() int {
+	return len(r.Groundings) + len(r.Results)
+}
+
+// QueryPayload encodes a query as the payload of a query message
+func QueryPayload(query string, limit int) map[string]interface{} {
+	return map[string]interface{}{"query": query, "limit": limit}
+}
+
+// DecodeQueryResult extracts a query result from the payload of a reply
+func DecodeQueryResult(payload map[string]interface{}) (*QueryResult, error) {
+	result := &QueryResult{}
+	if err := decode.Payload(payload, "result", "query result", result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,175 @@
+package atomspace
+
+import (
+	"strings"
+	"testing"
+)
+
+const zoo = `(InheritanceLink (ConceptNode "cat") (ConceptNode "animal"))
+(InheritanceLink (ConceptNode "dog") (ConceptNode "animal"))
+(InheritanceLink (ConceptNode "salmon") (ConceptNode "fish"))
+(InheritanceLink (PredicateNode "odd") (ConceptNode "animal"))
+(EvaluationLink (PredicateNode "likes") (ListLink (ConceptNode "cat") (ConceptNode "salmon")))
+(EvaluationLink (PredicateNode "likes") (ListLink (ConceptNode "dog") (ConceptNode "dog")))
+`
+
+func zooSpace(t *testing.T) *AtomSpace {
+	as := New()
+	if _, err := as.ImportScheme(strings.NewReader(zoo)); err != nil {
+		t.Fatalf("ImportScheme failed: %v", err)
+	}
+	return as
+}
+
+// groundingNames returns the names bound to the first variable
+func groundingNames(result *QueryResult) []string {
+	var names []string
+	for _, row := range result.Groundings {
+		names = append(names, row[0].Name)
+	}
+	return names
+}
+
+func runQuery(t *testing.T, as *AtomSpace, src string) *QueryResult {
+	t.Helper()
+	q, err := ParseQuery(src)
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	result, err := as.Execute(q, 0)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	return result
+}
+
+func TestQueryImplicitVariables(t *testing.T) {
+	result := runQuery(t, zooSpace(t), `(InheritanceLink (VariableNode "$x") (ConceptNode "animal"))`)
+
+	if got := strings.Join(groundingNames(result), ","); got != "cat,dog,odd" {
+		t.Errorf("Expected cat,dog,odd, got %s", got)
+	}
+	if len(result.Variables) != 1 || result.Variables[0] != "$x" {
+		t.Errorf("Unexpected variables %v", result.Variables)
+	}
+}
+
+func TestQueryTypeConstraint(t *testing.T) {
+	result := runQuery(t, zooSpace(t), `(GetLink
+  (TypedVariableLink (VariableNode "$x") (TypeNode "ConceptNode"))
+  (InheritanceLink (VariableNode "$x") (ConceptNode "animal")))`)
+
+	if got := strings.Join(groundingNames(result), ","); got != "cat,dog" {
+		t.Errorf("Expected cat,dog, got %s", got)
+	}
+
+	choice := runQuery(t, zooSpace(t), `(GetLink
+  (TypedVariableLink (VariableNode "$x") (TypeChoice (TypeNode "PredicateNode") (TypeNode "NumberNode")))
+  (InheritanceLink (VariableNode "$x") (ConceptNode "animal")))`)
+	if got := strings.Join(groundingNames(choice), ","); got != "odd" {
+		t.Errorf("Expected odd, got %s", got)
+	}
+}
+
+func TestQueryConjunction(t *testing.T) {
+	as := zooSpace(t)
+
+	result := runQuery(t, as, `(GetLink
+  (VariableList (VariableNode "$x") (VariableNode "$y"))
+  (AndLink
+    (InheritanceLink (VariableNode "$x") (ConceptNode "animal"))
+    (EvaluationLink (PredicateNode "likes") (ListLink (VariableNode "$x") (VariableNode "$y")))
+    (InheritanceLink (VariableNode "$y") (ConceptNode "fish"))))`)
+
+	if len(result.Groundings) != 1 {
+		t.Fatalf("Expected one grounding, got %+v", result.Groundings)
+	}
+	if row := result.Groundings[0]; row[0].Name != "cat" || row[1].Name != "salmon" {
+		t.Errorf("Expected cat and salmon, got %+v", row)
+	}
+
+	// A variable appearing twice must be bound to the same atom
+	self := runQuery(t, as, `(EvaluationLink (PredicateNode "likes") (ListLink (VariableNode "$x") (VariableNode "$x")))`)
+	if got := strings.Join(groundingNames(self), ","); got != "dog" {
+		t.Errorf("Expected dog, got %s", got)
+	}
+}
+
+func TestQueryBindLink(t *testing.T) {
+	result := runQuery(t, zooSpace(t), `(BindLink
+  (InheritanceLink (VariableNode "$x") (ConceptNode "fish"))
+  (EvaluationLink (PredicateNode "swims") (VariableNode "$x")))`)
+
+	if len(result.Results) != 1 {
+		t.Fatalf("Expected one result, got %+v", result)
+	}
+	if got := FormatScheme(result.Results[0]); !strings.Contains(got, `(ConceptNode "salmon")`) {
+		t.Errorf("Rewrite should be grounded, got %s", got)
+	}
+}
+
+func TestQueryNoMatches(t *testing.T) {
+	as := zooSpace(t)
+	if result := runQuery(t, as, `(InheritanceLink (VariableNode "$x") (ConceptNode "plant"))`); result.Count() != 0 {
+		t.Errorf("Expected no groundings, got %+v", result)
+	}
+	if result := runQuery(t, as, `(InheritanceLink (ConceptNode "cat") (ConceptNode "animal"))`); result.Count() != 1 {
+		t.Errorf("A present constant pattern should have one empty grounding, got %+v", result)
+	}
+}
+
+func TestQueryLimit(t *testing.T) {
+	as := zooSpace(t)
+	q, _ := ParseQuery(`(InheritanceLink (VariableNode "$x") (VariableNode "$y"))`)
+	if got := len(as.Match(q, 2)); got != 2 {
+		t.Errorf("Expected 2 groundings with a limit, got %d", got)
+	}
+	if got := len(as.Match(q, 0)); got != 4 {
+		t.Errorf("Expected 4 groundings without a limit, got %d", got)
+	}
+}
+
+func TestQueryGrounded(t *testing.T) {
+	as := zooSpace(t)
+	q, _ := ParseQuery(`(AndLink
+  (InheritanceLink (VariableNode "$x") (ConceptNode "animal"))
+  (EvaluationLink (PredicateNode "likes") (ListLink (VariableNode "$x") (VariableNode "$y"))))`)
+
+	handles, err := as.Grounded(q, 0)
+	if err != nil {
+		t.Fatalf("Grounded failed: %v", err)
+	}
+	var got []string
+	for _, h := range handles {
+		tree, _ := as.Tree(h)
+		got = append(got, tree.String())
+	}
+	want := []string{
+		`(InheritanceLink (ConceptNode "cat") (ConceptNode "animal"))`,
+		`(EvaluationLink (PredicateNode "likes") (ListLink (ConceptNode "cat") (ConceptNode "salmon")))`,
+		`(InheritanceLink (ConceptNode "dog") (ConceptNode "animal"))`,
+		`(EvaluationLink (PredicateNode "likes") (ListLink (ConceptNode "dog") (ConceptNode "dog")))`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected the matched links, got %v", got)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	tests := map[string]string{
+		"undeclared":   `(GetLink (VariableNode "$x") (InheritanceLink (VariableNode "$y") (ConceptNode "a")))`,
+		"unused":       `(GetLink (VariableList (VariableNode "$x") (VariableNode "$z")) (InheritanceLink (VariableNode "$x") (ConceptNode "a")))`,
+		"bare":         `(GetLink (VariableNode "$x") (VariableNode "$x"))`,
+		"rewrite":      `(BindLink (InheritanceLink (VariableNode "$x") (ConceptNode "a")) (ListLink (VariableNode "$w")))`,
+		"two patterns": `(ConceptNode "a") (ConceptNode "b")`,
+		"bad type":     `(GetLink (TypedVariableLink (VariableNode "$x") (TypeNode "Thing")) (ListLink (VariableNode "$x")))`,
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseQuery(src); err == nil {
+				t.Errorf("ParseQuery should reject %s", src)
+			}
+		})
+	}
+}
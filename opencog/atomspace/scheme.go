@@ -0,0 +1,411 @@
+package atomspace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseError is an error in Atomese source, located by line and column, both
+// starting at 1
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenOpen
+	tokenClose
+	tokenString
+	tokenSymbol
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	line   int
+	column int
+}
+
+// lexer splits Atomese source into tokens. Comments run from ';' to the end
+// of the line.
+type lexer struct {
+	src    []rune
+	pos    int
+	line   int
+	column int
+}
+
+func (l *lexer) errorf(line, column int, format string, args ...interface{}) error {
+	return &ParseError{Line: line, Column: column, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) advance() rune {
+	r := l.src[l.pos]
+	l.pos++
+	if r == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	return r
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		r := l.src[l.pos]
+		if unicode.IsSpace(r) {
+			l.advance()
+		} else if r == ';' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.advance()
+			}
+		} else {
+			break
+		}
+	}
+
+	tok := token{line: l.line, column: l.column}
+	if l.pos >= len(l.src) {
+		tok.kind = tokenEOF
+		return tok, nil
+	}
+
+	switch r := l.advance(); r {
+	case '(':
+		tok.kind = tokenOpen
+	case ')':
+		tok.kind = tokenClose
+	case '"':
+		tok.kind = tokenString
+		var b strings.Builder
+		for {
+			if l.pos >= len(l.src) {
+				return tok, l.errorf(tok.line, tok.column, "unterminated string")
+			}
+			c := l.advance()
+			if c == '"' {
+				break
+			}
+			if c == '\\' {
+				if l.pos >= len(l.src) {
+					return tok, l.errorf(tok.line, tok.column, "unterminated string")
+				}
+				switch e := l.advance(); e {
+				case 'n':
+					c = '\n'
+				case 't':
+					c = '\t'
+				case '"', '\\':
+					c = e
+				default:
+					return tok, l.errorf(l.line, l.column-2, "unknown escape \\%c", e)
+				}
+			}
+			b.WriteRune(c)
+		}
+		tok.text = b.String()
+	default:
+		tok.kind = tokenSymbol
+		var b strings.Builder
+		b.WriteRune(r)
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			if unicode.IsSpace(c) || c == '(' || c == ')' || c == '"' || c == ';' {
+				break
+			}
+			b.WriteRune(l.advance())
+		}
+		tok.text = b.String()
+	}
+	return tok, nil
+}
+
+// parser builds trees from the tokens of a lexer
+type parser struct {
+	lex  *lexer
+	peek *token
+}
+
+func (p *parser) next() (token, error) {
+	if p.peek != nil {
+		tok := *p.peek
+		p.peek = nil
+		return tok, nil
+	}
+	return p.lex.next()
+}
+
+func (p *parser) unread(tok token) {
+	p.peek = &tok
+}
+
+// ParseScheme parses Atomese s-expressions such as
+//
+//	(InheritanceLink (stv 0.9 0.8)
+//	  (ConceptNode "cat")
+//	  (ConceptNode "animal"))
+//
+// Truth values are given with (stv strength confidence) and attention values
+// with (av sti lti vlti), anywhere among an atom's arguments.
+func ParseScheme(r io.Reader) ([]Tree, error) {
+	src, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{lex: &lexer{src: []rune(string(src)), line: 1, column: 1}}
+
+	var trees []Tree
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind == tokenEOF {
+			return trees, nil
+		}
+		if tok.kind != tokenOpen {
+			return nil, p.lex.errorf(tok.line, tok.column, "expected '(', found %s", describe(tok))
+		}
+
+		tree, err := p.parseAtom(tok)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+	}
+}
+
+// parseAtom parses an atom whose opening parenthesis has been read
+func (p *parser) parseAtom(open token) (Tree, error) {
+	head, err := p.next()
+	if err != nil {
+		return Tree{}, err
+	}
+	if head.kind != tokenSymbol {
+		return Tree{}, p.lex.errorf(head.line, head.column, "expected an atom type, found %s", describe(head))
+	}
+
+	t := Type(head.text)
+	if head.text == "stv" || head.text == "av" {
+		return Tree{}, p.lex.errorf(head.line, head.column, "%s must be given inside an atom", head.text)
+	}
+	if err := t.validate(); err != nil {
+		return Tree{}, p.lex.errorf(head.line, head.column, "unknown atom type %q", head.text)
+	}
+
+	tree := Tree{Type: t}
+	hasName := false
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return Tree{}, err
+		}
+
+		switch tok.kind {
+		case tokenClose:
+			if t.IsNode() && !hasName {
+				return Tree{}, p.lex.errorf(open.line, open.column, "%s has no name", t)
+			}
+			return tree, nil
+		case tokenEOF:
+			return Tree{}, p.lex.errorf(open.line, open.column, "unclosed %s", t)
+		case tokenString, tokenSymbol:
+			if t.IsLink() {
+				return Tree{}, p.lex.errorf(tok.line, tok.column, "%s cannot have a name, found %s", t, describe(tok))
+			}
+			if tok.kind == tokenSymbol {
+				if _, err := strconv.ParseFloat(tok.text, 64); err != nil {
+					return Tree{}, p.lex.errorf(tok.line, tok.column, "expected a quoted name, found %s", describe(tok))
+				}
+			}
+			if hasName {
+				return Tree{}, p.lex.errorf(tok.line, tok.column, "%s has more than one name", t)
+			}
+			tree.Name = tok.text
+			hasName = true
+		case tokenOpen:
+			inner, err := p.next()
+			if err != nil {
+				return Tree{}, err
+			}
+			if inner.kind == tokenSymbol && (inner.text == "stv" || inner.text == "av") {
+				if err := p.parseValue(&tree, inner); err != nil {
+					return Tree{}, err
+				}
+				continue
+			}
+			p.unread(inner)
+			if t.IsNode() {
+				return Tree{}, p.lex.errorf(tok.line, tok.column, "%s cannot contain other atoms", t)
+			}
+			child, err := p.parseAtom(tok)
+			if err != nil {
+				return Tree{}, err
+			}
+			tree.Outgoing = append(tree.Outgoing, child)
+		}
+	}
+}
+
+// parseValue parses the numbers of an stv or av value and the closing
+// parenthesis
+func (p *parser) parseValue(tree *Tree, head token) error {
+	want := 2
+	if head.text == "av" {
+		want = 3
+	}
+
+	var numbers []float64
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return err
+		}
+		if tok.kind == tokenClose {
+			break
+		}
+		if tok.kind != tokenSymbol {
+			return p.lex.errorf(tok.line, tok.column, "expected a number in %s, found %s", head.text, describe(tok))
+		}
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return p.lex.errorf(tok.line, tok.column, "expected a number in %s, found %s", head.text, describe(tok))
+		}
+		numbers = append(numbers, n)
+	}
+	if len(numbers) != want {
+		return p.lex.errorf(head.line, head.column, "%s takes %d numbers, found %d", head.text, want, len(numbers))
+	}
+
+	if head.text == "stv" {
+		tv := TruthValue{Strength: numbers[0], Confidence: numbers[1]}
+		if err := tv.validate(); err != nil {
+			return p.lex.errorf(head.line, head.column, "%v", err)
+		}
+		tree.TV = &tv
+	} else {
+		tree.AV = &AttentionValue{STI: numbers[0], LTI: numbers[1], VLTI: numbers[2] != 0}
+	}
+	return nil
+}
+
+func describe(tok token) string {
+	switch tok.kind {
+	case tokenEOF:
+		return "end of input"
+	case tokenOpen:
+		return "'('"
+	case tokenClose:
+		return "')'"
+	case tokenString:
+		return strconv.Quote(tok.text)
+	}
+	return tok.text
+}
+
+// ImportScheme parses Atomese and adds its atoms, returning the handles of
+// the top-level atoms in the order they appear
+func (as *AtomSpace) ImportScheme(r io.Reader) ([]Handle, error) {
+	trees, err := ParseScheme(r)
+	if err != nil {
+		return nil, err
+	}
+
+	handles := make([]Handle, 0, len(trees))
+	for _, tree := range trees {
+		h, err := as.AddTree(tree)
+		if err != nil {
+			return nil, err
+		}
+		handles = append(handles, h)
+	}
+	return handles, nil
+}
+
+// ExportScheme writes every atom as Atomese. Each atom that does not appear
+// in a link is written as one top-level expression, in the order the atoms
+// were added, so exporting the import of an exported file reproduces it.
+func (as *AtomSpace) ExportScheme(w io.Writer) error {
+	for _, h := range as.Roots() {
+		tree, err := as.Tree(h)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, FormatScheme(tree)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FormatScheme formats a tree as Atomese. Links put each outgoing atom on
+// its own line, indented by two spaces per level.
+func FormatScheme(tree Tree) string {
+	var b strings.Builder
+	writeScheme(&b, tree, 0)
+	return b.String()
+}
+
+// String formats the tree as Atomese on a single line
+func (t Tree) String() string {
+	var b strings.Builder
+	writeScheme(&b, t, -1)
+	return b.String()
+}
+
+// writeScheme writes tree with each child on its own line, indented by depth,
+// or on the same line if depth is negative
+func writeScheme(b *strings.Builder, tree Tree, depth int) {
+	b.WriteString("(")
+	b.WriteString(string(tree.Type))
+	if tree.Type.IsNode() {
+		b.WriteString(" ")
+		b.WriteString(quote(tree.Name))
+	}
+	if tree.TV != nil {
+		fmt.Fprintf(b, " (stv %s %s)", formatNumber(tree.TV.Strength), formatNumber(tree.TV.Confidence))
+	}
+	if tree.AV != nil {
+		vlti := 0
+		if tree.AV.VLTI {
+			vlti = 1
+		}
+		fmt.Fprintf(b, " (av %s %s %d)", formatNumber(tree.AV.STI), formatNumber(tree.AV.LTI), vlti)
+	}
+	for _, child := range tree.Outgoing {
+		if depth < 0 {
+			b.WriteString(" ")
+			writeScheme(b, child, depth)
+			continue
+		}
+		b.WriteString("\n")
+		b.WriteString(strings.Repeat("  ", depth+1))
+		writeScheme(b, child, depth+1)
+	}
+	b.WriteString(")")
+}
+
+// quote quotes a name using the escapes the parser understands
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// formatNumber formats n with the fewest digits that parse back to n
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
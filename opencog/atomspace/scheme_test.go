@@ -0,0 +1,150 @@
+package atomspace
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const schemeSource = `(InheritanceLink (stv 0.9 0.8)
+  (ConceptNode "cat")
+  (ConceptNode "animal"))
+(EvaluationLink (stv 0.75 0.5)
+  (PredicateNode "likes" (av 10 2 1))
+  (ListLink
+    (ConceptNode "cat")
+    (ConceptNode "fish \"fresh\"")))
+(ConceptNode "lonely" (stv 0.1 0.2))
+`
+
+func TestParseScheme(t *testing.T) {
+	trees, err := ParseScheme(strings.NewReader(schemeSource))
+	if err != nil {
+		t.Fatalf("ParseScheme failed: %v", err)
+	}
+	if len(trees) != 3 {
+		t.Fatalf("Expected 3 top-level atoms, got %d", len(trees))
+	}
+
+	inheritance := trees[0]
+	if inheritance.Type != InheritanceLink || inheritance.TV == nil || inheritance.TV.Strength != 0.9 {
+		t.Errorf("Unexpected first atom %+v", inheritance)
+	}
+	if inheritance.Outgoing[1].Name != "animal" {
+		t.Errorf("Unexpected outgoing %+v", inheritance.Outgoing)
+	}
+
+	likes := trees[1].Outgoing[0]
+	if likes.AV == nil || likes.AV.STI != 10 || !likes.AV.VLTI {
+		t.Errorf("Unexpected attention value %+v", likes.AV)
+	}
+	if name := trees[1].Outgoing[1].Outgoing[1].Name; name != `fish "fresh"` {
+		t.Errorf("Escapes should be decoded, got %q", name)
+	}
+}
+
+func TestParseSchemeAcceptsVariants(t *testing.T) {
+	src := `; a comment
+(InheritanceLink
+  (ConceptNode "cat") ; trailing comment
+  (ConceptNode "animal")
+  (stv 0.5 0.5))
+(NumberNode 3)`
+
+	trees, err := ParseScheme(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseScheme failed: %v", err)
+	}
+	if trees[0].TV == nil || trees[0].TV.Strength != 0.5 {
+		t.Errorf("Truth value after the outgoing set should be accepted, got %+v", trees[0])
+	}
+	if trees[1].Name != "3" {
+		t.Errorf("Numbers should be accepted as node names, got %q", trees[1].Name)
+	}
+}
+
+func TestParseSchemeErrors(t *testing.T) {
+	tests := []struct {
+		src    string
+		line   int
+		column int
+		msg    string
+	}{
+		{src: `(ConceptNode "cat"`, line: 1, column: 1, msg: "unclosed ConceptNode"},
+		{src: "(ConceptNode \"cat\")\n  (Concept \"dog\")", line: 2, column: 4, msg: `unknown atom type "Concept"`},
+		{src: `(InheritanceLink "cat")`, line: 1, column: 18, msg: "cannot have a name"},
+		{src: `(ConceptNode "a" "b")`, line: 1, column: 18, msg: "more than one name"},
+		{src: `(ConceptNode)`, line: 1, column: 1, msg: "has no name"},
+		{src: `(ConceptNode cat)`, line: 1, column: 14, msg: "expected a quoted name"},
+		{src: `(ConceptNode "cat" (stv 0.9))`, line: 1, column: 21, msg: "stv takes 2 numbers"},
+		{src: `(ConceptNode "cat" (stv 2 1))`, line: 1, column: 21, msg: "invalid truth value"},
+		{src: `(ConceptNode "cat" (stv high 1))`, line: 1, column: 25, msg: "expected a number"},
+		{src: `(stv 1 1)`, line: 1, column: 2, msg: "must be given inside an atom"},
+		{src: `(ConceptNode "cat`, line: 1, column: 14, msg: "unterminated string"},
+		{src: `ConceptNode`, line: 1, column: 1, msg: "expected '('"},
+		{src: "(ListLink\n\t(ConceptNode \"a\"))\n)", line: 3, column: 1, msg: "expected '('"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := ParseScheme(strings.NewReader(tt.src))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Expected a ParseError, got %v", err)
+			}
+			if parseErr.Line != tt.line || parseErr.Column != tt.column || !strings.Contains(parseErr.Msg, tt.msg) {
+				t.Errorf("Expected %d:%d %q, got %v", tt.line, tt.column, tt.msg, err)
+			}
+		})
+	}
+}
+
+func TestSchemeRoundTrip(t *testing.T) {
+	as := New()
+	if _, err := as.ImportScheme(strings.NewReader(schemeSource)); err != nil {
+		t.Fatalf("ImportScheme failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := as.ExportScheme(&out); err != nil {
+		t.Fatalf("ExportScheme failed: %v", err)
+	}
+	if out.String() != schemeSource {
+		t.Errorf("Round trip should reproduce the source exactly, got:\n%s", out.String())
+	}
+
+	again := New()
+	again.ImportScheme(&out)
+	if again.Size() != as.Size() {
+		t.Errorf("Expected %d atoms after re-import, got %d", as.Size(), again.Size())
+	}
+}
+
+func TestFormatSchemeNumbers(t *testing.T) {
+	tree := Tree{Type: ConceptNode, Name: "x", TV: &TruthValue{Strength: 1.0 / 3, Confidence: 0.1}}
+	text := FormatScheme(tree)
+
+	trees, err := ParseScheme(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("ParseScheme failed: %v", err)
+	}
+	if *trees[0].TV != *tree.TV {
+		t.Errorf("Truth values should survive formatting exactly, got %+v from %s", trees[0].TV, text)
+	}
+}
+
+func TestTreeString(t *testing.T) {
+	tree := Tree{
+		Type: InheritanceLink,
+		TV:   &TruthValue{Strength: 0.9, Confidence: 0.8},
+		Outgoing: []Tree{
+			{Type: ConceptNode, Name: "cat"},
+			{Type: ConceptNode, Name: "animal"},
+		},
+	}
+	want := `(InheritanceLink (stv 0.9 0.8) (ConceptNode "cat") (ConceptNode "animal"))`
+	if got := tree.String(); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,138 @@
+package atomspace
+
+import (
+	"fmt"
+
+	"github.com/github/hub/v2/opencog/internal/decode"
+)
+
+// Tree is an atom together with its outgoing atoms, independent of any
+// AtomSpace. It is the form in which knowledge is exchanged between agents.
+type Tree struct {
+	Type     Type            `json:"type"`
+	Name     string          `json:"name,omitempty"`
+	Outgoing []Tree          `json:"outgoing,omitempty"`
+	TV       *TruthValue     `json:"tv,omitempty"`
+	AV       *AttentionValue `json:"av,omitempty"`
+}
+
+// Tree returns the atom with handle h as a tree. Truth and attention values
+// are included when they differ from the defaults.
+func (as *AtomSpace) Tree(h Handle) (Tree, error) {
+	atom, ok := as.Get(h)
+	if !ok {
+		return Tree{}, fmt.Errorf("unknown atom %d", h)
+	}
+
+	tree := Tree{Type: atom.Type, Name: atom.Name}
+	if atom.TV != DefaultTruthValue {
+		tv := atom.TV
+		tree.TV = &tv
+	}
+	if atom.AV != (AttentionValue{}) {
+		av := atom.AV
+		tree.AV = &av
+	}
+	for _, out := range atom.Outgoing {
+		child, err := as.Tree(out)
+		if err != nil {
+			return Tree{}, err
+		}
+		tree.Outgoing = append(tree.Outgoing, child)
+	}
+	return tree, nil
+}
+
+// AddTree adds the atoms of a tree and returns the handle of its root. Truth
+// and attention values in the tree replace those of existing atoms.
+func (as *AtomSpace) AddTree(tree Tree) (Handle, error) {
+	var h Handle
+	var err error
+
+	if tree.Type.IsLink() {
+		outgoing := make([]Handle, len(tree.Outgoing))
+		for i, child := range tree.Outgoing {
+			if outgoing[i], err = as.AddTree(child); err != nil {
+				return 0, err
+			}
+		}
+		h, err = as.AddLink(tree.Type, outgoing...)
+	} else {
+		if len(tree.Outgoing) > 0 {
+			return 0, fmt.Errorf("node %s %q cannot have outgoing atoms", tree.Type, tree.Name)
+		}
+		h, err = as.AddNode(tree.Type, tree.Name)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if tree.TV != nil {
+		if err := as.SetTruthValue(h, *tree.TV); err != nil {
+			return 0, err
+		}
+	}
+	if tree.AV != nil {
+		as.SetAttentionValue(h, *tree.AV)
+	}
+	return h, nil
+}
+
+// Find returns the handle of the atom a tree describes, without adding it
+func (as *AtomSpace) Find(tree Tree) (Handle, bool) {
+	if !tree.Type.IsLink() {
+		return as.Node(tree.Type, tree.Name)
+	}
+	outgoing := make([]Handle, len(tree.Outgoing))
+	for i, child := range tree.Outgoing {
+		h, ok := as.Find(child)
+		if !ok {
+			return 0, false
+		}
+		outgoing[i] = h
+	}
+	return as.Link(tree.Type, outgoing...)
+}
+
+// Bare returns the tree without truth or attention values
+func (t Tree) Bare() Tree {
+	bare := Tree{Type: t.Type, Name: t.Name}
+	for _, child := range t.Outgoing {
+		bare.Outgoing = append(bare.Outgoing, child.Bare())
+	}
+	return bare
+}
+
+// Roots returns the atoms that do not appear in any link, in the order they
+// were added. Together they cover the whole AtomSpace.
+func (as *AtomSpace) Roots() []Handle {
+	var roots []Handle
+	for _, h := range as.Handles() {
+		if len(as.Incoming(h)) == 0 {
+			roots = append(roots, h)
+		}
+	}
+	return roots
+}
+
+// KnowledgePayload encodes atoms as the payload of a knowledge message
+func (as *AtomSpace) KnowledgePayload(handles ...Handle) (map[string]interface{}, error) {
+	trees := make([]Tree, 0, len(handles))
+	for _, h := range handles {
+		tree, err := as.Tree(h)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+	}
+	return map[string]interface{}{"atoms": trees}, nil
+}
+
+// DecodeKnowledge extracts the atoms from the payload of a knowledge message
+func DecodeKnowledge(payload map[string]interface{}) ([]Tree, error) {
+	var trees []Tree
+	if err := decode.Payload(payload, "atoms", "atoms", &trees); err != nil {
+		return nil, err
+	}
+	return trees, nil
+}
@@ -0,0 +1,94 @@
+package atomspace
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTreeRoundTrip(t *testing.T) {
+	as := New()
+	cat, _ := as.AddNode(ConceptNode, "cat")
+	animal, _ := as.AddNode(ConceptNode, "animal")
+	link, _ := as.AddLink(InheritanceLink, cat, animal)
+	as.SetTruthValue(link, TruthValue{Strength: 0.9, Confidence: 0.8})
+
+	tree, err := as.Tree(link)
+	if err != nil {
+		t.Fatalf("Tree failed: %v", err)
+	}
+	if tree.Type != InheritanceLink || len(tree.Outgoing) != 2 || tree.Outgoing[0].Name != "cat" {
+		t.Errorf("Unexpected tree %+v", tree)
+	}
+	if tree.TV == nil || tree.Outgoing[0].TV != nil {
+		t.Error("Only non-default truth values should be included")
+	}
+
+	other := New()
+	h, err := other.AddTree(tree)
+	if err != nil {
+		t.Fatalf("AddTree failed: %v", err)
+	}
+	if atom, _ := other.Get(h); atom.TV.Strength != 0.9 || other.Size() != 3 {
+		t.Errorf("Tree should be added with its values, got %+v", atom)
+	}
+
+	if _, err := other.AddTree(Tree{Type: ConceptNode, Name: "x", Outgoing: []Tree{{Type: ConceptNode}}}); err == nil {
+		t.Error("AddTree should reject nodes with outgoing atoms")
+	}
+}
+
+func TestFind(t *testing.T) {
+	as := New()
+	cat, _ := as.AddNode(ConceptNode, "cat")
+	animal, _ := as.AddNode(ConceptNode, "animal")
+	link, _ := as.AddLink(InheritanceLink, cat, animal)
+	as.SetTruthValue(link, TruthValue{Strength: 0.9, Confidence: 0.8})
+
+	tree, _ := as.Tree(link)
+	if h, ok := as.Find(tree.Bare()); !ok || h != link {
+		t.Errorf("Expected to find the link, got %v", h)
+	}
+	missing := Tree{Type: InheritanceLink, Outgoing: []Tree{tree.Outgoing[1], tree.Outgoing[0]}}
+	if _, ok := as.Find(missing); ok {
+		t.Error("Find should not match atoms that are not in the AtomSpace")
+	}
+	if as.Size() != 3 {
+		t.Errorf("Find should not add atoms, got %d", as.Size())
+	}
+}
+
+func TestKnowledgePayload(t *testing.T) {
+	as := New()
+	cat, _ := as.AddNode(ConceptNode, "cat")
+	animal, _ := as.AddNode(ConceptNode, "animal")
+	as.AddLink(InheritanceLink, cat, animal)
+
+	roots := as.Roots()
+	if len(roots) != 1 {
+		t.Fatalf("Expected one root, got %v", roots)
+	}
+
+	payload, err := as.KnowledgePayload(roots...)
+	if err != nil {
+		t.Fatalf("KnowledgePayload failed: %v", err)
+	}
+
+	// Payloads crossing process boundaries arrive as decoded JSON
+	data, _ := json.Marshal(payload)
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+
+	for _, p := range []map[string]interface{}{payload, decoded} {
+		trees, err := DecodeKnowledge(p)
+		if err != nil {
+			t.Fatalf("DecodeKnowledge failed: %v", err)
+		}
+		if len(trees) != 1 || trees[0].Type != InheritanceLink {
+			t.Errorf("Unexpected trees %+v", trees)
+		}
+	}
+
+	if _, err := DecodeKnowledge(map[string]interface{}{}); err == nil {
+		t.Error("DecodeKnowledge should fail without atoms")
+	}
+}
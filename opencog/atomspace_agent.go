@@ -0,0 +1,225 @@
+package opencog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+func init() {
+	RegisterBehavior(AtomSpaceAgent, newAtomSpaceBehavior)
+}
+
+// AtomSpacePath returns the file holding the knowledge of an AtomSpace agent
+func AtomSpacePath(configDir string, agent *Agent) string {
+	return filepath.Join(configDir, "atomspace", agent.ID+".json")
+}
+
+// AtomSpaceStore holds an agent's AtomSpace and keeps it in sync with its
+// file, so that several processes can work with the same knowledge
+type AtomSpaceStore struct {
+	mu    sync.Mutex
+	path  string
+	space *atomspace.AtomSpace
+	// seen is the file as this store last read or wrote it
+	seen     os.FileInfo
+	maxAtoms int
+}
+
+// stores holds the stores opened by this process, one per file, so that
+// agents hosted together see and keep each other's changes
+var (
+	storesMu sync.Mutex
+	stores   = make(map[string]*AtomSpaceStore)
+)
+
+// OpenAtomSpace opens the AtomSpace of an agent
+func OpenAtomSpace(configDir string, agent *Agent) (*AtomSpaceStore, error) {
+	path := AtomSpacePath(configDir, agent)
+
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	store, ok := stores[path]
+	if !ok {
+		store = &AtomSpaceStore{path: path}
+	}
+
+	store.mu.Lock()
+	store.maxAtoms = agent.ConfigInt("max_atoms")
+	err := store.refresh()
+	store.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	stores[path] = store
+	return store, nil
+}
+
+// refresh reloads the AtomSpace if its file changed since it was last read.
+// The caller must hold the lock.
+func (s *AtomSpaceStore) refresh() error {
+	info, err := os.Stat(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read atomspace: %w", err)
+	}
+	if s.space != nil && (info == nil || s.seen != nil && os.SameFile(info, s.seen) &&
+		info.ModTime().Equal(s.seen.ModTime()) && info.Size() == s.seen.Size()) {
+		return nil
+	}
+
+	space, err := atomspace.Load(s.path)
+	if err != nil {
+		return err
+	}
+	s.space = space
+	s.seen = info
+	return nil
+}
+
+// save writes the AtomSpace to its file. The caller must hold the lock.
+func (s *AtomSpaceStore) save() error {
+	if err := s.space.Save(s.path); err != nil {
+		return err
+	}
+	s.seen, _ = os.Stat(s.path)
+	return nil
+}
+
+// Read calls fn with the current AtomSpace
+func (s *AtomSpaceStore) Read(fn func(*atomspace.AtomSpace) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	return fn(s.space)
+}
+
+// Update calls fn with the current AtomSpace and saves it if fn succeeds.
+// The change is rejected if it grows the AtomSpace beyond the agent's
+// max_atoms. The file is locked throughout, so that the changes other
+// processes make at the same time are kept.
+func (s *AtomSpaceStore) Update(fn func(*atomspace.AtomSpace) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create atomspace directory: %w", err)
+	}
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock atomspace: %w", err)
+	}
+	defer unlock()
+
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	if err := fn(s.space); err != nil {
+		// Discard any partial change
+		s.space = nil
+		s.refresh()
+		return err
+	}
+	if s.maxAtoms > 0 && s.space.Size() > s.maxAtoms {
+		size := s.space.Size()
+		s.space = nil
+		s.refresh()
+		return fmt.Errorf("atomspace would hold %d atoms, more than max_atoms %d", size, s.maxAtoms)
+	}
+	return s.save()
+}
+
+// atomSpaceBehavior implements the atomspace agent type: it stores the
+// knowledge sent to it and answers queries over it
+type atomSpaceBehavior struct {
+	store *AtomSpaceStore
+}
+
+func newAtomSpaceBehavior(agent *Agent, configDir string) (Behavior, error) {
+	store, err := OpenAtomSpace(configDir, agent)
+	if err != nil {
+		return nil, err
+	}
+	return &atomSpaceBehavior{store: store}, nil
+}
+
+func (b *atomSpaceBehavior) HandleMessage(msg *Message) (*Message, error) {
+	switch msg.Type {
+	case MessageTypeKnowledge:
+		return b.addKnowledge(msg)
+	case MessageTypeQuery:
+		return b.query(msg)
+	case MessageTypeHeartbeat:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("atomspace agents do not handle %s messages", msg.Type)
+}
+
+// addKnowledge adds the atoms of a knowledge message and replies with the
+// number of atoms added and the new size of the AtomSpace
+func (b *atomSpaceBehavior) addKnowledge(msg *Message) (*Message, error) {
+	trees, err := atomspace.DecodeKnowledge(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var before, after int
+	err = b.store.Update(func(space *atomspace.AtomSpace) error {
+		before = space.Size()
+		for _, tree := range trees {
+			if _, err := space.AddTree(tree); err != nil {
+				return err
+			}
+		}
+		after = space.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Type:    MessageTypeResponse,
+		Payload: map[string]interface{}{"added": after - before, "size": after},
+	}, nil
+}
+
+// query runs the Atomese pattern in the message's "query" and replies with
+// the result. An optional "limit" caps the number of answers.
+func (b *atomSpaceBehavior) query(msg *Message) (*Message, error) {
+	src, ok := msg.Payload["query"].(string)
+	if !ok || src == "" {
+		return nil, fmt.Errorf("query message has no query")
+	}
+	q, err := atomspace.ParseQuery(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+
+	limit := 0
+	switch v := msg.Payload["limit"].(type) {
+	case int:
+		limit = v
+	case float64:
+		limit = int(v)
+	}
+
+	var result *atomspace.QueryResult
+	err = b.store.Read(func(space *atomspace.AtomSpace) error {
+		result, err = space.Execute(q, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Type:    MessageTypeResponse,
+		Payload: map[string]interface{}{"result": result},
+	}, nil
+}
@@ -0,0 +1,228 @@
+package opencog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// catIsAnimal returns a knowledge payload stating that cats are animals
+func catIsAnimal() map[string]interface{} {
+	return map[string]interface{}{"atoms": []atomspace.Tree{{
+		Type: atomspace.InheritanceLink,
+		Outgoing: []atomspace.Tree{
+			{Type: atomspace.ConceptNode, Name: "cat"},
+			{Type: atomspace.ConceptNode, Name: "animal"},
+		},
+		TV: &atomspace.TruthValue{Strength: 0.9, Confidence: 0.8},
+	}}}
+}
+
+// receive waits for a message on ch
+func receive(t *testing.T, ch chan *Message) *Message {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a message")
+	}
+	return nil
+}
+
+func TestAtomSpaceAgentStoresKnowledge(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "kb", Type: AtomSpaceAgent})
+	agent.Status = StatusRunning
+	registry.Register(agent)
+
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.hostAgents()
+	if hosted := orchestrator.Hosted(); len(hosted) != 1 || hosted[0] != agent.ID {
+		t.Fatalf("Running atomspace agent should be hosted, got %v", hosted)
+	}
+
+	orchestrator.RegisterAgent("sender")
+	inbox, _ := orchestrator.GetAgentChannel("sender")
+
+	msg := &Message{From: "sender", To: agent.ID, Type: MessageTypeKnowledge, Payload: catIsAnimal()}
+	if err := orchestrator.SendMessage(msg); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	reply := receive(t, inbox)
+	if reply.Type != MessageTypeResponse || reply.ReplyTo != msg.ID {
+		t.Fatalf("Expected a response to %s, got %+v", msg.ID, reply)
+	}
+	if reply.Payload["added"] != 3 || reply.Payload["size"] != 3 {
+		t.Errorf("Expected 3 atoms added, got %v", reply.Payload)
+	}
+
+	// The knowledge is persisted and visible to other processes
+	store, err := OpenAtomSpace(registry.Dir(), agent)
+	if err != nil {
+		t.Fatalf("OpenAtomSpace failed: %v", err)
+	}
+	store.Read(func(space *atomspace.AtomSpace) error {
+		cat, _ := space.Node(atomspace.ConceptNode, "cat")
+		animal, _ := space.Node(atomspace.ConceptNode, "animal")
+		if _, ok := space.Link(atomspace.InheritanceLink, cat, animal); !ok {
+			t.Error("Stored knowledge should contain the link")
+		}
+		return nil
+	})
+
+	orchestrator.SendMessage(&Message{From: "sender", To: agent.ID, Type: MessageTypeCommand})
+	if reply := receive(t, inbox); reply.Type != MessageTypeError {
+		t.Errorf("Unsupported messages should be answered with an error, got %+v", reply)
+	}
+
+	// Reconfigured agents are hosted anew with their new configuration
+	agent.Config = map[string]interface{}{"max_atoms": 2}
+	orchestrator.hostAgents()
+	orchestrator.SendMessage(&Message{From: "sender", To: agent.ID, Type: MessageTypeKnowledge, Payload: catIsAnimal()})
+	if reply := receive(t, inbox); reply.Type != MessageTypeError {
+		t.Errorf("Expected the new max_atoms to apply, got %+v", reply)
+	}
+
+	agent.Status = StatusStopped
+	orchestrator.hostAgents()
+	if len(orchestrator.Hosted()) != 0 {
+		t.Error("Stopped agents should no longer be hosted")
+	}
+}
+
+func TestAtomSpaceMaxAtoms(t *testing.T) {
+	dir := t.TempDir()
+	agent, _ := NewAgent(AgentConfig{Name: "tiny", Type: AtomSpaceAgent, Config: map[string]interface{}{"max_atoms": 2}})
+
+	behavior, err := NewBehavior(agent, dir)
+	if err != nil {
+		t.Fatalf("NewBehavior failed: %v", err)
+	}
+	if _, err := behavior.HandleMessage(&Message{Type: MessageTypeKnowledge, Payload: catIsAnimal()}); err == nil {
+		t.Fatal("Knowledge beyond max_atoms should be rejected")
+	}
+
+	store, _ := OpenAtomSpace(dir, agent)
+	store.Read(func(space *atomspace.AtomSpace) error {
+		if space.Size() != 0 {
+			t.Errorf("A rejected update should not be kept, got %d atoms", space.Size())
+		}
+		return nil
+	})
+}
+
+func TestAtomSpaceStoreSeesOtherWriters(t *testing.T) {
+	dir := t.TempDir()
+	agent, _ := NewAgent(AgentConfig{Name: "shared", Type: AtomSpaceAgent})
+
+	reader, _ := OpenAtomSpace(dir, agent)
+	writer, _ := OpenAtomSpace(dir, agent)
+
+	writer.Update(func(space *atomspace.AtomSpace) error {
+		_, err := space.AddNode(atomspace.ConceptNode, "cat")
+		return err
+	})
+
+	reader.Read(func(space *atomspace.AtomSpace) error {
+		if _, ok := space.Node(atomspace.ConceptNode, "cat"); !ok {
+			t.Error("Reader should see atoms saved by another store")
+		}
+		return nil
+	})
+}
+
+func TestAtomSpaceStoreKeepsConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+	agent, _ := NewAgent(AgentConfig{Name: "shared", Type: AtomSpaceAgent})
+
+	// The daemon and the CLI each open their own store of the file
+	path := AtomSpacePath(dir, agent)
+	stores := []*AtomSpaceStore{{path: path}, {path: path}}
+
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func(i int, store *AtomSpaceStore) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				err := store.Update(func(space *atomspace.AtomSpace) error {
+					_, err := space.AddNode(atomspace.ConceptNode, fmt.Sprintf("atom-%d-%d", i, j))
+					return err
+				})
+				if err != nil {
+					t.Errorf("Update failed: %v", err)
+				}
+			}
+		}(i, store)
+	}
+	wg.Wait()
+
+	stores[0].Read(func(space *atomspace.AtomSpace) error {
+		if space.Size() != 40 {
+			t.Errorf("Expected the atoms of both writers to be kept, got %d atoms", space.Size())
+		}
+		return nil
+	})
+}
+
+func TestRequest(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "kb", Type: AtomSpaceAgent})
+	registry.Register(agent)
+
+	behavior, _ := NewBehavior(agent, registry.Dir())
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.Host(agent.ID, behavior)
+	orchestrator.RegisterAgent("client")
+
+	reply, err := orchestrator.Request(&Message{From: "client", To: agent.ID, Type: MessageTypeKnowledge, Payload: catIsAnimal()}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if reply.Payload["size"] != 3 {
+		t.Errorf("Unexpected reply %+v", reply.Payload)
+	}
+
+	_, err = orchestrator.Request(&Message{From: "client", To: agent.ID, Type: MessageTypeCommand}, 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "do not handle") {
+		t.Errorf("Error replies should be returned as errors, got %v", err)
+	}
+
+	orchestrator.RegisterAgent("silent")
+	_, err = orchestrator.Request(&Message{From: "client", To: "silent", Type: MessageTypeQuery}, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "no reply") {
+		t.Errorf("Request should time out, got %v", err)
+	}
+}
+
+func TestAtomSpaceAgentAnswersQueries(t *testing.T) {
+	agent, _ := NewAgent(AgentConfig{Name: "kb", Type: AtomSpaceAgent})
+	behavior, _ := NewBehavior(agent, t.TempDir())
+	behavior.HandleMessage(&Message{Type: MessageTypeKnowledge, Payload: catIsAnimal()})
+
+	reply, err := behavior.HandleMessage(&Message{
+		Type:    MessageTypeQuery,
+		Payload: atomspace.QueryPayload(`(InheritanceLink (VariableNode "$x") (ConceptNode "animal"))`, 0),
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	result, err := atomspace.DecodeQueryResult(reply.Payload)
+	if err != nil {
+		t.Fatalf("DecodeQueryResult failed: %v", err)
+	}
+	if len(result.Groundings) != 1 || result.Groundings[0][0].Name != "cat" {
+		t.Errorf("Expected cat, got %+v", result.Groundings)
+	}
+
+	_, err = behavior.HandleMessage(&Message{Type: MessageTypeQuery, Payload: atomspace.QueryPayload("(ConceptNode", 0)})
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Invalid queries should report their position, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/github/hub/v2/opencog/routing"
+)
+
+func init() {
+	RegisterBehavior(BrokerAgent, newBrokerBehavior)
+}
+
+// RouteStats counts the messages a routing rule of a broker forwarded
+type RouteStats struct {
+	// Matched counts the messages the rule routed
+	Matched int64 `json:"matched"`
+	// Delivered counts the copies forwarded to agents
+	Delivered int64 `json:"delivered"`
+	// Replies counts the replies waited for in the first and gather modes
+	Replies int64 `json:"replies"`
+	// Failures counts the copies that could not be delivered, timed out or
+	// were answered with an error
+	Failures int64 `json:"failures"`
+	// ReplySeconds adds up how long replies took
+	ReplySeconds float64    `json:"reply_seconds,omitempty"`
+	LastMatched  *time.Time `json:"last_matched,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// MeanReply returns how long replies took on average
+func (s *RouteStats) MeanReply() time.Duration {
+	if s.Replies == 0 {
+		return 0
+	}
+	return time.Duration(s.ReplySeconds / float64(s.Replies) * float64(time.Second))
+}
+
+// brokerState is what a broker keeps between messages
+type brokerState struct {
+	Rules map[string]*RouteStats `json:"rules,omitempty"`
+	// Unrouted counts the messages no rule matched
+	Unrouted int64 `json:"unrouted,omitempty"`
+}
+
+func brokerStatePath(configDir string, agent *Agent) string {
+	return filepath.Join(configDir, "broker", agent.ID+".json")
+}
+
+func loadBrokerState(configDir string, agent *Agent) (*brokerState, error) {
+	state := &brokerState{Rules: make(map[string]*RouteStats)}
+	data, err := os.ReadFile(brokerStatePath(configDir, agent))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read routing statistics: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse routing statistics: %w", err)
+	}
+	if state.Rules == nil {
+		state.Rules = make(map[string]*RouteStats)
+	}
+	return state, nil
+}
+
+func (s *brokerState) save(configDir string, agent *Agent) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal routing statistics: %w", err)
+	}
+	path := brokerStatePath(configDir, agent)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create routing statistics directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write routing statistics: %w", err)
+	}
+	return nil
+}
+
+// RoutingStats returns the statistics of the rules of a broker, by rule
+// name, and the number of messages no rule matched
+func RoutingStats(configDir string, agent *Agent) (map[string]*RouteStats, int64, error) {
+	state, err := loadBrokerState(configDir, agent)
+	if err != nil {
+		return nil, 0, err
+	}
+	return state.Rules, state.Unrouted, nil
+}
+
+// ResetRoutingStats forgets the statistics of a broker
+func ResetRoutingStats(configDir string, agent *Agent) error {
+	if err := os.Remove(brokerStatePath(configDir, agent)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove routing statistics: %w", err)
+	}
+	return nil
+}
+
+// RoutingTable reads the rules named by the "rules" option of a broker.
+// Relative paths are resolved against configDir.
+func RoutingTable(configDir string, agent *Agent) (*routing.Table, error) {
+	path := agent.ConfigString("rules")
+	if path == "" {
+		return nil, fmt.Errorf("agent %s has no routing rules; set them with `hub agent config %s --set rules=<file>`", agent.Name, agent.Name)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	return routing.LoadTable(path)
+}
+
+// brokerBehavior implements the broker agent type: it forwards the messages
+// addressed to it along the first of its rules matching them
+type brokerBehavior struct {
+	agent     *Agent
+	configDir string
+	outbox    *Outbox
+}
+
+func newBrokerBehavior(agent *Agent, configDir string) (Behavior, error) {
+	return &brokerBehavior{agent: agent, configDir: configDir}, nil
+}
+
+func (b *brokerBehavior) SetOutbox(outbox *Outbox) {
+	b.outbox = outbox
+}
+
+func (b *brokerBehavior) HandleMessage(msg *Message) (*Message, error) {
+	// Replies to the copies fanned out come back to the broker
+	if msg.ReplyTo != "" {
+		return nil, nil
+	}
+	if b.outbox == nil {
+		return nil, fmt.Errorf("agent %s is not hosted", b.agent.Name)
+	}
+	table, err := RoutingTable(b.configDir, b.agent)
+	if err != nil {
+		return nil, err
+	}
+	registry := b.outbox.Registry()
+	state, err := loadBrokerState(b.configDir, b.agent)
+	if err != nil {
+		return nil, err
+	}
+
+	env := routing.Envelope{Type: string(msg.Type), From: msg.From, Payload: msg.Payload}
+	if sender, err := registry.Get(msg.From); err == nil {
+		env.From, env.Tags = sender.Name, sender.Tags
+	}
+	rule := table.Match(env)
+	if rule == nil {
+		state.Unrouted++
+		if err := state.save(b.configDir, b.agent); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no routing rule of %s matches the %s message from %s", b.agent.Name, msg.Type, env.From)
+	}
+
+	stats := state.Rules[rule.Name]
+	if stats == nil {
+		stats = &RouteStats{}
+		state.Rules[rule.Name] = stats
+	}
+	now := time.Now()
+	stats.Matched++
+	stats.LastMatched = &now
+
+	reply, routeErr := b.forward(registry, msg, rule, stats)
+	if routeErr != nil {
+		stats.LastError = routeErr.Error()
+	}
+	if err := state.save(b.configDir, b.agent); err != nil {
+		return nil, err
+	}
+	if routeErr != nil {
+		return nil, fmt.Errorf("rule %s: %w", rule.Name, routeErr)
+	}
+	return reply, nil
+}
+
+// routed is the outcome of forwarding a copy of a message to an agent
+type routed struct {
+	agent string
+	reply *Message
+	took  time.Duration
+	err   error
+}
+
+// forward sends copies of msg to the agents of rule, in its mode, and
+// returns the broker's reply to the sender
+func (b *brokerBehavior) forward(registry *Registry, msg *Message, rule *routing.Rule, stats *RouteStats) (*Message, error) {
+	targets := make(map[string]string, len(rule.To))
+	var names []string
+	for _, name := range rule.To {
+		to := GitHubID
+		if name != GitHubID {
+			target, err := registry.GetByName(name)
+			if err != nil {
+				stats.Failures++
+				stats.LastError = err.Error()
+				continue
+			}
+			// Messages are not sent back where they came from, so that
+			// brokers cannot bounce them between each other
+			if target.ID == b.agent.ID || target.ID == msg.From {
+				continue
+			}
+			to = target.ID
+		}
+		targets[name] = to
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no agents to forward to")
+	}
+
+	if rule.ForwardMode() == routing.FanOut {
+		var delivered []string
+		for _, name := range names {
+			if err := b.outbox.Send(b.copyOf(msg, targets[name])); err != nil {
+				stats.Failures++
+				stats.LastError = err.Error()
+				continue
+			}
+			stats.Delivered++
+			delivered = append(delivered, name)
+		}
+		if len(delivered) == 0 {
+			return nil, fmt.Errorf("no agent could be forwarded to: %s", stats.LastError)
+		}
+		return &Message{
+			Type:    MessageTypeResponse,
+			Payload: map[string]interface{}{"rule": rule.Name, "delivered": delivered},
+		}, nil
+	}
+
+	timeout := rule.ReplyTimeout(b.agent.ConfigDuration("timeout"))
+	results := make(chan routed, len(names))
+	for _, name := range names {
+		copied := b.copyOf(msg, targets[name])
+		go func(name string) {
+			start := time.Now()
+			reply, err := b.outbox.Request(copied, timeout)
+			results <- routed{agent: name, reply: reply, took: time.Since(start), err: err}
+		}(name)
+	}
+	stats.Delivered += int64(len(names))
+
+	replies := make(map[string]interface{})
+	failures := make(map[string]interface{})
+	for range names {
+		result := <-results
+		if result.err != nil {
+			stats.Failures++
+			stats.LastError = fmt.Sprintf("%s: %v", result.agent, result.err)
+			failures[result.agent] = result.err.Error()
+			continue
+		}
+		stats.Replies++
+		stats.ReplySeconds += result.took.Seconds()
+		if rule.ForwardMode() == routing.First {
+			// The others may still answer; their replies are dropped
+			return &Message{Type: result.reply.Type, Payload: result.reply.Payload}, nil
+		}
+		replies[result.agent] = result.reply.Payload
+	}
+
+	if len(replies) == 0 {
+		return nil, fmt.Errorf("no agent replied: %s", stats.LastError)
+	}
+	payload := map[string]interface{}{"rule": rule.Name, "replies": replies}
+	if len(failures) > 0 {
+		payload["errors"] = failures
+	}
+	return &Message{Type: MessageTypeResponse, Payload: payload}, nil
+}
+
+// copyOf returns a copy of msg to forward to the agent with the given ID,
+// on behalf of the agent that sent msg, or that msg was itself forwarded for
+func (b *brokerBehavior) copyOf(msg *Message, to string) *Message {
+	payload := make(map[string]interface{}, len(msg.Payload))
+	for key, value := range msg.Payload {
+		payload[key] = value
+	}
+	origin := msg.OnBehalfOf
+	if origin == "" {
+		origin = msg.From
+	}
+	return &Message{To: to, Type: msg.Type, Payload: payload, OnBehalfOf: origin}
+}
@@ -0,0 +1,218 @@
+package opencog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const brokerRules = `
+rules:
+  - name: alerts
+    types: [command]
+    tags: [monitor]
+    payload: {severity: high}
+    to: [pager, logger]
+  - name: ask
+    types: [query]
+    to: [slow, fast]
+    mode: first
+  - name: poll
+    payload: {action: poll}
+    to: [slow, fast, broken]
+    mode: gather
+    timeout: 2s
+`
+
+// replier answers messages with its name after a delay, or fails
+type replier struct {
+	name  string
+	delay time.Duration
+	fail  bool
+
+	mu       sync.Mutex
+	received []*Message
+}
+
+func (r *replier) HandleMessage(msg *Message) (*Message, error) {
+	r.mu.Lock()
+	r.received = append(r.received, msg)
+	r.mu.Unlock()
+	time.Sleep(r.delay)
+	if r.fail {
+		return nil, fmt.Errorf("%s is broken", r.name)
+	}
+	return &Message{Payload: map[string]interface{}{"from": r.name}}, nil
+}
+
+func (r *replier) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+func TestBrokerAgentRoutesMessages(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	orchestrator := NewOrchestrator(registry)
+	if err := os.WriteFile(filepath.Join(registry.Dir(), "routes.yaml"), []byte(brokerRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repliers := map[string]*replier{
+		"pager":  {name: "pager"},
+		"logger": {name: "logger"},
+		"slow":   {name: "slow", delay: 200 * time.Millisecond},
+		"fast":   {name: "fast"},
+		"broken": {name: "broken", fail: true},
+	}
+	for name, r := range repliers {
+		agent, _ := NewAgent(AgentConfig{Name: name, Type: CustomAgent})
+		registry.Register(agent)
+		orchestrator.Host(agent.ID, r)
+	}
+	broker, _ := NewAgent(AgentConfig{Name: "router", Type: BrokerAgent, Config: map[string]interface{}{"rules": "routes.yaml"}})
+	registry.Register(broker)
+	behavior, err := NewBehavior(broker, registry.Dir())
+	if err != nil {
+		t.Fatalf("NewBehavior failed: %v", err)
+	}
+	orchestrator.Host(broker.ID, behavior)
+
+	monitor, _ := NewAgent(AgentConfig{Name: "monitor", Type: CustomAgent, Tags: []string{"monitor"}})
+	registry.Register(monitor)
+	orchestrator.RegisterAgent(monitor.ID)
+	orchestrator.RegisterAgent("client")
+
+	request := func(from string, msgType MessageType, payload map[string]interface{}) (*Message, error) {
+		t.Helper()
+		return orchestrator.Request(&Message{From: from, To: broker.ID, Type: msgType, Payload: payload}, 5*time.Second)
+	}
+
+	// Fan-out
+	reply, err := request(monitor.ID, MessageTypeCommand, map[string]interface{}{"severity": "high"})
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	if delivered, _ := reply.Payload["delivered"].([]string); reply.Payload["rule"] != "alerts" || len(delivered) != 2 {
+		t.Errorf("Expected the alert to be fanned out to 2 agents, got %v", reply.Payload)
+	}
+	waitFor(t, func() bool { return repliers["pager"].count() == 1 && repliers["logger"].count() == 1 })
+	if copied := repliers["pager"].received[0]; copied.From != broker.ID || copied.Payload["severity"] != "high" {
+		t.Errorf("Expected a copy from the broker, got %+v", copied)
+	}
+	if _, err := request("client", MessageTypeCommand, map[string]interface{}{"severity": "high"}); err == nil || !strings.Contains(err.Error(), "no routing rule") {
+		t.Errorf("Expected senders without the monitor tag not to be routed, got %v", err)
+	}
+
+	// First responder
+	reply, err = request("client", MessageTypeQuery, map[string]interface{}{"q": "?"})
+	if err != nil || reply.Payload["from"] != "fast" {
+		t.Errorf("Expected the fast agent to answer first, got %+v, %v", reply, err)
+	}
+
+	// Scatter-gather
+	reply, err = request("client", MessageTypeCommand, map[string]interface{}{"action": "poll"})
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	replies, _ := reply.Payload["replies"].(map[string]interface{})
+	errors, _ := reply.Payload["errors"].(map[string]interface{})
+	if len(replies) != 2 || replies["slow"] == nil || len(errors) != 1 || !strings.Contains(fmt.Sprint(errors["broken"]), "broken") {
+		t.Errorf("Expected the replies of slow and fast and the error of broken, got %v", reply.Payload)
+	}
+
+	stats, unrouted, err := RoutingStats(registry.Dir(), broker)
+	if err != nil {
+		t.Fatalf("RoutingStats failed: %v", err)
+	}
+	if unrouted != 1 {
+		t.Errorf("Expected 1 unrouted message, got %d", unrouted)
+	}
+	if s := stats["alerts"]; s == nil || s.Matched != 1 || s.Delivered != 2 || s.Replies != 0 {
+		t.Errorf("Unexpected alerts statistics %+v", s)
+	}
+	if s := stats["ask"]; s == nil || s.Matched != 1 || s.Delivered != 2 || s.Replies != 1 {
+		t.Errorf("Unexpected ask statistics %+v", s)
+	}
+	if s := stats["poll"]; s == nil || s.Replies != 2 || s.Failures != 1 || s.MeanReply() <= 0 || !strings.Contains(s.LastError, "broken") {
+		t.Errorf("Unexpected poll statistics %+v", s)
+	}
+
+	ResetRoutingStats(registry.Dir(), broker)
+	if stats, _, _ := RoutingStats(registry.Dir(), broker); len(stats) != 0 {
+		t.Errorf("Expected the statistics to be forgotten, got %v", stats)
+	}
+}
+
+func TestBrokerForwardsToGitHubWithinTheSendersGrant(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	orchestrator := NewOrchestrator(registry)
+	rules := "rules:\n  - name: github\n    types: [command]\n    to: [github]\n    mode: first\n"
+	if err := os.WriteFile(filepath.Join(registry.Dir(), "routes.yaml"), []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeGitHub{}
+	orchestrator.HostGitHub(fake)
+
+	broker, _ := NewAgent(AgentConfig{Name: "router", Type: BrokerAgent, Config: map[string]interface{}{
+		"rules":               "routes.yaml",
+		"github_actions":      "comment",
+		"github_repositories": "github/*",
+	}})
+	registry.Register(broker)
+	behavior, _ := NewBehavior(broker, registry.Dir())
+	orchestrator.Host(broker.ID, behavior)
+
+	granted, _ := NewAgent(AgentConfig{Name: "granted", Type: CustomAgent, Config: map[string]interface{}{
+		"github_actions":      "comment",
+		"github_repositories": "github/hub",
+	}})
+	ungranted, _ := NewAgent(AgentConfig{Name: "ungranted", Type: CustomAgent})
+	for _, agent := range []*Agent{granted, ungranted} {
+		registry.Register(agent)
+		orchestrator.RegisterAgent(agent.ID)
+	}
+
+	comment := func(from *Agent, repository string) error {
+		payload := map[string]interface{}{"action": "comment", "repository": repository, "number": 1, "body": "Hi"}
+		_, err := orchestrator.Request(&Message{From: from.ID, To: broker.ID, Type: MessageTypeCommand, Payload: payload}, 5*time.Second)
+		return err
+	}
+
+	// The broker's grant does not extend to the agents it forwards for
+	if err := comment(ungranted, "github/hub"); err == nil || !strings.Contains(err.Error(), "not granted") {
+		t.Errorf("Expected an agent without a grant to be denied, got %v", err)
+	}
+	if err := comment(granted, "github/other"); err == nil || !strings.Contains(err.Error(), "not granted") {
+		t.Errorf("Expected a repository outside the sender's grant to be denied, got %v", err)
+	}
+	if err := comment(granted, "github/hub"); err != nil {
+		t.Errorf("Expected a comment within both grants to be taken, got %v", err)
+	}
+	if len(fake.calls) != 1 {
+		t.Errorf("Expected one call to GitHub, got %v", fake.calls)
+	}
+
+	events, _ := registry.Events(granted.ID, EventFilter{Kind: EventGitHub})
+	if len(events) != 2 || events[1].Actor != "router" || !strings.HasPrefix(events[1].Reason, "done") {
+		t.Errorf("Expected the actions to be recorded for the sender, taken by the broker, got %+v", events)
+	}
+	if events, _ := registry.Events(broker.ID, EventFilter{Kind: EventGitHub}); len(events) != 0 {
+		t.Errorf("Expected no actions of the broker's own, got %+v", events)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,94 @@
+//go:build linux
+// +build linux
+
+package opencog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot is where the cgroup v2 hierarchy is mounted
+var cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupParent groups the cgroups of all agents
+const cgroupParent = "hub.cog"
+
+// setupCgroup creates a cgroup v2 group for agent that enforces its memory
+// limit and returns its path. It returns an empty path when the agent has no
+// memory limit, and an error when cgroups are not available to this user.
+func setupCgroup(agent *Agent) (string, error) {
+	if agent.Limits == nil || agent.Limits.MemoryBytes == 0 {
+		return "", nil
+	}
+
+	controllers, err := os.ReadFile(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	if err != nil {
+		return "", fmt.Errorf("cgroup v2 is not available")
+	}
+	if !strings.Contains(" "+strings.TrimSpace(string(controllers))+" ", " memory ") {
+		return "", fmt.Errorf("cgroup memory controller is not available")
+	}
+
+	parent := filepath.Join(cgroupRoot, cgroupParent)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	for _, dir := range []string{cgroupRoot, parent} {
+		if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+memory"), 0644); err != nil {
+			return "", fmt.Errorf("failed to enable memory controller: %w", err)
+		}
+	}
+
+	// Start from a fresh group so that events from earlier runs, such as
+	// OOM kills, are not attributed to this one
+	path := filepath.Join(parent, agent.ID)
+	os.Remove(path)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	limit := strconv.FormatInt(agent.Limits.MemoryBytes, 10)
+	if err := os.WriteFile(filepath.Join(path, "memory.max"), []byte(limit), 0644); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to set memory limit: %w", err)
+	}
+	// Without this, the kernel would swap rather than enforce the limit
+	os.WriteFile(filepath.Join(path, "memory.swap.max"), []byte("0"), 0644)
+
+	return path, nil
+}
+
+// joinCgroup moves the process pid into the cgroup at path
+func joinCgroup(path string, pid int) error {
+	return os.WriteFile(filepath.Join(path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
+
+// removeCgroup removes an agent's cgroup once its processes have exited
+func removeCgroup(path string) {
+	if path != "" {
+		os.Remove(path)
+	}
+}
+
+// cgroupOOMKilled reports whether the kernel killed a process in the cgroup
+// for exceeding its memory limit
+func cgroupOOMKilled(path string) bool {
+	if path == "" {
+		return false
+	}
+	data, err := os.ReadFile(filepath.Join(path, "memory.events"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.Atoi(fields[1])
+			return n > 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package opencog
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCgroupRoot points cgroupRoot at a directory that looks like a cgroup
+// v2 hierarchy with the memory controller
+func fakeCgroupRoot(t *testing.T) string {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu memory\n"), 0644)
+	previous := cgroupRoot
+	cgroupRoot = root
+	t.Cleanup(func() { cgroupRoot = previous })
+	return root
+}
+
+func TestStartProcessJoinsCgroup(t *testing.T) {
+	root := fakeCgroupRoot(t)
+	dir := t.TempDir()
+	agent, _ := NewAgent(AgentConfig{Name: "bounded", Type: CustomAgent, Limits: &ResourceLimits{MemoryBytes: 64 << 20}})
+
+	pid, err := StartProcess(agent, []string{"sh", "-c", "echo ran"}, dir)
+	if err != nil {
+		t.Fatalf("StartProcess failed: %v", err)
+	}
+	if agent.Cgroup != filepath.Join(root, cgroupParent, agent.ID) {
+		t.Errorf("Unexpected cgroup %q", agent.Cgroup)
+	}
+	procs, _ := os.ReadFile(filepath.Join(agent.Cgroup, "cgroup.procs"))
+	if string(procs) != strconv.Itoa(pid) {
+		t.Errorf("Expected the process to be placed in the cgroup, got %q", procs)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var output []byte
+	for time.Now().Before(deadline) && len(output) == 0 {
+		output, _ = os.ReadFile(LogPath(dir, agent))
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(string(output), "ran") {
+		t.Errorf("Expected the command to run once in the cgroup, got %q", output)
+	}
+}
+
+func TestStartProcessFailsWhenCgroupCannotBeJoined(t *testing.T) {
+	root := fakeCgroupRoot(t)
+	dir := t.TempDir()
+	agent, _ := NewAgent(AgentConfig{Name: "bounded", Type: CustomAgent, Limits: &ResourceLimits{MemoryBytes: 64 << 20}})
+
+	// A directory in place of cgroup.procs cannot be written to
+	os.MkdirAll(filepath.Join(root, cgroupParent, agent.ID, "cgroup.procs"), 0755)
+
+	if _, err := StartProcess(agent, []string{"sh", "-c", "echo ran"}, dir); err == nil {
+		t.Fatal("StartProcess should fail when the process cannot join its cgroup")
+	}
+	if output, _ := os.ReadFile(LogPath(dir, agent)); strings.Contains(string(output), "ran") {
+		t.Errorf("The command should not have run outside its cgroup, got %q", output)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package opencog
+
+import "fmt"
+
+// setupCgroup reports that cgroups are only available on linux
+func setupCgroup(agent *Agent) (string, error) {
+	if agent.Limits == nil || agent.Limits.MemoryBytes == 0 {
+		return "", nil
+	}
+	return "", fmt.Errorf("cgroups are only available on linux")
+}
+
+// joinCgroup reports that cgroups are only available on linux
+func joinCgroup(path string, pid int) error {
+	return fmt.Errorf("cgroups are only available on linux")
+}
+
+// removeCgroup does nothing outside linux
+func removeCgroup(path string) {}
+
+// cgroupOOMKilled always reports false outside linux
+func cgroupOOMKilled(path string) bool {
+	return false
+}
@@ -0,0 +1,1005 @@
+package opencog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github/hub/v2/opencog/cluster"
+	"github.com/github/hub/v2/opencog/raft"
+)
+
+// EventPlacement records an agent being placed onto a node of a cluster, or
+// taken off one
+const EventPlacement EventKind = "placement"
+
+// EventConflict records a change made to an agent on this node that was
+// dropped, because another node changed the agent first
+const EventConflict EventKind = "conflict"
+
+// forwardTimeout bounds how long a node may take to accept a message
+// forwarded to it, or to commit a change to the registry
+const forwardTimeout = 5 * time.Second
+
+// senderTTL is how long a node remembers the node a sender on another node
+// is on, for replies to find their way back
+const senderTTL = 10 * time.Minute
+
+// placementOptions place agents of any type onto the nodes of a cluster
+var placementOptions = []ConfigOption{
+	{Key: "node_tags", Type: OptionString,
+		Description: "Comma-separated tags of the cluster nodes the agent may be placed on"},
+}
+
+// ClusterConfig says how an orchestrator takes part in a cluster
+type ClusterConfig struct {
+	// Node names the node, uniquely within the cluster
+	Node string
+	// Listen is the address the node accepts the calls of other nodes on,
+	// such as :7946. Advertise is the address other nodes call it on, the
+	// address it listens on unless set.
+	Listen    string
+	Advertise string
+	// Join is the address of a node of the cluster to join. The node
+	// starts a cluster of its own unless it is set.
+	Join string
+	// Tags describe the node to the agents placed by their node_tags
+	Tags []string
+	// Capacity bounds the number of agents placed on the node
+	Capacity int
+	// Secret authenticates the nodes to each other
+	Secret []byte
+	// NodeTimeout is how long a node may go without answering the leader
+	// before the leader places its agents elsewhere, 3 check intervals
+	// unless set
+	NodeTimeout time.Duration
+	// ElectionTimeout is how long nodes wait to hear from the leader before
+	// they elect another, 1s unless set
+	ElectionTimeout time.Duration
+
+	// intercept, when set, is consulted before every call to the node at
+	// addr and fails the call if it returns an error, for tests to cut
+	// nodes off
+	intercept func(addr string) error
+}
+
+// ClusterState is what a node knows of its cluster. Nodes write it to their
+// configuration directory, so that commands run on them can tell.
+type ClusterState struct {
+	// Node is the name of this node
+	Node string `json:"node"`
+	// Coordinator is the name of the node leading the cluster
+	Coordinator string         `json:"coordinator"`
+	Nodes       []cluster.Node `json:"nodes"`
+	// Synced is when the changes made to the registry on this node were
+	// last committed, and Error why they last failed to be
+	Synced time.Time `json:"synced"`
+	Error  string    `json:"error,omitempty"`
+	// Raft is the state of the replicated log of the registry on this node
+	Raft *raft.Status `json:"raft,omitempty"`
+}
+
+func clusterStatePath(configDir string) string {
+	return filepath.Join(configDir, "cluster.json")
+}
+
+// LoadClusterState returns what this host's node knows of its cluster, or
+// nil if the host does not run a node
+func LoadClusterState(configDir string) (*ClusterState, error) {
+	data, err := os.ReadFile(clusterStatePath(configDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cluster state: %w", err)
+	}
+	state := &ClusterState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster state: %w", err)
+	}
+	return state, nil
+}
+
+func (s *ClusterState) save(configDir string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cluster state: %w", err)
+	}
+	if err := os.WriteFile(clusterStatePath(configDir), data, 0644); err != nil {
+		return fmt.Errorf("failed to write cluster state: %w", err)
+	}
+	return nil
+}
+
+// LocalNode returns the name of the node this host runs, or "" if it runs
+// none
+func LocalNode(configDir string) string {
+	if state, err := LoadClusterState(configDir); err == nil && state != nil {
+		return state.Node
+	}
+	return ""
+}
+
+// CheckProcessHost returns an error if the process of agent runs on another
+// node of the cluster than this host, where it cannot be signaled
+func CheckProcessHost(configDir string, agent *Agent) error {
+	if agent.PID == 0 || agent.Node == "" {
+		return nil
+	}
+	if local := LocalNode(configDir); agent.Node != local {
+		return fmt.Errorf("the process of agent %s runs on node %s; manage it there", agent.Name, agent.Node)
+	}
+	return nil
+}
+
+// registryCommand is an entry of the replicated log: a change to the
+// registry or to the nodes of the cluster
+type registryCommand struct {
+	Op    string          `json:"op"`
+	ID    string          `json:"id,omitempty"`
+	Agent json.RawMessage `json:"agent,omitempty"`
+	// Base is the version of the agent the change was made to, "" for
+	// agents created by the change. Changes to versions other than the
+	// current one conflict with a change committed before them.
+	Base string        `json:"base,omitempty"`
+	Node *cluster.Node `json:"node,omitempty"`
+}
+
+const (
+	opPut    = "put"
+	opRemove = "remove"
+	opJoin   = "join"
+	opForget = "forget"
+)
+
+// proposeReply tells the node that proposed a change to an agent whether
+// the change conflicted with one committed first, and the agent as that
+// change left it
+type proposeReply struct {
+	Conflict bool            `json:"conflict,omitempty"`
+	Current  json.RawMessage `json:"current,omitempty"`
+}
+
+// registrySnapshot is the state the replicated log leads to
+type registrySnapshot struct {
+	Agents map[string]json.RawMessage `json:"agents"`
+	Nodes  []cluster.Node             `json:"nodes"`
+}
+
+// errConflict is returned for changes made to an agent that was changed on
+// another node first
+var errConflict = errors.New("changed on another node first")
+
+// deliverRequest carries a message forwarded from another node
+type deliverRequest struct {
+	Node    string   `json:"node"`
+	Message *Message `json:"message"`
+}
+
+// senderRoute is the node a sender that is not an agent is on
+type senderRoute struct {
+	node string
+	seen time.Time
+}
+
+// clusterNode is an orchestrator's part in a cluster. The registry and the
+// nodes of the cluster are replicated by a Raft log: the changes made to the
+// registry on any node are proposed to the leader at every check interval,
+// and every node applies them in the order the log commits them. Changes
+// made to an agent that another node changed first are dropped. The leader
+// places agents implemented in-process onto the nodes, each of which hosts
+// the agents placed on it, and messages to agents on other nodes are
+// forwarded to them.
+type clusterNode struct {
+	o      *Orchestrator
+	config ClusterConfig
+	server *cluster.Server
+	raft   *raft.Node
+	self   cluster.Node
+
+	mu sync.Mutex
+	// applied holds the agents as the log has them, by ID, and local the
+	// versions of the log the agents of the registry of this node were
+	// changed from, which lag behind while a change made on this node is
+	// not committed. nodes holds the nodes of the cluster.
+	applied map[string]json.RawMessage
+	local   map[string]json.RawMessage
+	nodes   map[string]cluster.Node
+	senders map[string]senderRoute
+	state   ClusterState
+	left    sync.Once
+}
+
+// JoinCluster makes the orchestrator a node of a cluster: it starts
+// accepting the calls of other nodes and joins the cluster of the node at
+// config.Join, or starts a cluster of its own. Nodes restarted with the
+// state they kept rejoin their cluster. It must be called before Start.
+func (o *Orchestrator) JoinCluster(config ClusterConfig) error {
+	if config.Node == "" {
+		return fmt.Errorf("cluster node has no name")
+	}
+	if config.Capacity <= 0 {
+		return fmt.Errorf("node capacity must be positive, got %d", config.Capacity)
+	}
+	if config.NodeTimeout <= 0 {
+		config.NodeTimeout = 3 * o.CheckInterval
+	}
+	if config.ElectionTimeout <= 0 {
+		config.ElectionTimeout = time.Second
+	}
+
+	c := &clusterNode{
+		o:       o,
+		config:  config,
+		applied: make(map[string]json.RawMessage),
+		local:   make(map[string]json.RawMessage),
+		nodes:   make(map[string]cluster.Node),
+		senders: make(map[string]senderRoute),
+	}
+	storage, err := raft.NewFileStorage(c.raftDir())
+	if err != nil {
+		return err
+	}
+	var bootstrap []string
+	if config.Join == "" {
+		bootstrap = []string{config.Node}
+	}
+	c.raft, err = raft.NewNode(raft.Config{
+		ID:           config.Node,
+		Members:      bootstrap,
+		Storage:      storage,
+		Transport:    c,
+		StateMachine: c,
+	})
+	if err != nil {
+		return err
+	}
+
+	server, err := cluster.Listen(config.Listen, config.Secret, c.handle)
+	if err != nil {
+		return fmt.Errorf("failed to listen for cluster nodes: %w", err)
+	}
+	c.server = server
+	c.self = cluster.Node{
+		Name:     config.Node,
+		Address:  config.Advertise,
+		Tags:     config.Tags,
+		Capacity: config.Capacity,
+	}
+	if c.self.Address == "" {
+		c.self.Address = server.Addr()
+	}
+	c.raft.Start(config.ElectionTimeout / 10)
+
+	if err := c.join(); err != nil {
+		c.raft.Stop()
+		server.Close()
+		if config.Join == "" {
+			return fmt.Errorf("failed to start the cluster: %w", err)
+		}
+		return fmt.Errorf("failed to join the cluster at %s: %w", config.Join, err)
+	}
+	o.cluster = c
+	c.saveState()
+	return nil
+}
+
+func (c *clusterNode) raftDir() string {
+	return filepath.Join(c.o.registry.Dir(), "raft")
+}
+
+// join asks the leader to add this node to the cluster, through the node at
+// config.Join, and waits for the node to learn that it was
+func (c *clusterNode) join() error {
+	deadline := time.Now().Add(10 * c.config.ElectionTimeout)
+	var err error
+	for time.Now().Before(deadline) {
+		if c.config.Join != "" {
+			err = c.call(c.config.Join, "join", c.self, nil)
+		} else {
+			err = c.toLeader("join", c.self, nil)
+		}
+		if err == nil || errors.Is(err, cluster.ErrUnauthorized) || strings.Contains(err.Error(), "is taken") {
+			break
+		}
+		// The cluster may be electing its leader
+		time.Sleep(c.config.ElectionTimeout / 10)
+	}
+	if err != nil {
+		return err
+	}
+
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		_, joined := c.nodes[c.self.Name]
+		c.mu.Unlock()
+		if joined {
+			return nil
+		}
+		time.Sleep(c.config.ElectionTimeout / 10)
+	}
+	return fmt.Errorf("node %s was not added in time", c.self.Name)
+}
+
+func (c *clusterNode) coordinates() bool {
+	return c.raft.Status().Role == raft.Leader
+}
+
+// tick places agents, on the leader, and proposes the changes made to the
+// registry on this node since the last tick. What the node knows of the
+// cluster is then written to the configuration directory.
+func (c *clusterNode) tick(now time.Time) {
+	if c.coordinates() {
+		c.place(now)
+	}
+	err := c.propose()
+
+	c.mu.Lock()
+	if err != nil {
+		c.state.Error = err.Error()
+	} else {
+		c.state.Synced = now
+		c.state.Error = ""
+	}
+	for id, route := range c.senders {
+		if now.Sub(route.seen) > senderTTL {
+			delete(c.senders, id)
+		}
+	}
+	c.mu.Unlock()
+	c.saveState()
+}
+
+// saveState writes what the node knows of the cluster to the configuration
+// directory
+func (c *clusterNode) saveState() {
+	status := c.raft.Status()
+	c.mu.Lock()
+	c.state.Node = c.self.Name
+	c.state.Coordinator = status.Leader
+	c.state.Nodes = c.nodeList()
+	c.state.Raft = &status
+	state := c.state
+	c.mu.Unlock()
+
+	contact := make(map[string]time.Time)
+	for _, peer := range status.Peers {
+		contact[peer.ID] = peer.LastContact
+	}
+	for i, node := range state.Nodes {
+		if node.Name == c.self.Name {
+			state.Nodes[i].LastSeen = time.Now()
+		} else {
+			state.Nodes[i].LastSeen = contact[node.Name]
+		}
+	}
+	state.save(c.o.registry.Dir())
+}
+
+// nodeList returns the nodes sorted by name. c.mu must be held.
+func (c *clusterNode) nodeList() []cluster.Node {
+	nodes := make([]cluster.Node, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes
+}
+
+// propose proposes the changes made to the registry on this node since they
+// were last applied. Changes to an agent that another node changed first
+// are made again on top of that change, unless both changed the same
+// fields, in which case the change of this node is undone. Changes that
+// cannot be committed, for want of a leader, are proposed again at the next
+// tick.
+func (c *clusterNode) propose() error {
+	type change struct {
+		cmd  registryCommand
+		base json.RawMessage
+	}
+	var changes []change
+	current := make(map[string]bool)
+	c.mu.Lock()
+	for _, agent := range c.o.registry.List() {
+		current[agent.ID] = true
+		data, err := json.Marshal(agent)
+		if err != nil {
+			continue
+		}
+		if base, ok := c.local[agent.ID]; !ok || string(base) != string(data) {
+			cmd := registryCommand{Op: opPut, ID: agent.ID, Agent: data, Base: version(base)}
+			changes = append(changes, change{cmd, base})
+		}
+	}
+	for id, base := range c.local {
+		if !current[id] {
+			changes = append(changes, change{registryCommand{Op: opRemove, ID: id, Base: version(base)}, base})
+		}
+	}
+	c.mu.Unlock()
+
+	var failed []string
+	for _, ch := range changes {
+		cmd, base := ch.cmd, ch.base
+		for attempt := 0; attempt < 3; attempt++ {
+			var reply proposeReply
+			if err := c.toLeader("propose", cmd, &reply); err != nil {
+				failed = append(failed, fmt.Sprintf("agent %s: %v", cmd.ID, err))
+				break
+			}
+			if !reply.Conflict {
+				c.committed(cmd, ch.cmd)
+				break
+			}
+			rebased, ok := rebase(cmd, base, reply.Current)
+			if !ok {
+				c.undo(cmd.ID, reply.Current)
+				break
+			}
+			if rebased == nil {
+				// Removed on another node too
+				c.committed(cmd, ch.cmd)
+				break
+			}
+			cmd, base = *rebased, reply.Current
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to commit changes to %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// committed records that a change made on this node was committed, as
+// proposed or rebased onto changes of other nodes
+func (c *clusterNode) committed(cmd, proposed registryCommand) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cmd.Op == opRemove {
+		delete(c.local, cmd.ID)
+		return
+	}
+	c.local[cmd.ID] = cmd.Agent
+	if string(cmd.Agent) == string(proposed.Agent) {
+		return
+	}
+	// The registry gets the changes of the other nodes, unless the agent was
+	// changed on this node again
+	if agent, err := c.o.registry.Get(cmd.ID); err == nil {
+		if data, _ := json.Marshal(agent); string(data) == string(proposed.Agent) {
+			rebased := &Agent{}
+			if json.Unmarshal(cmd.Agent, rebased) == nil {
+				c.o.registry.Put(rebased)
+			}
+		}
+	}
+}
+
+// rebase makes a change to an agent made to version base again on top of
+// version current, committed first. Removals always are; other changes are
+// unless they changed a field current changed too, or the agent was removed.
+// It returns nil if there is nothing left to change.
+func rebase(cmd registryCommand, base, current json.RawMessage) (*registryCommand, bool) {
+	if current == nil {
+		return nil, cmd.Op == opRemove
+	}
+	if cmd.Op == opRemove {
+		return &registryCommand{Op: opRemove, ID: cmd.ID, Base: version(current)}, true
+	}
+	if base == nil {
+		return nil, false
+	}
+
+	var was, mine, theirs map[string]json.RawMessage
+	if json.Unmarshal(base, &was) != nil || json.Unmarshal(cmd.Agent, &mine) != nil || json.Unmarshal(current, &theirs) != nil {
+		return nil, false
+	}
+	changed := make(map[string]bool)
+	for _, field := range changedFields(was, theirs) {
+		changed[field] = true
+	}
+	merged := theirs
+	for _, field := range changedFields(was, mine) {
+		// Every change sets updated_at; the latest one stands
+		if field != "updated_at" && changed[field] {
+			return nil, false
+		}
+		if value, ok := mine[field]; ok {
+			merged[field] = value
+		} else {
+			delete(merged, field)
+		}
+	}
+
+	// Agents are put as they marshal, for the registry to compare them
+	agent := &Agent{}
+	data, err := json.Marshal(merged)
+	if err == nil {
+		err = json.Unmarshal(data, agent)
+	}
+	if err == nil {
+		data, err = json.Marshal(agent)
+	}
+	if err != nil {
+		return nil, false
+	}
+	return &registryCommand{Op: opPut, ID: cmd.ID, Agent: data, Base: version(current)}, true
+}
+
+// changedFields returns the fields that differ between two versions of an
+// agent
+func changedFields(a, b map[string]json.RawMessage) []string {
+	var fields []string
+	for field, value := range b {
+		if string(a[field]) != string(value) {
+			fields = append(fields, field)
+		}
+	}
+	for field := range a {
+		if _, ok := b[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// undo puts the agent with the given ID back as it was committed, recording
+// that the change made to it on this node was dropped
+func (c *clusterNode) undo(id string, current json.RawMessage) {
+	c.o.registry.RecordEvent(Event{
+		AgentID: id,
+		Actor:   ActorOrchestrator,
+		Kind:    EventConflict,
+		Reason:  "the change was dropped: the agent was " + errConflict.Error(),
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if current == nil {
+		delete(c.local, id)
+		c.o.registry.Unregister(id)
+		return
+	}
+	agent := &Agent{}
+	if json.Unmarshal(current, agent) == nil {
+		c.local[id] = current
+		c.o.registry.Put(agent)
+	}
+}
+
+// version returns the version of an agent as the log has it, "" for none
+func version(data json.RawMessage) string {
+	if data == nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// Apply applies a committed change to the registry or to the nodes
+func (c *clusterNode) Apply(command []byte) error {
+	var cmd registryCommand
+	if err := json.Unmarshal(command, &cmd); err != nil {
+		return fmt.Errorf("invalid registry change: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch cmd.Op {
+	case opPut, opRemove:
+		if cmd.Base != version(c.applied[cmd.ID]) {
+			return errConflict
+		}
+		agent := &Agent{}
+		if cmd.Op == opPut {
+			if err := json.Unmarshal(cmd.Agent, agent); err != nil {
+				return fmt.Errorf("invalid agent: %w", err)
+			}
+		}
+		// A change made on this node and not proposed yet is left in the
+		// registry, to conflict with this one when it is
+		if cmd.Op == opRemove {
+			delete(c.applied, cmd.ID)
+		} else {
+			c.applied[cmd.ID], _ = json.Marshal(agent)
+		}
+		switch {
+		case c.changedLocally(cmd.ID):
+		case cmd.Op == opRemove:
+			delete(c.local, cmd.ID)
+			c.o.registry.Unregister(cmd.ID)
+		default:
+			c.local[cmd.ID] = c.applied[cmd.ID]
+			return c.o.registry.Put(agent)
+		}
+	case opJoin:
+		if cmd.Node != nil {
+			c.nodes[cmd.Node.Name] = *cmd.Node
+		}
+	case opForget:
+		delete(c.nodes, cmd.ID)
+	}
+	return nil
+}
+
+// changedLocally tells whether the agent with the given ID was changed on
+// this node since the log last changed it. c.mu must be held.
+func (c *clusterNode) changedLocally(id string) bool {
+	base, ok := c.local[id]
+	agent, err := c.o.registry.Get(id)
+	if err != nil {
+		return ok
+	}
+	data, _ := json.Marshal(agent)
+	return !ok || string(data) != string(base)
+}
+
+// Snapshot returns the registry and the nodes as the log has them
+func (c *clusterNode) Snapshot() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Marshal(registrySnapshot{Agents: c.applied, Nodes: c.nodeList()})
+}
+
+// Restore replaces the registry and the nodes with a snapshot
+func (c *clusterNode) Restore(data []byte) error {
+	var snapshot registrySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("invalid registry snapshot: %w", err)
+	}
+	agents := make([]*Agent, 0, len(snapshot.Agents))
+	for _, data := range snapshot.Agents {
+		agent := &Agent{}
+		if err := json.Unmarshal(data, agent); err != nil {
+			return fmt.Errorf("invalid agent: %w", err)
+		}
+		agents = append(agents, agent)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.o.registry.Replace(agents); err != nil {
+		return err
+	}
+	c.applied = make(map[string]json.RawMessage, len(snapshot.Agents))
+	c.local = make(map[string]json.RawMessage, len(snapshot.Agents))
+	for id, data := range snapshot.Agents {
+		c.applied[id] = data
+		c.local[id] = data
+	}
+	c.nodes = make(map[string]cluster.Node, len(snapshot.Nodes))
+	for _, node := range snapshot.Nodes {
+		c.nodes[node.Name] = node
+	}
+	return nil
+}
+
+// Call carries a request of the Raft log to another node
+func (c *clusterNode) Call(peer, kind string, req, reply interface{}) error {
+	c.mu.Lock()
+	node, ok := c.nodes[peer]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown node %s", peer)
+	}
+	return c.call(node.Address, "raft."+kind, req, reply)
+}
+
+// call makes a call to the node at addr
+func (c *clusterNode) call(addr, kind string, req, reply interface{}) error {
+	if c.config.intercept != nil {
+		if err := c.config.intercept(addr); err != nil {
+			return err
+		}
+	}
+	return cluster.Call(addr, c.config.Secret, kind, req, reply, forwardTimeout)
+}
+
+// toLeader makes a call to the leader of the cluster, answering it here if
+// this node leads
+func (c *clusterNode) toLeader(kind string, req, reply interface{}) error {
+	status := c.raft.Status()
+	if status.Role == raft.Leader {
+		body, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		resp, err := c.lead(kind, body)
+		if err != nil || reply == nil {
+			return err
+		}
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, reply)
+	}
+
+	c.mu.Lock()
+	leader, ok := c.nodes[status.Leader]
+	c.mu.Unlock()
+	if !ok {
+		return &raft.NotLeaderError{Leader: status.Leader}
+	}
+	// The leader answers the call itself rather than passing it on, should
+	// it have stepped down
+	return c.call(leader.Address, "leader."+kind, req, reply)
+}
+
+// handle answers the calls of other nodes
+func (c *clusterNode) handle(kind string, body json.RawMessage) (interface{}, error) {
+	if strings.HasPrefix(kind, "raft.") {
+		return c.raft.Handle(strings.TrimPrefix(kind, "raft."), body)
+	}
+	if strings.HasPrefix(kind, "leader.") {
+		if status := c.raft.Status(); status.Role != raft.Leader {
+			return nil, &raft.NotLeaderError{Leader: status.Leader}
+		}
+		return c.lead(strings.TrimPrefix(kind, "leader."), body)
+	}
+
+	switch kind {
+	case "join", "propose", "leave":
+		var resp interface{}
+		err := c.toLeader(kind, body, &resp)
+		return resp, err
+	case "deliver":
+		var req deliverRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		if req.Message == nil {
+			return nil, fmt.Errorf("no message to deliver")
+		}
+		return nil, c.handleDeliver(&req)
+	}
+	return nil, fmt.Errorf("unknown cluster call %q", kind)
+}
+
+// lead answers, on the leader, the calls that change the cluster
+func (c *clusterNode) lead(kind string, body json.RawMessage) (interface{}, error) {
+	switch kind {
+	case "join":
+		var node cluster.Node
+		if err := json.Unmarshal(body, &node); err != nil {
+			return nil, err
+		}
+		return nil, c.admit(node)
+	case "propose":
+		var cmd registryCommand
+		if err := json.Unmarshal(body, &cmd); err != nil {
+			return nil, err
+		}
+		if cmd.Op != opPut && cmd.Op != opRemove {
+			return nil, fmt.Errorf("unknown registry change %q", cmd.Op)
+		}
+		err := c.raft.Propose(body, forwardTimeout)
+		if err != errConflict {
+			return proposeReply{}, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return proposeReply{Conflict: true, Current: c.applied[cmd.ID]}, nil
+	case "leave":
+		var node cluster.Node
+		if err := json.Unmarshal(body, &node); err != nil {
+			return nil, err
+		}
+		// The last node of a cluster has no one to leave
+		if members := c.raft.Status().Members; len(members) == 1 && members[0] == node.Name {
+			return nil, nil
+		}
+		if err := c.commit(registryCommand{Op: opForget, ID: node.Name}); err != nil {
+			return nil, err
+		}
+		return nil, c.raft.RemoveMember(node.Name, forwardTimeout)
+	}
+	return nil, fmt.Errorf("unknown cluster call %q", kind)
+}
+
+// admit adds a node to the cluster, unless another node that is still
+// around has the same name
+func (c *clusterNode) admit(node cluster.Node) error {
+	if node.Name == "" {
+		return fmt.Errorf("cluster node has no name")
+	}
+	c.mu.Lock()
+	known, ok := c.nodes[node.Name]
+	c.mu.Unlock()
+	if ok && known.Address != node.Address && (node.Name == c.self.Name || c.alive(time.Now())[node.Name]) {
+		return fmt.Errorf("node name %q is taken by the node at %s", node.Name, known.Address)
+	}
+
+	node.LastSeen = time.Time{}
+	if err := c.commit(registryCommand{Op: opJoin, Node: &node}); err != nil {
+		return err
+	}
+	err := c.raft.AddMember(node.Name, forwardTimeout)
+	if err == raft.ErrMembershipChange {
+		// Another node is joining; the joining node retries
+		return fmt.Errorf("another node is joining the cluster")
+	}
+	return err
+}
+
+// commit appends a change to the log and waits for it to be applied
+func (c *clusterNode) commit(cmd registryCommand) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	return c.raft.Propose(data, forwardTimeout)
+}
+
+// alive returns the nodes that answered the leader within NodeTimeout,
+// with this one
+func (c *clusterNode) alive(now time.Time) map[string]bool {
+	alive := map[string]bool{c.self.Name: true}
+	for _, peer := range c.raft.Status().Peers {
+		if now.Sub(peer.LastContact) <= c.config.NodeTimeout {
+			alive[peer.ID] = true
+		}
+	}
+	return alive
+}
+
+// place places the running agents implemented in-process that are on no
+// node, or on a node that does not answer, onto the node that suits them
+// best
+func (c *clusterNode) place(now time.Time) {
+	alive := c.alive(now)
+	c.mu.Lock()
+	var nodes []cluster.Node
+	for _, node := range c.nodeList() {
+		if alive[node.Name] {
+			nodes = append(nodes, node)
+		}
+	}
+	c.mu.Unlock()
+
+	agents := agentsByName(c.o.registry)
+	load := make(map[string]int)
+	for _, agent := range agents {
+		if alive[agent.Node] {
+			load[agent.Node]++
+		}
+	}
+
+	for _, agent := range agents {
+		if alive[agent.Node] || agent.PID != 0 || !HasBehavior(agent.Type) ||
+			(agent.Status != StatusRunning && agent.Status != StatusPaused) {
+			continue
+		}
+		tags := splitList(agent.ConfigString("node_tags"))
+		name, ok := cluster.Place(nodes, tags, load)
+		reason := ""
+		switch {
+		case ok && agent.Node != "":
+			reason = fmt.Sprintf("node %s is gone", agent.Node)
+		case ok:
+			reason = "placed"
+		case agent.Node != "":
+			reason = fmt.Sprintf("node %s is gone and no node has room", agent.Node)
+			if len(tags) > 0 {
+				reason = fmt.Sprintf("node %s is gone and no node tagged %s has room", agent.Node, strings.Join(tags, ", "))
+			}
+		default:
+			// Agents no node has room for wait for one
+			continue
+		}
+
+		c.o.registry.RecordEvent(Event{
+			AgentID: agent.ID,
+			Actor:   ActorOrchestrator,
+			Kind:    EventPlacement,
+			From:    agent.Node,
+			To:      name,
+			Reason:  reason,
+		})
+		agent.Node = name
+		agent.UpdatedAt = time.Now()
+		c.o.registry.Update(agent)
+		if ok {
+			load[name]++
+		}
+	}
+}
+
+// handleDeliver delivers a message forwarded from another node to an agent
+// on this one, and remembers where its sender is for the replies
+func (c *clusterNode) handleDeliver(req *deliverRequest) error {
+	msg := req.Message
+	if _, err := c.o.GetAgentChannel(msg.To); err != nil {
+		return fmt.Errorf("agent %s is not on node %s", msg.To, c.self.Name)
+	}
+	if _, err := c.o.registry.Get(msg.From); err != nil && msg.From != "" {
+		c.mu.Lock()
+		c.senders[msg.From] = senderRoute{node: req.Node, seen: time.Now()}
+		c.mu.Unlock()
+	}
+	return c.o.sendLocal(msg)
+}
+
+// nodeOf returns the node the agent with the given ID is on, if that is
+// another node than this one
+func (c *clusterNode) nodeOf(agentID string) (cluster.Node, bool) {
+	if _, err := c.o.GetAgentChannel(agentID); err == nil {
+		return cluster.Node{}, false
+	}
+
+	name := ""
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if route, ok := c.senders[agentID]; ok {
+		name = route.node
+	} else if agent, err := c.o.registry.Get(agentID); err == nil {
+		name = agent.Node
+	}
+	node, ok := c.nodes[name]
+	if !ok || name == c.self.Name {
+		return cluster.Node{}, false
+	}
+	return node, true
+}
+
+// forward sends msg to the node the agent it is addressed to is on
+func (c *clusterNode) forward(node cluster.Node, msg *Message) error {
+	msg.Timestamp = time.Now()
+	if msg.ID == "" {
+		msg.ID = generateMessageID()
+	}
+	c.o.mu.Lock()
+	c.o.countMessage(msg)
+	c.o.mu.Unlock()
+
+	req := deliverRequest{Node: c.self.Name, Message: msg}
+	if err := c.call(node.Address, "deliver", req, nil); err != nil {
+		return fmt.Errorf("failed to forward message to node %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// leave asks the leader to remove the node from the cluster, so that its
+// agents are placed elsewhere right away, and stops taking part in the
+// cluster. The node forgets its log, and joins anew when started again.
+func (c *clusterNode) leave() {
+	c.left.Do(func() {
+		c.toLeader("leave", c.self, nil)
+		c.raft.Stop()
+		c.server.Close()
+		os.RemoveAll(c.raftDir())
+		os.Remove(clusterStatePath(c.o.registry.Dir()))
+	})
+}
+
+// supervises tells whether the agent is looked after by this node: agents
+// placed on it, and on the leader, processes started on no node
+func (c *clusterNode) supervises(agent *Agent) bool {
+	if agent.Node != "" {
+		return agent.Node == c.self.Name
+	}
+	// Agents implemented in-process wait to be placed
+	return agent.PID != 0 && c.coordinates()
+}
+
+// supervises tells whether the orchestrator looks after the agent: hosts
+// it, checks its health and enforces its limits
+func (o *Orchestrator) supervises(agent *Agent) bool {
+	return o.cluster == nil || o.cluster.supervises(agent)
+}
+
+// ClusterAddress returns the address other nodes call this one on, or ""
+// if the orchestrator is not part of a cluster
+func (o *Orchestrator) ClusterAddress() string {
+	if o.cluster == nil {
+		return ""
+	}
+	return o.cluster.self.Address
+}
@@ -0,0 +1,128 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func echoServer(t *testing.T, secret string) *Server {
+	t.Helper()
+	server, err := Listen("127.0.0.1:0", []byte(secret), func(kind string, body json.RawMessage) (interface{}, error) {
+		if kind != "echo" {
+			return nil, fmt.Errorf("unknown call %q", kind)
+		}
+		var text string
+		if err := json.Unmarshal(body, &text); err != nil {
+			return nil, err
+		}
+		return strings.ToUpper(text), nil
+	})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestCall(t *testing.T) {
+	server := echoServer(t, "s3cret")
+
+	var reply string
+	if err := Call(server.Addr(), []byte("s3cret"), "echo", "hello", &reply, time.Second); err != nil || reply != "HELLO" {
+		t.Fatalf("Expected the call to be answered, got %q, %v", reply, err)
+	}
+	if err := Call(server.Addr(), []byte("s3cret"), "shout", "hello", nil, time.Second); err == nil || !strings.Contains(err.Error(), "unknown call") {
+		t.Errorf("Expected the handler's error, got %v", err)
+	}
+	if err := Call(server.Addr(), []byte("guess"), "echo", "hello", &reply, time.Second); err != ErrUnauthorized {
+		t.Errorf("Expected a client without the secret to be refused, got %v", err)
+	}
+	if _, err := Listen("127.0.0.1:0", nil, nil); err == nil {
+		t.Error("Expected servers without a secret to be refused")
+	}
+}
+
+func TestCallRefusesImpostors(t *testing.T) {
+	// A server that does not hold the secret cannot prove that it does
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n, _ := nonce()
+		writeFrame(conn, hello{Protocol: protocol, Nonce: n})
+		var a answer
+		readFrame(conn, &a)
+		writeFrame(conn, proof{Proof: mac([]byte("guess"), "server", n, a.Nonce)})
+	}()
+	if err := Call(listener.Addr().String(), []byte("s3cret"), "echo", "hello", nil, time.Second); err != ErrUnauthorized {
+		t.Errorf("Expected the impostor to be refused, got %v", err)
+	}
+}
+
+func TestSessionRefusesTamperedFrames(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		s, err := accept(server, []byte("s3cret"))
+		if err != nil {
+			done <- err
+			return
+		}
+		var req request
+		done <- s.read(&req)
+	}()
+
+	s, err := connect(client, []byte("s3cret"))
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	data, _ := json.Marshal(request{Kind: "echo"})
+	frame := append(s.sign(s.sent, data), data...)
+	frame[len(frame)-2] ^= 1
+	go writeRaw(client, frame)
+	if err := <-done; err != ErrUnauthorized {
+		t.Errorf("Expected a tampered frame to be refused, got %v", err)
+	}
+}
+
+func TestPlace(t *testing.T) {
+	nodes := []Node{
+		{Name: "a", Capacity: 2, Tags: []string{"gpu"}},
+		{Name: "b", Capacity: 4},
+		{Name: "c", Capacity: 4, Tags: []string{"gpu", "eu"}},
+	}
+	cases := []struct {
+		tags []string
+		load map[string]int
+		want string
+	}{
+		{nil, nil, "b"},
+		{nil, map[string]int{"b": 1}, "c"},
+		{[]string{"gpu"}, map[string]int{"a": 1, "c": 1}, "c"},
+		{[]string{"gpu"}, map[string]int{"c": 2}, "a"},
+		{[]string{"gpu"}, map[string]int{"a": 1, "c": 3}, "a"},
+		{[]string{"gpu", "eu"}, nil, "c"},
+		{[]string{"gpu", "eu"}, map[string]int{"c": 4}, ""},
+		{[]string{"tpu"}, nil, ""},
+	}
+	for _, c := range cases {
+		got, ok := Place(nodes, c.tags, c.load)
+		if got != c.want || ok != (c.want != "") {
+			t.Errorf("Place(%v, %v) = %q, %v, expected %q", c.tags, c.load, got, ok, c.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"sort"
+	"time"
+)
+
+// Node is a host of a cluster, running an orchestrator
+type Node struct {
+	Name string `json:"name"`
+	// Address is where other nodes call the node, such as 10.0.0.2:7946
+	Address string   `json:"address"`
+	Tags    []string `json:"tags,omitempty"`
+	// Capacity bounds the number of agents placed on the node
+	Capacity int `json:"capacity"`
+	// LastSeen is when the node was last heard from
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// HasTags tells whether the node has all of tags
+func (n *Node) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range n.Tags {
+			found = found || t == tag
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Place chooses the node for an agent that needs nodes with all of tags.
+// load holds the number of agents placed on each node. Of the nodes with the
+// tags and room to spare, the least loaded for its capacity is chosen; ties
+// go to the node with the larger capacity, then to the first by name. It
+// returns false if no node fits.
+func Place(nodes []Node, tags []string, load map[string]int) (string, bool) {
+	var fits []Node
+	for _, node := range nodes {
+		if node.HasTags(tags) && load[node.Name] < node.Capacity {
+			fits = append(fits, node)
+		}
+	}
+	if len(fits) == 0 {
+		return "", false
+	}
+
+	sort.Slice(fits, func(i, j int) bool {
+		a, b := fits[i], fits[j]
+		// Compare load[a]/capacity[a] with load[b]/capacity[b] exactly
+		if la, lb := load[a.Name]*b.Capacity, load[b.Name]*a.Capacity; la != lb {
+			return la < lb
+		}
+		if a.Capacity != b.Capacity {
+			return a.Capacity > b.Capacity
+		}
+		return a.Name < b.Name
+	})
+	return fits[0].Name, true
+}
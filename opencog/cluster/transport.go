@@ -0,0 +1,359 @@
+// Package cluster connects the orchestrators of several hosts. Nodes call
+// each other over TCP, one call per connection. Every connection is
+// authenticated with a secret the nodes share: each side proves that it
+// holds the secret by answering a challenge of the other, and every frame
+// after that carries a MAC keyed by both challenges, so that frames can be
+// neither forged nor replayed on another connection. Frames are not
+// encrypted. The package also places agents onto nodes by their tags and
+// capacity.
+package cluster
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// protocol identifies the version of the protocol nodes speak
+const protocol = "hub-cluster/1"
+
+// maxFrame bounds the size of a frame, and maxHandshakeFrame the size of
+// the frames sent before the other side is authenticated
+const (
+	maxFrame          = 16 << 20
+	maxHandshakeFrame = 4 << 10
+)
+
+// handshakeTimeout bounds how long a connection may take to authenticate
+// and send its call
+const handshakeTimeout = 10 * time.Second
+
+// ErrUnauthorized is returned when the other side of a connection does not
+// hold the secret
+var ErrUnauthorized = errors.New("cluster authentication failed")
+
+// Handler answers the calls of other nodes. kind says what is asked and
+// body holds the JSON request; the reply is sent back as JSON.
+type Handler func(kind string, body json.RawMessage) (interface{}, error)
+
+// Server accepts the calls of other nodes
+type Server struct {
+	listener net.Listener
+	secret   []byte
+	handler  Handler
+	// Timeout bounds how long a call may be handled
+	Timeout time.Duration
+
+	wg     sync.WaitGroup
+	closed chan struct{}
+}
+
+// Listen accepts calls on addr, such as 127.0.0.1:0, from nodes holding
+// secret, and answers them with handler
+func Listen(addr string, secret []byte, handler Handler) (*Server, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("no cluster secret")
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener: listener,
+		secret:   secret,
+		handler:  handler,
+		Timeout:  30 * time.Second,
+		closed:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops accepting calls and waits for the calls being handled
+func (s *Server) Close() error {
+	close(s.closed)
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.closed:
+				return
+			default:
+			}
+			// Temporary failures, such as running out of descriptors
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+// request and response are the frames of a call
+type request struct {
+	Kind string          `json:"kind"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+type response struct {
+	Body  json.RawMessage `json:"body,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+func (s *Server) handle(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	session, err := accept(conn, s.secret)
+	if err != nil {
+		return
+	}
+	var req request
+	if err := session.read(&req); err != nil {
+		return
+	}
+
+	conn.SetDeadline(time.Now().Add(s.Timeout))
+	var resp response
+	reply, err := s.handler(req.Kind, req.Body)
+	if err == nil {
+		resp.Body, err = json.Marshal(reply)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	session.write(resp)
+}
+
+// Call makes a call of the given kind to the node at addr, which must hold
+// secret, and decodes its reply into reply unless it is nil. Errors the
+// node answered with are returned as errors.
+func Call(addr string, secret []byte, kind string, req, reply interface{}, timeout time.Duration) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s call: %w", kind, err)
+	}
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	session, err := connect(conn, secret)
+	if err != nil {
+		return err
+	}
+	if err := session.write(request{Kind: kind, Body: body}); err != nil {
+		return err
+	}
+	var resp response
+	if err := session.read(&resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	if reply == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Body, reply); err != nil {
+		return fmt.Errorf("invalid reply to %s call: %w", kind, err)
+	}
+	return nil
+}
+
+// hello is the challenge of the server; answer is the proof of the client,
+// along with its own challenge; proof is the proof of the server
+type hello struct {
+	Protocol string `json:"protocol"`
+	Nonce    []byte `json:"nonce"`
+}
+
+type answer struct {
+	Nonce []byte `json:"nonce"`
+	Proof []byte `json:"proof"`
+}
+
+type proof struct {
+	Proof []byte `json:"proof"`
+}
+
+// session sends and receives the frames of an authenticated connection
+type session struct {
+	conn net.Conn
+	key  []byte
+	// sent and received number the frames, so that they cannot be
+	// reordered or replayed; client frames are even and server frames odd
+	sent, received uint64
+}
+
+func accept(conn net.Conn, secret []byte) (*session, error) {
+	serverNonce, err := nonce()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFrame(conn, hello{Protocol: protocol, Nonce: serverNonce}); err != nil {
+		return nil, err
+	}
+	var a answer
+	if err := readFrame(conn, &a); err != nil {
+		return nil, err
+	}
+	if len(a.Nonce) != len(serverNonce) || !hmac.Equal(a.Proof, mac(secret, "client", serverNonce, a.Nonce)) {
+		return nil, ErrUnauthorized
+	}
+	if err := writeFrame(conn, proof{Proof: mac(secret, "server", serverNonce, a.Nonce)}); err != nil {
+		return nil, err
+	}
+	return &session{conn: conn, key: mac(secret, "session", serverNonce, a.Nonce), sent: 1, received: 0}, nil
+}
+
+func connect(conn net.Conn, secret []byte) (*session, error) {
+	var h hello
+	if err := readFrame(conn, &h); err != nil {
+		return nil, err
+	}
+	if h.Protocol != protocol {
+		return nil, fmt.Errorf("node speaks %q, expected %s", h.Protocol, protocol)
+	}
+	clientNonce, err := nonce()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFrame(conn, answer{Nonce: clientNonce, Proof: mac(secret, "client", h.Nonce, clientNonce)}); err != nil {
+		return nil, err
+	}
+	var p proof
+	if err := readFrame(conn, &p); err != nil {
+		// Servers hang up on clients that do not hold the secret
+		if errors.Is(err, io.EOF) {
+			return nil, ErrUnauthorized
+		}
+		return nil, err
+	}
+	if !hmac.Equal(p.Proof, mac(secret, "server", h.Nonce, clientNonce)) {
+		return nil, ErrUnauthorized
+	}
+	return &session{conn: conn, key: mac(secret, "session", h.Nonce, clientNonce), sent: 0, received: 1}, nil
+}
+
+func (s *session) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	frame := append(s.sign(s.sent, data), data...)
+	s.sent += 2
+	return writeRaw(s.conn, frame)
+}
+
+func (s *session) read(v interface{}) error {
+	frame, err := readRaw(s.conn, maxFrame)
+	if err != nil {
+		return err
+	}
+	if len(frame) < sha256.Size {
+		return ErrUnauthorized
+	}
+	sum, data := frame[:sha256.Size], frame[sha256.Size:]
+	if !hmac.Equal(sum, s.sign(s.received, data)) {
+		return ErrUnauthorized
+	}
+	s.received += 2
+	return json.Unmarshal(data, v)
+}
+
+// sign returns the MAC of the frame with the given number
+func (s *session) sign(n uint64, data []byte) []byte {
+	h := hmac.New(sha256.New, s.key)
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], n)
+	h.Write(seq[:])
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func mac(secret []byte, label string, nonces ...[]byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(protocol + " " + label))
+	for _, n := range nonces {
+		h.Write(n)
+	}
+	return h.Sum(nil)
+}
+
+func nonce() ([]byte, error) {
+	n := make([]byte, 32)
+	if _, err := rand.Read(n); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	return n, nil
+}
+
+func writeFrame(conn net.Conn, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeRaw(conn, data)
+}
+
+func readFrame(conn net.Conn, v interface{}) error {
+	data, err := readRaw(conn, maxHandshakeFrame)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeRaw(conn net.Conn, data []byte) error {
+	if len(data) > maxFrame {
+		return fmt.Errorf("frame of %d bytes is too large", len(data))
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+	if _, err := conn.Write(append(size[:], data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func readRaw(conn net.Conn, limit uint32) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > limit {
+		return nil, fmt.Errorf("frame of %d bytes is too large", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,367 @@
+package opencog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/github/hub/v2/opencog/raft"
+)
+
+var clusterSecret = []byte("s3cret")
+
+// clusterNet cuts the nodes of a test cluster off from each other
+type clusterNet struct {
+	mu    sync.Mutex
+	addrs map[string]string
+	cut   map[string]bool
+}
+
+// intercept fails the calls node from makes to the nodes it is cut off from
+func (net *clusterNet) intercept(from string) func(addr string) error {
+	return func(addr string) error {
+		net.mu.Lock()
+		defer net.mu.Unlock()
+		for name, a := range net.addrs {
+			if a == addr && (net.cut[from] || net.cut[name]) && name != from {
+				return fmt.Errorf("%s cannot reach %s", from, name)
+			}
+		}
+		return nil
+	}
+}
+
+// isolate cuts the given nodes off from every other node, and from each
+// other; heal reconnects them
+func (net *clusterNet) isolate(names ...string) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	for _, name := range names {
+		net.cut[name] = true
+	}
+}
+
+func (net *clusterNet) heal() {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.cut = make(map[string]bool)
+}
+
+// clusterSetup runs a node per config on loopback, each with a registry of
+// its own, the first starting the cluster and the others joining it
+func clusterSetup(t *testing.T, configs ...ClusterConfig) ([]*Orchestrator, *clusterNet) {
+	t.Helper()
+	net := &clusterNet{addrs: make(map[string]string), cut: make(map[string]bool)}
+	var nodes []*Orchestrator
+	for i, config := range configs {
+		registry, _ := NewRegistry(t.TempDir())
+		o := NewOrchestrator(registry)
+		config.Listen = "127.0.0.1:0"
+		config.Secret = clusterSecret
+		config.ElectionTimeout = 100 * time.Millisecond
+		config.NodeTimeout = 300 * time.Millisecond
+		config.intercept = net.intercept(config.Node)
+		if i > 0 {
+			config.Join = nodes[0].ClusterAddress()
+		}
+		if err := o.JoinCluster(config); err != nil {
+			t.Fatalf("Node %s failed to join: %v", config.Node, err)
+		}
+		t.Cleanup(func() { o.cluster.leave() })
+		net.mu.Lock()
+		net.addrs[config.Node] = o.ClusterAddress()
+		net.mu.Unlock()
+		nodes = append(nodes, o)
+	}
+	return nodes, net
+}
+
+// clusterTick runs what the coordination loop of every node does with the
+// registry and the cluster, in order
+func clusterTick(nodes ...*Orchestrator) {
+	for _, o := range nodes {
+		o.registry.Reload()
+		o.cluster.tick(time.Now())
+		o.hostAgents()
+	}
+}
+
+// settle ticks the nodes until cond holds
+func settle(t *testing.T, what string, nodes []*Orchestrator, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		clusterTick(nodes...)
+		if cond() {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func clusterAgent(t *testing.T, registry *Registry, name string, config map[string]interface{}) *Agent {
+	t.Helper()
+	agent, err := NewAgent(AgentConfig{Name: name, Type: AtomSpaceAgent, Config: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Register(agent)
+	registry.Transition(agent, StatusStarting, "test", "")
+	registry.Transition(agent, StatusRunning, "test", "")
+	registry.Update(agent)
+	return agent
+}
+
+// placed tells whether every node has the agent with the given ID on node
+func placed(nodes []*Orchestrator, id, node string) bool {
+	for _, o := range nodes {
+		agent, err := o.registry.Get(id)
+		if err != nil || agent.Node != node {
+			return false
+		}
+	}
+	return true
+}
+
+func leaderOf(nodes ...*Orchestrator) *Orchestrator {
+	for _, o := range nodes {
+		if o.cluster.coordinates() {
+			return o
+		}
+	}
+	return nil
+}
+
+func TestClusterPlacesAgentsAndForwardsMessages(t *testing.T) {
+	nodes, _ := clusterSetup(t,
+		ClusterConfig{Node: "n1", Capacity: 1},
+		ClusterConfig{Node: "n2", Capacity: 2, Tags: []string{"gpu"}},
+		ClusterConfig{Node: "n3", Capacity: 2},
+	)
+	n1, n2, n3 := nodes[0], nodes[1], nodes[2]
+
+	// Agents created on any node reach the leader, which places them
+	kb := clusterAgent(t, n3.registry, "kb", map[string]interface{}{"node_tags": "gpu"})
+	other := clusterAgent(t, n3.registry, "other", nil)
+	settle(t, "the agents to be placed", nodes, func() bool {
+		return placed(nodes, kb.ID, "n2") && placed(nodes, other.ID, "n3")
+	})
+	settle(t, "n2 to host kb", nodes, func() bool {
+		hosted := n2.Hosted()
+		return len(hosted) == 1 && hosted[0] == kb.ID
+	})
+	if hosted := n1.Hosted(); len(hosted) != 0 {
+		t.Errorf("Expected n1 to host nothing, got %v", hosted)
+	}
+	events, _ := n1.registry.Events(kb.ID, EventFilter{Kind: EventPlacement})
+	if len(events) != 1 || events[0].To != "n2" {
+		t.Errorf("Expected the placement to be recorded, got %+v", events)
+	}
+
+	// Messages go to the node hosting their agent, and replies come back
+	n1.RegisterAgent("client")
+	reply, err := n1.Request(&Message{From: "client", To: kb.ID, Type: MessageTypeQuery,
+		Payload: map[string]interface{}{"query": `(ConceptNode "cat")`}}, 5*time.Second)
+	if err != nil || reply.From != kb.ID || reply.Payload["result"] == nil {
+		t.Fatalf("Expected kb to answer across nodes, got %+v, %v", reply, err)
+	}
+	if _, err := n1.Request(&Message{From: "client", To: other.ID, Type: MessageTypeCommand}, 5*time.Second); err == nil ||
+		!strings.Contains(err.Error(), "do not handle command") {
+		t.Errorf("Expected the error of other to come back from n3, got %v", err)
+	}
+
+	// Changes made on any node reach the others
+	changed, _ := n2.registry.Get(kb.ID)
+	changed.UpdateConfig(map[string]interface{}{"max_atoms": 10}, nil)
+	n2.registry.Update(changed)
+	n3.registry.Unregister(other.ID)
+	settle(t, "the changes to reach every node", nodes, func() bool {
+		for _, o := range nodes {
+			agent, err := o.registry.Get(kb.ID)
+			if err != nil || agent.ConfigInt("max_atoms") != 10 {
+				return false
+			}
+			if _, err := o.registry.Get(other.ID); err == nil {
+				return false
+			}
+		}
+		return true
+	})
+
+	state, err := LoadClusterState(n3.registry.Dir())
+	if err != nil || state.Node != "n3" || state.Coordinator != "n1" || len(state.Nodes) != 3 || state.Error != "" {
+		t.Fatalf("Unexpected cluster state of n3 %+v, %v", state, err)
+	}
+	if state.Raft == nil || state.Raft.Role != raft.Follower || len(state.Raft.Members) != 3 || state.Raft.AppliedIndex == 0 {
+		t.Errorf("Unexpected raft state of n3 %+v", state.Raft)
+	}
+}
+
+func TestClusterDropsConflictingChanges(t *testing.T) {
+	nodes, _ := clusterSetup(t,
+		ClusterConfig{Node: "n1", Capacity: 1},
+		ClusterConfig{Node: "n2", Capacity: 1},
+		ClusterConfig{Node: "n3", Capacity: 1},
+	)
+	n2, n3 := nodes[1], nodes[2]
+
+	kb := clusterAgent(t, n2.registry, "kb", nil)
+	settle(t, "kb to reach n3", nodes, func() bool {
+		_, err := n3.registry.Get(kb.ID)
+		return err == nil
+	})
+
+	// Both nodes change the configuration of kb; n2 proposes its change
+	// first
+	for i, o := range []*Orchestrator{n2, n3} {
+		agent, _ := o.registry.Get(kb.ID)
+		agent.UpdateConfig(map[string]interface{}{"max_atoms": 22 + i}, nil)
+		o.registry.Update(agent)
+	}
+	clusterTick(n2)
+	clusterTick(n3)
+
+	settle(t, "the change of n2 to win", nodes, func() bool {
+		for _, o := range nodes {
+			agent, err := o.registry.Get(kb.ID)
+			if err != nil || agent.ConfigInt("max_atoms") != 22 {
+				return false
+			}
+		}
+		return true
+	})
+	events, _ := n3.registry.Events(kb.ID, EventFilter{Kind: EventConflict})
+	if len(events) != 1 || !strings.Contains(events[0].Reason, "changed on another node first") {
+		t.Errorf("Expected the dropped change to be recorded, got %+v", events)
+	}
+
+	// Changes to different fields are both kept
+	agent, _ := n2.registry.Get(kb.ID)
+	agent.Branch = "dev"
+	agent.UpdatedAt = time.Now()
+	n2.registry.Update(agent)
+	agent, _ = n3.registry.Get(kb.ID)
+	agent.UpdateConfig(map[string]interface{}{"max_atoms": 30}, nil)
+	n3.registry.Update(agent)
+	clusterTick(n2)
+	clusterTick(n3)
+	settle(t, "both changes to be kept", nodes, func() bool {
+		for _, o := range nodes {
+			agent, err := o.registry.Get(kb.ID)
+			if err != nil || agent.Branch != "dev" || agent.ConfigInt("max_atoms") != 30 {
+				return false
+			}
+		}
+		return true
+	})
+	if events, _ := n3.registry.Events(kb.ID, EventFilter{Kind: EventConflict}); len(events) != 1 {
+		t.Errorf("Expected no other change to be dropped, got %+v", events)
+	}
+}
+
+func TestClusterSurvivesPartitions(t *testing.T) {
+	nodes, net := clusterSetup(t,
+		ClusterConfig{Node: "n1", Capacity: 2},
+		ClusterConfig{Node: "n2", Capacity: 1},
+		ClusterConfig{Node: "n3", Capacity: 1},
+	)
+	n1, n2, n3 := nodes[0], nodes[1], nodes[2]
+
+	kb := clusterAgent(t, n1.registry, "kb", nil)
+	other := clusterAgent(t, n1.registry, "other", nil)
+	settle(t, "the agents to be placed", nodes, func() bool {
+		return placed(nodes, kb.ID, "n1") && placed(nodes, other.ID, "n2")
+	})
+
+	// The leader is cut off; the others elect one of them and move kb
+	net.isolate("n1")
+	majority := []*Orchestrator{n2, n3}
+	settle(t, "a new leader", majority, func() bool { return leaderOf(majority...) != nil })
+	settle(t, "the old leader to step down", nodes[:1], func() bool { return !n1.cluster.coordinates() })
+	settle(t, "kb to be placed on n3", majority, func() bool { return placed(majority, kb.ID, "n3") })
+	events, _ := leaderOf(majority...).registry.Events(kb.ID, EventFilter{Kind: EventPlacement})
+	if len(events) == 0 || events[len(events)-1].From != "n1" || events[len(events)-1].Reason != "node n1 is gone" {
+		t.Errorf("Expected kb's move off n1 to be recorded, got %+v", events)
+	}
+
+	// Changes made on the majority are committed; those made on n1 wait
+	agent, _ := n2.registry.Get(other.ID)
+	agent.UpdateConfig(map[string]interface{}{"max_atoms": 5}, nil)
+	n2.registry.Update(agent)
+	settle(t, "n2's change to reach n3", majority, func() bool {
+		agent, err := n3.registry.Get(other.ID)
+		return err == nil && agent.ConfigInt("max_atoms") == 5
+	})
+	solo := clusterAgent(t, n1.registry, "solo", nil)
+	clusterTick(n1)
+	state, _ := LoadClusterState(n1.registry.Dir())
+	if state == nil || !strings.Contains(state.Error, "no raft leader") {
+		t.Errorf("Expected n1 to fail to commit its change, got %+v", state)
+	}
+	if _, err := n2.registry.Get(solo.ID); err == nil {
+		t.Error("Expected the change of n1 not to reach the majority")
+	}
+
+	// Once healed, n1 follows the new leader and its change is committed
+	net.heal()
+	settle(t, "the cluster to converge", nodes, func() bool {
+		if !placed(nodes, kb.ID, "n3") {
+			return false
+		}
+		for _, o := range nodes {
+			agent, err := o.registry.Get(other.ID)
+			if err != nil || agent.ConfigInt("max_atoms") != 5 {
+				return false
+			}
+			if _, err := o.registry.Get(solo.ID); err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if leader := leaderOf(nodes...); leader == n1 || leader == nil {
+		t.Errorf("Expected the cluster to keep a leader that has the latest log")
+	}
+	if hosted := n1.Hosted(); len(hosted) != 0 {
+		t.Errorf("Expected n1 to stop hosting kb, got %v", hosted)
+	}
+}
+
+func TestClusterReplacesAgentsOfNodesThatLeave(t *testing.T) {
+	nodes, _ := clusterSetup(t,
+		ClusterConfig{Node: "n1", Capacity: 1},
+		ClusterConfig{Node: "n2", Capacity: 1, Tags: []string{"gpu"}},
+		ClusterConfig{Node: "n3", Capacity: 1},
+	)
+	n1, n2, n3 := nodes[0], nodes[1], nodes[2]
+
+	kb := clusterAgent(t, n1.registry, "kb", map[string]interface{}{"node_tags": "gpu"})
+	settle(t, "kb to be placed", nodes, func() bool { return placed(nodes, kb.ID, "n2") })
+
+	// No node but n2 is tagged gpu
+	n2.Stop()
+	rest := []*Orchestrator{n1, n3}
+	settle(t, "kb to be taken off n2", rest, func() bool { return placed(rest, kb.ID, "") })
+	events, _ := n1.registry.Events(kb.ID, EventFilter{Kind: EventPlacement})
+	if len(events) != 2 || events[1].From != "n2" || !strings.Contains(events[1].Reason, "no node tagged gpu") {
+		t.Errorf("Expected kb's removal from n2 to be recorded, got %+v", events)
+	}
+	if members := n1.cluster.raft.Status().Members; len(members) != 2 {
+		t.Errorf("Expected n2 to leave the raft group, got %v", members)
+	}
+
+	if err := n3.JoinCluster(ClusterConfig{Node: "n4", Listen: "127.0.0.1:0", Join: n1.ClusterAddress(), Capacity: 1, Secret: []byte("guess")}); err == nil ||
+		!strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("Expected a node without the secret to be refused, got %v", err)
+	}
+	registry, _ := NewRegistry(t.TempDir())
+	if err := NewOrchestrator(registry).JoinCluster(ClusterConfig{Node: "n1", Listen: "127.0.0.1:0", Join: n1.ClusterAddress(), Capacity: 1, Secret: clusterSecret}); err == nil ||
+		!strings.Contains(err.Error(), "taken") {
+		t.Errorf("Expected a node with the leader's name to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+// Package cron parses cron expressions and computes when they fire.
+//
+// Expressions have the five standard fields, minute, hour, day of month,
+// month and day of week, each a "*", a value, a range "a-b", a step "*/n" or
+// "a-b/n", or a comma-separated list of these. Months and days of the week
+// may be named by their first three letters, and Sunday is 0 or 7. When both
+// the day of the month and the day of the week are restricted, either one
+// matching is enough, as in Vixie cron. The macros @yearly, @annually,
+// @monthly, @weekly, @daily, @midnight and @hourly are accepted too.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// daysRestricted and weekdaysRestricted tell whether the day fields
+	// were something other than "*"
+	daysRestricted, weekdaysRestricted bool
+}
+
+// Parse parses a cron expression
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := macros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields (minute hour day-of-month month day-of-week) or a macro such as @daily", expr)
+	}
+
+	sets := make([]uint64, len(fields))
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %v", expr, err)
+		}
+		sets[i] = set
+	}
+	// Sunday is both 0 and 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &Schedule{
+		minutes:            sets[0],
+		hours:              sets[1],
+		days:               sets[2],
+		months:             sets[3],
+		weekdays:           sets[4],
+		daysRestricted:     parts[2] != "*",
+		weekdaysRestricted: parts[4] != "*",
+	}, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, item)
+			}
+			rng, step = item[:i], n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range in %s %q", f.name, item)
+			}
+		default:
+			v, err := parseValue(rng, f)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// "5/15" means from 5 to the end, every 15
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			// Months are numbered from 1, days of the week from 0
+			return i + f.min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected %d-%d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	day, weekday := has(s.days, t.Day()), has(s.weekdays, int(t.Weekday()))
+	if s.daysRestricted && s.weekdaysRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// maxYears bounds the search for the next time, for expressions such as
+// "0 0 30 2 *" that never fire
+const maxYears = 5
+
+// Next returns the first time after t the schedule fires, in t's location,
+// or the zero time if it never does
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxYears, 0, 0)
+
+	for t.Before(limit) {
+		if !has(s.months, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.hours, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.minutes, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Last returns the last time in (after, until] the schedule fires, or the
+// zero time if it does not fire in between
+func (s *Schedule) Last(after, until time.Time) time.Time {
+	var last time.Time
+	for t := s.Next(after); !t.IsZero() && !t.After(until); t = s.Next(t) {
+		last = t
+	}
+	return last
+}
@@ -0,0 +1,85 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// Wednesday, 15 May 2024
+	from := time.Date(2024, 5, 15, 10, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"* * * * *", "2024-05-15 10:31"},
+		{"0 3 * * *", "2024-05-16 03:00"},
+		{"@daily", "2024-05-16 00:00"},
+		{"@hourly", "2024-05-15 11:00"},
+		{"*/15 * * * *", "2024-05-15 10:45"},
+		{"5/20 * * * *", "2024-05-15 10:45"},
+		{"0 9-17/4 * * *", "2024-05-15 13:00"},
+		{"0 0 * * sun", "2024-05-19 00:00"},
+		{"0 0 * * 7", "2024-05-19 00:00"},
+		{"0 0 * * MON-FRI", "2024-05-16 00:00"},
+		{"0 0 1 * *", "2024-06-01 00:00"},
+		{"0 0 1 jan *", "2025-01-01 00:00"},
+		{"30 10,22 * * *", "2024-05-15 22:30"},
+		// Either day field matching is enough when both are restricted
+		{"0 0 20 * 5", "2024-05-17 00:00"},
+		{"0 0 29 2 *", "2028-02-29 00:00"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+		}
+		if got := s.Next(from).Format("2006-01-02 15:04"); got != tt.want {
+			t.Errorf("Next(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	never, _ := Parse("0 0 30 2 *")
+	if next := never.Next(from); !next.IsZero() {
+		t.Errorf("Expected February 30th never to come, got %v", next)
+	}
+}
+
+func TestLast(t *testing.T) {
+	s, _ := Parse("0 3 * * *")
+	after := time.Date(2024, 5, 13, 12, 0, 0, 0, time.UTC)
+
+	if last := s.Last(after, after.Add(time.Hour)); !last.IsZero() {
+		t.Errorf("Expected no time in between, got %v", last)
+	}
+	want := time.Date(2024, 5, 15, 3, 0, 0, 0, time.UTC)
+	if last := s.Last(after, want); !last.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, last)
+	}
+	if last := s.Last(after, want.Add(5*time.Hour)); !last.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, last)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"* * * *", "expected 5 fields"},
+		{"60 * * * *", "invalid minute"},
+		{"* 24 * * *", "invalid hour"},
+		{"* * 0 * *", "invalid day of month"},
+		{"* * * foo *", "invalid month"},
+		{"*/0 * * * *", "invalid step"},
+		{"10-5 * * * *", "invalid range"},
+		{"@often", "expected 5 fields"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.expr); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Parse(%q): expected error containing %q, got %v", tt.expr, tt.wantErr, err)
+		}
+	}
+}
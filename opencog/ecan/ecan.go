@@ -0,0 +1,252 @@
+// Package ecan implements Economic Attention Networks over an AtomSpace.
+// Importance is a currency: a bank pays atoms wages for the stimulus they
+// receive, atoms pay rent to keep their importance, and atoms in the
+// attentional focus spread part of their short-term importance to the atoms
+// they are linked with. The total amount of importance, in the bank and in
+// atoms, stays the same.
+package ecan
+
+import (
+	"math"
+	"sort"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// Config holds the parameters of attention allocation
+type Config struct {
+	// FocusSize is the most atoms the attentional focus holds
+	FocusSize int
+	// FocusBoundary is the least STI an atom needs to enter the focus
+	FocusBoundary float64
+	// TargetSTIFunds and TargetLTIFunds are the amounts of importance the
+	// bank aims to hold
+	TargetSTIFunds float64
+	TargetLTIFunds float64
+	// STIWage and LTIWage are paid for each unit of stimulus
+	STIWage float64
+	LTIWage float64
+	// STIRent and LTIRent are charged to every atom each cycle
+	STIRent float64
+	LTIRent float64
+	// DiffusionRate is the fraction of its STI that each atom in the focus
+	// spreads to its neighbors each cycle
+	DiffusionRate float64
+}
+
+// DefaultConfig returns the default attention allocation parameters
+func DefaultConfig() Config {
+	return Config{
+		FocusSize:      20,
+		FocusBoundary:  1,
+		TargetSTIFunds: 10000,
+		TargetLTIFunds: 10000,
+		STIWage:        10,
+		LTIWage:        10,
+		STIRent:        1,
+		LTIRent:        1,
+		DiffusionRate:  0.2,
+	}
+}
+
+// Bank holds the importance that is not given to any atom
+type Bank struct {
+	STIFunds float64 `json:"sti_funds"`
+	LTIFunds float64 `json:"lti_funds"`
+}
+
+// NewBank returns a bank holding the target funds of config
+func NewBank(config Config) *Bank {
+	return &Bank{STIFunds: config.TargetSTIFunds, LTIFunds: config.TargetLTIFunds}
+}
+
+// Stimulus is the stimulus each atom received since the last cycle
+type Stimulus map[atomspace.Handle]float64
+
+// Report describes an attention allocation cycle
+type Report struct {
+	// Wages is the STI paid to stimulated atoms
+	Wages float64 `json:"wages"`
+	// Rent is the STI collected from atoms
+	Rent float64 `json:"rent"`
+	// Diffused is the STI spread from the focus to its neighbors
+	Diffused float64 `json:"diffused"`
+	// Focus holds the atoms in the attentional focus after the cycle, most
+	// important first
+	Focus []atomspace.Handle `json:"focus"`
+	// Boundary is the least STI of an atom in the focus
+	Boundary float64 `json:"boundary"`
+}
+
+// Allocator runs attention allocation cycles, moving importance between its
+// bank and the atoms of an AtomSpace
+type Allocator struct {
+	Config Config
+	Bank   *Bank
+}
+
+// NewAllocator creates an allocator. A nil bank starts with the target funds.
+func NewAllocator(config Config, bank *Bank) *Allocator {
+	if bank == nil {
+		bank = NewBank(config)
+	}
+	return &Allocator{Config: config, Bank: bank}
+}
+
+// Cycle pays wages for stimulus, diffuses importance from the attentional
+// focus along links, collects rent and returns the new focus.
+//
+// Wages and rent depend on how the bank's funds compared with their target at
+// the start of the cycle: with f = funds/target limited to [0, 2], the wage is
+// STIWage·f and the rent STIRent·(2-f). A bank that is short of funds pays
+// less and charges more, which brings its funds back towards the target.
+func (a *Allocator) Cycle(space *atomspace.AtomSpace, stimulus Stimulus) *Report {
+	report := &Report{}
+	avs := make(map[atomspace.Handle]atomspace.AttentionValue)
+	for _, h := range space.Handles() {
+		atom, _ := space.Get(h)
+		avs[h] = atom.AV
+	}
+
+	stiRatio := fundsRatio(a.Bank.STIFunds, a.Config.TargetSTIFunds)
+	ltiRatio := fundsRatio(a.Bank.LTIFunds, a.Config.TargetLTIFunds)
+
+	report.Wages = a.payWages(avs, stimulus, a.Config.STIWage*stiRatio, a.Config.LTIWage*ltiRatio)
+	report.Diffused = a.diffuse(space, avs)
+	report.Rent = a.collectRent(avs, a.Config.STIRent*(2-stiRatio), a.Config.LTIRent*(2-ltiRatio))
+
+	for h, av := range avs {
+		space.SetAttentionValue(h, av)
+	}
+	report.Focus = Focus(space, a.Config.FocusSize, a.Config.FocusBoundary)
+	report.Boundary = a.Config.FocusBoundary
+	if n := len(report.Focus); n > 0 && n == a.Config.FocusSize {
+		last, _ := space.Get(report.Focus[n-1])
+		report.Boundary = last.AV.STI
+	}
+	return report
+}
+
+// payWages gives every stimulated atom wages from the bank
+func (a *Allocator) payWages(avs map[atomspace.Handle]atomspace.AttentionValue, stimulus Stimulus, stiWage, ltiWage float64) float64 {
+	paid := 0.0
+	for _, h := range sortedHandles(stimulus) {
+		av, ok := avs[h]
+		if !ok || stimulus[h] <= 0 {
+			continue
+		}
+		sti := math.Min(stiWage*stimulus[h], math.Max(a.Bank.STIFunds, 0))
+		lti := math.Min(ltiWage*stimulus[h], math.Max(a.Bank.LTIFunds, 0))
+		av.STI += sti
+		av.LTI += lti
+		a.Bank.STIFunds -= sti
+		a.Bank.LTIFunds -= lti
+		avs[h] = av
+		paid += sti
+	}
+	return paid
+}
+
+// diffuse makes every atom in the focus spread part of its STI evenly over
+// its neighbors: the atoms it links and the links it appears in
+func (a *Allocator) diffuse(space *atomspace.AtomSpace, avs map[atomspace.Handle]atomspace.AttentionValue) float64 {
+	if a.Config.DiffusionRate <= 0 {
+		return 0
+	}
+
+	// Spread from the focus as it was before any atom gave STI away
+	for h, av := range avs {
+		space.SetAttentionValue(h, av)
+	}
+	focus := Focus(space, a.Config.FocusSize, a.Config.FocusBoundary)
+
+	delta := make(map[atomspace.Handle]float64)
+	total := 0.0
+	for _, h := range focus {
+		atom, _ := space.Get(h)
+		neighbors := append(append([]atomspace.Handle(nil), atom.Outgoing...), space.Incoming(h)...)
+		if len(neighbors) == 0 {
+			continue
+		}
+		amount := a.Config.DiffusionRate * avs[h].STI
+		delta[h] -= amount
+		for _, n := range neighbors {
+			delta[n] += amount / float64(len(neighbors))
+		}
+		total += amount
+	}
+
+	for h, d := range delta {
+		av := avs[h]
+		av.STI += d
+		avs[h] = av
+	}
+	return total
+}
+
+// collectRent charges every atom with importance rent, which returns to the
+// bank. Atoms never pay more than they have, and atoms with VLTI set pay no
+// LTI rent.
+func (a *Allocator) collectRent(avs map[atomspace.Handle]atomspace.AttentionValue, stiRent, ltiRent float64) float64 {
+	collected := 0.0
+	for h, av := range avs {
+		if av.STI > 0 {
+			rent := math.Min(stiRent, av.STI)
+			av.STI -= rent
+			a.Bank.STIFunds += rent
+			collected += rent
+		}
+		if av.LTI > 0 && !av.VLTI {
+			rent := math.Min(ltiRent, av.LTI)
+			av.LTI -= rent
+			a.Bank.LTIFunds += rent
+		}
+		avs[h] = av
+	}
+	return collected
+}
+
+// Focus returns the attentional focus of space: the atoms with at least
+// boundary STI, most important first, up to size atoms. Atoms with no STI are
+// never in the focus.
+func Focus(space *atomspace.AtomSpace, size int, boundary float64) []atomspace.Handle {
+	type entry struct {
+		h   atomspace.Handle
+		sti float64
+	}
+
+	var entries []entry
+	for _, h := range space.Handles() {
+		atom, _ := space.Get(h)
+		if atom.AV.STI > 0 && atom.AV.STI >= boundary {
+			entries = append(entries, entry{h, atom.AV.STI})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].sti > entries[j].sti })
+
+	if size > 0 && len(entries) > size {
+		entries = entries[:size]
+	}
+	focus := make([]atomspace.Handle, len(entries))
+	for i, e := range entries {
+		focus[i] = e.h
+	}
+	return focus
+}
+
+// fundsRatio compares funds with their target, limited to [0, 2]
+func fundsRatio(funds, target float64) float64 {
+	if target <= 0 {
+		return 1
+	}
+	return math.Max(0, math.Min(2, funds/target))
+}
+
+func sortedHandles(stimulus Stimulus) []atomspace.Handle {
+	handles := make([]atomspace.Handle, 0, len(stimulus))
+	for h := range stimulus {
+		handles = append(handles, h)
+	}
+	sort.Slice(handles, func(i, j int) bool { return handles[i] < handles[j] })
+	return handles
+}
@@ -0,0 +1,155 @@
+package ecan
+
+import (
+	"math"
+	"testing"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// animals returns an AtomSpace stating that cats and dogs are animals
+func animals() (*atomspace.AtomSpace, map[string]atomspace.Handle) {
+	space := atomspace.New()
+	h := make(map[string]atomspace.Handle)
+	for _, name := range []string{"cat", "dog", "animal", "rock"} {
+		h[name], _ = space.AddNode(atomspace.ConceptNode, name)
+	}
+	h["cat→animal"], _ = space.AddLink(atomspace.InheritanceLink, h["cat"], h["animal"])
+	h["dog→animal"], _ = space.AddLink(atomspace.InheritanceLink, h["dog"], h["animal"])
+	return space, h
+}
+
+func sti(space *atomspace.AtomSpace, h atomspace.Handle) float64 {
+	atom, _ := space.Get(h)
+	return atom.AV.STI
+}
+
+// totalSTI returns the STI held by the bank and all atoms
+func totalSTI(space *atomspace.AtomSpace, bank *Bank) float64 {
+	total := bank.STIFunds
+	for _, h := range space.Handles() {
+		total += sti(space, h)
+	}
+	return total
+}
+
+func TestWagesAndRent(t *testing.T) {
+	space, h := animals()
+	config := DefaultConfig()
+	config.DiffusionRate = 0
+	allocator := NewAllocator(config, nil)
+
+	report := allocator.Cycle(space, Stimulus{h["cat"]: 2})
+	// Wages of 10 per unit of stimulus, less the rent of 1
+	if got := sti(space, h["cat"]); got != 19 {
+		t.Errorf("Expected cat to have 19 STI, got %v", got)
+	}
+	if report.Wages != 20 || report.Rent != 1 {
+		t.Errorf("Expected wages 20 and rent 1, got %+v", report)
+	}
+	if atom, _ := space.Get(h["cat"]); atom.AV.LTI != 19 {
+		t.Errorf("Expected cat to have 19 LTI, got %v", atom.AV.LTI)
+	}
+	if allocator.Bank.STIFunds != 10000-19 {
+		t.Errorf("Expected the bank to hold 9981, got %v", allocator.Bank.STIFunds)
+	}
+
+	// Without stimulus, importance drains back into the bank
+	for i := 0; i < 30; i++ {
+		allocator.Cycle(space, nil)
+	}
+	if got := sti(space, h["cat"]); got != 0 {
+		t.Errorf("Unstimulated atoms should lose their STI, got %v", got)
+	}
+	if math.Abs(allocator.Bank.STIFunds-10000) > 1e-9 {
+		t.Errorf("Expected all STI to return to the bank, got %v", allocator.Bank.STIFunds)
+	}
+}
+
+func TestFundsRegulateWagesAndRent(t *testing.T) {
+	config := DefaultConfig()
+	config.DiffusionRate = 0
+
+	space, h := animals()
+	poor := NewAllocator(config, &Bank{STIFunds: config.TargetSTIFunds / 2, LTIFunds: config.TargetLTIFunds})
+	report := poor.Cycle(space, Stimulus{h["cat"]: 1})
+	if report.Wages != 5 || report.Rent != 1.5 {
+		t.Errorf("A bank with half its funds should pay half wages and charge 1.5 rent, got %+v", report)
+	}
+
+	space, h = animals()
+	broke := NewAllocator(config, &Bank{})
+	broke.Cycle(space, Stimulus{h["cat"]: 1})
+	if got := sti(space, h["cat"]); got != 0 || broke.Bank.STIFunds != 0 {
+		t.Errorf("A bank without funds should pay nothing, got %v STI and funds %v", got, broke.Bank.STIFunds)
+	}
+}
+
+func TestDiffusion(t *testing.T) {
+	space, h := animals()
+	config := DefaultConfig()
+	config.STIRent = 0
+	config.LTIRent = 0
+	allocator := NewAllocator(config, nil)
+
+	// Stimulated atoms spread importance in the cycle they are paid
+	report := allocator.Cycle(space, Stimulus{h["cat"]: 10})
+	if report.Diffused != 20 {
+		t.Errorf("Expected 20%% of cat's 100 STI to spread, got %v", report.Diffused)
+	}
+	if got := sti(space, h["cat→animal"]); got != 20 {
+		t.Errorf("Expected cat to spread to the link it appears in, got %v", got)
+	}
+	if sti(space, h["animal"]) != 0 {
+		t.Error("Importance should take a cycle to cross a link")
+	}
+
+	allocator.Cycle(space, nil)
+	if sti(space, h["animal"]) == 0 {
+		t.Error("Importance should spread through links to the atoms they link")
+	}
+	if sti(space, h["rock"]) != 0 {
+		t.Error("Importance should not reach unconnected atoms")
+	}
+}
+
+func TestImportanceIsConserved(t *testing.T) {
+	space, h := animals()
+	allocator := NewAllocator(DefaultConfig(), nil)
+	before := totalSTI(space, allocator.Bank)
+
+	for i := 0; i < 20; i++ {
+		stimulus := Stimulus{h["cat"]: 3}
+		if i%3 == 0 {
+			stimulus[h["dog"]] = 5
+		}
+		allocator.Cycle(space, stimulus)
+	}
+	if after := totalSTI(space, allocator.Bank); math.Abs(after-before) > 1e-6 {
+		t.Errorf("Expected total STI %v to be conserved, got %v", before, after)
+	}
+}
+
+func TestFocus(t *testing.T) {
+	space, h := animals()
+	space.SetAttentionValue(h["cat"], atomspace.AttentionValue{STI: 50})
+	space.SetAttentionValue(h["dog"], atomspace.AttentionValue{STI: 30})
+	space.SetAttentionValue(h["animal"], atomspace.AttentionValue{STI: 40})
+	space.SetAttentionValue(h["rock"], atomspace.AttentionValue{STI: 5})
+
+	focus := Focus(space, 2, 10)
+	if len(focus) != 2 || focus[0] != h["cat"] || focus[1] != h["animal"] {
+		t.Errorf("Expected cat and animal in the focus, got %v", focus)
+	}
+	if focus := Focus(space, 10, 10); len(focus) != 3 {
+		t.Errorf("Atoms below the boundary should stay out of the focus, got %v", focus)
+	}
+
+	config := DefaultConfig()
+	config.FocusSize = 2
+	config.DiffusionRate = 0
+	report := NewAllocator(config, nil).Cycle(space, nil)
+	if report.Boundary != 39 {
+		t.Errorf("A full focus should report the STI of its least important atom, got %v", report.Boundary)
+	}
+}
@@ -0,0 +1,401 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+	"github.com/github/hub/v2/opencog/ecan"
+	"github.com/github/hub/v2/opencog/internal/decode"
+)
+
+func init() {
+	RegisterBehavior(ECANAgent, newECANBehavior)
+}
+
+// Actions of the commands ECAN agents handle
+const (
+	StimulateAction = "stimulate"
+	CycleAction     = "cycle"
+)
+
+// Stimulation is stimulus an atom received and has not been paid for yet
+type Stimulation struct {
+	Atom   atomspace.Tree `json:"atom"`
+	Amount float64        `json:"amount"`
+}
+
+// FocusAtom is an atom in the attentional focus
+type FocusAtom struct {
+	Atom atomspace.Tree `json:"atom"`
+	STI  float64        `json:"sti"`
+	LTI  float64        `json:"lti"`
+}
+
+// AttentionCycle records an attention allocation cycle of an ECAN agent
+type AttentionCycle struct {
+	Time time.Time `json:"time"`
+	// Knowledge is the name of the atomspace agent whose atoms got attention
+	Knowledge string  `json:"knowledge"`
+	Wages     float64 `json:"wages"`
+	Rent      float64 `json:"rent"`
+	Diffused  float64 `json:"diffused"`
+	// Focus holds the attentional focus after the cycle, most important first
+	Focus    []FocusAtom `json:"focus"`
+	Boundary float64     `json:"boundary"`
+	// Bank holds the funds left after the cycle
+	Bank ecan.Bank `json:"bank"`
+}
+
+// ecanState is what an ECAN agent keeps between cycles
+type ecanState struct {
+	Bank      *ecan.Bank      `json:"bank,omitempty"`
+	Stimulus  []Stimulation   `json:"stimulus,omitempty"`
+	Cycles    int             `json:"cycles"`
+	LastCycle *AttentionCycle `json:"last_cycle,omitempty"`
+}
+
+func ecanStatePath(configDir string, agent *Agent) string {
+	return filepath.Join(configDir, "ecan", agent.ID+".json")
+}
+
+func loadECANState(configDir string, agent *Agent) (*ecanState, error) {
+	state := &ecanState{}
+	data, err := os.ReadFile(ecanStatePath(configDir, agent))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read attention state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse attention state: %w", err)
+	}
+	return state, nil
+}
+
+func (s *ecanState) save(configDir string, agent *Agent) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal attention state: %w", err)
+	}
+	path := ecanStatePath(configDir, agent)
+	// Readers never see a partly written file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write attention state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write attention state: %w", err)
+	}
+	return nil
+}
+
+// updateECANState calls fn with the current state of an ECAN agent and saves
+// it if fn succeeds. The state is locked throughout, so that the stimulus
+// other processes record at the same time is kept.
+func updateECANState(configDir string, agent *Agent, fn func(*ecanState) error) error {
+	path := ecanStatePath(configDir, agent)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create attention state directory: %w", err)
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock attention state: %w", err)
+	}
+	defer unlock()
+
+	state, err := loadECANState(configDir, agent)
+	if err != nil {
+		return err
+	}
+	if err := fn(state); err != nil {
+		return err
+	}
+	return state.save(configDir, agent)
+}
+
+// AttentionalFocus returns the most recent attention allocation cycle of an
+// ECAN agent and the number of cycles it has run. The cycle is nil if the
+// agent has not run one yet.
+func AttentionalFocus(configDir string, agent *Agent) (*AttentionCycle, int, error) {
+	state, err := loadECANState(configDir, agent)
+	if err != nil {
+		return nil, 0, err
+	}
+	return state.LastCycle, state.Cycles, nil
+}
+
+// StimulusPayload builds the payload of a command giving each of atoms
+// amount units of stimulus
+func StimulusPayload(atoms []atomspace.Tree, amount float64) map[string]interface{} {
+	return map[string]interface{}{
+		"action": StimulateAction,
+		"atoms":  atoms,
+		"amount": amount,
+	}
+}
+
+// DecodeAttentionCycle extracts the cycle from an ECAN agent's reply
+func DecodeAttentionCycle(payload map[string]interface{}) (*AttentionCycle, error) {
+	cycle := &AttentionCycle{}
+	if err := decode.Payload(payload, "cycle", "attention cycle", cycle); err != nil {
+		return nil, err
+	}
+	return cycle, nil
+}
+
+// ecanBehavior implements the ecan agent type: it collects stimulus for the
+// atoms of its atomspace agent and periodically allocates attention to them,
+// publishing the attention values it changes back to the atomspace agent
+type ecanBehavior struct {
+	agent     *Agent
+	configDir string
+	outbox    *Outbox
+}
+
+func newECANBehavior(agent *Agent, configDir string) (Behavior, error) {
+	return &ecanBehavior{agent: agent, configDir: configDir}, nil
+}
+
+func (b *ecanBehavior) SetOutbox(outbox *Outbox) {
+	b.outbox = outbox
+}
+
+func (b *ecanBehavior) CycleInterval() time.Duration {
+	return b.agent.ConfigDuration("cycle_interval")
+}
+
+func (b *ecanBehavior) Cycle(now time.Time) error {
+	_, err := b.cycle(now)
+	return err
+}
+
+func (b *ecanBehavior) HandleMessage(msg *Message) (*Message, error) {
+	switch msg.Type {
+	case MessageTypeCommand:
+		action, _ := msg.Payload["action"].(string)
+		switch action {
+		case StimulateAction:
+			return b.stimulate(msg)
+		case CycleAction:
+			cycle, err := b.cycle(time.Now())
+			if err != nil {
+				return nil, err
+			}
+			return &Message{
+				Type:    MessageTypeResponse,
+				Payload: map[string]interface{}{"cycle": cycle},
+			}, nil
+		}
+		return nil, fmt.Errorf("unknown ecan action %q, expected %s or %s", action, StimulateAction, CycleAction)
+	case MessageTypeHeartbeat, MessageTypeResponse:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("ecan agents do not handle %s messages", msg.Type)
+}
+
+// config returns the attention allocation parameters of the agent
+func (b *ecanBehavior) config() ecan.Config {
+	return ecan.Config{
+		FocusSize:      b.agent.ConfigInt("af_size"),
+		FocusBoundary:  b.agent.ConfigFloat("af_boundary"),
+		TargetSTIFunds: b.agent.ConfigFloat("sti_funds"),
+		TargetLTIFunds: b.agent.ConfigFloat("lti_funds"),
+		STIWage:        b.agent.ConfigFloat("sti_wage"),
+		LTIWage:        b.agent.ConfigFloat("lti_wage"),
+		STIRent:        b.agent.ConfigFloat("sti_rent"),
+		LTIRent:        b.agent.ConfigFloat("lti_rent"),
+		DiffusionRate:  b.agent.ConfigFloat("diffusion_rate"),
+	}
+}
+
+// knowledge opens the store of the agent's atomspace agent
+func (b *ecanBehavior) knowledge() (*Agent, *AtomSpaceStore, error) {
+	registry, err := NewRegistry(b.configDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	kb, err := KnowledgeAgent(registry, b.agent)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := OpenAtomSpace(b.configDir, kb)
+	if err != nil {
+		return nil, nil, err
+	}
+	return kb, store, nil
+}
+
+// stimulate records stimulus for the atoms of the message, to be paid for in
+// the next cycle, and replies with the number of atoms stimulated
+func (b *ecanBehavior) stimulate(msg *Message) (*Message, error) {
+	trees, err := atomspace.DecodeKnowledge(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	amount := 1.0
+	switch v := msg.Payload["amount"].(type) {
+	case int:
+		amount = float64(v)
+	case float64:
+		amount = v
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("stimulus must be positive, got %g", amount)
+	}
+
+	kb, store, err := b.knowledge()
+	if err != nil {
+		return nil, err
+	}
+	err = store.Read(func(space *atomspace.AtomSpace) error {
+		for _, tree := range trees {
+			if _, ok := space.Find(tree.Bare()); !ok {
+				return fmt.Errorf("%s does not know %s", kb.Name, tree.Bare())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = updateECANState(b.configDir, b.agent, func(state *ecanState) error {
+		for _, tree := range trees {
+			state.Stimulus = append(state.Stimulus, Stimulation{Atom: tree.Bare(), Amount: amount})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Type:    MessageTypeResponse,
+		Payload: map[string]interface{}{"stimulated": len(trees)},
+	}, nil
+}
+
+// cycle pays the pending stimulus and runs an attention allocation cycle over
+// the atoms of the agent's atomspace agent
+func (b *ecanBehavior) cycle(now time.Time) (*AttentionCycle, error) {
+	if b.outbox == nil {
+		return nil, fmt.Errorf("agent %s is not hosted", b.agent.Name)
+	}
+	kb, store, err := b.knowledge()
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadECANState(b.configDir, b.agent)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allocate attention on a copy, so that the knowledge store only changes
+	// through the knowledge messages it receives
+	var space *atomspace.AtomSpace
+	err = store.Read(func(s *atomspace.AtomSpace) error {
+		space = s.Clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	before := make(map[atomspace.Handle]atomspace.AttentionValue)
+	for _, h := range space.Handles() {
+		atom, _ := space.Get(h)
+		before[h] = atom.AV
+	}
+
+	// Stimulus for atoms forgotten since is dropped
+	stimulus := make(ecan.Stimulus)
+	for _, s := range state.Stimulus {
+		if h, ok := space.Find(s.Atom); ok {
+			stimulus[h] += s.Amount
+		}
+	}
+
+	allocator := ecan.NewAllocator(b.config(), state.Bank)
+	report := allocator.Cycle(space, stimulus)
+	cycle := &AttentionCycle{
+		Time:      now,
+		Knowledge: kb.Name,
+		Wages:     report.Wages,
+		Rent:      report.Rent,
+		Diffused:  report.Diffused,
+		Boundary:  report.Boundary,
+		Bank:      *allocator.Bank,
+	}
+	for _, h := range report.Focus {
+		tree, err := space.Tree(h)
+		if err != nil {
+			return nil, err
+		}
+		atom, _ := space.Get(h)
+		cycle.Focus = append(cycle.Focus, FocusAtom{Atom: tree.Bare(), STI: atom.AV.STI, LTI: atom.AV.LTI})
+	}
+
+	var changed []atomspace.Tree
+	for _, h := range space.Handles() {
+		atom, _ := space.Get(h)
+		if atom.AV == before[h] {
+			continue
+		}
+		tree, err := space.Tree(h)
+		if err != nil {
+			return nil, err
+		}
+		tree = tree.Bare()
+		av := atom.AV
+		tree.AV = &av
+		changed = append(changed, tree)
+	}
+	if len(changed) > 0 {
+		_, err := b.outbox.Request(&Message{
+			To:      kb.ID,
+			Type:    MessageTypeKnowledge,
+			Payload: map[string]interface{}{"atoms": changed},
+		}, publishTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to publish attention to %s: %w", kb.Name, err)
+		}
+	}
+
+	err = updateECANState(b.configDir, b.agent, func(current *ecanState) error {
+		// Stimulus recorded since the state was loaded is paid next cycle
+		current.Stimulus = unpaidStimulus(current.Stimulus, state.Stimulus)
+		current.Bank = allocator.Bank
+		current.Cycles++
+		current.LastCycle = cycle
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cycle, nil
+}
+
+// unpaidStimulus returns the stimulus of pending that is not among paid
+func unpaidStimulus(pending, paid []Stimulation) []Stimulation {
+	left := append([]Stimulation(nil), paid...)
+	var unpaid []Stimulation
+	for _, s := range pending {
+		found := false
+		for i, p := range left {
+			if p.Amount == s.Amount && p.Atom.String() == s.Atom.String() {
+				left = append(left[:i], left[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			unpaid = append(unpaid, s)
+		}
+	}
+	return unpaid
+}
@@ -0,0 +1,196 @@
+package opencog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// attentionSetup hosts an atomspace agent holding plnKnowledge and an ecan
+// agent allocating attention to it, and registers a client to talk to them
+func attentionSetup(t *testing.T, config map[string]interface{}) (*Orchestrator, *Registry, *Agent, *Agent) {
+	t.Helper()
+	registry, _ := NewRegistry(t.TempDir())
+	kb, _ := NewAgent(AgentConfig{Name: "kb", Type: AtomSpaceAgent})
+	config["atomspace"] = "kb"
+	attention, _ := NewAgent(AgentConfig{Name: "attention", Type: ECANAgent, Config: config})
+	registry.Register(kb)
+	registry.Register(attention)
+
+	trees, err := atomspace.ParseScheme(strings.NewReader(plnKnowledge))
+	if err != nil {
+		t.Fatalf("ParseScheme failed: %v", err)
+	}
+	store, _ := OpenAtomSpace(registry.Dir(), kb)
+	store.Update(func(space *atomspace.AtomSpace) error {
+		for _, tree := range trees {
+			space.AddTree(tree)
+		}
+		return nil
+	})
+
+	orchestrator := NewOrchestrator(registry)
+	for _, agent := range []*Agent{kb, attention} {
+		behavior, err := NewBehavior(agent, registry.Dir())
+		if err != nil {
+			t.Fatalf("NewBehavior failed: %v", err)
+		}
+		orchestrator.Host(agent.ID, behavior)
+	}
+	orchestrator.RegisterAgent("client")
+	t.Cleanup(func() {
+		stopCycling(orchestrator, attention)
+		orchestrator.UnregisterAgent(kb.ID)
+	})
+	return orchestrator, registry, kb, attention
+}
+
+// stopCycling stops hosting agent and lets a cycle in progress finish before
+// the test's directory is removed
+func stopCycling(orchestrator *Orchestrator, agent *Agent) {
+	orchestrator.UnregisterAgent(agent.ID)
+	time.Sleep(20 * time.Millisecond)
+}
+
+func concept(name string) atomspace.Tree {
+	return atomspace.Tree{Type: atomspace.ConceptNode, Name: name}
+}
+
+func TestECANAgentAllocatesAttention(t *testing.T) {
+	orchestrator, registry, kb, attention := attentionSetup(t, map[string]interface{}{"diffusion_rate": 0.0})
+
+	command := func(payload map[string]interface{}) *Message {
+		t.Helper()
+		reply, err := orchestrator.Request(&Message{From: "client", To: attention.ID, Type: MessageTypeCommand, Payload: payload}, 5*time.Second)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return reply
+	}
+
+	command(StimulusPayload([]atomspace.Tree{concept("cat")}, 2))
+	reply := command(map[string]interface{}{"action": CycleAction})
+	cycle, err := DecodeAttentionCycle(reply.Payload)
+	if err != nil {
+		t.Fatalf("DecodeAttentionCycle failed: %v", err)
+	}
+	if len(cycle.Focus) != 1 || cycle.Focus[0].Atom.Name != "cat" || cycle.Focus[0].STI != 19 {
+		t.Errorf("Expected cat in the focus with 19 STI, got %+v", cycle.Focus)
+	}
+	if cycle.Bank.STIFunds != 10000-19 {
+		t.Errorf("Expected the bank to hold 9981 STI, got %v", cycle.Bank.STIFunds)
+	}
+
+	store, _ := OpenAtomSpace(registry.Dir(), kb)
+	store.Read(func(space *atomspace.AtomSpace) error {
+		h, _ := space.Node(atomspace.ConceptNode, "cat")
+		if atom, _ := space.Get(h); atom.AV.STI != 19 {
+			t.Errorf("Attention should be stored with the knowledge, got %+v", atom.AV)
+		}
+		return nil
+	})
+
+	last, cycles, err := AttentionalFocus(registry.Dir(), attention)
+	if err != nil {
+		t.Fatalf("AttentionalFocus failed: %v", err)
+	}
+	if cycles != 1 || last == nil || len(last.Focus) != 1 {
+		t.Errorf("Expected the cycle to be saved, got %d cycles and %+v", cycles, last)
+	}
+
+	// Stimulus is paid once
+	cycle, _ = DecodeAttentionCycle(command(map[string]interface{}{"action": CycleAction}).Payload)
+	if cycle.Wages != 0 || cycle.Focus[0].STI >= 18 {
+		t.Errorf("Expected cat to pay rent without new wages, got %+v", cycle)
+	}
+
+	_, err = orchestrator.Request(&Message{From: "client", To: attention.ID, Type: MessageTypeCommand,
+		Payload: StimulusPayload([]atomspace.Tree{concept("dog")}, 1)}, 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "does not know") {
+		t.Errorf("Expected stimulus for unknown atoms to be rejected, got %v", err)
+	}
+}
+
+// stimulatingBehavior records stimulus for the ECAN agent of a test while
+// it is in the middle of a cycle, publishing attention
+type stimulatingBehavior struct {
+	Behavior
+	configDir string
+	attention *Agent
+}
+
+func (b *stimulatingBehavior) HandleMessage(msg *Message) (*Message, error) {
+	if msg.Type == MessageTypeKnowledge {
+		updateECANState(b.configDir, b.attention, func(state *ecanState) error {
+			state.Stimulus = append(state.Stimulus, Stimulation{Atom: concept("cat"), Amount: 1})
+			return nil
+		})
+	}
+	return b.Behavior.HandleMessage(msg)
+}
+
+func TestECANAgentKeepsStimulusGivenDuringACycle(t *testing.T) {
+	orchestrator, registry, kb, attention := attentionSetup(t, map[string]interface{}{})
+	behavior, _ := NewBehavior(kb, registry.Dir())
+	orchestrator.UnregisterAgent(kb.ID)
+	orchestrator.Host(kb.ID, &stimulatingBehavior{Behavior: behavior, configDir: registry.Dir(), attention: attention})
+
+	command := func(payload map[string]interface{}) {
+		t.Helper()
+		if _, err := orchestrator.Request(&Message{From: "client", To: attention.ID, Type: MessageTypeCommand, Payload: payload}, 5*time.Second); err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+	}
+	command(StimulusPayload([]atomspace.Tree{concept("cat")}, 1))
+	command(map[string]interface{}{"action": CycleAction})
+
+	state, err := loadECANState(registry.Dir(), attention)
+	if err != nil {
+		t.Fatalf("loadECANState failed: %v", err)
+	}
+	if len(state.Stimulus) != 1 || state.Stimulus[0].Atom.Name != "cat" {
+		t.Errorf("Expected the stimulus given during the cycle to be left for the next one, got %+v", state.Stimulus)
+	}
+}
+
+func TestECANAgentCycles(t *testing.T) {
+	_, registry, _, attention := attentionSetup(t, map[string]interface{}{"cycle_interval": "10ms"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, cycles, _ := AttentionalFocus(registry.Dir(), attention); cycles >= 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Hosted ecan agents should run attention allocation cycles")
+}
+
+func TestECANAgentReportsFailingCycles(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	attention, _ := NewAgent(AgentConfig{Name: "attention", Type: ECANAgent, Config: map[string]interface{}{"cycle_interval": "10ms"}})
+	registry.Register(attention)
+
+	orchestrator := NewOrchestrator(registry)
+	behavior, _ := NewBehavior(attention, registry.Dir())
+	orchestrator.Host(attention.ID, behavior)
+	defer stopCycling(orchestrator, attention)
+
+	health := func() []Event {
+		events, _ := registry.Events(attention.ID, EventFilter{Kind: EventHealth})
+		return events
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(health()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Later failures with the same cause are not recorded again
+	time.Sleep(100 * time.Millisecond)
+	events := health()
+	if len(events) != 1 || !strings.HasPrefix(events[0].Reason, "cycle failed: agent attention has no atomspace") {
+		t.Errorf("Expected one event for the failing cycles, got %+v", events)
+	}
+}
@@ -0,0 +1,225 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// maxEventsPerAgent bounds the number of events retained for each agent
+const maxEventsPerAgent = 200
+
+// ActorOrchestrator identifies changes made by the orchestrator itself
+const ActorOrchestrator = "orchestrator"
+
+// EventKind classifies agent events
+type EventKind string
+
+const (
+	EventLifecycle EventKind = "lifecycle"
+	EventConfig    EventKind = "config"
+	EventHealth    EventKind = "health"
+	// EventGitHub records the actions agents take, or try to take, on GitHub
+	EventGitHub EventKind = "github"
+)
+
+// Event records a change to an agent: who made it, when, and what changed
+type Event struct {
+	ID      string    `json:"id"`
+	AgentID string    `json:"agent_id"`
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Kind    EventKind `json:"kind"`
+	From    string    `json:"from,omitempty"`
+	To      string    `json:"to,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// EventFilter selects events returned by Registry.Events
+type EventFilter struct {
+	Kind  EventKind
+	Since time.Time
+	// Limit keeps only the most recent events when positive
+	Limit int
+}
+
+// CurrentActor returns the name of the user running this process
+func CurrentActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// RecordEvent appends an event to the agent's event log, discarding the
+// oldest events beyond the retention limit
+func (r *Registry) RecordEvent(event Event) error {
+	if event.AgentID == "" {
+		return fmt.Errorf("event has no agent ID")
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.ID == "" {
+		event.ID = fmt.Sprintf("evt-%d-%d", event.Time.UnixNano(), atomic.AddUint64(&eventSeq, 1))
+	}
+
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+
+	// The daemon and the CLI append to the same logs
+	unlock, err := r.lockEvents()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	events, err := r.readEvents(event.AgentID)
+	if err != nil {
+		return err
+	}
+
+	events = append(events, event)
+	if len(events) > maxEventsPerAgent {
+		events = events[len(events)-maxEventsPerAgent:]
+	}
+
+	return r.writeEvents(event.AgentID, events)
+}
+
+// eventSeq keeps the IDs of events recorded within the same nanosecond apart
+var eventSeq uint64
+
+// Events returns the events recorded for an agent, oldest first
+func (r *Registry) Events(agentID string, filter EventFilter) ([]Event, error) {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+
+	events, err := r.readEvents(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]Event, 0, len(events))
+	for _, event := range events {
+		if filter.Kind != "" && event.Kind != filter.Kind {
+			continue
+		}
+		if !filter.Since.IsZero() && event.Time.Before(filter.Since) {
+			continue
+		}
+		matched = append(matched, event)
+	}
+
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[len(matched)-filter.Limit:]
+	}
+
+	return matched, nil
+}
+
+// Transition moves agent to a new status and records the change as a
+// lifecycle event made by actor. An error means the agent did not move;
+// failing to record the event only produces a warning, as the change is
+// still kept in the agent's history. The agent itself still has to be saved
+// with Update.
+func (r *Registry) Transition(agent *Agent, to AgentStatus, actor, reason string) error {
+	from := agent.Status
+	if err := agent.Transition(to, reason); err != nil {
+		return err
+	}
+
+	err := r.RecordEvent(Event{
+		AgentID: agent.ID,
+		Actor:   actor,
+		Kind:    EventLifecycle,
+		From:    string(from),
+		To:      string(to),
+		Reason:  reason,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record the %s event of agent %s: %v\n", EventLifecycle, agent.Name, err)
+	}
+	return nil
+}
+
+// eventsPath returns the file holding an agent's events
+func (r *Registry) eventsPath(agentID string) string {
+	return filepath.Join(r.dir, "events", agentID+".json")
+}
+
+// lockEvents takes the lock other processes take to change event logs too
+func (r *Registry) lockEvents() (func(), error) {
+	dir := filepath.Join(r.dir, "events")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create events directory: %w", err)
+	}
+	unlock, err := lockFile(filepath.Join(dir, ".lock"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock events: %w", err)
+	}
+	return unlock, nil
+}
+
+// removeEvents deletes an agent's event log
+func (r *Registry) removeEvents(agentID string) error {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+
+	unlock, err := r.lockEvents()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.Remove(r.eventsPath(agentID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove events: %w", err)
+	}
+	return nil
+}
+
+func (r *Registry) readEvents(agentID string) ([]Event, error) {
+	data, err := os.ReadFile(r.eventsPath(agentID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+
+	var events []Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal events: %w", err)
+	}
+	return events, nil
+}
+
+func (r *Registry) writeEvents(agentID string, events []Event) error {
+	path := r.eventsPath(agentID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create events directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+
+	// Readers never see a partly written file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write events file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write events file: %w", err)
+	}
+	return nil
+}
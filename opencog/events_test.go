@@ -0,0 +1,187 @@
+package opencog
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistryRecordEvents(t *testing.T) {
+	registry, err := NewRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	err = registry.RecordEvent(Event{AgentID: "agent-1", Actor: "alice", Kind: EventConfig, From: "a=1", To: "a=2"})
+	if err != nil {
+		t.Fatalf("RecordEvent failed: %v", err)
+	}
+
+	events, err := registry.Events("agent-1", EventFilter{})
+	if err != nil {
+		t.Fatalf("Events failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	event := events[0]
+	if event.ID == "" || event.Time.IsZero() {
+		t.Error("RecordEvent should fill in ID and time")
+	}
+	if event.Actor != "alice" || event.From != "a=1" || event.To != "a=2" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	if err := registry.RecordEvent(Event{Actor: "alice"}); err == nil {
+		t.Error("RecordEvent should require an agent ID")
+	}
+}
+
+func TestRegistryEventsPersist(t *testing.T) {
+	dir := t.TempDir()
+	registry, _ := NewRegistry(dir)
+	registry.RecordEvent(Event{AgentID: "agent-1", Actor: "bob", Kind: EventLifecycle, To: "running"})
+
+	reopened, _ := NewRegistry(dir)
+	events, _ := reopened.Events("agent-1", EventFilter{})
+	if len(events) != 1 || events[0].Actor != "bob" {
+		t.Errorf("Events should persist across registries, got %+v", events)
+	}
+}
+
+func TestRegistryEventsOfSeveralProcesses(t *testing.T) {
+	// The daemon and the CLI each hold a registry on the same directory
+	dir := t.TempDir()
+	daemon, _ := NewRegistry(dir)
+	cli, _ := NewRegistry(dir)
+
+	var wg sync.WaitGroup
+	for _, registry := range []*Registry{daemon, cli} {
+		wg.Add(1)
+		go func(registry *Registry) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				registry.RecordEvent(Event{AgentID: "agent-1", Actor: "loop", Kind: EventHealth, Time: time.Unix(0, 1)})
+			}
+		}(registry)
+	}
+	wg.Wait()
+
+	events, _ := daemon.Events("agent-1", EventFilter{})
+	ids := make(map[string]bool)
+	for _, event := range events {
+		ids[event.ID] = true
+	}
+	if len(events) != 100 || len(ids) != 100 {
+		t.Errorf("Expected 100 events with distinct IDs, got %d events with %d IDs", len(events), len(ids))
+	}
+}
+
+func TestRegistryEventRetention(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	for i := 0; i < maxEventsPerAgent+10; i++ {
+		registry.RecordEvent(Event{AgentID: "agent-1", Actor: "loop", Kind: EventHealth, Reason: string(rune('a' + i%26))})
+	}
+
+	events, _ := registry.Events("agent-1", EventFilter{})
+	if len(events) != maxEventsPerAgent {
+		t.Errorf("Expected %d retained events, got %d", maxEventsPerAgent, len(events))
+	}
+}
+
+func TestRegistryEventFilter(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	old := time.Now().Add(-time.Hour)
+	registry.RecordEvent(Event{AgentID: "agent-1", Time: old, Actor: "a", Kind: EventLifecycle})
+	registry.RecordEvent(Event{AgentID: "agent-1", Actor: "b", Kind: EventConfig})
+	registry.RecordEvent(Event{AgentID: "agent-1", Actor: "c", Kind: EventLifecycle})
+	registry.RecordEvent(Event{AgentID: "agent-2", Actor: "d", Kind: EventLifecycle})
+
+	lifecycle, _ := registry.Events("agent-1", EventFilter{Kind: EventLifecycle})
+	if len(lifecycle) != 2 {
+		t.Errorf("Expected 2 lifecycle events, got %d", len(lifecycle))
+	}
+
+	recent, _ := registry.Events("agent-1", EventFilter{Since: time.Now().Add(-time.Minute)})
+	if len(recent) != 2 {
+		t.Errorf("Expected 2 recent events, got %d", len(recent))
+	}
+
+	last, _ := registry.Events("agent-1", EventFilter{Limit: 1})
+	if len(last) != 1 || last[0].Actor != "c" {
+		t.Errorf("Limit should keep the most recent event, got %+v", last)
+	}
+}
+
+func TestRegistryTransitionRecordsEvent(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "audited", Type: AtomSpaceAgent})
+	registry.Register(agent)
+
+	if err := registry.Transition(agent, StatusStarting, "carol", "deploy"); err != nil {
+		t.Fatalf("Transition failed: %v", err)
+	}
+	if err := registry.Transition(agent, StatusPaused, "carol", ""); err == nil {
+		t.Error("Illegal transition should be rejected")
+	}
+
+	events, _ := registry.Events(agent.ID, EventFilter{})
+	if len(events) != 1 {
+		t.Fatalf("Expected only the legal transition to be recorded, got %d", len(events))
+	}
+	event := events[0]
+	if event.Actor != "carol" || event.Kind != EventLifecycle || event.From != "created" || event.To != "starting" || event.Reason != "deploy" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+}
+
+func TestRegistryTransitionWithoutEvents(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "unaudited", Type: AtomSpaceAgent})
+	registry.Register(agent)
+
+	// A file in place of the events directory cannot hold events
+	if err := os.WriteFile(filepath.Join(registry.Dir(), "events"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Transition(agent, StatusStarting, "erin", ""); err != nil {
+		t.Fatalf("Transition should not fail when its event cannot be recorded: %v", err)
+	}
+	if agent.Status != StatusStarting {
+		t.Errorf("Expected the agent to have moved, got %s", agent.Status)
+	}
+}
+
+func TestRegistryUnregisterRemovesEvents(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "gone", Type: AtomSpaceAgent})
+	registry.Register(agent)
+	registry.RecordEvent(Event{AgentID: agent.ID, Actor: "dave", Kind: EventLifecycle})
+
+	if err := registry.Unregister(agent.ID); err != nil {
+		t.Fatalf("Unregister failed: %v", err)
+	}
+	if _, err := os.Stat(registry.eventsPath(agent.ID)); !os.IsNotExist(err) {
+		t.Error("Unregister should remove the agent's events")
+	}
+}
+
+func TestHealthChecksRecordEvents(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "silent", Type: AtomSpaceAgent})
+	agent.Status = StatusRunning
+	agent.Metrics = &AgentMetrics{LastHeartbeat: time.Now().Add(-time.Hour)}
+	registry.Register(agent)
+
+	NewOrchestrator(registry).performHealthChecks()
+
+	events, _ := registry.Events(agent.ID, EventFilter{Kind: EventLifecycle})
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 lifecycle event, got %d", len(events))
+	}
+	if events[0].Actor != ActorOrchestrator || events[0].To != string(StatusError) {
+		t.Errorf("Unexpected event %+v", events[0])
+	}
+}
@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package opencog
+
+// lockFile does not lock on windows, where agent processes and the daemon
+// are not supported; writes are still atomic
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,416 @@
+package opencog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/github/hub/v2/github"
+)
+
+// GitHubID is the recipient of the commands agents send to act on GitHub.
+// Rules of openpsi agents name it as the agent of their action.
+const GitHubID = "github"
+
+// Actions agents may take on GitHub
+const (
+	GitHubComment       = "comment"
+	GitHubLabel         = "label"
+	GitHubCreateIssue   = "create_issue"
+	GitHubUpdateIssue   = "update_issue"
+	GitHubCreateRelease = "create_release"
+	// GitHubCreateGist creates a gist, which belongs to no repository
+	GitHubCreateGist = "create_gist"
+)
+
+// GitHubActions lists the actions agents may be granted
+var GitHubActions = []string{GitHubComment, GitHubLabel, GitHubCreateIssue, GitHubUpdateIssue, GitHubCreateRelease, GitHubCreateGist}
+
+// githubOptions grant agents of any type actions on GitHub
+var githubOptions = []ConfigOption{
+	{Key: "github_actions", Type: OptionString, check: checkGitHubActions,
+		Description: "Comma-separated actions the agent may take on GitHub: " + strings.Join(GitHubActions, ", ")},
+	{Key: "github_repositories", Type: OptionString, check: checkGitHubRepositories,
+		Description: "Comma-separated repositories the agent may act on, such as github/hub or github/*"},
+	{Key: "github_dry_run", Type: OptionBool,
+		Description: "Record the agent's actions on GitHub without taking them"},
+}
+
+func checkGitHubActions(value interface{}) error {
+	for _, action := range splitList(value.(string)) {
+		if !containsString(GitHubActions, action) {
+			return fmt.Errorf("unknown action %q, expected %s", action, strings.Join(GitHubActions, ", "))
+		}
+	}
+	return nil
+}
+
+func checkGitHubRepositories(value interface{}) error {
+	for _, pattern := range splitList(value.(string)) {
+		if strings.Count(pattern, "/") != 1 {
+			return fmt.Errorf("expected repositories as OWNER/NAME, got %q", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid repository pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GitHubGrant is what an agent may do on GitHub
+type GitHubGrant struct {
+	Actions []string `json:"actions"`
+	// Repositories are the full names of the repositories the agent may act
+	// on, or patterns such as github/* matching them
+	Repositories []string `json:"repositories"`
+	// DryRun records actions without taking them
+	DryRun bool `json:"dry_run"`
+}
+
+// GitHubGrant returns what the agent was granted on GitHub. Agents are
+// granted nothing unless they are configured to.
+func (a *Agent) GitHubGrant() *GitHubGrant {
+	return &GitHubGrant{
+		Actions:      splitList(a.ConfigString("github_actions")),
+		Repositories: splitList(a.ConfigString("github_repositories")),
+		DryRun:       a.ConfigBool("github_dry_run"),
+	}
+}
+
+// Allows returns an error unless the grant allows action on repository.
+// Gists are allowed on no repository.
+func (g *GitHubGrant) Allows(action, repository string) error {
+	if !containsString(g.Actions, action) {
+		return fmt.Errorf("%s is not granted", action)
+	}
+	if action == GitHubCreateGist {
+		return nil
+	}
+	for _, pattern := range g.Repositories {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(repository)); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("repository %s is not granted", repository)
+}
+
+// GitHubRequest is the payload of a command asking to act on GitHub
+type GitHubRequest struct {
+	Action string `json:"action"`
+	// Repository is the full name of the repository, such as github/hub
+	Repository string `json:"repository"`
+	// Number is the issue or pull request commented, labeled or updated
+	Number int      `json:"number,omitempty"`
+	Title  string   `json:"title,omitempty"`
+	Body   string   `json:"body,omitempty"`
+	State  string   `json:"state,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+	// Tag, Target, Name, Draft and Prerelease describe a release
+	Tag        string `json:"tag,omitempty"`
+	Target     string `json:"target,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Draft      bool   `json:"draft,omitempty"`
+	Prerelease bool   `json:"prerelease,omitempty"`
+	// Filename names the file of a gist holding Body, and Public makes
+	// the gist public
+	Filename string `json:"filename,omitempty"`
+	Public   bool   `json:"public,omitempty"`
+}
+
+// ParseGitHubRequest reads the payload of a command asking to act on GitHub
+func ParseGitHubRequest(payload map[string]interface{}) (*GitHubRequest, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub request: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	req := &GitHubRequest{}
+	if err := decoder.Decode(req); err != nil {
+		return nil, fmt.Errorf("invalid GitHub request: %w", err)
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Validate checks that the request has what its action needs
+func (r *GitHubRequest) Validate() error {
+	if !containsString(GitHubActions, r.Action) {
+		return fmt.Errorf("unknown GitHub action %q, expected one of %s", r.Action, strings.Join(GitHubActions, ", "))
+	}
+	if r.Action == GitHubCreateGist {
+		if r.Body == "" {
+			return fmt.Errorf("create_gist: no body")
+		}
+		if r.Filename != "" && (r.Filename != filepath.Base(r.Filename) || r.Filename == "." || r.Filename == "..") {
+			return fmt.Errorf("create_gist: invalid filename %q", r.Filename)
+		}
+		return nil
+	}
+	if strings.Count(r.Repository, "/") != 1 || strings.HasPrefix(r.Repository, "/") || strings.HasSuffix(r.Repository, "/") {
+		return fmt.Errorf("%s: expected a repository as OWNER/NAME, got %q", r.Action, r.Repository)
+	}
+
+	switch r.Action {
+	case GitHubComment, GitHubLabel, GitHubUpdateIssue:
+		if r.Number <= 0 {
+			return fmt.Errorf("%s: no issue or pull request number", r.Action)
+		}
+	}
+	switch r.Action {
+	case GitHubComment:
+		if r.Body == "" {
+			return fmt.Errorf("comment: no body")
+		}
+	case GitHubLabel:
+		if len(r.Labels) == 0 {
+			return fmt.Errorf("label: no labels")
+		}
+	case GitHubCreateIssue:
+		if r.Title == "" {
+			return fmt.Errorf("create_issue: no title")
+		}
+	case GitHubUpdateIssue:
+		if r.Title == "" && r.Body == "" && r.State == "" && r.Labels == nil {
+			return fmt.Errorf("update_issue: nothing to update")
+		}
+		if r.State != "" && r.State != "open" && r.State != "closed" {
+			return fmt.Errorf("update_issue: expected state open or closed, got %q", r.State)
+		}
+	case GitHubCreateRelease:
+		if r.Tag == "" {
+			return fmt.Errorf("create_release: no tag")
+		}
+	}
+	return nil
+}
+
+// String describes the request, as recorded in the audit trail
+func (r *GitHubRequest) String() string {
+	switch r.Action {
+	case GitHubComment:
+		return fmt.Sprintf("comment on %s#%d", r.Repository, r.Number)
+	case GitHubLabel:
+		return fmt.Sprintf("label %s#%d %s", r.Repository, r.Number, strings.Join(r.Labels, ", "))
+	case GitHubCreateIssue:
+		return fmt.Sprintf("create issue in %s", r.Repository)
+	case GitHubUpdateIssue:
+		return fmt.Sprintf("update %s#%d", r.Repository, r.Number)
+	case GitHubCreateRelease:
+		return fmt.Sprintf("create release %s in %s", r.Tag, r.Repository)
+	case GitHubCreateGist:
+		return "create gist " + r.gistFilename()
+	}
+	return r.Action + " " + r.Repository
+}
+
+// gistFilename returns the name of the file of a gist
+func (r *GitHubRequest) gistFilename() string {
+	if r.Filename != "" {
+		return r.Filename
+	}
+	return "gistfile1.md"
+}
+
+// GitHubClient is the part of github.Client agents act through
+type GitHubClient interface {
+	CreateComment(project *github.Project, issueNumber int, body string) (*github.Comment, error)
+	AddLabels(project *github.Project, issueNumber int, labels []string) error
+	CreateIssue(project *github.Project, params interface{}) (*github.Issue, error)
+	UpdateIssue(project *github.Project, issueNumber int, params map[string]interface{}) error
+	CreateRelease(project *github.Project, release *github.Release) (*github.Release, error)
+	CreateGist(filenames []string, public bool) (*github.Gist, error)
+}
+
+// HostGitHub hosts the recipient of the commands agents send to act on
+// GitHub through client. Each command is checked against the grant of the
+// agent sending it, and recorded in the agent's events whether it is taken,
+// dry-run, denied or failed. Commands forwarded on behalf of another agent,
+// such as by a broker, must be allowed by the grants of both agents, and are
+// recorded in the events of the agent they were forwarded for.
+func (o *Orchestrator) HostGitHub(client GitHubClient) error {
+	return o.Host(GitHubID, &githubBehavior{registry: o.registry, client: client})
+}
+
+// githubBehavior takes the actions agents command on GitHub
+type githubBehavior struct {
+	registry *Registry
+	client   GitHubClient
+}
+
+func (b *githubBehavior) HandleMessage(msg *Message) (*Message, error) {
+	if msg.Type != MessageTypeCommand {
+		return nil, fmt.Errorf("GitHub does not handle %s messages", msg.Type)
+	}
+	// Grants are read anew, so that revoking them takes effect right away
+	sender, err := b.registry.Get(msg.From)
+	if err != nil {
+		return nil, fmt.Errorf("only agents may act on GitHub")
+	}
+	agent, grantees := sender, []*Agent{sender}
+	if msg.OnBehalfOf != "" && msg.OnBehalfOf != msg.From {
+		agent, err = b.registry.Get(msg.OnBehalfOf)
+		if err != nil {
+			return nil, fmt.Errorf("only agents may act on GitHub")
+		}
+		grantees = append(grantees, agent)
+	}
+
+	req, err := ParseGitHubRequest(msg.Payload)
+	if err != nil {
+		b.record(agent, sender, nil, "denied: "+err.Error())
+		return nil, err
+	}
+	dryRun := false
+	for _, grantee := range grantees {
+		grant := grantee.GitHubGrant()
+		if err := grant.Allows(req.Action, req.Repository); err != nil {
+			b.record(agent, sender, req, "denied: "+err.Error())
+			return nil, fmt.Errorf("agent %s may not %s: %w", grantee.Name, req, err)
+		}
+		dryRun = dryRun || grant.DryRun
+	}
+
+	result := map[string]interface{}{"action": req.Action}
+	if req.Repository != "" {
+		result["repository"] = req.Repository
+	}
+	if dryRun {
+		result["dry_run"] = true
+		if err := b.record(agent, sender, req, "dry run"); err != nil {
+			return nil, err
+		}
+		return &Message{Type: MessageTypeResponse, Payload: result}, nil
+	}
+
+	url, err := b.perform(req, result)
+	if err != nil {
+		b.record(agent, sender, req, "failed: "+err.Error())
+		return nil, err
+	}
+	if err := b.record(agent, sender, req, strings.TrimSpace("done "+url)); err != nil {
+		return nil, err
+	}
+	if url != "" {
+		result["url"] = url
+	}
+	return &Message{Type: MessageTypeResponse, Payload: result}, nil
+}
+
+// perform takes the action of req, and returns the URL of what it made or
+// changed when GitHub tells it
+func (b *githubBehavior) perform(req *GitHubRequest, result map[string]interface{}) (string, error) {
+	if req.Action == GitHubCreateGist {
+		return b.createGist(req)
+	}
+	project := github.NewProject(req.Repository, "", "")
+
+	switch req.Action {
+	case GitHubComment:
+		comment, err := b.client.CreateComment(project, req.Number, req.Body)
+		if err != nil {
+			return "", err
+		}
+		return comment.HTMLURL, nil
+	case GitHubLabel:
+		return "", b.client.AddLabels(project, req.Number, req.Labels)
+	case GitHubCreateIssue:
+		params := map[string]interface{}{"title": req.Title}
+		if req.Body != "" {
+			params["body"] = req.Body
+		}
+		if len(req.Labels) > 0 {
+			params["labels"] = req.Labels
+		}
+		issue, err := b.client.CreateIssue(project, params)
+		if err != nil {
+			return "", err
+		}
+		result["number"] = issue.Number
+		return issue.HTMLURL, nil
+	case GitHubUpdateIssue:
+		params := make(map[string]interface{})
+		for key, value := range map[string]string{"title": req.Title, "body": req.Body, "state": req.State} {
+			if value != "" {
+				params[key] = value
+			}
+		}
+		if req.Labels != nil {
+			params["labels"] = req.Labels
+		}
+		return "", b.client.UpdateIssue(project, req.Number, params)
+	case GitHubCreateRelease:
+		release, err := b.client.CreateRelease(project, &github.Release{
+			TagName:         req.Tag,
+			TargetCommitish: req.Target,
+			Name:            req.Name,
+			Body:            req.Body,
+			Draft:           req.Draft,
+			Prerelease:      req.Prerelease,
+		})
+		if err != nil {
+			return "", err
+		}
+		return release.HTMLURL, nil
+	}
+	return "", fmt.Errorf("unknown GitHub action %q", req.Action)
+}
+
+// createGist creates a gist of the body of req. The client reads gists from
+// files, so the body is written to one named after the gist's file first.
+func (b *githubBehavior) createGist(req *GitHubRequest) (string, error) {
+	dir, err := os.MkdirTemp("", "hub-gist")
+	if err != nil {
+		return "", fmt.Errorf("failed to write gist: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, req.gistFilename())
+	if err := os.WriteFile(file, []byte(req.Body), 0600); err != nil {
+		return "", fmt.Errorf("failed to write gist: %w", err)
+	}
+	gist, err := b.client.CreateGist([]string{file}, req.Public)
+	if err != nil {
+		return "", err
+	}
+	return gist.HTMLURL, nil
+}
+
+// record adds an action of agent, taken by actor, to its events. Requests
+// too malformed to be described are recorded without one.
+func (b *githubBehavior) record(agent, actor *Agent, req *GitHubRequest, outcome string) error {
+	event := Event{AgentID: agent.ID, Actor: actor.Name, Kind: EventGitHub, Reason: outcome}
+	if req != nil {
+		event.To = req.String()
+	}
+	if err := b.registry.RecordEvent(event); err != nil {
+		return fmt.Errorf("failed to record GitHub action: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package opencog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/hub/v2/github"
+)
+
+// fakeGitHub records the calls agents make instead of making them
+type fakeGitHub struct {
+	calls []string
+}
+
+func (f *fakeGitHub) CreateComment(project *github.Project, issueNumber int, body string) (*github.Comment, error) {
+	f.calls = append(f.calls, fmt.Sprintf("comment %s#%d %s", project, issueNumber, body))
+	return &github.Comment{HTMLURL: fmt.Sprintf("https://github.com/%s/issues/%d#issuecomment-1", project, issueNumber)}, nil
+}
+
+func (f *fakeGitHub) AddLabels(project *github.Project, issueNumber int, labels []string) error {
+	f.calls = append(f.calls, fmt.Sprintf("label %s#%d %s", project, issueNumber, strings.Join(labels, ",")))
+	return nil
+}
+
+func (f *fakeGitHub) CreateIssue(project *github.Project, params interface{}) (*github.Issue, error) {
+	f.calls = append(f.calls, fmt.Sprintf("create issue %s %v", project, params))
+	return &github.Issue{Number: 7}, nil
+}
+
+func (f *fakeGitHub) UpdateIssue(project *github.Project, issueNumber int, params map[string]interface{}) error {
+	f.calls = append(f.calls, fmt.Sprintf("update %s#%d %v", project, issueNumber, params))
+	return nil
+}
+
+func (f *fakeGitHub) CreateRelease(project *github.Project, release *github.Release) (*github.Release, error) {
+	return nil, fmt.Errorf("tag %s already has a release", release.TagName)
+}
+
+func (f *fakeGitHub) CreateGist(filenames []string, public bool) (*github.Gist, error) {
+	for _, file := range filenames {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		f.calls = append(f.calls, fmt.Sprintf("gist %s %s", filepath.Base(file), content))
+	}
+	return &github.Gist{HTMLURL: "https://gist.github.com/1"}, nil
+}
+
+func TestGitHubGrantOptions(t *testing.T) {
+	agent, err := NewAgent(AgentConfig{Name: "triage", Type: ECANAgent, Config: map[string]interface{}{
+		"github_actions":      "comment, label",
+		"github_repositories": "github/hub,octocat/*",
+		"github_dry_run":      "true",
+	}})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+	grant := agent.GitHubGrant()
+	if strings.Join(grant.Actions, ",") != "comment,label" || len(grant.Repositories) != 2 || !grant.DryRun {
+		t.Errorf("Unexpected grant %+v", grant)
+	}
+	if err := grant.Allows(GitHubComment, "GitHub/Hub"); err != nil {
+		t.Errorf("Expected comments on github/hub to be allowed, got %v", err)
+	}
+	if err := grant.Allows(GitHubLabel, "octocat/hello-world"); err != nil {
+		t.Errorf("Expected labels in octocat's repositories to be allowed, got %v", err)
+	}
+	if err := grant.Allows(GitHubCreateRelease, "github/hub"); err == nil {
+		t.Error("Expected releases not to be allowed")
+	}
+	if err := grant.Allows(GitHubComment, "github/other"); err == nil {
+		t.Error("Expected comments on github/other not to be allowed")
+	}
+
+	if _, err := agent.UpdateConfig(map[string]interface{}{"github_actions": "comment,merge"}, nil); err == nil || !strings.Contains(err.Error(), "merge") {
+		t.Errorf("Expected an unknown action to be refused, got %v", err)
+	}
+	if _, err := agent.UpdateConfig(map[string]interface{}{"github_repositories": "hub"}, nil); err == nil {
+		t.Error("Expected a repository without an owner to be refused")
+	}
+
+	if grant := (&Agent{Type: CustomAgent}).GitHubGrant(); len(grant.Actions) != 0 || grant.DryRun {
+		t.Errorf("Expected agents to be granted nothing by default, got %+v", grant)
+	}
+
+	schema := &ConfigSchema{Options: []ConfigOption{{Key: "github_actions"}}}
+	if err := schema.validate(); err == nil {
+		t.Error("Expected types declaring a common option to be refused")
+	}
+}
+
+func TestGitHubActions(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "triage", Type: CustomAgent, Config: map[string]interface{}{
+		"github_actions":      "comment,label,create_issue,create_release",
+		"github_repositories": "github/hub",
+	}})
+	registry.Register(agent)
+
+	fake := &fakeGitHub{}
+	orchestrator := NewOrchestrator(registry)
+	if err := orchestrator.HostGitHub(fake); err != nil {
+		t.Fatalf("HostGitHub failed: %v", err)
+	}
+	orchestrator.RegisterAgent(agent.ID)
+	orchestrator.RegisterAgent("cli")
+
+	send := func(from string, payload map[string]interface{}) (*Message, error) {
+		return orchestrator.Request(&Message{From: from, To: GitHubID, Type: MessageTypeCommand, Payload: payload}, time.Second)
+	}
+
+	reply, err := send(agent.ID, map[string]interface{}{"action": "comment", "repository": "github/hub", "number": 42.0, "body": "Thanks!"})
+	if err != nil {
+		t.Fatalf("Comment failed: %v", err)
+	}
+	if reply.Payload["url"] != "https://github.com/github/hub/issues/42#issuecomment-1" {
+		t.Errorf("Unexpected reply %v", reply.Payload)
+	}
+	if _, err := send(agent.ID, map[string]interface{}{"action": "label", "repository": "github/hub", "number": 42, "labels": []interface{}{"bug"}}); err != nil {
+		t.Fatalf("Label failed: %v", err)
+	}
+	reply, err = send(agent.ID, map[string]interface{}{"action": "create_issue", "repository": "github/hub", "title": "Flaky test"})
+	if err != nil || reply.Payload["number"] != 7 {
+		t.Fatalf("Unexpected create_issue reply %v, %v", reply, err)
+	}
+
+	if _, err := send(agent.ID, map[string]interface{}{"action": "comment", "repository": "github/other", "number": 1, "body": "Hi"}); err == nil || !strings.Contains(err.Error(), "not granted") {
+		t.Errorf("Expected a comment on another repository to be denied, got %v", err)
+	}
+	if _, err := send(agent.ID, map[string]interface{}{"action": "update_issue", "repository": "github/hub", "number": 1, "state": "closed"}); err == nil {
+		t.Error("Expected an action that was not granted to be denied")
+	}
+	if _, err := send(agent.ID, map[string]interface{}{"action": "comment", "repository": "github/hub", "number": 1}); err == nil {
+		t.Error("Expected a comment without a body to be refused")
+	}
+	if _, err := send(agent.ID, map[string]interface{}{"action": "create_release", "repository": "github/hub", "tag": "v1.0"}); err == nil || !strings.Contains(err.Error(), "already") {
+		t.Errorf("Expected the failure of GitHub to be reported, got %v", err)
+	}
+	if _, err := send("cli", map[string]interface{}{"action": "comment", "repository": "github/hub", "number": 1, "body": "Hi"}); err == nil {
+		t.Error("Expected commands from other than agents to be refused")
+	}
+
+	if len(fake.calls) != 3 || fake.calls[0] != "comment github/hub#42 Thanks!" || fake.calls[1] != "label github/hub#42 bug" {
+		t.Errorf("Unexpected calls %v", fake.calls)
+	}
+
+	// Dry runs are recorded, not taken
+	agent.UpdateConfig(map[string]interface{}{"github_dry_run": true}, nil)
+	registry.Update(agent)
+	reply, err = send(agent.ID, map[string]interface{}{"action": "label", "repository": "github/hub", "number": 3, "labels": []interface{}{"triage"}})
+	if err != nil || reply.Payload["dry_run"] != true {
+		t.Fatalf("Unexpected dry run reply %v, %v", reply, err)
+	}
+	if len(fake.calls) != 3 {
+		t.Errorf("Expected a dry run not to call GitHub, got %v", fake.calls)
+	}
+
+	events, _ := registry.Events(agent.ID, EventFilter{Kind: EventGitHub})
+	var outcomes []string
+	for _, event := range events {
+		outcome := event.Reason
+		if i := strings.IndexAny(outcome, " :"); i > 0 {
+			outcome = outcome[:i]
+		}
+		outcomes = append(outcomes, outcome)
+		if event.Actor != "triage" {
+			t.Errorf("Expected events to be made by the agent, got %+v", event)
+		}
+	}
+	if got := strings.Join(outcomes, ","); got != "done,done,done,denied,denied,denied,failed,dry" {
+		t.Errorf("Unexpected outcomes %s", got)
+	}
+	if events[0].To != "comment on github/hub#42" || !strings.HasSuffix(events[0].Reason, "#issuecomment-1") {
+		t.Errorf("Unexpected event %+v", events[0])
+	}
+}
+
+func TestGitHubGist(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "mirror", Type: CustomAgent, Config: map[string]interface{}{
+		"github_actions": "create_gist",
+	}})
+	registry.Register(agent)
+
+	fake := &fakeGitHub{}
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.HostGitHub(fake)
+	orchestrator.RegisterAgent(agent.ID)
+
+	send := func(payload map[string]interface{}) (*Message, error) {
+		return orchestrator.Request(&Message{From: agent.ID, To: GitHubID, Type: MessageTypeCommand, Payload: payload}, time.Second)
+	}
+	reply, err := send(map[string]interface{}{"action": "create_gist", "filename": "report.md", "body": "# Report"})
+	if err != nil {
+		t.Fatalf("Gist failed: %v", err)
+	}
+	if reply.Payload["url"] != "https://gist.github.com/1" || len(fake.calls) != 1 || fake.calls[0] != "gist report.md # Report" {
+		t.Errorf("Unexpected reply %v and calls %v", reply.Payload, fake.calls)
+	}
+	if _, err := send(map[string]interface{}{"action": "create_gist", "filename": "../report.md", "body": "# Report"}); err == nil {
+		t.Error("Expected a gist filename outside of the gist to be refused")
+	}
+}
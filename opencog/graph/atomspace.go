@@ -0,0 +1,68 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// OutgoingEdge is the kind of the edges from links to their outgoing atoms
+const OutgoingEdge = "outgoing"
+
+// AtomSpace returns the graph of the given atoms and the atoms they link,
+// or of the whole AtomSpace if handles is empty. Every atom is a node, and
+// each link has an edge to each of its outgoing atoms, numbered by position
+// when there are several.
+func AtomSpace(name string, space *atomspace.AtomSpace, handles []atomspace.Handle) (*Graph, error) {
+	if len(handles) == 0 {
+		handles = space.Handles()
+	}
+
+	g := &Graph{Name: name}
+	seen := make(map[atomspace.Handle]bool)
+	var add func(h atomspace.Handle) error
+	add = func(h atomspace.Handle) error {
+		if seen[h] {
+			return nil
+		}
+		seen[h] = true
+		atom, ok := space.Get(h)
+		if !ok {
+			return fmt.Errorf("unknown atom %d", h)
+		}
+
+		id := atomID(h)
+		label := string(atom.Type)
+		if atom.IsNode() {
+			label += " " + strconv.Quote(atom.Name)
+		}
+		if atom.TV != atomspace.DefaultTruthValue {
+			label += fmt.Sprintf(" (stv %g %g)", atom.TV.Strength, atom.TV.Confidence)
+		}
+		g.AddNode(Node{ID: id, Label: label, Kind: string(atom.Type)})
+
+		for i, child := range atom.Outgoing {
+			if err := add(child); err != nil {
+				return err
+			}
+			edge := Edge{From: id, To: atomID(child), Kind: OutgoingEdge}
+			if len(atom.Outgoing) > 1 {
+				edge.Label = strconv.Itoa(i + 1)
+			}
+			g.AddEdge(edge)
+		}
+		return nil
+	}
+
+	for _, h := range handles {
+		if err := add(h); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func atomID(h atomspace.Handle) string {
+	return fmt.Sprintf("atom%d", h)
+}
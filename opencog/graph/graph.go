@@ -0,0 +1,244 @@
+// Package graph renders directed graphs as Graphviz DOT, GraphML or Mermaid,
+// so that agent topologies and knowledge can be drawn in docs and pull
+// requests.
+package graph
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Node is a vertex of a graph
+type Node struct {
+	ID    string
+	Label string
+	// Kind groups nodes drawn alike, such as agents of one type
+	Kind string
+}
+
+// Edge is a directed edge of a graph
+type Edge struct {
+	From  string
+	To    string
+	Label string
+	// Kind groups edges drawn alike. Edges of kinds listed in a graph's
+	// Dashed are drawn dashed.
+	Kind string
+	// Weight, when positive, makes the edge thicker relative to the other
+	// weighted edges of the graph
+	Weight float64
+}
+
+// Graph is a directed graph
+type Graph struct {
+	Name  string
+	Nodes []Node
+	Edges []Edge
+	// Dashed lists the kinds of edges drawn dashed
+	Dashed []string
+
+	nodes map[string]bool
+}
+
+// AddNode adds a node unless the graph already has one with the same ID
+func (g *Graph) AddNode(node Node) {
+	if g.nodes == nil {
+		g.nodes = make(map[string]bool)
+		for _, n := range g.Nodes {
+			g.nodes[n.ID] = true
+		}
+	}
+	if g.nodes[node.ID] {
+		return
+	}
+	g.nodes[node.ID] = true
+	g.Nodes = append(g.Nodes, node)
+}
+
+// AddEdge adds an edge
+func (g *Graph) AddEdge(edge Edge) {
+	g.Edges = append(g.Edges, edge)
+}
+
+func (g *Graph) dashed(edge Edge) bool {
+	for _, kind := range g.Dashed {
+		if edge.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// width returns the stroke width of an edge, between 1 and 5 for weighted
+// edges
+func (g *Graph) width(edge Edge) float64 {
+	if edge.Weight <= 0 {
+		return 1
+	}
+	max := 0.0
+	for _, e := range g.Edges {
+		max = math.Max(max, e.Weight)
+	}
+	return 1 + 4*math.Log1p(edge.Weight)/math.Log1p(max)
+}
+
+// Format is a graph file format
+type Format string
+
+const (
+	DOT     Format = "dot"
+	GraphML Format = "graphml"
+	Mermaid Format = "mermaid"
+)
+
+// Formats lists the supported formats
+var Formats = []Format{DOT, GraphML, Mermaid}
+
+// ParseFormat returns the format named s
+func ParseFormat(s string) (Format, error) {
+	for _, format := range Formats {
+		if strings.EqualFold(s, string(format)) {
+			return format, nil
+		}
+	}
+	names := make([]string, len(Formats))
+	for i, format := range Formats {
+		names[i] = string(format)
+	}
+	return "", fmt.Errorf("unknown graph format %q, expected one of %s", s, strings.Join(names, ", "))
+}
+
+// Write renders g to w in format
+func Write(w io.Writer, g *Graph, format Format) error {
+	switch format {
+	case DOT:
+		return writeDOT(w, g)
+	case GraphML:
+		return writeGraphML(w, g)
+	case Mermaid:
+		return writeMermaid(w, g)
+	}
+	return fmt.Errorf("unknown graph format %q", format)
+}
+
+func writeDOT(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotID(g.Name))
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s [label=%s", dotID(n.ID), dotID(n.Label))
+		if n.Kind != "" {
+			fmt.Fprintf(&b, ", class=%s", dotID(n.Kind))
+		}
+		b.WriteString("];\n")
+	}
+	for _, e := range g.Edges {
+		var attrs []string
+		if e.Label != "" {
+			attrs = append(attrs, "label="+dotID(e.Label))
+		}
+		if g.dashed(e) {
+			attrs = append(attrs, "style=dashed")
+		}
+		if e.Weight > 0 {
+			attrs = append(attrs, fmt.Sprintf("weight=%g", e.Weight), fmt.Sprintf("penwidth=%.1f", g.width(e)))
+		}
+		fmt.Fprintf(&b, "  %s -> %s", dotID(e.From), dotID(e.To))
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(attrs, ", "))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotID(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func writeGraphML(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	for _, key := range []struct{ id, domain, name, typ string }{
+		{"label", "node", "label", "string"},
+		{"kind", "node", "kind", "string"},
+		{"elabel", "edge", "label", "string"},
+		{"ekind", "edge", "kind", "string"},
+		{"weight", "edge", "weight", "double"},
+	} {
+		fmt.Fprintf(&b, `  <key id="%s" for="%s" attr.name="%s" attr.type="%s"/>`+"\n", key.id, key.domain, key.name, key.typ)
+	}
+	fmt.Fprintf(&b, `  <graph id=%s edgedefault="directed">`+"\n", xmlAttr(g.Name))
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "    <node id=%s>\n", xmlAttr(n.ID))
+		fmt.Fprintf(&b, `      <data key="label">%s</data>`+"\n", xmlText(n.Label))
+		if n.Kind != "" {
+			fmt.Fprintf(&b, `      <data key="kind">%s</data>`+"\n", xmlText(n.Kind))
+		}
+		b.WriteString("    </node>\n")
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(&b, "    <edge id=\"e%d\" source=%s target=%s>\n", i, xmlAttr(e.From), xmlAttr(e.To))
+		if e.Label != "" {
+			fmt.Fprintf(&b, `      <data key="elabel">%s</data>`+"\n", xmlText(e.Label))
+		}
+		if e.Kind != "" {
+			fmt.Fprintf(&b, `      <data key="ekind">%s</data>`+"\n", xmlText(e.Kind))
+		}
+		if e.Weight > 0 {
+			fmt.Fprintf(&b, `      <data key="weight">%g</data>`+"\n", e.Weight)
+		}
+		b.WriteString("    </edge>\n")
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func xmlAttr(s string) string {
+	return `"` + xmlText(s) + `"`
+}
+
+func writeMermaid(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+
+	// Mermaid IDs cannot hold arbitrary characters, so nodes are numbered
+	ids := make(map[string]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "  %s[%s]\n", ids[n.ID], mermaidText(n.Label))
+	}
+	var styles []string
+	for i, e := range g.Edges {
+		arrow := "-->"
+		if g.dashed(e) {
+			arrow = "-.->"
+		}
+		if e.Label != "" {
+			arrow += "|" + mermaidText(e.Label) + "|"
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", ids[e.From], arrow, ids[e.To])
+		if e.Weight > 0 {
+			styles = append(styles, fmt.Sprintf("  linkStyle %d stroke-width:%.1fpx\n", i, g.width(e)))
+		}
+	}
+	b.WriteString(strings.Join(styles, ""))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func mermaidText(s string) string {
+	return `"` + strings.NewReplacer(`"`, "#quot;", "\n", " ", "|", "#124;").Replace(s) + `"`
+}
@@ -0,0 +1,118 @@
+package graph
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+func sample() *Graph {
+	g := &Graph{Name: "agents", Dashed: []string{"dependency"}}
+	g.AddNode(Node{ID: "a", Label: `say "hi"`, Kind: "pln"})
+	g.AddNode(Node{ID: "b", Label: "kb <atoms>", Kind: "atomspace"})
+	g.AddNode(Node{ID: "a", Label: "duplicate"})
+	g.AddEdge(Edge{From: "a", To: "b", Label: "atomspace", Kind: "dependency"})
+	g.AddEdge(Edge{From: "a", To: "b", Label: "10 messages", Kind: "message", Weight: 10})
+	g.AddEdge(Edge{From: "b", To: "a", Label: "1 message", Kind: "message", Weight: 1})
+	return g
+}
+
+func render(t *testing.T, g *Graph, format Format) string {
+	t.Helper()
+	var b strings.Builder
+	if err := Write(&b, g, format); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	return b.String()
+}
+
+func TestDOT(t *testing.T) {
+	out := render(t, sample(), DOT)
+	for _, want := range []string{
+		`digraph "agents" {`,
+		`"a" [label="say \"hi\"", class="pln"];`,
+		`"a" -> "b" [label="atomspace", style=dashed];`,
+		`"a" -> "b" [label="10 messages", weight=10, penwidth=5.0];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %s in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "duplicate") {
+		t.Error("Nodes should be added once")
+	}
+}
+
+func TestGraphML(t *testing.T) {
+	out := render(t, sample(), GraphML)
+	var doc struct {
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+		} `xml:"graph>edge"`
+	}
+	if err := xml.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("GraphML should be valid XML: %v\n%s", err, out)
+	}
+	if len(doc.Nodes) != 2 || len(doc.Edges) != 3 {
+		t.Errorf("Expected 2 nodes and 3 edges, got %+v", doc)
+	}
+	if !strings.Contains(out, `<data key="label">kb &lt;atoms&gt;</data>`) {
+		t.Errorf("Labels should be escaped:\n%s", out)
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	out := render(t, sample(), Mermaid)
+	for _, want := range []string{
+		"flowchart LR\n",
+		`n0["say #quot;hi#quot;"]`,
+		`n0 -.->|"atomspace"| n1`,
+		`n1 -->|"1 message"| n0`,
+		"linkStyle 1 stroke-width:5.0px",
+		"linkStyle 2 stroke-width:2.2px",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %s in:\n%s", want, out)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if format, err := ParseFormat("GraphML"); err != nil || format != GraphML {
+		t.Errorf("Expected graphml, got %v, %v", format, err)
+	}
+	if _, err := ParseFormat("svg"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestAtomSpace(t *testing.T) {
+	space := atomspace.New()
+	handles, err := space.ImportScheme(strings.NewReader(`
+(InheritanceLink (stv 0.9 0.8) (ConceptNode "cat") (ConceptNode "animal"))
+(NotLink (ConceptNode "dog"))`))
+	if err != nil {
+		t.Fatalf("ImportScheme failed: %v", err)
+	}
+
+	g, err := AtomSpace("kb", space, handles[:1])
+	if err != nil {
+		t.Fatalf("AtomSpace failed: %v", err)
+	}
+	if len(g.Nodes) != 3 || g.Nodes[0].Label != "InheritanceLink (stv 0.9 0.8)" || g.Nodes[1].Label != `ConceptNode "cat"` {
+		t.Errorf("Expected the link and its atoms, got %+v", g.Nodes)
+	}
+	if len(g.Edges) != 2 || g.Edges[1].Label != "2" {
+		t.Errorf("Expected numbered edges to the outgoing atoms, got %+v", g.Edges)
+	}
+
+	all, _ := AtomSpace("kb", space, nil)
+	if len(all.Nodes) != space.Size() {
+		t.Errorf("Expected every atom without handles, got %d of %d", len(all.Nodes), space.Size())
+	}
+}
@@ -0,0 +1,362 @@
+// Package ingest turns a git repository and its GitHub project into Atomese.
+//
+// Every entity is a ConceptNode named after its kind, such as
+// (ConceptNode "commit:<sha>"), "author:<email>", "file:<path>",
+// "branch:<name>", "issue:<number>", "pull:<number>", "user:<login>",
+// "label:<name>" and "release:<tag>", and is declared an instance of its kind
+// with (InheritanceLink (ConceptNode "commit:<sha>") (ConceptNode "commit")).
+// Relations are EvaluationLinks such as
+// (EvaluationLink (PredicateNode "changes") (ListLink <commit> <file>)).
+//
+// Relations that can stop holding, such as the head of a branch or the state
+// of an issue, carry an explicit truth value: (stv 1 1) while they hold, and
+// (stv 0 1) once they no longer do.
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/github/hub/v2/git"
+	"github.com/github/hub/v2/github"
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// Relations between entities
+const (
+	Authored = "authored" // author, commit
+	Parent   = "parent"   // commit, parent commit
+	Changes  = "changes"  // commit, file
+	Head     = "head"     // branch, commit
+	Title    = "title"    // commit, issue, pull or release, its title
+	Opened   = "opened"   // user, issue or pull
+	State    = "state"    // issue or pull, open, closed or merged
+	Labeled  = "labeled"  // issue or pull, label
+	Targets  = "targets"  // release, branch or commit
+)
+
+var (
+	holds       = atomspace.TruthValue{Strength: 1, Confidence: 1}
+	holdsNoMore = atomspace.TruthValue{Strength: 0, Confidence: 1}
+)
+
+// states are the states of issues and pull requests
+var states = []string{"open", "closed", "merged"}
+
+// Progress records what was ingested from a repository, so that the next
+// ingestion only reads what changed since
+type Progress struct {
+	// Branches maps the local branches ingested to their head
+	Branches map[string]string `json:"branches,omitempty"`
+	// IssuesSince is when the most recently updated issue ingested was
+	// updated
+	IssuesSince time.Time `json:"issues_since"`
+	Time        time.Time `json:"time"`
+}
+
+// Batch is the result of reading a repository
+type Batch struct {
+	Atoms        []atomspace.Tree
+	Commits      int
+	Branches     int
+	Issues       int
+	PullRequests int
+	Labels       int
+	Releases     int
+	// Progress is what will have been ingested once the atoms are stored
+	Progress *Progress
+}
+
+// Read reads the repository in the current directory, and the issues, pull
+// requests, labels and releases of project unless it is nil, skipping what
+// previous already covers. previous may be nil to read everything.
+func Read(previous *Progress, project *github.Project, client *github.Client) (*Batch, error) {
+	if previous == nil {
+		previous = &Progress{}
+	}
+	batch := &Batch{Progress: &Progress{Branches: make(map[string]string), IssuesSince: previous.IssuesSince, Time: time.Now()}}
+
+	branches, err := git.LocalBranches()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+	var revisions []string
+	for _, branch := range branches {
+		if strings.HasPrefix(branch, "(") {
+			// A detached HEAD
+			continue
+		}
+		sha, err := git.Ref("refs/heads/" + branch)
+		if err != nil {
+			return nil, err
+		}
+		batch.Progress.Branches[branch] = sha
+		revisions = append(revisions, sha)
+	}
+	batch.Branches = len(batch.Progress.Branches)
+	for _, sha := range previous.Branches {
+		// Commits ingested before are left out, unless they were lost to a
+		// rebase or a deleted branch
+		if git.Quiet("cat-file", "-e", sha+"^{commit}") {
+			revisions = append(revisions, "^"+sha)
+		}
+	}
+
+	if batch.Branches > 0 {
+		commits, err := git.Commits(revisions...)
+		if err != nil {
+			return nil, err
+		}
+		for _, commit := range commits {
+			batch.Atoms = append(batch.Atoms, Commit(commit)...)
+		}
+		batch.Commits = len(commits)
+	}
+	batch.Atoms = append(batch.Atoms, Branches(previous.Branches, batch.Progress.Branches)...)
+
+	if project == nil {
+		return batch, nil
+	}
+
+	labels, err := client.FetchLabels(project)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range labels {
+		batch.Atoms = append(batch.Atoms, Label(label)...)
+	}
+	batch.Labels = len(labels)
+
+	filter := map[string]interface{}{"state": "all", "sort": "updated", "direction": "asc"}
+	if !previous.IssuesSince.IsZero() {
+		filter["since"] = previous.IssuesSince.Format(time.RFC3339)
+	}
+	issues, err := client.FetchIssues(project, filter, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues {
+		batch.Atoms = append(batch.Atoms, Issue(issue)...)
+		if issue.PullRequest != nil {
+			batch.PullRequests++
+		} else {
+			batch.Issues++
+		}
+		if issue.UpdatedAt.After(batch.Progress.IssuesSince) {
+			batch.Progress.IssuesSince = issue.UpdatedAt
+		}
+	}
+
+	releases, err := client.FetchReleases(project, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		batch.Atoms = append(batch.Atoms, Release(release)...)
+	}
+	batch.Releases = len(releases)
+
+	return batch, nil
+}
+
+// Commit describes a commit, its author, its parents and the files it
+// changes
+func Commit(commit git.Commit) []atomspace.Tree {
+	c := entity("commit", commit.Sha)
+	author := entity("author", commit.AuthorEmail)
+	trees := []atomspace.Tree{
+		instance(c, "commit"),
+		instance(author, "author"),
+		relation(Authored, author, c),
+		relation(Title, c, concept(commit.Subject)),
+	}
+	for _, parent := range commit.Parents {
+		trees = append(trees, relation(Parent, c, entity("commit", parent)))
+	}
+	for _, file := range commit.Files {
+		f := entity("file", file)
+		trees = append(trees, instance(f, "file"), relation(Changes, c, f))
+	}
+	return trees
+}
+
+// Branches describes the heads of branches that changed from previous to
+// current. Branches are maps from branch names to their head.
+func Branches(previous, current map[string]string) []atomspace.Tree {
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var trees []atomspace.Tree
+	for _, name := range names {
+		b := entity("branch", name)
+		old, head := previous[name], current[name]
+		if old == head {
+			continue
+		}
+		if old != "" {
+			trees = append(trees, withTV(relation(Head, b, entity("commit", old)), holdsNoMore))
+		}
+		if head != "" {
+			trees = append(trees, instance(b, "branch"), withTV(relation(Head, b, entity("commit", head)), holds))
+		}
+	}
+	return trees
+}
+
+// Issue describes an issue or pull request, who opened it, its state and its
+// labels
+func Issue(issue github.Issue) []atomspace.Tree {
+	kind, state := "issue", issue.State
+	if issue.PullRequest != nil {
+		kind = "pull"
+		if !issue.PullRequest.MergedAt.IsZero() {
+			state = "merged"
+		}
+	}
+	i := entity(kind, fmt.Sprint(issue.Number))
+	trees := []atomspace.Tree{
+		instance(i, kind),
+		relation(Title, i, concept(issue.Title)),
+	}
+	if issue.User != nil {
+		user := entity("user", issue.User.Login)
+		trees = append(trees, instance(user, "user"), relation(Opened, user, i))
+	}
+	for _, s := range states {
+		tv := holdsNoMore
+		if s == state {
+			tv = holds
+		}
+		trees = append(trees, withTV(relation(State, i, concept(s)), tv))
+	}
+	for _, label := range issue.Labels {
+		trees = append(trees, relation(Labeled, i, entity("label", label.Name)))
+	}
+	return trees
+}
+
+// Label describes a label
+func Label(label github.IssueLabel) []atomspace.Tree {
+	return []atomspace.Tree{instance(entity("label", label.Name), "label")}
+}
+
+// Release describes a release and what it was made from
+func Release(release github.Release) []atomspace.Tree {
+	r := entity("release", release.TagName)
+	trees := []atomspace.Tree{instance(r, "release")}
+	if release.Name != "" {
+		trees = append(trees, relation(Title, r, concept(release.Name)))
+	}
+	if target := release.TargetCommitish; target != "" {
+		kind := "branch"
+		if isSha(target) {
+			kind = "commit"
+		}
+		trees = append(trees, relation(Targets, r, entity(kind, target)))
+	}
+	return trees
+}
+
+func isSha(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func concept(name string) atomspace.Tree {
+	return atomspace.Tree{Type: atomspace.ConceptNode, Name: name}
+}
+
+func entity(kind, id string) atomspace.Tree {
+	return concept(kind + ":" + id)
+}
+
+func instance(entity atomspace.Tree, kind string) atomspace.Tree {
+	return atomspace.Tree{Type: atomspace.InheritanceLink, Outgoing: []atomspace.Tree{entity, concept(kind)}}
+}
+
+func relation(predicate string, args ...atomspace.Tree) atomspace.Tree {
+	return atomspace.Tree{Type: atomspace.EvaluationLink, Outgoing: []atomspace.Tree{
+		{Type: atomspace.PredicateNode, Name: predicate},
+		{Type: atomspace.ListLink, Outgoing: args},
+	}}
+}
+
+func withTV(tree atomspace.Tree, tv atomspace.TruthValue) atomspace.Tree {
+	tree.TV = &tv
+	return tree
+}
+
+// StatePath returns the file recording what was ingested into an atomspace
+// agent, by repository
+func StatePath(configDir string, agent *opencog.Agent) string {
+	return filepath.Join(configDir, "ingest", agent.ID+".json")
+}
+
+// LoadProgress returns what was ingested from repository into an atomspace
+// agent, or nil if nothing was
+func LoadProgress(configDir string, agent *opencog.Agent, repository string) (*Progress, error) {
+	state, err := loadState(configDir, agent)
+	if err != nil {
+		return nil, err
+	}
+	return state[repository], nil
+}
+
+// SaveProgress records what was ingested from repository into an atomspace
+// agent
+func SaveProgress(configDir string, agent *opencog.Agent, repository string, progress *Progress) error {
+	state, err := loadState(configDir, agent)
+	if err != nil {
+		return err
+	}
+	state[repository] = progress
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal ingestion state: %w", err)
+	}
+	path := StatePath(configDir, agent)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create ingestion state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write ingestion state: %w", err)
+	}
+	return nil
+}
+
+func loadState(configDir string, agent *opencog.Agent) (map[string]*Progress, error) {
+	state := make(map[string]*Progress)
+	data, err := os.ReadFile(StatePath(configDir, agent))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read ingestion state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse ingestion state: %w", err)
+	}
+	return state, nil
+}
@@ -0,0 +1,203 @@
+package ingest
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/hub/v2/git"
+	"github.com/github/hub/v2/github"
+	"github.com/github/hub/v2/opencog"
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// store adds trees to a new AtomSpace
+func store(t *testing.T, trees []atomspace.Tree) *atomspace.AtomSpace {
+	t.Helper()
+	space := atomspace.New()
+	for _, tree := range trees {
+		if _, err := space.AddTree(tree); err != nil {
+			t.Fatalf("AddTree failed: %v", err)
+		}
+	}
+	return space
+}
+
+// holding reports whether space holds the atom of src, and with what
+// strength
+func holding(t *testing.T, space *atomspace.AtomSpace, src string) (float64, bool) {
+	t.Helper()
+	trees, err := atomspace.ParseScheme(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseScheme failed: %v", err)
+	}
+	h, ok := space.Find(trees[0])
+	if !ok {
+		return 0, false
+	}
+	atom, _ := space.Get(h)
+	return atom.TV.Strength, true
+}
+
+func TestCommit(t *testing.T) {
+	space := store(t, Commit(git.Commit{
+		Sha:         "b",
+		Parents:     []string{"a"},
+		AuthorEmail: "mona@example.com",
+		Subject:     "Fix the parser",
+		Files:       []string{"parser.go"},
+	}))
+
+	for _, src := range []string{
+		`(InheritanceLink (ConceptNode "commit:b") (ConceptNode "commit"))`,
+		`(EvaluationLink (PredicateNode "authored") (ListLink (ConceptNode "author:mona@example.com") (ConceptNode "commit:b")))`,
+		`(EvaluationLink (PredicateNode "parent") (ListLink (ConceptNode "commit:b") (ConceptNode "commit:a")))`,
+		`(EvaluationLink (PredicateNode "changes") (ListLink (ConceptNode "commit:b") (ConceptNode "file:parser.go")))`,
+		`(EvaluationLink (PredicateNode "title") (ListLink (ConceptNode "commit:b") (ConceptNode "Fix the parser")))`,
+	} {
+		if _, ok := holding(t, space, src); !ok {
+			t.Errorf("Expected %s", src)
+		}
+	}
+}
+
+func TestBranchesMove(t *testing.T) {
+	space := store(t, append(Branches(nil, map[string]string{"main": "a", "topic": "b"}), Branches(
+		map[string]string{"main": "a", "topic": "b"},
+		map[string]string{"main": "c"},
+	)...))
+
+	cases := map[string]float64{
+		`(EvaluationLink (PredicateNode "head") (ListLink (ConceptNode "branch:main") (ConceptNode "commit:a")))`:  0,
+		`(EvaluationLink (PredicateNode "head") (ListLink (ConceptNode "branch:main") (ConceptNode "commit:c")))`:  1,
+		`(EvaluationLink (PredicateNode "head") (ListLink (ConceptNode "branch:topic") (ConceptNode "commit:b")))`: 0,
+	}
+	for src, want := range cases {
+		if strength, ok := holding(t, space, src); !ok || strength != want {
+			t.Errorf("Expected %s with strength %v, got %v, %v", src, want, strength, ok)
+		}
+	}
+}
+
+func TestIssue(t *testing.T) {
+	space := store(t, Issue(github.Issue{
+		Number:      7,
+		State:       "closed",
+		Title:       "Add ingestion",
+		User:        &github.User{Login: "mona"},
+		Labels:      []github.IssueLabel{{Name: "feature"}},
+		PullRequest: &github.PullRequest{MergedAt: time.Now()},
+	}))
+
+	cases := map[string]float64{
+		`(InheritanceLink (ConceptNode "pull:7") (ConceptNode "pull"))`:                                              1,
+		`(EvaluationLink (PredicateNode "opened") (ListLink (ConceptNode "user:mona") (ConceptNode "pull:7")))`:      1,
+		`(EvaluationLink (PredicateNode "labeled") (ListLink (ConceptNode "pull:7") (ConceptNode "label:feature")))`: 1,
+		`(EvaluationLink (PredicateNode "state") (ListLink (ConceptNode "pull:7") (ConceptNode "merged")))`:          1,
+		`(EvaluationLink (PredicateNode "state") (ListLink (ConceptNode "pull:7") (ConceptNode "closed")))`:          0,
+		`(EvaluationLink (PredicateNode "state") (ListLink (ConceptNode "pull:7") (ConceptNode "open")))`:            0,
+		`(EvaluationLink (PredicateNode "title") (ListLink (ConceptNode "pull:7") (ConceptNode "Add ingestion")))`:   1,
+	}
+	for src, want := range cases {
+		if strength, ok := holding(t, space, src); !ok || strength != want {
+			t.Errorf("Expected %s with strength %v, got %v, %v", src, want, strength, ok)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	space := store(t, Release(github.Release{TagName: "v1.0", Name: "First", TargetCommitish: "main"}))
+	src := `(EvaluationLink (PredicateNode "targets") (ListLink (ConceptNode "release:v1.0") (ConceptNode "branch:main")))`
+	if _, ok := holding(t, space, src); !ok {
+		t.Errorf("Expected %s", src)
+	}
+}
+
+// repository creates a git repository with one commit and changes to it
+func repository(t *testing.T) func(args ...string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	pwd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(pwd) })
+	for name, value := range map[string]string{
+		"GIT_AUTHOR_NAME":     "Mona",
+		"GIT_AUTHOR_EMAIL":    "mona@example.com",
+		"GIT_COMMITTER_NAME":  "Mona",
+		"GIT_COMMITTER_EMAIL": "mona@example.com",
+	} {
+		t.Setenv(name, value)
+	}
+
+	run := func(args ...string) {
+		t.Helper()
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+	commit := func(args ...string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, args[0]), []byte(args[1]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		run("add", args[0])
+		run("commit", "-q", "-m", args[1])
+	}
+
+	run("init", "-q", "-b", "main")
+	commit("README", "Hello")
+	return commit
+}
+
+func TestReadIncrementally(t *testing.T) {
+	commit := repository(t)
+
+	first, err := Read(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if first.Commits != 1 || first.Branches != 1 {
+		t.Fatalf("Expected 1 commit on 1 branch, got %+v", first)
+	}
+
+	commit("main.go", "Add main")
+	second, err := Read(first.Progress, nil, nil)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if second.Commits != 1 {
+		t.Fatalf("Expected only the new commit to be read, got %d", second.Commits)
+	}
+
+	space := store(t, append(first.Atoms, second.Atoms...))
+	head := second.Progress.Branches["main"]
+	src := `(EvaluationLink (PredicateNode "head") (ListLink (ConceptNode "branch:main") (ConceptNode "commit:` + head + `")))`
+	if strength, ok := holding(t, space, src); !ok || strength != 1 {
+		t.Errorf("Expected main to point at %s", head)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	dir := t.TempDir()
+	agent := &opencog.Agent{ID: "kb"}
+
+	if progress, err := LoadProgress(dir, agent, "/src/hub"); err != nil || progress != nil {
+		t.Fatalf("Expected no progress, got %+v, %v", progress, err)
+	}
+	if err := SaveProgress(dir, agent, "/src/hub", &Progress{Branches: map[string]string{"main": "a"}}); err != nil {
+		t.Fatalf("SaveProgress failed: %v", err)
+	}
+	progress, err := LoadProgress(dir, agent, "/src/hub")
+	if err != nil || progress.Branches["main"] != "a" {
+		t.Errorf("Expected the saved progress, got %+v, %v", progress, err)
+	}
+}
@@ -0,0 +1,38 @@
+// Package decode extracts values from the payloads of agent messages.
+package decode
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Payload stores the value under key in a message's payload into the value
+// target points to. The payload holds a value of that type, or a pointer to
+// one, when the message was built in-process, and the JSON form of one when
+// it was decoded. what names the value in errors.
+func Payload(payload map[string]interface{}, key, what string, target interface{}) error {
+	raw, ok := payload[key]
+	if !ok {
+		return fmt.Errorf("payload has no %s", what)
+	}
+
+	dest := reflect.ValueOf(target).Elem()
+	switch value := reflect.ValueOf(raw); {
+	case value.Type() == dest.Type():
+		dest.Set(value)
+		return nil
+	case value.Kind() == reflect.Ptr && !value.IsNil() && value.Elem().Type() == dest.Type():
+		dest.Set(value.Elem())
+		return nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", what, err)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("invalid %s: %w", what, err)
+	}
+	return nil
+}
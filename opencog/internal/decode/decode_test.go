@@ -0,0 +1,41 @@
+package decode
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type run struct {
+	Steps int      `json:"steps"`
+	Atoms []string `json:"atoms"`
+}
+
+func TestPayload(t *testing.T) {
+	built := &run{Steps: 2, Atoms: []string{"a"}}
+	var decoded map[string]interface{}
+	json.Unmarshal([]byte(`{"run": {"steps": 2, "atoms": ["a"]}}`), &decoded)
+
+	for name, payload := range map[string]map[string]interface{}{
+		"pointer": {"run": built},
+		"value":   {"run": *built},
+		"JSON":    decoded,
+	} {
+		var got run
+		if err := Payload(payload, "run", "inference run", &got); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got.Steps != 2 || len(got.Atoms) != 1 || got.Atoms[0] != "a" {
+			t.Errorf("%s: expected the run, got %+v", name, got)
+		}
+	}
+
+	var got run
+	if err := Payload(map[string]interface{}{}, "run", "inference run", &got); err == nil || !strings.Contains(err.Error(), "no inference run") {
+		t.Errorf("Expected a missing run to be reported, got %v", err)
+	}
+	if err := Payload(map[string]interface{}{"run": "steps"}, "run", "inference run", &got); err == nil || !strings.Contains(err.Error(), "invalid inference run") {
+		t.Errorf("Expected an invalid run to be reported, got %v", err)
+	}
+}
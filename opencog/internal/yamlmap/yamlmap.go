@@ -0,0 +1,29 @@
+// Package yamlmap converts the values the YAML decoder produces for fields
+// of any type into the shapes JSON decoding would produce.
+package yamlmap
+
+import "fmt"
+
+// StringKeys converts the maps YAML decodes, which have keys of any type, to
+// maps with string keys, recursively, so that they marshal to JSON
+func StringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = StringKeys(item)
+		}
+		return m
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = StringKeys(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = StringKeys(item)
+		}
+		return v
+	}
+	return value
+}
@@ -0,0 +1,23 @@
+package yamlmap
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestStringKeys(t *testing.T) {
+	var decoded map[string]interface{}
+	if err := yaml.Unmarshal([]byte("event:\n  action: opened\n  labels:\n    - {name: bug, 1: one}\n"), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(StringKeys(decoded))
+	if err != nil {
+		t.Fatalf("Expected the converted value to marshal to JSON: %v", err)
+	}
+	if want := `{"event":{"action":"opened","labels":[{"1":"one","name":"bug"}]}}`; string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+}
@@ -0,0 +1,136 @@
+package opencog
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxHistory bounds the number of status transitions kept on an agent
+const maxHistory = 50
+
+// StatusTransition records a change of an agent's status
+type StatusTransition struct {
+	From   AgentStatus `json:"from"`
+	To     AgentStatus `json:"to"`
+	At     time.Time   `json:"at"`
+	Reason string      `json:"reason,omitempty"`
+}
+
+// transitions lists the statuses an agent may move to from each status
+var transitions = map[AgentStatus][]AgentStatus{
+	StatusCreated:  {StatusStarting},
+	StatusStarting: {StatusRunning, StatusStopping, StatusError},
+	StatusRunning:  {StatusPaused, StatusStopping, StatusError},
+	StatusPaused:   {StatusRunning, StatusStopping, StatusError},
+	StatusStopping: {StatusStopped, StatusError},
+	StatusStopped:  {StatusStarting},
+	StatusError:    {StatusStarting, StatusStopping},
+}
+
+// Restart stops agent if it is running and starts it again, launching the
+// command of its type if it has one. Metrics reported before the restart are
+// forgotten. The agent is saved.
+func (r *Registry) Restart(agent *Agent, actor, reason string) error {
+	if err := CheckProcessHost(r.dir, agent); err != nil {
+		return err
+	}
+	switch agent.Status {
+	case StatusStarting, StatusRunning, StatusPaused:
+		if err := r.stop(agent, actor, reason); err != nil {
+			return err
+		}
+	}
+
+	if err := r.Transition(agent, StatusStarting, actor, reason); err != nil {
+		return err
+	}
+	if agent.Metrics != nil {
+		agent.Metrics.ErrorReason = ""
+		agent.Metrics.Reported = nil
+	}
+	if desc, ok := DefaultTypes.Lookup(agent.Type); ok && len(desc.Command) > 0 {
+		pid, err := StartProcess(agent, desc.Command, r.dir)
+		if err != nil {
+			r.Transition(agent, StatusError, actor, err.Error())
+			r.Update(agent)
+			return err
+		}
+		agent.PID = pid
+	}
+	if err := r.Transition(agent, StatusRunning, actor, ""); err != nil {
+		return err
+	}
+	return r.Update(agent)
+}
+
+// Stop stops agent, terminating its process and removing its cgroup if it
+// has them. The agent is saved.
+func (r *Registry) Stop(agent *Agent, actor, reason string) error {
+	if err := CheckProcessHost(r.dir, agent); err != nil {
+		return err
+	}
+	if err := r.stop(agent, actor, reason); err != nil {
+		return err
+	}
+	return r.Update(agent)
+}
+
+// stop is Stop without saving the agent
+func (r *Registry) stop(agent *Agent, actor, reason string) error {
+	if err := r.Transition(agent, StatusStopping, actor, reason); err != nil {
+		return err
+	}
+	if agent.PID != 0 {
+		if err := StopProcess(agent.PID); err != nil {
+			return err
+		}
+		agent.PID = 0
+	}
+	removeCgroup(agent.Cgroup)
+	agent.Cgroup = ""
+	return r.Transition(agent, StatusStopped, actor, "")
+}
+
+// CanTransition reports whether an agent may move from one status to another
+func CanTransition(from, to AgentStatus) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the agent to a new status, rejecting transitions the
+// lifecycle does not allow, and records the change in the agent's history
+func (a *Agent) Transition(to AgentStatus, reason string) error {
+	if !CanTransition(a.Status, to) {
+		return fmt.Errorf("agent %s cannot go from %s to %s", a.Name, a.Status, to)
+	}
+
+	now := time.Now()
+	from := a.Status
+	a.History = append(a.History, StatusTransition{
+		From:   from,
+		To:     to,
+		At:     now,
+		Reason: reason,
+	})
+	if len(a.History) > maxHistory {
+		a.History = a.History[len(a.History)-maxHistory:]
+	}
+
+	a.Status = to
+	a.UpdatedAt = now
+	switch to {
+	case StatusRunning:
+		// Resuming a paused agent does not restart its uptime
+		if from == StatusStarting {
+			a.StartedAt = &now
+		}
+	case StatusStopped:
+		a.StoppedAt = &now
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package opencog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAgentTransitionLifecycle(t *testing.T) {
+	agent, err := NewAgent(AgentConfig{Name: "cycle", Type: AtomSpaceAgent})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+
+	steps := []AgentStatus{
+		StatusStarting,
+		StatusRunning,
+		StatusPaused,
+		StatusRunning,
+		StatusStopping,
+		StatusStopped,
+		StatusStarting,
+		StatusRunning,
+		StatusError,
+		StatusStopping,
+		StatusStopped,
+	}
+
+	for _, to := range steps {
+		if err := agent.Transition(to, "test"); err != nil {
+			t.Fatalf("Transition to %s failed: %v", to, err)
+		}
+		if agent.Status != to {
+			t.Errorf("Expected status %s, got %s", to, agent.Status)
+		}
+	}
+
+	if len(agent.History) != len(steps) {
+		t.Fatalf("Expected %d history entries, got %d", len(steps), len(agent.History))
+	}
+	first := agent.History[0]
+	if first.From != StatusCreated || first.To != StatusStarting || first.Reason != "test" {
+		t.Errorf("Unexpected first transition %+v", first)
+	}
+	if agent.StartedAt == nil || agent.StoppedAt == nil {
+		t.Error("StartedAt and StoppedAt should be set")
+	}
+}
+
+func TestAgentTransitionRejectsIllegal(t *testing.T) {
+	tests := []struct {
+		from AgentStatus
+		to   AgentStatus
+	}{
+		{StatusCreated, StatusRunning},
+		{StatusCreated, StatusPaused},
+		{StatusStopped, StatusPaused},
+		{StatusPaused, StatusStarting},
+		{StatusStopping, StatusRunning},
+		{StatusError, StatusRunning},
+		{StatusRunning, StatusRunning},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			agent := &Agent{Name: "strict", Status: tt.from}
+			err := agent.Transition(tt.to, "")
+			if err == nil {
+				t.Fatal("Transition should be rejected")
+			}
+			if !strings.Contains(err.Error(), "cannot go from") {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if agent.Status != tt.from {
+				t.Errorf("Status should be unchanged, got %s", agent.Status)
+			}
+			if len(agent.History) != 0 {
+				t.Error("Rejected transitions should not be recorded")
+			}
+		})
+	}
+}
+
+func TestAgentResumeKeepsStartedAt(t *testing.T) {
+	agent := &Agent{Name: "steady", Status: StatusStarting}
+	agent.Transition(StatusRunning, "")
+	started := *agent.StartedAt
+
+	agent.Transition(StatusPaused, "")
+	agent.Transition(StatusRunning, "")
+	if !agent.StartedAt.Equal(started) {
+		t.Error("Resuming should not reset StartedAt")
+	}
+}
+
+func TestAgentHistoryIsBounded(t *testing.T) {
+	agent := &Agent{Name: "busy", Status: StatusRunning}
+	for i := 0; i < maxHistory; i++ {
+		agent.Transition(StatusPaused, "")
+		agent.Transition(StatusRunning, "")
+	}
+
+	if len(agent.History) != maxHistory {
+		t.Errorf("Expected history bounded to %d, got %d", maxHistory, len(agent.History))
+	}
+}
@@ -0,0 +1,255 @@
+package opencog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resources that can be limited for an agent process
+const (
+	LimitCPU       = "cpu"
+	LimitMemory    = "memory"
+	LimitOpenFiles = "open_files"
+	LimitWallClock = "wall_clock"
+)
+
+// ResourceLimits bounds the resources an agent process may use. CPU time and
+// open files are enforced with rlimits on the spawned process. Memory is
+// enforced by a cgroup v2 group where one can be created, and otherwise by
+// limiting the data segment, which bounds the memory the process allocates
+// but not the address space it reserves. The wall-clock limit is enforced by
+// the orchestrator.
+type ResourceLimits struct {
+	CPUSeconds  int    `json:"cpu_seconds,omitempty"`
+	MemoryBytes int64  `json:"memory_bytes,omitempty"`
+	OpenFiles   int    `json:"open_files,omitempty"`
+	WallClock   string `json:"wall_clock,omitempty"`
+}
+
+// IsZero reports whether no limit is set
+func (l *ResourceLimits) IsZero() bool {
+	return l == nil || (l.CPUSeconds == 0 && l.MemoryBytes == 0 && l.OpenFiles == 0 && l.WallClock == "")
+}
+
+// WallClockDuration returns the wall-clock limit, or zero if there is none
+func (l *ResourceLimits) WallClockDuration() time.Duration {
+	if l == nil {
+		return 0
+	}
+	return parseDurationOr(l.WallClock, 0)
+}
+
+// validate checks that all limits are sensible
+func (l *ResourceLimits) validate() error {
+	if l.CPUSeconds < 0 {
+		return fmt.Errorf("invalid CPU limit %d", l.CPUSeconds)
+	}
+	if l.MemoryBytes < 0 {
+		return fmt.Errorf("invalid memory limit %d", l.MemoryBytes)
+	}
+	if l.OpenFiles < 0 {
+		return fmt.Errorf("invalid open files limit %d", l.OpenFiles)
+	}
+	if l.WallClock != "" {
+		if d, err := time.ParseDuration(l.WallClock); err != nil || d <= 0 {
+			return fmt.Errorf("invalid wall-clock limit %q", l.WallClock)
+		}
+	}
+	return nil
+}
+
+// describe returns a human-readable description of the limit on resource
+func (l *ResourceLimits) describe(resource string) string {
+	switch resource {
+	case LimitCPU:
+		return fmt.Sprintf("%s of CPU time", time.Duration(l.CPUSeconds)*time.Second)
+	case LimitMemory:
+		return FormatByteSize(l.MemoryBytes) + " of memory"
+	case LimitOpenFiles:
+		return fmt.Sprintf("%d open files", l.OpenFiles)
+	case LimitWallClock:
+		return l.WallClock + " of wall-clock time"
+	}
+	return resource
+}
+
+// ParseByteSize parses sizes such as 512M, 2G or 1048576
+func ParseByteSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+
+	multiplier := int64(1)
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			value = value[:len(value)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 512M or 2G", s)
+	}
+	return n * multiplier, nil
+}
+
+// FormatByteSize formats a byte count using binary units
+func FormatByteSize(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", n, units[0])
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
+
+// limitCommand wraps command in a shell that applies the rlimits and then
+// execs the command so that it keeps the PID. With a cgroup, which enforces
+// the memory limit instead of an rlimit, the shell first waits for a line on
+// its standard input, sent once it has been placed in the cgroup, and the
+// command gets no standard input.
+func limitCommand(command []string, limits *ResourceLimits, cgroup string) []string {
+	if limits.IsZero() && cgroup == "" {
+		return command
+	}
+
+	var script []string
+	if cgroup != "" {
+		script = append(script, "read -r joined")
+	}
+	if limits.CPUSeconds > 0 {
+		script = append(script, fmt.Sprintf("ulimit -t %d", limits.CPUSeconds))
+	}
+	if limits.MemoryBytes > 0 && cgroup == "" {
+		kib := limits.MemoryBytes / 1024
+		if kib == 0 {
+			kib = 1
+		}
+		script = append(script, fmt.Sprintf("ulimit -d %d", kib))
+	}
+	if limits.OpenFiles > 0 {
+		script = append(script, fmt.Sprintf("ulimit -n %d", limits.OpenFiles))
+	}
+	if cgroup != "" {
+		script = append(script, `exec "$@" </dev/null`)
+	} else {
+		script = append(script, `exec "$@"`)
+	}
+
+	return append([]string{"/bin/sh", "-c", strings.Join(script, " && "), "hub-agent"}, command...)
+}
+
+// enforceLimits checks supervised agent processes against their limits.
+// Processes past their wall-clock limit are stopped, and killed if they do
+// not exit when asked. Processes that have exited are marked as errored, with
+// the limit they breached as the reason when it can be determined.
+func (o *Orchestrator) enforceLimits() {
+	now := time.Now()
+
+	for _, agent := range o.registry.List() {
+		if agent.PID == 0 || (agent.Status != StatusRunning && agent.Status != StatusPaused) || !o.supervises(agent) {
+			continue
+		}
+
+		breach := ""
+		var exitErr string
+
+		if !ProcessAlive(agent.PID) {
+			breach = o.exitBreach(agent)
+			exitErr = "process exited"
+		} else {
+			if d := agent.Limits.WallClockDuration(); d > 0 && agent.StartedAt != nil && now.Sub(*agent.StartedAt) > d {
+				StopProcess(agent.PID)
+				breach = LimitWallClock
+			} else if agent.Limits != nil && agent.Limits.OpenFiles > 0 {
+				if files, err := procOpenFiles(agent.PID); err == nil && files >= agent.Limits.OpenFiles {
+					// The process is not killed, but it can no longer open files
+					o.reportBreach(agent, LimitOpenFiles, false)
+				}
+			}
+			if breach == "" {
+				continue
+			}
+		}
+
+		if breach != "" {
+			o.reportBreach(agent, breach, true)
+		} else {
+			o.registry.Transition(agent, StatusError, ActorOrchestrator, exitErr)
+		}
+
+		removeCgroup(agent.Cgroup)
+		agent.PID = 0
+		agent.Cgroup = ""
+		o.forgetSamples(agent.ID)
+		o.registry.Update(agent)
+	}
+}
+
+// exitBreach determines which limit, if any, made an exited process die
+func (o *Orchestrator) exitBreach(agent *Agent) string {
+	if agent.Limits == nil {
+		return ""
+	}
+	if agent.Limits.MemoryBytes > 0 && cgroupOOMKilled(agent.Cgroup) {
+		return LimitMemory
+	}
+	if agent.Limits.CPUSeconds > 0 {
+		o.mu.RLock()
+		buffer, sampled := o.samples[agent.ID]
+		o.mu.RUnlock()
+		if !sampled {
+			return ""
+		}
+		// The last sample is at most one tick old
+		if latest, ok := buffer.Latest(); ok && latest.CPUSeconds >= float64(agent.Limits.CPUSeconds)-o.CheckInterval.Seconds() {
+			return LimitCPU
+		}
+	}
+	return ""
+}
+
+// reportBreach records a limit breach in the agent's metrics and events and,
+// if fatal, moves the agent to the error status
+func (o *Orchestrator) reportBreach(agent *Agent, resource string, fatal bool) {
+	reason := "limit_exceeded:" + resource
+	if agent.Metrics != nil && agent.Metrics.ErrorReason == reason && !fatal {
+		// Already reported
+		return
+	}
+
+	if agent.Metrics == nil {
+		agent.Metrics = &AgentMetrics{}
+	}
+	agent.Metrics.ErrorReason = reason
+	agent.Metrics.ErrorCount++
+
+	message := fmt.Sprintf("limit exceeded: %s", agent.Limits.describe(resource))
+	if fatal {
+		o.registry.Transition(agent, StatusError, ActorOrchestrator, message)
+	} else {
+		o.registry.RecordEvent(Event{
+			AgentID: agent.ID,
+			Actor:   ActorOrchestrator,
+			Kind:    EventHealth,
+			Reason:  message,
+		})
+		o.registry.Update(agent)
+	}
+}
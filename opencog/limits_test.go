@@ -0,0 +1,261 @@
+//go:build !windows
+// +build !windows
+
+package opencog
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "1048576", want: 1 << 20},
+		{size: "512M", want: 512 << 20},
+		{size: "2g", want: 2 << 30},
+		{size: "64KiB", want: 64 << 10},
+		{size: "1GB", want: 1 << 30},
+		{size: "", wantErr: true},
+		{size: "-1M", wantErr: true},
+		{size: "lots", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := ParseByteSize(tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseByteSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+
+	if got := FormatByteSize(512 << 20); got != "512.0MiB" {
+		t.Errorf("Expected 512.0MiB, got %s", got)
+	}
+}
+
+func TestResourceLimitsValidation(t *testing.T) {
+	config := AgentConfig{Name: "bounded", Type: CustomAgent, Limits: &ResourceLimits{WallClock: "soon"}}
+	if err := config.Validate(); err == nil {
+		t.Error("Validate should reject an invalid wall-clock limit")
+	}
+
+	config.Limits = &ResourceLimits{CPUSeconds: 10, WallClock: "1h"}
+	agent, err := NewAgent(config)
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+	if agent.Limits.WallClockDuration() != time.Hour {
+		t.Errorf("Expected a 1h wall-clock limit, got %s", agent.Limits.WallClockDuration())
+	}
+
+	agent, _ = NewAgent(AgentConfig{Name: "free", Type: CustomAgent, Limits: &ResourceLimits{}})
+	if agent.Limits != nil {
+		t.Error("Empty limits should not be stored on the agent")
+	}
+}
+
+func TestLimitCommandAppliesRlimits(t *testing.T) {
+	limits := &ResourceLimits{OpenFiles: 64, CPUSeconds: 7, MemoryBytes: 1 << 30}
+	command := limitCommand([]string{"sh", "-c", "ulimit -n; ulimit -t; ulimit -d"}, limits, "")
+	output, err := exec.Command(command[0], command[1:]...).Output()
+	if err != nil {
+		t.Fatalf("Limited command failed: %v", err)
+	}
+	if got := strings.Fields(string(output)); len(got) != 3 || got[0] != "64" || got[1] != "7" || got[2] != "1048576" {
+		t.Errorf("Expected limits 64, 7 and 1048576, got %q", output)
+	}
+
+	// The cgroup limits memory instead, once the command has been let in
+	command = limitCommand([]string{"sh", "-c", "ulimit -d"}, limits, "/sys/fs/cgroup/hub.cog/agent")
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader("\n")
+	output, err = cmd.Output()
+	if err != nil {
+		t.Fatalf("Limited command failed: %v", err)
+	}
+	if strings.TrimSpace(string(output)) == "1048576" {
+		t.Errorf("Expected no data segment limit with a cgroup")
+	}
+
+	plain := []string{"true"}
+	if got := limitCommand(plain, nil, ""); len(got) != 1 {
+		t.Errorf("Commands without limits should not be wrapped, got %v", got)
+	}
+}
+
+func startLimitedAgent(t *testing.T, registry *Registry, limits *ResourceLimits, command ...string) *Agent {
+	agent, err := NewAgent(AgentConfig{Name: "limited", Type: CustomAgent, Limits: limits})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+	pid, err := StartProcess(agent, command, registry.Dir())
+	if err != nil {
+		t.Fatalf("StartProcess failed: %v", err)
+	}
+	t.Cleanup(func() { StopProcess(pid) })
+
+	agent.PID = pid
+	agent.Status = StatusStarting
+	agent.Transition(StatusRunning, "")
+	registry.Register(agent)
+	return agent
+}
+
+func TestWallClockLimit(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent := startLimitedAgent(t, registry, &ResourceLimits{WallClock: "1h"}, "sleep", "30")
+	pid := agent.PID
+
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.enforceLimits()
+	if agent.Status != StatusRunning {
+		t.Fatalf("Agent within its wall-clock limit should keep running, got %s", agent.Status)
+	}
+
+	started := time.Now().Add(-2 * time.Hour)
+	agent.StartedAt = &started
+	orchestrator.enforceLimits()
+
+	if agent.Status != StatusError {
+		t.Errorf("Agent past its wall-clock limit should be in error, got %s", agent.Status)
+	}
+	if agent.Metrics == nil || agent.Metrics.ErrorReason != "limit_exceeded:wall_clock" {
+		t.Errorf("Expected a wall-clock breach in the metrics, got %+v", agent.Metrics)
+	}
+	if !waitForExit(pid) {
+		t.Error("Process should have been stopped")
+	}
+
+	events, _ := registry.Events(agent.ID, EventFilter{Kind: EventLifecycle})
+	if len(events) == 0 || !strings.Contains(events[len(events)-1].Reason, "wall-clock") {
+		t.Errorf("Expected a lifecycle event for the breach, got %+v", events)
+	}
+}
+
+func TestCPULimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("CPU sampling requires /proc")
+	}
+
+	registry, _ := NewRegistry(t.TempDir())
+	agent := startLimitedAgent(t, registry, &ResourceLimits{CPUSeconds: 1}, "sh", "-c", "while :; do :; done")
+	pid := agent.PID
+
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.CheckInterval = time.Second
+	orchestrator.sampleResources()
+
+	if !waitForExit(pid) {
+		t.Fatal("Process should have been killed by its CPU limit")
+	}
+	orchestrator.enforceLimits()
+
+	if agent.Status != StatusError {
+		t.Errorf("Agent should be in error, got %s", agent.Status)
+	}
+	if agent.Metrics == nil || agent.Metrics.ErrorReason != "limit_exceeded:cpu" {
+		t.Errorf("Expected a CPU breach in the metrics, got %+v", agent.Metrics)
+	}
+	if agent.PID != 0 {
+		t.Error("PID should be cleared once the process has exited")
+	}
+}
+
+func TestProcessExitWithoutBreach(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent := startLimitedAgent(t, registry, &ResourceLimits{CPUSeconds: 60}, "true")
+
+	if !waitForExit(agent.PID) {
+		t.Fatal("Process should have exited")
+	}
+	NewOrchestrator(registry).enforceLimits()
+
+	if agent.Status != StatusError {
+		t.Errorf("Agent whose process exited should be in error, got %s", agent.Status)
+	}
+	if agent.Metrics != nil && agent.Metrics.ErrorReason != "" {
+		t.Errorf("A plain exit should not be reported as a breach, got %s", agent.Metrics.ErrorReason)
+	}
+}
+
+func TestOpenFilesLimit(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("counting open files requires /proc")
+	}
+
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "hoarder", Type: CustomAgent, Limits: &ResourceLimits{OpenFiles: 32}})
+	agent.Status = StatusRunning
+
+	// The helper opens files until it runs out and then waits
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperOpenFiles")
+	cmd.Env = append(os.Environ(), "HUB_TEST_OPEN_FILES=1")
+	cmd.Args = limitCommand(cmd.Args, agent.Limits, "")
+	cmd.Path = cmd.Args[0]
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start helper: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	// Wait until the helper reports that it has exhausted its files
+	stdout.Read(make([]byte, 1))
+
+	agent.PID = cmd.Process.Pid
+	registry.Register(agent)
+
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.enforceLimits()
+	orchestrator.enforceLimits()
+
+	if agent.Status != StatusRunning {
+		t.Errorf("Running out of files should not stop the agent, got %s", agent.Status)
+	}
+	if agent.Metrics == nil || agent.Metrics.ErrorReason != "limit_exceeded:open_files" {
+		t.Errorf("Expected an open files breach in the metrics, got %+v", agent.Metrics)
+	}
+
+	events, _ := registry.Events(agent.ID, EventFilter{Kind: EventHealth})
+	if len(events) != 1 {
+		t.Errorf("The breach should be reported once, got %d events", len(events))
+	}
+}
+
+func TestHelperOpenFiles(t *testing.T) {
+	if os.Getenv("HUB_TEST_OPEN_FILES") != "1" {
+		return
+	}
+	var files []*os.File
+	for {
+		f, err := os.Open(os.DevNull)
+		if err != nil {
+			break
+		}
+		files = append(files, f)
+	}
+	os.Stdout.Write([]byte("x"))
+	time.Sleep(30 * time.Second)
+}
+
+// waitForExit waits up to five seconds for pid to exit
+func waitForExit(pid int) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for ProcessAlive(pid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return !ProcessAlive(pid)
+}
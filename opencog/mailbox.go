@@ -0,0 +1,185 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The mailbox hands messages from other processes, such as the webhook
+// receiver, to the daemon, which delivers them to the agents it hosts and
+// writes their replies back. Messages and replies are files named after the
+// message ID under the mailbox directory of the registry.
+const (
+	// mailboxInterval is the time between two reads of the mailbox
+	mailboxInterval = 250 * time.Millisecond
+	// mailboxTimeout bounds the wait for the reply to a posted message
+	mailboxTimeout = 30 * time.Second
+	// mailboxReplyTTL is how long replies nobody claims are kept
+	mailboxReplyTTL = time.Hour
+)
+
+func (r *Registry) mailboxPath(box, id string) string {
+	return filepath.Join(r.dir, "mailbox", box, id+".json")
+}
+
+// PostMessage leaves msg in the mailbox for the daemon to deliver. The
+// sender must not be an agent of the registry.
+func (r *Registry) PostMessage(msg *Message) error {
+	if msg.From == "" {
+		return fmt.Errorf("posted messages need a sender")
+	}
+	if _, err := r.Get(msg.From); err == nil {
+		return fmt.Errorf("messages cannot be posted as agent %s", msg.From)
+	}
+	if msg.ID == "" {
+		msg.ID = generateMessageID()
+	}
+	if strings.ContainsAny(msg.ID, `/\`) || strings.HasPrefix(msg.ID, ".") {
+		return fmt.Errorf("invalid message ID %q", msg.ID)
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return writeMailboxFile(r.mailboxPath("in", msg.ID), msg)
+}
+
+// WaitForReply waits for the reply the daemon writes to the posted message
+// with the given ID. Error replies are returned along with their error.
+func (r *Registry) WaitForReply(id string, timeout time.Duration) (*Message, error) {
+	path := r.mailboxPath("out", id)
+	deadline := time.Now().Add(timeout)
+	for {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			os.Remove(path)
+			var reply Message
+			if err := json.Unmarshal(data, &reply); err != nil {
+				return nil, fmt.Errorf("invalid reply to message %s: %w", id, err)
+			}
+			if reply.Type == MessageTypeError {
+				return &reply, fmt.Errorf("%v", reply.Payload["error"])
+			}
+			return &reply, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read reply to message %s: %w", id, err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no reply to message %s within %s; is the agent daemon running?", id, timeout)
+		}
+		time.Sleep(mailboxInterval)
+	}
+}
+
+// writeMailboxFile writes msg to path so that readers never see a partly
+// written file
+func writeMailboxFile(path string, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create mailbox directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
+
+// mailboxLoop delivers the posted messages until the orchestrator stops
+func (o *Orchestrator) mailboxLoop() {
+	ticker := time.NewTicker(mailboxInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.stopCh:
+			return
+		case <-ticker.C:
+			o.readMailbox(time.Now())
+		}
+	}
+}
+
+// readMailbox takes the posted messages out of the mailbox and delivers each
+// of them in the background. Replies left unclaimed are dropped.
+func (o *Orchestrator) readMailbox(now time.Time) {
+	dir := filepath.Dir(o.registry.mailboxPath("in", ""))
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		// A message that cannot be removed would be delivered again
+		if err != nil || os.Remove(path) != nil {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil || msg.From == "" {
+			fmt.Fprintf(os.Stderr, "Warning: dropping invalid message %s from the mailbox\n", entry.Name())
+			continue
+		}
+		// The reply is written where the file name says it is awaited
+		msg.ID = strings.TrimSuffix(entry.Name(), ".json")
+		go o.deliverPosted(&msg)
+	}
+
+	dir = filepath.Dir(o.registry.mailboxPath("out", ""))
+	entries, _ = os.ReadDir(dir)
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && now.Sub(info.ModTime()) > mailboxReplyTTL {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// deliverPosted sends a posted message to its agent and writes the reply, or
+// the error that prevented one, to the mailbox
+func (o *Orchestrator) deliverPosted(msg *Message) {
+	reply, err := o.requestPosted(msg)
+	if err != nil && reply == nil {
+		reply = &Message{
+			From:    msg.To,
+			To:      msg.From,
+			Type:    MessageTypeError,
+			Payload: map[string]interface{}{"error": err.Error()},
+		}
+	}
+	reply.ReplyTo = msg.ID
+	if reply.Timestamp.IsZero() {
+		reply.Timestamp = time.Now()
+	}
+	if err := writeMailboxFile(o.registry.mailboxPath("out", msg.ID), reply); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to reply to message %s: %v\n", msg.ID, err)
+	}
+}
+
+func (o *Orchestrator) requestPosted(msg *Message) (*Message, error) {
+	// Posters are no agents, and may not speak for one
+	if _, err := o.registry.Get(msg.From); err == nil {
+		return nil, fmt.Errorf("messages cannot be posted as agent %s", msg.From)
+	}
+	o.mu.RLock()
+	hosted := o.hosted[msg.From]
+	o.mu.RUnlock()
+	if hosted {
+		return nil, fmt.Errorf("messages cannot be posted as agent %s", msg.From)
+	}
+	msg.OnBehalfOf = ""
+	if _, err := o.GetAgentChannel(msg.From); err != nil {
+		o.RegisterAgent(msg.From)
+	}
+	return o.Request(msg, mailboxTimeout)
+}
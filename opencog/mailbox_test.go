@@ -0,0 +1,58 @@
+package opencog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMailboxDeliversPostedMessages(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "reviewer", Type: AtomSpaceAgent})
+	registry.Register(agent)
+
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.Host(agent.ID, &replier{name: "reviewer"})
+	orchestrator.Host("broken", &replier{name: "broken", fail: true})
+	if err := orchestrator.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer orchestrator.Stop()
+
+	msg := &Message{From: "webhook", To: agent.ID, Type: MessageTypeCommand}
+	if err := registry.PostMessage(msg); err != nil {
+		t.Fatalf("PostMessage failed: %v", err)
+	}
+	reply, err := registry.WaitForReply(msg.ID, 5*time.Second)
+	if err != nil {
+		t.Fatalf("WaitForReply failed: %v", err)
+	}
+	if reply.Payload["from"] != "reviewer" || reply.ReplyTo != msg.ID {
+		t.Errorf("Expected the reply of reviewer to %s, got %+v", msg.ID, reply)
+	}
+
+	msg = &Message{From: "webhook", To: "broken", Type: MessageTypeCommand}
+	registry.PostMessage(msg)
+	if _, err := registry.WaitForReply(msg.ID, 5*time.Second); err == nil || !strings.Contains(err.Error(), "broken is broken") {
+		t.Errorf("Expected the error of the agent, got %v", err)
+	}
+
+	if err := registry.PostMessage(&Message{From: agent.ID, To: "broken"}); err == nil {
+		t.Error("Expected messages posted as an agent to be refused")
+	}
+	if err := registry.PostMessage(&Message{ID: "../agents", From: "webhook", To: agent.ID}); err == nil {
+		t.Error("Expected a message ID naming another file to be refused")
+	}
+}
+
+func TestWaitForReplyTimesOut(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+
+	msg := &Message{From: "webhook", To: "reviewer", Type: MessageTypeCommand}
+	if err := registry.PostMessage(msg); err != nil {
+		t.Fatalf("PostMessage failed: %v", err)
+	}
+	if _, err := registry.WaitForReply(msg.ID, 10*time.Millisecond); err == nil || !strings.Contains(err.Error(), "daemon") {
+		t.Errorf("Expected a timeout pointing at the daemon, got %v", err)
+	}
+}
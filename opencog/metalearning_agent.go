@@ -0,0 +1,432 @@
+package opencog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/github/hub/v2/opencog/internal/decode"
+	"github.com/github/hub/v2/opencog/tuning"
+)
+
+func init() {
+	RegisterBehavior(MetaLearningAgent, newMetaLearningBehavior)
+}
+
+// TrialAction asks a meta-learning agent to end its current trial and start
+// the next one right away
+const TrialAction = "trial"
+
+// metaCheckInterval bounds the time between the checks of a meta-learning
+// agent for the end of its current trial
+const metaCheckInterval = 10 * time.Second
+
+// TuningTrial records a trial of parameter values of the agent a
+// meta-learning agent tunes
+type TuningTrial struct {
+	Number  int           `json:"number"`
+	Values  tuning.Values `json:"values"`
+	Started time.Time     `json:"started"`
+	Ended   *time.Time    `json:"ended,omitempty"`
+	// Score is the metric the target reported last during the trial, and
+	// Error why the trial could not be scored
+	Score *float64 `json:"score,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// BestConfiguration is the parameter values that scored best on average
+type BestConfiguration struct {
+	Values tuning.Values `json:"values"`
+	Score  float64       `json:"score"`
+	Trials int           `json:"trials"`
+}
+
+// metaState is what a meta-learning agent keeps between trials
+type metaState struct {
+	Trials  []*TuningTrial `json:"trials,omitempty"`
+	Current *TuningTrial   `json:"current,omitempty"`
+	// Applied is set when the best configuration was applied, which ends
+	// the search
+	Applied *time.Time `json:"applied,omitempty"`
+}
+
+func metaStatePath(configDir string, agent *Agent) string {
+	return filepath.Join(configDir, "metalearning", agent.ID+".json")
+}
+
+func loadMetaState(configDir string, agent *Agent) (*metaState, error) {
+	state := &metaState{}
+	data, err := os.ReadFile(metaStatePath(configDir, agent))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read tuning state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse tuning state: %w", err)
+	}
+	return state, nil
+}
+
+func (s *metaState) save(configDir string, agent *Agent) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal tuning state: %w", err)
+	}
+	path := metaStatePath(configDir, agent)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create tuning state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write tuning state: %w", err)
+	}
+	return nil
+}
+
+func checkSearchSpace(value interface{}) error {
+	if value.(string) == "" {
+		return nil
+	}
+	_, err := tuning.ParseSpace(value.(string))
+	return err
+}
+
+// TuningTrials returns the trials of a meta-learning agent, oldest first,
+// and the trial in progress, if any
+func TuningTrials(configDir string, agent *Agent) ([]*TuningTrial, *TuningTrial, error) {
+	state, err := loadMetaState(configDir, agent)
+	if err != nil {
+		return nil, nil, err
+	}
+	return state.Trials, state.Current, nil
+}
+
+// BestTuning returns the values that scored best on average over the trials
+// of a meta-learning agent, or nil if no trial was scored
+func BestTuning(configDir string, agent *Agent) (*BestConfiguration, error) {
+	state, err := loadMetaState(configDir, agent)
+	if err != nil {
+		return nil, err
+	}
+	return bestConfiguration(agent, state.Trials), nil
+}
+
+// ApplyBestTuning sets the values that scored best on the agent a
+// meta-learning agent tunes and restarts it. The search ends until
+// ResetTuning is called.
+func ApplyBestTuning(registry *Registry, agent *Agent, actor string) (*BestConfiguration, []ConfigChange, error) {
+	state, err := loadMetaState(registry.Dir(), agent)
+	if err != nil {
+		return nil, nil, err
+	}
+	best := bestConfiguration(agent, state.Trials)
+	if best == nil {
+		return nil, nil, fmt.Errorf("%s has no scored trials", agent.Name)
+	}
+	target, err := TuningTarget(registry, agent)
+	if err != nil {
+		return nil, nil, err
+	}
+	space, err := tuningSpace(agent, target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes, err := target.UpdateConfig(configValues(space, best.Values), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	reason := fmt.Sprintf("best configuration of %s applied", agent.Name)
+	recordConfigChanges(registry, target, actor, reason, changes)
+	if target.Status == StatusRunning || target.Status == StatusPaused {
+		err = registry.Restart(target, actor, reason)
+	} else {
+		err = registry.Update(target)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if state.Current != nil {
+		state.Current.Ended = &now
+		state.Current.Error = "interrupted by applying the best configuration"
+		state.Trials = append(state.Trials, state.Current)
+		state.Current = nil
+	}
+	state.Applied = &now
+	if err := state.save(registry.Dir(), agent); err != nil {
+		return nil, nil, err
+	}
+	return best, changes, nil
+}
+
+// ResetTuning forgets the trials of a meta-learning agent, so that it
+// searches anew
+func ResetTuning(configDir string, agent *Agent) error {
+	err := os.Remove(metaStatePath(configDir, agent))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to reset tuning state: %w", err)
+	}
+	return nil
+}
+
+// TuningTarget returns the agent a meta-learning agent tunes
+func TuningTarget(registry *Registry, agent *Agent) (*Agent, error) {
+	name := agent.ConfigString("target")
+	if name == "" {
+		return nil, fmt.Errorf("agent %s has no target; set one with --set target=<name>", agent.Name)
+	}
+	target, err := registry.GetByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("target of %s: %w", agent.Name, err)
+	}
+	return target, nil
+}
+
+// DecodeTuningTrial extracts the trial from a meta-learning agent's reply
+func DecodeTuningTrial(payload map[string]interface{}) (*TuningTrial, error) {
+	trial := &TuningTrial{}
+	if err := decode.Payload(payload, "trial", "trial", trial); err != nil {
+		return nil, err
+	}
+	return trial, nil
+}
+
+// tuningSpace returns the parameters a meta-learning agent searches. They
+// must be numeric options of the target.
+func tuningSpace(agent, target *Agent) (tuning.Space, error) {
+	space, err := tuning.ParseSpace(agent.ConfigString("parameters"))
+	if err != nil {
+		return nil, fmt.Errorf("parameters of %s: %w", agent.Name, err)
+	}
+	schema, ok := SchemaFor(target.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown agent type %q", target.Type)
+	}
+	for i := range space {
+		option, ok := schema.Option(space[i].Key)
+		switch {
+		case !ok && schema.AllowUnknown:
+		case !ok:
+			return nil, fmt.Errorf("%s agents have no option %s", target.Type, space[i].Key)
+		case option.Type == OptionInt:
+			space[i].Integer = true
+		case option.Type != OptionFloat:
+			return nil, fmt.Errorf("option %s of %s agents is not numeric", space[i].Key, target.Type)
+		}
+	}
+	return space, nil
+}
+
+// recordConfigChanges records the changes made to the configuration of
+// target as config events
+func recordConfigChanges(registry *Registry, target *Agent, actor, reason string, changes []ConfigChange) {
+	for _, change := range changes {
+		event := Event{AgentID: target.ID, Actor: actor, Kind: EventConfig, Reason: reason}
+		if change.Old != nil {
+			event.From = fmt.Sprintf("%s=%v", change.Key, change.Old)
+		}
+		if change.New != nil {
+			event.To = fmt.Sprintf("%s=%v", change.Key, change.New)
+		}
+		registry.RecordEvent(event)
+	}
+}
+
+// configValues converts values to the configuration of the target
+func configValues(space tuning.Space, values tuning.Values) map[string]interface{} {
+	config := make(map[string]interface{}, len(values))
+	for _, p := range space {
+		value, ok := values[p.Key]
+		if !ok {
+			continue
+		}
+		if p.Integer {
+			config[p.Key] = int(math.Round(value))
+		} else {
+			config[p.Key] = value
+		}
+	}
+	return config
+}
+
+// searchTrials returns trials as the tuning package scores them, higher being
+// better
+func searchTrials(agent *Agent, trials []*TuningTrial) []tuning.Trial {
+	sign := 1.0
+	if agent.ConfigString("goal") == "minimize" {
+		sign = -1
+	}
+	searched := make([]tuning.Trial, 0, len(trials))
+	for _, trial := range trials {
+		if trial.Score == nil {
+			searched = append(searched, tuning.Trial{Values: trial.Values, Failed: true})
+			continue
+		}
+		searched = append(searched, tuning.Trial{Values: trial.Values, Score: sign * *trial.Score})
+	}
+	return searched
+}
+
+func bestConfiguration(agent *Agent, trials []*TuningTrial) *BestConfiguration {
+	values, score, ok := tuning.Best(searchTrials(agent, trials))
+	if !ok {
+		return nil
+	}
+	if agent.ConfigString("goal") == "minimize" {
+		score = -score
+	}
+	best := &BestConfiguration{Values: values, Score: score}
+	for _, trial := range trials {
+		if trial.Score != nil && trial.Values.Key() == values.Key() {
+			best.Trials++
+		}
+	}
+	return best
+}
+
+// metaLearningBehavior implements the metalearning agent type: it tries
+// values of the numeric options of its target, restarting the target with
+// each, and scores each trial by the metric the target reports with its
+// heartbeats
+type metaLearningBehavior struct {
+	agent     *Agent
+	configDir string
+	rng       *rand.Rand
+}
+
+func newMetaLearningBehavior(agent *Agent, configDir string) (Behavior, error) {
+	return &metaLearningBehavior{
+		agent:     agent,
+		configDir: configDir,
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+func (b *metaLearningBehavior) CycleInterval() time.Duration {
+	if d := b.agent.ConfigDuration("trial_duration"); d < metaCheckInterval {
+		return d
+	}
+	return metaCheckInterval
+}
+
+func (b *metaLearningBehavior) Cycle(now time.Time) error {
+	_, err := b.advance(now, false)
+	return err
+}
+
+func (b *metaLearningBehavior) HandleMessage(msg *Message) (*Message, error) {
+	switch msg.Type {
+	case MessageTypeCommand:
+		action, _ := msg.Payload["action"].(string)
+		if action != TrialAction {
+			return nil, fmt.Errorf("unknown metalearning action %q, expected %s", action, TrialAction)
+		}
+		trial, err := b.advance(time.Now(), true)
+		if err != nil {
+			return nil, err
+		}
+		if trial == nil {
+			return nil, fmt.Errorf("%s has finished searching", b.agent.Name)
+		}
+		return &Message{
+			Type:    MessageTypeResponse,
+			Payload: map[string]interface{}{"trial": trial},
+		}, nil
+	case MessageTypeHeartbeat, MessageTypeResponse:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("metalearning agents do not handle %s messages", msg.Type)
+}
+
+// advance ends the current trial once it has run for trial_duration, or
+// right away if forced, and starts the next one. It returns the trial
+// started, or nil if none was.
+func (b *metaLearningBehavior) advance(now time.Time, force bool) (*TuningTrial, error) {
+	state, err := loadMetaState(b.configDir, b.agent)
+	if err != nil {
+		return nil, err
+	}
+	if state.Applied != nil {
+		return nil, nil
+	}
+	current := state.Current
+	if current != nil && !force && now.Sub(current.Started) < b.agent.ConfigDuration("trial_duration") {
+		return nil, nil
+	}
+
+	registry, err := NewRegistry(b.configDir)
+	if err != nil {
+		return nil, err
+	}
+	target, err := TuningTarget(registry, b.agent)
+	if err != nil {
+		return nil, err
+	}
+	space, err := tuningSpace(b.agent, target)
+	if err != nil {
+		return nil, err
+	}
+
+	if current != nil {
+		b.score(current, target, now)
+		state.Trials = append(state.Trials, current)
+		state.Current = nil
+	}
+
+	var next *TuningTrial
+	if len(state.Trials) < b.agent.ConfigInt("max_trials") {
+		strategy, err := tuning.NewStrategy(b.agent.ConfigString("strategy"), b.rng)
+		if err != nil {
+			return nil, err
+		}
+		values, err := strategy.Next(space, searchTrials(b.agent, state.Trials))
+		switch {
+		case errors.Is(err, tuning.ErrExhausted):
+		case err != nil:
+			return nil, err
+		default:
+			next = &TuningTrial{Number: len(state.Trials) + 1, Values: values, Started: now}
+		}
+	}
+
+	if next != nil {
+		changes, err := target.UpdateConfig(configValues(space, next.Values), nil)
+		if err != nil {
+			return nil, err
+		}
+		reason := fmt.Sprintf("trial %d of %s", next.Number, b.agent.Name)
+		recordConfigChanges(registry, target, b.agent.Name, reason, changes)
+		if err := registry.Restart(target, b.agent.Name, reason); err != nil {
+			return nil, err
+		}
+		state.Current = next
+	}
+	if err := state.save(b.configDir, b.agent); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// score scores trial by the metric the target reported since it started
+func (b *metaLearningBehavior) score(trial *TuningTrial, target *Agent, now time.Time) {
+	trial.Ended = &now
+	metric := b.agent.ConfigString("metric")
+	if target.Metrics == nil || target.Metrics.LastHeartbeat.Before(trial.Started) {
+		trial.Error = fmt.Sprintf("%s sent no heartbeat during the trial", target.Name)
+		return
+	}
+	score, ok := target.Metrics.Reported[metric]
+	if !ok {
+		trial.Error = fmt.Sprintf("%s reported no %s during the trial", target.Name, metric)
+		return
+	}
+	trial.Score = &score
+}
@@ -0,0 +1,123 @@
+package opencog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetaLearningAgentTunesTarget(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	target, _ := NewAgent(AgentConfig{Name: "attention", Type: ECANAgent})
+	registry.Register(target)
+	registry.Transition(target, StatusStarting, "test", "")
+	registry.Transition(target, StatusRunning, "test", "")
+	registry.Update(target)
+
+	meta, err := NewAgent(AgentConfig{Name: "tuner", Type: MetaLearningAgent, Config: map[string]interface{}{
+		"strategy":       "grid",
+		"target":         "attention",
+		"parameters":     "af_size=10:30:10",
+		"trial_duration": "1m",
+		"max_trials":     3,
+	}})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+	registry.Register(meta)
+	behavior, _ := NewBehavior(meta, registry.Dir())
+	tuner := behavior.(*metaLearningBehavior)
+
+	start := time.Now().Add(-time.Hour)
+	heartbeat := func(score float64) {
+		t.Helper()
+		registry.Reload()
+		if err := registry.Heartbeat(target.ID, map[string]float64{"score": score}); err != nil {
+			t.Fatalf("Heartbeat failed: %v", err)
+		}
+	}
+	size := func() int {
+		registry.Reload()
+		agent, _ := registry.Get(target.ID)
+		return agent.ConfigInt("af_size")
+	}
+
+	trial, err := tuner.advance(start, false)
+	if err != nil || trial == nil || trial.Number != 1 || trial.Values["af_size"] != 10 {
+		t.Fatalf("Expected the first trial to start, got %+v, %v", trial, err)
+	}
+	if size() != 10 {
+		t.Errorf("Expected the target to run with af_size 10, got %d", size())
+	}
+	heartbeat(0.5)
+
+	if trial, _ := tuner.advance(start.Add(30*time.Second), false); trial != nil {
+		t.Errorf("Expected the trial to run for trial_duration, got %+v", trial)
+	}
+	trial, err = tuner.advance(start.Add(time.Minute), false)
+	if err != nil || trial == nil || trial.Values["af_size"] != 20 {
+		t.Fatalf("Expected the second trial to start, got %+v, %v", trial, err)
+	}
+	heartbeat(0.9)
+
+	// The score of the second trial is forgotten when the target restarts
+	if _, err := tuner.advance(start.Add(2*time.Minute), false); err != nil {
+		t.Fatalf("Third trial failed to start: %v", err)
+	}
+	if trial, err := tuner.advance(start.Add(2*time.Minute), true); trial != nil || err != nil {
+		t.Errorf("Expected the search to end after max_trials, got %+v, %v", trial, err)
+	}
+
+	trials, current, err := TuningTrials(registry.Dir(), meta)
+	if err != nil || len(trials) != 3 || current != nil {
+		t.Fatalf("Expected 3 trials, got %d, %+v, %v", len(trials), current, err)
+	}
+	if *trials[0].Score != 0.5 || *trials[1].Score != 0.9 || trials[2].Score != nil || !strings.Contains(trials[2].Error, "no score") {
+		t.Errorf("Unexpected trials %+v %+v %+v", trials[0], trials[1], trials[2])
+	}
+
+	registry.Reload()
+	best, changes, err := ApplyBestTuning(registry, meta, "test")
+	if err != nil {
+		t.Fatalf("ApplyBestTuning failed: %v", err)
+	}
+	if best.Values["af_size"] != 20 || best.Score != 0.9 || len(changes) != 1 || changes[0].New != 20 {
+		t.Errorf("Unexpected best configuration %+v and changes %+v", best, changes)
+	}
+	if size() != 20 {
+		t.Errorf("Expected the best af_size to be applied, got %d", size())
+	}
+	events, _ := registry.Events(target.ID, EventFilter{Kind: EventConfig})
+	if len(events) != 4 || events[3].To != "af_size=20" || events[0].Actor != "tuner" {
+		t.Errorf("Expected the trials and the best configuration to be recorded, got %+v", events)
+	}
+
+	if trial, err := tuner.advance(start.Add(time.Hour), true); trial != nil || err != nil {
+		t.Errorf("Expected no trials after the best configuration is applied, got %+v, %v", trial, err)
+	}
+	ResetTuning(registry.Dir(), meta)
+	if trial, err := tuner.advance(time.Now(), false); err != nil || trial == nil || trial.Number != 1 {
+		t.Errorf("Expected a reset to start the search anew, got %+v, %v", trial, err)
+	}
+}
+
+func TestMetaLearningAgentChecksParameters(t *testing.T) {
+	if _, err := NewAgent(AgentConfig{Name: "tuner", Type: MetaLearningAgent, Config: map[string]interface{}{
+		"parameters": "af_size=30:10",
+	}}); err == nil {
+		t.Error("Expected a malformed search space to be refused")
+	}
+
+	registry, _ := NewRegistry(t.TempDir())
+	target, _ := NewAgent(AgentConfig{Name: "kb", Type: AtomSpaceAgent})
+	registry.Register(target)
+	meta, _ := NewAgent(AgentConfig{Name: "tuner", Type: MetaLearningAgent, Config: map[string]interface{}{
+		"target":     "kb",
+		"parameters": "af_size=10:30",
+	}})
+	registry.Register(meta)
+	behavior, _ := NewBehavior(meta, registry.Dir())
+	if _, err := behavior.(*metaLearningBehavior).advance(time.Now(), false); err == nil || !strings.Contains(err.Error(), "no option af_size") {
+		t.Errorf("Expected options the target does not have to be refused, got %v", err)
+	}
+}
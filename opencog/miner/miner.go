@@ -0,0 +1,403 @@
+// Package miner mines frequent patterns from an AtomSpace. A pattern is a
+// conjunction of clauses: links in which some of the nodes are replaced by
+// variables. Its support is the number of ways its variables can be grounded
+// in the AtomSpace. Patterns grow one clause at a time: a frequent pattern is
+// extended with a frequent clause sharing one of its variables, and only the
+// extensions that are frequent in turn are grown further.
+package miner
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// Config holds the parameters of a mining run
+type Config struct {
+	// MinSupport is the least support of a frequent pattern
+	MinSupport int
+	// MaxSize is the most clauses in a pattern
+	MaxSize int
+}
+
+// Pattern is a frequent pattern. Its variables are named $1, $2 and so on,
+// in the order they first appear.
+type Pattern struct {
+	Clauses []atomspace.Tree `json:"clauses"`
+	Support int              `json:"support"`
+	// Surprisingness is how far the probability of the pattern is from what
+	// it would be if its clauses were independent, between 0 and 1. It is 0
+	// for patterns of one clause.
+	Surprisingness float64 `json:"surprisingness"`
+}
+
+// Body returns the pattern as a single tree: its clause, or an AndLink of
+// its clauses
+func (p Pattern) Body() atomspace.Tree {
+	if len(p.Clauses) == 1 {
+		return p.Clauses[0]
+	}
+	return atomspace.Tree{Type: atomspace.AndLink, Outgoing: p.Clauses}
+}
+
+// Key identifies the pattern up to the order of its clauses and the names of
+// its variables
+func (p Pattern) Key() string {
+	return clauseKey(p.Clauses)
+}
+
+func (p Pattern) String() string {
+	return p.Body().String()
+}
+
+// Miner mines the frequent patterns of an AtomSpace
+type Miner struct {
+	space   *atomspace.AtomSpace
+	config  Config
+	support map[string]int
+	// abstract holds the atoms that contain variables. Patterns are not
+	// grounded by them, so that mined patterns stored in the AtomSpace do
+	// not count as occurrences of themselves.
+	abstract map[atomspace.Handle]bool
+}
+
+// New creates a miner over space
+func New(space *atomspace.AtomSpace, config Config) *Miner {
+	if config.MinSupport < 1 {
+		config.MinSupport = 1
+	}
+	if config.MaxSize < 1 {
+		config.MaxSize = 1
+	}
+	m := &Miner{
+		space:    space,
+		config:   config,
+		support:  make(map[string]int),
+		abstract: make(map[atomspace.Handle]bool),
+	}
+	for _, h := range space.Handles() {
+		if tree, err := space.Tree(h); err == nil && hasVariables(tree) {
+			m.abstract[h] = true
+		}
+	}
+	return m
+}
+
+// Mine returns the frequent patterns, most surprising first, then most
+// frequent. Atoms holding variables, such as previously mined patterns, are
+// not mined.
+func (m *Miner) Mine() ([]Pattern, error) {
+	// Patterns of one clause abstract the links of the AtomSpace
+	var level []Pattern
+	seen := make(map[string]bool)
+	for _, h := range m.space.Handles() {
+		atom, _ := m.space.Get(h)
+		if !atom.IsLink() || m.abstract[h] {
+			continue
+		}
+		tree, err := m.space.Tree(h)
+		if err != nil {
+			return nil, err
+		}
+		for _, clause := range abstractions(tree.Bare()) {
+			clauses, key := canonical([]atomspace.Tree{clause})
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if p, ok := m.frequent(clauses, key); ok {
+				level = append(level, p)
+			}
+		}
+	}
+	sortPatterns(level)
+	clauses := level
+
+	var patterns []Pattern
+	for size := 1; len(level) > 0; size++ {
+		patterns = append(patterns, level...)
+		if size == m.config.MaxSize {
+			break
+		}
+
+		var next []Pattern
+		for _, p := range level {
+			for _, c := range clauses {
+				for _, extended := range extensions(p.Clauses, c.Clauses[0]) {
+					extended, key := canonical(extended)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+					if p, ok := m.frequent(extended, key); ok {
+						next = append(next, p)
+					}
+				}
+			}
+		}
+		sortPatterns(next)
+		level = next
+	}
+
+	for i := range patterns {
+		patterns[i].Surprisingness = m.surprisingness(patterns[i])
+	}
+	sort.SliceStable(patterns, func(i, j int) bool {
+		if patterns[i].Surprisingness != patterns[j].Surprisingness {
+			return patterns[i].Surprisingness > patterns[j].Surprisingness
+		}
+		return patterns[i].Support > patterns[j].Support
+	})
+	return patterns, nil
+}
+
+// frequent counts the support of a canonical pattern and reports whether it
+// reaches the minimum
+func (m *Miner) frequent(clauses []atomspace.Tree, key string) (Pattern, bool) {
+	support, ok := m.support[key]
+	if !ok {
+		body := Pattern{Clauses: clauses}.Body()
+		if q, err := atomspace.NewQuery(body); err == nil {
+			for _, grounding := range m.space.Match(q, 0) {
+				if m.concrete(grounding) {
+					support++
+				}
+			}
+		}
+		m.support[key] = support
+	}
+	return Pattern{Clauses: clauses, Support: support}, support >= m.config.MinSupport
+}
+
+// concrete reports whether a grounding binds no variable to an atom that
+// contains variables
+func (m *Miner) concrete(grounding map[string]atomspace.Handle) bool {
+	for _, h := range grounding {
+		if m.abstract[h] {
+			return false
+		}
+	}
+	return true
+}
+
+// surprisingness compares the probability of a pattern with the product of
+// the probabilities of its clauses. The probability of a pattern with k
+// variables is its support divided by N^k, N being the number of atoms
+// without variables: the chance that random atoms for its variables ground
+// it.
+func (m *Miner) surprisingness(p Pattern) float64 {
+	if len(p.Clauses) < 2 {
+		return 0
+	}
+	logN := math.Log(float64(m.space.Size() - len(m.abstract)))
+	logProb := func(clauses []atomspace.Tree, support int) float64 {
+		return math.Log(float64(support)) - float64(len(variables(clauses)))*logN
+	}
+
+	observed := logProb(p.Clauses, p.Support)
+	estimated := 0.0
+	for _, clause := range p.Clauses {
+		clauses, key := canonical([]atomspace.Tree{clause})
+		c, _ := m.frequent(clauses, key)
+		if c.Support == 0 {
+			return 1
+		}
+		estimated += logProb(clauses, c.Support)
+	}
+	// |p - e| / max(p, e), computed from the logarithms
+	return 1 - math.Exp(-math.Abs(observed-estimated))
+}
+
+// maxAbstractedLeaves bounds the number of abstractions of wide links: only
+// their first nodes are replaced with variables
+const maxAbstractedLeaves = 8
+
+// abstractions returns the clauses obtained by replacing some of the nodes
+// of tree with variables. At least one node is kept, so that every clause
+// says something beyond the type of its link.
+func abstractions(tree atomspace.Tree) []atomspace.Tree {
+	leaves := countLeaves(tree)
+	n := leaves
+	if n > maxAbstractedLeaves {
+		n = maxAbstractedLeaves
+	}
+
+	var clauses []atomspace.Tree
+	for mask := 1; mask < 1<<uint(n); mask++ {
+		if n == leaves && mask == 1<<uint(n)-1 {
+			continue
+		}
+		i := 0
+		clauses = append(clauses, abstract(tree, mask, &i))
+	}
+	return clauses
+}
+
+// abstract replaces the leaves of tree selected by mask with variables,
+// numbering them from i
+func abstract(tree atomspace.Tree, mask int, i *int) atomspace.Tree {
+	if !tree.Type.IsLink() {
+		leaf := *i
+		*i++
+		if mask&(1<<uint(leaf)) != 0 {
+			return variable(leaf + 1)
+		}
+		return tree
+	}
+	out := atomspace.Tree{Type: tree.Type}
+	for _, child := range tree.Outgoing {
+		out.Outgoing = append(out.Outgoing, abstract(child, mask, i))
+	}
+	return out
+}
+
+// extensions conjoins clause with pattern in every way that shares exactly
+// one variable between them
+func extensions(pattern []atomspace.Tree, clause atomspace.Tree) [][]atomspace.Tree {
+	if len(pattern) == 0 {
+		return nil
+	}
+	k := len(variables(pattern))
+	clauseVars := variables([]atomspace.Tree{clause})
+
+	// Give the clause fresh variables
+	fresh := make(map[string]string)
+	for i, v := range clauseVars {
+		fresh[v] = variable(k + i + 1).Name
+	}
+	clause = rename(clause, fresh)
+
+	var result [][]atomspace.Tree
+	for i := 1; i <= k; i++ {
+		for j := range clauseVars {
+			joined := rename(clause, map[string]string{variable(k + j + 1).Name: variable(i).Name})
+			duplicate := false
+			for _, c := range pattern {
+				if c.String() == joined.String() {
+					duplicate = true
+				}
+			}
+			if !duplicate {
+				result = append(result, append(append([]atomspace.Tree(nil), pattern...), joined))
+			}
+		}
+	}
+	return result
+}
+
+// canonical renames the variables of clauses in order of first appearance,
+// with the clauses in the order that gives the smallest key
+func canonical(clauses []atomspace.Tree) ([]atomspace.Tree, string) {
+	var best []atomspace.Tree
+	bestKey := ""
+	permute(clauses, 0, func(order []atomspace.Tree) {
+		renamed := renameInOrder(order)
+		key := clauseKey(renamed)
+		if best == nil || key < bestKey {
+			best, bestKey = renamed, key
+		}
+	})
+	return best, bestKey
+}
+
+// permute calls fn with every order of clauses from index i on. Patterns are
+// small, so trying every order is cheap.
+func permute(clauses []atomspace.Tree, i int, fn func([]atomspace.Tree)) {
+	if i == len(clauses) {
+		fn(append([]atomspace.Tree(nil), clauses...))
+		return
+	}
+	for j := i; j < len(clauses); j++ {
+		clauses[i], clauses[j] = clauses[j], clauses[i]
+		permute(clauses, i+1, fn)
+		clauses[i], clauses[j] = clauses[j], clauses[i]
+	}
+}
+
+func renameInOrder(clauses []atomspace.Tree) []atomspace.Tree {
+	names := make(map[string]string)
+	for i, v := range variables(clauses) {
+		names[v] = variable(i + 1).Name
+	}
+	renamed := make([]atomspace.Tree, len(clauses))
+	for i, clause := range clauses {
+		renamed[i] = rename(clause, names)
+	}
+	return renamed
+}
+
+func rename(tree atomspace.Tree, names map[string]string) atomspace.Tree {
+	if tree.Type == atomspace.VariableNode {
+		if name, ok := names[tree.Name]; ok {
+			tree.Name = name
+		}
+		return tree
+	}
+	out := atomspace.Tree{Type: tree.Type, Name: tree.Name}
+	for _, child := range tree.Outgoing {
+		out.Outgoing = append(out.Outgoing, rename(child, names))
+	}
+	return out
+}
+
+// variables returns the names of the variables of clauses in order of first
+// appearance
+func variables(clauses []atomspace.Tree) []string {
+	var names []string
+	seen := make(map[string]bool)
+	var walk func(atomspace.Tree)
+	walk = func(tree atomspace.Tree) {
+		if tree.Type == atomspace.VariableNode && !seen[tree.Name] {
+			seen[tree.Name] = true
+			names = append(names, tree.Name)
+		}
+		for _, child := range tree.Outgoing {
+			walk(child)
+		}
+	}
+	for _, clause := range clauses {
+		walk(clause)
+	}
+	return names
+}
+
+func variable(i int) atomspace.Tree {
+	return atomspace.Tree{Type: atomspace.VariableNode, Name: fmt.Sprintf("$%d", i)}
+}
+
+func hasVariables(tree atomspace.Tree) bool {
+	return len(variables([]atomspace.Tree{tree})) > 0
+}
+
+func countLeaves(tree atomspace.Tree) int {
+	if !tree.Type.IsLink() {
+		return 1
+	}
+	n := 0
+	for _, child := range tree.Outgoing {
+		n += countLeaves(child)
+	}
+	return n
+}
+
+func clauseKey(clauses []atomspace.Tree) string {
+	keys := make([]string, len(clauses))
+	for i, clause := range clauses {
+		keys[i] = clause.String()
+	}
+	return strings.Join(keys, " ")
+}
+
+// sortPatterns orders patterns by decreasing support, so that the most
+// frequent ones are grown first
+func sortPatterns(patterns []Pattern) {
+	sort.SliceStable(patterns, func(i, j int) bool {
+		if patterns[i].Support != patterns[j].Support {
+			return patterns[i].Support > patterns[j].Support
+		}
+		return patterns[i].Key() < patterns[j].Key()
+	})
+}
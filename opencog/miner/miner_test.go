@@ -0,0 +1,110 @@
+package miner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// pets returns an AtomSpace where every pet is a mammal that likes fish
+func pets(t *testing.T) *atomspace.AtomSpace {
+	t.Helper()
+	trees, err := atomspace.ParseScheme(strings.NewReader(`
+(InheritanceLink (ConceptNode "cat") (ConceptNode "mammal"))
+(InheritanceLink (ConceptNode "lion") (ConceptNode "mammal"))
+(InheritanceLink (ConceptNode "seal") (ConceptNode "mammal"))
+(InheritanceLink (ConceptNode "eagle") (ConceptNode "bird"))
+(EvaluationLink (PredicateNode "likes") (ListLink (ConceptNode "cat") (ConceptNode "fish")))
+(EvaluationLink (PredicateNode "likes") (ListLink (ConceptNode "seal") (ConceptNode "fish")))
+(EvaluationLink (PredicateNode "likes") (ListLink (ConceptNode "lion") (ConceptNode "fish")))
+(EvaluationLink (PredicateNode "likes") (ListLink (ConceptNode "eagle") (ConceptNode "mice")))
+`))
+	if err != nil {
+		t.Fatalf("ParseScheme failed: %v", err)
+	}
+	space := atomspace.New()
+	for _, tree := range trees {
+		space.AddTree(tree)
+	}
+	return space
+}
+
+func find(patterns []Pattern, pattern string) *Pattern {
+	for i := range patterns {
+		if patterns[i].String() == pattern {
+			return &patterns[i]
+		}
+	}
+	return nil
+}
+
+func TestMineSingleClauses(t *testing.T) {
+	patterns, err := New(pets(t), Config{MinSupport: 3, MaxSize: 1}).Mine()
+	if err != nil {
+		t.Fatalf("Mine failed: %v", err)
+	}
+
+	mammals := find(patterns, `(InheritanceLink (VariableNode "$1") (ConceptNode "mammal"))`)
+	if mammals == nil || mammals.Support != 3 {
+		t.Fatalf("Expected the three mammals to make a pattern, got %v", patterns)
+	}
+	if mammals.Surprisingness != 0 {
+		t.Errorf("Single clauses should not be surprising, got %v", mammals.Surprisingness)
+	}
+	if find(patterns, `(InheritanceLink (VariableNode "$1") (ConceptNode "bird"))`) != nil {
+		t.Error("Patterns below the minimum support should not be kept")
+	}
+	for _, p := range patterns {
+		if len(p.Clauses) != 1 {
+			t.Errorf("Patterns should be no larger than MaxSize, got %v", p)
+		}
+	}
+}
+
+func TestMineConjunctions(t *testing.T) {
+	patterns, err := New(pets(t), Config{MinSupport: 3, MaxSize: 2}).Mine()
+	if err != nil {
+		t.Fatalf("Mine failed: %v", err)
+	}
+
+	// Mammals like fish
+	fish := find(patterns, `(AndLink (EvaluationLink (PredicateNode "likes") (ListLink (VariableNode "$1") (ConceptNode "fish"))) (InheritanceLink (VariableNode "$1") (ConceptNode "mammal")))`)
+	if fish == nil {
+		t.Fatalf("Expected a pattern of mammals that like fish, got %v", patterns)
+	}
+	if fish.Support != 3 || fish.Surprisingness <= 0.5 {
+		t.Errorf("Expected a surprising pattern with support 3, got %+v", fish)
+	}
+	if patterns[0].Surprisingness == 0 {
+		t.Error("Patterns should be sorted most surprising first")
+	}
+}
+
+func TestMinedPatternsAreNotMined(t *testing.T) {
+	space := pets(t)
+	patterns, _ := New(space, Config{MinSupport: 3, MaxSize: 1}).Mine()
+	mammals := find(patterns, `(InheritanceLink (VariableNode "$1") (ConceptNode "mammal"))`)
+	space.AddTree(mammals.Body())
+
+	again, _ := New(space, Config{MinSupport: 3, MaxSize: 1}).Mine()
+	if p := find(again, mammals.String()); p == nil || p.Support != 3 {
+		t.Errorf("Stored patterns should not count as occurrences, got %+v", p)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	x := atomspace.Tree{Type: atomspace.VariableNode, Name: "$x"}
+	y := atomspace.Tree{Type: atomspace.VariableNode, Name: "$y"}
+	mammal := atomspace.Tree{Type: atomspace.ConceptNode, Name: "mammal"}
+	a := atomspace.Tree{Type: atomspace.InheritanceLink, Outgoing: []atomspace.Tree{x, mammal}}
+	b := atomspace.Tree{Type: atomspace.SimilarityLink, Outgoing: []atomspace.Tree{x, y}}
+	c := atomspace.Tree{Type: atomspace.InheritanceLink, Outgoing: []atomspace.Tree{y, mammal}}
+	d := atomspace.Tree{Type: atomspace.SimilarityLink, Outgoing: []atomspace.Tree{y, x}}
+
+	_, key1 := canonical([]atomspace.Tree{a, b})
+	_, key2 := canonical([]atomspace.Tree{d, c})
+	if key1 != key2 {
+		t.Errorf("Patterns equal up to renaming and order should have the same key:\n%s\n%s", key1, key2)
+	}
+}
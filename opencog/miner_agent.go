@@ -0,0 +1,224 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+	"github.com/github/hub/v2/opencog/internal/decode"
+	"github.com/github/hub/v2/opencog/miner"
+)
+
+func init() {
+	RegisterBehavior(PatternMinerAgent, newMinerBehavior)
+}
+
+// MineAction asks a pattern miner agent to mine its atomspace agent
+const MineAction = "mine"
+
+// PatternPredicate names the EvaluationLinks by which mined patterns are
+// published: (EvaluationLink (stv <surprisingness> <confidence>)
+// (PredicateNode "surprising-pattern") (LambdaLink <pattern>)), with the
+// confidence growing with the pattern's support
+const PatternPredicate = "surprising-pattern"
+
+// MiningRun records a mining run of a pattern miner agent
+type MiningRun struct {
+	Time time.Time `json:"time"`
+	// Knowledge is the name of the atomspace agent mined
+	Knowledge string          `json:"knowledge"`
+	Patterns  []miner.Pattern `json:"patterns"`
+	// Published is the number of patterns sent to the atomspace agent
+	// because they were new or their support changed
+	Published int `json:"published"`
+}
+
+// minerState is what a pattern miner agent keeps between runs
+type minerState struct {
+	// Published maps the keys of the patterns published to their support
+	Published map[string]int `json:"published,omitempty"`
+	LastRun   *MiningRun     `json:"last_run,omitempty"`
+}
+
+func minerStatePath(configDir string, agent *Agent) string {
+	return filepath.Join(configDir, "miner", agent.ID+".json")
+}
+
+func loadMinerState(configDir string, agent *Agent) (*minerState, error) {
+	state := &minerState{}
+	data, err := os.ReadFile(minerStatePath(configDir, agent))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read mining state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse mining state: %w", err)
+	}
+	return state, nil
+}
+
+func (s *minerState) save(configDir string, agent *Agent) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal mining state: %w", err)
+	}
+	path := minerStatePath(configDir, agent)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create mining state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write mining state: %w", err)
+	}
+	return nil
+}
+
+// LastMining returns the most recent run of a pattern miner agent, or nil if
+// it has not run yet
+func LastMining(configDir string, agent *Agent) (*MiningRun, error) {
+	state, err := loadMinerState(configDir, agent)
+	if err != nil {
+		return nil, err
+	}
+	return state.LastRun, nil
+}
+
+// DecodeMiningRun extracts the run from a pattern miner agent's reply
+func DecodeMiningRun(payload map[string]interface{}) (*MiningRun, error) {
+	run := &MiningRun{}
+	if err := decode.Payload(payload, "run", "mining run", run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// PatternTree returns the atom by which a mined pattern is published
+func PatternTree(p miner.Pattern) atomspace.Tree {
+	tv := atomspace.TruthValue{
+		Strength:   p.Surprisingness,
+		Confidence: atomspace.ConfidenceFromCount(float64(p.Support)),
+	}
+	return atomspace.Tree{
+		Type: atomspace.EvaluationLink,
+		TV:   &tv,
+		Outgoing: []atomspace.Tree{
+			{Type: atomspace.PredicateNode, Name: PatternPredicate},
+			{Type: atomspace.LambdaLink, Outgoing: []atomspace.Tree{p.Body()}},
+		},
+	}
+}
+
+// minerBehavior implements the patternminer agent type: on command it mines
+// the knowledge of its atomspace agent and publishes the most surprising
+// patterns back to it
+type minerBehavior struct {
+	agent     *Agent
+	configDir string
+	outbox    *Outbox
+}
+
+func newMinerBehavior(agent *Agent, configDir string) (Behavior, error) {
+	return &minerBehavior{agent: agent, configDir: configDir}, nil
+}
+
+func (b *minerBehavior) SetOutbox(outbox *Outbox) {
+	b.outbox = outbox
+}
+
+func (b *minerBehavior) HandleMessage(msg *Message) (*Message, error) {
+	switch msg.Type {
+	case MessageTypeCommand:
+		if action, _ := msg.Payload["action"].(string); action != MineAction {
+			return nil, fmt.Errorf("unknown patternminer action %q, expected %s", action, MineAction)
+		}
+		return b.mine()
+	case MessageTypeHeartbeat, MessageTypeResponse:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("patternminer agents do not handle %s messages", msg.Type)
+}
+
+// mine mines the knowledge of the agent's atomspace agent and replies with
+// the run
+func (b *minerBehavior) mine() (*Message, error) {
+	if b.outbox == nil {
+		return nil, fmt.Errorf("agent %s is not hosted", b.agent.Name)
+	}
+
+	registry, err := NewRegistry(b.configDir)
+	if err != nil {
+		return nil, err
+	}
+	kb, err := KnowledgeAgent(registry, b.agent)
+	if err != nil {
+		return nil, err
+	}
+	store, err := OpenAtomSpace(b.configDir, kb)
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []miner.Pattern
+	err = store.Read(func(space *atomspace.AtomSpace) error {
+		patterns, err = miner.New(space, miner.Config{
+			MinSupport: b.agent.ConfigInt("min_support"),
+			MaxSize:    b.agent.ConfigInt("max_pattern_size"),
+		}).Mine()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := loadMinerState(b.configDir, b.agent)
+	if err != nil {
+		return nil, err
+	}
+	if state.Published == nil {
+		state.Published = make(map[string]int)
+	}
+
+	// Publish the most surprising patterns, unless they were already
+	// published with the same support
+	var trees []atomspace.Tree
+	for i, p := range patterns {
+		if i == b.agent.ConfigInt("max_published") {
+			break
+		}
+		if support, ok := state.Published[p.Key()]; ok && support == p.Support {
+			continue
+		}
+		trees = append(trees, PatternTree(p))
+		state.Published[p.Key()] = p.Support
+	}
+	if len(trees) > 0 {
+		_, err := b.outbox.Request(&Message{
+			To:      kb.ID,
+			Type:    MessageTypeKnowledge,
+			Payload: map[string]interface{}{"atoms": trees},
+		}, publishTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to publish patterns to %s: %w", kb.Name, err)
+		}
+	}
+
+	run := &MiningRun{
+		Time:      time.Now(),
+		Knowledge: kb.Name,
+		Patterns:  patterns,
+		Published: len(trees),
+	}
+	state.LastRun = run
+	if err := state.save(b.configDir, b.agent); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Type:    MessageTypeResponse,
+		Payload: map[string]interface{}{"run": run},
+	}, nil
+}
@@ -0,0 +1,86 @@
+package opencog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+const minerKnowledge = `
+(InheritanceLink (ConceptNode "cat") (ConceptNode "mammal"))
+(InheritanceLink (ConceptNode "lion") (ConceptNode "mammal"))
+(EvaluationLink (PredicateNode "likes") (ListLink (ConceptNode "cat") (ConceptNode "fish")))
+(EvaluationLink (PredicateNode "likes") (ListLink (ConceptNode "lion") (ConceptNode "fish")))
+`
+
+func TestMinerAgentPublishesPatterns(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	kb, _ := NewAgent(AgentConfig{Name: "kb", Type: AtomSpaceAgent})
+	patterns, _ := NewAgent(AgentConfig{Name: "miner", Type: PatternMinerAgent, Config: map[string]interface{}{
+		"atomspace":        "kb",
+		"max_pattern_size": 2,
+		"max_published":    3,
+	}})
+	registry.Register(kb)
+	registry.Register(patterns)
+
+	orchestrator := NewOrchestrator(registry)
+	for _, agent := range []*Agent{kb, patterns} {
+		behavior, _ := NewBehavior(agent, registry.Dir())
+		orchestrator.Host(agent.ID, behavior)
+	}
+	orchestrator.RegisterAgent("client")
+
+	trees, _ := atomspace.ParseScheme(strings.NewReader(minerKnowledge))
+	orchestrator.Request(&Message{From: "client", To: kb.ID, Type: MessageTypeKnowledge, Payload: map[string]interface{}{"atoms": trees}}, 5*time.Second)
+
+	mine := func() *MiningRun {
+		t.Helper()
+		reply, err := orchestrator.Request(&Message{From: "client", To: patterns.ID, Type: MessageTypeCommand,
+			Payload: map[string]interface{}{"action": MineAction}}, 5*time.Second)
+		if err != nil {
+			t.Fatalf("Mining failed: %v", err)
+		}
+		run, err := DecodeMiningRun(reply.Payload)
+		if err != nil {
+			t.Fatalf("DecodeMiningRun failed: %v", err)
+		}
+		return run
+	}
+
+	run := mine()
+	if len(run.Patterns) == 0 || run.Published != 3 || run.Knowledge != "kb" {
+		t.Fatalf("Expected the 3 most surprising patterns to be published, got %+v", run)
+	}
+	for _, p := range run.Patterns {
+		if len(p.Clauses) > 2 || p.Support < 2 {
+			t.Errorf("Patterns should respect max_pattern_size and min_support, got %+v", p)
+		}
+	}
+
+	store, _ := OpenAtomSpace(registry.Dir(), kb)
+	store.Read(func(space *atomspace.AtomSpace) error {
+		h, ok := space.Find(PatternTree(run.Patterns[0]).Bare())
+		if !ok {
+			t.Fatal("The most surprising pattern should be published to the knowledge store")
+		}
+		if atom, _ := space.Get(h); atom.TV.Strength != run.Patterns[0].Surprisingness {
+			t.Errorf("Published patterns should carry their surprisingness, got %+v", atom.TV)
+		}
+		return nil
+	})
+
+	// Patterns already published are not sent again, and published patterns
+	// are not mined themselves
+	again := mine()
+	if again.Published != 0 || len(again.Patterns) != len(run.Patterns) {
+		t.Errorf("Expected the same patterns and nothing new to publish, got %d published of %d", again.Published, len(again.Patterns))
+	}
+
+	last, err := LastMining(registry.Dir(), patterns)
+	if err != nil || last == nil || len(last.Patterns) != len(run.Patterns) {
+		t.Errorf("Expected the last run to be saved, got %+v, %v", last, err)
+	}
+}
@@ -0,0 +1,214 @@
+// Package openpsi implements OpenPsi goal-driven action selection. Goals have
+// an urgency that grows while they are neglected. Rules state that in some
+// context an action serves a goal, with a weight saying how well it does.
+// Each step the selector picks the applicable rule that best serves the most
+// urgent goals, and performing its action makes its goal less urgent.
+package openpsi
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+	"github.com/github/hub/v2/opencog/internal/yamlmap"
+	"gopkg.in/yaml.v2"
+)
+
+// Goal is something an agent strives for
+type Goal struct {
+	Name string `yaml:"name" json:"name"`
+	// Urgency is how pressing the goal is at first, between 0 and 1
+	Urgency float64 `yaml:"urgency" json:"urgency"`
+	// Growth is added to the urgency every step
+	Growth float64 `yaml:"growth,omitempty" json:"growth,omitempty"`
+}
+
+// Action is a command sent to an agent
+type Action struct {
+	// Agent is the name of the agent that performs the action
+	Agent   string                 `yaml:"agent" json:"agent"`
+	Payload map[string]interface{} `yaml:"payload,omitempty" json:"payload,omitempty"`
+}
+
+// Rule states that in its context, its action serves its goal
+type Rule struct {
+	Name string `yaml:"name" json:"name"`
+	// Context is an Atomese pattern that must have a grounding for the rule
+	// to apply. Rules without a context always apply.
+	Context string `yaml:"context,omitempty" json:"context,omitempty"`
+	Action  Action `yaml:"action" json:"action"`
+	Goal    string `yaml:"goal" json:"goal"`
+	// Weight is how much of its goal's urgency the action relieves, between
+	// 0 and 1
+	Weight float64 `yaml:"weight" json:"weight"`
+}
+
+// Model holds the goals and rules of an agent
+type Model struct {
+	Goals []Goal `yaml:"goals" json:"goals"`
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// ParseModel parses goals and rules written in YAML
+func ParseModel(data []byte) (*Model, error) {
+	model := &Model{}
+	if err := yaml.UnmarshalStrict(data, model); err != nil {
+		return nil, err
+	}
+	// Payloads are sent as JSON, which needs string keys
+	for i := range model.Rules {
+		if payload := model.Rules[i].Action.Payload; payload != nil {
+			model.Rules[i].Action.Payload = yamlmap.StringKeys(payload).(map[string]interface{})
+		}
+	}
+	if err := model.Validate(); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// LoadModel reads goals and rules from a YAML file
+func LoadModel(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	model, err := ParseModel(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules in %s: %w", path, err)
+	}
+	return model, nil
+}
+
+// Validate checks that goals and rules are well-formed and that every rule
+// serves a declared goal
+func (m *Model) Validate() error {
+	goals := make(map[string]bool)
+	for _, goal := range m.Goals {
+		if goal.Name == "" {
+			return fmt.Errorf("goal has no name")
+		}
+		if goals[goal.Name] {
+			return fmt.Errorf("goal %s is declared twice", goal.Name)
+		}
+		if goal.Urgency < 0 || goal.Urgency > 1 {
+			return fmt.Errorf("goal %s: urgency must be between 0 and 1, got %g", goal.Name, goal.Urgency)
+		}
+		if goal.Growth < 0 {
+			return fmt.Errorf("goal %s: growth must not be negative, got %g", goal.Name, goal.Growth)
+		}
+		goals[goal.Name] = true
+	}
+
+	rules := make(map[string]bool)
+	for _, rule := range m.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule has no name")
+		}
+		if rules[rule.Name] {
+			return fmt.Errorf("rule %s is declared twice", rule.Name)
+		}
+		if !goals[rule.Goal] {
+			return fmt.Errorf("rule %s: unknown goal %q", rule.Name, rule.Goal)
+		}
+		if rule.Action.Agent == "" {
+			return fmt.Errorf("rule %s: action has no agent", rule.Name)
+		}
+		if rule.Weight <= 0 || rule.Weight > 1 {
+			return fmt.Errorf("rule %s: weight must be above 0 and at most 1, got %g", rule.Name, rule.Weight)
+		}
+		if rule.Context != "" {
+			if _, err := atomspace.ParseQuery(rule.Context); err != nil {
+				return fmt.Errorf("rule %s: invalid context: %w", rule.Name, err)
+			}
+		}
+		rules[rule.Name] = true
+	}
+	return nil
+}
+
+// Goal returns the goal with the given name
+func (m *Model) Goal(name string) (Goal, bool) {
+	for _, goal := range m.Goals {
+		if goal.Name == name {
+			return goal, true
+		}
+	}
+	return Goal{}, false
+}
+
+// Candidate is a rule that applied in a step, scored by how urgently its
+// action is needed
+type Candidate struct {
+	Rule  string  `json:"rule"`
+	Goal  string  `json:"goal"`
+	Score float64 `json:"score"`
+}
+
+// Selector chooses actions for the goals of a model
+type Selector struct {
+	Model *Model
+	// Urgency holds the current urgency of every goal
+	Urgency map[string]float64
+}
+
+// NewSelector creates a selector. Goals missing from urgency start with their
+// declared urgency, and goals that are no longer declared are dropped.
+func NewSelector(model *Model, urgency map[string]float64) *Selector {
+	current := make(map[string]float64, len(model.Goals))
+	for _, goal := range model.Goals {
+		if u, ok := urgency[goal.Name]; ok {
+			current[goal.Name] = u
+		} else {
+			current[goal.Name] = goal.Urgency
+		}
+	}
+	return &Selector{Model: model, Urgency: current}
+}
+
+// Grow makes every goal more urgent by its growth, up to 1
+func (s *Selector) Grow() {
+	for _, goal := range s.Model.Goals {
+		s.Urgency[goal.Name] = math.Min(1, s.Urgency[goal.Name]+goal.Growth)
+	}
+}
+
+// Select returns the rules whose context holds, best first, scored by their
+// weight times the urgency of their goal. The first rule with a positive
+// score is the one to act on, or none if there is no such rule. Ties are
+// broken by the order the rules were declared in.
+func (s *Selector) Select(holds func(Rule) (bool, error)) (*Rule, []Candidate, error) {
+	var candidates []Candidate
+	for _, rule := range s.Model.Rules {
+		ok, err := holds(rule)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		if ok {
+			candidates = append(candidates, Candidate{
+				Rule:  rule.Name,
+				Goal:  rule.Goal,
+				Score: rule.Weight * s.Urgency[rule.Goal],
+			})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+
+	if len(candidates) == 0 || candidates[0].Score <= 0 {
+		return nil, candidates, nil
+	}
+	for i := range s.Model.Rules {
+		if s.Model.Rules[i].Name == candidates[0].Rule {
+			return &s.Model.Rules[i], candidates, nil
+		}
+	}
+	return nil, candidates, nil
+}
+
+// Satisfy relieves the goal of a rule whose action was performed by the
+// rule's weight
+func (s *Selector) Satisfy(rule *Rule) {
+	s.Urgency[rule.Goal] *= 1 - rule.Weight
+}
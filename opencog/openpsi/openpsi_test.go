@@ -0,0 +1,110 @@
+package openpsi
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+const curiosity = `
+goals:
+  - name: understand
+    urgency: 0.8
+    growth: 0.1
+  - name: tidy
+    urgency: 0.5
+rules:
+  - name: reason
+    context: '(InheritanceLink (VariableNode "$x") (ConceptNode "animal"))'
+    action:
+      agent: reasoner
+      payload: {action: forward, options: {depth: 2}}
+    goal: understand
+    weight: 0.5
+  - name: compact
+    action:
+      agent: kb
+      payload: {action: compact}
+    goal: tidy
+    weight: 0.9
+`
+
+func TestParseModel(t *testing.T) {
+	model, err := ParseModel([]byte(curiosity))
+	if err != nil {
+		t.Fatalf("ParseModel failed: %v", err)
+	}
+	if len(model.Goals) != 2 || len(model.Rules) != 2 || model.Rules[0].Action.Agent != "reasoner" {
+		t.Fatalf("Unexpected model %+v", model)
+	}
+	if _, err := json.Marshal(model.Rules[0].Action.Payload); err != nil {
+		t.Errorf("Payloads should be encodable as JSON: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"unknown goal", "goals: [{name: a, urgency: 1}]\nrules: [{name: r, goal: b, weight: 1, action: {agent: x}}]", `unknown goal "b"`},
+		{"no agent", "goals: [{name: a, urgency: 1}]\nrules: [{name: r, goal: a, weight: 1}]", "action has no agent"},
+		{"weight", "goals: [{name: a, urgency: 1}]\nrules: [{name: r, goal: a, weight: 2, action: {agent: x}}]", "weight must be"},
+		{"urgency", "goals: [{name: a, urgency: 1.5}]", "urgency must be between 0 and 1"},
+		{"duplicate goal", "goals: [{name: a, urgency: 1}, {name: a, urgency: 1}]", "declared twice"},
+		{"context", "goals: [{name: a, urgency: 1}]\nrules: [{name: r, goal: a, weight: 1, context: '(Concept', action: {agent: x}}]", "invalid context"},
+		{"unknown field", "goals: [{name: a, urgency: 1, importance: 2}]", "importance"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseModel([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	model, _ := ParseModel([]byte(curiosity))
+	selector := NewSelector(model, nil)
+	always := func(Rule) (bool, error) { return true, nil }
+
+	// compact scores 0.9·0.5 = 0.45, reason 0.5·0.8 = 0.4
+	rule, candidates, err := selector.Select(always)
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if rule == nil || rule.Name != "compact" || len(candidates) != 2 || candidates[1].Rule != "reason" {
+		t.Fatalf("Expected compact then reason, got %v and %+v", rule, candidates)
+	}
+
+	// Acting on a goal makes it less urgent, and neglected goals grow
+	selector.Satisfy(rule)
+	if u := selector.Urgency["tidy"]; math.Abs(u-0.05) > 1e-9 {
+		t.Errorf("Expected tidy to drop to 0.05, got %v", u)
+	}
+	selector.Grow()
+	if u := selector.Urgency["understand"]; math.Abs(u-0.9) > 1e-9 {
+		t.Errorf("Expected understand to grow to 0.9, got %v", u)
+	}
+	if rule, _, _ := selector.Select(always); rule.Name != "reason" {
+		t.Errorf("Expected reason once tidy is satisfied, got %s", rule.Name)
+	}
+
+	// Rules whose context does not hold are not candidates
+	noContext := func(r Rule) (bool, error) { return r.Context == "", nil }
+	if rule, candidates, _ := selector.Select(noContext); rule.Name != "compact" || len(candidates) != 1 {
+		t.Errorf("Expected only compact to apply, got %+v", candidates)
+	}
+
+	// Urgency that was saved is kept, and goals that are gone are dropped
+	restored := NewSelector(model, map[string]float64{"understand": 0.2, "gone": 1})
+	if restored.Urgency["understand"] != 0.2 || restored.Urgency["tidy"] != 0.5 || len(restored.Urgency) != 2 {
+		t.Errorf("Unexpected urgency %v", restored.Urgency)
+	}
+	restored.Urgency["understand"], restored.Urgency["tidy"] = 0, 0
+	if rule, _, _ := restored.Select(always); rule != nil {
+		t.Errorf("Rules for goals without urgency should not be selected, got %s", rule.Name)
+	}
+}
@@ -0,0 +1,279 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+	"github.com/github/hub/v2/opencog/internal/decode"
+	"github.com/github/hub/v2/opencog/openpsi"
+)
+
+func init() {
+	RegisterBehavior(OpenPsiAgent, newOpenPsiBehavior)
+}
+
+// StepAction asks an OpenPsi agent to select and perform an action right away
+const StepAction = "step"
+
+// actionTimeout bounds how long an OpenPsi agent waits for an agent to
+// perform the action it selected
+const actionTimeout = 30 * time.Second
+
+// maxDecisions bounds the decision log of an OpenPsi agent
+const maxDecisions = 100
+
+// Decision records an action selection step of an OpenPsi agent
+type Decision struct {
+	Time time.Time `json:"time"`
+	// Urgency holds the urgency of every goal when the action was selected
+	Urgency map[string]float64 `json:"urgency"`
+	// Candidates holds the rules that applied, best first
+	Candidates []openpsi.Candidate `json:"candidates,omitempty"`
+	// Rule, Goal and Agent are empty if no action was selected
+	Rule    string                 `json:"rule,omitempty"`
+	Goal    string                 `json:"goal,omitempty"`
+	Agent   string                 `json:"agent,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+	// Error says why the action failed
+	Error string `json:"error,omitempty"`
+}
+
+// psiState is what an OpenPsi agent keeps between steps
+type psiState struct {
+	Urgency   map[string]float64 `json:"urgency,omitempty"`
+	Decisions []*Decision        `json:"decisions,omitempty"`
+}
+
+func psiStatePath(configDir string, agent *Agent) string {
+	return filepath.Join(configDir, "openpsi", agent.ID+".json")
+}
+
+func loadPsiState(configDir string, agent *Agent) (*psiState, error) {
+	state := &psiState{}
+	data, err := os.ReadFile(psiStatePath(configDir, agent))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read decision log: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse decision log: %w", err)
+	}
+	return state, nil
+}
+
+func (s *psiState) save(configDir string, agent *Agent) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal decision log: %w", err)
+	}
+	path := psiStatePath(configDir, agent)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create decision log directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write decision log: %w", err)
+	}
+	return nil
+}
+
+// DecisionLog returns the most recent decisions of an OpenPsi agent, oldest
+// first
+func DecisionLog(configDir string, agent *Agent) ([]*Decision, error) {
+	state, err := loadPsiState(configDir, agent)
+	if err != nil {
+		return nil, err
+	}
+	return state.Decisions, nil
+}
+
+// GoalUrgency returns the current urgency of the goals of an OpenPsi agent
+func GoalUrgency(configDir string, agent *Agent, model *openpsi.Model) (map[string]float64, error) {
+	state, err := loadPsiState(configDir, agent)
+	if err != nil {
+		return nil, err
+	}
+	return openpsi.NewSelector(model, state.Urgency).Urgency, nil
+}
+
+// PsiModel reads the goals and rules named by the "rules" option of an
+// OpenPsi agent. Relative paths are resolved against configDir.
+func PsiModel(configDir string, agent *Agent) (*openpsi.Model, error) {
+	path := agent.ConfigString("rules")
+	if path == "" {
+		return nil, fmt.Errorf("agent %s has no rules; set them with `hub agent config %s --set rules=<file>`", agent.Name, agent.Name)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	return openpsi.LoadModel(path)
+}
+
+// DecodeDecision extracts the decision from an OpenPsi agent's reply
+func DecodeDecision(payload map[string]interface{}) (*Decision, error) {
+	decision := &Decision{}
+	if err := decode.Payload(payload, "decision", "decision", decision); err != nil {
+		return nil, err
+	}
+	return decision, nil
+}
+
+// openPsiBehavior implements the openpsi agent type: every cycle it selects
+// the action that best serves its goals and commands an agent to perform it
+type openPsiBehavior struct {
+	agent     *Agent
+	configDir string
+	outbox    *Outbox
+}
+
+func newOpenPsiBehavior(agent *Agent, configDir string) (Behavior, error) {
+	return &openPsiBehavior{agent: agent, configDir: configDir}, nil
+}
+
+func (b *openPsiBehavior) SetOutbox(outbox *Outbox) {
+	b.outbox = outbox
+}
+
+func (b *openPsiBehavior) CycleInterval() time.Duration {
+	return b.agent.ConfigDuration("cycle_interval")
+}
+
+func (b *openPsiBehavior) Cycle(now time.Time) error {
+	_, err := b.step(now)
+	return err
+}
+
+func (b *openPsiBehavior) HandleMessage(msg *Message) (*Message, error) {
+	switch msg.Type {
+	case MessageTypeCommand:
+		if action, _ := msg.Payload["action"].(string); action != StepAction {
+			return nil, fmt.Errorf("unknown openpsi action %q, expected %s", action, StepAction)
+		}
+		decision, err := b.step(time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return &Message{
+			Type:    MessageTypeResponse,
+			Payload: map[string]interface{}{"decision": decision},
+		}, nil
+	case MessageTypeHeartbeat, MessageTypeResponse:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("openpsi agents do not handle %s messages", msg.Type)
+}
+
+// step lets the goals grow more urgent, selects the rule that best serves
+// them, commands its agent to perform its action and logs the decision
+func (b *openPsiBehavior) step(now time.Time) (*Decision, error) {
+	if b.outbox == nil {
+		return nil, fmt.Errorf("agent %s is not hosted", b.agent.Name)
+	}
+	model, err := PsiModel(b.configDir, b.agent)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := NewRegistry(b.configDir)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadPsiState(b.configDir, b.agent)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := openpsi.NewSelector(model, state.Urgency)
+	selector.Grow()
+	decision := &Decision{Time: now, Urgency: make(map[string]float64)}
+	for goal, urgency := range selector.Urgency {
+		decision.Urgency[goal] = urgency
+	}
+
+	rule, candidates, err := selector.Select(b.contextHolds(registry))
+	if err != nil {
+		return nil, err
+	}
+	decision.Candidates = candidates
+	if rule != nil {
+		decision.Rule, decision.Goal, decision.Agent = rule.Name, rule.Goal, rule.Action.Agent
+		decision.Payload = rule.Action.Payload
+		if err := b.perform(registry, rule.Action); err != nil {
+			decision.Error = err.Error()
+		} else {
+			selector.Satisfy(rule)
+		}
+	}
+
+	state.Urgency = selector.Urgency
+	state.Decisions = append(state.Decisions, decision)
+	if len(state.Decisions) > maxDecisions {
+		state.Decisions = state.Decisions[len(state.Decisions)-maxDecisions:]
+	}
+	if err := state.save(b.configDir, b.agent); err != nil {
+		return nil, err
+	}
+	return decision, nil
+}
+
+// contextHolds returns a function telling whether the context of a rule has
+// a grounding in the knowledge of the agent's atomspace agent
+func (b *openPsiBehavior) contextHolds(registry *Registry) func(openpsi.Rule) (bool, error) {
+	var store *AtomSpaceStore
+	return func(rule openpsi.Rule) (bool, error) {
+		if rule.Context == "" {
+			return true, nil
+		}
+		if store == nil {
+			kb, err := KnowledgeAgent(registry, b.agent)
+			if err != nil {
+				return false, err
+			}
+			if store, err = OpenAtomSpace(b.configDir, kb); err != nil {
+				return false, err
+			}
+		}
+
+		q, err := atomspace.ParseQuery(rule.Context)
+		if err != nil {
+			return false, err
+		}
+		holds := false
+		err = store.Read(func(space *atomspace.AtomSpace) error {
+			holds = len(space.Match(q, 1)) > 0
+			return nil
+		})
+		return holds, err
+	}
+}
+
+// perform commands the agent of action, or GitHub, to perform it and waits
+// for it to reply
+func (b *openPsiBehavior) perform(registry *Registry, action openpsi.Action) error {
+	to := GitHubID
+	if action.Agent != GitHubID {
+		target, err := registry.GetByName(action.Agent)
+		if err != nil {
+			return err
+		}
+		if target.ID == b.agent.ID {
+			return fmt.Errorf("agent %s cannot command itself", b.agent.Name)
+		}
+		to = target.ID
+	}
+
+	payload := make(map[string]interface{}, len(action.Payload))
+	for key, value := range action.Payload {
+		payload[key] = value
+	}
+	_, err := b.outbox.Request(&Message{
+		To:      to,
+		Type:    MessageTypeCommand,
+		Payload: payload,
+	}, actionTimeout)
+	return err
+}
@@ -0,0 +1,133 @@
+package opencog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+const psiRules = `
+goals:
+  - name: understand
+    urgency: 0.8
+  - name: explore
+    urgency: 0.6
+rules:
+  - name: reason
+    context: '(InheritanceLink (ConceptNode "cat") (VariableNode "$x"))'
+    action:
+      agent: reasoner
+      payload: {action: forward}
+    goal: understand
+    weight: 0.5
+  - name: wander
+    context: '(InheritanceLink (ConceptNode "dog") (VariableNode "$x"))'
+    action:
+      agent: reasoner
+      payload: {action: forward}
+    goal: understand
+    weight: 1
+  - name: ask
+    action:
+      agent: ghost
+    goal: explore
+    weight: 0.5
+`
+
+// psiSetup hosts the agents of reasoningSetup and an openpsi agent whose
+// rules command the pln agent
+func psiSetup(t *testing.T) (*Orchestrator, *Registry, *Agent) {
+	t.Helper()
+	orchestrator, registry, _, _ := reasoningSetup(t)
+	if err := os.WriteFile(filepath.Join(registry.Dir(), "psi.yaml"), []byte(psiRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	psi, _ := NewAgent(AgentConfig{Name: "psi", Type: OpenPsiAgent, Config: map[string]interface{}{
+		"rules":     "psi.yaml",
+		"atomspace": "kb",
+	}})
+	registry.Register(psi)
+	behavior, _ := NewBehavior(psi, registry.Dir())
+	orchestrator.Host(psi.ID, behavior)
+	return orchestrator, registry, psi
+}
+
+func step(t *testing.T, orchestrator *Orchestrator, psi *Agent) *Decision {
+	t.Helper()
+	reply, err := orchestrator.Request(&Message{From: "client", To: psi.ID, Type: MessageTypeCommand,
+		Payload: map[string]interface{}{"action": StepAction}}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Step failed: %v", err)
+	}
+	decision, err := DecodeDecision(reply.Payload)
+	if err != nil {
+		t.Fatalf("DecodeDecision failed: %v", err)
+	}
+	return decision
+}
+
+func TestOpenPsiAgentDispatchesActions(t *testing.T) {
+	orchestrator, registry, psi := psiSetup(t)
+
+	decision := step(t, orchestrator, psi)
+	if decision.Rule != "reason" || decision.Agent != "reasoner" || decision.Error != "" {
+		t.Fatalf("Expected the reason rule to be performed, got %+v", decision)
+	}
+	if len(decision.Candidates) != 2 {
+		t.Errorf("Rules whose context does not hold should not be candidates, got %+v", decision.Candidates)
+	}
+
+	// The pln agent performed the action
+	kb, _ := registry.GetByName("kb")
+	store, _ := OpenAtomSpace(registry.Dir(), kb)
+	store.Read(func(space *atomspace.AtomSpace) error {
+		cat, _ := space.Node(atomspace.ConceptNode, "cat")
+		animal, _ := space.Node(atomspace.ConceptNode, "animal")
+		if _, ok := space.Link(atomspace.InheritanceLink, cat, animal); !ok {
+			t.Error("The commanded agent should have reasoned")
+		}
+		return nil
+	})
+
+	// Performing the action halved the urgency of its goal, so a failing
+	// action for another goal comes next
+	decision = step(t, orchestrator, psi)
+	if decision.Urgency["understand"] != 0.4 || decision.Rule != "ask" {
+		t.Fatalf("Expected ask once understand is less urgent, got %+v", decision)
+	}
+	if !strings.Contains(decision.Error, "ghost") {
+		t.Errorf("Expected the failure to be logged, got %q", decision.Error)
+	}
+
+	model, err := PsiModel(registry.Dir(), psi)
+	if err != nil {
+		t.Fatalf("PsiModel failed: %v", err)
+	}
+	urgency, _ := GoalUrgency(registry.Dir(), psi, model)
+	if urgency["explore"] != 0.6 {
+		t.Errorf("Failed actions should not relieve their goal, got %v", urgency)
+	}
+
+	log, err := DecisionLog(registry.Dir(), psi)
+	if err != nil {
+		t.Fatalf("DecisionLog failed: %v", err)
+	}
+	if len(log) != 2 || log[0].Rule != "reason" || log[1].Rule != "ask" {
+		t.Errorf("Expected both decisions in the log, got %+v", log)
+	}
+}
+
+func TestOpenPsiAgentNeedsRules(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	psi, _ := NewAgent(AgentConfig{Name: "psi", Type: OpenPsiAgent})
+	registry.Register(psi)
+
+	if _, err := PsiModel(registry.Dir(), psi); err == nil || !strings.Contains(err.Error(), "has no rules") {
+		t.Errorf("Expected an error for an agent without rules, got %v", err)
+	}
+}
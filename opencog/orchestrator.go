@@ -3,16 +3,42 @@ package opencog
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Orchestrator manages multi-agent coordination and communication
 type Orchestrator struct {
-	registry  *Registry
-	channels  map[string]chan *Message
-	mu        sync.RWMutex
-	running   bool
-	stopCh    chan struct{}
+	// CheckInterval is the time between coordination ticks and
+	// HeartbeatTimeout is how long a running agent without an active
+	// liveness probe may go without a heartbeat. Both must be set before
+	// Start is called.
+	CheckInterval    time.Duration
+	HeartbeatTimeout time.Duration
+
+	registry *Registry
+	channels map[string]chan *Message
+	held     map[string][]*Message
+	paused   map[string]bool
+	hosted   map[string]bool
+	// hostedConfig holds the configuration each hosted agent was created with
+	hostedConfig map[string]string
+	samples      map[string]*SampleBuffer
+	// traffic counts the messages sent between agents since the last flush
+	traffic map[flowKey]*Flow
+	mu      sync.RWMutex
+	running bool
+	stopCh  chan struct{}
+
+	// pending maps the IDs of requests to the channels awaiting their replies
+	pending map[string]chan *Message
+	// scheduled holds the names of the schedules with a run in progress, and
+	// scheduleMu serializes the updates of their state
+	scheduled  map[string]bool
+	scheduleMu sync.Mutex
+
+	// cluster is the orchestrator's part in a cluster, if it is in one
+	cluster *clusterNode
 }
 
 // Message represents communication between agents
@@ -23,6 +49,11 @@ type Message struct {
 	Type      MessageType            `json:"type"`
 	Payload   map[string]interface{} `json:"payload"`
 	Timestamp time.Time              `json:"timestamp"`
+	// ReplyTo is the ID of the message this one answers
+	ReplyTo string `json:"reply_to,omitempty"`
+	// OnBehalfOf is the ID of the agent a message was forwarded for, such
+	// as the sender of a message a broker routed
+	OnBehalfOf string `json:"on_behalf_of,omitempty"`
 }
 
 // MessageType defines types of inter-agent messages
@@ -40,9 +71,19 @@ const (
 // NewOrchestrator creates a new multi-agent orchestrator
 func NewOrchestrator(registry *Registry) *Orchestrator {
 	return &Orchestrator{
-		registry: registry,
-		channels: make(map[string]chan *Message),
-		stopCh:   make(chan struct{}),
+		CheckInterval:    5 * time.Second,
+		HeartbeatTimeout: 30 * time.Second,
+		registry:         registry,
+		channels:         make(map[string]chan *Message),
+		held:             make(map[string][]*Message),
+		paused:           make(map[string]bool),
+		hosted:           make(map[string]bool),
+		hostedConfig:     make(map[string]string),
+		samples:          make(map[string]*SampleBuffer),
+		traffic:          make(map[flowKey]*Flow),
+		pending:          make(map[string]chan *Message),
+		scheduled:        make(map[string]bool),
+		stopCh:           make(chan struct{}),
 	}
 }
 
@@ -56,15 +97,21 @@ func (o *Orchestrator) Start() error {
 	}
 
 	o.running = true
-	
+
 	// Start coordination goroutine
 	go o.coordinationLoop()
+	go o.mailboxLoop()
 
 	return nil
 }
 
 // Stop halts the orchestrator
 func (o *Orchestrator) Stop() error {
+	if o.cluster != nil {
+		// Forwarded messages must not arrive once channels are closed
+		o.cluster.leave()
+	}
+
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
@@ -80,6 +127,8 @@ func (o *Orchestrator) Stop() error {
 		close(ch)
 	}
 	o.channels = make(map[string]chan *Message)
+	o.hosted = make(map[string]bool)
+	o.hostedConfig = make(map[string]string)
 
 	return nil
 }
@@ -109,13 +158,95 @@ func (o *Orchestrator) UnregisterAgent(agentID string) error {
 
 	close(ch)
 	delete(o.channels, agentID)
+	delete(o.held, agentID)
+	delete(o.paused, agentID)
+	delete(o.hosted, agentID)
+	delete(o.hostedConfig, agentID)
 	return nil
 }
 
-// SendMessage sends a message from one agent to another
-func (o *Orchestrator) SendMessage(msg *Message) error {
+// maxHeldMessages bounds the number of messages held for a paused agent
+const maxHeldMessages = 1000
+
+// PauseAgent holds messages addressed to an agent instead of delivering them
+// until ResumeAgent is called
+func (o *Orchestrator) PauseAgent(agentID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, exists := o.channels[agentID]; !exists {
+		return fmt.Errorf("agent %s is not registered", agentID)
+	}
+
+	o.paused[agentID] = true
+	return nil
+}
+
+// ResumeAgent delivers the messages held for a paused agent, in the order
+// they were sent, and resumes normal delivery. Messages that do not fit in
+// the agent's queue remain held until the next resume.
+func (o *Orchestrator) ResumeAgent(agentID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ch, exists := o.channels[agentID]
+	if !exists {
+		return fmt.Errorf("agent %s is not registered", agentID)
+	}
+
+	delete(o.paused, agentID)
+
+	held := o.held[agentID]
+	delivered := 0
+flush:
+	for delivered < len(held) {
+		select {
+		case ch <- held[delivered]:
+			delivered++
+		default:
+			break flush
+		}
+	}
+
+	if delivered == len(held) {
+		delete(o.held, agentID)
+		return nil
+	}
+	o.held[agentID] = held[delivered:]
+	return fmt.Errorf("agent %s message queue is full, %d messages still held", agentID, len(held)-delivered)
+}
+
+// HeldMessages returns the number of messages held for a paused agent
+func (o *Orchestrator) HeldMessages(agentID string) int {
 	o.mu.RLock()
 	defer o.mu.RUnlock()
+	return len(o.held[agentID])
+}
+
+// hold keeps msg for a paused agent. The caller must hold the write lock.
+func (o *Orchestrator) hold(agentID string, msg *Message) error {
+	if len(o.held[agentID]) >= maxHeldMessages {
+		return fmt.Errorf("agent %s is paused and its held message queue is full", agentID)
+	}
+	o.held[agentID] = append(o.held[agentID], msg)
+	return nil
+}
+
+// SendMessage sends a message from one agent to another. In a cluster,
+// messages to agents on other nodes are forwarded to their node.
+func (o *Orchestrator) SendMessage(msg *Message) error {
+	if o.cluster != nil {
+		if node, ok := o.cluster.nodeOf(msg.To); ok {
+			return o.cluster.forward(node, msg)
+		}
+	}
+	return o.sendLocal(msg)
+}
+
+// sendLocal sends msg to an agent registered with this orchestrator
+func (o *Orchestrator) sendLocal(msg *Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 
 	ch, exists := o.channels[msg.To]
 	if !exists {
@@ -126,6 +257,18 @@ func (o *Orchestrator) SendMessage(msg *Message) error {
 	if msg.ID == "" {
 		msg.ID = generateMessageID()
 	}
+	o.countMessage(msg)
+
+	// Replies to requests go to whoever is waiting for them
+	if waiter, ok := o.pending[msg.ReplyTo]; ok && msg.ReplyTo != "" {
+		delete(o.pending, msg.ReplyTo)
+		waiter <- msg
+		return nil
+	}
+
+	if o.paused[msg.To] {
+		return o.hold(msg.To, msg)
+	}
 
 	select {
 	case ch <- msg:
@@ -137,8 +280,8 @@ func (o *Orchestrator) SendMessage(msg *Message) error {
 
 // BroadcastMessage sends a message to all registered agents
 func (o *Orchestrator) BroadcastMessage(from string, msgType MessageType, payload map[string]interface{}) error {
-	o.mu.RLock()
-	defer o.mu.RUnlock()
+	o.mu.Lock()
+	defer o.mu.Unlock()
 
 	msg := &Message{
 		ID:        generateMessageID(),
@@ -155,6 +298,14 @@ func (o *Orchestrator) BroadcastMessage(from string, msgType MessageType, payloa
 
 		msgCopy := *msg
 		msgCopy.To = agentID
+		o.countMessage(&msgCopy)
+
+		if o.paused[agentID] {
+			if err := o.hold(agentID, &msgCopy); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+			continue
+		}
 
 		select {
 		case ch <- &msgCopy:
@@ -170,7 +321,7 @@ func (o *Orchestrator) BroadcastMessage(from string, msgType MessageType, payloa
 
 // coordinationLoop is the main coordination routine
 func (o *Orchestrator) coordinationLoop() {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(o.CheckInterval)
 	defer ticker.Stop()
 
 	for {
@@ -178,29 +329,152 @@ func (o *Orchestrator) coordinationLoop() {
 		case <-o.stopCh:
 			return
 		case <-ticker.C:
+			// Pick up agents created or changed by other processes
+			o.registry.Reload()
+			if o.cluster != nil {
+				o.cluster.tick(time.Now())
+			}
+			o.hostAgents()
+			o.syncPaused()
+			o.sampleResources()
+			o.enforceLimits()
 			o.performHealthChecks()
+			// Schedules run once in a cluster, on its coordinator
+			if o.cluster == nil || o.cluster.coordinates() {
+				o.runSchedules(time.Now())
+			}
+			o.FlushTraffic()
+		}
+	}
+}
+
+// syncPaused pauses and resumes message delivery to match the status of the
+// agents in the registry, which may have been changed by another process
+func (o *Orchestrator) syncPaused() {
+	for _, agent := range o.registry.List() {
+		o.mu.RLock()
+		_, registered := o.channels[agent.ID]
+		paused := o.paused[agent.ID]
+		o.mu.RUnlock()
+
+		if !registered {
+			continue
+		}
+		if agent.Status == StatusPaused && !paused {
+			o.PauseAgent(agent.ID)
+		} else if agent.Status != StatusPaused && paused {
+			o.ResumeAgent(agent.ID)
 		}
 	}
 }
 
-// performHealthChecks checks the health of all agents
+// performHealthChecks checks the health of all agents. Agents with an active
+// liveness probe are probed; the others are judged by heartbeat staleness.
+// Readiness probes run independently of liveness.
 func (o *Orchestrator) performHealthChecks() {
 	agents := o.registry.List()
-	
+	now := time.Now()
+
 	for _, agent := range agents {
-		if agent.Status == StatusRunning {
+		if agent.Status != StatusRunning || !o.supervises(agent) {
+			continue
+		}
+
+		previous := HealthUnknown
+		if agent.Health != nil {
+			previous = agent.Health.State
+		}
+
+		changed := false
+		if agent.Liveness.Active() {
+			changed = o.probeLiveness(agent, now)
+		} else if agent.Metrics != nil {
 			// Check if agent is still responding
-			if agent.Metrics != nil {
-				timeSinceHeartbeat := time.Since(agent.Metrics.LastHeartbeat)
-				if timeSinceHeartbeat > 30*time.Second {
-					// Agent may be unresponsive
-					agent.Status = StatusError
-					agent.UpdatedAt = time.Now()
-					o.registry.Update(agent)
-				}
+			timeSinceHeartbeat := now.Sub(agent.Metrics.LastHeartbeat)
+			if timeSinceHeartbeat > o.HeartbeatTimeout {
+				// Agent may be unresponsive
+				o.registry.Transition(agent, StatusError, ActorOrchestrator,
+					fmt.Sprintf("no heartbeat for %s", timeSinceHeartbeat.Round(time.Second)))
+				changed = true
 			}
 		}
+
+		if agent.Status == StatusRunning && agent.Readiness.Active() {
+			changed = o.probeReadiness(agent, now) || changed
+		}
+
+		if agent.Health != nil && agent.Health.State != previous {
+			reason := ""
+			if agent.Health.State != HealthHealthy {
+				reason = agent.Health.LastError
+			}
+			o.registry.RecordEvent(Event{
+				AgentID: agent.ID,
+				Actor:   ActorOrchestrator,
+				Kind:    EventHealth,
+				From:    string(previous),
+				To:      string(agent.Health.State),
+				Reason:  reason,
+			})
+		}
+
+		if changed {
+			agent.UpdatedAt = time.Now()
+			o.registry.Update(agent)
+		}
+	}
+}
+
+// probeLiveness runs the agent's liveness probe if it is due. An agent whose
+// probe fails FailureThreshold times in a row is marked as errored; fewer
+// failures leave it running but degraded.
+func (o *Orchestrator) probeLiveness(agent *Agent, now time.Time) bool {
+	health := agent.health()
+	if health.LastLiveness != nil && now.Sub(*health.LastLiveness) < agent.Liveness.IntervalDuration() {
+		return false
+	}
+
+	err := agent.Liveness.Probe(agent)
+	health.LastLiveness = &now
+	if err != nil {
+		health.LivenessFailures++
+		health.LastError = err.Error()
+		if health.LivenessFailures >= agent.Liveness.Threshold() {
+			o.registry.Transition(agent, StatusError, ActorOrchestrator,
+				fmt.Sprintf("liveness probe failed %d times: %v", health.LivenessFailures, err))
+		}
+	} else {
+		health.LivenessFailures = 0
 	}
+
+	health.updateState()
+	return true
+}
+
+// probeReadiness runs the agent's readiness probe if it is due. The agent
+// becomes ready on the first success and not ready after FailureThreshold
+// consecutive failures.
+func (o *Orchestrator) probeReadiness(agent *Agent, now time.Time) bool {
+	health := agent.health()
+	if health.LastReadiness != nil && now.Sub(*health.LastReadiness) < agent.Readiness.IntervalDuration() {
+		return false
+	}
+
+	err := agent.Readiness.Probe(agent)
+	health.LastReadiness = &now
+	if err != nil {
+		health.ReadinessFailures++
+		health.LastError = err.Error()
+		if health.ReadinessFailures >= agent.Readiness.Threshold() {
+			health.Ready = false
+		}
+	} else {
+		health.ReadinessFailures = 0
+		health.Ready = true
+	}
+
+	health.updateState()
+	return true
 }
 
 // GetAgentChannel returns the message channel for an agent
@@ -218,5 +492,8 @@ func (o *Orchestrator) GetAgentChannel(agentID string) (chan *Message, error) {
 
 // generateMessageID generates a unique message identifier
 func generateMessageID() string {
-	return fmt.Sprintf("msg-%d", time.Now().UnixNano())
+	return fmt.Sprintf("msg-%d-%d", time.Now().UnixNano(), atomic.AddUint64(&messageSeq, 1))
 }
+
+// messageSeq keeps message IDs generated within the same nanosecond apart
+var messageSeq uint64
@@ -261,3 +261,92 @@ func TestMessageIDGeneration(t *testing.T) {
 		t.Error("Generated message IDs should be unique")
 	}
 }
+
+func TestOrchestratorPauseHoldsMessages(t *testing.T) {
+	registry, err := NewRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.RegisterAgent("sender")
+	orchestrator.RegisterAgent("sleeper")
+
+	if err := orchestrator.PauseAgent("sleeper"); err != nil {
+		t.Fatalf("PauseAgent failed: %v", err)
+	}
+
+	for _, command := range []string{"first", "second"} {
+		err := orchestrator.SendMessage(&Message{
+			From:    "sender",
+			To:      "sleeper",
+			Type:    MessageTypeCommand,
+			Payload: map[string]interface{}{"command": command},
+		})
+		if err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+	orchestrator.BroadcastMessage("sender", MessageTypeKnowledge, map[string]interface{}{})
+
+	ch, _ := orchestrator.GetAgentChannel("sleeper")
+	if len(ch) != 0 {
+		t.Errorf("Paused agent should not receive messages, got %d", len(ch))
+	}
+	if held := orchestrator.HeldMessages("sleeper"); held != 3 {
+		t.Errorf("Expected 3 held messages, got %d", held)
+	}
+
+	if err := orchestrator.ResumeAgent("sleeper"); err != nil {
+		t.Fatalf("ResumeAgent failed: %v", err)
+	}
+	if orchestrator.HeldMessages("sleeper") != 0 {
+		t.Error("Resume should deliver held messages")
+	}
+
+	first := <-ch
+	if first.Payload["command"] != "first" {
+		t.Errorf("Held messages should be delivered in order, got %v", first.Payload)
+	}
+	second := <-ch
+	if second.Payload["command"] != "second" {
+		t.Errorf("Held messages should be delivered in order, got %v", second.Payload)
+	}
+	if third := <-ch; third.Type != MessageTypeKnowledge {
+		t.Errorf("Expected held broadcast, got %s", third.Type)
+	}
+}
+
+func TestOrchestratorPauseUnknownAgent(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	orchestrator := NewOrchestrator(registry)
+
+	if err := orchestrator.PauseAgent("ghost"); err == nil {
+		t.Error("PauseAgent should fail for an unregistered agent")
+	}
+	if err := orchestrator.ResumeAgent("ghost"); err == nil {
+		t.Error("ResumeAgent should fail for an unregistered agent")
+	}
+}
+
+func TestOrchestratorSyncPaused(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "synced", Type: AtomSpaceAgent})
+	agent.Status = StatusPaused
+	registry.Register(agent)
+
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.RegisterAgent(agent.ID)
+
+	orchestrator.syncPaused()
+	orchestrator.SendMessage(&Message{From: "x", To: agent.ID, Type: MessageTypeCommand})
+	if orchestrator.HeldMessages(agent.ID) != 1 {
+		t.Fatal("Messages to an agent paused in the registry should be held")
+	}
+
+	agent.Status = StatusRunning
+	orchestrator.syncPaused()
+	if orchestrator.HeldMessages(agent.ID) != 0 {
+		t.Error("Messages should be released once the agent is no longer paused")
+	}
+}
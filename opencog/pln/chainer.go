@@ -0,0 +1,451 @@
+package pln
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// Config controls an inference run
+type Config struct {
+	// MaxSteps is the number of rule applications allowed per run, or zero
+	// for no limit
+	MaxSteps int
+	// MaxDepth bounds how many levels of subgoals backward chaining explores
+	MaxDepth int
+	// MinConfidence discards conclusions that are less confident
+	MinConfidence float64
+}
+
+// Step is a single rule application in an inference trace. The premises and
+// the conclusion carry the truth values the rule used and derived.
+type Step struct {
+	Rule       string           `json:"rule"`
+	Premises   []atomspace.Tree `json:"premises"`
+	Conclusion atomspace.Tree   `json:"conclusion"`
+}
+
+// Result describes an inference run
+type Result struct {
+	// Steps is the inference trace, in the order rules were applied
+	Steps []Step `json:"steps"`
+	// Conclusions are the atoms whose truth values changed, with their new
+	// truth values
+	Conclusions []atomspace.Tree `json:"conclusions,omitempty"`
+	// Target is the goal of backward chaining with its truth value, which is
+	// unset if the goal could not be proven
+	Target *atomspace.Tree `json:"target,omitempty"`
+	// Exhausted is set if the run stopped because it used up its step budget
+	Exhausted bool `json:"exhausted,omitempty"`
+}
+
+// inference is a rule applied to particular premises
+type inference struct {
+	rule     string
+	premises []atomspace.Handle
+}
+
+// Chainer draws conclusions from the statements in an AtomSpace and adds
+// them to it
+type Chainer struct {
+	space   *atomspace.AtomSpace
+	config  Config
+	applied map[string]bool
+	keys    map[atomspace.Handle]string
+
+	used    int
+	result  *Result
+	changed []atomspace.Handle
+}
+
+// NewChainer creates a chainer over space. applied holds the keys of the
+// inferences drawn by earlier runs and is updated as new ones are drawn: an
+// inference is only drawn once, so that its evidence is not counted twice
+// when its conclusion is revised.
+func NewChainer(space *atomspace.AtomSpace, config Config, applied map[string]bool) *Chainer {
+	if applied == nil {
+		applied = make(map[string]bool)
+	}
+	return &Chainer{
+		space:   space,
+		config:  config,
+		applied: applied,
+		keys:    make(map[atomspace.Handle]string),
+	}
+}
+
+// Forward applies every rule it can until nothing new follows or the step
+// budget is used up. If sources are given, only inferences from the sources,
+// from statements about them and from what follows from those are drawn.
+func (c *Chainer) Forward(sources ...atomspace.Handle) (*Result, error) {
+	c.begin()
+
+	reached := make(map[atomspace.Handle]bool)
+	for _, h := range sources {
+		if _, ok := c.space.Get(h); !ok {
+			return nil, fmt.Errorf("unknown source atom %d", h)
+		}
+		reached[h] = true
+	}
+
+	for progress := true; progress; {
+		progress = false
+		for _, h := range c.space.Handles() {
+			if len(sources) > 0 && !c.touches(h, reached) {
+				continue
+			}
+			for _, inf := range c.inferences(h) {
+				concl, ok, err := c.try(inf)
+				if err != nil {
+					return nil, err
+				}
+				if c.result.Exhausted {
+					return c.finish(), nil
+				}
+				if ok {
+					progress = true
+					reached[concl] = true
+				}
+			}
+		}
+	}
+
+	return c.finish(), nil
+}
+
+// Backward looks for the rule applications that conclude target, proving
+// their premises as subgoals up to the configured depth. The target must not
+// contain variables.
+func (c *Chainer) Backward(target atomspace.Tree) (*Result, error) {
+	if hasVariables(target) {
+		return nil, fmt.Errorf("backward chaining target %s contains variables", target)
+	}
+	c.begin()
+
+	h, err := c.space.AddTree(target.Bare())
+	if err != nil {
+		return nil, err
+	}
+	if err := c.prove(h, c.config.MaxDepth, make(map[atomspace.Handle]bool)); err != nil {
+		return nil, err
+	}
+
+	result := c.finish()
+	tree, err := c.space.Tree(h)
+	if err != nil {
+		return nil, err
+	}
+	if !c.known(h) {
+		tree.TV = nil
+	}
+	result.Target = &tree
+	return result, nil
+}
+
+func (c *Chainer) begin() {
+	c.used = 0
+	c.result = &Result{}
+	c.changed = nil
+}
+
+func (c *Chainer) finish() *Result {
+	// Conclusions carry only their own truth values, so that publishing them
+	// does not overwrite what else is known about their parts
+	for _, h := range c.changed {
+		tree := c.tree(h)
+		tv := tree.TV
+		tree = tree.Bare()
+		tree.TV = tv
+		c.result.Conclusions = append(c.result.Conclusions, tree)
+	}
+	return c.result
+}
+
+// prove tries to conclude the atom h, first proving the premises it would
+// need. visiting holds the goals being proven, so that no goal depends on
+// itself.
+func (c *Chainer) prove(h atomspace.Handle, depth int, visiting map[atomspace.Handle]bool) error {
+	if visiting[h] || c.result.Exhausted {
+		return nil
+	}
+	visiting[h] = true
+	defer delete(visiting, h)
+
+	atom, _ := c.space.Get(h)
+	var err error
+
+	if isStatement(atom) {
+		a, b := atom.Outgoing[0], atom.Outgoing[1]
+
+		// Deduction: A→X and X→B
+		for _, l := range c.space.Incoming(a) {
+			first, _ := c.space.Get(l)
+			if !c.isPremise(first, atom.Type) || first.Outgoing[0] != a {
+				continue
+			}
+			x := first.Outgoing[1]
+			if x == b {
+				continue
+			}
+			sub, ok := c.space.Link(atom.Type, x, b)
+			if depth > 0 {
+				if sub, err = c.space.AddLink(atom.Type, x, b); err != nil {
+					return err
+				}
+				ok = true
+				if err := c.prove(sub, depth-1, visiting); err != nil {
+					return err
+				}
+			}
+			if ok && c.known(sub) {
+				if _, _, err := c.try(inference{Deduction, []atomspace.Handle{l, sub}}); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Inversion: B→A
+		reverse, ok := c.space.Link(atom.Type, b, a)
+		if depth > 0 && !c.known(h) {
+			if reverse, err = c.space.AddLink(atom.Type, b, a); err != nil {
+				return err
+			}
+			ok = true
+			if err := c.prove(reverse, depth-1, visiting); err != nil {
+				return err
+			}
+		}
+		if ok && c.known(reverse) {
+			if _, _, err := c.try(inference{Inversion, []atomspace.Handle{reverse}}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Modus ponens: X→h and X
+	for _, l := range c.space.Incoming(h) {
+		implication, _ := c.space.Get(l)
+		if !c.isPremise(implication, atomspace.ImplicationLink) || implication.Outgoing[1] != h {
+			continue
+		}
+		x := implication.Outgoing[0]
+		if depth > 0 {
+			if err := c.prove(x, depth-1, visiting); err != nil {
+				return err
+			}
+		}
+		if c.known(x) {
+			if _, _, err := c.try(inference{ModusPonens, []atomspace.Handle{l, x}}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// inferences returns the inferences that use the atom h as a premise
+func (c *Chainer) inferences(h atomspace.Handle) []inference {
+	atom, ok := c.space.Get(h)
+	if !ok || !c.known(h) {
+		return nil
+	}
+
+	var infs []inference
+	if isStatement(atom) {
+		a, b := atom.Outgoing[0], atom.Outgoing[1]
+
+		// h as A→B, with B→C
+		for _, l := range c.space.Incoming(b) {
+			next, _ := c.space.Get(l)
+			if c.isPremise(next, atom.Type) && next.Outgoing[0] == b && next.Outgoing[1] != a {
+				infs = append(infs, inference{Deduction, []atomspace.Handle{h, l}})
+			}
+		}
+		// h as B→C, with A→B
+		for _, l := range c.space.Incoming(a) {
+			prev, _ := c.space.Get(l)
+			if c.isPremise(prev, atom.Type) && prev.Outgoing[1] == a && prev.Outgoing[0] != b {
+				infs = append(infs, inference{Deduction, []atomspace.Handle{l, h}})
+			}
+		}
+		infs = append(infs, inference{Inversion, []atomspace.Handle{h}})
+		if atom.Type == atomspace.ImplicationLink && c.known(a) {
+			infs = append(infs, inference{ModusPonens, []atomspace.Handle{h, a}})
+		}
+	}
+
+	// h as the antecedent of an implication
+	for _, l := range c.space.Incoming(h) {
+		implication, _ := c.space.Get(l)
+		if c.isPremise(implication, atomspace.ImplicationLink) && implication.Outgoing[0] == h {
+			infs = append(infs, inference{ModusPonens, []atomspace.Handle{l, h}})
+		}
+	}
+	return infs
+}
+
+// try applies inf unless it was applied before, and returns its conclusion
+// and whether the conclusion was kept
+func (c *Chainer) try(inf inference) (atomspace.Handle, bool, error) {
+	key := c.key(inf)
+	if c.applied[key] {
+		return 0, false, nil
+	}
+	if c.config.MaxSteps > 0 && c.used >= c.config.MaxSteps {
+		c.result.Exhausted = true
+		return 0, false, nil
+	}
+
+	premises := make([]*atomspace.Atom, len(inf.premises))
+	for i, h := range inf.premises {
+		premises[i], _ = c.space.Get(h)
+	}
+	first := premises[0]
+
+	var tv atomspace.TruthValue
+	var conclusion atomspace.Handle
+	var err error
+	switch inf.rule {
+	case Deduction:
+		a, b, cc := first.Outgoing[0], first.Outgoing[1], premises[1].Outgoing[1]
+		if a == cc {
+			return 0, false, nil
+		}
+		tv = DeductionTV(first.TV, premises[1].TV, c.termProbability(b), c.termProbability(cc))
+		conclusion, err = c.space.AddLink(first.Type, a, cc)
+	case Inversion:
+		a, b := first.Outgoing[0], first.Outgoing[1]
+		// Inversion only estimates statements nothing else is known about
+		if reverse, ok := c.space.Link(first.Type, b, a); ok && c.known(reverse) {
+			return 0, false, nil
+		}
+		tv = InversionTV(first.TV, c.termProbability(a), c.termProbability(b))
+		conclusion, err = c.space.AddLink(first.Type, b, a)
+	case ModusPonens:
+		tv = ModusPonensTV(first.TV, premises[1].TV)
+		conclusion = first.Outgoing[1]
+	default:
+		return 0, false, fmt.Errorf("unknown rule %s", inf.rule)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	c.applied[key] = true
+	c.used++
+	if tv.Confidence < c.config.MinConfidence {
+		return conclusion, false, nil
+	}
+
+	step := Step{Rule: inf.rule}
+	for _, h := range inf.premises {
+		step.Premises = append(step.Premises, c.tree(h))
+	}
+	step.Conclusion = c.treeWith(conclusion, tv)
+	c.result.Steps = append(c.result.Steps, step)
+
+	// A conclusion that is already known is revised with the new evidence
+	if existing, _ := c.space.Get(conclusion); existing.TV.Confidence > 0 {
+		revised := RevisionTV(existing.TV, tv)
+		c.result.Steps = append(c.result.Steps, Step{
+			Rule:       Revision,
+			Premises:   []atomspace.Tree{c.tree(conclusion), step.Conclusion},
+			Conclusion: c.treeWith(conclusion, revised),
+		})
+		tv = revised
+	}
+
+	if err := c.space.SetTruthValue(conclusion, tv); err != nil {
+		return 0, false, err
+	}
+	c.markChanged(conclusion)
+	return conclusion, true, nil
+}
+
+func (c *Chainer) markChanged(h atomspace.Handle) {
+	for _, changed := range c.changed {
+		if changed == h {
+			return
+		}
+	}
+	c.changed = append(c.changed, h)
+}
+
+// key identifies an inference by its rule and the structure of its premises,
+// which unlike handles is the same in every copy of the knowledge
+func (c *Chainer) key(inf inference) string {
+	parts := []string{inf.rule}
+	for _, h := range inf.premises {
+		key, ok := c.keys[h]
+		if !ok {
+			key = c.tree(h).Bare().String()
+			c.keys[h] = key
+		}
+		parts = append(parts, key)
+	}
+	return strings.Join(parts, " ")
+}
+
+// touches reports whether h is reached or is a link over a reached atom
+func (c *Chainer) touches(h atomspace.Handle, reached map[atomspace.Handle]bool) bool {
+	if reached[h] {
+		return true
+	}
+	atom, _ := c.space.Get(h)
+	for _, out := range atom.Outgoing {
+		if reached[out] {
+			return true
+		}
+	}
+	return false
+}
+
+// known reports whether the truth value of h carries any confidence
+func (c *Chainer) known(h atomspace.Handle) bool {
+	atom, ok := c.space.Get(h)
+	return ok && atom.TV.Confidence > 0
+}
+
+// isPremise reports whether atom is a known statement of type t
+func (c *Chainer) isPremise(atom *atomspace.Atom, t atomspace.Type) bool {
+	return atom.Type == t && isStatement(atom) && atom.TV.Confidence > 0
+}
+
+func (c *Chainer) termProbability(h atomspace.Handle) float64 {
+	atom, _ := c.space.Get(h)
+	return TermProbability(atom.TV)
+}
+
+// tree returns h as a tree that always carries its truth value
+func (c *Chainer) tree(h atomspace.Handle) atomspace.Tree {
+	atom, _ := c.space.Get(h)
+	return c.treeWith(h, atom.TV)
+}
+
+func (c *Chainer) treeWith(h atomspace.Handle, tv atomspace.TruthValue) atomspace.Tree {
+	tree, _ := c.space.Tree(h)
+	tree.TV = &tv
+	tree.AV = nil
+	return tree
+}
+
+// isStatement reports whether atom is an inheritance or implication between
+// two different atoms
+func isStatement(atom *atomspace.Atom) bool {
+	return (atom.Type == atomspace.InheritanceLink || atom.Type == atomspace.ImplicationLink) &&
+		atom.Arity() == 2 && atom.Outgoing[0] != atom.Outgoing[1]
+}
+
+func hasVariables(tree atomspace.Tree) bool {
+	if tree.Type == atomspace.VariableNode {
+		return true
+	}
+	for _, child := range tree.Outgoing {
+		if hasVariables(child) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package pln
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// knowledge builds an AtomSpace from Atomese
+func knowledge(t *testing.T, src string) *atomspace.AtomSpace {
+	t.Helper()
+	space := atomspace.New()
+	if _, err := space.ImportScheme(strings.NewReader(src)); err != nil {
+		t.Fatalf("ImportScheme failed: %v", err)
+	}
+	return space
+}
+
+func concept(name string) atomspace.Tree {
+	return atomspace.Tree{Type: atomspace.ConceptNode, Name: name}
+}
+
+func inheritance(a, b string) atomspace.Tree {
+	return atomspace.Tree{Type: atomspace.InheritanceLink, Outgoing: []atomspace.Tree{concept(a), concept(b)}}
+}
+
+// truthOf returns the truth value of the atom tree describes
+func truthOf(t *testing.T, space *atomspace.AtomSpace, tree atomspace.Tree) atomspace.TruthValue {
+	t.Helper()
+	h, err := space.AddTree(tree)
+	if err != nil {
+		t.Fatalf("AddTree failed: %v", err)
+	}
+	atom, _ := space.Get(h)
+	return atom.TV
+}
+
+const animals = `
+(InheritanceLink (stv 0.9 0.9) (ConceptNode "cat") (ConceptNode "mammal"))
+(InheritanceLink (stv 0.95 0.9) (ConceptNode "mammal") (ConceptNode "animal"))
+`
+
+func TestForwardDeduction(t *testing.T) {
+	space := knowledge(t, animals)
+	result, err := NewChainer(space, Config{MinConfidence: 0.1}, nil).Forward()
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+
+	got := truthOf(t, space, inheritance("cat", "animal"))
+	want := DeductionTV(tv(0.9, 0.9), tv(0.95, 0.9), DefaultTermProbability, DefaultTermProbability)
+	if got != want {
+		t.Errorf("Expected cat→animal %+v, got %+v", want, got)
+	}
+
+	var rules []string
+	for _, step := range result.Steps {
+		rules = append(rules, step.Rule)
+	}
+	if len(rules) == 0 || rules[0] != Deduction {
+		t.Errorf("Expected the trace to start with deduction, got %v", rules)
+	}
+	if step := result.Steps[0]; len(step.Premises) != 2 || step.Conclusion.Bare().String() != inheritance("cat", "animal").String() {
+		t.Errorf("Unexpected first step %+v", step)
+	}
+	if len(result.Conclusions) == 0 {
+		t.Error("Expected conclusions")
+	}
+	if result.Exhausted {
+		t.Error("Unlimited run should not be exhausted")
+	}
+}
+
+func TestForwardDrawsEachInferenceOnce(t *testing.T) {
+	space := knowledge(t, animals)
+	applied := make(map[string]bool)
+
+	if _, err := NewChainer(space, Config{}, applied).Forward(); err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	before := truthOf(t, space, inheritance("cat", "animal"))
+
+	result, err := NewChainer(space, Config{}, applied).Forward()
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	if len(result.Steps) != 0 {
+		t.Errorf("A second run should draw nothing new, got %d steps", len(result.Steps))
+	}
+	if after := truthOf(t, space, inheritance("cat", "animal")); after != before {
+		t.Errorf("A second run should not change conclusions, got %+v then %+v", before, after)
+	}
+}
+
+func TestForwardStepBudget(t *testing.T) {
+	space := knowledge(t, animals)
+	result, err := NewChainer(space, Config{MaxSteps: 1}, nil).Forward()
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	if len(result.Steps) != 1 || !result.Exhausted {
+		t.Errorf("Expected one step and an exhausted budget, got %d steps, exhausted %v", len(result.Steps), result.Exhausted)
+	}
+}
+
+func TestForwardMinConfidence(t *testing.T) {
+	space := knowledge(t, animals)
+	result, err := NewChainer(space, Config{MinConfidence: 0.85}, nil).Forward()
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	if len(result.Steps) != 0 || len(result.Conclusions) != 0 {
+		t.Errorf("Conclusions below the minimum confidence should be discarded, got %+v", result.Steps)
+	}
+}
+
+func TestForwardFromSources(t *testing.T) {
+	space := knowledge(t, animals+`
+(InheritanceLink (stv 0.9 0.9) (ConceptNode "rose") (ConceptNode "flower"))
+(InheritanceLink (stv 0.9 0.9) (ConceptNode "flower") (ConceptNode "plant"))
+`)
+	cat, _ := space.Node(atomspace.ConceptNode, "cat")
+
+	result, err := NewChainer(space, Config{}, nil).Forward(cat)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	for _, tree := range result.Conclusions {
+		if strings.Contains(tree.String(), "flower") {
+			t.Errorf("Chaining from cat should not reason about flowers, got %s", tree)
+		}
+	}
+	if tv := truthOf(t, space, inheritance("cat", "animal")); tv.Confidence == 0 {
+		t.Error("Chaining from cat should conclude cat→animal")
+	}
+}
+
+func TestInversionAndRevision(t *testing.T) {
+	space := knowledge(t, `
+(ConceptNode "smoker" (stv 0.1 0.9))
+(ConceptNode "cancer" (stv 0.05 0.9))
+(InheritanceLink (stv 0.3 0.8) (ConceptNode "cancer") (ConceptNode "smoker"))
+`)
+	if _, err := NewChainer(space, Config{}, nil).Forward(); err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	got := truthOf(t, space, inheritance("smoker", "cancer"))
+	want := InversionTV(tv(0.3, 0.8), 0.05, 0.1)
+	if got != want {
+		t.Errorf("Expected smoker→cancer %+v, got %+v", want, got)
+	}
+
+	// Two deductions of the same statement are revised together
+	space = knowledge(t, `
+(InheritanceLink (stv 0.9 0.9) (ConceptNode "a") (ConceptNode "b"))
+(InheritanceLink (stv 0.9 0.9) (ConceptNode "b") (ConceptNode "d"))
+(InheritanceLink (stv 0.5 0.9) (ConceptNode "a") (ConceptNode "c"))
+(InheritanceLink (stv 0.5 0.9) (ConceptNode "c") (ConceptNode "d"))
+`)
+	result, err := NewChainer(space, Config{}, nil).Forward()
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	revised := false
+	for _, step := range result.Steps {
+		if step.Rule == Revision && step.Conclusion.Bare().String() == inheritance("a", "d").String() {
+			revised = true
+		}
+	}
+	if !revised {
+		t.Error("Expected the two deductions of a→d to be revised")
+	}
+	if tv := truthOf(t, space, inheritance("a", "d")); tv.Confidence <= 0.81 {
+		t.Errorf("Revision should be more confident than either deduction, got %+v", tv)
+	}
+}
+
+func TestModusPonens(t *testing.T) {
+	space := knowledge(t, `
+(EvaluationLink (stv 1 0.9) (PredicateNode "raining") (ListLink))
+(ImplicationLink (stv 0.8 0.9)
+  (EvaluationLink (PredicateNode "raining") (ListLink))
+  (EvaluationLink (PredicateNode "wet") (ListLink)))
+`)
+	if _, err := NewChainer(space, Config{}, nil).Forward(); err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	wet := atomspace.Tree{Type: atomspace.EvaluationLink, Outgoing: []atomspace.Tree{
+		{Type: atomspace.PredicateNode, Name: "wet"},
+		{Type: atomspace.ListLink},
+	}}
+	if got, want := truthOf(t, space, wet), ModusPonensTV(tv(0.8, 0.9), tv(1, 0.9)); got != want {
+		t.Errorf("Expected wet %+v, got %+v", want, got)
+	}
+}
+
+func TestBackward(t *testing.T) {
+	space := knowledge(t, animals+`
+(InheritanceLink (stv 0.9 0.9) (ConceptNode "animal") (ConceptNode "living"))
+`)
+	result, err := NewChainer(space, Config{MaxDepth: 3}, nil).Backward(inheritance("cat", "living"))
+	if err != nil {
+		t.Fatalf("Backward failed: %v", err)
+	}
+	if result.Target == nil || result.Target.TV == nil || result.Target.TV.Confidence == 0 {
+		t.Fatalf("Expected cat→living to be proven, got %+v", result.Target)
+	}
+	if len(result.Steps) < 2 {
+		t.Errorf("Proving cat→living takes two deductions, got %d steps", len(result.Steps))
+	}
+
+	// Without looking at subgoals there is no chain to follow
+	space = knowledge(t, animals+`
+(InheritanceLink (stv 0.9 0.9) (ConceptNode "animal") (ConceptNode "living"))
+`)
+	result, err = NewChainer(space, Config{MaxDepth: 0}, nil).Backward(inheritance("cat", "living"))
+	if err != nil {
+		t.Fatalf("Backward failed: %v", err)
+	}
+	if result.Target.TV != nil {
+		t.Errorf("cat→living should not be provable at depth 0, got %+v", result.Target.TV)
+	}
+
+	variable := atomspace.Tree{Type: atomspace.InheritanceLink, Outgoing: []atomspace.Tree{
+		concept("cat"), {Type: atomspace.VariableNode, Name: "$x"},
+	}}
+	if _, err := NewChainer(space, Config{}, nil).Backward(variable); err == nil {
+		t.Error("Backward should reject targets with variables")
+	}
+}
@@ -0,0 +1,98 @@
+// Package pln implements Probabilistic Logic Networks inference over an
+// AtomSpace. Statements are InheritanceLinks and ImplicationLinks between two
+// atoms; rules combine statements into new ones, with truth value formulas
+// that estimate the strength of each conclusion and how confident it is.
+package pln
+
+import (
+	"math"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+// Rule names
+const (
+	Deduction   = "deduction"
+	Inversion   = "inversion"
+	ModusPonens = "modus-ponens"
+	Revision    = "revision"
+)
+
+// DefaultTermProbability is the probability assumed for a term whose truth
+// value carries no confidence, and for B given not A in modus ponens
+const DefaultTermProbability = 0.2
+
+// inversionDiscount scales the confidence of inverted statements, which rest
+// on term probabilities that are rarely known well
+const inversionDiscount = 0.6
+
+// TermProbability returns the probability of a term: its strength, or
+// DefaultTermProbability if its truth value has no confidence
+func TermProbability(tv atomspace.TruthValue) float64 {
+	if tv.Confidence == 0 {
+		return DefaultTermProbability
+	}
+	return tv.Strength
+}
+
+// DeductionTV derives A→C from A→B and B→C, given the probabilities of the
+// terms B and C, assuming independence:
+//
+//	sAC = sAB·sBC + (1-sAB)·(sC - sB·sBC) / (1-sB)
+//	cAC = cAB·cBC
+func DeductionTV(ab, bc atomspace.TruthValue, sB, sC float64) atomspace.TruthValue {
+	var s float64
+	if sB > 0.9999 {
+		s = sC
+	} else {
+		s = ab.Strength*bc.Strength + (1-ab.Strength)*(sC-sB*bc.Strength)/(1-sB)
+	}
+	return atomspace.TruthValue{
+		Strength:   clamp(s),
+		Confidence: ab.Confidence * bc.Confidence,
+	}
+}
+
+// InversionTV derives B→A from A→B with Bayes' rule, given the probabilities
+// of the terms A and B:
+//
+//	sBA = sAB·sA / sB
+//	cBA = cAB·0.6
+func InversionTV(ab atomspace.TruthValue, sA, sB float64) atomspace.TruthValue {
+	s := 1.0
+	if sB > 0 {
+		s = ab.Strength * sA / sB
+	}
+	return atomspace.TruthValue{
+		Strength:   clamp(s),
+		Confidence: ab.Confidence * inversionDiscount,
+	}
+}
+
+// ModusPonensTV derives B from A→B and A:
+//
+//	sB = sAB·sA + 0.2·(1-sA)
+//	cB = cAB·cA
+func ModusPonensTV(ab, a atomspace.TruthValue) atomspace.TruthValue {
+	return atomspace.TruthValue{
+		Strength:   clamp(ab.Strength*a.Strength + DefaultTermProbability*(1-a.Strength)),
+		Confidence: ab.Confidence * a.Confidence,
+	}
+}
+
+// RevisionTV merges two truth values of the same statement that rest on
+// different evidence, weighting each strength by its evidence count
+func RevisionTV(x, y atomspace.TruthValue) atomspace.TruthValue {
+	nx, ny := x.Count(), y.Count()
+	if nx+ny == 0 {
+		return atomspace.TruthValue{Strength: (x.Strength + y.Strength) / 2}
+	}
+	return atomspace.TruthValue{
+		Strength:   clamp((nx*x.Strength + ny*y.Strength) / (nx + ny)),
+		Confidence: math.Min(atomspace.ConfidenceFromCount(nx+ny), 1),
+	}
+}
+
+func clamp(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
@@ -0,0 +1,58 @@
+package pln
+
+import (
+	"math"
+	"testing"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+)
+
+func tv(s, c float64) atomspace.TruthValue {
+	return atomspace.TruthValue{Strength: s, Confidence: c}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestFormulas(t *testing.T) {
+	tests := []struct {
+		name string
+		got  atomspace.TruthValue
+		want atomspace.TruthValue
+	}{
+		{"deduction", DeductionTV(tv(0.9, 0.9), tv(0.95, 0.9), 0.2, 0.2), tv(0.9*0.95+0.1*(0.2-0.2*0.95)/0.8, 0.81)},
+		{"deduction with a certain middle term", DeductionTV(tv(0.9, 0.9), tv(0.5, 0.9), 1, 0.3), tv(0.3, 0.81)},
+		{"inversion", InversionTV(tv(0.8, 0.5), 0.1, 0.4), tv(0.2, 0.3)},
+		{"inversion is clamped", InversionTV(tv(0.8, 0.5), 0.9, 0.1), tv(1, 0.3)},
+		{"modus ponens", ModusPonensTV(tv(0.9, 0.8), tv(0.5, 0.5)), tv(0.55, 0.4)},
+		{"revision", RevisionTV(tv(1, 0.5), tv(0, 0.5)), tv(0.5, atomspace.ConfidenceFromCount(1600))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !near(tt.got.Strength, tt.want.Strength) || !near(tt.got.Confidence, tt.want.Confidence) {
+				t.Errorf("Expected %+v, got %+v", tt.want, tt.got)
+			}
+		})
+	}
+}
+
+func TestRevisionFavorsMoreEvidence(t *testing.T) {
+	revised := RevisionTV(tv(0.9, 0.9), tv(0.1, 0.1))
+	if revised.Strength < 0.85 {
+		t.Errorf("Revision should lean towards the more confident value, got %+v", revised)
+	}
+	if revised.Confidence <= 0.9 {
+		t.Errorf("Revision should increase confidence, got %+v", revised)
+	}
+}
+
+func TestTermProbability(t *testing.T) {
+	if p := TermProbability(atomspace.DefaultTruthValue); p != DefaultTermProbability {
+		t.Errorf("Terms without confidence should get the default probability, got %v", p)
+	}
+	if p := TermProbability(tv(0.3, 0.5)); p != 0.3 {
+		t.Errorf("Expected the term's strength, got %v", p)
+	}
+}
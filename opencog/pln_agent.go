@@ -0,0 +1,294 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+	"github.com/github/hub/v2/opencog/internal/decode"
+	"github.com/github/hub/v2/opencog/pln"
+)
+
+func init() {
+	RegisterBehavior(PLNAgent, newPLNBehavior)
+}
+
+// Chaining directions of an inference run
+const (
+	ForwardChaining  = "forward"
+	BackwardChaining = "backward"
+)
+
+// publishTimeout bounds how long a reasoning agent waits for the knowledge
+// store to accept its conclusions
+const publishTimeout = 30 * time.Second
+
+// InferenceRun records an inference run of a PLN agent
+type InferenceRun struct {
+	Time time.Time `json:"time"`
+	// Chaining is forward or backward
+	Chaining string `json:"chaining"`
+	// Knowledge is the name of the atomspace agent reasoned over
+	Knowledge string `json:"knowledge"`
+	*pln.Result
+}
+
+// plnState is what a PLN agent keeps between runs
+type plnState struct {
+	// Applied holds the keys of the inferences already drawn
+	Applied []string      `json:"applied"`
+	LastRun *InferenceRun `json:"last_run,omitempty"`
+}
+
+func plnStatePath(configDir string, agent *Agent) string {
+	return filepath.Join(configDir, "pln", agent.ID+".json")
+}
+
+func loadPLNState(configDir string, agent *Agent) (*plnState, error) {
+	state := &plnState{}
+	data, err := os.ReadFile(plnStatePath(configDir, agent))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read inference state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse inference state: %w", err)
+	}
+	return state, nil
+}
+
+func (s *plnState) save(configDir string, agent *Agent) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal inference state: %w", err)
+	}
+	path := plnStatePath(configDir, agent)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create inference state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write inference state: %w", err)
+	}
+	return nil
+}
+
+// LastInference returns the most recent inference run of a PLN agent, or
+// nil if it has not run yet
+func LastInference(configDir string, agent *Agent) (*InferenceRun, error) {
+	state, err := loadPLNState(configDir, agent)
+	if err != nil {
+		return nil, err
+	}
+	return state.LastRun, nil
+}
+
+// KnowledgeAgent returns the atomspace agent named by the "atomspace" option
+// of a reasoning agent
+func KnowledgeAgent(registry *Registry, agent *Agent) (*Agent, error) {
+	name := agent.ConfigString("atomspace")
+	if name == "" {
+		return nil, fmt.Errorf("agent %s has no atomspace; set one with `hub agent config %s --set atomspace=<name>`", agent.Name, agent.Name)
+	}
+	kb, err := registry.GetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if kb.Type != AtomSpaceAgent {
+		return nil, fmt.Errorf("agent %s is a %s agent, not an atomspace agent", kb.Name, kb.Type)
+	}
+	return kb, nil
+}
+
+// InferencePayload builds the payload of a command asking a PLN agent to
+// chain forward from source, or from all its knowledge if source is empty,
+// or backward towards target. A positive maxSteps overrides the agent's step
+// budget.
+func InferencePayload(chaining, atomese string, maxSteps int) map[string]interface{} {
+	payload := map[string]interface{}{"action": chaining}
+	if atomese != "" {
+		key := "source"
+		if chaining == BackwardChaining {
+			key = "target"
+		}
+		payload[key] = atomese
+	}
+	if maxSteps > 0 {
+		payload["max_steps"] = maxSteps
+	}
+	return payload
+}
+
+// DecodeInferenceRun extracts the run from a PLN agent's reply
+func DecodeInferenceRun(payload map[string]interface{}) (*InferenceRun, error) {
+	run := &InferenceRun{}
+	if err := decode.Payload(payload, "run", "inference run", run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// plnBehavior implements the pln agent type: on command it reasons over the
+// knowledge of its atomspace agent and publishes what it concludes back to it
+type plnBehavior struct {
+	agent     *Agent
+	configDir string
+	outbox    *Outbox
+}
+
+func newPLNBehavior(agent *Agent, configDir string) (Behavior, error) {
+	return &plnBehavior{agent: agent, configDir: configDir}, nil
+}
+
+func (b *plnBehavior) SetOutbox(outbox *Outbox) {
+	b.outbox = outbox
+}
+
+func (b *plnBehavior) HandleMessage(msg *Message) (*Message, error) {
+	switch msg.Type {
+	case MessageTypeCommand:
+		return b.infer(msg)
+	case MessageTypeHeartbeat, MessageTypeResponse:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("pln agents do not handle %s messages", msg.Type)
+}
+
+// infer runs forward or backward chaining as the message's "action" asks and
+// replies with the inference run
+func (b *plnBehavior) infer(msg *Message) (*Message, error) {
+	chaining, _ := msg.Payload["action"].(string)
+	if chaining != ForwardChaining && chaining != BackwardChaining {
+		return nil, fmt.Errorf("unknown pln action %q, expected %s or %s", chaining, ForwardChaining, BackwardChaining)
+	}
+	if b.outbox == nil {
+		return nil, fmt.Errorf("agent %s is not hosted", b.agent.Name)
+	}
+
+	config := pln.Config{
+		MaxSteps:      b.agent.ConfigInt("max_steps"),
+		MaxDepth:      b.agent.ConfigInt("max_depth"),
+		MinConfidence: b.agent.ConfigFloat("min_confidence"),
+	}
+	switch v := msg.Payload["max_steps"].(type) {
+	case int:
+		config.MaxSteps = v
+	case float64:
+		config.MaxSteps = int(v)
+	}
+
+	registry, err := NewRegistry(b.configDir)
+	if err != nil {
+		return nil, err
+	}
+	kb, err := KnowledgeAgent(registry, b.agent)
+	if err != nil {
+		return nil, err
+	}
+	store, err := OpenAtomSpace(b.configDir, kb)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reason over a copy, so that the knowledge store only changes through
+	// the knowledge messages it receives
+	var space *atomspace.AtomSpace
+	err = store.Read(func(s *atomspace.AtomSpace) error {
+		space = s.Clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := loadPLNState(b.configDir, b.agent)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]bool, len(state.Applied))
+	for _, key := range state.Applied {
+		applied[key] = true
+	}
+
+	chainer := pln.NewChainer(space, config, applied)
+	var result *pln.Result
+	if chaining == ForwardChaining {
+		result, err = b.forward(chainer, space, msg.Payload["source"])
+	} else {
+		result, err = b.backward(chainer, msg.Payload["target"])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Conclusions) > 0 {
+		_, err := b.outbox.Request(&Message{
+			To:      kb.ID,
+			Type:    MessageTypeKnowledge,
+			Payload: map[string]interface{}{"atoms": result.Conclusions},
+		}, publishTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to publish conclusions to %s: %w", kb.Name, err)
+		}
+	}
+
+	run := &InferenceRun{
+		Time:      time.Now(),
+		Chaining:  chaining,
+		Knowledge: kb.Name,
+		Result:    result,
+	}
+	state.Applied = state.Applied[:0]
+	for key := range applied {
+		state.Applied = append(state.Applied, key)
+	}
+	sort.Strings(state.Applied)
+	state.LastRun = run
+	if err := state.save(b.configDir, b.agent); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Type:    MessageTypeResponse,
+		Payload: map[string]interface{}{"run": run},
+	}, nil
+}
+
+func (b *plnBehavior) forward(chainer *pln.Chainer, space *atomspace.AtomSpace, source interface{}) (*pln.Result, error) {
+	src, _ := source.(string)
+	if src == "" {
+		return chainer.Forward()
+	}
+
+	trees, err := atomspace.ParseScheme(strings.NewReader(src))
+	if err != nil {
+		return nil, fmt.Errorf("invalid source: %w", err)
+	}
+	var sources []atomspace.Handle
+	for _, tree := range trees {
+		h, err := space.AddTree(tree)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source: %w", err)
+		}
+		sources = append(sources, h)
+	}
+	return chainer.Forward(sources...)
+}
+
+func (b *plnBehavior) backward(chainer *pln.Chainer, target interface{}) (*pln.Result, error) {
+	src, _ := target.(string)
+	trees, err := atomspace.ParseScheme(strings.NewReader(src))
+	if err != nil {
+		return nil, fmt.Errorf("invalid target: %w", err)
+	}
+	if len(trees) != 1 {
+		return nil, fmt.Errorf("backward chaining needs exactly one target, got %d", len(trees))
+	}
+	return chainer.Backward(trees[0])
+}
@@ -0,0 +1,141 @@
+package opencog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/hub/v2/opencog/atomspace"
+	"github.com/github/hub/v2/opencog/pln"
+)
+
+const plnKnowledge = `
+(InheritanceLink (stv 0.9 0.9) (ConceptNode "cat") (ConceptNode "mammal"))
+(InheritanceLink (stv 0.95 0.9) (ConceptNode "mammal") (ConceptNode "animal"))
+`
+
+// reasoningSetup hosts an atomspace agent holding plnKnowledge and a pln
+// agent reasoning over it, and registers a client to talk to them
+func reasoningSetup(t *testing.T) (*Orchestrator, *Registry, *Agent, *Agent) {
+	t.Helper()
+	registry, _ := NewRegistry(t.TempDir())
+	kb, _ := NewAgent(AgentConfig{Name: "kb", Type: AtomSpaceAgent})
+	reasoner, _ := NewAgent(AgentConfig{Name: "reasoner", Type: PLNAgent, Config: map[string]interface{}{"atomspace": "kb"}})
+	registry.Register(kb)
+	registry.Register(reasoner)
+
+	trees, err := atomspace.ParseScheme(strings.NewReader(plnKnowledge))
+	if err != nil {
+		t.Fatalf("ParseScheme failed: %v", err)
+	}
+
+	orchestrator := NewOrchestrator(registry)
+	for _, agent := range []*Agent{kb, reasoner} {
+		behavior, err := NewBehavior(agent, registry.Dir())
+		if err != nil {
+			t.Fatalf("NewBehavior failed: %v", err)
+		}
+		orchestrator.Host(agent.ID, behavior)
+	}
+	orchestrator.RegisterAgent("client")
+
+	msg := &Message{From: "client", To: kb.ID, Type: MessageTypeKnowledge, Payload: map[string]interface{}{"atoms": trees}}
+	if _, err := orchestrator.Request(msg, 5*time.Second); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return orchestrator, registry, kb, reasoner
+}
+
+func infer(t *testing.T, orchestrator *Orchestrator, reasoner *Agent, payload map[string]interface{}) *InferenceRun {
+	t.Helper()
+	reply, err := orchestrator.Request(&Message{From: "client", To: reasoner.ID, Type: MessageTypeCommand, Payload: payload}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Inference failed: %v", err)
+	}
+	run, err := DecodeInferenceRun(reply.Payload)
+	if err != nil {
+		t.Fatalf("DecodeInferenceRun failed: %v", err)
+	}
+	return run
+}
+
+func TestPLNAgentPublishesConclusions(t *testing.T) {
+	orchestrator, registry, kb, reasoner := reasoningSetup(t)
+
+	run := infer(t, orchestrator, reasoner, InferencePayload(ForwardChaining, "", 0))
+	if run.Knowledge != "kb" || len(run.Steps) == 0 || run.Steps[0].Rule != pln.Deduction {
+		t.Fatalf("Expected a run starting with deduction, got %+v", run)
+	}
+
+	store, _ := OpenAtomSpace(registry.Dir(), kb)
+	store.Read(func(space *atomspace.AtomSpace) error {
+		cat, _ := space.Node(atomspace.ConceptNode, "cat")
+		animal, _ := space.Node(atomspace.ConceptNode, "animal")
+		h, ok := space.Link(atomspace.InheritanceLink, cat, animal)
+		if !ok {
+			t.Fatal("Conclusion cat→animal should be published to the knowledge store")
+		}
+		if atom, _ := space.Get(h); atom.TV.Confidence == 0 {
+			t.Errorf("Published conclusion should carry its truth value, got %+v", atom.TV)
+		}
+		return nil
+	})
+
+	last, err := LastInference(registry.Dir(), reasoner)
+	if err != nil || last == nil || len(last.Steps) != len(run.Steps) {
+		t.Errorf("The run should be recorded, got %+v, %v", last, err)
+	}
+
+	// Nothing new follows from the same knowledge
+	run = infer(t, orchestrator, reasoner, InferencePayload(ForwardChaining, "", 0))
+	if len(run.Steps) != 0 {
+		t.Errorf("A second run should draw nothing new, got %d steps", len(run.Steps))
+	}
+}
+
+func TestPLNAgentBackwardChaining(t *testing.T) {
+	orchestrator, _, _, reasoner := reasoningSetup(t)
+
+	target := `(InheritanceLink (ConceptNode "cat") (ConceptNode "animal"))`
+	run := infer(t, orchestrator, reasoner, InferencePayload(BackwardChaining, target, 0))
+	if run.Target == nil || run.Target.TV == nil {
+		t.Fatalf("Expected the target to be proven, got %+v", run.Target)
+	}
+
+	_, err := orchestrator.Request(&Message{From: "client", To: reasoner.ID, Type: MessageTypeCommand,
+		Payload: InferencePayload(BackwardChaining, `(InheritanceLink (VariableNode "$x") (ConceptNode "animal"))`, 0)}, 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "contains variables") {
+		t.Errorf("Targets with variables should be rejected, got %v", err)
+	}
+}
+
+func TestPLNAgentStepBudget(t *testing.T) {
+	orchestrator, _, _, reasoner := reasoningSetup(t)
+
+	run := infer(t, orchestrator, reasoner, InferencePayload(ForwardChaining, "", 1))
+	if len(run.Steps) != 1 || !run.Exhausted {
+		t.Errorf("Expected a single step and an exhausted budget, got %d steps", len(run.Steps))
+	}
+}
+
+func TestPLNAgentNeedsAtomSpace(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	reasoner, _ := NewAgent(AgentConfig{Name: "reasoner", Type: PLNAgent})
+	registry.Register(reasoner)
+
+	behavior, _ := NewBehavior(reasoner, registry.Dir())
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.Host(reasoner.ID, behavior)
+	orchestrator.RegisterAgent("client")
+
+	_, err := orchestrator.Request(&Message{From: "client", To: reasoner.ID, Type: MessageTypeCommand,
+		Payload: InferencePayload(ForwardChaining, "", 0)}, 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "has no atomspace") {
+		t.Errorf("Expected a missing atomspace error, got %v", err)
+	}
+
+	inbox, _ := orchestrator.GetAgentChannel("client")
+	if len(inbox) != 0 {
+		t.Errorf("Replies to requests should not reach the requester's channel, got %d messages", len(inbox))
+	}
+}
@@ -0,0 +1,307 @@
+package opencog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/github/hub/v2/opencog/tuning"
+	"gopkg.in/yaml.v2"
+)
+
+// AgentTypeDescriptor describes an agent type: what it is, how to launch it,
+// which configuration it accepts and how its health is checked
+type AgentTypeDescriptor struct {
+	Name        AgentType     `json:"name" yaml:"name"`
+	Description string        `json:"description" yaml:"description"`
+	Command     []string      `json:"command,omitempty" yaml:"command,omitempty"`
+	Schema      *ConfigSchema `json:"config,omitempty" yaml:"config,omitempty"`
+	HealthCheck *HealthCheck  `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+
+	// Source is the descriptor file a plugin type was loaded from. It is
+	// empty for built-in types.
+	Source string `json:"source,omitempty" yaml:"-"`
+}
+
+// Builtin reports whether the descriptor is one of the built-in agent types
+func (d *AgentTypeDescriptor) Builtin() bool {
+	return d.Source == ""
+}
+
+// validate checks the descriptor and fills in defaults
+func (d *AgentTypeDescriptor) validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("agent type name is required")
+	}
+	if strings.ContainsAny(string(d.Name), " \t\n/") {
+		return fmt.Errorf("invalid agent type name %q", d.Name)
+	}
+
+	if d.Schema == nil {
+		d.Schema = &ConfigSchema{}
+	}
+	if err := d.Schema.validate(); err != nil {
+		return fmt.Errorf("invalid config schema: %w", err)
+	}
+
+	if d.HealthCheck == nil {
+		d.HealthCheck = &HealthCheck{Method: HealthCheckHeartbeat}
+	}
+	if err := d.HealthCheck.validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// TypeRegistry holds the agent types known to the workbench
+type TypeRegistry struct {
+	types map[AgentType]*AgentTypeDescriptor
+	mu    sync.RWMutex
+}
+
+// DefaultTypes is the type registry used to validate agent configurations.
+// It holds the built-in types plus any plugins loaded with LoadPlugins.
+var DefaultTypes = NewTypeRegistry()
+
+// NewTypeRegistry creates a type registry holding the built-in agent types
+func NewTypeRegistry() *TypeRegistry {
+	tr := &TypeRegistry{
+		types: make(map[AgentType]*AgentTypeDescriptor),
+	}
+	for _, desc := range builtinTypes() {
+		if err := desc.validate(); err != nil {
+			panic(fmt.Sprintf("invalid built-in agent type %s: %v", desc.Name, err))
+		}
+		tr.types[desc.Name] = desc
+	}
+	return tr
+}
+
+// Register adds a plugin agent type. Built-in types cannot be redefined.
+func (tr *TypeRegistry) Register(desc *AgentTypeDescriptor) error {
+	if err := desc.validate(); err != nil {
+		return err
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if existing, exists := tr.types[desc.Name]; exists {
+		if existing.Builtin() {
+			return fmt.Errorf("agent type %s is built in and cannot be redefined", desc.Name)
+		}
+		return fmt.Errorf("agent type %s is already defined in %s", desc.Name, existing.Source)
+	}
+
+	tr.types[desc.Name] = desc
+	return nil
+}
+
+// Lookup returns the descriptor for an agent type
+func (tr *TypeRegistry) Lookup(agentType AgentType) (*AgentTypeDescriptor, bool) {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
+	desc, ok := tr.types[agentType]
+	return desc, ok
+}
+
+// List returns all known agent types, built-in types first in their
+// declared order followed by plugin types sorted by name
+func (tr *TypeRegistry) List() []*AgentTypeDescriptor {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
+	descs := make([]*AgentTypeDescriptor, 0, len(tr.types))
+	for _, builtin := range builtinTypes() {
+		descs = append(descs, tr.types[builtin.Name])
+	}
+
+	plugins := make([]*AgentTypeDescriptor, 0)
+	for _, desc := range tr.types {
+		if !desc.Builtin() {
+			plugins = append(plugins, desc)
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name < plugins[j].Name
+	})
+
+	return append(descs, plugins...)
+}
+
+// LoadDir discovers agent type descriptors (*.yml, *.yaml, *.json) in dir and
+// registers them. Descriptors that fail to load are skipped and reported in
+// the returned error; the remaining ones are still registered.
+func (tr *TypeRegistry) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+
+	var errs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch filepath.Ext(entry.Name()) {
+		case ".yml", ".yaml", ".json":
+		default:
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		desc, err := readTypeDescriptor(path)
+		if err == nil {
+			err = tr.Register(desc)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// readTypeDescriptor parses a single descriptor file. JSON is a subset of
+// YAML, so both formats go through the YAML decoder.
+func readTypeDescriptor(path string) (*AgentTypeDescriptor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := &AgentTypeDescriptor{}
+	if err := yaml.UnmarshalStrict(data, desc); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor: %w", err)
+	}
+	desc.Source = path
+
+	return desc, nil
+}
+
+// PluginDir returns the directory agent type descriptors are discovered in
+func PluginDir(configDir string) string {
+	return filepath.Join(configDir, "agent-types")
+}
+
+// LoadPlugins registers the agent type descriptors found in the plugin
+// directory of configDir with DefaultTypes
+func LoadPlugins(configDir string) error {
+	return DefaultTypes.LoadDir(PluginDir(configDir))
+}
+
+// builtinTypes returns the descriptors of the built-in agent types
+func builtinTypes() []*AgentTypeDescriptor {
+	return []*AgentTypeDescriptor{
+		{
+			Name:        AtomSpaceAgent,
+			Description: "Knowledge representation and storage",
+			Schema: &ConfigSchema{Options: []ConfigOption{
+				{Key: "max_atoms", Type: OptionInt, Default: 100000, Description: "Maximum number of atoms held in the store"},
+			}},
+		},
+		{
+			Name:        PLNAgent,
+			Description: "Probabilistic Logic Networks reasoning",
+			Schema: &ConfigSchema{Options: []ConfigOption{
+				{Key: "atomspace", Type: OptionAgent, Description: "Name of the atomspace agent to reason over and publish conclusions to"},
+				{Key: "max_steps", Type: OptionInt, Default: 100, Description: "Inference step budget per run"},
+				{Key: "max_depth", Type: OptionInt, Default: 5, Description: "Levels of subgoals explored by backward chaining"},
+				{Key: "min_confidence", Type: OptionFloat, Default: 0.1, Description: "Discard conclusions below this confidence"},
+			}},
+		},
+		{
+			Name:        ECANAgent,
+			Description: "Economic Attention Networks",
+			Schema: &ConfigSchema{Options: []ConfigOption{
+				{Key: "atomspace", Type: OptionAgent, Description: "Name of the atomspace agent whose atoms get attention"},
+				{Key: "af_size", Type: OptionInt, Default: 20, Description: "Maximum number of atoms in the attentional focus"},
+				{Key: "af_boundary", Type: OptionFloat, Default: 1.0, Description: "Least STI an atom needs to enter the attentional focus"},
+				{Key: "cycle_interval", Type: OptionDuration, Default: "10s", Description: "Time between attention allocation cycles"},
+				{Key: "sti_funds", Type: OptionFloat, Default: 10000.0, Description: "STI the bank aims to hold"},
+				{Key: "lti_funds", Type: OptionFloat, Default: 10000.0, Description: "LTI the bank aims to hold"},
+				{Key: "sti_wage", Type: OptionFloat, Default: 10.0, Description: "STI paid per unit of stimulus"},
+				{Key: "lti_wage", Type: OptionFloat, Default: 10.0, Description: "LTI paid per unit of stimulus"},
+				{Key: "sti_rent", Type: OptionFloat, Default: 1.0, Description: "STI charged to each atom per cycle"},
+				{Key: "lti_rent", Type: OptionFloat, Default: 1.0, Description: "LTI charged to each atom per cycle"},
+				{Key: "diffusion_rate", Type: OptionFloat, Default: 0.2, Description: "Fraction of its STI each atom in the focus spreads to its neighbors per cycle"},
+			}},
+		},
+		{
+			Name:        OpenPsiAgent,
+			Description: "Goal-driven behavior",
+			Schema: &ConfigSchema{Options: []ConfigOption{
+				{Key: "rules", Type: OptionString, Description: "YAML file declaring goals and rules, relative to the configuration directory"},
+				{Key: "atomspace", Type: OptionAgent, Description: "Name of the atomspace agent rule contexts are matched against"},
+				{Key: "cycle_interval", Type: OptionDuration, Default: "10s", Description: "Time between action selection cycles"},
+			}},
+		},
+		{
+			Name:        PatternMinerAgent,
+			Description: "Pattern mining and discovery",
+			Schema: &ConfigSchema{Options: []ConfigOption{
+				{Key: "atomspace", Type: OptionAgent, Description: "Name of the atomspace agent to mine and publish patterns to"},
+				{Key: "min_support", Type: OptionInt, Default: 2, Description: "Minimum number of occurrences for a pattern"},
+				{Key: "max_pattern_size", Type: OptionInt, Default: 3, Description: "Maximum number of links in a pattern"},
+				{Key: "max_published", Type: OptionInt, Default: 20, Description: "Number of most surprising patterns published as knowledge"},
+			}},
+		},
+		{
+			Name:        MetaLearningAgent,
+			Description: "Meta-learning and optimization",
+			Schema: &ConfigSchema{Options: []ConfigOption{
+				{Key: "strategy", Type: OptionString, Default: "random", Choices: tuning.Strategies, Description: "Parameter search strategy"},
+				{Key: "target", Type: OptionAgent, Description: "Name of the agent whose configuration is tuned"},
+				{Key: "parameters", Type: OptionString, check: checkSearchSpace, Description: "Numeric options of the target searched, as KEY=MIN:MAX[:STEP] separated by commas"},
+				{Key: "metric", Type: OptionString, Default: "score", Description: "Metric the target reports with its heartbeats that trials are scored by"},
+				{Key: "goal", Type: OptionString, Default: "maximize", Choices: []string{"maximize", "minimize"}, Description: "Whether higher or lower scores are better"},
+				{Key: "trial_duration", Type: OptionDuration, Default: "5m", Description: "Time the target runs with the values of a trial before it is scored"},
+				{Key: "max_trials", Type: OptionInt, Default: 20, Description: "Number of trials to run"},
+			}},
+		},
+		{
+			Name:        ReflectionAgent,
+			Description: "Self-reflection and monitoring",
+			Schema: &ConfigSchema{Options: []ConfigOption{
+				{Key: "report_interval", Type: OptionDuration, Default: "1h", Description: "Time between self-assessment reports"},
+				{Key: "baseline_reports", Type: OptionInt, Default: 24, Description: "Number of past reports the metrics of each agent are compared with"},
+				{Key: "anomaly_threshold", Type: OptionFloat, Default: 3.0, Description: "Report metrics this many standard deviations away from their baseline"},
+				{Key: "slow_reply", Type: OptionDuration, Default: "1s", Description: "Report pairs of agents where replies took this long on average"},
+				{Key: "publish", Type: OptionString, Default: "none", Choices: []string{"none", "issue", "gist"}, Description: "Publish reports with anomalies on GitHub"},
+				{Key: "publish_always", Type: OptionBool, Default: false, Description: "Publish reports without anomalies too"},
+				{Key: "repository", Type: OptionString, Description: "Repository reports are published to as issues, such as github/hub"},
+			}},
+		},
+		{
+			Name:        OrchestratorAgent,
+			Description: "Multi-agent coordination",
+			Schema:      &ConfigSchema{},
+		},
+		{
+			Name:        BrokerAgent,
+			Description: "Message routing and coordination",
+			Schema: &ConfigSchema{Options: []ConfigOption{
+				{Key: "queue_size", Type: OptionInt, Default: 100, Description: "Maximum number of messages held for routing"},
+				{Key: "rules", Type: OptionString, Description: "YAML file of routing rules, relative to the configuration directory"},
+				{Key: "timeout", Type: OptionDuration, Default: "10s", Description: "How long to wait for replies in the first and gather modes"},
+			}},
+		},
+		{
+			Name:        CustomAgent,
+			Description: "User-defined agents",
+			Schema:      &ConfigSchema{AllowUnknown: true},
+		},
+	}
+}
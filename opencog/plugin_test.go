@@ -0,0 +1,156 @@
+package opencog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeDescriptor(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create plugin dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write descriptor: %v", err)
+	}
+}
+
+func TestTypeRegistryBuiltins(t *testing.T) {
+	types := NewTypeRegistry()
+
+	list := types.List()
+	if len(list) != 10 {
+		t.Fatalf("Expected 10 built-in types, got %d", len(list))
+	}
+	if list[0].Name != AtomSpaceAgent {
+		t.Errorf("Expected atomspace first, got %s", list[0].Name)
+	}
+
+	for _, desc := range list {
+		if !desc.Builtin() {
+			t.Errorf("Type %s should be built in", desc.Name)
+		}
+		if desc.HealthCheck.Method != HealthCheckHeartbeat {
+			t.Errorf("Type %s should default to heartbeat health checks", desc.Name)
+		}
+	}
+}
+
+func TestTypeRegistryLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeDescriptor(t, dir, "summarizer.yml", `
+name: summarizer
+description: Summarizes repository activity
+command: [python3, summarizer.py]
+config:
+  options:
+    - key: window
+      type: duration
+      default: 24h
+    - key: limit
+      type: int
+      default: 10
+health_check:
+  method: tcp
+  port: 9000
+`)
+	writeDescriptor(t, dir, "echo.json", `{"name": "echo", "description": "Echoes messages", "command": ["cat"]}`)
+	writeDescriptor(t, dir, "README.md", "not a descriptor")
+
+	types := NewTypeRegistry()
+	if err := types.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+
+	desc, ok := types.Lookup("summarizer")
+	if !ok {
+		t.Fatal("summarizer type should be registered")
+	}
+	if desc.Builtin() {
+		t.Error("Plugin type should not be built in")
+	}
+	if desc.Source != filepath.Join(dir, "summarizer.yml") {
+		t.Errorf("Unexpected source %s", desc.Source)
+	}
+	if len(desc.Command) != 2 || desc.Command[0] != "python3" {
+		t.Errorf("Unexpected command %v", desc.Command)
+	}
+	if desc.HealthCheck.Method != HealthCheckTCP || desc.HealthCheck.Port != 9000 {
+		t.Errorf("Unexpected health check %+v", desc.HealthCheck)
+	}
+
+	config, err := desc.Schema.Apply(desc.Name, map[string]interface{}{"limit": "3"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if config["limit"] != 3 || config["window"] != "24h" {
+		t.Errorf("Unexpected config %v", config)
+	}
+
+	if _, ok := types.Lookup("echo"); !ok {
+		t.Error("echo type should be registered from JSON descriptor")
+	}
+
+	list := types.List()
+	if len(list) != 12 {
+		t.Fatalf("Expected 12 types, got %d", len(list))
+	}
+	if list[10].Name != "echo" || list[11].Name != "summarizer" {
+		t.Errorf("Plugins should be listed after built-ins in name order, got %s, %s", list[10].Name, list[11].Name)
+	}
+}
+
+func TestTypeRegistryLoadDirErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeDescriptor(t, dir, "pln.yml", "name: pln\ndescription: Impostor\n")
+	writeDescriptor(t, dir, "broken.yml", "name: [unterminated\n")
+	writeDescriptor(t, dir, "badcheck.yml", "name: badcheck\nhealth_check:\n  method: ping\n")
+	writeDescriptor(t, dir, "badopt.yml", "name: badopt\nconfig:\n  options:\n    - key: n\n      type: int\n      default: many\n")
+	writeDescriptor(t, dir, "good.yml", "name: good\ndescription: Fine\n")
+
+	types := NewTypeRegistry()
+	err := types.LoadDir(dir)
+	if err == nil {
+		t.Fatal("LoadDir should report invalid descriptors")
+	}
+
+	for _, want := range []string{
+		"pln.yml: agent type pln is built in",
+		"broken.yml: failed to parse descriptor",
+		`badcheck.yml: unknown health check method "ping"`,
+		"badopt.yml: invalid config schema: option n has invalid default",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got:\n%v", want, err)
+		}
+	}
+
+	if _, ok := types.Lookup("good"); !ok {
+		t.Error("Valid descriptors should still be registered")
+	}
+	if desc, _ := types.Lookup(PLNAgent); !desc.Builtin() {
+		t.Error("Built-in type should not be replaced")
+	}
+}
+
+func TestTypeRegistryMissingDir(t *testing.T) {
+	types := NewTypeRegistry()
+	if err := types.LoadDir(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("Missing plugin directory should not be an error, got %v", err)
+	}
+}
+
+func TestTypeRegistryDuplicatePlugin(t *testing.T) {
+	types := NewTypeRegistry()
+	desc := &AgentTypeDescriptor{Name: "dup", Source: "a.yml"}
+	if err := types.Register(desc); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	err := types.Register(&AgentTypeDescriptor{Name: "dup", Source: "b.yml"})
+	if err == nil || !strings.Contains(err.Error(), "already defined in a.yml") {
+		t.Errorf("Expected duplicate error, got %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package opencog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HealthCheckMethod identifies how an agent's health is determined
+type HealthCheckMethod string
+
+const (
+	HealthCheckHeartbeat HealthCheckMethod = "heartbeat"
+	HealthCheckExec      HealthCheckMethod = "exec"
+	HealthCheckHTTP      HealthCheckMethod = "http"
+	HealthCheckTCP       HealthCheckMethod = "tcp"
+)
+
+const (
+	defaultProbeInterval    = 10 * time.Second
+	defaultProbeTimeout     = 2 * time.Second
+	defaultFailureThreshold = 3
+)
+
+// HealthCheck describes how to probe whether an agent is healthy. Heartbeat
+// checks are passive; exec, http and tcp checks actively probe the agent.
+type HealthCheck struct {
+	Method  HealthCheckMethod `json:"method" yaml:"method"`
+	Command []string          `json:"command,omitempty" yaml:"command,omitempty"`
+	Path    string            `json:"path,omitempty" yaml:"path,omitempty"`
+	Port    int               `json:"port,omitempty" yaml:"port,omitempty"`
+
+	Interval         string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout          string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	FailureThreshold int    `json:"failure_threshold,omitempty" yaml:"failure_threshold,omitempty"`
+}
+
+// HealthState summarizes the outcome of an agent's probes
+type HealthState string
+
+const (
+	HealthUnknown  HealthState = "unknown"
+	HealthHealthy  HealthState = "healthy"
+	HealthDegraded HealthState = "degraded"
+	HealthNotReady HealthState = "not-ready"
+)
+
+// AgentHealth records the results of an agent's liveness and readiness probes
+type AgentHealth struct {
+	State             HealthState `json:"state"`
+	Ready             bool        `json:"ready"`
+	LivenessFailures  int         `json:"liveness_failures,omitempty"`
+	ReadinessFailures int         `json:"readiness_failures,omitempty"`
+	LastLiveness      *time.Time  `json:"last_liveness,omitempty"`
+	LastReadiness     *time.Time  `json:"last_readiness,omitempty"`
+	LastError         string      `json:"last_error,omitempty"`
+}
+
+// health returns the agent's health record, creating it if necessary
+func (a *Agent) health() *AgentHealth {
+	if a.Health == nil {
+		a.Health = &AgentHealth{
+			State: HealthUnknown,
+			Ready: !a.Readiness.Active(),
+		}
+	}
+	return a.Health
+}
+
+// updateState derives the overall health state from the probe results
+func (h *AgentHealth) updateState() {
+	switch {
+	case h.LivenessFailures > 0:
+		h.State = HealthDegraded
+	case !h.Ready:
+		h.State = HealthNotReady
+	default:
+		h.State = HealthHealthy
+	}
+}
+
+// ParseHealthCheck parses a probe given on the command line: exec:<command>,
+// http:<path>, http:<port>, http:<port><path>, tcp:<port> or heartbeat.
+// HTTP paths start with a slash, and a port alone keeps the path of the
+// agent's endpoint.
+func ParseHealthCheck(spec string) (*HealthCheck, error) {
+	if spec == string(HealthCheckHeartbeat) {
+		return &HealthCheck{Method: HealthCheckHeartbeat}, nil
+	}
+
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid probe %q, expected exec:<command>, http:[<port>][/<path>] or tcp:<port>", spec)
+	}
+
+	hc := &HealthCheck{Method: HealthCheckMethod(parts[0])}
+	switch hc.Method {
+	case HealthCheckExec:
+		hc.Command = strings.Fields(parts[1])
+	case HealthCheckHTTP:
+		port, path := parts[1], ""
+		if i := strings.Index(port, "/"); i >= 0 {
+			port, path = port[:i], port[i:]
+		}
+		if port != "" {
+			n, err := strconv.Atoi(port)
+			if err != nil || n <= 0 || n > 65535 {
+				return nil, fmt.Errorf("invalid port in probe %q, expected http:[<port>][/<path>]", spec)
+			}
+			hc.Port = n
+		}
+		hc.Path = path
+	case HealthCheckTCP:
+		port, err := strconv.Atoi(parts[1])
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port in probe %q, expected tcp:<port>", spec)
+		}
+		hc.Port = port
+	default:
+		return nil, fmt.Errorf("unknown probe method %q", parts[0])
+	}
+
+	if err := hc.validate(); err != nil {
+		return nil, err
+	}
+	return hc, nil
+}
+
+// validate checks the health check and fills in defaults
+func (hc *HealthCheck) validate() error {
+	switch hc.Method {
+	case "":
+		hc.Method = HealthCheckHeartbeat
+	case HealthCheckHeartbeat, HealthCheckHTTP, HealthCheckTCP:
+	case HealthCheckExec:
+		if len(hc.Command) == 0 {
+			return fmt.Errorf("exec health check requires a command")
+		}
+	default:
+		return fmt.Errorf("unknown health check method %q", hc.Method)
+	}
+
+	for name, value := range map[string]string{"interval": hc.Interval, "timeout": hc.Timeout} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("invalid health check %s %q", name, value)
+		}
+	}
+	if hc.FailureThreshold < 0 {
+		return fmt.Errorf("invalid health check failure threshold %d", hc.FailureThreshold)
+	}
+
+	return nil
+}
+
+// Active reports whether the health check probes the agent rather than
+// relying on heartbeats
+func (hc *HealthCheck) Active() bool {
+	return hc != nil && hc.Method != "" && hc.Method != HealthCheckHeartbeat
+}
+
+// IntervalDuration returns how often the probe runs
+func (hc *HealthCheck) IntervalDuration() time.Duration {
+	return parseDurationOr(hc.Interval, defaultProbeInterval)
+}
+
+// TimeoutDuration returns how long a single probe may take
+func (hc *HealthCheck) TimeoutDuration() time.Duration {
+	return parseDurationOr(hc.Timeout, defaultProbeTimeout)
+}
+
+// Threshold returns the number of consecutive failures after which the probe
+// is considered failed
+func (hc *HealthCheck) Threshold() int {
+	if hc.FailureThreshold > 0 {
+		return hc.FailureThreshold
+	}
+	return defaultFailureThreshold
+}
+
+// String formats the health check the way ParseHealthCheck accepts it
+func (hc *HealthCheck) String() string {
+	switch hc.Method {
+	case HealthCheckExec:
+		return "exec:" + strings.Join(hc.Command, " ")
+	case HealthCheckHTTP:
+		if hc.Port > 0 {
+			return fmt.Sprintf("http:%d%s", hc.Port, hc.Path)
+		}
+		return "http:" + hc.Path
+	case HealthCheckTCP:
+		return fmt.Sprintf("tcp:%d", hc.Port)
+	}
+	return string(hc.Method)
+}
+
+// Probe runs the health check once against agent. It returns nil if the
+// agent passed.
+func (hc *HealthCheck) Probe(agent *Agent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hc.TimeoutDuration())
+	defer cancel()
+
+	switch hc.Method {
+	case HealthCheckExec:
+		return hc.probeExec(ctx, agent)
+	case HealthCheckHTTP:
+		return hc.probeHTTP(ctx, agent)
+	case HealthCheckTCP:
+		return hc.probeTCP(ctx, agent)
+	}
+	return fmt.Errorf("health check method %s cannot be probed", hc.Method)
+}
+
+func (hc *HealthCheck) probeExec(ctx context.Context, agent *Agent) error {
+	env, err := agentEnv(agent)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, hc.Command[0], hc.Command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("exec probe timed out after %s", hc.TimeoutDuration())
+	}
+	if err != nil {
+		msg := strings.TrimSpace(string(output))
+		if msg != "" {
+			return fmt.Errorf("exec probe failed: %v: %s", err, msg)
+		}
+		return fmt.Errorf("exec probe failed: %v", err)
+	}
+	return nil
+}
+
+func (hc *HealthCheck) probeHTTP(ctx context.Context, agent *Agent) error {
+	target, err := hc.httpURL(agent)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("http probe failed: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http probe failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("http probe failed: GET %s returned %s", target, resp.Status)
+	}
+	return nil
+}
+
+func (hc *HealthCheck) probeTCP(ctx context.Context, agent *Agent) error {
+	address, err := hc.tcpAddress(agent)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("tcp probe failed: %v", err)
+	}
+	conn.Close()
+	return nil
+}
+
+// httpURL resolves the probed URL from the agent's endpoint, overriding the
+// port if the health check declares one
+func (hc *HealthCheck) httpURL(agent *Agent) (string, error) {
+	base := agent.Endpoint
+	if base == "" {
+		if hc.Port == 0 {
+			return "", fmt.Errorf("http probe needs an agent endpoint or a port")
+		}
+		base = "http://127.0.0.1"
+	}
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid agent endpoint %q: %v", agent.Endpoint, err)
+	}
+	if hc.Port > 0 {
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(hc.Port))
+	}
+	if hc.Path != "" {
+		u.Path = hc.Path
+	}
+	return u.String(), nil
+}
+
+// tcpAddress resolves the probed address from the agent's endpoint,
+// overriding the port if the health check declares one
+func (hc *HealthCheck) tcpAddress(agent *Agent) (string, error) {
+	host := "127.0.0.1"
+	port := ""
+
+	if agent.Endpoint != "" {
+		endpoint := agent.Endpoint
+		if strings.Contains(endpoint, "://") {
+			u, err := url.Parse(endpoint)
+			if err != nil {
+				return "", fmt.Errorf("invalid agent endpoint %q: %v", agent.Endpoint, err)
+			}
+			endpoint = u.Host
+		}
+		if h, p, err := net.SplitHostPort(endpoint); err == nil {
+			host, port = h, p
+		} else {
+			host = endpoint
+		}
+	}
+	if hc.Port > 0 {
+		port = strconv.Itoa(hc.Port)
+	}
+	if port == "" {
+		return "", fmt.Errorf("tcp probe needs a port")
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func parseDurationOr(value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
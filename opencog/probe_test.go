@@ -0,0 +1,274 @@
+//go:build !windows
+// +build !windows
+
+package opencog
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHealthCheck(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    HealthCheck
+		wantErr bool
+	}{
+		{spec: "heartbeat", want: HealthCheck{Method: HealthCheckHeartbeat}},
+		{spec: "exec:test -f ready", want: HealthCheck{Method: HealthCheckExec, Command: []string{"test", "-f", "ready"}}},
+		{spec: "http:/healthz", want: HealthCheck{Method: HealthCheckHTTP, Path: "/healthz"}},
+		{spec: "http:8080/healthz", want: HealthCheck{Method: HealthCheckHTTP, Port: 8080, Path: "/healthz"}},
+		{spec: "http:8080", want: HealthCheck{Method: HealthCheckHTTP, Port: 8080}},
+		{spec: "http:healthz", wantErr: true},
+		{spec: "http:99999/healthz", wantErr: true},
+		{spec: "tcp:9000", want: HealthCheck{Method: HealthCheckTCP, Port: 9000}},
+		{spec: "tcp:http", wantErr: true},
+		{spec: "tcp:-1", wantErr: true},
+		{spec: "tcp:70000", wantErr: true},
+		{spec: "ping:1", wantErr: true},
+		{spec: "exec:", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			hc, err := ParseHealthCheck(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHealthCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if hc.String() != tt.want.String() {
+				t.Errorf("Expected %s, got %s", tt.want.String(), hc.String())
+			}
+			if hc.Port != tt.want.Port || hc.Path != tt.want.Path {
+				t.Errorf("Expected %+v, got %+v", tt.want, *hc)
+			}
+		})
+	}
+}
+
+func TestHealthCheckDefaults(t *testing.T) {
+	hc := &HealthCheck{Method: HealthCheckTCP, Port: 1}
+	if hc.IntervalDuration() != defaultProbeInterval {
+		t.Errorf("Expected default interval, got %s", hc.IntervalDuration())
+	}
+	if hc.TimeoutDuration() != defaultProbeTimeout {
+		t.Errorf("Expected default timeout, got %s", hc.TimeoutDuration())
+	}
+	if hc.Threshold() != defaultFailureThreshold {
+		t.Errorf("Expected default threshold, got %d", hc.Threshold())
+	}
+
+	hc = &HealthCheck{Method: HealthCheckTCP, Interval: "later"}
+	if err := hc.validate(); err == nil {
+		t.Error("validate should reject an invalid interval")
+	}
+}
+
+func TestExecProbe(t *testing.T) {
+	agent := &Agent{Name: "probe-me"}
+
+	ok := &HealthCheck{Method: HealthCheckExec, Command: []string{"sh", "-c", `test "$HUB_AGENT_NAME" = probe-me`}}
+	if err := ok.Probe(agent); err != nil {
+		t.Errorf("Exec probe should pass, got %v", err)
+	}
+
+	fail := &HealthCheck{Method: HealthCheckExec, Command: []string{"sh", "-c", "echo broken; exit 1"}}
+	err := fail.Probe(agent)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Exec probe should fail with output, got %v", err)
+	}
+
+	slow := &HealthCheck{Method: HealthCheckExec, Command: []string{"sleep", "5"}, Timeout: "50ms"}
+	err = slow.Probe(agent)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Exec probe should time out, got %v", err)
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	agent := &Agent{Name: "web", Endpoint: server.URL}
+
+	ok := &HealthCheck{Method: HealthCheckHTTP, Path: "/healthz"}
+	if err := ok.Probe(agent); err != nil {
+		t.Errorf("HTTP probe should pass, got %v", err)
+	}
+
+	fail := &HealthCheck{Method: HealthCheckHTTP, Path: "/ready"}
+	err := fail.Probe(agent)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("HTTP probe should fail with status, got %v", err)
+	}
+
+	noEndpoint := &HealthCheck{Method: HealthCheckHTTP, Path: "/healthz"}
+	if err := noEndpoint.Probe(&Agent{Name: "nowhere"}); err == nil {
+		t.Error("HTTP probe without endpoint or port should fail")
+	}
+}
+
+func TestTCPProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	hc := &HealthCheck{Method: HealthCheckTCP, Port: port}
+	if err := hc.Probe(&Agent{Name: "tcp"}); err != nil {
+		t.Errorf("TCP probe should pass, got %v", err)
+	}
+
+	viaEndpoint := &HealthCheck{Method: HealthCheckTCP}
+	if err := viaEndpoint.Probe(&Agent{Name: "tcp", Endpoint: listener.Addr().String()}); err != nil {
+		t.Errorf("TCP probe via endpoint should pass, got %v", err)
+	}
+
+	listener.Close()
+	if err := hc.Probe(&Agent{Name: "tcp"}); err == nil {
+		t.Error("TCP probe should fail once the listener is closed")
+	}
+}
+
+func TestLivenessProbeMarksError(t *testing.T) {
+	registry, err := NewRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	agent, _ := NewAgent(AgentConfig{
+		Name:     "flaky",
+		Type:     CustomAgent,
+		Liveness: &HealthCheck{Method: HealthCheckExec, Command: []string{"false"}, Interval: "1ns", FailureThreshold: 2},
+	})
+	agent.Status = StatusRunning
+	registry.Register(agent)
+
+	orchestrator := NewOrchestrator(registry)
+
+	orchestrator.performHealthChecks()
+	if agent.Status != StatusRunning {
+		t.Fatalf("Agent should still be running after one failure, got %s", agent.Status)
+	}
+	if agent.Health.State != HealthDegraded {
+		t.Errorf("Agent should be degraded after one failure, got %s", agent.Health.State)
+	}
+
+	orchestrator.performHealthChecks()
+	if agent.Status != StatusError {
+		t.Errorf("Agent should be in error after reaching the failure threshold, got %s", agent.Status)
+	}
+	if agent.Health.LivenessFailures != 2 {
+		t.Errorf("Expected 2 liveness failures, got %d", agent.Health.LivenessFailures)
+	}
+}
+
+func TestLivenessProbeInterval(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{
+		Name:     "steady",
+		Type:     CustomAgent,
+		Liveness: &HealthCheck{Method: HealthCheckExec, Command: []string{"true"}, Interval: "1h"},
+	})
+	agent.Status = StatusRunning
+	registry.Register(agent)
+
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.performHealthChecks()
+
+	first := *agent.Health.LastLiveness
+	orchestrator.performHealthChecks()
+	if !agent.Health.LastLiveness.Equal(first) {
+		t.Error("Probe should not run again before its interval elapses")
+	}
+	if agent.Health.State != HealthHealthy {
+		t.Errorf("Agent should be healthy, got %s", agent.Health.State)
+	}
+}
+
+func TestReadinessProbe(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{
+		Name:      "warming",
+		Type:      CustomAgent,
+		Readiness: &HealthCheck{Method: HealthCheckExec, Command: []string{"false"}, Interval: "1ns", FailureThreshold: 1},
+	})
+	agent.Status = StatusRunning
+	agent.Metrics = &AgentMetrics{LastHeartbeat: time.Now()}
+	registry.Register(agent)
+
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.performHealthChecks()
+
+	if agent.Status != StatusRunning {
+		t.Errorf("Readiness failures should not change the status, got %s", agent.Status)
+	}
+	if agent.Health.Ready || agent.Health.State != HealthNotReady {
+		t.Errorf("Agent should be not-ready, got %+v", agent.Health)
+	}
+
+	agent.Readiness.Command = []string{"true"}
+	orchestrator.performHealthChecks()
+	if !agent.Health.Ready || agent.Health.State != HealthHealthy {
+		t.Errorf("Agent should be ready after a passing probe, got %+v", agent.Health)
+	}
+}
+
+func TestHeartbeatTimeoutConfigurable(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "quiet", Type: AtomSpaceAgent})
+	agent.Status = StatusRunning
+	agent.Metrics = &AgentMetrics{LastHeartbeat: time.Now().Add(-time.Minute)}
+	registry.Register(agent)
+
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.HeartbeatTimeout = 2 * time.Minute
+	orchestrator.performHealthChecks()
+	if agent.Status != StatusRunning {
+		t.Errorf("Agent within the heartbeat timeout should keep running, got %s", agent.Status)
+	}
+
+	orchestrator.HeartbeatTimeout = 30 * time.Second
+	orchestrator.performHealthChecks()
+	if agent.Status != StatusError {
+		t.Errorf("Agent past the heartbeat timeout should be in error, got %s", agent.Status)
+	}
+}
+
+func TestNewAgentUsesTypeHealthCheck(t *testing.T) {
+	types := DefaultTypes
+	desc := &AgentTypeDescriptor{
+		Name:        "probed",
+		Source:      "probed.yml",
+		HealthCheck: &HealthCheck{Method: HealthCheckTCP, Port: 9000},
+	}
+	if err := types.Register(desc); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	defer func() {
+		types.mu.Lock()
+		delete(types.types, "probed")
+		types.mu.Unlock()
+	}()
+
+	agent, err := NewAgent(AgentConfig{Name: "p", Type: "probed"})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+	if agent.Liveness == nil || agent.Liveness.Method != HealthCheckTCP {
+		t.Errorf("Agent should inherit the type's health check, got %+v", agent.Liveness)
+	}
+}
@@ -0,0 +1,166 @@
+//go:build !windows
+// +build !windows
+
+package opencog
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// stopGracePeriod is how long StopProcess waits for a process group to exit
+// after asking it to terminate, before killing it
+var stopGracePeriod = 5 * time.Second
+
+// StartProcess launches command on behalf of agent in its own process group.
+// Output is appended to the agent's log file under configDir. The process is
+// not waited for; its PID is returned so that later invocations can signal it.
+// The agent's resource limits are applied to the process, and agent.Cgroup is
+// set when a cgroup was created to enforce them. The process is placed in the
+// cgroup before it runs the command, and the start fails if that is not
+// possible. agent.Node is set to the cluster node this host runs, if any,
+// which looks after the process.
+func StartProcess(agent *Agent, command []string, configDir string) (int, error) {
+	if len(command) == 0 {
+		return 0, fmt.Errorf("agent type %s has no launch command", agent.Type)
+	}
+
+	logPath := LogPath(configDir, agent)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+
+	env, err := agentEnv(agent)
+	if err != nil {
+		return 0, err
+	}
+
+	cgroup, err := setupCgroup(agent)
+	if err != nil {
+		// rlimits still apply, so a missing cgroup is not fatal
+		fmt.Fprintf(logFile, "hub: not using a cgroup: %v\n", err)
+	}
+	name := command[0]
+	command = limitCommand(command, agent.Limits, cgroup)
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	// The process waits on its standard input until it is in the cgroup
+	var joined *os.File
+	if cgroup != "" {
+		wait, signal, err := os.Pipe()
+		if err != nil {
+			removeCgroup(cgroup)
+			return 0, fmt.Errorf("failed to launch %s: %w", name, err)
+		}
+		defer wait.Close()
+		defer signal.Close()
+		cmd.Stdin = wait
+		joined = signal
+	}
+
+	if err := cmd.Start(); err != nil {
+		removeCgroup(cgroup)
+		return 0, fmt.Errorf("failed to launch %s: %w", name, err)
+	}
+
+	if joined != nil {
+		err := joinCgroup(cgroup, cmd.Process.Pid)
+		if err == nil {
+			_, err = joined.Write([]byte("\n"))
+		}
+		if err != nil {
+			SignalProcess(cmd.Process.Pid, syscall.SIGKILL)
+			cmd.Wait()
+			removeCgroup(cgroup)
+			return 0, fmt.Errorf("failed to place %s in its cgroup: %w", name, err)
+		}
+	}
+
+	// Reap the child if this process outlives it
+	go cmd.Wait()
+
+	agent.Cgroup = cgroup
+	agent.Node = LocalNode(configDir)
+	return cmd.Process.Pid, nil
+}
+
+// SignalProcess sends sig to the process group led by pid
+func SignalProcess(pid int, sig syscall.Signal) error {
+	if pid <= 0 {
+		return fmt.Errorf("invalid pid %d", pid)
+	}
+	if err := syscall.Kill(-pid, sig); err != nil && err != syscall.ESRCH {
+		return fmt.Errorf("failed to signal process %d: %w", pid, err)
+	}
+	return nil
+}
+
+// StopProcess asks the process group led by pid to terminate, and kills it
+// if it has not exited after a grace period. The group is continued after
+// being asked so that a paused process handles the signal.
+func StopProcess(pid int) error {
+	if err := SignalProcess(pid, syscall.SIGTERM); err != nil {
+		return err
+	}
+	if err := SignalProcess(pid, syscall.SIGCONT); err != nil {
+		return err
+	}
+	if waitGroupExit(pid, stopGracePeriod) {
+		return nil
+	}
+	if err := SignalProcess(pid, syscall.SIGKILL); err != nil {
+		return err
+	}
+	// Killed processes that nobody reaps linger as zombies, which are not
+	// waited for beyond this
+	waitGroupExit(pid, time.Second)
+	return nil
+}
+
+// waitGroupExit waits up to timeout for every process in the group led by
+// pid to exit, and reports whether they did
+func waitGroupExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := syscall.Kill(-pid, 0); err == syscall.ESRCH {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// PauseProcess suspends the process group led by pid
+func PauseProcess(pid int) error {
+	return SignalProcess(pid, syscall.SIGSTOP)
+}
+
+// ResumeProcess continues the suspended process group led by pid
+func ResumeProcess(pid int) error {
+	return SignalProcess(pid, syscall.SIGCONT)
+}
+
+// ProcessAlive reports whether a process with the given pid exists
+func ProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
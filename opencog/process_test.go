@@ -0,0 +1,160 @@
+//go:build !windows
+// +build !windows
+
+package opencog
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartAndStopProcess(t *testing.T) {
+	dir := t.TempDir()
+	agent, err := NewAgent(AgentConfig{Name: "sleeper", Type: CustomAgent})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+
+	pid, err := StartProcess(agent, []string{"sh", "-c", "echo started $HUB_AGENT_NAME; exec sleep 30"}, dir)
+	if err != nil {
+		t.Fatalf("StartProcess failed: %v", err)
+	}
+	if !ProcessAlive(pid) {
+		t.Fatal("Process should be alive after start")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var output []byte
+	for time.Now().Before(deadline) {
+		output, _ = os.ReadFile(LogPath(dir, agent))
+		if len(output) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(string(output), "started sleeper") {
+		t.Errorf("Log should contain process output, got %q", output)
+	}
+
+	if err := StopProcess(pid); err != nil {
+		t.Fatalf("StopProcess failed: %v", err)
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for ProcessAlive(pid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ProcessAlive(pid) {
+		t.Error("Process should have exited after StopProcess")
+	}
+
+}
+
+func TestStopProcessKillsProcessesThatDoNotExit(t *testing.T) {
+	defer func(grace time.Duration) { stopGracePeriod = grace }(stopGracePeriod)
+	stopGracePeriod = 100 * time.Millisecond
+
+	dir := t.TempDir()
+	agent, _ := NewAgent(AgentConfig{Name: "stubborn", Type: CustomAgent})
+	pid, err := StartProcess(agent, []string{"sh", "-c", "trap '' TERM; echo trapped; while :; do sleep 1; done"}, dir)
+	if err != nil {
+		t.Fatalf("StartProcess failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if output, _ := os.ReadFile(LogPath(dir, agent)); len(output) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := StopProcess(pid); err != nil {
+		t.Fatalf("StopProcess failed: %v", err)
+	}
+	if !waitForExit(pid) {
+		t.Error("Process ignoring SIGTERM should have been killed")
+	}
+}
+
+func TestStartProcessWithoutCommand(t *testing.T) {
+	agent, _ := NewAgent(AgentConfig{Name: "idle", Type: CustomAgent})
+	if _, err := StartProcess(agent, nil, t.TempDir()); err == nil {
+		t.Error("StartProcess should fail without a command")
+	}
+}
+
+func TestPauseAndResumeProcess(t *testing.T) {
+	agent, _ := NewAgent(AgentConfig{Name: "pausable", Type: CustomAgent})
+	pid, err := StartProcess(agent, []string{"sleep", "30"}, t.TempDir())
+	if err != nil {
+		t.Fatalf("StartProcess failed: %v", err)
+	}
+	defer StopProcess(pid)
+
+	if err := PauseProcess(pid); err != nil {
+		t.Fatalf("PauseProcess failed: %v", err)
+	}
+	if state := waitProcessState(t, pid, true); state != "T" {
+		t.Errorf("Expected stopped process state T, got %s", state)
+	}
+
+	if err := ResumeProcess(pid); err != nil {
+		t.Fatalf("ResumeProcess failed: %v", err)
+	}
+	if state := waitProcessState(t, pid, false); state == "T" {
+		t.Error("Process should no longer be stopped after ResumeProcess")
+	}
+}
+
+// waitProcessState polls the single-letter state of pid from /proc until the
+// process is (or is no longer) stopped, and returns the last state seen
+func waitProcessState(t *testing.T, pid int, stopped bool) string {
+	t.Helper()
+
+	var state string
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+		if err != nil {
+			t.Skip("/proc is not available")
+		}
+		fields := strings.Fields(string(data[strings.LastIndex(string(data), ")")+1:]))
+		state = fields[0]
+		if (state == "T") == stopped {
+			return state
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return state
+}
+
+func TestRegistryStopTerminatesProcess(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "worker", Type: CustomAgent})
+	pid, err := StartProcess(agent, []string{"sleep", "30"}, registry.Dir())
+	if err != nil {
+		t.Fatalf("StartProcess failed: %v", err)
+	}
+	agent.PID = pid
+	agent.Status = StatusStarting
+	agent.Transition(StatusRunning, "")
+	registry.Register(agent)
+
+	if err := registry.Stop(agent, "tester", "removed by user"); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if agent.Status != StatusStopped || agent.PID != 0 || agent.Cgroup != "" {
+		t.Errorf("Expected a stopped agent without a process, got %s with PID %d", agent.Status, agent.PID)
+	}
+	if !waitForExit(pid) {
+		t.Error("Process should have exited")
+	}
+	events, _ := registry.Events(agent.ID, EventFilter{Kind: EventLifecycle})
+	if len(events) != 2 || events[0].Reason != "removed by user" {
+		t.Errorf("Expected the stop to be recorded, got %+v", events)
+	}
+}
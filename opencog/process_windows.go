@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+package opencog
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// StartProcess is not supported on windows
+func StartProcess(agent *Agent, command []string, configDir string) (int, error) {
+	return 0, fmt.Errorf("launching agent processes is not supported on windows")
+}
+
+// SignalProcess is not supported on windows
+func SignalProcess(pid int, sig syscall.Signal) error {
+	return fmt.Errorf("signaling agent processes is not supported on windows")
+}
+
+// StopProcess is not supported on windows
+func StopProcess(pid int) error {
+	return fmt.Errorf("stopping agent processes is not supported on windows")
+}
+
+// PauseProcess is not supported on windows
+func PauseProcess(pid int) error {
+	return fmt.Errorf("pausing agent processes is not supported on windows")
+}
+
+// ResumeProcess is not supported on windows
+func ResumeProcess(pid int) error {
+	return fmt.Errorf("resuming agent processes is not supported on windows")
+}
+
+// ProcessAlive always reports false on windows
+func ProcessAlive(pid int) bool {
+	return false
+}
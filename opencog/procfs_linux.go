@@ -0,0 +1,67 @@
+//go:build linux
+// +build linux
+
+package opencog
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is the kernel's USER_HZ, which is 100 on all supported
+// architectures
+const clockTicks = 100
+
+// procStat holds the statistics of a process read from /proc/<pid>/stat
+type procStat struct {
+	cpuSeconds float64
+	threads    int
+	rss        int64
+}
+
+// readProcStat reads the CPU time, user and system, thread count and
+// resident memory of pid
+func readProcStat(pid int) (*procStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	// The command name may contain spaces, so fields are counted from the
+	// closing parenthesis: utime and stime are fields 14 and 15, num_threads
+	// is field 20 and rss, in pages, is field 24
+	stat := string(data)
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return nil, fmt.Errorf("malformed stat for process %d", pid)
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("malformed stat for process %d", pid)
+	}
+
+	var values [4]int64
+	for i, field := range []int{11, 12, 17, 21} {
+		values[i], err = strconv.ParseInt(fields[field], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed stat for process %d", pid)
+		}
+	}
+
+	return &procStat{
+		cpuSeconds: float64(values[0]+values[1]) / clockTicks,
+		threads:    int(values[2]),
+		rss:        values[3] * int64(os.Getpagesize()),
+	}, nil
+}
+
+// procOpenFiles returns the number of file descriptors open in pid
+func procOpenFiles(pid int) (int, error) {
+	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package opencog
+
+import "fmt"
+
+// procStat holds the statistics of a process
+type procStat struct {
+	cpuSeconds float64
+	threads    int
+	rss        int64
+}
+
+// readProcStat is only available on linux
+func readProcStat(pid int) (*procStat, error) {
+	return nil, fmt.Errorf("process statistics are only available on linux")
+}
+
+// procOpenFiles is only available on linux
+func procOpenFiles(pid int) (int, error) {
+	return 0, fmt.Errorf("process statistics are only available on linux")
+}
@@ -0,0 +1,1034 @@
+// Package raft replicates a log of commands among the members of a group
+// with the Raft consensus algorithm. The members elect a leader, which
+// appends the commands proposed to it to its log and replicates the log to
+// the other members. Once a majority of the members holds an entry, it is
+// committed, and every member applies the committed entries to its state
+// machine in the same order. Logs are compacted into snapshots of the state
+// machine, which are also sent to members too far behind the leader, and
+// members are added and removed one at a time. Members talk to each other
+// through a Transport and keep what they must not forget in a Storage.
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Role is the part a member plays in its group
+type Role string
+
+const (
+	Follower  Role = "follower"
+	Candidate Role = "candidate"
+	Leader    Role = "leader"
+)
+
+// EntryKind says what an entry of the log holds
+type EntryKind string
+
+const (
+	// EntryCommand holds a command for the state machine
+	EntryCommand EntryKind = "command"
+	// EntryMembers holds the members of the group from the entry on
+	EntryMembers EntryKind = "members"
+	// EntryNoop is appended by leaders when they are elected, to commit
+	// the entries of earlier terms
+	EntryNoop EntryKind = "noop"
+)
+
+// Entry is an entry of the log
+type Entry struct {
+	Index   uint64    `json:"index"`
+	Term    uint64    `json:"term"`
+	Kind    EntryKind `json:"kind"`
+	Data    []byte    `json:"data,omitempty"`
+	Members []string  `json:"members,omitempty"`
+}
+
+// maxBatch bounds the number of entries sent to a member at once
+const maxBatch = 64
+
+var (
+	// ErrLeadershipLost is returned when the leader an entry was proposed
+	// to stepped down before the entry was committed. The entry may still
+	// be committed by the next leader.
+	ErrLeadershipLost = errors.New("leadership was lost before the entry was committed")
+	// ErrTimeout is returned when an entry was not committed in time. It
+	// may still be committed.
+	ErrTimeout = errors.New("the entry was not committed in time")
+	// ErrStopped is returned by members that are stopped
+	ErrStopped = errors.New("the raft member is stopped")
+	// ErrMembershipChange is returned when a change of the members is
+	// proposed while another is not committed yet
+	ErrMembershipChange = errors.New("another membership change is in progress")
+)
+
+// NotLeaderError is returned when entries are proposed to a member that
+// does not lead its group
+type NotLeaderError struct {
+	// Leader is the member the group follows, if it knows of one
+	Leader string
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.Leader == "" {
+		return "no raft leader is elected"
+	}
+	return fmt.Sprintf("%s is the raft leader", e.Leader)
+}
+
+// StateMachine is what the log is applied to
+type StateMachine interface {
+	// Apply applies a committed command. Its error is returned to the
+	// proposer of the command, and must be decided by the state of the
+	// machine alone, so that every member applies commands alike.
+	Apply(command []byte) error
+	// Snapshot returns the state of the machine, and Restore replaces it
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+}
+
+// Transport carries the requests of a member to the others
+type Transport interface {
+	// Call sends a request of the given kind to member peer, whose Node
+	// passes it to Handle, and decodes the reply into reply
+	Call(peer, kind string, req, reply interface{}) error
+}
+
+// Config configures a member
+type Config struct {
+	// ID names the member, uniquely within its group
+	ID string
+	// Members bootstrap a group when the storage holds no state. Members
+	// started without wait to be added to a group.
+	Members      []string
+	Storage      Storage
+	Transport    Transport
+	StateMachine StateMachine
+	// ElectionTicks is the number of ticks followers wait for the leader
+	// before they elect another, 10 unless set. Each election times out
+	// after a random number of ticks between once and twice as many.
+	ElectionTicks int
+	// HeartbeatTicks is the number of ticks between the heartbeats of the
+	// leader, 2 unless set
+	HeartbeatTicks int
+	// SnapshotEntries is the number of entries applied since the last
+	// snapshot after which the log is compacted, 256 unless set
+	SnapshotEntries int
+}
+
+// Status is what a member knows of its group
+type Status struct {
+	ID      string   `json:"id"`
+	Role    Role     `json:"role"`
+	Term    uint64   `json:"term"`
+	Leader  string   `json:"leader,omitempty"`
+	Members []string `json:"members"`
+	// CommitIndex is the last entry known to be committed, AppliedIndex
+	// the last applied, LastIndex the last in the log and SnapshotIndex the
+	// last compacted into the snapshot
+	CommitIndex   uint64 `json:"commit_index"`
+	AppliedIndex  uint64 `json:"applied_index"`
+	LastIndex     uint64 `json:"last_index"`
+	SnapshotIndex uint64 `json:"snapshot_index"`
+	// Peers holds, on the leader, how far the log of the other members
+	// matches its own and when they last answered it
+	Peers []PeerStatus `json:"peers,omitempty"`
+	// Error is why the member last failed to store its state
+	Error string `json:"error,omitempty"`
+}
+
+// PeerStatus is what the leader knows of another member
+type PeerStatus struct {
+	ID          string    `json:"id"`
+	Match       uint64    `json:"match"`
+	LastContact time.Time `json:"last_contact,omitempty"`
+}
+
+// voteRequest asks for the vote of a member, and appendRequest appends
+// entries to the log of a member, or only tells it that the leader is alive
+type voteRequest struct {
+	Term      uint64 `json:"term"`
+	Candidate string `json:"candidate"`
+	LastIndex uint64 `json:"last_index"`
+	LastTerm  uint64 `json:"last_term"`
+}
+
+type voteReply struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+type appendRequest struct {
+	Term      uint64  `json:"term"`
+	Leader    string  `json:"leader"`
+	PrevIndex uint64  `json:"prev_index"`
+	PrevTerm  uint64  `json:"prev_term"`
+	Entries   []Entry `json:"entries,omitempty"`
+	Commit    uint64  `json:"commit"`
+}
+
+type appendReply struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
+	// LastIndex is the last entry the member holds that may match the
+	// leader's log, for the leader to send the entries after it
+	LastIndex uint64 `json:"last_index"`
+}
+
+// snapshotRequest replaces the log of a member too far behind the leader
+// with the leader's snapshot
+type snapshotRequest struct {
+	Term     uint64    `json:"term"`
+	Leader   string    `json:"leader"`
+	Snapshot *Snapshot `json:"snapshot"`
+}
+
+type snapshotReply struct {
+	Term uint64 `json:"term"`
+}
+
+type waiter struct {
+	term uint64
+	done chan error
+}
+
+// Node is a member of a group
+type Node struct {
+	config Config
+	// applyMu serializes what is done to the state machine, and is always
+	// acquired before mu
+	applyMu sync.Mutex
+
+	mu       sync.Mutex
+	role     Role
+	term     uint64
+	votedFor string
+	leader   string
+	// log holds the entries after the snapshot
+	log          []Entry
+	snapshot     Snapshot
+	snapshotData []byte
+	members      []string
+	commit       uint64
+	applied      uint64
+	err          error
+
+	electionElapsed  int
+	electionTimeout  int
+	heartbeatElapsed int
+	quorumElapsed    int
+	votes            map[string]bool
+	// next and match are, on the leader, the next entry to send to each
+	// member and the last known to match
+	next     map[string]uint64
+	match    map[string]uint64
+	inflight map[string]bool
+	heard    map[string]bool
+	contact  map[string]time.Time
+	waiters  map[uint64]waiter
+	random   *rand.Rand
+
+	stopped bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewNode returns a member as its storage left it, restoring the state
+// machine from the snapshot, or bootstraps a group of config.Members if the
+// storage holds no state
+func NewNode(config Config) (*Node, error) {
+	if config.ID == "" {
+		return nil, fmt.Errorf("raft member has no ID")
+	}
+	if config.ElectionTicks <= 0 {
+		config.ElectionTicks = 10
+	}
+	if config.HeartbeatTicks <= 0 {
+		config.HeartbeatTicks = 2
+	}
+	if config.SnapshotEntries <= 0 {
+		config.SnapshotEntries = 256
+	}
+	seed := fnv.New64a()
+	seed.Write([]byte(config.ID))
+
+	n := &Node{
+		config:   config,
+		role:     Follower,
+		votes:    make(map[string]bool),
+		next:     make(map[string]uint64),
+		match:    make(map[string]uint64),
+		inflight: make(map[string]bool),
+		heard:    make(map[string]bool),
+		contact:  make(map[string]time.Time),
+		waiters:  make(map[uint64]waiter),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(seed.Sum64()))),
+		stop:     make(chan struct{}),
+	}
+
+	state, snapshot, err := config.Storage.Load()
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		if err := config.StateMachine.Restore(snapshot.Data); err != nil {
+			return nil, fmt.Errorf("failed to restore raft snapshot: %w", err)
+		}
+		n.snapshot = Snapshot{Index: snapshot.Index, Term: snapshot.Term, Members: snapshot.Members}
+		n.snapshotData = snapshot.Data
+		n.commit, n.applied = snapshot.Index, snapshot.Index
+	}
+	if state != nil {
+		n.term, n.votedFor = state.Term, state.VotedFor
+		for _, e := range state.Entries {
+			if e.Index > n.snapshot.Index {
+				n.log = append(n.log, e)
+			}
+		}
+	} else if snapshot == nil && len(config.Members) > 0 {
+		members := append([]string{}, config.Members...)
+		sort.Strings(members)
+		n.term = 1
+		n.log = []Entry{{Index: 1, Term: 1, Kind: EntryMembers, Members: members}}
+		n.persist()
+		if n.err != nil {
+			return nil, n.err
+		}
+	}
+	n.members = n.latestMembers()
+	n.resetElection()
+	return n, nil
+}
+
+// Start ticks the member at every interval, until it is stopped
+func (n *Node) Start(interval time.Duration) {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n.tick()
+			case <-n.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the member. Entries waiting to be committed fail.
+func (n *Node) Stop() {
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return
+	}
+	n.stopped = true
+	n.failWaiters(ErrStopped)
+	n.mu.Unlock()
+	close(n.stop)
+	n.wg.Wait()
+}
+
+// Propose appends command to the log of the group and waits up to timeout
+// for it to be applied, returning the error the state machine applied it
+// with. Only the leader accepts commands; other members return a
+// NotLeaderError.
+func (n *Node) Propose(command []byte, timeout time.Duration) error {
+	n.mu.Lock()
+	if err := n.checkLeader(); err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	index, done := n.appendEntry(Entry{Kind: EntryCommand, Data: command})
+	n.mu.Unlock()
+	return n.wait(index, done, timeout)
+}
+
+// AddMember adds a member to the group and waits up to timeout for the
+// change to be committed
+func (n *Node) AddMember(id string, timeout time.Duration) error {
+	return n.changeMembers(id, true, timeout)
+}
+
+// RemoveMember removes a member from the group and waits up to timeout for
+// the change to be committed. A leader that removes itself steps down once
+// the change is committed.
+func (n *Node) RemoveMember(id string, timeout time.Duration) error {
+	return n.changeMembers(id, false, timeout)
+}
+
+func (n *Node) changeMembers(id string, add bool, timeout time.Duration) error {
+	n.mu.Lock()
+	if err := n.checkLeader(); err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	for _, e := range n.log {
+		if e.Kind == EntryMembers && e.Index > n.commit {
+			n.mu.Unlock()
+			return ErrMembershipChange
+		}
+	}
+	if isIn(n.members, id) == add {
+		n.mu.Unlock()
+		return nil
+	}
+
+	var members []string
+	for _, m := range n.members {
+		if m != id {
+			members = append(members, m)
+		}
+	}
+	if add {
+		members = append(members, id)
+		sort.Strings(members)
+	} else if len(members) == 0 {
+		n.mu.Unlock()
+		return fmt.Errorf("the last member of a group cannot be removed")
+	}
+	index, done := n.appendEntry(Entry{Kind: EntryMembers, Members: members})
+	n.mu.Unlock()
+	return n.wait(index, done, timeout)
+}
+
+// checkLeader returns an error unless the member leads its group. n.mu
+// must be held.
+func (n *Node) checkLeader() error {
+	if n.stopped {
+		return ErrStopped
+	}
+	if n.role != Leader {
+		return &NotLeaderError{Leader: n.leader}
+	}
+	return nil
+}
+
+// appendEntry appends an entry of the current term to the leader's log and
+// sends it to the other members. n.mu must be held.
+func (n *Node) appendEntry(e Entry) (uint64, chan error) {
+	e.Index = n.lastIndex() + 1
+	e.Term = n.term
+	n.log = append(n.log, e)
+	if e.Kind == EntryMembers {
+		n.members = e.Members
+	}
+	n.persist()
+
+	done := make(chan error, 1)
+	n.waiters[e.Index] = waiter{term: n.term, done: done}
+	n.broadcast()
+	n.advanceCommit()
+	return e.Index, done
+}
+
+func (n *Node) wait(index uint64, done chan error, timeout time.Duration) error {
+	// Groups of one member commit right away
+	n.applyCommitted()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		n.mu.Lock()
+		delete(n.waiters, index)
+		n.mu.Unlock()
+		return ErrTimeout
+	}
+}
+
+// Status returns what the member knows of its group
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	status := Status{
+		ID:            n.config.ID,
+		Role:          n.role,
+		Term:          n.term,
+		Leader:        n.leader,
+		Members:       append([]string{}, n.members...),
+		CommitIndex:   n.commit,
+		AppliedIndex:  n.applied,
+		LastIndex:     n.lastIndex(),
+		SnapshotIndex: n.snapshot.Index,
+	}
+	if n.err != nil {
+		status.Error = n.err.Error()
+	}
+	if n.role == Leader {
+		for _, peer := range n.peers() {
+			status.Peers = append(status.Peers, PeerStatus{ID: peer, Match: n.match[peer], LastContact: n.contact[peer]})
+		}
+	}
+	return status
+}
+
+// Handle answers a request of another member, of the kind its Transport
+// was called with
+func (n *Node) Handle(kind string, body json.RawMessage) (interface{}, error) {
+	n.mu.Lock()
+	stopped := n.stopped
+	n.mu.Unlock()
+	if stopped {
+		return nil, ErrStopped
+	}
+
+	switch kind {
+	case "vote":
+		var req voteRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return n.handleVote(&req), nil
+	case "append":
+		var req appendRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return n.handleAppend(&req), nil
+	case "snapshot":
+		var req snapshotRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		if req.Snapshot == nil {
+			return nil, fmt.Errorf("no snapshot to install")
+		}
+		return n.handleSnapshot(&req), nil
+	}
+	return nil, fmt.Errorf("unknown raft request %q", kind)
+}
+
+func (n *Node) tick() {
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return
+	}
+	if n.role == Leader {
+		n.heartbeatElapsed++
+		if n.heartbeatElapsed >= n.config.HeartbeatTicks {
+			n.heartbeatElapsed = 0
+			n.broadcast()
+		}
+		// Leaders that cannot reach a majority step down, so that they stop
+		// taking commands they cannot commit
+		n.quorumElapsed++
+		if n.quorumElapsed >= n.config.ElectionTicks {
+			n.quorumElapsed = 0
+			n.heard[n.config.ID] = true
+			if !n.hasQuorum(n.heard) {
+				n.becomeFollower(n.term, "")
+			}
+			n.heard = make(map[string]bool)
+		}
+	} else {
+		n.electionElapsed++
+		if n.electionElapsed >= n.electionTimeout && isIn(n.members, n.config.ID) {
+			n.campaign()
+		}
+	}
+	n.mu.Unlock()
+	n.applyCommitted()
+}
+
+// campaign starts an election. n.mu must be held.
+func (n *Node) campaign() {
+	n.role = Candidate
+	n.term++
+	n.votedFor = n.config.ID
+	n.leader = ""
+	n.votes = map[string]bool{n.config.ID: true}
+	n.persist()
+	n.resetElection()
+	if n.hasQuorum(n.votes) {
+		n.becomeLeader()
+		return
+	}
+
+	req := voteRequest{Term: n.term, Candidate: n.config.ID, LastIndex: n.lastIndex()}
+	req.LastTerm, _ = n.termAt(req.LastIndex)
+	for _, peer := range n.peers() {
+		n.wg.Add(1)
+		go func(peer string) {
+			defer n.wg.Done()
+			var reply voteReply
+			if err := n.config.Transport.Call(peer, "vote", req, &reply); err != nil {
+				return
+			}
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if n.stopped {
+				return
+			}
+			if reply.Term > n.term {
+				n.becomeFollower(reply.Term, "")
+				return
+			}
+			if n.role != Candidate || n.term != req.Term || !reply.Granted {
+				return
+			}
+			n.votes[peer] = true
+			if n.hasQuorum(n.votes) {
+				n.becomeLeader()
+			}
+		}(peer)
+	}
+}
+
+// becomeLeader takes the lead of the group. n.mu must be held.
+func (n *Node) becomeLeader() {
+	n.role = Leader
+	n.leader = n.config.ID
+	n.next = make(map[string]uint64)
+	n.match = make(map[string]uint64)
+	n.heard = make(map[string]bool)
+	n.heartbeatElapsed, n.quorumElapsed = 0, 0
+	// Members count as heard from when the leader is elected, until they
+	// fail to answer it
+	for _, peer := range n.peers() {
+		n.contact[peer] = time.Now()
+	}
+	n.log = append(n.log, Entry{Index: n.lastIndex() + 1, Term: n.term, Kind: EntryNoop})
+	n.persist()
+	n.broadcast()
+	n.advanceCommit()
+}
+
+// becomeFollower follows leader, if known, in term. n.mu must be held.
+func (n *Node) becomeFollower(term uint64, leader string) {
+	if n.role == Leader {
+		n.failWaiters(ErrLeadershipLost)
+	}
+	if term > n.term {
+		n.term = term
+		n.votedFor = ""
+		n.persist()
+	}
+	n.role = Follower
+	n.leader = leader
+	n.resetElection()
+}
+
+func (n *Node) resetElection() {
+	n.electionElapsed = 0
+	n.electionTimeout = n.config.ElectionTicks + n.random.Intn(n.config.ElectionTicks)
+}
+
+func (n *Node) failWaiters(err error) {
+	for index, w := range n.waiters {
+		w.done <- err
+		delete(n.waiters, index)
+	}
+}
+
+// broadcast sends the other members the entries they miss, or a heartbeat.
+// n.mu must be held.
+func (n *Node) broadcast() {
+	for _, peer := range n.peers() {
+		n.send(peer)
+	}
+}
+
+// send sends a member the entries it misses, or the snapshot if they were
+// compacted, unless a request to the member is in flight. n.mu must be
+// held.
+func (n *Node) send(peer string) {
+	if n.inflight[peer] || n.stopped {
+		return
+	}
+	next, ok := n.next[peer]
+	if !ok {
+		next = n.lastIndex() + 1
+		n.next[peer] = next
+		if n.contact[peer].IsZero() {
+			n.contact[peer] = time.Now()
+		}
+	}
+	n.inflight[peer] = true
+	n.wg.Add(1)
+
+	if next <= n.snapshot.Index {
+		snapshot := n.snapshot
+		snapshot.Data = n.snapshotData
+		req := snapshotRequest{Term: n.term, Leader: n.config.ID, Snapshot: &snapshot}
+		go func() {
+			defer n.wg.Done()
+			var reply snapshotReply
+			err := n.config.Transport.Call(peer, "snapshot", req, &reply)
+			n.replied(peer, req.Term, reply.Term, err, func() {
+				if snapshot.Index > n.match[peer] {
+					n.match[peer] = snapshot.Index
+				}
+				n.next[peer] = n.match[peer] + 1
+			})
+		}()
+		return
+	}
+
+	req := appendRequest{Term: n.term, Leader: n.config.ID, PrevIndex: next - 1, Commit: n.commit}
+	req.PrevTerm, _ = n.termAt(req.PrevIndex)
+	for i := next; i <= n.lastIndex() && len(req.Entries) < maxBatch; i++ {
+		req.Entries = append(req.Entries, *n.entryAt(i))
+	}
+	go func() {
+		defer n.wg.Done()
+		var reply appendReply
+		err := n.config.Transport.Call(peer, "append", req, &reply)
+		n.replied(peer, req.Term, reply.Term, err, func() {
+			if reply.Success {
+				if match := req.PrevIndex + uint64(len(req.Entries)); match > n.match[peer] {
+					n.match[peer] = match
+				}
+				n.next[peer] = n.match[peer] + 1
+				n.advanceCommit()
+				return
+			}
+			// Back up to the last entry that may match
+			next := n.next[peer] - 1
+			if reply.LastIndex+1 < next {
+				next = reply.LastIndex + 1
+			}
+			if next < 1 {
+				next = 1
+			}
+			n.next[peer] = next
+		})
+	}()
+}
+
+// replied handles the reply of a member to a request of the leader sent in
+// term, calling update if the member answered while the leader still leads,
+// and sends the member what it still misses
+func (n *Node) replied(peer string, term, replyTerm uint64, err error, update func()) {
+	n.mu.Lock()
+	n.inflight[peer] = false
+	if n.stopped || err != nil {
+		n.mu.Unlock()
+		return
+	}
+	if replyTerm > n.term {
+		n.becomeFollower(replyTerm, "")
+		n.mu.Unlock()
+		return
+	}
+	if n.role != Leader || n.term != term {
+		n.mu.Unlock()
+		return
+	}
+	n.heard[peer] = true
+	n.contact[peer] = time.Now()
+	update()
+	if isIn(n.members, peer) && n.next[peer] <= n.lastIndex() {
+		n.send(peer)
+	}
+	n.mu.Unlock()
+	n.applyCommitted()
+}
+
+// advanceCommit commits the entries of the current term a majority of the
+// members hold, with the entries before them. n.mu must be held.
+func (n *Node) advanceCommit() {
+	for i := n.lastIndex(); i > n.commit; i-- {
+		if term, _ := n.termAt(i); term != n.term {
+			break
+		}
+		holders := make(map[string]bool)
+		for _, m := range n.members {
+			holders[m] = m == n.config.ID || n.match[m] >= i
+		}
+		if n.hasQuorum(holders) {
+			n.commit = i
+			break
+		}
+	}
+}
+
+func (n *Node) handleVote(req *voteRequest) *voteReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term < n.term {
+		return &voteReply{Term: n.term}
+	}
+	// Members that hear from their leader ignore candidates, so that
+	// members removed from the group, which the leader no longer sends
+	// heartbeats to, cannot disrupt it
+	if n.leader != "" && n.electionElapsed < n.config.ElectionTicks {
+		return &voteReply{Term: n.term}
+	}
+	if req.Term > n.term {
+		n.becomeFollower(req.Term, "")
+	}
+
+	lastIndex := n.lastIndex()
+	lastTerm, _ := n.termAt(lastIndex)
+	upToDate := req.LastTerm > lastTerm || (req.LastTerm == lastTerm && req.LastIndex >= lastIndex)
+	if (n.votedFor == "" || n.votedFor == req.Candidate) && upToDate {
+		n.votedFor = req.Candidate
+		n.persist()
+		n.resetElection()
+		return &voteReply{Term: n.term, Granted: true}
+	}
+	return &voteReply{Term: n.term}
+}
+
+func (n *Node) handleAppend(req *appendRequest) *appendReply {
+	n.mu.Lock()
+	if req.Term < n.term {
+		defer n.mu.Unlock()
+		return &appendReply{Term: n.term}
+	}
+	n.becomeFollower(req.Term, req.Leader)
+	reply := &appendReply{Term: n.term}
+
+	// Entries compacted into the snapshot are committed, and so match
+	prev, prevTerm, entries := req.PrevIndex, req.PrevTerm, req.Entries
+	if prev < n.snapshot.Index {
+		skip := n.snapshot.Index - prev
+		if skip > uint64(len(entries)) {
+			skip = uint64(len(entries))
+		}
+		entries = entries[skip:]
+		prev, prevTerm = n.snapshot.Index, n.snapshot.Term
+	}
+	if prev > n.lastIndex() {
+		reply.LastIndex = n.lastIndex()
+		n.mu.Unlock()
+		return reply
+	}
+	if term, _ := n.termAt(prev); term != prevTerm {
+		// Skip the entries of the conflicting term at once
+		i := prev
+		for i > n.snapshot.Index+1 {
+			if t, _ := n.termAt(i - 1); t != term {
+				break
+			}
+			i--
+		}
+		reply.LastIndex = i - 1
+		n.mu.Unlock()
+		return reply
+	}
+
+	changed := false
+	for i, e := range entries {
+		if e.Index <= n.lastIndex() {
+			if term, _ := n.termAt(e.Index); term == e.Term {
+				continue
+			}
+			n.log = n.log[:e.Index-n.snapshot.Index-1]
+		}
+		n.log = append(n.log, entries[i:]...)
+		changed = true
+		break
+	}
+	if changed {
+		n.members = n.latestMembers()
+		n.persist()
+	}
+
+	reply.Success = true
+	reply.LastIndex = prev + uint64(len(entries))
+	if req.Commit > n.commit {
+		n.commit = req.Commit
+		if n.commit > reply.LastIndex {
+			n.commit = reply.LastIndex
+		}
+	}
+	n.mu.Unlock()
+	n.applyCommitted()
+	return reply
+}
+
+func (n *Node) handleSnapshot(req *snapshotRequest) *snapshotReply {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term < n.term {
+		return &snapshotReply{Term: n.term}
+	}
+	n.becomeFollower(req.Term, req.Leader)
+	snapshot := req.Snapshot
+	if snapshot.Index <= n.commit {
+		return &snapshotReply{Term: n.term}
+	}
+
+	if err := n.config.StateMachine.Restore(snapshot.Data); err != nil {
+		n.err = fmt.Errorf("failed to restore raft snapshot: %w", err)
+		return &snapshotReply{Term: n.term}
+	}
+	// Entries after the snapshot are kept if the log matches it
+	var log []Entry
+	if term, ok := n.termAt(snapshot.Index); ok && term == snapshot.Term && snapshot.Index > n.snapshot.Index {
+		log = append(log, n.log[snapshot.Index-n.snapshot.Index:]...)
+	}
+	n.log = log
+	n.snapshot = Snapshot{Index: snapshot.Index, Term: snapshot.Term, Members: snapshot.Members}
+	n.snapshotData = snapshot.Data
+	n.commit, n.applied = snapshot.Index, snapshot.Index
+	n.members = n.latestMembers()
+	n.saveSnapshot()
+	n.persist()
+	return &snapshotReply{Term: n.term}
+}
+
+// applyCommitted applies the committed entries to the state machine,
+// answers their proposers and compacts the log when it grew long enough
+func (n *Node) applyCommitted() {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+
+	for {
+		n.mu.Lock()
+		if n.stopped || n.applied >= n.commit {
+			n.mu.Unlock()
+			break
+		}
+		e := *n.entryAt(n.applied + 1)
+		n.mu.Unlock()
+
+		var err error
+		if e.Kind == EntryCommand {
+			err = n.config.StateMachine.Apply(e.Data)
+		}
+
+		n.mu.Lock()
+		n.applied = e.Index
+		if w, ok := n.waiters[e.Index]; ok {
+			if w.term != e.Term {
+				err = ErrLeadershipLost
+			}
+			w.done <- err
+			delete(n.waiters, e.Index)
+		}
+		if e.Kind == EntryMembers && n.role == Leader && !isIn(n.members, n.config.ID) {
+			n.becomeFollower(n.term, "")
+		}
+		n.mu.Unlock()
+	}
+
+	n.mu.Lock()
+	compact := n.applied-n.snapshot.Index >= uint64(n.config.SnapshotEntries)
+	n.mu.Unlock()
+	if compact {
+		n.compact()
+	}
+}
+
+// compact replaces the applied entries of the log with a snapshot.
+// n.applyMu must be held.
+func (n *Node) compact() {
+	data, err := n.config.StateMachine.Snapshot()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		n.err = fmt.Errorf("failed to snapshot the state machine: %w", err)
+		return
+	}
+
+	index := n.applied
+	term, _ := n.termAt(index)
+	members := n.snapshot.Members
+	for _, e := range n.log {
+		if e.Index <= index && e.Kind == EntryMembers {
+			members = e.Members
+		}
+	}
+	n.log = append([]Entry{}, n.log[index-n.snapshot.Index:]...)
+	n.snapshot = Snapshot{Index: index, Term: term, Members: members}
+	n.snapshotData = data
+	n.saveSnapshot()
+	n.persist()
+}
+
+func (n *Node) saveSnapshot() {
+	snapshot := n.snapshot
+	snapshot.Data = n.snapshotData
+	if err := n.config.Storage.SaveSnapshot(&snapshot); err != nil {
+		n.err = err
+	}
+}
+
+func (n *Node) persist() {
+	if err := n.config.Storage.Save(&State{Term: n.term, VotedFor: n.votedFor, Entries: n.log}); err != nil {
+		n.err = err
+	}
+}
+
+func (n *Node) lastIndex() uint64 {
+	if len(n.log) > 0 {
+		return n.log[len(n.log)-1].Index
+	}
+	return n.snapshot.Index
+}
+
+// entryAt returns the entry at index, which must be in the log
+func (n *Node) entryAt(index uint64) *Entry {
+	return &n.log[index-n.snapshot.Index-1]
+}
+
+// termAt returns the term of the entry at index, if the log or the
+// snapshot knows it
+func (n *Node) termAt(index uint64) (uint64, bool) {
+	switch {
+	case index == n.snapshot.Index:
+		return n.snapshot.Term, true
+	case index < n.snapshot.Index || index > n.lastIndex():
+		return 0, false
+	}
+	return n.entryAt(index).Term, true
+}
+
+// latestMembers returns the members as of the last entry of the log:
+// changes take effect as soon as they are appended
+func (n *Node) latestMembers() []string {
+	for i := len(n.log) - 1; i >= 0; i-- {
+		if n.log[i].Kind == EntryMembers {
+			return n.log[i].Members
+		}
+	}
+	return n.snapshot.Members
+}
+
+// peers returns the members other than this one
+func (n *Node) peers() []string {
+	var peers []string
+	for _, m := range n.members {
+		if m != n.config.ID {
+			peers = append(peers, m)
+		}
+	}
+	return peers
+}
+
+// hasQuorum tells whether a majority of the members is in set
+func (n *Node) hasQuorum(set map[string]bool) bool {
+	count := 0
+	for _, m := range n.members {
+		if set[m] {
+			count++
+		}
+	}
+	return count > len(n.members)/2
+}
+
+func isIn(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
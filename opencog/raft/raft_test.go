@@ -0,0 +1,421 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// network carries requests between the members of a test group, except
+// across the partitions made by cutting links
+type network struct {
+	mu    sync.Mutex
+	nodes map[string]*Node
+	cut   map[[2]string]bool
+}
+
+type link struct {
+	net  *network
+	from string
+}
+
+func (l *link) Call(peer, kind string, req, reply interface{}) error {
+	l.net.mu.Lock()
+	node := l.net.nodes[peer]
+	cut := l.net.cut[[2]string{l.from, peer}]
+	l.net.mu.Unlock()
+	if node == nil || cut {
+		return fmt.Errorf("%s cannot reach %s", l.from, peer)
+	}
+
+	body, _ := json.Marshal(req)
+	resp, err := node.Handle(kind, body)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(resp)
+
+	// Replies are lost on the way back too
+	l.net.mu.Lock()
+	cut = l.net.cut[[2]string{peer, l.from}]
+	l.net.mu.Unlock()
+	if cut {
+		return fmt.Errorf("%s cannot reach %s", peer, l.from)
+	}
+	return json.Unmarshal(data, reply)
+}
+
+// partition cuts every link between members of different groups, and
+// heals the others
+func (net *network) partition(groups ...[]string) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.cut = make(map[[2]string]bool)
+	group := make(map[string]int)
+	for i, members := range groups {
+		for _, m := range members {
+			group[m] = i
+		}
+	}
+	for a := range net.nodes {
+		for b := range net.nodes {
+			if group[a] != group[b] {
+				net.cut[[2]string{a, b}] = true
+			}
+		}
+	}
+}
+
+func (net *network) heal() {
+	net.partition()
+}
+
+// machine records the commands applied to it, and refuses those starting
+// with "!"
+type machine struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (m *machine) Apply(command []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if strings.HasPrefix(string(command), "!") {
+		return errors.New("refused")
+	}
+	m.commands = append(m.commands, string(command))
+	return nil
+}
+
+func (m *machine) Snapshot() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return json.Marshal(m.commands)
+}
+
+func (m *machine) Restore(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = nil
+	return json.Unmarshal(data, &m.commands)
+}
+
+func (m *machine) applied() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string{}, m.commands...)
+}
+
+type group struct {
+	t        *testing.T
+	net      *network
+	machines map[string]*machine
+	storage  map[string]*MemoryStorage
+}
+
+func newGroup(t *testing.T) *group {
+	g := &group{
+		t:        t,
+		net:      &network{nodes: make(map[string]*Node)},
+		machines: make(map[string]*machine),
+		storage:  make(map[string]*MemoryStorage),
+	}
+	t.Cleanup(func() {
+		for _, n := range g.nodes() {
+			n.Stop()
+		}
+	})
+	return g
+}
+
+// start starts a member, from its storage if it was started before,
+// bootstrapping members
+func (g *group) start(id string, snapshotEntries int, members ...string) *Node {
+	g.t.Helper()
+	if g.storage[id] == nil {
+		g.storage[id] = &MemoryStorage{}
+	}
+	g.machines[id] = &machine{}
+	n, err := NewNode(Config{
+		ID:              id,
+		Members:         members,
+		Storage:         g.storage[id],
+		Transport:       &link{net: g.net, from: id},
+		StateMachine:    g.machines[id],
+		SnapshotEntries: snapshotEntries,
+	})
+	if err != nil {
+		g.t.Fatal(err)
+	}
+	g.net.mu.Lock()
+	g.net.nodes[id] = n
+	g.net.mu.Unlock()
+	n.Start(2 * time.Millisecond)
+	return n
+}
+
+func (g *group) stop(id string) {
+	g.net.mu.Lock()
+	n := g.net.nodes[id]
+	delete(g.net.nodes, id)
+	g.net.mu.Unlock()
+	n.Stop()
+}
+
+func (g *group) nodes() []*Node {
+	g.net.mu.Lock()
+	defer g.net.mu.Unlock()
+	var nodes []*Node
+	for _, n := range g.net.nodes {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// leader waits for one of ids to lead the others
+func (g *group) leader(ids ...string) *Node {
+	g.t.Helper()
+	var leader *Node
+	waitFor(g.t, fmt.Sprintf("a leader among %v", ids), func() bool {
+		leader = nil
+		g.net.mu.Lock()
+		defer g.net.mu.Unlock()
+		for _, id := range ids {
+			if s := g.net.nodes[id].Status(); s.Role == Leader {
+				leader = g.net.nodes[id]
+			}
+		}
+		if leader == nil {
+			return false
+		}
+		term := leader.Status().Term
+		for _, id := range ids {
+			if s := g.net.nodes[id].Status(); s.Term != term || s.Leader != leader.config.ID {
+				return false
+			}
+		}
+		return true
+	})
+	return leader
+}
+
+// converge waits for ids to have applied commands
+func (g *group) converge(commands []string, ids ...string) {
+	g.t.Helper()
+	for _, id := range ids {
+		waitFor(g.t, fmt.Sprintf("%s to apply %v", id, commands), func() bool {
+			return reflect.DeepEqual(g.machines[id].applied(), commands)
+		})
+	}
+}
+
+func propose(t *testing.T, n *Node, commands ...string) {
+	t.Helper()
+	for _, c := range commands {
+		if err := n.Propose([]byte(c), 2*time.Second); err != nil {
+			t.Fatalf("Proposing %q to %s failed: %v", c, n.config.ID, err)
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	g := newGroup(t)
+	for _, id := range []string{"a", "b", "c"} {
+		g.start(id, 0, "a", "b", "c")
+	}
+	leader := g.leader("a", "b", "c")
+
+	propose(t, leader, "x", "y")
+	if err := leader.Propose([]byte("!z"), time.Second); err == nil || err.Error() != "refused" {
+		t.Errorf("Expected the state machine's error, got %v", err)
+	}
+	g.converge([]string{"x", "y"}, "a", "b", "c")
+
+	for _, n := range g.nodes() {
+		if n == leader {
+			continue
+		}
+		var notLeader *NotLeaderError
+		if err := n.Propose([]byte("w"), time.Second); !errors.As(err, &notLeader) || notLeader.Leader != leader.config.ID {
+			t.Errorf("Expected followers to name the leader, got %v", err)
+		}
+	}
+	status := leader.Status()
+	if len(status.Peers) != 2 || status.Peers[0].Match != status.LastIndex || status.CommitIndex != status.LastIndex {
+		t.Errorf("Unexpected leader status %+v", status)
+	}
+}
+
+func TestPartitions(t *testing.T) {
+	g := newGroup(t)
+	ids := []string{"a", "b", "c", "d", "e"}
+	for _, id := range ids {
+		g.start(id, 0, ids...)
+	}
+	old := g.leader(ids...)
+	propose(t, old, "x")
+	g.converge([]string{"x"}, ids...)
+
+	// The leader is cut off with a follower; the majority elects another
+	var minority, majority []string
+	minority = append(minority, old.config.ID)
+	for _, id := range ids {
+		if id == old.config.ID {
+			continue
+		}
+		if len(minority) < 2 {
+			minority = append(minority, id)
+		} else {
+			majority = append(majority, id)
+		}
+	}
+	g.net.partition(minority, majority)
+
+	if err := old.Propose([]byte("lost"), 100*time.Millisecond); err != ErrTimeout && err != ErrLeadershipLost {
+		t.Errorf("Expected a command proposed to the minority not to be committed, got %v", err)
+	}
+	leader := g.leader(majority...)
+	if leader.Status().Term <= old.Status().Term {
+		t.Errorf("Expected the new leader to be elected in a later term")
+	}
+	propose(t, leader, "y")
+	g.converge([]string{"x", "y"}, majority...)
+
+	waitFor(t, "the old leader to step down", func() bool { return old.Status().Role != Leader })
+	var notLeader *NotLeaderError
+	if err := old.Propose([]byte("lost"), time.Second); !errors.As(err, &notLeader) {
+		t.Errorf("Expected a leader without a majority to step down, got %v", err)
+	}
+	g.converge([]string{"x"}, minority...)
+
+	// Once healed, the minority drops what it did not commit
+	g.net.heal()
+	propose(t, leader, "z")
+	g.converge([]string{"x", "y", "z"}, ids...)
+	if l := g.leader(ids...); l != leader {
+		t.Errorf("Expected %s to keep the lead, got %s", leader.config.ID, l.config.ID)
+	}
+}
+
+func TestLeaderFailure(t *testing.T) {
+	g := newGroup(t)
+	ids := []string{"a", "b", "c"}
+	for _, id := range ids {
+		g.start(id, 0, ids...)
+	}
+	old := g.leader(ids...)
+	propose(t, old, "x")
+	g.converge([]string{"x"}, ids...)
+
+	g.stop(old.config.ID)
+	var rest []string
+	for _, id := range ids {
+		if id != old.config.ID {
+			rest = append(rest, id)
+		}
+	}
+	leader := g.leader(rest...)
+	propose(t, leader, "y")
+
+	// The old leader restarts from its storage and catches up
+	g.start(old.config.ID, 0)
+	g.converge([]string{"x", "y"}, ids...)
+	if status := g.net.nodes[old.config.ID].Status(); status.Role != Follower || status.Leader != leader.config.ID {
+		t.Errorf("Expected the restarted member to follow %s, got %+v", leader.config.ID, status)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	g := newGroup(t)
+	ids := []string{"a", "b", "c"}
+	for _, id := range ids {
+		g.start(id, 5, ids...)
+	}
+	leader := g.leader(ids...)
+
+	// A follower cut off while the log is compacted catches up from the
+	// leader's snapshot
+	var behind string
+	for _, id := range ids {
+		if id != leader.config.ID {
+			behind = id
+		}
+	}
+	var others []string
+	for _, id := range ids {
+		if id != behind {
+			others = append(others, id)
+		}
+	}
+	g.net.partition([]string{behind}, others)
+
+	var commands []string
+	for i := 0; i < 20; i++ {
+		commands = append(commands, fmt.Sprint(i))
+	}
+	propose(t, leader, commands...)
+	status := leader.Status()
+	if status.SnapshotIndex == 0 || status.LastIndex-status.SnapshotIndex >= 10 {
+		t.Errorf("Expected the log to be compacted, got %+v", status)
+	}
+
+	g.net.heal()
+	g.converge(commands, ids...)
+	if status := g.net.nodes[behind].Status(); status.SnapshotIndex == 0 {
+		t.Errorf("Expected %s to install the snapshot, got %+v", behind, status)
+	}
+
+	// Members restart from their snapshot
+	g.stop(behind)
+	g.start(behind, 5)
+	g.converge(commands, behind)
+}
+
+func TestMembershipChanges(t *testing.T) {
+	g := newGroup(t)
+	a := g.start("a", 0, "a")
+	g.start("b", 0)
+	g.start("c", 0)
+	g.leader("a")
+	propose(t, a, "x")
+
+	for _, id := range []string{"b", "c"} {
+		if err := a.AddMember(id, 2*time.Second); err != nil {
+			t.Fatalf("Adding %s failed: %v", id, err)
+		}
+	}
+	g.converge([]string{"x"}, "b", "c")
+	if members := a.Status().Members; !reflect.DeepEqual(members, []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected members %v", members)
+	}
+
+	// The leader removes itself and the others elect another
+	if err := a.RemoveMember("a", 2*time.Second); err != nil {
+		t.Fatalf("Removing a failed: %v", err)
+	}
+	leader := g.leader("b", "c")
+	propose(t, leader, "y")
+	g.converge([]string{"x", "y"}, "b", "c")
+	if status := a.Status(); status.Role == Leader {
+		t.Errorf("Expected the removed leader to step down, got %+v", status)
+	}
+	if members := leader.Status().Members; !reflect.DeepEqual(members, []string{"b", "c"}) {
+		t.Errorf("Unexpected members %v", members)
+	}
+}
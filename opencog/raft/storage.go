@@ -0,0 +1,146 @@
+package raft
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// State is what a member must not forget across restarts: its term, the
+// candidate it voted for in that term, and the entries of its log after its
+// snapshot
+type State struct {
+	Term     uint64  `json:"term"`
+	VotedFor string  `json:"voted_for,omitempty"`
+	Entries  []Entry `json:"entries"`
+}
+
+// Snapshot replaces the entries of a log up to Index with the state they
+// led to
+type Snapshot struct {
+	// Index and Term are those of the last entry the snapshot replaces
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	// Members are the members of the group as of Index
+	Members []string `json:"members"`
+	Data    []byte   `json:"data"`
+}
+
+// Storage keeps the state and the snapshot of a member
+type Storage interface {
+	// Load returns the state and the snapshot last saved, either nil if
+	// none was
+	Load() (*State, *Snapshot, error)
+	Save(state *State) error
+	SaveSnapshot(snapshot *Snapshot) error
+}
+
+// FileStorage keeps the state and the snapshot of a member in a directory
+type FileStorage struct {
+	dir string
+}
+
+// NewFileStorage returns storage in dir, which is created if need be
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create raft directory: %w", err)
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+func (s *FileStorage) Load() (*State, *Snapshot, error) {
+	var state *State
+	if err := s.read("state.json", &state); err != nil {
+		return nil, nil, err
+	}
+	var snapshot *Snapshot
+	if err := s.read("snapshot.json", &snapshot); err != nil {
+		return nil, nil, err
+	}
+	return state, snapshot, nil
+}
+
+func (s *FileStorage) Save(state *State) error {
+	return s.write("state.json", state)
+}
+
+func (s *FileStorage) SaveSnapshot(snapshot *Snapshot) error {
+	return s.write("snapshot.json", snapshot)
+}
+
+func (s *FileStorage) read(name string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read raft %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse raft %s: %w", name, err)
+	}
+	return nil
+}
+
+// write replaces the file atomically, so that a crash leaves either the old
+// or the new contents
+func (s *FileStorage) write(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal raft %s: %w", name, err)
+	}
+	path := filepath.Join(s.dir, name)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write raft %s: %w", name, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write raft %s: %w", name, err)
+	}
+	return nil
+}
+
+// MemoryStorage keeps the state and the snapshot of a member in memory, for
+// members that need not survive their process
+type MemoryStorage struct {
+	mu       sync.Mutex
+	state    []byte
+	snapshot []byte
+}
+
+func (s *MemoryStorage) Load() (*State, *Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var state *State
+	var snapshot *Snapshot
+	if s.state != nil {
+		json.Unmarshal(s.state, &state)
+	}
+	if s.snapshot != nil {
+		json.Unmarshal(s.snapshot, &snapshot)
+	}
+	return state, snapshot, nil
+}
+
+func (s *MemoryStorage) Save(state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.state = data
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStorage) SaveSnapshot(snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.snapshot = data
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,535 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/github/hub/v2/opencog/internal/decode"
+)
+
+func init() {
+	RegisterBehavior(ReflectionAgent, newReflectionBehavior)
+}
+
+// ReflectAction asks a reflection agent to assess the system right away
+const ReflectAction = "reflect"
+
+// Metrics of the agents that reflection agents compare with their baseline
+const (
+	MetricMessages       = "messages"
+	MetricErrors         = "errors"
+	MetricRestarts       = "restarts"
+	MetricHealthFailures = "health_failures"
+)
+
+// reflectionMetrics lists the metrics compared with the baseline
+var reflectionMetrics = []string{MetricMessages, MetricErrors, MetricRestarts, MetricHealthFailures}
+
+// minBaseline is the number of past reports needed before anomalies are
+// looked for
+const minBaseline = 3
+
+// maxReflectionReports bounds the number of reports a reflection agent keeps
+const maxReflectionReports = 20
+
+// AgentAssessment is what an agent did over the period of a report
+type AgentAssessment struct {
+	Agent  string      `json:"agent"`
+	Type   AgentType   `json:"type"`
+	Status AgentStatus `json:"status"`
+	// Sent and Received count the messages the agent exchanged with other
+	// agents
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+	// Errors counts the error replies the agent sent and the resource
+	// limits it breached
+	Errors         int64 `json:"errors"`
+	Restarts       int   `json:"restarts"`
+	HealthFailures int   `json:"health_failures"`
+}
+
+// ErrorRate returns the errors of the agent per message it received, or zero
+// if it received none
+func (a *AgentAssessment) ErrorRate() float64 {
+	if a.Received == 0 {
+		return 0
+	}
+	return float64(a.Errors) / float64(a.Received)
+}
+
+// metric returns the value of one of reflectionMetrics
+func (a *AgentAssessment) metric(name string) float64 {
+	switch name {
+	case MetricMessages:
+		return float64(a.Sent + a.Received)
+	case MetricErrors:
+		return float64(a.Errors)
+	case MetricRestarts:
+		return float64(a.Restarts)
+	case MetricHealthFailures:
+		return float64(a.HealthFailures)
+	}
+	return 0
+}
+
+// SlowExchange is a pair of agents where one took long to answer the other
+type SlowExchange struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Replies int64  `json:"replies"`
+	// Mean is the mean time To took to answer From, in seconds
+	Mean float64 `json:"mean"`
+}
+
+// Anomaly is a metric of an agent that strayed from its baseline
+type Anomaly struct {
+	Agent  string  `json:"agent"`
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	// Deviation is how far Value is from Mean, in spreads of the baseline
+	Deviation float64 `json:"deviation"`
+}
+
+func (a Anomaly) String() string {
+	direction := "above"
+	if a.Value < a.Mean {
+		direction = "below"
+	}
+	return fmt.Sprintf("%s %s: %g, %s the baseline of %.1f ± %.1f",
+		a.Agent, strings.Replace(a.Metric, "_", " ", -1), a.Value, direction, a.Mean, a.StdDev)
+}
+
+// ReflectionReport is the self-assessment a reflection agent made of the
+// system over a period
+type ReflectionReport struct {
+	Since     time.Time         `json:"since"`
+	Time      time.Time         `json:"time"`
+	Agents    []AgentAssessment `json:"agents"`
+	Slow      []SlowExchange    `json:"slow,omitempty"`
+	Anomalies []Anomaly         `json:"anomalies,omitempty"`
+	// Baseline is the number of past reports anomalies were looked for
+	// against
+	Baseline int `json:"baseline"`
+	// URL is where the report was published, and PublishError why it could
+	// not be
+	URL          string `json:"url,omitempty"`
+	PublishError string `json:"publish_error,omitempty"`
+}
+
+// Title summarizes the report
+func (r *ReflectionReport) Title() string {
+	summary := "no anomalies"
+	switch n := len(r.Anomalies); {
+	case n == 1:
+		summary = "1 anomaly"
+	case n > 1:
+		summary = fmt.Sprintf("%d anomalies", n)
+	}
+	return fmt.Sprintf("Self-assessment %s: %s", r.Time.UTC().Format("2006-01-02 15:04"), summary)
+}
+
+// Markdown renders the report
+func (r *ReflectionReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", r.Title())
+	fmt.Fprintf(&b, "Activity of %d agents from %s to %s.\n\n",
+		len(r.Agents), r.Since.UTC().Format(time.RFC3339), r.Time.UTC().Format(time.RFC3339))
+
+	b.WriteString("## Anomalies\n\n")
+	switch {
+	case len(r.Anomalies) > 0:
+		for _, anomaly := range r.Anomalies {
+			fmt.Fprintf(&b, "- %s\n", anomaly)
+		}
+	case r.Baseline < minBaseline:
+		fmt.Fprintf(&b, "The baseline is still being established from %d of at least %d reports.\n", r.Baseline, minBaseline)
+	default:
+		fmt.Fprintf(&b, "None compared with the last %d reports.\n", r.Baseline)
+	}
+
+	b.WriteString("\n## Agents\n\n")
+	b.WriteString("| Agent | Type | Status | Sent | Received | Errors | Error rate | Restarts | Health failures |\n")
+	b.WriteString("|-------|------|--------|-----:|---------:|-------:|-----------:|---------:|----------------:|\n")
+	for _, a := range r.Agents {
+		fmt.Fprintf(&b, "| %s | %s | %s | %d | %d | %d | %.1f%% | %d | %d |\n",
+			a.Agent, a.Type, a.Status, a.Sent, a.Received, a.Errors, 100*a.ErrorRate(), a.Restarts, a.HealthFailures)
+	}
+
+	if len(r.Slow) > 0 {
+		b.WriteString("\n## Slow replies\n\n")
+		b.WriteString("| From | To | Replies | Mean reply time |\n")
+		b.WriteString("|------|----|--------:|----------------:|\n")
+		for _, s := range r.Slow {
+			mean := time.Duration(s.Mean * float64(time.Second)).Round(time.Millisecond)
+			fmt.Fprintf(&b, "| %s | %s | %d | %s |\n", s.From, s.To, s.Replies, mean)
+		}
+	}
+	return b.String()
+}
+
+// reflectionState is what a reflection agent keeps between reports
+type reflectionState struct {
+	// Traffic and ErrorCounts hold the totals at the last report, which the
+	// next report counts from
+	Traffic     []Flow           `json:"traffic,omitempty"`
+	ErrorCounts map[string]int64 `json:"error_counts,omitempty"`
+	// History holds the metrics of each agent in the recent reports, oldest
+	// first
+	History map[string]map[string][]float64 `json:"history,omitempty"`
+	Reports []*ReflectionReport             `json:"reports,omitempty"`
+}
+
+func reflectionStatePath(configDir string, agent *Agent) string {
+	return filepath.Join(configDir, "reflection", agent.ID+".json")
+}
+
+func loadReflectionState(configDir string, agent *Agent) (*reflectionState, error) {
+	state := &reflectionState{}
+	data, err := os.ReadFile(reflectionStatePath(configDir, agent))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read reflection state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse reflection state: %w", err)
+	}
+	return state, nil
+}
+
+func (s *reflectionState) save(configDir string, agent *Agent) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal reflection state: %w", err)
+	}
+	path := reflectionStatePath(configDir, agent)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create reflection state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write reflection state: %w", err)
+	}
+	return nil
+}
+
+// ReflectionReports returns the recent reports of a reflection agent, oldest
+// first
+func ReflectionReports(configDir string, agent *Agent) ([]*ReflectionReport, error) {
+	state, err := loadReflectionState(configDir, agent)
+	if err != nil {
+		return nil, err
+	}
+	return state.Reports, nil
+}
+
+// DecodeReflectionReport extracts the report from a reflection agent's reply
+func DecodeReflectionReport(payload map[string]interface{}) (*ReflectionReport, error) {
+	report := &ReflectionReport{}
+	if err := decode.Payload(payload, "report", "report", report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// reflectionBehavior implements the reflection agent type: it periodically
+// assesses the traffic, errors, restarts and health of the agents, and
+// reports where they stray from their recent past
+type reflectionBehavior struct {
+	agent     *Agent
+	configDir string
+	outbox    *Outbox
+}
+
+func newReflectionBehavior(agent *Agent, configDir string) (Behavior, error) {
+	publish := agent.ConfigString("publish")
+	if publish == "issue" && agent.ConfigString("repository") == "" {
+		return nil, fmt.Errorf("reflection agent %s publishes issues but has no repository", agent.Name)
+	}
+	return &reflectionBehavior{agent: agent, configDir: configDir}, nil
+}
+
+func (b *reflectionBehavior) SetOutbox(outbox *Outbox) {
+	b.outbox = outbox
+}
+
+func (b *reflectionBehavior) CycleInterval() time.Duration {
+	return b.agent.ConfigDuration("report_interval")
+}
+
+func (b *reflectionBehavior) Cycle(now time.Time) error {
+	_, err := b.reflect(now)
+	return err
+}
+
+func (b *reflectionBehavior) HandleMessage(msg *Message) (*Message, error) {
+	switch msg.Type {
+	case MessageTypeCommand:
+		action, _ := msg.Payload["action"].(string)
+		if action != ReflectAction {
+			return nil, fmt.Errorf("unknown reflection action %q, expected %s", action, ReflectAction)
+		}
+		report, err := b.reflect(time.Now())
+		if report == nil {
+			return nil, err
+		}
+		// Reports that could not be published are still answered
+		return &Message{
+			Type:    MessageTypeResponse,
+			Payload: map[string]interface{}{"report": report},
+		}, nil
+	case MessageTypeHeartbeat, MessageTypeResponse:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("reflection agents do not handle %s messages", msg.Type)
+}
+
+// reflect assesses the agents since the last report, compares them with the
+// baseline of the previous reports and publishes the report if configured
+// to. The report is returned even if it could not be published.
+func (b *reflectionBehavior) reflect(now time.Time) (*ReflectionReport, error) {
+	registry, err := NewRegistry(b.configDir)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadReflectionState(b.configDir, b.agent)
+	if err != nil {
+		return nil, err
+	}
+	traffic, err := registry.Traffic()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReflectionReport{Time: now, Since: now.Add(-b.CycleInterval())}
+	if n := len(state.Reports); n > 0 {
+		report.Since = state.Reports[n-1].Time
+	}
+
+	agents := registry.List()
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Name < agents[j].Name
+	})
+	names := make(map[string]string, len(agents))
+	for _, agent := range agents {
+		names[agent.ID] = agent.Name
+	}
+
+	// Traffic is counted since the registry was created, so the report
+	// counts what it gained since the last one
+	flows := trafficSince(traffic, state.Traffic)
+	errorCounts := make(map[string]int64)
+	for _, agent := range agents {
+		assessment := AgentAssessment{Agent: agent.Name, Type: agent.Type, Status: agent.Status}
+		for _, flow := range flows {
+			if flow.From == agent.ID {
+				assessment.Sent += flow.Messages
+				assessment.Errors += flow.Errors
+			}
+			if flow.To == agent.ID {
+				assessment.Received += flow.Messages
+			}
+		}
+		if agent.Metrics != nil {
+			errorCounts[agent.ID] = agent.Metrics.ErrorCount
+			// Counts that went down were reset by a restart
+			if breached := agent.Metrics.ErrorCount - state.ErrorCounts[agent.ID]; breached >= 0 {
+				assessment.Errors += breached
+			} else {
+				assessment.Errors += agent.Metrics.ErrorCount
+			}
+		}
+
+		events, err := registry.Events(agent.ID, EventFilter{Since: report.Since})
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			switch {
+			case !event.Time.Before(now):
+			case event.Kind == EventLifecycle && event.To == string(StatusStarting) && event.From != string(StatusCreated):
+				assessment.Restarts++
+			case event.Kind == EventLifecycle && event.To == string(StatusError),
+				event.Kind == EventHealth && healthFailure(event):
+				assessment.HealthFailures++
+			}
+		}
+		report.Agents = append(report.Agents, assessment)
+	}
+
+	slow := b.agent.ConfigDuration("slow_reply").Seconds()
+	for _, flow := range flows {
+		if flow.Replies == 0 || names[flow.From] == "" || names[flow.To] == "" {
+			continue
+		}
+		if mean := flow.ReplySeconds / float64(flow.Replies); mean >= slow {
+			report.Slow = append(report.Slow, SlowExchange{
+				From: names[flow.From], To: names[flow.To], Replies: flow.Replies, Mean: mean,
+			})
+		}
+	}
+	sort.Slice(report.Slow, func(i, j int) bool {
+		return report.Slow[i].Mean > report.Slow[j].Mean
+	})
+
+	history := b.compare(report, agents, state.History)
+
+	// The report is recorded even if it cannot be published, so that the
+	// next one counts from it
+	publishErr := b.publish(report)
+	if publishErr != nil {
+		report.PublishError = publishErr.Error()
+	}
+	state.Traffic = traffic
+	state.ErrorCounts = errorCounts
+	state.History = history
+	state.Reports = append(state.Reports, report)
+	if len(state.Reports) > maxReflectionReports {
+		state.Reports = state.Reports[len(state.Reports)-maxReflectionReports:]
+	}
+	if err := state.save(b.configDir, b.agent); err != nil {
+		return nil, err
+	}
+	return report, publishErr
+}
+
+// compare looks for the metrics of the report that stray from their history,
+// and returns the history with the report added. Agents that are gone are
+// forgotten.
+func (b *reflectionBehavior) compare(report *ReflectionReport, agents []*Agent, history map[string]map[string][]float64) map[string]map[string][]float64 {
+	window := b.agent.ConfigInt("baseline_reports")
+	threshold := b.agent.ConfigFloat("anomaly_threshold")
+
+	updated := make(map[string]map[string][]float64, len(agents))
+	for i, agent := range agents {
+		assessment := &report.Agents[i]
+		past := history[agent.ID]
+		metrics := make(map[string][]float64, len(reflectionMetrics))
+		for _, metric := range reflectionMetrics {
+			values := past[metric]
+			if len(values) > report.Baseline {
+				report.Baseline = len(values)
+			}
+			value := assessment.metric(metric)
+			if anomaly, ok := anomalous(values, value, threshold); ok && len(values) >= minBaseline {
+				// Only a drop in messages is worth reporting; fewer errors,
+				// restarts or failures are not
+				if anomaly.Deviation > 0 || metric == MetricMessages {
+					anomaly.Agent, anomaly.Metric = agent.Name, metric
+					report.Anomalies = append(report.Anomalies, anomaly)
+				}
+			}
+
+			values = append(values, value)
+			if len(values) > window {
+				values = values[len(values)-window:]
+			}
+			metrics[metric] = values
+		}
+		updated[agent.ID] = metrics
+	}
+	return updated
+}
+
+// anomalous reports whether value is at least threshold spreads away from the
+// mean of baseline. Counts vary at least as much as Poisson counts of the
+// same mean would, so the spread is never less than the square root of the
+// mean.
+func anomalous(baseline []float64, value, threshold float64) (Anomaly, bool) {
+	if len(baseline) == 0 {
+		return Anomaly{}, false
+	}
+	var sum, squares float64
+	for _, v := range baseline {
+		sum += v
+	}
+	mean := sum / float64(len(baseline))
+	for _, v := range baseline {
+		squares += (v - mean) * (v - mean)
+	}
+	stddev := math.Sqrt(squares / float64(len(baseline)))
+
+	spread := math.Max(stddev, math.Sqrt(math.Max(mean, 1)))
+	deviation := (value - mean) / spread
+	anomaly := Anomaly{Value: value, Mean: mean, StdDev: stddev, Deviation: deviation}
+	return anomaly, math.Abs(deviation) >= threshold
+}
+
+// healthFailure reports whether a health event reports a problem rather
+// than a recovery
+func healthFailure(event Event) bool {
+	switch HealthState(event.To) {
+	case HealthDegraded, HealthNotReady:
+		return true
+	case "":
+		return strings.HasPrefix(event.Reason, "cycle failed")
+	}
+	return false
+}
+
+// trafficSince returns the traffic gained since the totals of last. Totals
+// that went down were reset, by removing and re-adding an agent, and count
+// in full.
+func trafficSince(traffic, last []Flow) []Flow {
+	previous := make(map[flowKey]Flow, len(last))
+	for _, flow := range last {
+		previous[flowKey{flow.From, flow.To}] = flow
+	}
+
+	gained := make([]Flow, 0, len(traffic))
+	for _, flow := range traffic {
+		before, ok := previous[flowKey{flow.From, flow.To}]
+		if ok && flow.Messages >= before.Messages {
+			flow.Messages -= before.Messages
+			flow.Errors -= before.Errors
+			flow.Replies -= before.Replies
+			flow.ReplySeconds -= before.ReplySeconds
+		}
+		gained = append(gained, flow)
+	}
+	return gained
+}
+
+// publish publishes the report as configured: as an issue or a gist,
+// created through GitHub with the agent's grant. Reports without anomalies
+// are only published if publish_always is set.
+func (b *reflectionBehavior) publish(report *ReflectionReport) error {
+	publish := b.agent.ConfigString("publish")
+	if publish == "none" || publish == "" {
+		return nil
+	}
+	if len(report.Anomalies) == 0 && !b.agent.ConfigBool("publish_always") {
+		return nil
+	}
+	if b.outbox == nil {
+		return fmt.Errorf("cannot publish the report: agent %s is not hosted", b.agent.Name)
+	}
+
+	payload := map[string]interface{}{"body": report.Markdown()}
+	switch publish {
+	case "issue":
+		payload["action"] = GitHubCreateIssue
+		payload["repository"] = b.agent.ConfigString("repository")
+		payload["title"] = report.Title()
+	case "gist":
+		payload["action"] = GitHubCreateGist
+		payload["filename"] = fmt.Sprintf("self-assessment-%s.md", report.Time.UTC().Format("20060102-1504"))
+	}
+
+	reply, err := b.outbox.Request(&Message{To: GitHubID, Type: MessageTypeCommand, Payload: payload}, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to publish the report: %w", err)
+	}
+	if url, ok := reply.Payload["url"].(string); ok {
+		report.URL = url
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package opencog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReflectionAgentReportsAnomalies(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	kb, _ := NewAgent(AgentConfig{Name: "kb", Type: AtomSpaceAgent})
+	pln, _ := NewAgent(AgentConfig{Name: "pln", Type: PLNAgent, Config: map[string]interface{}{"atomspace": "kb"}})
+	reflection, err := NewAgent(AgentConfig{Name: "mirror", Type: ReflectionAgent, Config: map[string]interface{}{
+		"publish":             "issue",
+		"repository":          "github/hub",
+		"slow_reply":          "2s",
+		"github_actions":      "create_issue",
+		"github_repositories": "github/hub",
+	}})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+	for _, agent := range []*Agent{kb, pln, reflection} {
+		registry.Register(agent)
+	}
+
+	fake := &fakeGitHub{}
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.HostGitHub(fake)
+	behavior, err := NewBehavior(reflection, registry.Dir())
+	if err != nil {
+		t.Fatalf("NewBehavior failed: %v", err)
+	}
+	orchestrator.Host(reflection.ID, behavior)
+	orchestrator.RegisterAgent("client")
+
+	reflect := func() *ReflectionReport {
+		t.Helper()
+		reply, err := orchestrator.Request(&Message{From: "client", To: reflection.ID, Type: MessageTypeCommand,
+			Payload: map[string]interface{}{"action": ReflectAction}}, 5*time.Second)
+		if err != nil {
+			t.Fatalf("Reflect failed: %v", err)
+		}
+		report, err := DecodeReflectionReport(reply.Payload)
+		if err != nil {
+			t.Fatalf("DecodeReflectionReport failed: %v", err)
+		}
+		return report
+	}
+
+	for i := 0; i < 4; i++ {
+		registry.RecordTraffic([]Flow{{From: pln.ID, To: kb.ID, Messages: 10, Replies: 10, ReplySeconds: 1}})
+		report := reflect()
+		if len(report.Anomalies) != 0 || len(report.Slow) != 0 || report.URL != "" {
+			t.Fatalf("Expected a quiet report, got %+v", report)
+		}
+		if report.Baseline != i {
+			t.Errorf("Expected a baseline of %d reports, got %d", i, report.Baseline)
+		}
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("Expected reports without anomalies not to be published, got %v", fake.calls)
+	}
+
+	registry.RecordTraffic([]Flow{
+		{From: pln.ID, To: kb.ID, Messages: 10, Replies: 2, ReplySeconds: 5},
+		{From: kb.ID, To: pln.ID, Messages: 8, Errors: 8},
+	})
+	registry.RecordEvent(Event{AgentID: kb.ID, Kind: EventLifecycle, From: "stopped", To: "starting"})
+	registry.RecordEvent(Event{AgentID: kb.ID, Kind: EventHealth, Reason: "cycle failed: boom"})
+	report := reflect()
+
+	var assessed *AgentAssessment
+	for i := range report.Agents {
+		if report.Agents[i].Agent == "kb" {
+			assessed = &report.Agents[i]
+		}
+	}
+	if assessed == nil || assessed.Sent != 8 || assessed.Received != 10 || assessed.Errors != 8 ||
+		assessed.Restarts != 1 || assessed.HealthFailures != 1 {
+		t.Fatalf("Unexpected assessment of kb %+v", assessed)
+	}
+	if len(report.Slow) != 1 || report.Slow[0].From != "pln" || report.Slow[0].To != "kb" || report.Slow[0].Mean != 2.5 {
+		t.Errorf("Expected the replies of kb to pln to be slow, got %+v", report.Slow)
+	}
+
+	var anomalies []string
+	for _, anomaly := range report.Anomalies {
+		anomalies = append(anomalies, anomaly.Agent+" "+anomaly.Metric)
+	}
+	if got := strings.Join(anomalies, ","); got != "kb errors" {
+		t.Errorf("Unexpected anomalies %s", got)
+	}
+	if !strings.Contains(report.Markdown(), "- kb errors: 8, above the baseline of 0.0 ± 0.0") {
+		t.Errorf("Expected the anomaly in the report, got\n%s", report.Markdown())
+	}
+
+	if len(fake.calls) != 1 || !strings.HasPrefix(fake.calls[0], "create issue github/hub") ||
+		!strings.Contains(fake.calls[0], "Self-assessment") {
+		t.Errorf("Expected the report to be published as an issue, got %v", fake.calls)
+	}
+	reports, err := ReflectionReports(registry.Dir(), reflection)
+	if err != nil || len(reports) != 5 || reports[4].Anomalies == nil {
+		t.Errorf("Expected the reports to be kept, got %d, %v", len(reports), err)
+	}
+}
+
+func TestAnomalous(t *testing.T) {
+	if _, ok := anomalous(nil, 100, 3); ok {
+		t.Error("Expected no anomaly without a baseline")
+	}
+	if _, ok := anomalous([]float64{100, 110, 90}, 115, 3); ok {
+		t.Error("Expected counts within their Poisson spread not to be anomalous")
+	}
+	anomaly, ok := anomalous([]float64{100, 110, 90}, 10, 3)
+	if !ok || anomaly.Deviation >= 0 || anomaly.Mean != 100 {
+		t.Errorf("Expected a drop to be anomalous, got %+v", anomaly)
+	}
+}
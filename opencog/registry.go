@@ -6,13 +6,19 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
 // Registry manages the collection of cognitive agents
 type Registry struct {
 	agents map[string]*Agent
 	mu     sync.RWMutex
+	dir    string
 	file   string
+	// seen is the registry file as this registry last read or wrote it
+	seen os.FileInfo
+
+	eventsMu sync.Mutex
 }
 
 // NewRegistry creates a new agent registry
@@ -31,6 +37,7 @@ func NewRegistry(configDir string) (*Registry, error) {
 
 	registry := &Registry{
 		agents: make(map[string]*Agent),
+		dir:    configDir,
 		file:   filepath.Join(configDir, "agents.json"),
 	}
 
@@ -42,17 +49,28 @@ func NewRegistry(configDir string) (*Registry, error) {
 	return registry, nil
 }
 
+// Dir returns the configuration directory backing the registry
+func (r *Registry) Dir() string {
+	return r.dir
+}
+
+// LogPath returns the file an agent's process output is written to
+func LogPath(configDir string, agent *Agent) string {
+	return filepath.Join(configDir, "logs", agent.Name+".log")
+}
+
 // Register adds a new agent to the registry
 func (r *Registry) Register(agent *Agent) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.agents[agent.ID]; exists {
-		return fmt.Errorf("agent with ID %s already exists", agent.ID)
-	}
-
-	r.agents[agent.ID] = agent
-	return r.save()
+	return r.modify(func() error {
+		if _, exists := r.agents[agent.ID]; exists {
+			return fmt.Errorf("agent with ID %s already exists", agent.ID)
+		}
+		r.agents[agent.ID] = agent
+		return nil
+	})
 }
 
 // Get retrieves an agent by ID
@@ -125,17 +143,117 @@ func (r *Registry) ListByStatus(status AgentStatus) []*Agent {
 	return agents
 }
 
-// Update updates an existing agent in the registry
+// Update updates an existing agent in the registry. Only the fields changed
+// since the agent was read are saved, on top of what other processes saved
+// in the meantime, and agent is updated to match; changes to a field another
+// process changed too are refused.
 func (r *Registry) Update(agent *Agent) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.agents[agent.ID]; !exists {
-		return fmt.Errorf("agent with ID %s not found", agent.ID)
+	return r.modify(func() error {
+		current, exists := r.agents[agent.ID]
+		if !exists {
+			return fmt.Errorf("agent with ID %s not found", agent.ID)
+		}
+		if current != agent && agent.loaded != nil {
+			merged, err := rebaseAgent(agent, current)
+			if err != nil {
+				return err
+			}
+			*agent = *merged
+		}
+		r.agents[agent.ID] = agent
+		return nil
+	})
+}
+
+// rebaseAgent makes the changes made to agent since it was read again on
+// top of current, the agent as the registry file has it now
+func rebaseAgent(agent, current *Agent) (*Agent, error) {
+	var was, mine, theirs map[string]json.RawMessage
+	data, err := json.Marshal(agent)
+	if err == nil {
+		err = json.Unmarshal(data, &mine)
+	}
+	if err == nil {
+		data, err = json.Marshal(current)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &theirs)
+	}
+	if err == nil {
+		err = json.Unmarshal(agent.loaded, &was)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge agent %s: %w", agent.Name, err)
 	}
 
-	r.agents[agent.ID] = agent
-	return r.save()
+	if !mergeChanges(was, mine, theirs) {
+		return nil, fmt.Errorf("agent %s was changed by another process, try again", agent.Name)
+	}
+	merged := &Agent{}
+	data, err = json.Marshal(theirs)
+	if err == nil {
+		err = json.Unmarshal(data, merged)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge agent %s: %w", agent.Name, err)
+	}
+	return merged, nil
+}
+
+// mergeChanges makes the changes mine made to the fields of base in theirs,
+// which was changed from base as well. Objects both changed are merged field
+// by field. It reports false if both changed a value differently.
+func mergeChanges(base, mine, theirs map[string]json.RawMessage) bool {
+	changed := make(map[string]bool)
+	for _, field := range changedFields(base, theirs) {
+		changed[field] = true
+	}
+	for _, field := range changedFields(base, mine) {
+		value, ok := mine[field]
+		// Every change sets updated_at; the latest one stands
+		if changed[field] && field != "updated_at" && string(theirs[field]) != string(value) {
+			var was, m, t map[string]json.RawMessage
+			if !ok || json.Unmarshal(base[field], &was) != nil || json.Unmarshal(value, &m) != nil ||
+				json.Unmarshal(theirs[field], &t) != nil || m == nil || t == nil || !mergeChanges(was, m, t) {
+				return false
+			}
+			value, _ = json.Marshal(t)
+		}
+		if ok {
+			theirs[field] = value
+		} else {
+			delete(theirs, field)
+		}
+	}
+	return true
+}
+
+// Heartbeat records a heartbeat of an agent and the metrics it reported
+// with it
+func (r *Registry) Heartbeat(id string, reported map[string]float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.modify(func() error {
+		agent, exists := r.agents[id]
+		if !exists {
+			return fmt.Errorf("agent with ID %s not found", id)
+		}
+		if agent.Metrics == nil {
+			agent.Metrics = &AgentMetrics{}
+		}
+		agent.Metrics.LastHeartbeat = time.Now()
+		if len(reported) > 0 && agent.Metrics.Reported == nil {
+			agent.Metrics.Reported = make(map[string]float64, len(reported))
+		}
+		for key, value := range reported {
+			agent.Metrics.Reported[key] = value
+		}
+		return nil
+	})
 }
 
 // Unregister removes an agent from the registry
@@ -143,12 +261,79 @@ func (r *Registry) Unregister(id string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.agents[id]; !exists {
-		return fmt.Errorf("agent with ID %s not found", id)
+	err := r.modify(func() error {
+		if _, exists := r.agents[id]; !exists {
+			return fmt.Errorf("agent with ID %s not found", id)
+		}
+		delete(r.agents, id)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	return r.removeState(id)
+}
 
-	delete(r.agents, id)
-	return r.save()
+// removeState removes what is kept about an agent besides its record
+func (r *Registry) removeState(id string) error {
+	os.Remove(r.samplesPath(id))
+	os.Remove(filepath.Join(r.dir, "atomspace", id+".json"))
+	os.Remove(filepath.Join(r.dir, "pln", id+".json"))
+	os.Remove(filepath.Join(r.dir, "ecan", id+".json"))
+	os.Remove(filepath.Join(r.dir, "openpsi", id+".json"))
+	os.Remove(filepath.Join(r.dir, "miner", id+".json"))
+	os.Remove(filepath.Join(r.dir, "ingest", id+".json"))
+	os.Remove(filepath.Join(r.dir, "reflection", id+".json"))
+	os.Remove(filepath.Join(r.dir, "metalearning", id+".json"))
+	os.Remove(filepath.Join(r.dir, "broker", id+".json"))
+	r.removeTraffic(id)
+	r.removeSchedules(id)
+	return r.removeEvents(id)
+}
+
+// Replace replaces the agents with those of another registry, such as the
+// registry of a cluster. What is kept about the agents that are gone is
+// removed.
+func (r *Registry) Replace(agents []*Agent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unlock, err := lockFile(r.lockPath())
+	if err != nil {
+		return fmt.Errorf("failed to lock agents file: %w", err)
+	}
+	defer unlock()
+
+	// What other processes saved since is replaced too
+	previous := r.agents
+	if err := r.reload(); err == nil {
+		previous = r.agents
+	}
+	r.agents = make(map[string]*Agent, len(agents))
+	for _, agent := range agents {
+		r.agents[agent.ID] = agent
+	}
+	if err := r.save(); err != nil {
+		r.agents = previous
+		return err
+	}
+	for id := range previous {
+		if _, ok := r.agents[id]; !ok {
+			r.removeState(id)
+		}
+	}
+	return nil
+}
+
+// Put adds an agent to the registry, or replaces the agent with its ID
+func (r *Registry) Put(agent *Agent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.modify(func() error {
+		r.agents[agent.ID] = agent
+		return nil
+	})
 }
 
 // Count returns the total number of agents
@@ -158,12 +343,81 @@ func (r *Registry) Count() int {
 	return len(r.agents)
 }
 
+// Reload replaces the in-memory agents with the contents of the registry
+// file, picking up changes made by other processes
+func (r *Registry) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.reload()
+}
+
+// reload is Reload with the registry already locked
+func (r *Registry) reload() error {
+	previous := r.agents
+	r.agents = make(map[string]*Agent)
+	if err := r.load(); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		r.agents = previous
+		return err
+	}
+
+	return nil
+}
+
+// modify applies change to the agents as they are in the registry file and
+// saves them, holding the lock on the file throughout. Other processes, such
+// as the daemon and the CLI, modify the registry the same way, so that
+// changes are made on top of what the others saved since this registry last
+// read the file. The registry must already be locked.
+func (r *Registry) modify(change func() error) error {
+	unlock, err := lockFile(r.lockPath())
+	if err != nil {
+		return fmt.Errorf("failed to lock agents file: %w", err)
+	}
+	defer unlock()
+
+	if r.changedOnDisk() {
+		if err := r.reload(); err != nil {
+			return fmt.Errorf("failed to load agents: %w", err)
+		}
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	return r.save()
+}
+
+// changedOnDisk reports whether another process saved the registry file
+// since this registry last read or wrote it
+func (r *Registry) changedOnDisk() bool {
+	info, err := os.Stat(r.file)
+	if err != nil {
+		return r.seen != nil || !os.IsNotExist(err)
+	}
+	return r.seen == nil || !os.SameFile(info, r.seen) ||
+		!info.ModTime().Equal(r.seen.ModTime()) || info.Size() != r.seen.Size()
+}
+
+// lockPath returns the file locked while the registry file is modified
+func (r *Registry) lockPath() string {
+	return r.file + ".lock"
+}
+
 // load reads agents from the JSON file
 func (r *Registry) load() error {
+	info, err := os.Stat(r.file)
+	if err != nil {
+		r.seen = nil
+		return err
+	}
 	data, err := os.ReadFile(r.file)
 	if err != nil {
 		return err
 	}
+	r.seen = info
 
 	var agents []*Agent
 	if err := json.Unmarshal(data, &agents); err != nil {
@@ -171,6 +425,7 @@ func (r *Registry) load() error {
 	}
 
 	for _, agent := range agents {
+		agent.loaded, _ = json.Marshal(agent)
 		r.agents[agent.ID] = agent
 	}
 
@@ -189,9 +444,19 @@ func (r *Registry) save() error {
 		return fmt.Errorf("failed to marshal agents: %w", err)
 	}
 
-	if err := os.WriteFile(r.file, data, 0644); err != nil {
+	// Readers never see a partly written file
+	tmp := r.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write agents file: %w", err)
+	}
+	if err := os.Rename(tmp, r.file); err != nil {
+		os.Remove(tmp)
 		return fmt.Errorf("failed to write agents file: %w", err)
 	}
+	r.seen, _ = os.Stat(r.file)
+	for _, agent := range agents {
+		agent.loaded, _ = json.Marshal(agent)
+	}
 
 	return nil
 }
@@ -3,6 +3,7 @@ package opencog
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -303,3 +304,102 @@ func TestRegistryPersistence(t *testing.T) {
 		t.Error("agents.json file should exist")
 	}
 }
+
+func TestRegistryKeepsChangesOfOtherProcesses(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The daemon and the CLI each hold a registry on the same directory
+	daemon, err := NewRegistry(tmpDir)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	running, _ := NewAgent(AgentConfig{Name: "running", Type: AtomSpaceAgent})
+	if err := daemon.Register(running); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	cli, err := NewRegistry(tmpDir)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	created, _ := NewAgent(AgentConfig{Name: "created", Type: AtomSpaceAgent})
+	if err := cli.Register(created); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	// The daemon saves without having reloaded
+	if err := daemon.Heartbeat(running.ID, nil); err != nil {
+		t.Fatalf("Heartbeat failed: %v", err)
+	}
+	if _, err := daemon.GetByName("created"); err != nil {
+		t.Errorf("Expected the daemon to pick up the agent created by the CLI: %v", err)
+	}
+
+	// Nor does it bring back an agent the CLI removed
+	if err := cli.Unregister(created.ID); err != nil {
+		t.Fatalf("Unregister failed: %v", err)
+	}
+	if err := daemon.Update(running); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	reloaded, _ := NewRegistry(tmpDir)
+	if reloaded.Count() != 1 {
+		t.Errorf("Expected only the running agent to be left, got %d agents", reloaded.Count())
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "agents.json.tmp")); !os.IsNotExist(err) {
+		t.Errorf("Expected no temporary file to be left behind")
+	}
+}
+
+func TestRegistryUpdateKeepsChangesMadeSinceTheAgentWasRead(t *testing.T) {
+	tmpDir := t.TempDir()
+	daemon, _ := NewRegistry(tmpDir)
+	agent, _ := NewAgent(AgentConfig{Name: "worker", Type: CustomAgent})
+	agent.Status = StatusRunning
+	agent.PID = 4242
+	if err := daemon.Register(agent); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	// The daemon reads the agent at the start of a tick...
+	daemon.Reload()
+	checked, _ := daemon.Get(agent.ID)
+
+	// ...the CLI stops it meanwhile...
+	cli, _ := NewRegistry(tmpDir)
+	stopped, _ := cli.Get(agent.ID)
+	stopped.Status = StatusStopped
+	stopped.PID = 0
+	if err := cli.Update(stopped); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// ...and the daemon saves the outcome of its probes
+	checked.health().State = HealthHealthy
+	checked.Metrics = &AgentMetrics{CPUUsage: 1.5}
+	if err := daemon.Update(checked); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if checked.Status != StatusStopped || checked.PID != 0 {
+		t.Errorf("Expected the daemon's copy to be stopped, got %s with PID %d", checked.Status, checked.PID)
+	}
+
+	reloaded, _ := NewRegistry(tmpDir)
+	saved, _ := reloaded.Get(agent.ID)
+	if saved.Status != StatusStopped || saved.PID != 0 {
+		t.Errorf("Expected the agent to stay stopped, got %s with PID %d", saved.Status, saved.PID)
+	}
+	if saved.Health == nil || saved.Health.State != HealthHealthy || saved.Metrics == nil || saved.Metrics.CPUUsage != 1.5 {
+		t.Errorf("Expected the daemon's changes to be saved, got %+v and %+v", saved.Health, saved.Metrics)
+	}
+
+	// A field both changed cannot be merged
+	checked.Status = StatusError
+	stopped.Status = StatusCreated
+	if err := cli.Update(stopped); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := daemon.Update(checked); err == nil || !strings.Contains(err.Error(), "changed by another process") {
+		t.Errorf("Expected conflicting changes to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+// Package routing holds the declarative rules brokers route messages by. A
+// rule matches messages by their type, the name and tags of their sender and
+// the fields of their payload, and names the agents matching messages are
+// forwarded to. Its mode says how: fanned out to every agent, raced so that
+// the first agent to reply answers, or scattered to every agent with their
+// replies gathered into one.
+package routing
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/github/hub/v2/opencog/internal/yamlmap"
+	"gopkg.in/yaml.v2"
+)
+
+// Modes of forwarding
+const (
+	// FanOut sends a copy of the message to every agent without waiting for
+	// replies
+	FanOut = "fanout"
+	// First sends the message to every agent and answers with the first
+	// reply
+	First = "first"
+	// Gather sends the message to every agent and answers with all their
+	// replies
+	Gather = "gather"
+)
+
+// Modes lists the modes of forwarding
+var Modes = []string{FanOut, First, Gather}
+
+// Envelope is what rules see of a message
+type Envelope struct {
+	Type string
+	// From is the name of the sender, or its ID if it is not a registered
+	// agent
+	From    string
+	Tags    []string
+	Payload map[string]interface{}
+}
+
+// Rule forwards the messages it matches to agents. Conditions that are not
+// set match every message.
+type Rule struct {
+	Name string `yaml:"name" json:"name"`
+	// Types restricts the rule to messages of one of these types
+	Types []string `yaml:"types,omitempty" json:"types,omitempty"`
+	// From restricts the rule to senders whose name matches one of these
+	// glob patterns
+	From []string `yaml:"from,omitempty" json:"from,omitempty"`
+	// Tags restricts the rule to senders with all of these tags
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	// Payload restricts the rule to messages whose payload has these fields,
+	// with values matching glob patterns. Keys such as event.action reach
+	// into nested objects.
+	Payload map[string]interface{} `yaml:"payload,omitempty" json:"payload,omitempty"`
+	// To names the agents matching messages are forwarded to
+	To   []string `yaml:"to" json:"to"`
+	Mode string   `yaml:"mode,omitempty" json:"mode,omitempty"`
+	// Timeout bounds how long replies are waited for in the first and
+	// gather modes, such as 5s. The broker's timeout applies unless set.
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// ForwardMode returns the mode of the rule, fanout unless set
+func (r *Rule) ForwardMode() string {
+	if r.Mode == "" {
+		return FanOut
+	}
+	return r.Mode
+}
+
+// ReplyTimeout returns the timeout of the rule, or fallback if it has none
+func (r *Rule) ReplyTimeout(fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(r.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// Matches tells whether the rule matches a message
+func (r *Rule) Matches(env Envelope) bool {
+	if len(r.Types) > 0 && !contains(r.Types, env.Type) {
+		return false
+	}
+	if len(r.From) > 0 && !matchesAny(r.From, env.From) {
+		return false
+	}
+	for _, tag := range r.Tags {
+		if !contains(env.Tags, tag) {
+			return false
+		}
+	}
+	for key, pattern := range r.Payload {
+		value, ok := Field(env.Payload, key)
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(fmt.Sprint(pattern), fmt.Sprint(value)); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Field returns the value of a field of a payload. Dots in key separate the
+// fields of nested objects; a field whose name has dots is found first.
+func Field(payload map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := payload[key]; ok {
+		return value, true
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] != '.' {
+			continue
+		}
+		nested, ok := payload[key[:i]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if value, ok := Field(nested, key[i+1:]); ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// Table holds the rules of a broker. The first rule matching a message
+// routes it.
+type Table struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// ParseTable parses rules written in YAML
+func ParseTable(data []byte) (*Table, error) {
+	t := &Table{}
+	if err := yaml.UnmarshalStrict(data, t); err != nil {
+		return nil, err
+	}
+	// Payloads are matched against JSON, which has string keys
+	for i := range t.Rules {
+		if payload := t.Rules[i].Payload; payload != nil {
+			t.Rules[i].Payload = yamlmap.StringKeys(payload).(map[string]interface{})
+		}
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// LoadTable reads rules from a YAML file
+func LoadTable(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing rules: %w", err)
+	}
+	t, err := ParseTable(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routing rules in %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Validate checks that the rules are well-formed
+func (t *Table) Validate() error {
+	if len(t.Rules) == 0 {
+		return fmt.Errorf("no rules")
+	}
+	names := make(map[string]bool)
+	for _, rule := range t.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule has no name")
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %s is declared twice", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if len(rule.To) == 0 {
+			return fmt.Errorf("rule %s: no agents to forward to", rule.Name)
+		}
+		for _, name := range rule.To {
+			if name == "" {
+				return fmt.Errorf("rule %s: empty agent name", rule.Name)
+			}
+		}
+		if !contains(Modes, rule.ForwardMode()) {
+			return fmt.Errorf("rule %s: unknown mode %q, expected one of %s", rule.Name, rule.Mode, strings.Join(Modes, ", "))
+		}
+		if rule.Timeout != "" {
+			if d, err := time.ParseDuration(rule.Timeout); err != nil || d <= 0 {
+				return fmt.Errorf("rule %s: invalid timeout %q", rule.Name, rule.Timeout)
+			}
+		}
+
+		patterns := append([]string{}, rule.From...)
+		for key, pattern := range rule.Payload {
+			if key == "" {
+				return fmt.Errorf("rule %s: payload field has no name", rule.Name)
+			}
+			patterns = append(patterns, fmt.Sprint(pattern))
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %s: invalid pattern %q", rule.Name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Match returns the first rule matching a message, or nil if none does
+func (t *Table) Match(env Envelope) *Rule {
+	for i := range t.Rules {
+		if t.Rules[i].Matches(env) {
+			return &t.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Agents returns the names of the agents the rules forward to
+func (t *Table) Agents() []string {
+	var names []string
+	for _, rule := range t.Rules {
+		for _, name := range rule.To {
+			if !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func matchesAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, s); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const rules = `
+rules:
+  - name: reviews
+    types: [command]
+    from: [ci-*]
+    tags: [trusted]
+    payload:
+      event.action: opened
+      priority: 2
+    to: [reviewer, linter]
+    mode: gather
+    timeout: 5s
+  - name: everything
+    to: [archive]
+`
+
+func TestParseTable(t *testing.T) {
+	table, err := ParseTable([]byte(rules))
+	if err != nil {
+		t.Fatalf("ParseTable failed: %v", err)
+	}
+	if len(table.Rules) != 2 || table.Rules[0].ForwardMode() != Gather || table.Rules[1].ForwardMode() != FanOut {
+		t.Fatalf("Unexpected rules %+v", table.Rules)
+	}
+	if d := table.Rules[0].ReplyTimeout(time.Second); d != 5*time.Second {
+		t.Errorf("Expected the rule's timeout, got %s", d)
+	}
+	if d := table.Rules[1].ReplyTimeout(time.Second); d != time.Second {
+		t.Errorf("Expected the fallback timeout, got %s", d)
+	}
+	if agents := table.Agents(); strings.Join(agents, ",") != "reviewer,linter,archive" {
+		t.Errorf("Unexpected agents %v", agents)
+	}
+
+	for _, bad := range []string{
+		"rules: []",
+		"rules: [{to: [a]}]",
+		"rules: [{name: a, to: [b]}, {name: a, to: [c]}]",
+		"rules: [{name: a}]",
+		"rules: [{name: a, to: [b], mode: broadcast}]",
+		"rules: [{name: a, to: [b], timeout: soon}]",
+		"rules: [{name: a, to: [b], from: ['[']}]",
+		"rules: [{name: a, to: [b], priority: 1}]",
+	} {
+		if _, err := ParseTable([]byte(bad)); err == nil {
+			t.Errorf("Expected %q to be refused", bad)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	table, _ := ParseTable([]byte(rules))
+	review := Envelope{
+		Type: "command",
+		From: "ci-linux",
+		Tags: []string{"trusted", "ci"},
+		Payload: map[string]interface{}{
+			"event":    map[string]interface{}{"action": "opened"},
+			"priority": 2.0,
+		},
+	}
+	if rule := table.Match(review); rule == nil || rule.Name != "reviews" {
+		t.Errorf("Expected the review to match the first rule, got %+v", rule)
+	}
+
+	for _, change := range []func(*Envelope){
+		func(e *Envelope) { e.Type = "query" },
+		func(e *Envelope) { e.From = "deploy" },
+		func(e *Envelope) { e.Tags = []string{"ci"} },
+		func(e *Envelope) { e.Payload = map[string]interface{}{"priority": 2} },
+		func(e *Envelope) { e.Payload = map[string]interface{}{"event.action": "closed", "priority": 2} },
+	} {
+		env := review
+		change(&env)
+		if rule := table.Match(env); rule == nil || rule.Name != "everything" {
+			t.Errorf("Expected %+v to fall through to the catch-all rule, got %+v", env, rule)
+		}
+	}
+
+	if value, ok := Field(map[string]interface{}{"event.action": "x"}, "event.action"); !ok || value != "x" {
+		t.Errorf("Expected fields with dots in their name to be found, got %v", value)
+	}
+}
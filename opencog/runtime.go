@@ -0,0 +1,302 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Behavior is the in-process implementation of an agent type. HandleMessage
+// processes a message addressed to the agent and may return a reply, which
+// the orchestrator sends back to the message's sender.
+type Behavior interface {
+	HandleMessage(msg *Message) (*Message, error)
+}
+
+// Publisher is implemented by behaviors that send messages of their own
+// accord, besides replies. Host gives them the outbox of the agent they run
+// as.
+type Publisher interface {
+	SetOutbox(outbox *Outbox)
+}
+
+// Outbox sends messages on behalf of a hosted agent
+type Outbox struct {
+	orchestrator *Orchestrator
+	agentID      string
+}
+
+// Send sends msg from the agent
+func (b *Outbox) Send(msg *Message) error {
+	msg.From = b.agentID
+	return b.orchestrator.SendMessage(msg)
+}
+
+// Request sends msg from the agent and waits for the reply to it
+func (b *Outbox) Request(msg *Message, timeout time.Duration) (*Message, error) {
+	msg.From = b.agentID
+	return b.orchestrator.Request(msg, timeout)
+}
+
+// Registry returns the registry of the orchestrator hosting the agent
+func (b *Outbox) Registry() *Registry {
+	return b.orchestrator.registry
+}
+
+// Heartbeat records a heartbeat of the agent and the metrics it reports
+func (b *Outbox) Heartbeat(reported map[string]float64) error {
+	return b.orchestrator.registry.Heartbeat(b.agentID, reported)
+}
+
+// Cycler is implemented by behaviors that also act periodically, rather than
+// only when they receive messages. While the agent is hosted and not paused,
+// Cycle is called every CycleInterval, between the messages it handles.
+type Cycler interface {
+	CycleInterval() time.Duration
+	Cycle(now time.Time) error
+}
+
+// BehaviorFactory creates the behavior of an agent. configDir is the
+// registry's configuration directory, under which the behavior may keep
+// state.
+type BehaviorFactory func(agent *Agent, configDir string) (Behavior, error)
+
+var (
+	behaviors   = make(map[AgentType]BehaviorFactory)
+	behaviorsMu sync.RWMutex
+)
+
+// RegisterBehavior sets the in-process implementation of an agent type
+func RegisterBehavior(agentType AgentType, factory BehaviorFactory) {
+	behaviorsMu.Lock()
+	defer behaviorsMu.Unlock()
+	behaviors[agentType] = factory
+}
+
+// HasBehavior reports whether an agent type is implemented in-process
+func HasBehavior(agentType AgentType) bool {
+	behaviorsMu.RLock()
+	defer behaviorsMu.RUnlock()
+	_, ok := behaviors[agentType]
+	return ok
+}
+
+// NewBehavior creates the in-process implementation of agent
+func NewBehavior(agent *Agent, configDir string) (Behavior, error) {
+	behaviorsMu.RLock()
+	factory, ok := behaviors[agent.Type]
+	behaviorsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("agent type %s has no in-process implementation", agent.Type)
+	}
+	return factory(agent, configDir)
+}
+
+// Host runs behavior as the agent with the given ID: messages sent to the
+// agent are handled by the behavior and replies are sent back to their
+// senders. The agent is registered if it is not already, and stays hosted
+// until it is unregistered.
+func (o *Orchestrator) Host(agentID string, behavior Behavior) error {
+	o.mu.Lock()
+	if o.hosted[agentID] {
+		o.mu.Unlock()
+		return fmt.Errorf("agent %s is already hosted", agentID)
+	}
+	ch, exists := o.channels[agentID]
+	if !exists {
+		ch = make(chan *Message, 100)
+		o.channels[agentID] = ch
+	}
+	o.hosted[agentID] = true
+	o.mu.Unlock()
+
+	if publisher, ok := behavior.(Publisher); ok {
+		publisher.SetOutbox(&Outbox{orchestrator: o, agentID: agentID})
+	}
+	go o.serve(agentID, ch, behavior)
+	return nil
+}
+
+// Hosted returns the IDs of the agents hosted in-process, sorted
+func (o *Orchestrator) Hosted() []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	ids := make([]string, 0, len(o.hosted))
+	for id := range o.hosted {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// serve delivers the messages on ch to behavior until ch is closed, and runs
+// the behavior's cycles if it has any
+func (o *Orchestrator) serve(agentID string, ch chan *Message, behavior Behavior) {
+	var tick <-chan time.Time
+	cycler, ok := behavior.(Cycler)
+	if ok && cycler.CycleInterval() > 0 {
+		ticker := time.NewTicker(cycler.CycleInterval())
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	lastErr := ""
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			o.deliver(agentID, msg, behavior)
+		case now := <-tick:
+			o.mu.RLock()
+			paused := o.paused[agentID]
+			o.mu.RUnlock()
+			if paused {
+				continue
+			}
+
+			failure := ""
+			if err := cycler.Cycle(now); err != nil {
+				failure = "cycle failed: " + err.Error()
+			}
+			// Record changes rather than every failing cycle
+			if failure != lastErr {
+				reason := failure
+				if reason == "" {
+					reason = "cycles recovered"
+				}
+				o.registry.RecordEvent(Event{
+					AgentID: agentID,
+					Actor:   ActorOrchestrator,
+					Kind:    EventHealth,
+					Reason:  reason,
+				})
+				lastErr = failure
+			}
+		}
+	}
+}
+
+// deliver hands msg to behavior and sends back its reply
+func (o *Orchestrator) deliver(agentID string, msg *Message, behavior Behavior) {
+	reply, err := behavior.HandleMessage(msg)
+	if (reply != nil || err != nil) && msg.ReplyTo == "" {
+		o.countReply(msg.From, agentID, time.Since(msg.Timestamp))
+	}
+	if err != nil {
+		reply = &Message{
+			Type:    MessageTypeError,
+			Payload: map[string]interface{}{"error": err.Error()},
+		}
+	}
+	// Replies are never answered, so that agents cannot keep answering
+	// each other
+	if reply == nil || msg.From == "" || msg.ReplyTo != "" {
+		return
+	}
+
+	reply.From = agentID
+	reply.To = msg.From
+	reply.ReplyTo = msg.ID
+	if reply.Type == "" {
+		reply.Type = MessageTypeResponse
+	}
+	// The sender may have gone away; there is no one to tell
+	o.SendMessage(reply)
+}
+
+// hostAgents hosts the running agents whose types are implemented in-process
+// and stops hosting agents that are no longer running, or that were placed on
+// another node of the cluster. GitHub, which is not an agent, stays hosted.
+func (o *Orchestrator) hostAgents() {
+	want := make(map[string]*Agent)
+	for _, agent := range o.registry.List() {
+		if agent.PID == 0 && HasBehavior(agent.Type) && o.supervises(agent) &&
+			(agent.Status == StatusRunning || agent.Status == StatusPaused) {
+			want[agent.ID] = agent
+		}
+	}
+
+	for _, id := range o.Hosted() {
+		if _, ok := want[id]; !ok && id != GitHubID {
+			o.UnregisterAgent(id)
+		}
+	}
+
+	for id, agent := range want {
+		// Behaviors read their configuration when they are created, so
+		// reconfigured agents are hosted anew
+		config := configFingerprint(agent)
+		o.mu.RLock()
+		hosted, current := o.hosted[id], o.hostedConfig[id]
+		o.mu.RUnlock()
+		if hosted && current == config {
+			continue
+		}
+		if hosted {
+			o.UnregisterAgent(id)
+		}
+
+		behavior, err := NewBehavior(agent, o.registry.Dir())
+		if err != nil {
+			o.registry.Transition(agent, StatusError, ActorOrchestrator, err.Error())
+			o.registry.Update(agent)
+			continue
+		}
+		if o.Host(id, behavior) == nil {
+			o.mu.Lock()
+			o.hostedConfig[id] = config
+			o.mu.Unlock()
+		}
+	}
+}
+
+// configFingerprint identifies the configuration of an agent
+func configFingerprint(agent *Agent) string {
+	data, _ := json.Marshal(agent.Config)
+	return string(data)
+}
+
+// Request sends msg and waits for the reply to it. The sender, msg.From,
+// must be registered. The reply is not delivered to the sender's channel, so
+// hosted agents can make requests too. Error replies are returned as errors.
+func (o *Orchestrator) Request(msg *Message, timeout time.Duration) (*Message, error) {
+	if _, err := o.GetAgentChannel(msg.From); err != nil {
+		return nil, err
+	}
+	if msg.ID == "" {
+		msg.ID = generateMessageID()
+	}
+
+	waiter := make(chan *Message, 1)
+	o.mu.Lock()
+	o.pending[msg.ID] = waiter
+	o.mu.Unlock()
+	defer func() {
+		o.mu.Lock()
+		delete(o.pending, msg.ID)
+		o.mu.Unlock()
+	}()
+
+	if err := o.SendMessage(msg); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-waiter:
+		if reply.Type == MessageTypeError {
+			return reply, fmt.Errorf("%v", reply.Payload["error"])
+		}
+		return reply, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("no reply from agent %s within %s", msg.To, timeout)
+	}
+}
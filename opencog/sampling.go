@@ -0,0 +1,222 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxSamples bounds the number of resource samples kept for each agent
+const maxSamples = 60
+
+// ResourceSample is a measurement of an agent process's resource usage
+type ResourceSample struct {
+	Time       time.Time `json:"time"`
+	CPUSeconds float64   `json:"cpu_seconds"`
+	CPUPercent float64   `json:"cpu_percent"`
+	RSS        int64     `json:"rss"`
+	Threads    int       `json:"threads"`
+	OpenFiles  int       `json:"open_files"`
+}
+
+// SampleBuffer is a fixed-size ring buffer of resource samples
+type SampleBuffer struct {
+	samples []ResourceSample
+	next    int
+	full    bool
+}
+
+// NewSampleBuffer creates a buffer holding up to size samples
+func NewSampleBuffer(size int) *SampleBuffer {
+	return &SampleBuffer{samples: make([]ResourceSample, size)}
+}
+
+// Add stores a sample, overwriting the oldest one when the buffer is full
+func (b *SampleBuffer) Add(sample ResourceSample) {
+	b.samples[b.next] = sample
+	b.next = (b.next + 1) % len(b.samples)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Latest returns the most recent sample
+func (b *SampleBuffer) Latest() (ResourceSample, bool) {
+	if !b.full && b.next == 0 {
+		return ResourceSample{}, false
+	}
+	return b.samples[(b.next+len(b.samples)-1)%len(b.samples)], true
+}
+
+// Samples returns the buffered samples, oldest first
+func (b *SampleBuffer) Samples() []ResourceSample {
+	if !b.full {
+		return append([]ResourceSample(nil), b.samples[:b.next]...)
+	}
+	return append(append([]ResourceSample(nil), b.samples[b.next:]...), b.samples[:b.next]...)
+}
+
+// SampleProcess measures the resource usage of pid. CPU usage is computed
+// against prev, the previous sample of the same process, if there is one.
+func SampleProcess(pid int, prev *ResourceSample) (ResourceSample, error) {
+	stat, err := readProcStat(pid)
+	if err != nil {
+		return ResourceSample{}, fmt.Errorf("failed to sample process %d: %w", pid, err)
+	}
+
+	sample := ResourceSample{
+		Time:       time.Now(),
+		CPUSeconds: stat.cpuSeconds,
+		RSS:        stat.rss,
+		Threads:    stat.threads,
+	}
+	if files, err := procOpenFiles(pid); err == nil {
+		sample.OpenFiles = files
+	}
+
+	if prev != nil {
+		elapsed := sample.Time.Sub(prev.Time).Seconds()
+		if elapsed > 0 && sample.CPUSeconds >= prev.CPUSeconds {
+			sample.CPUPercent = (sample.CPUSeconds - prev.CPUSeconds) / elapsed * 100
+		}
+	}
+
+	return sample, nil
+}
+
+// sampleResources samples every supervised agent process, records the
+// samples in the agents' buffers and updates their metrics
+func (o *Orchestrator) sampleResources() {
+	for _, agent := range o.registry.List() {
+		if agent.PID == 0 || (agent.Status != StatusRunning && agent.Status != StatusPaused) || !o.supervises(agent) {
+			continue
+		}
+
+		o.mu.Lock()
+		buffer, ok := o.samples[agent.ID]
+		if !ok {
+			buffer = NewSampleBuffer(maxSamples)
+			o.samples[agent.ID] = buffer
+		}
+		var prev *ResourceSample
+		if latest, ok := buffer.Latest(); ok {
+			prev = &latest
+		}
+		o.mu.Unlock()
+
+		sample, err := SampleProcess(agent.PID, prev)
+		if err != nil {
+			// The process has exited; enforceLimits deals with it
+			continue
+		}
+
+		o.mu.Lock()
+		buffer.Add(sample)
+		samples := buffer.Samples()
+		o.mu.Unlock()
+
+		if agent.Metrics == nil {
+			agent.Metrics = &AgentMetrics{}
+		}
+		agent.Metrics.CPUUsage = sample.CPUPercent
+		agent.Metrics.MemoryUsage = sample.RSS
+		agent.Metrics.Threads = sample.Threads
+		agent.Metrics.OpenFiles = sample.OpenFiles
+		if agent.StartedAt != nil {
+			agent.Metrics.Uptime = int64(sample.Time.Sub(*agent.StartedAt).Seconds())
+		}
+
+		o.registry.Update(agent)
+		o.registry.SaveSamples(agent.ID, samples)
+	}
+}
+
+// Samples returns the resource samples the orchestrator holds for an agent,
+// oldest first
+func (o *Orchestrator) Samples(agentID string) []ResourceSample {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if buffer, ok := o.samples[agentID]; ok {
+		return buffer.Samples()
+	}
+	return nil
+}
+
+// forgetSamples drops the samples held for an agent whose process has exited
+func (o *Orchestrator) forgetSamples(agentID string) {
+	o.mu.Lock()
+	delete(o.samples, agentID)
+	o.mu.Unlock()
+}
+
+// SaveSamples stores the most recent resource samples of an agent so that
+// other processes, such as `hub agent status`, can show them
+func (r *Registry) SaveSamples(agentID string, samples []ResourceSample) error {
+	path := r.samplesPath(agentID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create samples directory: %w", err)
+	}
+
+	data, err := json.Marshal(samples)
+	if err != nil {
+		return fmt.Errorf("failed to marshal samples: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write samples file: %w", err)
+	}
+	return nil
+}
+
+// Samples returns the resource samples last saved for an agent, oldest first
+func (r *Registry) Samples(agentID string) ([]ResourceSample, error) {
+	data, err := os.ReadFile(r.samplesPath(agentID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read samples: %w", err)
+	}
+
+	var samples []ResourceSample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal samples: %w", err)
+	}
+	return samples, nil
+}
+
+// samplesPath returns the file holding an agent's resource samples
+func (r *Registry) samplesPath(agentID string) string {
+	return filepath.Join(r.dir, "samples", agentID+".json")
+}
+
+// sparkTicks are the bars used by Sparkline, lowest first
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline renders values as a line of bars scaled between their minimum
+// and maximum
+func Sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+
+	line := make([]rune, len(values))
+	for i, v := range values {
+		tick := 0
+		if max > min {
+			tick = int((v - min) / (max - min) * float64(len(sparkTicks)-1))
+		}
+		line[i] = sparkTicks[tick]
+	}
+	return string(line)
+}
@@ -0,0 +1,110 @@
+package opencog
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSampleBuffer(t *testing.T) {
+	buffer := NewSampleBuffer(3)
+	if _, ok := buffer.Latest(); ok {
+		t.Error("An empty buffer should have no latest sample")
+	}
+
+	for i := 1; i <= 5; i++ {
+		buffer.Add(ResourceSample{Threads: i})
+	}
+
+	samples := buffer.Samples()
+	if len(samples) != 3 {
+		t.Fatalf("Expected 3 samples, got %d", len(samples))
+	}
+	for i, want := range []int{3, 4, 5} {
+		if samples[i].Threads != want {
+			t.Errorf("Sample %d: expected %d, got %d", i, want, samples[i].Threads)
+		}
+	}
+	if latest, _ := buffer.Latest(); latest.Threads != 5 {
+		t.Errorf("Expected latest sample 5, got %d", latest.Threads)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := Sparkline([]float64{0, 1, 2, 3, 4, 5, 6, 7}); got != "▁▂▃▄▅▆▇█" {
+		t.Errorf("Unexpected sparkline %q", got)
+	}
+	if got := Sparkline([]float64{3, 3, 3}); got != "▁▁▁" {
+		t.Errorf("A flat series should render as the lowest bar, got %q", got)
+	}
+	if got := Sparkline(nil); got != "" {
+		t.Errorf("An empty series should render as nothing, got %q", got)
+	}
+}
+
+func TestSampleProcess(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sampling requires /proc")
+	}
+
+	first, err := SampleProcess(os.Getpid(), nil)
+	if err != nil {
+		t.Fatalf("SampleProcess failed: %v", err)
+	}
+	if first.RSS <= 0 || first.Threads <= 0 || first.OpenFiles <= 0 {
+		t.Errorf("Expected positive usage, got %+v", first)
+	}
+
+	// Burn some CPU so that the second sample shows usage
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+	}
+	second, err := SampleProcess(os.Getpid(), &first)
+	if err != nil {
+		t.Fatalf("SampleProcess failed: %v", err)
+	}
+	if second.CPUPercent <= 0 {
+		t.Errorf("Expected CPU usage, got %+v", second)
+	}
+
+	if _, err := SampleProcess(0, nil); err == nil {
+		t.Error("SampleProcess should fail for a missing process")
+	}
+}
+
+func TestSampleResources(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sampling requires /proc")
+	}
+
+	registry, _ := NewRegistry(t.TempDir())
+	agent, _ := NewAgent(AgentConfig{Name: "sampled", Type: CustomAgent})
+	agent.Status = StatusRunning
+	agent.PID = os.Getpid()
+	registry.Register(agent)
+
+	orchestrator := NewOrchestrator(registry)
+	orchestrator.sampleResources()
+	orchestrator.sampleResources()
+
+	if agent.Metrics == nil || agent.Metrics.MemoryUsage <= 0 || agent.Metrics.Threads <= 0 {
+		t.Errorf("Metrics should be populated from the samples, got %+v", agent.Metrics)
+	}
+	if got := len(orchestrator.Samples(agent.ID)); got != 2 {
+		t.Errorf("Expected 2 buffered samples, got %d", got)
+	}
+
+	saved, err := registry.Samples(agent.ID)
+	if err != nil {
+		t.Fatalf("Samples failed: %v", err)
+	}
+	if len(saved) != 2 {
+		t.Errorf("Expected 2 saved samples, got %d", len(saved))
+	}
+
+	registry.Unregister(agent.ID)
+	if saved, _ := registry.Samples(agent.ID); len(saved) != 0 {
+		t.Error("Samples should be removed with the agent")
+	}
+}
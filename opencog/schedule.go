@@ -0,0 +1,433 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/github/hub/v2/opencog/cron"
+	"github.com/github/hub/v2/opencog/workflow"
+)
+
+// SchedulerID is the sender of the messages of scheduled tasks
+const SchedulerID = "scheduler"
+
+// MissedPolicy says what happens to the runs of a schedule that were due
+// while the daemon was not running
+type MissedPolicy string
+
+const (
+	// MissedSkip skips missed runs; the next run is the next one due
+	MissedSkip MissedPolicy = "skip"
+	// MissedCatchUp runs once as soon as the daemon runs again, however
+	// many runs were missed
+	MissedCatchUp MissedPolicy = "catch-up"
+)
+
+// maxScheduledRuns bounds the runs remembered for each schedule
+const maxScheduledRuns = 20
+
+// Schedule runs a task on a cron schedule while the daemon runs: either a
+// command sent to an agent or a workflow
+type Schedule struct {
+	Name string `json:"name"`
+	Cron string `json:"cron"`
+	// AgentID is the agent the command is sent to
+	AgentID string                 `json:"agent_id,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+	// Timeout bounds the wait for the agent's reply to the command
+	Timeout string `json:"timeout,omitempty"`
+	// Workflow is the path of the workflow file to run
+	Workflow string       `json:"workflow,omitempty"`
+	Missed   MissedPolicy `json:"missed"`
+	Created  time.Time    `json:"created"`
+}
+
+// Validate checks that the schedule is well-formed and that its agent or
+// workflow exists
+func (s *Schedule) Validate(r *Registry) error {
+	if s.Name == "" || strings.Trim(s.Name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789._-") != "" || strings.HasPrefix(s.Name, ".") {
+		return fmt.Errorf("invalid schedule name %q: use letters, digits, dots, dashes and underscores", s.Name)
+	}
+	if _, err := cron.Parse(s.Cron); err != nil {
+		return err
+	}
+	if s.Missed != MissedSkip && s.Missed != MissedCatchUp {
+		return fmt.Errorf("unknown missed-run policy %q, expected %s or %s", s.Missed, MissedSkip, MissedCatchUp)
+	}
+	if (s.AgentID == "") == (s.Workflow == "") {
+		return fmt.Errorf("schedule %s needs either an agent or a workflow", s.Name)
+	}
+	if s.Timeout != "" {
+		if d, err := time.ParseDuration(s.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("timeout must be a positive duration (e.g. 30s, 5m), got %q", s.Timeout)
+		}
+	}
+
+	if s.Workflow != "" {
+		_, err := workflow.Load(s.Workflow)
+		return err
+	}
+	agent, err := r.Get(s.AgentID)
+	if err != nil {
+		return err
+	}
+	if !HasBehavior(agent.Type) {
+		return fmt.Errorf("%s agents cannot be sent commands", agent.Type)
+	}
+	return nil
+}
+
+// NextRun returns when a schedule is next due after t, or the zero time if
+// it never is
+func (s *Schedule) NextRun(t time.Time) time.Time {
+	spec, err := cron.Parse(s.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	return spec.Next(t)
+}
+
+// timeout returns how long a command waits for its reply
+func (s *Schedule) timeout() time.Duration {
+	if d, err := time.ParseDuration(s.Timeout); err == nil {
+		return d
+	}
+	return workflow.DefaultTimeout
+}
+
+// ScheduledRun is the record of a run of a schedule
+type ScheduledRun struct {
+	// Due is when the run was scheduled
+	Due      time.Time       `json:"due"`
+	Started  *time.Time      `json:"started,omitempty"`
+	Finished *time.Time      `json:"finished,omitempty"`
+	Status   workflow.Status `json:"status"`
+	// Error tells why the run failed or was skipped
+	Error string `json:"error,omitempty"`
+	// RunID identifies the record of a workflow run
+	RunID string `json:"run_id,omitempty"`
+}
+
+// scheduleState is what the daemon keeps about a schedule
+type scheduleState struct {
+	// LastDue is when the last run handled was due
+	LastDue time.Time       `json:"last_due"`
+	Runs    []*ScheduledRun `json:"runs"`
+}
+
+func (r *Registry) schedulesPath() string {
+	return filepath.Join(r.dir, "schedules.json")
+}
+
+func (r *Registry) scheduleStatePath(name string) string {
+	return filepath.Join(r.dir, "schedules", name+".json")
+}
+
+// Schedules returns the schedules, sorted by name
+func (r *Registry) Schedules() ([]*Schedule, error) {
+	data, err := os.ReadFile(r.schedulesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read schedules: %w", err)
+	}
+
+	var schedules []*Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return nil, fmt.Errorf("failed to parse schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// Schedule returns the schedule with the given name
+func (r *Registry) Schedule(name string) (*Schedule, error) {
+	schedules, err := r.Schedules()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range schedules {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("schedule %s not found", name)
+}
+
+// AddSchedule validates and adds a schedule
+func (r *Registry) AddSchedule(s *Schedule) error {
+	if err := s.Validate(r); err != nil {
+		return err
+	}
+	schedules, err := r.Schedules()
+	if err != nil {
+		return err
+	}
+	for _, existing := range schedules {
+		if existing.Name == s.Name {
+			return fmt.Errorf("schedule %s already exists", s.Name)
+		}
+	}
+	if s.Created.IsZero() {
+		s.Created = time.Now()
+	}
+	return r.writeSchedules(append(schedules, s))
+}
+
+// RemoveSchedule removes a schedule and the record of its runs
+func (r *Registry) RemoveSchedule(name string) error {
+	schedules, err := r.Schedules()
+	if err != nil {
+		return err
+	}
+	kept := schedules[:0]
+	for _, s := range schedules {
+		if s.Name != name {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == len(schedules) {
+		return fmt.Errorf("schedule %s not found", name)
+	}
+	os.Remove(r.scheduleStatePath(name))
+	return r.writeSchedules(kept)
+}
+
+// removeSchedules removes the schedules sending commands to an agent
+func (r *Registry) removeSchedules(agentID string) error {
+	schedules, err := r.Schedules()
+	if err != nil || schedules == nil {
+		return err
+	}
+	kept := schedules[:0]
+	for _, s := range schedules {
+		if s.AgentID == agentID {
+			os.Remove(r.scheduleStatePath(s.Name))
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return r.writeSchedules(kept)
+}
+
+func (r *Registry) writeSchedules(schedules []*Schedule) error {
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].Name < schedules[j].Name })
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedules: %w", err)
+	}
+	if err := os.WriteFile(r.schedulesPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write schedules: %w", err)
+	}
+	return nil
+}
+
+// ScheduledRuns returns the most recent runs of a schedule, oldest first
+func (r *Registry) ScheduledRuns(name string) ([]*ScheduledRun, error) {
+	state, err := r.loadScheduleState(name)
+	if err != nil {
+		return nil, err
+	}
+	return state.Runs, nil
+}
+
+func (r *Registry) loadScheduleState(name string) (*scheduleState, error) {
+	state := &scheduleState{}
+	data, err := os.ReadFile(r.scheduleStatePath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read schedule state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule state: %w", err)
+	}
+	return state, nil
+}
+
+func (r *Registry) saveScheduleState(name string, state *scheduleState) error {
+	if len(state.Runs) > maxScheduledRuns {
+		state.Runs = state.Runs[len(state.Runs)-maxScheduledRuns:]
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule state: %w", err)
+	}
+	path := r.scheduleStatePath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create schedule state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write schedule state: %w", err)
+	}
+	return nil
+}
+
+// scheduleGrace is how late a run may start before the skip policy counts
+// it as missed
+func (o *Orchestrator) scheduleGrace() time.Duration {
+	if grace := 2 * o.CheckInterval; grace > time.Minute {
+		return grace
+	}
+	return time.Minute
+}
+
+// runSchedules starts the runs of the schedules that came due since their
+// last run. A run due while the previous one is still going is skipped.
+func (o *Orchestrator) runSchedules(now time.Time) {
+	schedules, err := o.registry.Schedules()
+	if err != nil || len(schedules) == 0 {
+		return
+	}
+	if _, err := o.GetAgentChannel(SchedulerID); err != nil {
+		o.RegisterAgent(SchedulerID)
+	}
+
+	o.scheduleMu.Lock()
+	defer o.scheduleMu.Unlock()
+
+	for _, s := range schedules {
+		spec, err := cron.Parse(s.Cron)
+		if err != nil {
+			continue
+		}
+		state, err := o.registry.loadScheduleState(s.Name)
+		if err != nil {
+			continue
+		}
+
+		o.mu.RLock()
+		running := o.scheduled[s.Name]
+		o.mu.RUnlock()
+
+		// Runs left running by a daemon that stopped will not finish
+		changed := false
+		if n := len(state.Runs); n > 0 && state.Runs[n-1].Status == workflow.Running && !running {
+			state.Runs[n-1].Status = workflow.Failed
+			state.Runs[n-1].Error = "interrupted: the daemon stopped"
+			changed = true
+		}
+
+		since := state.LastDue
+		if since.IsZero() {
+			since = s.Created
+		}
+		due := spec.Last(since, now)
+		if due.IsZero() {
+			if changed {
+				o.registry.saveScheduleState(s.Name, state)
+			}
+			continue
+		}
+
+		state.LastDue = due
+		run := &ScheduledRun{Due: due}
+		switch {
+		case running:
+			run.Status = workflow.Skipped
+			run.Error = "the previous run was still running"
+		case s.Missed == MissedSkip && now.Sub(due) > o.scheduleGrace():
+			run.Status = workflow.Skipped
+			run.Error = "missed while the daemon was not running"
+		default:
+			started := now
+			run.Started = &started
+			run.Status = workflow.Running
+			o.mu.Lock()
+			o.scheduled[s.Name] = true
+			o.mu.Unlock()
+			go o.runScheduled(s, run)
+		}
+		state.Runs = append(state.Runs, run)
+		o.registry.saveScheduleState(s.Name, state)
+	}
+}
+
+// runScheduled performs a run of a schedule and records its outcome
+func (o *Orchestrator) runScheduled(s *Schedule, run *ScheduledRun) {
+	var runID string
+	var err error
+	if s.Workflow != "" {
+		runID, err = o.runScheduledWorkflow(s.Workflow)
+	} else {
+		_, err = o.Request(&Message{
+			From:    SchedulerID,
+			To:      s.AgentID,
+			Type:    MessageTypeCommand,
+			Payload: s.Payload,
+		}, s.timeout())
+	}
+
+	o.scheduleMu.Lock()
+	defer o.scheduleMu.Unlock()
+	o.mu.Lock()
+	delete(o.scheduled, s.Name)
+	o.mu.Unlock()
+
+	finished := time.Now()
+	state, loadErr := o.registry.loadScheduleState(s.Name)
+	if loadErr != nil {
+		return
+	}
+	for _, recorded := range state.Runs {
+		if !recorded.Due.Equal(run.Due) || recorded.Status != workflow.Running {
+			continue
+		}
+		recorded.Finished = &finished
+		recorded.RunID = runID
+		recorded.Status = workflow.Succeeded
+		if err != nil {
+			recorded.Status = workflow.Failed
+			recorded.Error = err.Error()
+		}
+	}
+	o.registry.saveScheduleState(s.Name, state)
+}
+
+func (o *Orchestrator) runScheduledWorkflow(file string) (string, error) {
+	w, err := workflow.Load(file)
+	if err != nil {
+		return "", err
+	}
+	runner := &workflow.Runner{
+		Send: o.WorkflowSender(SchedulerID),
+		Record: func(run *workflow.Run) error {
+			return workflow.SaveRun(o.registry.Dir(), run)
+		},
+	}
+	run, err := runner.Run(w, file)
+	if err != nil {
+		return run.ID, err
+	}
+	if run.Status != workflow.Succeeded {
+		return run.ID, fmt.Errorf("workflow run %s %s", run.ID, run.Status)
+	}
+	return run.ID, nil
+}
+
+// WorkflowSender returns a workflow sender sending the messages of steps
+// from the given agent, which must be registered
+func (o *Orchestrator) WorkflowSender(from string) workflow.Sender {
+	return func(step *workflow.Step, timeout time.Duration) (map[string]interface{}, error) {
+		agent, err := o.registry.GetByName(step.Agent)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := o.Request(&Message{
+			From:    from,
+			To:      agent.ID,
+			Type:    MessageType(step.MessageType()),
+			Payload: step.Payload,
+		}, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return reply.Payload, nil
+	}
+}
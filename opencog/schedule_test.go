@@ -0,0 +1,148 @@
+package opencog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/hub/v2/opencog/workflow"
+)
+
+// lastScheduledRun waits for the last run of a schedule to finish and
+// returns it
+func lastScheduledRun(t *testing.T, registry *Registry, name string) *ScheduledRun {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runs, err := registry.ScheduledRuns(name)
+		if err != nil {
+			t.Fatalf("ScheduledRuns failed: %v", err)
+		}
+		if len(runs) > 0 && runs[len(runs)-1].Status != workflow.Running {
+			return runs[len(runs)-1]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Schedule %s did not finish a run, runs: %+v", name, runs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunSchedules(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	kb, _ := NewAgent(AgentConfig{Name: "kb", Type: AtomSpaceAgent})
+	miner, _ := NewAgent(AgentConfig{Name: "miner", Type: PatternMinerAgent, Config: map[string]interface{}{"atomspace": "kb"}})
+	registry.Register(kb)
+	registry.Register(miner)
+
+	orchestrator := NewOrchestrator(registry)
+	for _, agent := range []*Agent{kb, miner} {
+		behavior, err := NewBehavior(agent, registry.Dir())
+		if err != nil {
+			t.Fatalf("NewBehavior failed: %v", err)
+		}
+		orchestrator.Host(agent.ID, behavior)
+	}
+
+	created := time.Date(2024, 5, 15, 10, 30, 0, 0, time.Local)
+	for _, s := range []*Schedule{
+		{Name: "hourly", Cron: "0 * * * *", AgentID: miner.ID, Payload: map[string]interface{}{"action": MineAction}, Missed: MissedSkip, Created: created},
+		{Name: "eager", Cron: "0 * * * *", AgentID: miner.ID, Payload: map[string]interface{}{"action": MineAction}, Missed: MissedCatchUp, Created: created},
+	} {
+		if err := registry.AddSchedule(s); err != nil {
+			t.Fatalf("AddSchedule failed: %v", err)
+		}
+	}
+
+	orchestrator.runSchedules(created.Add(10 * time.Minute))
+	if runs, _ := registry.ScheduledRuns("hourly"); len(runs) != 0 {
+		t.Fatalf("Expected no run before the schedule is due, got %+v", runs)
+	}
+
+	orchestrator.runSchedules(created.Add(30*time.Minute + 5*time.Second))
+	for _, name := range []string{"hourly", "eager"} {
+		run := lastScheduledRun(t, registry, name)
+		if run.Status != workflow.Succeeded || !run.Due.Equal(created.Add(30*time.Minute)) {
+			t.Errorf("Expected %s to run at 11:00, got %+v", name, run)
+		}
+	}
+
+	// Runs missed for hours are skipped, or caught up with once
+	orchestrator.runSchedules(created.Add(3*time.Hour + 40*time.Minute))
+	if run := lastScheduledRun(t, registry, "hourly"); run.Status != workflow.Skipped || !strings.Contains(run.Error, "missed") {
+		t.Errorf("Expected the missed run to be skipped, got %+v", run)
+	}
+	if run := lastScheduledRun(t, registry, "eager"); run.Status != workflow.Succeeded || run.Due.Hour() != 14 {
+		t.Errorf("Expected one run catching up, got %+v", run)
+	}
+	if runs, _ := registry.ScheduledRuns("eager"); len(runs) != 2 {
+		t.Errorf("Expected missed runs to be caught up with once, got %d runs", len(runs))
+	}
+
+	// A run due while the previous one is still going is skipped
+	orchestrator.scheduled["hourly"] = true
+	orchestrator.runSchedules(created.Add(4*time.Hour + 30*time.Minute))
+	if run := lastScheduledRun(t, registry, "hourly"); run.Status != workflow.Skipped || !strings.Contains(run.Error, "still running") {
+		t.Errorf("Expected the overlapping run to be skipped, got %+v", run)
+	}
+
+	// Runs left running by a daemon that stopped are failed
+	delete(orchestrator.scheduled, "hourly")
+	state, _ := registry.loadScheduleState("hourly")
+	state.Runs = append(state.Runs, &ScheduledRun{Due: state.LastDue, Status: workflow.Running})
+	registry.saveScheduleState("hourly", state)
+	orchestrator.runSchedules(created.Add(4*time.Hour + 35*time.Minute))
+	if run := lastScheduledRun(t, registry, "hourly"); run.Status != workflow.Failed || !strings.Contains(run.Error, "interrupted") {
+		t.Errorf("Expected the interrupted run to fail, got %+v", run)
+	}
+
+	// Schedules go with their agent
+	registry.Unregister(miner.ID)
+	if schedules, _ := registry.Schedules(); len(schedules) != 0 {
+		t.Errorf("Expected the schedules of the removed agent to go, got %+v", schedules)
+	}
+}
+
+func TestAddSchedule(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	kb, _ := NewAgent(AgentConfig{Name: "kb", Type: AtomSpaceAgent})
+	custom, _ := NewAgent(AgentConfig{Name: "custom", Type: CustomAgent})
+	registry.Register(kb)
+	registry.Register(custom)
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		wantErr  string
+	}{
+		{"name", Schedule{Name: "a/b", Cron: "@daily", AgentID: kb.ID, Missed: MissedSkip}, "invalid schedule name"},
+		{"cron", Schedule{Name: "s", Cron: "daily", AgentID: kb.ID, Missed: MissedSkip}, "invalid cron expression"},
+		{"policy", Schedule{Name: "s", Cron: "@daily", AgentID: kb.ID, Missed: "later"}, "unknown missed-run policy"},
+		{"no target", Schedule{Name: "s", Cron: "@daily", Missed: MissedSkip}, "either an agent or a workflow"},
+		{"agent", Schedule{Name: "s", Cron: "@daily", AgentID: "missing", Missed: MissedSkip}, "not found"},
+		{"behavior", Schedule{Name: "s", Cron: "@daily", AgentID: custom.ID, Missed: MissedSkip}, "cannot be sent commands"},
+		{"workflow", Schedule{Name: "s", Cron: "@daily", Workflow: "missing.yaml", Missed: MissedSkip}, "failed to read workflow"},
+		{"timeout", Schedule{Name: "s", Cron: "@daily", AgentID: kb.ID, Missed: MissedSkip, Timeout: "-1s"}, "timeout must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := registry.AddSchedule(&tt.schedule)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	s := &Schedule{Name: "nightly", Cron: "0 3 * * *", AgentID: kb.ID, Missed: MissedSkip}
+	if err := registry.AddSchedule(s); err != nil {
+		t.Fatalf("AddSchedule failed: %v", err)
+	}
+	if err := registry.AddSchedule(s); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected a duplicate schedule to be refused, got %v", err)
+	}
+	if err := registry.RemoveSchedule("nightly"); err != nil {
+		t.Errorf("RemoveSchedule failed: %v", err)
+	}
+	if err := registry.RemoveSchedule("nightly"); err == nil {
+		t.Error("Expected removing a missing schedule to fail")
+	}
+}
@@ -0,0 +1,258 @@
+package opencog
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OptionType is the value type accepted by an agent configuration option
+type OptionType string
+
+const (
+	OptionString   OptionType = "string"
+	OptionInt      OptionType = "int"
+	OptionFloat    OptionType = "float"
+	OptionBool     OptionType = "bool"
+	OptionDuration OptionType = "duration"
+	// OptionAgent values name another agent, which the agent depends on
+	OptionAgent OptionType = "agent"
+)
+
+// ConfigOption describes a single configuration key accepted by an agent type
+type ConfigOption struct {
+	Key         string      `json:"key" yaml:"key"`
+	Type        OptionType  `json:"type" yaml:"type"`
+	Default     interface{} `json:"default,omitempty" yaml:"default,omitempty"`
+	Required    bool        `json:"required,omitempty" yaml:"required,omitempty"`
+	Choices     []string    `json:"choices,omitempty" yaml:"choices,omitempty"`
+	Description string      `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// check further validates values coerced to the option's type
+	check func(value interface{}) error
+}
+
+// commonOptions are accepted by agents of every type, besides the options
+// of their type's schema
+var commonOptions = append(append([]ConfigOption{}, githubOptions...), placementOptions...)
+
+// ConfigSchema describes the configuration accepted by an agent type
+type ConfigSchema struct {
+	Options []ConfigOption `json:"options" yaml:"options"`
+	// AllowUnknown permits keys that are not declared in Options
+	AllowUnknown bool `json:"allow_unknown,omitempty" yaml:"allow_unknown,omitempty"`
+}
+
+// Option returns the declared option for key, or the common option
+func (s *ConfigSchema) Option(key string) (*ConfigOption, bool) {
+	for i := range s.Options {
+		if s.Options[i].Key == key {
+			return &s.Options[i], true
+		}
+	}
+	for i := range commonOptions {
+		if commonOptions[i].Key == key {
+			return &commonOptions[i], true
+		}
+	}
+	return nil, false
+}
+
+// Keys returns the declared option keys in declaration order
+func (s *ConfigSchema) Keys() []string {
+	keys := make([]string, 0, len(s.Options))
+	for _, opt := range s.Options {
+		keys = append(keys, opt.Key)
+	}
+	return keys
+}
+
+// Apply validates config against the schema and returns a copy with values
+// coerced to their declared types and defaults filled in
+func (s *ConfigSchema) Apply(agentType AgentType, config map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(config)+len(s.Options))
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := config[key]
+		opt, ok := s.Option(key)
+		if !ok {
+			if !s.AllowUnknown {
+				return nil, fmt.Errorf("unknown option %q for agent type %s (accepted: %s)",
+					key, agentType, strings.Join(s.Keys(), ", "))
+			}
+			result[key] = value
+			continue
+		}
+
+		coerced, err := opt.Coerce(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for option %s of agent type %s: %w", key, agentType, err)
+		}
+		result[key] = coerced
+	}
+
+	for _, opt := range s.Options {
+		if _, ok := result[opt.Key]; ok {
+			continue
+		}
+		if opt.Required {
+			return nil, fmt.Errorf("option %s is required for agent type %s", opt.Key, agentType)
+		}
+		if opt.Default != nil {
+			result[opt.Key] = opt.Default
+		}
+	}
+
+	return result, nil
+}
+
+// Coerce converts value to the option's declared type. Strings are parsed so
+// that values given on the command line can be validated the same way as
+// values loaded from JSON.
+func (o *ConfigOption) Coerce(value interface{}) (interface{}, error) {
+	var result interface{}
+
+	switch o.Type {
+	case OptionString, OptionAgent, "":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string, got %v", value)
+		}
+		result = s
+	case OptionInt:
+		switch v := value.(type) {
+		case int:
+			result = v
+		case int64:
+			result = int(v)
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("expected integer, got %v", v)
+			}
+			result = int(v)
+		case string:
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("expected integer, got %q", v)
+			}
+			result = n
+		default:
+			return nil, fmt.Errorf("expected integer, got %v", value)
+		}
+	case OptionFloat:
+		switch v := value.(type) {
+		case float64:
+			result = v
+		case int:
+			result = float64(v)
+		case int64:
+			result = float64(v)
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected number, got %q", v)
+			}
+			result = f
+		default:
+			return nil, fmt.Errorf("expected number, got %v", value)
+		}
+	case OptionBool:
+		switch v := value.(type) {
+		case bool:
+			result = v
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("expected boolean, got %q", v)
+			}
+			result = b
+		default:
+			return nil, fmt.Errorf("expected boolean, got %v", value)
+		}
+	case OptionDuration:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected duration, got %v", value)
+		}
+		if _, err := time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("expected duration (e.g. 30s, 5m), got %q", s)
+		}
+		result = s
+	default:
+		return nil, fmt.Errorf("option has unsupported type %q", o.Type)
+	}
+
+	if o.check != nil {
+		if err := o.check(result); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(o.Choices) > 0 {
+		s := fmt.Sprint(result)
+		for _, choice := range o.Choices {
+			if s == choice {
+				return result, nil
+			}
+		}
+		return nil, fmt.Errorf("expected one of %s, got %q", strings.Join(o.Choices, ", "), s)
+	}
+
+	return result, nil
+}
+
+// validate checks that the schema itself is well-formed
+func (s *ConfigSchema) validate() error {
+	seen := make(map[string]bool)
+	for i := range s.Options {
+		opt := &s.Options[i]
+		if opt.Key == "" {
+			return fmt.Errorf("option %d has no key", i+1)
+		}
+		if seen[opt.Key] {
+			return fmt.Errorf("option %s is declared twice", opt.Key)
+		}
+		for _, common := range commonOptions {
+			if opt.Key == common.Key {
+				return fmt.Errorf("option %s is common to all agent types", opt.Key)
+			}
+		}
+		seen[opt.Key] = true
+
+		switch opt.Type {
+		case "":
+			opt.Type = OptionString
+		case OptionString, OptionInt, OptionFloat, OptionBool, OptionDuration, OptionAgent:
+		default:
+			return fmt.Errorf("option %s has unsupported type %q", opt.Key, opt.Type)
+		}
+
+		if opt.Default != nil {
+			def, err := opt.Coerce(opt.Default)
+			if err != nil {
+				return fmt.Errorf("option %s has invalid default: %w", opt.Key, err)
+			}
+			opt.Default = def
+		}
+	}
+	return nil
+}
+
+// SchemaFor returns the configuration schema of an agent type known to
+// DefaultTypes
+func SchemaFor(agentType AgentType) (*ConfigSchema, bool) {
+	desc, ok := DefaultTypes.Lookup(agentType)
+	if !ok {
+		return nil, false
+	}
+	return desc.Schema, true
+}
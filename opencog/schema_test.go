@@ -0,0 +1,168 @@
+package opencog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaApplyDefaults(t *testing.T) {
+	schema, ok := SchemaFor(ECANAgent)
+	if !ok {
+		t.Fatal("ecan schema should be registered")
+	}
+
+	config, err := schema.Apply(ECANAgent, nil)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if config["af_size"] != 20 {
+		t.Errorf("Expected default af_size 20, got %v", config["af_size"])
+	}
+	if config["cycle_interval"] != "10s" {
+		t.Errorf("Expected default cycle_interval 10s, got %v", config["cycle_interval"])
+	}
+}
+
+func TestSchemaApplyCoercion(t *testing.T) {
+	schema, _ := SchemaFor(ECANAgent)
+
+	config, err := schema.Apply(ECANAgent, map[string]interface{}{
+		"af_size":        "42",
+		"cycle_interval": "1m",
+	})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if config["af_size"] != 42 {
+		t.Errorf("Expected af_size 42, got %#v", config["af_size"])
+	}
+
+	// Values decoded from JSON arrive as float64
+	config, err = schema.Apply(ECANAgent, map[string]interface{}{"af_size": float64(7)})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if config["af_size"] != 7 {
+		t.Errorf("Expected af_size 7, got %#v", config["af_size"])
+	}
+}
+
+func TestSchemaApplyErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		agentType AgentType
+		config    map[string]interface{}
+		wantErr   string
+	}{
+		{
+			name:      "invalid integer",
+			agentType: ECANAgent,
+			config:    map[string]interface{}{"af_size": "abc"},
+			wantErr:   `invalid value for option af_size of agent type ecan: expected integer, got "abc"`,
+		},
+		{
+			name:      "fractional integer",
+			agentType: ECANAgent,
+			config:    map[string]interface{}{"af_size": 2.5},
+			wantErr:   "expected integer, got 2.5",
+		},
+		{
+			name:      "invalid duration",
+			agentType: ECANAgent,
+			config:    map[string]interface{}{"cycle_interval": "often"},
+			wantErr:   "expected duration",
+		},
+		{
+			name:      "invalid float",
+			agentType: PLNAgent,
+			config:    map[string]interface{}{"min_confidence": "high"},
+			wantErr:   `expected number, got "high"`,
+		},
+		{
+			name:      "invalid choice",
+			agentType: MetaLearningAgent,
+			config:    map[string]interface{}{"strategy": "genetic"},
+			wantErr:   "expected one of grid, random, bandit",
+		},
+		{
+			name:      "unknown option",
+			agentType: ECANAgent,
+			config:    map[string]interface{}{"focus": "1"},
+			wantErr:   `unknown option "focus" for agent type ecan`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, _ := SchemaFor(tt.agentType)
+			_, err := schema.Apply(tt.agentType, tt.config)
+			if err == nil {
+				t.Fatal("Apply should return an error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %q", tt.wantErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestSchemaRequiredOption(t *testing.T) {
+	schema := &ConfigSchema{
+		Options: []ConfigOption{
+			{Key: "endpoint", Type: OptionString, Required: true},
+		},
+	}
+
+	_, err := schema.Apply(CustomAgent, map[string]interface{}{})
+	if err == nil || !strings.Contains(err.Error(), "option endpoint is required") {
+		t.Errorf("Expected required option error, got %v", err)
+	}
+}
+
+func TestCustomSchemaAllowsUnknown(t *testing.T) {
+	schema, _ := SchemaFor(CustomAgent)
+
+	config, err := schema.Apply(CustomAgent, map[string]interface{}{"anything": "goes"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if config["anything"] != "goes" {
+		t.Errorf("Expected unknown key to be preserved, got %v", config["anything"])
+	}
+}
+
+func TestAgentConfigValidateSchema(t *testing.T) {
+	config := AgentConfig{
+		Name:   "attention",
+		Type:   ECANAgent,
+		Config: map[string]interface{}{"af_size": "abc"},
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("Validate should reject invalid af_size")
+	}
+
+	config = AgentConfig{Name: "mystery", Type: AgentType("mystery")}
+	err := config.Validate()
+	if err == nil || !strings.Contains(err.Error(), `unknown agent type "mystery"`) {
+		t.Errorf("Expected unknown agent type error, got %v", err)
+	}
+}
+
+func TestNewAgentAppliesSchema(t *testing.T) {
+	agent, err := NewAgent(AgentConfig{
+		Name:   "attention",
+		Type:   ECANAgent,
+		Config: map[string]interface{}{"af_size": "5"},
+	})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+
+	if agent.Config["af_size"] != 5 {
+		t.Errorf("Expected af_size 5, got %#v", agent.Config["af_size"])
+	}
+	if agent.Config["cycle_interval"] != "10s" {
+		t.Errorf("Expected default cycle_interval, got %#v", agent.Config["cycle_interval"])
+	}
+}
@@ -0,0 +1,124 @@
+package opencog
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/github/hub/v2/opencog/graph"
+)
+
+// Kinds of the edges of the agent topology
+const (
+	DependencyEdge = "dependency"
+	MessageEdge    = "message"
+)
+
+// Dependency is an agent's reference to another agent
+type Dependency struct {
+	From *Agent
+	To   *Agent
+	// Via is the configuration option holding the reference
+	Via string
+}
+
+// Dependencies returns the references between registered agents: options of
+// type agent, the agents the rules of openpsi agents act on, and the agents
+// brokers forward to. References to agents that do not exist are left out.
+func (r *Registry) Dependencies() []Dependency {
+	var deps []Dependency
+	for _, agent := range agentsByName(r) {
+		schema, ok := SchemaFor(agent.Type)
+		if !ok {
+			continue
+		}
+		for _, opt := range schema.Options {
+			if opt.Type != OptionAgent {
+				continue
+			}
+			if to, err := r.GetByName(agent.ConfigString(opt.Key)); err == nil {
+				deps = append(deps, Dependency{From: agent, To: to, Via: opt.Key})
+			}
+		}
+
+		var targets []string
+		switch agent.Type {
+		case OpenPsiAgent:
+			if model, err := PsiModel(r.Dir(), agent); err == nil {
+				for _, rule := range model.Rules {
+					targets = append(targets, rule.Action.Agent)
+				}
+			}
+		case BrokerAgent:
+			if table, err := RoutingTable(r.Dir(), agent); err == nil {
+				targets = table.Agents()
+			}
+		}
+		seen := make(map[string]bool)
+		var names []string
+		for _, name := range targets {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if to, err := r.GetByName(name); err == nil {
+				deps = append(deps, Dependency{From: agent, To: to, Via: "rules"})
+			}
+		}
+	}
+	return deps
+}
+
+// Topology returns the graph of the registered agents: their dependencies,
+// drawn dashed and labeled with the option holding them, and the messages
+// they exchanged, weighted and labeled by count
+func Topology(registry *Registry) (*graph.Graph, error) {
+	g := &graph.Graph{Name: "agents", Dashed: []string{DependencyEdge}}
+	for _, agent := range agentsByName(registry) {
+		g.AddNode(graph.Node{
+			ID:    agent.ID,
+			Label: agent.Name + " (" + string(agent.Type) + ")",
+			Kind:  string(agent.Type),
+		})
+	}
+
+	for _, dep := range registry.Dependencies() {
+		g.AddEdge(graph.Edge{From: dep.From.ID, To: dep.To.ID, Label: dep.Via, Kind: DependencyEdge})
+	}
+
+	flows, err := registry.Traffic()
+	if err != nil {
+		return nil, err
+	}
+	for _, flow := range flows {
+		label := fmt.Sprintf("%d messages", flow.Messages)
+		if flow.Messages == 1 {
+			label = "1 message"
+		}
+		// Flows may outlive agents unregistered by an older hub
+		if _, err := registry.Get(flow.From); err != nil {
+			continue
+		}
+		if _, err := registry.Get(flow.To); err != nil {
+			continue
+		}
+		g.AddEdge(graph.Edge{
+			From:   flow.From,
+			To:     flow.To,
+			Label:  label,
+			Kind:   MessageEdge,
+			Weight: float64(flow.Messages),
+		})
+	}
+	return g, nil
+}
+
+// agentsByName returns the registered agents sorted by name, so that graphs
+// come out the same every time
+func agentsByName(r *Registry) []*Agent {
+	agents := r.List()
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	return agents
+}
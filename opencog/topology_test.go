@@ -0,0 +1,58 @@
+package opencog
+
+import (
+	"testing"
+)
+
+func TestTopology(t *testing.T) {
+	registry, _ := NewRegistry(t.TempDir())
+	kb, _ := NewAgent(AgentConfig{Name: "kb", Type: AtomSpaceAgent})
+	pln, _ := NewAgent(AgentConfig{Name: "pln", Type: PLNAgent, Config: map[string]interface{}{"atomspace": "kb"}})
+	ecan, _ := NewAgent(AgentConfig{Name: "ecan", Type: ECANAgent, Config: map[string]interface{}{"atomspace": "missing"}})
+	for _, agent := range []*Agent{kb, pln, ecan} {
+		registry.Register(agent)
+	}
+
+	deps := registry.Dependencies()
+	if len(deps) != 1 || deps[0].From != pln || deps[0].To != kb || deps[0].Via != "atomspace" {
+		t.Fatalf("Expected pln to depend on kb through atomspace, got %+v", deps)
+	}
+
+	orchestrator := NewOrchestrator(registry)
+	for _, id := range []string{kb.ID, pln.ID, "cli"} {
+		orchestrator.RegisterAgent(id)
+	}
+	for i := 0; i < 3; i++ {
+		orchestrator.SendMessage(&Message{From: pln.ID, To: kb.ID, Type: MessageTypeQuery})
+	}
+	orchestrator.SendMessage(&Message{From: "cli", To: kb.ID, Type: MessageTypeQuery})
+	if err := orchestrator.FlushTraffic(); err != nil {
+		t.Fatalf("FlushTraffic failed: %v", err)
+	}
+	orchestrator.SendMessage(&Message{From: pln.ID, To: kb.ID, Type: MessageTypeQuery})
+	orchestrator.FlushTraffic()
+
+	flows, err := registry.Traffic()
+	if err != nil {
+		t.Fatalf("Traffic failed: %v", err)
+	}
+	if len(flows) != 1 || flows[0] != (Flow{From: pln.ID, To: kb.ID, Messages: 4}) {
+		t.Fatalf("Expected the flushes to add up to 4 messages from pln to kb, got %+v", flows)
+	}
+
+	g, err := Topology(registry)
+	if err != nil {
+		t.Fatalf("Topology failed: %v", err)
+	}
+	if len(g.Nodes) != 3 || g.Nodes[0].Label != "ecan (ecan)" {
+		t.Errorf("Expected the agents sorted by name, got %+v", g.Nodes)
+	}
+	if len(g.Edges) != 2 || g.Edges[0].Kind != DependencyEdge || g.Edges[1].Weight != 4 {
+		t.Errorf("Expected a dependency and a message flow, got %+v", g.Edges)
+	}
+
+	registry.Unregister(kb.ID)
+	if flows, _ := registry.Traffic(); len(flows) != 0 {
+		t.Errorf("Unregistering an agent should forget its traffic, got %+v", flows)
+	}
+}
@@ -0,0 +1,183 @@
+package opencog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Flow is the number of messages one agent sent another
+type Flow struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Messages int64  `json:"messages"`
+	// Errors is the number of the messages that were errors
+	Errors int64 `json:"errors,omitempty"`
+	// Replies is the number of messages from From that To, hosted
+	// in-process, answered, and ReplySeconds the time it took to answer them
+	Replies      int64   `json:"replies,omitempty"`
+	ReplySeconds float64 `json:"reply_seconds,omitempty"`
+}
+
+// add adds the counts of other to the flow
+func (f *Flow) add(other Flow) {
+	f.Messages += other.Messages
+	f.Errors += other.Errors
+	f.Replies += other.Replies
+	f.ReplySeconds += other.ReplySeconds
+}
+
+type flowKey struct {
+	from, to string
+}
+
+// countMessage records a message sent between two agents. The caller must
+// hold the lock.
+func (o *Orchestrator) countMessage(msg *Message) {
+	if msg.From == "" || msg.To == "" {
+		return
+	}
+	flow := o.flow(msg.From, msg.To)
+	flow.Messages++
+	if msg.Type == MessageTypeError {
+		flow.Errors++
+	}
+}
+
+// countReply records the time a hosted agent took to answer a message
+func (o *Orchestrator) countReply(from, to string, took time.Duration) {
+	if from == "" {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	flow := o.flow(from, to)
+	flow.Replies++
+	flow.ReplySeconds += took.Seconds()
+}
+
+// flow returns the traffic counted from one agent to another since the last
+// flush. The caller must hold the lock.
+func (o *Orchestrator) flow(from, to string) *Flow {
+	key := flowKey{from, to}
+	flow, ok := o.traffic[key]
+	if !ok {
+		flow = &Flow{From: from, To: to}
+		o.traffic[key] = flow
+	}
+	return flow
+}
+
+// FlushTraffic adds the messages counted since the last flush to the
+// registry's traffic, so that other processes, such as `hub agent graph`,
+// can show it. The daemon flushes on every coordination tick.
+func (o *Orchestrator) FlushTraffic() error {
+	o.mu.Lock()
+	if len(o.traffic) == 0 {
+		o.mu.Unlock()
+		return nil
+	}
+	flows := make([]Flow, 0, len(o.traffic))
+	for _, flow := range o.traffic {
+		flows = append(flows, *flow)
+	}
+	o.traffic = make(map[flowKey]*Flow)
+	o.mu.Unlock()
+
+	return o.registry.RecordTraffic(flows)
+}
+
+func (r *Registry) trafficPath() string {
+	return filepath.Join(r.dir, "traffic.json")
+}
+
+// Traffic returns the number of messages exchanged between registered
+// agents, busiest flows first
+func (r *Registry) Traffic() ([]Flow, error) {
+	data, err := os.ReadFile(r.trafficPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read traffic: %w", err)
+	}
+
+	var flows []Flow
+	if err := json.Unmarshal(data, &flows); err != nil {
+		return nil, fmt.Errorf("failed to parse traffic: %w", err)
+	}
+	return flows, nil
+}
+
+// RecordTraffic adds flows to the registry's traffic. Flows from or to
+// anything but a registered agent, such as the command line, are left out.
+func (r *Registry) RecordTraffic(flows []Flow) error {
+	recorded, err := r.Traffic()
+	if err != nil {
+		return err
+	}
+
+	totals := make(map[flowKey]*Flow)
+	for i := range recorded {
+		totals[flowKey{recorded[i].From, recorded[i].To}] = &recorded[i]
+	}
+	for _, flow := range flows {
+		if _, err := r.Get(flow.From); err != nil {
+			continue
+		}
+		if _, err := r.Get(flow.To); err != nil {
+			continue
+		}
+		key := flowKey{flow.From, flow.To}
+		if total, ok := totals[key]; ok {
+			total.add(flow)
+		} else {
+			flow := flow
+			totals[key] = &flow
+		}
+	}
+	return r.writeTraffic(totals)
+}
+
+// removeTraffic forgets the flows from and to an agent
+func (r *Registry) removeTraffic(agentID string) error {
+	flows, err := r.Traffic()
+	if err != nil || flows == nil {
+		return err
+	}
+	totals := make(map[flowKey]*Flow)
+	for i, flow := range flows {
+		if flow.From != agentID && flow.To != agentID {
+			totals[flowKey{flow.From, flow.To}] = &flows[i]
+		}
+	}
+	return r.writeTraffic(totals)
+}
+
+func (r *Registry) writeTraffic(totals map[flowKey]*Flow) error {
+	flows := make([]Flow, 0, len(totals))
+	for _, flow := range totals {
+		flows = append(flows, *flow)
+	}
+	sort.Slice(flows, func(i, j int) bool {
+		if flows[i].Messages != flows[j].Messages {
+			return flows[i].Messages > flows[j].Messages
+		}
+		if flows[i].From != flows[j].From {
+			return flows[i].From < flows[j].From
+		}
+		return flows[i].To < flows[j].To
+	})
+
+	data, err := json.MarshalIndent(flows, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal traffic: %w", err)
+	}
+	if err := os.WriteFile(r.trafficPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write traffic: %w", err)
+	}
+	return nil
+}
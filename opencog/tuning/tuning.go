@@ -0,0 +1,328 @@
+// Package tuning searches for the parameter values that score best. A search
+// space bounds each numeric parameter; a strategy proposes the values of the
+// next trial from the scores of the previous ones. Grid search tries every
+// point of a grid in turn, random search samples the space uniformly, and the
+// bandit strategy treats the points of the grid as the arms of a bandit and
+// plays them by their upper confidence bound, so that noisy scores are
+// averaged over repeated trials.
+package tuning
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Strategies names the search strategies
+var Strategies = []string{"grid", "random", "bandit"}
+
+// ErrExhausted is returned by strategies that have no values left to try
+var ErrExhausted = errors.New("search space exhausted")
+
+// gridLevels is the number of values of a parameter without a step on a
+// grid
+const gridLevels = 5
+
+// Parameter bounds the values of a parameter. Values are multiples of Step
+// from Min when Step is positive, and integers when Integer is set.
+type Parameter struct {
+	Key     string  `json:"key"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Step    float64 `json:"step,omitempty"`
+	Integer bool    `json:"integer,omitempty"`
+}
+
+// Space is the parameters searched
+type Space []Parameter
+
+// Values are the values of the parameters of a trial
+type Values map[string]float64
+
+// Key identifies values, so that trials of the same values can be told
+func (v Values) Key() string {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + strconv.FormatFloat(v[key], 'g', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Trial is a trial of values. Higher scores are better; failed trials have
+// no score.
+type Trial struct {
+	Values Values
+	Score  float64
+	Failed bool
+}
+
+// ParseSpace parses a comma-separated list of KEY=MIN:MAX or
+// KEY=MIN:MAX:STEP
+func ParseSpace(s string) (Space, error) {
+	var space Space
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		eq := strings.Index(item, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("expected KEY=MIN:MAX[:STEP], got %q", item)
+		}
+		p := Parameter{Key: strings.TrimSpace(item[:eq])}
+		if seen[p.Key] {
+			return nil, fmt.Errorf("parameter %s is given twice", p.Key)
+		}
+		seen[p.Key] = true
+
+		bounds := strings.Split(item[eq+1:], ":")
+		if len(bounds) < 2 || len(bounds) > 3 {
+			return nil, fmt.Errorf("expected %s=MIN:MAX[:STEP], got %q", p.Key, item)
+		}
+		numbers := make([]float64, len(bounds))
+		for i, bound := range bounds {
+			n, err := strconv.ParseFloat(strings.TrimSpace(bound), 64)
+			if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+				return nil, fmt.Errorf("%s: expected a number, got %q", p.Key, bound)
+			}
+			numbers[i] = n
+		}
+		p.Min, p.Max = numbers[0], numbers[1]
+		if p.Min > p.Max {
+			return nil, fmt.Errorf("%s: minimum %g is above maximum %g", p.Key, p.Min, p.Max)
+		}
+		if len(numbers) == 3 {
+			if p.Step = numbers[2]; p.Step <= 0 {
+				return nil, fmt.Errorf("%s: step must be positive, got %g", p.Key, p.Step)
+			}
+		}
+		space = append(space, p)
+	}
+	if len(space) == 0 {
+		return nil, fmt.Errorf("no parameters to search")
+	}
+	return space, nil
+}
+
+// levels returns the values of the parameter on a grid
+func (p Parameter) levels() []float64 {
+	step := p.Step
+	switch {
+	case step > 0:
+	case p.Integer && p.Max-p.Min < 2*gridLevels:
+		step = 1
+	case p.Max == p.Min:
+		return []float64{p.Min}
+	default:
+		step = (p.Max - p.Min) / (gridLevels - 1)
+	}
+
+	var levels []float64
+	for i := 0; ; i++ {
+		v := p.Min + float64(i)*step
+		// Tolerate the rounding of steps such as 0.1
+		if v > p.Max+step*1e-9 {
+			break
+		}
+		v = p.snap(math.Min(v, p.Max))
+		if len(levels) == 0 || levels[len(levels)-1] != v {
+			levels = append(levels, v)
+		}
+	}
+	return levels
+}
+
+// snap rounds v to the precision of the parameter
+func (p Parameter) snap(v float64) float64 {
+	if p.Integer {
+		return math.Round(v)
+	}
+	if p.Step > 0 {
+		v = p.Min + math.Round((v-p.Min)/p.Step)*p.Step
+	}
+	// Drop the noise of floating point steps, such as 0.30000000000000004
+	v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', 12, 64), 64)
+	return math.Max(p.Min, math.Min(p.Max, v))
+}
+
+// Grid returns every point of the grid over space, varying the last
+// parameter fastest
+func (s Space) Grid() []Values {
+	points := []Values{{}}
+	for _, p := range s {
+		var next []Values
+		for _, point := range points {
+			for _, v := range p.levels() {
+				values := make(Values, len(point)+1)
+				for key, value := range point {
+					values[key] = value
+				}
+				values[p.Key] = v
+				next = append(next, values)
+			}
+		}
+		points = next
+	}
+	return points
+}
+
+// Strategy proposes the values of the next trial
+type Strategy interface {
+	Next(space Space, trials []Trial) (Values, error)
+}
+
+// NewStrategy returns the strategy with the given name. Random choices are
+// drawn from rng.
+func NewStrategy(name string, rng *rand.Rand) (Strategy, error) {
+	switch name {
+	case "grid":
+		return Grid{}, nil
+	case "random":
+		return &Random{rng: rng}, nil
+	case "bandit":
+		return Bandit{Exploration: 1}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q, expected one of %s", name, strings.Join(Strategies, ", "))
+}
+
+// Grid tries the points of the grid in turn
+type Grid struct{}
+
+func (Grid) Next(space Space, trials []Trial) (Values, error) {
+	tried := triedKeys(trials)
+	for _, point := range space.Grid() {
+		if !tried[point.Key()] {
+			return point, nil
+		}
+	}
+	return nil, ErrExhausted
+}
+
+// Random samples the space uniformly
+type Random struct {
+	rng *rand.Rand
+}
+
+func (r *Random) Next(space Space, trials []Trial) (Values, error) {
+	values := make(Values, len(space))
+	for _, p := range space {
+		v := p.Min + r.rng.Float64()*(p.Max-p.Min)
+		if low, high := math.Ceil(p.Min), math.Floor(p.Max); p.Integer && low <= high {
+			// Each integer is as likely as the others, the bounds included
+			v = low + math.Floor(r.rng.Float64()*(high-low+1))
+		}
+		values[p.Key] = p.snap(v)
+	}
+	return values, nil
+}
+
+// Bandit plays the points of the grid as the arms of a bandit: every arm is
+// tried once, then the arm with the highest upper confidence bound on its
+// mean score is played. Exploration scales the bound with the spread of the
+// scores. Arms that only ever failed are not played again.
+type Bandit struct {
+	Exploration float64
+}
+
+func (b Bandit) Next(space Space, trials []Trial) (Values, error) {
+	type arm struct {
+		values   Values
+		sum      float64
+		plays    int
+		failures int
+	}
+	points := space.Grid()
+	arms := make(map[string]*arm, len(points))
+	for _, point := range points {
+		arms[point.Key()] = &arm{values: point}
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	plays := 0
+	for _, trial := range trials {
+		a, ok := arms[trial.Values.Key()]
+		if !ok {
+			continue
+		}
+		if trial.Failed {
+			a.failures++
+			continue
+		}
+		a.sum += trial.Score
+		a.plays++
+		plays++
+		low, high = math.Min(low, trial.Score), math.Max(high, trial.Score)
+	}
+
+	spread := high - low
+	if spread <= 0 {
+		spread = 1
+	}
+	var best *arm
+	bestBound := math.Inf(-1)
+	for _, point := range points {
+		a := arms[point.Key()]
+		if a.plays == 0 {
+			if a.failures == 0 {
+				return a.values, nil
+			}
+			continue
+		}
+		mean := a.sum / float64(a.plays)
+		bound := mean + b.Exploration*spread*math.Sqrt(2*math.Log(float64(plays))/float64(a.plays))
+		if bound > bestBound {
+			best, bestBound = a, bound
+		}
+	}
+	if best == nil {
+		return nil, ErrExhausted
+	}
+	return best.values, nil
+}
+
+// Best returns the values with the highest mean score over their successful
+// trials
+func Best(trials []Trial) (Values, float64, bool) {
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	values := make(map[string]Values)
+	for _, trial := range trials {
+		if trial.Failed {
+			continue
+		}
+		key := trial.Values.Key()
+		sums[key] += trial.Score
+		counts[key]++
+		values[key] = trial.Values
+	}
+
+	bestKey, bestMean := "", math.Inf(-1)
+	for key, sum := range sums {
+		mean := sum / float64(counts[key])
+		if mean > bestMean || (mean == bestMean && key < bestKey) {
+			bestKey, bestMean = key, mean
+		}
+	}
+	if bestKey == "" {
+		return nil, 0, false
+	}
+	return values[bestKey], bestMean, true
+}
+
+func triedKeys(trials []Trial) map[string]bool {
+	tried := make(map[string]bool, len(trials))
+	for _, trial := range trials {
+		tried[trial.Values.Key()] = true
+	}
+	return tried
+}
@@ -0,0 +1,94 @@
+package tuning
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestParseSpace(t *testing.T) {
+	space, err := ParseSpace("rate=0.1:0.3:0.1, size=1:3")
+	if err != nil {
+		t.Fatalf("ParseSpace failed: %v", err)
+	}
+	if len(space) != 2 || space[0] != (Parameter{Key: "rate", Min: 0.1, Max: 0.3, Step: 0.1}) || space[1].Max != 3 {
+		t.Fatalf("Unexpected space %+v", space)
+	}
+
+	for _, bad := range []string{"", "rate", "rate=1", "rate=2:1", "rate=0:1:0", "rate=a:b", "rate=0:1,rate=0:2"} {
+		if _, err := ParseSpace(bad); err == nil {
+			t.Errorf("Expected %q to be refused", bad)
+		}
+	}
+}
+
+func TestGrid(t *testing.T) {
+	space := Space{{Key: "rate", Min: 0.1, Max: 0.3, Step: 0.1}, {Key: "size", Min: 1, Max: 2, Integer: true}}
+	points := space.Grid()
+	if len(points) != 6 || points[1].Key() != "rate=0.1,size=2" || points[5].Key() != "rate=0.3,size=2" {
+		t.Fatalf("Unexpected grid %v", points)
+	}
+	if levels := (Parameter{Key: "x", Min: 0, Max: 1}).levels(); len(levels) != gridLevels || levels[1] != 0.25 {
+		t.Errorf("Expected parameters without a step to have %d levels, got %v", gridLevels, levels)
+	}
+
+	var trials []Trial
+	for i := 0; i < len(points); i++ {
+		values, err := Grid{}.Next(space, trials)
+		if err != nil {
+			t.Fatalf("Next failed after %d trials: %v", i, err)
+		}
+		trials = append(trials, Trial{Values: values, Failed: i == 0})
+	}
+	if _, err := (Grid{}).Next(space, trials); err != ErrExhausted {
+		t.Errorf("Expected the grid to be exhausted, got %v", err)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	space := Space{{Key: "rate", Min: 0, Max: 1, Step: 0.25}, {Key: "size", Min: 1, Max: 3, Integer: true}}
+	strategy, _ := NewStrategy("random", rand.New(rand.NewSource(1)))
+	sizes := make(map[float64]bool)
+	for i := 0; i < 100; i++ {
+		values, err := strategy.Next(space, nil)
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		if r := values["rate"]; r < 0 || r > 1 || r*4 != float64(int(r*4)) {
+			t.Fatalf("Expected rates in steps of 0.25, got %g", r)
+		}
+		sizes[values["size"]] = true
+	}
+	if len(sizes) != 3 || !sizes[1] || !sizes[3] {
+		t.Errorf("Expected every size to be drawn, got %v", sizes)
+	}
+}
+
+func TestBandit(t *testing.T) {
+	space := Space{{Key: "arm", Min: 1, Max: 3, Integer: true}}
+	// Arm 2 scores best, arm 3 always fails
+	score := map[float64]float64{1: 0.2, 2: 0.8}
+
+	var trials []Trial
+	plays := make(map[float64]int)
+	for i := 0; i < 30; i++ {
+		values, err := Bandit{Exploration: 1}.Next(space, trials)
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		arm := values["arm"]
+		plays[arm]++
+		trials = append(trials, Trial{Values: values, Score: score[arm], Failed: arm == 3})
+	}
+	if plays[3] != 1 || plays[2] <= plays[1] {
+		t.Errorf("Expected the best arm to be played most and the failing one once, got %v", plays)
+	}
+
+	best, mean, ok := Best(trials)
+	if !ok || best["arm"] != 2 || math.Abs(mean-0.8) > 1e-9 {
+		t.Errorf("Expected arm 2 to be best, got %v %g", best, mean)
+	}
+	if _, _, ok := Best([]Trial{{Values: Values{"arm": 1}, Failed: true}}); ok {
+		t.Error("Expected failed trials not to be best")
+	}
+}
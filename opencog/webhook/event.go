@@ -0,0 +1,170 @@
+// Package webhook receives GitHub webhook deliveries and routes them to
+// agents. Deliveries are verified against a shared secret, parsed into
+// events, and matched against the routes of a manifest, each naming the agent
+// a matching event is sent to.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/github/hub/v2/github"
+)
+
+// Events lists the events that can be routed
+var Events = []string{"push", "pull_request", "issues", "check_run"}
+
+// ErrUnsupportedEvent is returned when parsing an event that cannot be
+// routed
+var ErrUnsupportedEvent = errors.New("unsupported event")
+
+// Event is a parsed webhook delivery. Only the field matching its name is
+// set among Push, PullRequest, Issue and CheckRun.
+type Event struct {
+	// Name is the event, such as pull_request
+	Name string `json:"event"`
+	// Delivery is the unique ID of the delivery
+	Delivery string `json:"delivery,omitempty"`
+	Action   string `json:"action,omitempty"`
+	// Repository is the full name of the repository, such as github/hub
+	Repository string `json:"repository,omitempty"`
+	// Sender is the login of the user who triggered the event
+	Sender string `json:"sender,omitempty"`
+
+	Push        *Push               `json:"push,omitempty"`
+	PullRequest *github.PullRequest `json:"pull_request,omitempty"`
+	Issue       *github.Issue       `json:"issue,omitempty"`
+	CheckRun    *CheckRun           `json:"check_run,omitempty"`
+}
+
+// Push is the payload of a push event
+type Push struct {
+	Ref     string       `json:"ref"`
+	Before  string       `json:"before"`
+	After   string       `json:"after"`
+	Created bool         `json:"created"`
+	Deleted bool         `json:"deleted"`
+	Forced  bool         `json:"forced"`
+	Commits []PushCommit `json:"commits"`
+}
+
+// Branch returns the branch pushed to, or "" if a tag was pushed
+func (p *Push) Branch() string {
+	if strings.HasPrefix(p.Ref, "refs/heads/") {
+		return strings.TrimPrefix(p.Ref, "refs/heads/")
+	}
+	return ""
+}
+
+// PushCommit is a commit of a push
+type PushCommit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	Author  struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Username string `json:"username,omitempty"`
+	} `json:"author"`
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+}
+
+// CheckRun is the payload of a check_run event
+type CheckRun struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion,omitempty"`
+	HeadSha    string `json:"head_sha"`
+	HTMLURL    string `json:"html_url"`
+}
+
+// Parse parses the body of a delivery of the named event
+func Parse(name, delivery string, body []byte) (*Event, error) {
+	supported := false
+	for _, event := range Events {
+		supported = supported || event == name
+	}
+	if !supported {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEvent, name)
+	}
+
+	var payload struct {
+		Action      string              `json:"action"`
+		Repository  *github.Repository  `json:"repository"`
+		Sender      *github.User        `json:"sender"`
+		PullRequest *github.PullRequest `json:"pull_request"`
+		Issue       *github.Issue       `json:"issue"`
+		CheckRun    *CheckRun           `json:"check_run"`
+		Push
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", name, err)
+	}
+
+	event := &Event{Name: name, Delivery: delivery, Action: payload.Action}
+	if payload.Repository != nil {
+		event.Repository = payload.Repository.FullName
+	}
+	if payload.Sender != nil {
+		event.Sender = payload.Sender.Login
+	}
+
+	switch name {
+	case "push":
+		event.Push = &payload.Push
+		if event.Push.Ref == "" {
+			return nil, fmt.Errorf("invalid push payload: no ref")
+		}
+	case "pull_request":
+		event.PullRequest = payload.PullRequest
+	case "issues":
+		event.Issue = payload.Issue
+	case "check_run":
+		event.CheckRun = payload.CheckRun
+	}
+	if name != "push" && event.PullRequest == nil && event.Issue == nil && event.CheckRun == nil {
+		return nil, fmt.Errorf("invalid %s payload: no %s", name, strings.TrimSuffix(name, "s"))
+	}
+	return event, nil
+}
+
+// Map returns the event as it is written in JSON, to be sent in a message
+func (e *Event) Map() (map[string]interface{}, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to decode event: %w", err)
+	}
+	return m, nil
+}
+
+// Sign returns the X-Hub-Signature-256 header of a delivery of body
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the X-Hub-Signature-256 header of a delivery of body
+func Verify(secret, body []byte, signature string) error {
+	if signature == "" {
+		return fmt.Errorf("missing X-Hub-Signature-256 header")
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		return fmt.Errorf("invalid X-Hub-Signature-256 header %q", signature)
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, body))) {
+		return fmt.Errorf("signature does not match the payload")
+	}
+	return nil
+}
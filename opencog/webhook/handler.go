@@ -0,0 +1,139 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxPayloadSize is the largest payload GitHub delivers
+const maxPayloadSize = 25 << 20
+
+// Recording is a delivery saved to be replayed
+type Recording struct {
+	Event    string          `json:"event"`
+	Delivery string          `json:"delivery,omitempty"`
+	Received time.Time       `json:"received"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// ReadRecording reads a delivery saved by a handler. Without a recorded
+// event name, the whole file is read as the payload of an event named
+// event.
+func ReadRecording(path, event string) (*Recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	rec := &Recording{}
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, fmt.Errorf("invalid recording: %w", err)
+	}
+	if rec.Event == "" || rec.Payload == nil {
+		if event == "" {
+			return nil, fmt.Errorf("not a recorded delivery; give the name of its event to replay it as a payload")
+		}
+		rec = &Recording{Event: event, Payload: data}
+	} else if event != "" && event != rec.Event {
+		return nil, fmt.Errorf("recorded %s delivery, not %s", rec.Event, event)
+	}
+	if rec.Delivery == "" {
+		rec.Delivery = "replay-" + strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return rec, nil
+}
+
+// Handler serves webhook deliveries
+type Handler struct {
+	// Secret is the secret the deliveries are signed with
+	Secret   []byte
+	Manifest *Manifest
+	// Deliver sends an event to the agent of a route matching it
+	Deliver func(route *Route, event *Event)
+	// RecordDir, when set, is where the deliveries of events that can be
+	// routed are saved, to be replayed
+	RecordDir string
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize+1))
+	if err != nil {
+		http.Error(w, "failed to read payload", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxPayloadSize {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := Verify(h.Secret, body, r.Header.Get("X-Hub-Signature-256")); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	name := r.Header.Get("X-GitHub-Event")
+	if name == "ping" {
+		fmt.Fprintln(w, "pong")
+		return
+	}
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	event, err := Parse(name, delivery, body)
+	if errors.Is(err, ErrUnsupportedEvent) {
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "ignored %s event\n", name)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.RecordDir != "" {
+		if err := h.record(name, delivery, body); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	routes := h.Manifest.Match(event)
+	for _, route := range routes {
+		h.Deliver(route, event)
+	}
+	w.WriteHeader(http.StatusAccepted)
+	if len(routes) == 1 {
+		fmt.Fprintln(w, "matched 1 route")
+	} else {
+		fmt.Fprintf(w, "matched %d routes\n", len(routes))
+	}
+}
+
+func (h *Handler) record(name, delivery string, body []byte) error {
+	now := time.Now()
+	rec := &Recording{Event: name, Delivery: delivery, Received: now, Payload: body}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal recording: %w", err)
+	}
+	if err := os.MkdirAll(h.RecordDir, 0755); err != nil {
+		return fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	id := delivery
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		id = fmt.Sprintf("%d", now.UnixNano())
+	}
+	path := filepath.Join(h.RecordDir, now.UTC().Format("20060102-150405")+"-"+name+"-"+id+".json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package webhook
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/github/hub/v2/opencog/internal/yamlmap"
+	"gopkg.in/yaml.v2"
+)
+
+// messageTypes are the message types routes may send
+var messageTypes = []string{"command", "query", "knowledge"}
+
+// Route sends the events it matches to an agent
+type Route struct {
+	// Event is the name of the events matched, such as pull_request
+	Event string `yaml:"event" json:"event"`
+	// Actions, when set, restricts the route to events with one of these
+	// actions, such as opened
+	Actions []string `yaml:"actions,omitempty" json:"actions,omitempty"`
+	// Repositories, when set, restricts the route to events of one of these
+	// repositories, such as github/hub
+	Repositories []string `yaml:"repositories,omitempty" json:"repositories,omitempty"`
+	// Agent is the name of the agent the events are sent to
+	Agent string `yaml:"agent" json:"agent"`
+	// Type is the type of the message, command unless set
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	// Payload is sent along with the event, under its own keys
+	Payload map[string]interface{} `yaml:"payload,omitempty" json:"payload,omitempty"`
+}
+
+// MessageType returns the type of the messages the route sends
+func (r *Route) MessageType() string {
+	if r.Type == "" {
+		return "command"
+	}
+	return r.Type
+}
+
+// Matches tells whether the route matches an event
+func (r *Route) Matches(event *Event) bool {
+	if r.Event != event.Name {
+		return false
+	}
+	if len(r.Actions) > 0 && !containsFold(r.Actions, event.Action) {
+		return false
+	}
+	if len(r.Repositories) > 0 && !containsFold(r.Repositories, event.Repository) {
+		return false
+	}
+	return true
+}
+
+// Message returns the payload of the message sending an event along the
+// route: the route's payload, with the event under "event"
+func (r *Route) Message(event *Event) (map[string]interface{}, error) {
+	m, err := event.Map()
+	if err != nil {
+		return nil, err
+	}
+	payload := make(map[string]interface{}, len(r.Payload)+1)
+	for key, value := range r.Payload {
+		payload[key] = value
+	}
+	payload["event"] = m
+	return payload, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Manifest holds the routes events are sent along
+type Manifest struct {
+	Routes []Route `yaml:"routes" json:"routes"`
+}
+
+// ParseManifest parses a manifest written in YAML
+func ParseManifest(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := yaml.UnmarshalStrict(data, m); err != nil {
+		return nil, err
+	}
+	// Payloads are sent as JSON, which needs string keys
+	for i := range m.Routes {
+		if payload := m.Routes[i].Payload; payload != nil {
+			m.Routes[i].Payload = yamlmap.StringKeys(payload).(map[string]interface{})
+		}
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadManifest reads a manifest from a YAML file
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook manifest: %w", err)
+	}
+	m, err := ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Validate checks that the routes are well-formed
+func (m *Manifest) Validate() error {
+	if len(m.Routes) == 0 {
+		return fmt.Errorf("manifest has no routes")
+	}
+	for i, route := range m.Routes {
+		if !contains(Events, route.Event) {
+			return fmt.Errorf("route %d: unknown event %q, expected one of %s", i+1, route.Event, strings.Join(Events, ", "))
+		}
+		if route.Agent == "" {
+			return fmt.Errorf("route %d: no agent", i+1)
+		}
+		if !contains(messageTypes, route.MessageType()) {
+			return fmt.Errorf("route %d: unknown message type %q, expected one of %s", i+1, route.Type, strings.Join(messageTypes, ", "))
+		}
+		if _, ok := route.Payload["event"]; ok {
+			return fmt.Errorf("route %d: the payload cannot set \"event\", which holds the event", i+1)
+		}
+	}
+	return nil
+}
+
+// Match returns the routes matching an event, in the order they are declared
+func (m *Manifest) Match(event *Event) []*Route {
+	var routes []*Route
+	for i := range m.Routes {
+		if m.Routes[i].Matches(event) {
+			routes = append(routes, &m.Routes[i])
+		}
+	}
+	return routes
+}
+
+// Agents returns the names of the agents of the routes
+func (m *Manifest) Agents() []string {
+	var names []string
+	for _, route := range m.Routes {
+		if !contains(names, route.Agent) {
+			names = append(names, route.Agent)
+		}
+	}
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	pullRequestOpened = `{
+  "action": "opened",
+  "number": 42,
+  "pull_request": {"number": 42, "state": "open", "title": "Add webhooks", "user": {"login": "octocat"},
+    "head": {"ref": "webhooks", "sha": "abc123"}, "base": {"ref": "master", "sha": "def456"}, "merged_at": null},
+  "repository": {"name": "hub", "full_name": "github/hub"},
+  "sender": {"login": "octocat"}
+}`
+	pushed = `{
+  "ref": "refs/heads/master",
+  "before": "def456",
+  "after": "abc123",
+  "commits": [{"id": "abc123", "message": "Add webhooks", "author": {"name": "Mona", "email": "mona@example.com"}, "modified": ["README.md"]}],
+  "repository": {"name": "hub", "full_name": "github/hub"},
+  "sender": {"login": "mona"}
+}`
+	checkRunCompleted = `{
+  "action": "completed",
+  "check_run": {"id": 7, "name": "test", "status": "completed", "conclusion": "failure", "head_sha": "abc123"},
+  "repository": {"full_name": "github/hub"},
+  "sender": {"login": "github-actions"}
+}`
+	issueLabeled = `{
+  "action": "labeled",
+  "issue": {"number": 3, "state": "open", "title": "Crash", "labels": [{"name": "bug"}]},
+  "repository": {"full_name": "github/hub"},
+  "sender": {"login": "mona"}
+}`
+)
+
+func TestParse(t *testing.T) {
+	event, err := Parse("pull_request", "d1", []byte(pullRequestOpened))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.Action != "opened" || event.Repository != "github/hub" || event.Sender != "octocat" ||
+		event.PullRequest == nil || event.PullRequest.Number != 42 || event.PullRequest.Head.Ref != "webhooks" {
+		t.Errorf("Unexpected pull request event %+v", event)
+	}
+
+	event, err = Parse("push", "d2", []byte(pushed))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.Push == nil || event.Push.Branch() != "master" || len(event.Push.Commits) != 1 || event.Push.Commits[0].Author.Email != "mona@example.com" {
+		t.Errorf("Unexpected push event %+v", event.Push)
+	}
+
+	event, err = Parse("check_run", "d3", []byte(checkRunCompleted))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.CheckRun == nil || event.CheckRun.Conclusion != "failure" || event.PullRequest != nil {
+		t.Errorf("Unexpected check run event %+v", event)
+	}
+
+	event, err = Parse("issues", "d4", []byte(issueLabeled))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.Issue == nil || event.Issue.Labels[0].Name != "bug" {
+		t.Errorf("Unexpected issue event %+v", event)
+	}
+	m, err := event.Map()
+	if err != nil {
+		t.Fatalf("Map failed: %v", err)
+	}
+	if m["event"] != "issues" || m["issue"].(map[string]interface{})["title"] != "Crash" {
+		t.Errorf("Unexpected map %v", m)
+	}
+
+	if _, err := Parse("star", "", []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("Expected star events to be unsupported, got %v", err)
+	}
+	if _, err := Parse("issues", "", []byte(`{"action": "opened"}`)); err == nil {
+		t.Error("Expected an issues event without an issue to be invalid")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("s3cret")
+	body := []byte(pushed)
+	signature := Sign(secret, body)
+	if !strings.HasPrefix(signature, "sha256=") {
+		t.Fatalf("Unexpected signature %s", signature)
+	}
+	if err := Verify(secret, body, signature); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+	if err := Verify([]byte("other"), body, signature); err == nil {
+		t.Error("Expected a signature made with another secret to be refused")
+	}
+	if err := Verify(secret, body, ""); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Expected a missing signature to be refused, got %v", err)
+	}
+	if err := Verify(secret, body, "sha1=abc"); err == nil {
+		t.Error("Expected a SHA-1 signature to be refused")
+	}
+}
+
+const manifest = `
+routes:
+  - event: pull_request
+    actions: [opened, reopened]
+    agent: reviewer
+    payload: {action: review}
+  - event: check_run
+    repositories: [github/hub]
+    agent: triage
+    type: knowledge
+  - event: pull_request
+    agent: archivist
+`
+
+func TestManifest(t *testing.T) {
+	m, err := ParseManifest([]byte(manifest))
+	if err != nil {
+		t.Fatalf("ParseManifest failed: %v", err)
+	}
+	if got := strings.Join(m.Agents(), ","); got != "reviewer,triage,archivist" {
+		t.Errorf("Unexpected agents %s", got)
+	}
+
+	opened, _ := Parse("pull_request", "", []byte(pullRequestOpened))
+	routes := m.Match(opened)
+	if len(routes) != 2 || routes[0].Agent != "reviewer" || routes[1].Agent != "archivist" {
+		t.Fatalf("Unexpected routes %+v", routes)
+	}
+	payload, err := routes[0].Message(opened)
+	if err != nil {
+		t.Fatalf("Message failed: %v", err)
+	}
+	if payload["action"] != "review" || payload["event"].(map[string]interface{})["action"] != "opened" {
+		t.Errorf("Unexpected payload %v", payload)
+	}
+
+	closed, _ := Parse("pull_request", "", []byte(strings.Replace(pullRequestOpened, `"opened"`, `"closed"`, 1)))
+	if routes := m.Match(closed); len(routes) != 1 || routes[0].Agent != "archivist" {
+		t.Errorf("Expected only the route without actions to match, got %+v", routes)
+	}
+	check, _ := Parse("check_run", "", []byte(strings.Replace(checkRunCompleted, "github/hub", "github/other", 1)))
+	if routes := m.Match(check); len(routes) != 0 {
+		t.Errorf("Expected no route for another repository, got %+v", routes)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"empty", "routes: []", "no routes"},
+		{"event", "routes: [{event: star, agent: a}]", `unknown event "star"`},
+		{"agent", "routes: [{event: push}]", "no agent"},
+		{"type", "routes: [{event: push, agent: a, type: error}]", "unknown message type"},
+		{"payload", "routes: [{event: push, agent: a, payload: {event: x}}]", "cannot set"},
+		{"unknown field", "routes: [{event: push, agent: a, action: opened}]", "action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseManifest([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m, _ := ParseManifest([]byte(manifest))
+	secret := []byte("s3cret")
+	var delivered []string
+	h := &Handler{
+		Secret:    secret,
+		Manifest:  m,
+		RecordDir: t.TempDir(),
+		Deliver: func(route *Route, event *Event) {
+			delivered = append(delivered, route.Agent+":"+event.Delivery)
+		},
+	}
+
+	post := func(event, body, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("X-GitHub-Event", event)
+		req.Header.Set("X-GitHub-Delivery", "d1")
+		if signature != "" {
+			req.Header.Set("X-Hub-Signature-256", signature)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("pull_request", pullRequestOpened, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unsigned deliveries to be refused, got %d", w.Code)
+	}
+	if w := post("pull_request", pullRequestOpened, Sign([]byte("other"), []byte(pullRequestOpened))); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected badly signed deliveries to be refused, got %d", w.Code)
+	}
+	if w := post("ping", `{}`, Sign(secret, []byte(`{}`))); w.Code != http.StatusOK {
+		t.Errorf("Expected pings to be answered, got %d", w.Code)
+	}
+	if w := post("star", `{}`, Sign(secret, []byte(`{}`))); w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), "ignored") {
+		t.Errorf("Expected unsupported events to be ignored, got %d %s", w.Code, w.Body)
+	}
+	if len(delivered) != 0 {
+		t.Fatalf("Expected nothing to be delivered yet, got %v", delivered)
+	}
+
+	w := post("pull_request", pullRequestOpened, Sign(secret, []byte(pullRequestOpened)))
+	if w.Code != http.StatusAccepted || strings.Join(delivered, ",") != "reviewer:d1,archivist:d1" {
+		t.Fatalf("Expected the event to be routed, got %d %s, delivered %v", w.Code, w.Body, delivered)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET to be refused, got %d", rec.Code)
+	}
+
+	// The routed delivery was recorded, and replays as it was received
+	files, _ := filepath.Glob(filepath.Join(h.RecordDir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one recording, got %v", files)
+	}
+	recording, err := ReadRecording(files[0], "")
+	if err != nil {
+		t.Fatalf("ReadRecording failed: %v", err)
+	}
+	event, err := Parse(recording.Event, recording.Delivery, recording.Payload)
+	if err != nil || event.PullRequest.Number != 42 || event.Delivery != "d1" {
+		t.Errorf("Unexpected replayed event %+v, %v", event, err)
+	}
+
+	// Raw payloads replay with the name of their event
+	raw := filepath.Join(t.TempDir(), "push.json")
+	os.WriteFile(raw, []byte(pushed), 0644)
+	if _, err := ReadRecording(raw, ""); err == nil {
+		t.Error("Expected a raw payload without an event name to be refused")
+	}
+	recording, err = ReadRecording(raw, "push")
+	if err != nil || recording.Event != "push" || recording.Delivery != "replay-push" {
+		t.Errorf("Unexpected recording %+v, %v", recording, err)
+	}
+}
@@ -0,0 +1,319 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status is the state of a run or of one of its steps
+type Status string
+
+const (
+	Pending   Status = "pending"
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	// Skipped steps did not run, because their condition did not hold or a
+	// step they need did not succeed
+	Skipped Status = "skipped"
+)
+
+// StepRun is the record of a step of a run
+type StepRun struct {
+	Name     string                 `json:"name"`
+	Agent    string                 `json:"agent"`
+	Status   Status                 `json:"status"`
+	Attempts int                    `json:"attempts,omitempty"`
+	Started  *time.Time             `json:"started,omitempty"`
+	Finished *time.Time             `json:"finished,omitempty"`
+	Output   map[string]interface{} `json:"output,omitempty"`
+	// Error tells why the step failed or was skipped
+	Error string `json:"error,omitempty"`
+}
+
+// Run is the record of a run of a workflow
+type Run struct {
+	ID       string     `json:"id"`
+	Workflow string     `json:"workflow"`
+	File     string     `json:"file,omitempty"`
+	Status   Status     `json:"status"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Steps    []*StepRun `json:"steps"`
+}
+
+// Step returns the record of the step with the given name
+func (r *Run) Step(name string) *StepRun {
+	for _, step := range r.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	return nil
+}
+
+// Sender sends the message of a step to its agent and returns the payload of
+// the reply, giving up after timeout
+type Sender func(step *Step, timeout time.Duration) (map[string]interface{}, error)
+
+// Runner runs workflows
+type Runner struct {
+	Send Sender
+	// Record, when set, is called with the run every time its status or the
+	// status of one of its steps changes, so that progress can be followed
+	Record func(run *Run) error
+
+	mu  sync.Mutex
+	err error
+}
+
+// Run runs a workflow. Each step starts as soon as the steps it needs are
+// done, so independent branches run side by side. A failed step fails the run
+// and skips the steps depending on it; the other branches run to the end.
+// The error is the first one returned by Record.
+func (r *Runner) Run(w *Workflow, file string) (*Run, error) {
+	r.err = nil
+	now := time.Now()
+	run := &Run{
+		ID:       w.Name + "-" + now.UTC().Format("20060102-150405.000"),
+		Workflow: w.Name,
+		File:     file,
+		Status:   Running,
+		Started:  now,
+	}
+	for _, step := range w.Steps {
+		run.Steps = append(run.Steps, &StepRun{Name: step.Name, Agent: step.Agent, Status: Pending})
+	}
+
+	r.mu.Lock()
+	r.record(run)
+
+	done := make(chan bool)
+	running := 0
+	remaining := len(w.Steps)
+	for remaining > 0 {
+		for progress := true; progress; {
+			progress = false
+			for i := range w.Steps {
+				step := &w.Steps[i]
+				record := run.Step(step.Name)
+				if record.Status != Pending || !r.ready(run, step) {
+					continue
+				}
+				progress = true
+				if reason := r.skip(run, step); reason != "" {
+					record.Status = Skipped
+					record.Error = reason
+					remaining--
+					r.record(run)
+					continue
+				}
+				started := time.Now()
+				record.Status = Running
+				record.Started = &started
+				running++
+				r.record(run)
+				go func() {
+					r.runStep(run, step, record)
+					done <- true
+				}()
+			}
+		}
+		if running == 0 {
+			break
+		}
+		r.mu.Unlock()
+		<-done
+		r.mu.Lock()
+		running--
+		remaining--
+	}
+
+	finished := time.Now()
+	run.Finished = &finished
+	run.Status = Succeeded
+	for _, step := range run.Steps {
+		if step.Status == Failed {
+			run.Status = Failed
+		}
+	}
+	r.record(run)
+	r.mu.Unlock()
+	return run, r.err
+}
+
+// ready tells whether the steps a step needs are all done
+func (r *Runner) ready(run *Run, step *Step) bool {
+	for _, need := range step.Needs {
+		switch run.Step(need).Status {
+		case Pending, Running:
+			return false
+		}
+	}
+	return true
+}
+
+// skip returns why a ready step must not run, or an empty string if it must
+func (r *Runner) skip(run *Run, step *Step) string {
+	for _, need := range step.Needs {
+		if status := run.Step(need).Status; status != Succeeded {
+			return fmt.Sprintf("needs %s, which %s", need, map[Status]string{Failed: "failed", Skipped: "was skipped"}[status])
+		}
+	}
+	if step.When == "" {
+		return ""
+	}
+
+	cond, err := ParseCondition(step.When)
+	if err != nil {
+		return err.Error()
+	}
+	record, err := toJSON(run.Step(cond.Step))
+	if err != nil {
+		return err.Error()
+	}
+	holds, err := cond.Holds(record)
+	if err != nil {
+		return fmt.Sprintf("condition %s: %v", step.When, err)
+	}
+	if !holds {
+		return fmt.Sprintf("condition %s does not hold", step.When)
+	}
+	return ""
+}
+
+// runStep sends the message of a step until it succeeds or runs out of
+// attempts. It is called without holding the lock.
+func (r *Runner) runStep(run *Run, step *Step, record *StepRun) {
+	var output map[string]interface{}
+	var err error
+	for attempt := 1; attempt <= step.Retries+1; attempt++ {
+		if attempt > 1 {
+			time.Sleep(step.RetryDelayDuration())
+		}
+		r.mu.Lock()
+		record.Attempts = attempt
+		if attempt > 1 {
+			r.record(run)
+		}
+		r.mu.Unlock()
+
+		var payload map[string]interface{}
+		if payload, err = r.Send(step, step.TimeoutDuration()); err == nil {
+			// The reply may hold values built in-process; keep what it
+			// says in JSON, as conditions and the record see it
+			var value interface{}
+			if value, err = toJSON(payload); err == nil {
+				output, _ = value.(map[string]interface{})
+				break
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	finished := time.Now()
+	record.Finished = &finished
+	if err != nil {
+		record.Status = Failed
+		record.Error = err.Error()
+	} else {
+		record.Status = Succeeded
+		record.Output = output
+	}
+	r.record(run)
+}
+
+// record passes the run to Record, keeping the first error. It is called
+// holding the lock.
+func (r *Runner) record(run *Run) {
+	if r.Record == nil {
+		return
+	}
+	if err := r.Record(run); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+func toJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode reply: %w", err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("failed to decode reply: %w", err)
+	}
+	return value, nil
+}
+
+// RunsDir returns the directory holding the records of workflow runs
+func RunsDir(configDir string) string {
+	return filepath.Join(configDir, "workflows")
+}
+
+// SaveRun writes the record of a run
+func SaveRun(configDir string, run *Run) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal workflow run: %w", err)
+	}
+	dir := RunsDir(configDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create workflow runs directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, run.ID+".json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write workflow run: %w", err)
+	}
+	return nil
+}
+
+// LoadRun reads the record of the run with the given ID
+func LoadRun(configDir, id string) (*Run, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid run ID %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(RunsDir(configDir), id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("workflow run %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to read workflow run: %w", err)
+	}
+	run := &Run{}
+	if err := json.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow run %s: %w", id, err)
+	}
+	return run, nil
+}
+
+// ListRuns returns the records of all runs, oldest first
+func ListRuns(configDir string) ([]*Run, error) {
+	entries, err := os.ReadDir(RunsDir(configDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read workflow runs: %w", err)
+	}
+	var runs []*Run
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		run, err := LoadRun(configDir, strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Started.Before(runs[j].Started) })
+	return runs, nil
+}
@@ -0,0 +1,389 @@
+// Package workflow runs pipelines of agent requests. A workflow is a directed
+// acyclic graph of steps, each sending a message to an agent and waiting for
+// its reply. A step runs once the steps it needs have succeeded, and only if
+// its condition on their results holds.
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/github/hub/v2/opencog/internal/yamlmap"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultTimeout is how long a step waits for its agent's reply when it sets
+// no timeout
+const DefaultTimeout = 30 * time.Second
+
+// DefaultRetryDelay is the time between the attempts of a step when it sets
+// no retry delay
+const DefaultRetryDelay = time.Second
+
+// messageTypes are the message types steps may send
+var messageTypes = []string{"command", "query", "knowledge"}
+
+// Step sends a message to an agent
+type Step struct {
+	Name string `yaml:"name" json:"name"`
+	// Agent is the name of the agent the message is sent to
+	Agent string `yaml:"agent" json:"agent"`
+	// Type is the type of the message, command unless set
+	Type    string                 `yaml:"type,omitempty" json:"type,omitempty"`
+	Payload map[string]interface{} `yaml:"payload,omitempty" json:"payload,omitempty"`
+	// Needs lists the steps that must succeed before this one runs
+	Needs []string `yaml:"needs,omitempty" json:"needs,omitempty"`
+	// When is a condition on the results of the steps this one needs, such
+	// as "mine.output.run.published > 0". The step is skipped unless it
+	// holds.
+	When string `yaml:"when,omitempty" json:"when,omitempty"`
+	// Timeout bounds each attempt, such as "2m"
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// Retries is the number of times a failed step is attempted again
+	Retries    int    `yaml:"retries,omitempty" json:"retries,omitempty"`
+	RetryDelay string `yaml:"retry_delay,omitempty" json:"retry_delay,omitempty"`
+}
+
+// MessageType returns the type of the message the step sends
+func (s *Step) MessageType() string {
+	if s.Type == "" {
+		return "command"
+	}
+	return s.Type
+}
+
+// TimeoutDuration returns how long each attempt of the step may take
+func (s *Step) TimeoutDuration() time.Duration {
+	return durationOr(s.Timeout, DefaultTimeout)
+}
+
+// RetryDelayDuration returns the time between the attempts of the step
+func (s *Step) RetryDelayDuration() time.Duration {
+	return durationOr(s.RetryDelay, DefaultRetryDelay)
+}
+
+func durationOr(s string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d
+	}
+	return fallback
+}
+
+// Workflow is a named graph of steps
+type Workflow struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Steps       []Step `yaml:"steps" json:"steps"`
+}
+
+// Parse parses a workflow written in YAML
+func Parse(data []byte) (*Workflow, error) {
+	w := &Workflow{}
+	if err := yaml.UnmarshalStrict(data, w); err != nil {
+		return nil, err
+	}
+	// Payloads are sent as JSON, which needs string keys
+	for i := range w.Steps {
+		if payload := w.Steps[i].Payload; payload != nil {
+			w.Steps[i].Payload = yamlmap.StringKeys(payload).(map[string]interface{})
+		}
+	}
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Load reads a workflow from a YAML file
+func Load(path string) (*Workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow: %w", err)
+	}
+	w, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workflow in %s: %w", path, err)
+	}
+	return w, nil
+}
+
+// Validate checks that the steps are well-formed and form a directed acyclic
+// graph, and that conditions only refer to steps that run before
+func (w *Workflow) Validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("workflow has no name")
+	}
+	// Runs are recorded in files named after the workflow
+	if strings.Trim(w.Name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789._-") != "" || strings.HasPrefix(w.Name, ".") {
+		return fmt.Errorf("invalid workflow name %q: use letters, digits, dots, dashes and underscores", w.Name)
+	}
+	if len(w.Steps) == 0 {
+		return fmt.Errorf("workflow %s has no steps", w.Name)
+	}
+
+	steps := make(map[string]*Step)
+	for i := range w.Steps {
+		step := &w.Steps[i]
+		if step.Name == "" {
+			return fmt.Errorf("step %d has no name", i+1)
+		}
+		if steps[step.Name] != nil {
+			return fmt.Errorf("step %s is declared twice", step.Name)
+		}
+		if step.Agent == "" {
+			return fmt.Errorf("step %s has no agent", step.Name)
+		}
+		if !contains(messageTypes, step.MessageType()) {
+			return fmt.Errorf("step %s: unknown message type %q, expected one of %s", step.Name, step.Type, strings.Join(messageTypes, ", "))
+		}
+		for _, d := range []struct{ key, value string }{{"timeout", step.Timeout}, {"retry_delay", step.RetryDelay}} {
+			if d.value == "" {
+				continue
+			}
+			if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+				return fmt.Errorf("step %s: %s must be a positive duration (e.g. 30s, 5m), got %q", step.Name, d.key, d.value)
+			}
+		}
+		if step.Retries < 0 {
+			return fmt.Errorf("step %s: retries must not be negative, got %d", step.Name, step.Retries)
+		}
+		steps[step.Name] = step
+	}
+
+	for _, step := range w.Steps {
+		for _, need := range step.Needs {
+			if steps[need] == nil {
+				return fmt.Errorf("step %s needs unknown step %q", step.Name, need)
+			}
+		}
+	}
+	if _, err := w.Order(); err != nil {
+		return err
+	}
+
+	for _, step := range w.Steps {
+		if step.When == "" {
+			continue
+		}
+		cond, err := ParseCondition(step.When)
+		if err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		if !contains(w.ancestors(step.Name), cond.Step) {
+			return fmt.Errorf("step %s: condition refers to %s, which is not among the steps it needs", step.Name, cond.Step)
+		}
+	}
+	return nil
+}
+
+// Order returns the names of the steps in an order where every step comes
+// after the steps it needs, keeping the declared order where it can
+func (w *Workflow) Order() ([]string, error) {
+	var order []string
+	done := make(map[string]bool)
+	for len(order) < len(w.Steps) {
+		progress := false
+		for _, step := range w.Steps {
+			if done[step.Name] || !all(step.Needs, done) {
+				continue
+			}
+			done[step.Name] = true
+			order = append(order, step.Name)
+			progress = true
+		}
+		if !progress {
+			var cycle []string
+			for _, step := range w.Steps {
+				if !done[step.Name] {
+					cycle = append(cycle, step.Name)
+				}
+			}
+			return nil, fmt.Errorf("steps %s need each other", strings.Join(cycle, ", "))
+		}
+	}
+	return order, nil
+}
+
+// Step returns the step with the given name
+func (w *Workflow) Step(name string) *Step {
+	for i := range w.Steps {
+		if w.Steps[i].Name == name {
+			return &w.Steps[i]
+		}
+	}
+	return nil
+}
+
+// ancestors returns the steps a step needs, directly or not
+func (w *Workflow) ancestors(name string) []string {
+	seen := make(map[string]bool)
+	var visit func(string)
+	visit = func(name string) {
+		for _, need := range w.Step(name).Needs {
+			if !seen[need] {
+				seen[need] = true
+				visit(need)
+			}
+		}
+	}
+	visit(name)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func all(names []string, set map[string]bool) bool {
+	for _, name := range names {
+		if !set[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// operators are the comparisons conditions may use, longest first so that
+// ">=" is not read as ">"
+var operators = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// Condition compares a value from the record of an earlier step with a
+// literal. A condition without an operator holds when the value is set and
+// is not false, zero or empty.
+type Condition struct {
+	// Step is the name of the step the value comes from
+	Step string
+	// Path leads to the value within the step's record, such as
+	// ["output", "run", "published"]
+	Path     []string
+	Operator string
+	Value    interface{}
+}
+
+// ParseCondition parses a condition such as "mine.output.run.published > 0"
+// or `lint.output.verdict == "clean"`. Literals are JSON values; bare words are
+// read as strings.
+func ParseCondition(src string) (*Condition, error) {
+	cond := &Condition{}
+	path := strings.TrimSpace(src)
+	for _, op := range operators {
+		if i := strings.Index(src, op); i >= 0 {
+			path = strings.TrimSpace(src[:i])
+			cond.Operator = op
+			literal := strings.TrimSpace(src[i+len(op):])
+			if literal == "" {
+				return nil, fmt.Errorf("invalid condition %q: nothing to compare with", src)
+			}
+			if err := json.Unmarshal([]byte(literal), &cond.Value); err != nil {
+				cond.Value = literal
+			}
+			break
+		}
+	}
+
+	parts := strings.Split(path, ".")
+	for _, part := range parts {
+		if part == "" || strings.ContainsAny(part, " \t") {
+			return nil, fmt.Errorf("invalid condition %q: expected <step>.<field>[.<field>...] [<operator> <value>]", src)
+		}
+	}
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid condition %q: expected <step>.<field>, such as %s.status", src, parts[0])
+	}
+	cond.Step, cond.Path = parts[0], parts[1:]
+	return cond, nil
+}
+
+// Holds evaluates the condition against the record of its step, as it is
+// written in JSON
+func (c *Condition) Holds(record interface{}) (bool, error) {
+	value := record
+	for _, key := range c.Path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			value = nil
+			break
+		}
+		if value, ok = m[key]; !ok {
+			break
+		}
+	}
+
+	switch c.Operator {
+	case "":
+		return truthy(value), nil
+	case "==":
+		return equal(value, c.Value), nil
+	case "!=":
+		return !equal(value, c.Value), nil
+	}
+
+	a, aok := number(value)
+	b, bok := number(c.Value)
+	if !aok || !bok {
+		return false, fmt.Errorf("cannot compare %v %s %v: both must be numbers", value, c.Operator, c.Value)
+	}
+	switch c.Operator {
+	case ">":
+		return a > b, nil
+	case ">=":
+		return a >= b, nil
+	case "<":
+		return a < b, nil
+	default:
+		return a <= b, nil
+	}
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+func equal(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,256 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const pipeline = `
+name: understand-repo
+steps:
+  - name: mine
+    agent: miner
+    payload: {action: mine, options: {limit: 5}}
+  - name: infer
+    agent: reasoner
+    needs: [mine]
+    payload: {action: forward}
+    when: mine.output.run.published > 0
+    timeout: 2m
+    retries: 2
+    retry_delay: 1ms
+  - name: focus
+    agent: attention
+    needs: [mine]
+    payload: {action: spread}
+  - name: report
+    agent: reporter
+    needs: [infer, focus]
+`
+
+func TestParse(t *testing.T) {
+	w, err := Parse([]byte(pipeline))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if w.Name != "understand-repo" || len(w.Steps) != 4 {
+		t.Fatalf("Unexpected workflow %+v", w)
+	}
+	infer := w.Step("infer")
+	if infer.MessageType() != "command" || infer.TimeoutDuration() != 2*time.Minute || infer.Retries != 2 {
+		t.Errorf("Unexpected step %+v", infer)
+	}
+	if d := w.Step("mine").TimeoutDuration(); d != DefaultTimeout {
+		t.Errorf("Expected the default timeout, got %v", d)
+	}
+	if _, err := json.Marshal(w.Step("mine").Payload); err != nil {
+		t.Errorf("Payloads should be encodable as JSON: %v", err)
+	}
+	order, err := w.Order()
+	if err != nil {
+		t.Fatalf("Order failed: %v", err)
+	}
+	if got := strings.Join(order, ","); got != "mine,infer,focus,report" {
+		t.Errorf("Unexpected order %s", got)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"no name", "steps: [{name: a, agent: x}]", "workflow has no name"},
+		{"bad name", "name: a/b\nsteps: [{name: a, agent: x}]", "invalid workflow name"},
+		{"no steps", "name: w", "has no steps"},
+		{"no agent", "name: w\nsteps: [{name: a}]", "step a has no agent"},
+		{"duplicate", "name: w\nsteps: [{name: a, agent: x}, {name: a, agent: y}]", "declared twice"},
+		{"unknown need", "name: w\nsteps: [{name: a, agent: x, needs: [b]}]", `unknown step "b"`},
+		{"cycle", "name: w\nsteps: [{name: a, agent: x, needs: [b]}, {name: b, agent: x, needs: [a]}]", "steps a, b need each other"},
+		{"type", "name: w\nsteps: [{name: a, agent: x, type: shout}]", "unknown message type"},
+		{"timeout", "name: w\nsteps: [{name: a, agent: x, timeout: soon}]", "timeout must be a positive duration"},
+		{"retries", "name: w\nsteps: [{name: a, agent: x, retries: -1}]", "retries must not be negative"},
+		{"condition", "name: w\nsteps: [{name: a, agent: x}, {name: b, agent: x, needs: [a], when: 'a >'}]", "invalid condition"},
+		{"condition step", "name: w\nsteps: [{name: a, agent: x}, {name: b, agent: x, when: a.status}]", "not among the steps it needs"},
+		{"unknown field", "name: w\nsteps: [{name: a, agent: x, retry: 2}]", "retry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCondition(t *testing.T) {
+	record := map[string]interface{}{
+		"status": "succeeded",
+		"output": map[string]interface{}{
+			"run":   map[string]interface{}{"published": 3.0},
+			"items": []interface{}{},
+		},
+	}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"a.output.run.published > 0", true},
+		{"a.output.run.published >= 3", true},
+		{"a.output.run.published < 3", false},
+		{"a.output.run.published == 3", true},
+		{`a.status == "succeeded"`, true},
+		{"a.status == succeeded", true},
+		{"a.status != failed", true},
+		{"a.output.items", false},
+		{"a.output.run", true},
+		{"a.output.missing.deeper", false},
+	}
+	for _, tt := range tests {
+		cond, err := ParseCondition(tt.src)
+		if err != nil {
+			t.Fatalf("ParseCondition(%q) failed: %v", tt.src, err)
+		}
+		got, err := cond.Holds(record)
+		if err != nil {
+			t.Fatalf("Holds(%q) failed: %v", tt.src, err)
+		}
+		if got != tt.want {
+			t.Errorf("Expected %q to be %v", tt.src, tt.want)
+		}
+	}
+
+	cond, _ := ParseCondition("a.status > 1")
+	if _, err := cond.Holds(record); err == nil {
+		t.Error("Expected comparing a string with > to fail")
+	}
+	for _, src := range []string{"a", "a. == 1", ".status", "a.status =="} {
+		if _, err := ParseCondition(src); err == nil {
+			t.Errorf("Expected %q to be invalid", src)
+		}
+	}
+}
+
+// fakeAgents answers steps with canned replies, failing the first attempts
+// of some
+type fakeAgents struct {
+	mu       sync.Mutex
+	replies  map[string]map[string]interface{}
+	failures map[string]int
+	sent     []string
+}
+
+func (f *fakeAgents) send(step *Step, timeout time.Duration) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, step.Name)
+	if f.failures[step.Agent] > 0 {
+		f.failures[step.Agent]--
+		return nil, fmt.Errorf("%s timed out", step.Agent)
+	}
+	return f.replies[step.Agent], nil
+}
+
+func TestRunner(t *testing.T) {
+	w, err := Parse([]byte(pipeline))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	agents := &fakeAgents{
+		replies: map[string]map[string]interface{}{
+			"miner":    {"run": map[string]int{"published": 2}},
+			"reasoner": {"inferred": 4},
+		},
+		failures: map[string]int{"reasoner": 2},
+	}
+	var records int
+	runner := &Runner{
+		Send: agents.send,
+		Record: func(run *Run) error {
+			records++
+			return nil
+		},
+	}
+	run, err := runner.Run(w, "pipeline.yaml")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if run.Status != Succeeded || run.Finished == nil || run.File != "pipeline.yaml" {
+		t.Fatalf("Unexpected run %+v", run)
+	}
+	infer := run.Step("infer")
+	if infer.Status != Succeeded || infer.Attempts != 3 || infer.Output["inferred"] != 4.0 {
+		t.Errorf("Expected infer to succeed on its third attempt, got %+v", infer)
+	}
+	if report := run.Step("report"); report.Status != Succeeded || report.Started.Before(*infer.Finished) {
+		t.Errorf("Expected report to run after infer, got %+v", report)
+	}
+	if records < 2*len(w.Steps) {
+		t.Errorf("Expected the run to be recorded at every change, got %d records", records)
+	}
+
+	// Without published patterns, inference is skipped, and so is the report
+	// needing it
+	agents = &fakeAgents{replies: map[string]map[string]interface{}{"miner": {"run": map[string]int{"published": 0}}}}
+	run, _ = (&Runner{Send: agents.send}).Run(w, "")
+	if run.Status != Succeeded {
+		t.Errorf("Expected skipped steps not to fail the run, got %s", run.Status)
+	}
+	if infer := run.Step("infer"); infer.Status != Skipped || !strings.Contains(infer.Error, "does not hold") {
+		t.Errorf("Expected infer to be skipped, got %+v", infer)
+	}
+	if report := run.Step("report"); report.Status != Skipped || report.Error != "needs infer, which was skipped" {
+		t.Errorf("Expected report to be skipped, got %+v", report)
+	}
+	if focus := run.Step("focus"); focus.Status != Succeeded {
+		t.Errorf("Expected the other branch to run, got %+v", focus)
+	}
+
+	// A step failing every attempt fails the run
+	agents = &fakeAgents{failures: map[string]int{"miner": 1}}
+	run, _ = (&Runner{Send: agents.send}).Run(w, "")
+	if run.Status != Failed || run.Step("mine").Error != "miner timed out" {
+		t.Errorf("Expected the run to fail, got %+v", run.Step("mine"))
+	}
+	if strings.Join(agents.sent, ",") != "mine" {
+		t.Errorf("Expected no step after the failed one, sent %v", agents.sent)
+	}
+}
+
+func TestRunRecords(t *testing.T) {
+	dir := t.TempDir()
+	if runs, err := ListRuns(dir); err != nil || len(runs) != 0 {
+		t.Fatalf("Expected no runs, got %v, %v", runs, err)
+	}
+
+	w, _ := Parse([]byte("name: w\nsteps: [{name: a, agent: x}]"))
+	agents := &fakeAgents{replies: map[string]map[string]interface{}{"x": {"ok": true}}}
+	runner := &Runner{
+		Send:   agents.send,
+		Record: func(run *Run) error { return SaveRun(dir, run) },
+	}
+	run, err := runner.Run(w, "")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	loaded, err := LoadRun(dir, run.ID)
+	if err != nil {
+		t.Fatalf("LoadRun failed: %v", err)
+	}
+	if loaded.Status != Succeeded || loaded.Step("a").Output["ok"] != true {
+		t.Errorf("Unexpected record %+v", loaded)
+	}
+	runs, err := ListRuns(dir)
+	if err != nil || len(runs) != 1 || runs[0].ID != run.ID {
+		t.Errorf("Expected one run, got %v, %v", runs, err)
+	}
+	if _, err := LoadRun(dir, "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a missing run to be reported, got %v", err)
+	}
+}